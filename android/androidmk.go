@@ -189,41 +189,8 @@ func (a *AndroidMkEntries) fillInEntries(config Config, bpPath string, mod bluep
 	a.Target_required = append(a.Target_required, amod.commonProperties.Target_required...)
 
 	// Fill in the header part.
-	if len(amod.commonProperties.Dist.Targets) > 0 {
-		distFile := a.DistFile
-		if !distFile.Valid() {
-			distFile = a.OutputFile
-		}
-		if distFile.Valid() {
-			dest := filepath.Base(distFile.String())
-
-			if amod.commonProperties.Dist.Dest != nil {
-				var err error
-				if dest, err = validateSafePath(*amod.commonProperties.Dist.Dest); err != nil {
-					// This was checked in ModuleBase.GenerateBuildActions
-					panic(err)
-				}
-			}
-
-			if amod.commonProperties.Dist.Suffix != nil {
-				ext := filepath.Ext(dest)
-				suffix := *amod.commonProperties.Dist.Suffix
-				dest = strings.TrimSuffix(dest, ext) + suffix + ext
-			}
-
-			if amod.commonProperties.Dist.Dir != nil {
-				var err error
-				if dest, err = validateSafePath(*amod.commonProperties.Dist.Dir, dest); err != nil {
-					// This was checked in ModuleBase.GenerateBuildActions
-					panic(err)
-				}
-			}
-
-			goals := strings.Join(amod.commonProperties.Dist.Targets, " ")
-			fmt.Fprintln(&a.header, ".PHONY:", goals)
-			fmt.Fprintf(&a.header, "$(call dist-for-goals,%s,%s:%s)\n",
-				goals, distFile.String(), dest)
-		}
+	for _, dist := range amod.dists() {
+		a.writeDist(mod, dist)
 	}
 
 	fmt.Fprintln(&a.header, "\ninclude $(CLEAR_VARS)")
@@ -324,6 +291,59 @@ func (a *AndroidMkEntries) fillInEntries(config Config, bpPath string, mod bluep
 	}
 }
 
+// writeDist writes the make rules that copy the outputs selected by a dist property to the dist
+// directory.
+func (a *AndroidMkEntries) writeDist(mod blueprint.Module, dist Dist) {
+	var distFiles Paths
+	if dist.Tag != nil {
+		var err error
+		if distFiles, err = distTaggedOutputs(mod, *dist.Tag); err != nil {
+			// This was checked in ModuleBase.GenerateBuildActions
+			panic(err)
+		}
+	} else if a.DistFile.Valid() {
+		distFiles = Paths{a.DistFile.Path()}
+	} else if a.OutputFile.Valid() {
+		distFiles = Paths{a.OutputFile.Path()}
+	}
+
+	if len(distFiles) == 0 {
+		return
+	}
+
+	goals := strings.Join(dist.Targets, " ")
+	fmt.Fprintln(&a.header, ".PHONY:", goals)
+
+	for _, distFile := range distFiles {
+		dest := filepath.Base(distFile.String())
+
+		if dist.Dest != nil {
+			var err error
+			if dest, err = validateSafePath(*dist.Dest); err != nil {
+				// This was checked in ModuleBase.GenerateBuildActions
+				panic(err)
+			}
+		}
+
+		if dist.Suffix != nil {
+			ext := filepath.Ext(dest)
+			suffix := *dist.Suffix
+			dest = strings.TrimSuffix(dest, ext) + suffix + ext
+		}
+
+		if dist.Dir != nil {
+			var err error
+			if dest, err = validateSafePath(*dist.Dir, dest); err != nil {
+				// This was checked in ModuleBase.GenerateBuildActions
+				panic(err)
+			}
+		}
+
+		fmt.Fprintf(&a.header, "$(call dist-for-goals,%s,%s:%s)\n",
+			goals, distFile.String(), dest)
+	}
+}
+
 func (a *AndroidMkEntries) write(w io.Writer) {
 	if a.Disabled {
 		return
@@ -340,6 +360,10 @@ func (a *AndroidMkEntries) write(w io.Writer) {
 	w.Write(a.footer.Bytes())
 }
 
+func (a *AndroidMkEntries) HeaderLinesForTests() []string {
+	return strings.Split(string(a.header.Bytes()), "\n")
+}
+
 func (a *AndroidMkEntries) FooterLinesForTests() []string {
 	return strings.Split(string(a.footer.Bytes()), "\n")
 }
@@ -399,6 +423,11 @@ func translateAndroidMk(ctx SingletonContext, mkFile string, mods []blueprint.Mo
 		}
 	}
 
+	if err := writeDistModuleOutputs(ctx, buf, mods); err != nil {
+		os.Remove(mkFile)
+		return err
+	}
+
 	keys := []string{}
 	fmt.Fprintln(buf, "\nSTATS.SOONG_MODULE_TYPE :=")
 	for k := range type_stats {
@@ -433,6 +462,58 @@ func translateAndroidMk(ctx SingletonContext, mkFile string, mods []blueprint.Mo
 	return ioutil.WriteFile(absolutePath(mkFile), buf.Bytes(), 0666)
 }
 
+// distModuleOutputsEnv lists outputs of modules to copy to the dist directory in addition to the
+// ones selected by the dist properties in the Blueprint files, for example:
+//   m dist DIST_MODULE_OUTPUTS="Settings{.proguard_map}:mappings SystemUI"
+// Each entry is the name of a module, optionally followed by the tag of the outputs in braces and
+// by the directory within the dist directory to copy them to.
+const distModuleOutputsEnv = "DIST_MODULE_OUTPUTS"
+
+// writeDistModuleOutputs writes the make rules that copy the outputs listed in
+// distModuleOutputsEnv to the dist directory.  The outputs are copied from the first enabled
+// variant of each module.
+func writeDistModuleOutputs(ctx SingletonContext, w io.Writer, mods []blueprint.Module) error {
+	for _, entry := range strings.Fields(ctx.Config().Getenv(distModuleOutputsEnv)) {
+		spec, dir := entry, ""
+		if i := strings.LastIndex(entry, ":"); i >= 0 {
+			spec, dir = entry[:i], entry[i+1:]
+		}
+
+		name, tag := SrcIsModuleWithTag(":" + spec)
+		if name == "" || strings.ContainsAny(name, "{}") {
+			return fmt.Errorf("%s: invalid entry %q, expected <module>[{<tag>}][:<dir>]",
+				distModuleOutputsEnv, entry)
+		}
+		if _, err := validateSafePath(dir); err != nil {
+			return fmt.Errorf("%s: invalid entry %q: %s", distModuleOutputsEnv, entry, err)
+		}
+
+		var module blueprint.Module
+		for _, mod := range mods {
+			if amod, ok := mod.(Module); ok && amod.Enabled() && ctx.ModuleName(mod) == name {
+				module = mod
+				break
+			}
+		}
+		if module == nil {
+			return fmt.Errorf("%s: module %q does not exist or is disabled", distModuleOutputsEnv, name)
+		}
+
+		distFiles, err := distTaggedOutputs(module, tag)
+		if err != nil {
+			return fmt.Errorf("%s: module %q: %s", distModuleOutputsEnv, name, err)
+		}
+
+		fmt.Fprintln(w, "\n.PHONY: dist_files")
+		for _, distFile := range distFiles {
+			dest := filepath.Join(dir, filepath.Base(distFile.String()))
+			fmt.Fprintf(w, "$(call dist-for-goals,dist_files,%s:%s)\n", distFile.String(), dest)
+		}
+	}
+
+	return nil
+}
+
 func translateAndroidMkModule(ctx SingletonContext, w io.Writer, mod blueprint.Module) error {
 	defer func() {
 		if r := recover(); r != nil {
@@ -15,8 +15,12 @@
 package android
 
 import (
+	"fmt"
 	"io"
+	"io/ioutil"
 	"reflect"
+	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -76,3 +80,109 @@ func TestAndroidMkSingleton_PassesUpdatedAndroidMkDataToCustomCallback(t *testin
 	assertEqual([]string{"baz"}, m.data.Host_required)
 	assertEqual([]string{"qux"}, m.data.Target_required)
 }
+
+type distTestModule struct {
+	ModuleBase
+	outputs map[string]Paths
+}
+
+func (m *distTestModule) GenerateAndroidBuildActions(ctx ModuleContext) {
+	m.outputs = map[string]Paths{
+		"":     {PathForModuleOut(ctx, "foo.jar")},
+		".map": {PathForModuleOut(ctx, "mapping.txt")},
+	}
+}
+
+func (m *distTestModule) OutputFiles(tag string) (Paths, error) {
+	if paths, ok := m.outputs[tag]; ok {
+		return paths, nil
+	}
+	return nil, fmt.Errorf("unsupported module reference tag %q", tag)
+}
+
+func distTestModuleFactory() Module {
+	module := &distTestModule{}
+	InitAndroidModule(module)
+	return module
+}
+
+func testDistModuleOutputs(t *testing.T, distModuleOutputs string) (string, []error) {
+	t.Helper()
+	bp := `
+	dist_test {
+		name: "foo",
+	}
+	`
+
+	config := TestConfig(buildDir, map[string]string{distModuleOutputsEnv: distModuleOutputs}, bp, nil)
+	config.inMake = true // Enable androidmk Singleton
+
+	ctx := NewTestContext()
+	ctx.RegisterSingletonType("androidmk", AndroidMkSingleton)
+	ctx.RegisterModuleType("dist_test", distTestModuleFactory)
+	ctx.Register(config)
+
+	_, errs := ctx.ParseFileList(".", []string{"Android.bp"})
+	FailIfErrored(t, errs)
+	_, errs = ctx.PrepareBuildActions(config)
+	if len(errs) > 0 {
+		return "", errs
+	}
+
+	mk, err := ioutil.ReadFile(PathForOutput(PathContextForTesting(config), "Android.mk").String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(mk), nil
+}
+
+func TestDistModuleOutputs(t *testing.T) {
+	mk, errs := testDistModuleOutputs(t, "foo{.map}:mappings foo")
+	FailIfErrored(t, errs)
+
+	for _, expected := range []string{
+		"/.intermediates/foo/mapping.txt:mappings/mapping.txt)\n",
+		"/.intermediates/foo/foo.jar:foo.jar)\n",
+	} {
+		found := false
+		for _, line := range strings.Split(mk, "\n") {
+			if strings.HasPrefix(line, "$(call dist-for-goals,dist_files,") && strings.HasSuffix(line+"\n", expected) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected a dist_files rule ending in %q in:\n%s", expected, mk)
+		}
+	}
+}
+
+func TestDistModuleOutputsErrors(t *testing.T) {
+	testCases := []struct {
+		name              string
+		distModuleOutputs string
+		err               string
+	}{
+		{
+			name:              "unknown module",
+			distModuleOutputs: "bar{.map}",
+			err:               `DIST_MODULE_OUTPUTS: module "bar" does not exist or is disabled`,
+		},
+		{
+			name:              "unknown tag",
+			distModuleOutputs: "foo{.apk}",
+			err:               `DIST_MODULE_OUTPUTS: module "foo": unsupported module reference tag ".apk"`,
+		},
+		{
+			name:              "invalid dir",
+			distModuleOutputs: "foo:../mappings",
+			err:               `DIST_MODULE_OUTPUTS: invalid entry "foo:../mappings": Path is outside directory: ../mappings`,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			_, errs := testDistModuleOutputs(t, test.distModuleOutputs)
+			CheckErrorsAgainstExpectations(t, errs, []string{regexp.QuoteMeta(test.err)})
+		})
+	}
+}
@@ -1205,14 +1205,16 @@ func (m *ModuleBase) appendProperties(ctx BottomUpMutatorContext,
 		}
 	}
 
-	err := proptools.ExtendMatchingProperties([]interface{}{dst}, src.Interface(), nil, order)
-	if err != nil {
-		if propertyErr, ok := err.(*proptools.ExtendPropertyError); ok {
-			ctx.PropertyErrorf(propertyErr.Property, "%s", propertyErr.Err.Error())
-		} else {
-			panic(err)
+	m.tracePropertyChanges(ctx, srcPrefix, func() {
+		err := proptools.ExtendMatchingProperties([]interface{}{dst}, src.Interface(), nil, order)
+		if err != nil {
+			if propertyErr, ok := err.(*proptools.ExtendPropertyError); ok {
+				ctx.PropertyErrorf(propertyErr.Property, "%s", propertyErr.Err.Error())
+			} else {
+				panic(err)
+			}
 		}
-	}
+	})
 
 	return ret
 }
@@ -0,0 +1,94 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The artifact_path_requirements singleton enforces that the modules the product installs into a
+// partition are defined in the source directories the product allows for that partition, for
+// example so that a vendor partition only contains modules from the vendor's own directories.
+// Modules that the product doesn't install are not checked.  Every violation is written to a
+// report; unless the requirements are relaxed, the violations are also reported as a single error
+// for the product that lists the offending modules with their Blueprint locations, like Make does
+// for PRODUCT_ARTIFACT_PATH_REQUIREMENTS.
+
+func init() {
+	RegisterSingletonType("artifact_path_requirements", ArtifactPathRequirementsSingleton)
+}
+
+func ArtifactPathRequirementsSingleton() Singleton {
+	return &artifactPathRequirementsSingleton{}
+}
+
+type artifactPathRequirementsSingleton struct{}
+
+// inAllowedSourcePath returns true if dir is one of the allowed directories or a subdirectory of
+// one of them.
+func inAllowedSourcePath(dir string, allowed []string) bool {
+	for _, a := range allowed {
+		a = strings.TrimSuffix(a, "/")
+		if dir == a || strings.HasPrefix(dir, a+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *artifactPathRequirementsSingleton) GenerateBuildActions(ctx SingletonContext) {
+	var violations []string
+	for _, module := range productInstalledModules(ctx) {
+		dir := ctx.ModuleDir(module)
+		reported := make(map[string]bool)
+		for _, spec := range modulePackagingSpecs(module) {
+			installPath := spec.InstallPath()
+			partition, ok := spec.Partition()
+			if !ok || reported[partition] {
+				continue
+			}
+			allowed := ctx.Config().ArtifactPathRequirements(partition)
+			if len(allowed) == 0 || inAllowedSourcePath(dir, allowed) {
+				continue
+			}
+
+			reported[partition] = true
+			violations = append(violations, fmt.Sprintf(
+				"%s (%s) installs %s into %s, which only allows modules from %s",
+				ctx.ModuleName(module), ctx.BlueprintFile(module), installPath.path, partition,
+				strings.Join(allowed, ", ")))
+		}
+	}
+
+	sort.Strings(violations)
+	violations = FirstUniqueStrings(violations)
+
+	product := ctx.Config().ProductName()
+	if len(violations) > 0 && !ctx.Config().ArtifactPathRequirementsRelaxed() {
+		ctx.Errorf("product %q installs modules from outside its artifact path requirements:\n    %s",
+			product, strings.Join(violations, "\n    "))
+	}
+
+	report := PathForOutput(ctx, "artifact_path_requirements_violations.txt")
+	content := ""
+	if len(violations) > 0 {
+		content = "product " + product + ":\n    " + strings.Join(violations, "\n    ") + "\n"
+	}
+	WriteFileRule(ctx, report, content)
+
+	ctx.Phony("artifact_path_requirements_report", report)
+}
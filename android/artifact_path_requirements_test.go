@@ -0,0 +1,109 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/blueprint/proptools"
+)
+
+func testArtifactPathRequirements(t *testing.T, relaxed, inMake bool) (*TestContext, []error) {
+	t.Helper()
+
+	fs := map[string][]byte{
+		"a.txt": nil,
+		"Android.bp": []byte(`
+			test {
+				name: "foo",
+			}
+
+			test {
+				name: "bar",
+				vendor: true,
+			}
+
+			test {
+				name: "qux",
+				vendor: true,
+			}
+		`),
+		"vendor/acme/Android.bp": []byte(`
+			test {
+				name: "baz",
+				vendor: true,
+			}
+		`),
+		"vendor/acme/a.txt": nil,
+	}
+
+	config := TestArchConfig(buildDir, nil, "", fs)
+	config.TestProductVariables.Product_packages = []string{"foo", "bar", "baz"}
+	config.TestProductVariables.Artifact_path_requirements = map[string][]string{
+		"vendor": []string{"vendor/acme"},
+	}
+	config.TestProductVariables.Artifact_path_requirements_relaxed = proptools.BoolPtr(relaxed)
+	config.inMake = inMake
+
+	ctx := NewTestArchContext()
+	ctx.RegisterModuleType("test", targetFilesTestModuleFactory)
+	ctx.RegisterSingletonType("artifact_path_requirements", ArtifactPathRequirementsSingleton)
+	ctx.Register(config)
+
+	_, errs := ctx.ParseBlueprintsFiles("Android.bp")
+	FailIfErrored(t, errs)
+	_, errs = ctx.PrepareBuildActions(config)
+	return ctx, errs
+}
+
+func TestArtifactPathRequirements(t *testing.T) {
+	expectedErrors := []string{
+		`product "test_product" installs modules from outside its artifact path requirements:\n` +
+			`    bar \(Android.bp\) installs target/product/test_device/vendor/etc/bar into vendor, which only allows modules from vendor/acme$`,
+	}
+	t.Run("soong", func(t *testing.T) {
+		_, errs := testArtifactPathRequirements(t, false, false)
+		CheckErrorsAgainstExpectations(t, errs, expectedErrors)
+	})
+	t.Run("embedded in make", func(t *testing.T) {
+		_, errs := testArtifactPathRequirements(t, false, true)
+		CheckErrorsAgainstExpectations(t, errs, expectedErrors)
+	})
+}
+
+func TestArtifactPathRequirementsRelaxed(t *testing.T) {
+	t.Run("soong", func(t *testing.T) {
+		testArtifactPathRequirementsRelaxed(t, false)
+	})
+	t.Run("embedded in make", func(t *testing.T) {
+		testArtifactPathRequirementsRelaxed(t, true)
+	})
+}
+
+func testArtifactPathRequirementsRelaxed(t *testing.T, inMake bool) {
+	ctx, errs := testArtifactPathRequirements(t, true, inMake)
+	FailIfErrored(t, errs)
+
+	report := ctx.SingletonForTests("artifact_path_requirements").Output("artifact_path_requirements_violations.txt")
+	content := ContentFromWriteFileRuleForTests(t, report)
+
+	expected := "product test_product:\n" +
+		"    bar (Android.bp) installs target/product/test_device/vendor/etc/bar into vendor, " +
+		"which only allows modules from vendor/acme"
+	if got := strings.TrimSpace(content); got != expected {
+		t.Errorf("expected violations %q, got %q", expected, got)
+	}
+}
@@ -221,6 +221,7 @@ func TestConfig(buildDir string, env map[string]string, bp string, fs map[string
 	config := &config{
 		productVariables: productVariables{
 			DeviceName:                  stringPtr("test_device"),
+			Product_name:                stringPtr("test_product"),
 			Platform_sdk_version:        intPtr(30),
 			DeviceSystemSdkVersions:     []string{"14", "15"},
 			Platform_systemsdk_versions: []string{"29", "30"},
@@ -357,6 +358,11 @@ func NewConfig(srcDir, buildDir string) (Config, error) {
 		return Config{}, err
 	}
 
+	// soong_ui exports the apps of an unbundled apps build in TARGET_BUILD_APPS.
+	if config.UnbundledBuild() && len(config.productVariables.Unbundled_build_apps) == 0 {
+		config.productVariables.Unbundled_build_apps = strings.Fields(config.Getenv("TARGET_BUILD_APPS"))
+	}
+
 	inMakeFile := filepath.Join(buildDir, ".soong.in_make")
 	if _, err := os.Stat(absolutePath(inMakeFile)); err == nil {
 		config.inMake = true
@@ -593,6 +599,12 @@ func (c *config) BuildNumberFile(ctx PathContext) Path {
 	return PathForOutput(ctx, String(c.productVariables.BuildNumberFile))
 }
 
+// BuildScmRevisionFile returns the file containing the source revision of the build, which is
+// written by soong_ui from BUILD_SCM_REVISION.
+func (c *config) BuildScmRevisionFile(ctx PathContext) Path {
+	return PathForOutput(ctx, "build_scm_revision.txt")
+}
+
 // DeviceName returns the name of the current device target
 // TODO: take an AndroidModuleContext to select the device name for multi-device builds
 func (c *config) DeviceName() string {
@@ -728,6 +740,102 @@ func (c *config) UnbundledBuildUsePrebuiltSdks() bool {
 	return Bool(c.productVariables.Unbundled_build) && !Bool(c.productVariables.Unbundled_build_sdks_from_source)
 }
 
+// Returns the apps that are being built by an unbundled apps build (TARGET_BUILD_APPS), or nil
+// if this is not an unbundled apps build.
+func (c *config) UnbundledBuildApps() []string {
+	if !c.UnbundledBuild() {
+		return nil
+	}
+	return c.productVariables.Unbundled_build_apps
+}
+
+// Returns the name of the module that provides the preloaded-classes file used to lay out the boot
+// image, or an empty string if none is configured.
+func (c *config) BootImagePreloadedClassesModule() string {
+	return String(c.productVariables.Boot_image_preloaded_classes)
+}
+
+// Returns the name of the module that provides the dirty-image-objects file used to lay out the
+// boot image, or an empty string if none is configured.
+func (c *config) BootImageDirtyImageObjectsModule() string {
+	return String(c.productVariables.Boot_image_dirty_image_objects)
+}
+
+// Returns the path of the product-wide dictionary used for obfuscated class, package and member
+// names of shrunk java modules, or an empty string if there is none.
+func (c *config) ProguardObfuscationDictionary() string {
+	return String(c.productVariables.Proguard_obfuscation_dictionary)
+}
+
+// Returns the product-wide package that obfuscated classes of shrunk java modules are repackaged
+// into, or nil if classes are not repackaged.
+func (c *config) ProguardRepackageClasses() *string {
+	return c.productVariables.Proguard_repackage_classes
+}
+
+// Returns the product-wide proguard flags files that are applied to all shrunk java modules.
+func (c *config) ProguardFlagsFiles() []string {
+	return c.productVariables.Proguard_flags_files
+}
+
+// Returns true if the product disables shrinking, obfuscation and optimization for all java
+// modules, which are then dexed without R8.
+func (c *config) ProguardDisabled() bool {
+	return Bool(c.productVariables.Proguard_disabled)
+}
+
+// Returns the name of the product, TARGET_PRODUCT.
+func (c *config) ProductName() string {
+	return String(c.productVariables.Product_name)
+}
+
+// Returns the modules in PRODUCT_PACKAGES, which the product installs along with the modules they
+// require.
+func (c *config) ProductPackages() []string {
+	return c.productVariables.Product_packages
+}
+
+// Returns the maximum total size in bytes of the files installed by Soong into the given partition,
+// or false if the partition has no budget.
+func (c *config) PartitionSizeBudget(partition string) (int64, bool) {
+	budget, ok := c.productVariables.Partition_size_budgets[partition]
+	return budget, ok
+}
+
+// Returns the source directories that modules installed into the given partition must be defined
+// in, or nil if the partition has no requirements.
+func (c *config) ArtifactPathRequirements(partition string) []string {
+	return c.productVariables.Artifact_path_requirements[partition]
+}
+
+// Returns true if violations of the artifact path requirements are only reported instead of
+// failing the build.
+func (c *config) ArtifactPathRequirementsRelaxed() bool {
+	return Bool(c.productVariables.Artifact_path_requirements_relaxed)
+}
+
+// Returns the path of the file that overrides properties of modules for the product, or an empty
+// string if the product does not override any.
+func (c *config) ModuleOverridesFile() string {
+	return String(c.productVariables.ModuleOverridesFile)
+}
+
+// Returns the experimental features enabled for any module by the product, in sorted order.
+func (c *config) ExperimentalFeatures() []string {
+	return SortedStringKeys(c.productVariables.Experimental_features)
+}
+
+// Returns the allowlist of the modules that the given experimental feature is enabled for.
+func (c *config) ExperimentalFeatureAllowlist(feature string) []string {
+	return c.productVariables.Experimental_features[feature]
+}
+
+// Returns the command used to release sign artifacts of modules that set release_signing, or
+// an empty string if the product has not configured one.
+func (c *config) ReleaseSignerCommand() string {
+	return String(c.productVariables.Release_signer_command)
+}
+
 func (c *config) Fuchsia() bool {
 	return Bool(c.productVariables.Fuchsia)
 }
@@ -940,6 +1048,12 @@ func (c *config) BootJars() []string {
 	return jars
 }
 
+// BootJarsPackageAllowList returns the packages that the classes of all the boot jars must be in,
+// including their sub-packages.  If it is empty the packages of the boot jars are not checked.
+func (c *config) BootJarsPackageAllowList() []string {
+	return c.productVariables.BootJarsPackageAllowList
+}
+
 func (c *config) DexpreoptGlobalConfig(ctx PathContext) ([]byte, error) {
 	if c.productVariables.DexpreoptGlobalConfig == nil {
 		return nil, nil
@@ -1215,6 +1329,14 @@ func (c *config) EnforceProductPartitionInterface() bool {
 	return Bool(c.productVariables.EnforceProductPartitionInterface)
 }
 
+func (c *config) EnforceInterPartitionJavaSdkLibrary() bool {
+	return Bool(c.productVariables.EnforceInterPartitionJavaSdkLibrary)
+}
+
+func (c *config) InterPartitionJavaLibraryAllowList() []string {
+	return c.productVariables.InterPartitionJavaLibraryAllowList
+}
+
 func (c *config) InstallExtraFlattenedApexes() bool {
 	return Bool(c.productVariables.InstallExtraFlattenedApexes)
 }
@@ -1274,3 +1396,12 @@ func (c *deviceConfig) DeviceSecondaryArchVariant() string {
 func (c *deviceConfig) BoardUsesRecoveryAsBoot() bool {
 	return Bool(c.config.productVariables.BoardUsesRecoveryAsBoot)
 }
+
+// BoardName returns the name of the board (TARGET_BOOTLOADER_BOARD_NAME), falling back to the
+// device name if the board name is not set.
+func (c *deviceConfig) BoardName() string {
+	if name := String(c.config.productVariables.BoardName); name != "" {
+		return name
+	}
+	return c.config.DeviceName()
+}
@@ -228,14 +228,17 @@ var _ Defaults = (*DefaultsModuleBase)(nil)
 func (defaultable *DefaultableModuleBase) applyDefaults(ctx TopDownMutatorContext,
 	defaultsList []Defaults) {
 
+	base := ctx.Module().base()
 	for _, defaults := range defaultsList {
-		for _, prop := range defaultable.defaultableProperties {
-			if prop == defaultable.defaultableVariableProperties {
-				defaultable.applyDefaultVariableProperties(ctx, defaults, prop)
-			} else {
-				defaultable.applyDefaultProperties(ctx, defaults, prop)
+		base.tracePropertyChanges(ctx, "defaults "+ctx.OtherModuleName(defaults), func() {
+			for _, prop := range defaultable.defaultableProperties {
+				if prop == defaultable.defaultableVariableProperties {
+					defaultable.applyDefaultVariableProperties(ctx, defaults, prop)
+				} else {
+					defaultable.applyDefaultProperties(ctx, defaults, prop)
+				}
 			}
-		}
+		})
 	}
 }
 
@@ -15,8 +15,13 @@
 package android
 
 import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
 	"github.com/google/blueprint"
 	_ "github.com/google/blueprint/bootstrap"
+	"github.com/google/blueprint/proptools"
 )
 
 var (
@@ -97,6 +102,15 @@ var (
 		},
 		"content")
 
+	// writeFileVerbatim writes content that has already been escaped for printf %b, the shell and
+	// ninja by WriteFileRule, without appending a trailing newline.
+	writeFileVerbatim = pctx.AndroidStaticRule("writeFileVerbatim",
+		blueprint.RuleParams{
+			Command:     `/bin/bash -c 'printf %b "$$0" > $out' $content`,
+			Description: "writing file $out",
+		},
+		"content")
+
 	// Used only when USE_GOMA=true is set, to restrict non-goma jobs to the local parallelism value
 	localPool = blueprint.NewBuiltinPool("local_pool")
 
@@ -110,3 +124,96 @@ var (
 func init() {
 	pctx.Import("github.com/google/blueprint/bootstrap")
 }
+
+// writeFileShardSize is the maximum length of the escaped content passed to a single
+// writeFileVerbatim rule, which keeps the command well below the kernel's limit on the length of a
+// single argument.
+const writeFileShardSize = 100000
+
+var writeFileEscaper = strings.NewReplacer(
+	`\`, `\\`, // First escape existing backslashes so they aren't interpreted by printf %b.
+	"\n", `\n`, // Then replace newlines with \n
+)
+
+var writeFileUnescaper = strings.NewReplacer(
+	`\\`, `\`,
+	`\n`, "\n",
+)
+
+// WriteFileRule creates a ninja rule to write content to outputFile.  The content is written
+// verbatim, so it should end with a newline if the file is expected to.  Unlike writing the file
+// directly during analysis, the file is only written when it is needed by the build, and it is
+// tracked by ninja so that it is cleaned up when it is no longer generated.  Content that is too
+// long for a single command line is written in shards that are concatenated into outputFile.
+func WriteFileRule(ctx BuilderContext, outputFile WritablePath, content string) {
+	shards := shardWriteFileContent(content)
+	if len(shards) == 1 {
+		ctx.Build(pctx, BuildParams{
+			Rule:   writeFileVerbatim,
+			Output: outputFile,
+			Args: map[string]string{
+				"content": shards[0],
+			},
+		})
+		return
+	}
+
+	rel, err := filepath.Rel(outputFile.buildDir(), outputFile.String())
+	if err != nil {
+		panic(err)
+	}
+
+	var parts Paths
+	for i, shard := range shards {
+		part := PathForOutput(ctx, fmt.Sprintf("%s.%d", rel, i))
+		ctx.Build(pctx, BuildParams{
+			Rule:   writeFileVerbatim,
+			Output: part,
+			Args: map[string]string{
+				"content": shard,
+			},
+		})
+		parts = append(parts, part)
+	}
+
+	ctx.Build(pctx, BuildParams{
+		Rule:        Cat,
+		Description: "concatenate " + outputFile.Base(),
+		Inputs:      parts,
+		Output:      outputFile,
+	})
+}
+
+// shardWriteFileContent splits content on line boundaries into escaped shards that are each short
+// enough to be passed to a single writeFileVerbatim rule.  A single line that is longer than the
+// shard size is put into a shard of its own.
+func shardWriteFileContent(content string) []string {
+	escape := func(s string) string {
+		escaped := proptools.NinjaAndShellEscape(writeFileEscaper.Replace(s))
+		if escaped == "" {
+			return "''"
+		}
+		return escaped
+	}
+
+	var shards []string
+	// Quoting each line separately overestimates the length of the escaped shard, which is fine
+	// for deciding where to split it.
+	start, size := 0, 0
+	for end := 0; end < len(content); {
+		next := strings.IndexByte(content[end:], '\n')
+		if next == -1 {
+			next = len(content)
+		} else {
+			next = end + next + 1
+		}
+		lineSize := len(escape(content[end:next]))
+		if end > start && size+lineSize > writeFileShardSize {
+			shards = append(shards, escape(content[start:end]))
+			start, size = end, 0
+		}
+		size += lineSize
+		end = next
+	}
+	return append(shards, escape(content[start:]))
+}
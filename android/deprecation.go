@@ -0,0 +1,245 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Property deprecations for the build system.
+//
+// This allows the meaning of a property to change, or a property to be removed, through a managed
+// migration instead of a flag day.  A property is first marked deprecated, which reports a warning
+// for every module that sets it, and later obsolete, which makes setting it an error.  Modules in
+// the paths of the grace allowlist of an obsolete property only get a warning, so the remaining
+// users can be migrated one project at a time while new users are rejected.
+//
+// A property is considered set if it has a non-empty value; nested properties are separated with
+// a '.'.  A warning is printed for every module that uses a deprecated property during the build,
+// and the warnings of all modules are also written to deprecated_properties.txt in the output
+// directory.
+
+func RegisterDeprecationMutator(ctx RegisterMutatorsContext) {
+	ctx.BottomUp("deprecated_properties", deprecationMutator).Parallel()
+}
+
+var propertyDeprecations = []PropertyDeprecation{}
+
+func init() {
+	RegisterSingletonType("deprecated_properties", DeprecatedPropertiesSingleton)
+}
+
+// Add property deprecations to the set of deprecations to apply.
+func AddPropertyDeprecations(deprecations ...PropertyDeprecation) {
+	propertyDeprecations = append(propertyDeprecations, deprecations...)
+}
+
+// A deprecation of a module property.
+type PropertyDeprecation interface {
+	// ModuleType restricts the deprecation to modules of the given types.
+	ModuleType(types ...string) PropertyDeprecation
+
+	// Obsolete makes setting the property an error outside of the paths allowed by AllowedIn.
+	Obsolete() PropertyDeprecation
+
+	// AllowedIn adds paths to the grace allowlist, in which setting an obsolete property is only
+	// a warning.
+	AllowedIn(path ...string) PropertyDeprecation
+
+	// Because sets the message that tells users what to use instead.
+	Because(reason string) PropertyDeprecation
+}
+
+type propertyDeprecation struct {
+	property string
+	fields   []string
+
+	// User string for what to do instead.
+	reason string
+
+	moduleTypes []string
+
+	obsolete bool
+
+	allowedPaths []string
+}
+
+// Create a new deprecation of the given property.
+func DeprecatedProperty(property string) PropertyDeprecation {
+	return &propertyDeprecation{
+		property: property,
+		fields:   fieldNamesForProperties(property),
+	}
+}
+
+func (d *propertyDeprecation) ModuleType(types ...string) PropertyDeprecation {
+	d.moduleTypes = append(d.moduleTypes, types...)
+	return d
+}
+
+func (d *propertyDeprecation) Obsolete() PropertyDeprecation {
+	d.obsolete = true
+	return d
+}
+
+func (d *propertyDeprecation) AllowedIn(path ...string) PropertyDeprecation {
+	d.allowedPaths = append(d.allowedPaths, cleanPaths(path)...)
+	return d
+}
+
+func (d *propertyDeprecation) Because(reason string) PropertyDeprecation {
+	d.reason = reason
+	return d
+}
+
+func (d *propertyDeprecation) String() string {
+	s := "deprecated property " + d.property
+	if d.obsolete {
+		s = "obsolete property " + d.property
+	}
+	if d.reason != "" {
+		s += ": " + d.reason
+	}
+	return s
+}
+
+func (d *propertyDeprecation) appliesToModuleType(moduleType string) bool {
+	return len(d.moduleTypes) == 0 || InList(moduleType, d.moduleTypes)
+}
+
+func (d *propertyDeprecation) allowedInPath(dir string) bool {
+	return HasAnyPrefix(dir, d.allowedPaths)
+}
+
+func (d *propertyDeprecation) isSet(properties []interface{}) bool {
+	return hasProperty(properties, ruleProperty{fields: d.fields, matcher: isSetMatcherInstance})
+}
+
+func deprecationMutator(ctx BottomUpMutatorContext) {
+	m, ok := ctx.Module().(Module)
+	if !ok {
+		return
+	}
+
+	dir := ctx.ModuleDir() + "/"
+	properties := m.GetProperties()
+
+	for _, d := range propertyDeprecationsForConfig(ctx.Config()) {
+		n := d.(*propertyDeprecation)
+		if !n.appliesToModuleType(ctx.ModuleType()) {
+			continue
+		}
+
+		if !n.isSet(properties) {
+			continue
+		}
+
+		if n.obsolete && !n.allowedInPath(dir) {
+			ctx.ModuleErrorf("uses %s", n.String())
+			continue
+		}
+
+		deprecationWarningsForConfig(ctx.Config()).add(fmt.Sprintf("%s: module %q uses %s",
+			ctx.BlueprintsFile(), ctx.ModuleName(), n.String()))
+	}
+}
+
+type deprecationWarnings struct {
+	sync.Mutex
+	warnings []string
+}
+
+func (w *deprecationWarnings) add(warning string) {
+	w.Lock()
+	defer w.Unlock()
+	w.warnings = append(w.warnings, warning)
+}
+
+var deprecationWarningsKey = NewOnceKey("deprecationWarnings")
+
+func deprecationWarningsForConfig(config Config) *deprecationWarnings {
+	return config.Once(deprecationWarningsKey, func() interface{} {
+		return &deprecationWarnings{}
+	}).(*deprecationWarnings)
+}
+
+var propertyDeprecationsKey = NewOnceKey("propertyDeprecations")
+
+func propertyDeprecationsForConfig(config Config) []PropertyDeprecation {
+	return config.Once(propertyDeprecationsKey, func() interface{} {
+		// No test deprecations were set by SetTestPropertyDeprecations, use the global ones
+		return propertyDeprecations
+	}).([]PropertyDeprecation)
+}
+
+// Overrides the default property deprecations for the supplied config.
+//
+// For testing only.
+func SetTestPropertyDeprecations(config Config, testDeprecations []PropertyDeprecation) {
+	config.Once(propertyDeprecationsKey, func() interface{} { return testDeprecations })
+}
+
+var deprecationWarningsWriterKey = NewOnceKey("deprecationWarningsWriter")
+
+func deprecationWarningsWriterForConfig(config Config) io.Writer {
+	return config.Once(deprecationWarningsWriterKey, func() interface{} {
+		return os.Stderr
+	}).(io.Writer)
+}
+
+// Overrides the writer the deprecation warnings are printed to for the supplied config.
+//
+// For testing only.
+func SetTestDeprecationWarningsWriter(config Config, w io.Writer) {
+	config.Once(deprecationWarningsWriterKey, func() interface{} { return w })
+}
+
+func DeprecatedPropertiesSingleton() Singleton {
+	return &deprecatedPropertiesSingleton{}
+}
+
+type deprecatedPropertiesSingleton struct{}
+
+// GenerateBuildActions prints the warnings collected by the deprecated_properties mutator, with
+// one line per module even if the module has multiple variants, and writes them to a report that
+// is built by the deprecated_properties_report phony target.
+func (d *deprecatedPropertiesSingleton) GenerateBuildActions(ctx SingletonContext) {
+	w := deprecationWarningsForConfig(ctx.Config())
+	w.Lock()
+	warnings := CopyOf(w.warnings)
+	w.Unlock()
+
+	sort.Strings(warnings)
+	warnings = FirstUniqueStrings(warnings)
+
+	out := deprecationWarningsWriterForConfig(ctx.Config())
+	for _, warning := range warnings {
+		fmt.Fprintln(out, "warning: "+warning)
+	}
+
+	report := PathForOutput(ctx, "deprecated_properties.txt")
+	content := ""
+	if len(warnings) > 0 {
+		content = strings.Join(warnings, "\n") + "\n"
+	}
+	WriteFileRule(ctx, report, content)
+
+	ctx.Phony("deprecated_properties_report", report)
+}
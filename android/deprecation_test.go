@@ -0,0 +1,171 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var deprecationTests = []struct {
+	name           string
+	deprecations   []PropertyDeprecation
+	fs             map[string][]byte
+	expectedErrors []string
+	expectedReport []string
+}{
+	{
+		name: "deprecated",
+		deprecations: []PropertyDeprecation{
+			DeprecatedProperty("sdk_version").Because("use min_sdk_version instead."),
+		},
+		fs: map[string][]byte{
+			"top/Android.bp": []byte(`
+				cc_library {
+					name: "libfoo",
+					sdk_version: "current",
+				}
+
+				cc_library {
+					name: "libbar",
+				}`),
+		},
+		expectedReport: []string{
+			`top/Android.bp: module "libfoo" uses deprecated property sdk_version: use min_sdk_version instead.`,
+		},
+	},
+	{
+		name: "nested property",
+		deprecations: []PropertyDeprecation{
+			DeprecatedProperty("vndk.enabled"),
+		},
+		fs: map[string][]byte{
+			"top/Android.bp": []byte(`
+				cc_library {
+					name: "libfoo",
+					vndk: {
+						enabled: false,
+					},
+				}`),
+		},
+		expectedReport: []string{
+			`top/Android.bp: module "libfoo" uses deprecated property vndk.enabled`,
+		},
+	},
+	{
+		name: "module type",
+		deprecations: []PropertyDeprecation{
+			DeprecatedProperty("sdk_version").ModuleType("java_library"),
+		},
+		fs: map[string][]byte{
+			"top/Android.bp": []byte(`
+				cc_library {
+					name: "libfoo",
+					sdk_version: "current",
+				}`),
+		},
+	},
+	{
+		name: "obsolete",
+		deprecations: []PropertyDeprecation{
+			DeprecatedProperty("include_dirs").Obsolete().AllowedIn("legacy").
+				Because("use export_include_dirs of a dependency instead."),
+		},
+		fs: map[string][]byte{
+			"top/Android.bp": []byte(`
+				cc_library {
+					name: "libfoo",
+					include_dirs: ["bar"],
+				}`),
+			"legacy/Android.bp": []byte(`
+				cc_library {
+					name: "liblegacy",
+					include_dirs: ["bar"],
+				}`),
+			"legacyfoo/Android.bp": []byte(`
+				cc_library {
+					name: "liblegacyfoo",
+					include_dirs: ["bar"],
+				}`),
+		},
+		expectedErrors: []string{
+			`module "libfoo": uses obsolete property include_dirs: use export_include_dirs`,
+			`module "liblegacyfoo": uses obsolete property include_dirs: use export_include_dirs`,
+		},
+	},
+	{
+		name: "grace allowlist",
+		deprecations: []PropertyDeprecation{
+			DeprecatedProperty("include_dirs").Obsolete().AllowedIn("legacy"),
+		},
+		fs: map[string][]byte{
+			"legacy/foo/Android.bp": []byte(`
+				cc_library {
+					name: "liblegacy",
+					include_dirs: ["bar"],
+				}`),
+		},
+		expectedReport: []string{
+			`legacy/foo/Android.bp: module "liblegacy" uses obsolete property include_dirs`,
+		},
+	},
+}
+
+func TestPropertyDeprecations(t *testing.T) {
+	for _, test := range deprecationTests {
+		t.Run(test.name, func(t *testing.T) {
+			config := TestConfig(buildDir, nil, "", test.fs)
+			SetTestPropertyDeprecations(config, test.deprecations)
+			var printed bytes.Buffer
+			SetTestDeprecationWarningsWriter(config, &printed)
+
+			ctx := NewTestContext()
+			ctx.RegisterModuleType("cc_library", newMockCcLibraryModule)
+			ctx.PostDepsMutators(RegisterDeprecationMutator)
+			ctx.RegisterSingletonType("deprecated_properties", DeprecatedPropertiesSingleton)
+			ctx.Register(config)
+
+			_, errs := ctx.ParseBlueprintsFiles("Android.bp")
+			FailIfErrored(t, errs)
+			_, errs = ctx.PrepareBuildActions(config)
+			CheckErrorsAgainstExpectations(t, errs, test.expectedErrors)
+			if len(errs) > 0 {
+				return
+			}
+
+			report := ctx.SingletonForTests("deprecated_properties").Output("deprecated_properties.txt")
+			content := ContentFromWriteFileRuleForTests(t, report)
+
+			var got []string
+			if s := strings.TrimSpace(content); s != "" {
+				got = strings.Split(s, "\n")
+			}
+			if !reflect.DeepEqual(got, test.expectedReport) {
+				t.Errorf("expected deprecation warnings %q, got %q", test.expectedReport, got)
+			}
+
+			// The warnings are also printed during the build.
+			var expectedPrinted string
+			for _, warning := range test.expectedReport {
+				expectedPrinted += "warning: " + warning + "\n"
+			}
+			if printed.String() != expectedPrinted {
+				t.Errorf("expected printed deprecation warnings %q, got %q", expectedPrinted, printed.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/blueprint/proptools"
+)
+
+// The device_push singleton writes a script, out/soong/device_push/device_push.sh, that pushes the
+// files of the modules given as arguments to the connected device with adb after remounting the
+// partitions, which lets framework developers test a change without flashing a new image, for
+// example with "m foo && out/soong/device_push/device_push.sh foo".  The script reads the files of
+// every module that installs files onto the device from a manifest, so that the build has a single
+// rule for the manifest and a single rule for the script instead of rules for every module.  The
+// compiled code of the pushed jars and apks is removed from the device, and the runtime is
+// restarted so that it loads the new code instead of the stale compiled one.  Talking to the device
+// is left to the script instead of the build, so that the build never depends on the state of a
+// device.
+
+func init() {
+	RegisterSingletonType("device_push", DevicePushSingleton)
+}
+
+// devicePushPartitions are the partitions that are mounted at /<partition> on a running device.
+var devicePushPartitions = []string{"data", "odm", "product", "system", "system_ext", "vendor"}
+
+// devicePushScript reads lines of tab separated "<module> <action> <argument> <device path>"
+// entries from the manifest, where the action is push to push the built file in the argument,
+// symlink to create a symlink to the argument, or clean to remove the files matching the glob
+// patterns in the argument and restart the runtime.  The script is preceded by the assignments of
+// ADB and MANIFEST.
+const devicePushScript = `# Pushes the files of the given modules to the connected device, build them first with m <modules>.
+if [ $# -eq 0 ]; then
+  echo "usage: $0 <module>..." >&2
+  exit 1
+fi
+cd "${ANDROID_BUILD_TOP:?run lunch first}"
+
+entries=()
+for module in "$@"; do
+  found=
+  while IFS=$'\t' read -r name action arg dest; do
+    if [ "${name}" = "${module}" ]; then
+      found=true
+      entries+=("${action}"$'\t'"${arg}"$'\t'"${dest}")
+    fi
+  done < "${MANIFEST}"
+  if [ -z "${found}" ]; then
+    echo "${module} doesn't install files onto the device" >&2
+    exit 1
+  fi
+done
+
+"${ADB}" root
+"${ADB}" wait-for-device
+"${ADB}" remount
+
+restart=
+for entry in "${entries[@]}"; do
+  IFS=$'\t' read -r action arg dest <<< "${entry}"
+  case "${action}" in
+    push) "${ADB}" push "${arg}" "${dest}" ;;
+    symlink) "${ADB}" shell "ln -sf '${arg}' '${dest}'" ;;
+    clean) "${ADB}" shell "rm -rf ${arg}"; restart=true ;;
+  esac
+done
+
+if [ -n "${restart}" ]; then
+  "${ADB}" shell stop
+  "${ADB}" shell start
+fi
+`
+
+func DevicePushSingleton() Singleton {
+	return &devicePushSingleton{}
+}
+
+type devicePushSingleton struct{}
+
+func (s *devicePushSingleton) GenerateBuildActions(ctx SingletonContext) {
+	pushes := make(map[string][]PackagingSpec)
+	ctx.VisitAllModules(func(module Module) {
+		for _, spec := range modulePackagingSpecs(module) {
+			partition, ok := spec.Partition()
+			if !ok || !InList(partition, devicePushPartitions) {
+				continue
+			}
+			name := ctx.ModuleName(module)
+			pushes[name] = append(pushes[name], spec)
+		}
+	})
+
+	if len(pushes) == 0 {
+		return
+	}
+
+	var entries []string
+	entry := func(name, action, arg, devicePath string) {
+		entries = append(entries, strings.Join([]string{name, action, arg, devicePath}, "\t"))
+	}
+	for _, name := range SortedStringKeys(pushes) {
+		specs := pushes[name]
+		sort.SliceStable(specs, func(a, b int) bool {
+			return specs[a].installPath.path < specs[b].installPath.path
+		})
+
+		for i, spec := range specs {
+			if i > 0 && spec.installPath.path == specs[i-1].installPath.path {
+				continue
+			}
+			devicePath, _ := spec.DevicePath()
+			if spec.SymlinkTarget() != "" {
+				entry(name, "symlink", spec.SymlinkTarget(), devicePath)
+				continue
+			}
+			entry(name, "push", spec.SrcPath().String(), devicePath)
+			if ext := filepath.Ext(devicePath); ext == ".jar" || ext == ".apk" {
+				entry(name, "clean", strings.Join(compiledCodeOnDevice(devicePath), " "), "")
+			}
+		}
+	}
+
+	manifest := PathForOutput(ctx, "device_push", "device_push.manifest")
+	WriteFileRule(ctx, manifest, strings.Join(entries, "\n")+"\n")
+
+	adb := ctx.Config().HostToolPath(ctx, "adb")
+	scriptContent := PathForOutput(ctx, "device_push", "device_push.sh.in")
+	WriteFileRule(ctx, scriptContent, "#!/bin/bash -e\n"+
+		"ADB="+proptools.ShellEscape(adb.String())+"\n"+
+		"MANIFEST="+proptools.ShellEscape(manifest.String())+"\n"+
+		devicePushScript)
+
+	// The script is copied to make it executable.
+	script := PathForOutput(ctx, "device_push", "device_push.sh")
+	ctx.Build(pctx, BuildParams{
+		Rule:      CpExecutable,
+		Input:     scriptContent,
+		Implicits: Paths{manifest, adb},
+		Output:    script,
+	})
+
+	ctx.Phony("device_push", script)
+}
+
+// compiledCodeOnDevice returns the glob patterns of the files that contain the compiled code of a jar
+// or apk on the device: the dexpreopted code installed next to it, and the code compiled on the
+// device into the dalvik cache.
+func compiledCodeOnDevice(devicePath string) []string {
+	dir := filepath.Dir(devicePath)
+	base := strings.TrimSuffix(filepath.Base(devicePath), filepath.Ext(devicePath))
+	cacheName := strings.ReplaceAll(strings.TrimPrefix(devicePath, "/"), "/", "@")
+	return []string{
+		dir + "/oat/*/" + base + ".art",
+		dir + "/oat/*/" + base + ".odex",
+		dir + "/oat/*/" + base + ".vdex",
+		"/data/dalvik-cache/*/" + cacheName + "@classes.*",
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"strings"
+	"testing"
+)
+
+type devicePushTestModule struct {
+	ModuleBase
+}
+
+func (m *devicePushTestModule) GenerateAndroidBuildActions(ctx ModuleContext) {
+	ctx.InstallFile(PathForModuleInstall(ctx, "framework"), ctx.ModuleName()+".jar", PathForModuleSrc(ctx, "a.jar"))
+}
+
+func devicePushTestModuleFactory() Module {
+	module := &devicePushTestModule{}
+	InitAndroidArchModule(module, DeviceSupported, MultilibCommon)
+	return module
+}
+
+func TestDevicePush(t *testing.T) {
+	t.Run("soong", func(t *testing.T) {
+		testDevicePush(t, false)
+	})
+	t.Run("embedded in make", func(t *testing.T) {
+		testDevicePush(t, true)
+	})
+}
+
+func testDevicePush(t *testing.T, inMake bool) {
+	bp := `
+		test {
+			name: "foo",
+		}
+
+		jar {
+			name: "bar",
+		}
+	`
+
+	config := TestArchConfig(buildDir, nil, bp, map[string][]byte{"a.txt": nil, "a.jar": nil})
+	config.inMake = inMake
+
+	ctx := NewTestArchContext()
+	ctx.RegisterModuleType("test", targetFilesTestModuleFactory)
+	ctx.RegisterModuleType("jar", devicePushTestModuleFactory)
+	ctx.RegisterSingletonType("device_push", DevicePushSingleton)
+	ctx.Register(config)
+
+	_, errs := ctx.ParseFileList(".", []string{"Android.bp"})
+	FailIfErrored(t, errs)
+	_, errs = ctx.PrepareBuildActions(config)
+	FailIfErrored(t, errs)
+
+	singleton := ctx.SingletonForTests("device_push")
+
+	manifest := ContentFromWriteFileRuleForTests(t, singleton.Output("device_push/device_push.manifest"))
+	for _, expected := range []string{
+		"foo\tpush\ta.txt\t/system/etc/foo\n",
+		"bar\tpush\ta.jar\t/system/framework/bar.jar\n",
+		"bar\tclean\t/system/framework/oat/*/bar.art /system/framework/oat/*/bar.odex " +
+			"/system/framework/oat/*/bar.vdex /data/dalvik-cache/*/system@framework@bar.jar@classes.*\t\n",
+	} {
+		if !strings.Contains(manifest, expected) {
+			t.Errorf("expected %q in push manifest %q", expected, manifest)
+		}
+	}
+	if strings.Contains(manifest, "foo\tclean") {
+		t.Errorf("expected no runtime restart when pushing files without code, got %q", manifest)
+	}
+
+	script := singleton.Output("device_push/device_push.sh")
+	if !InList(singleton.Output("device_push/device_push.manifest").Output.String(), script.Implicits.Strings()) {
+		t.Errorf("expected the push script to depend on the manifest, got implicits %q",
+			script.Implicits.Strings())
+	}
+	if r := singleton.MaybeOutput("device_push/foo-push.sh"); r.Rule != nil {
+		t.Errorf("expected no per module push scripts")
+	}
+}
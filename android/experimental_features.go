@@ -0,0 +1,223 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Experimental features are changes to how modules are built, for example a new dexer or a new
+// resource compiler, that are rolled out incrementally instead of for all modules at once.  A
+// module type checks whether a feature is enabled for a module with ExperimentalFeatureEnabled,
+// and the product enables the feature for the modules in its allowlist in
+// Experimental_features, for example:
+//
+//   "Experimental_features": {
+//       "r8_full_mode": ["Settings", "packages/apps/", "frameworks/base/packages/SystemUI/"]
+//   }
+//
+// An allowlist entry that ends with a '/' matches all modules in the directory and its
+// subdirectories, "*" matches all modules, and any other entry matches the module with that name.
+//
+// The adoption of every feature, the modules that checked it and the ones that it is enabled
+// for, is written to experimental_features.txt in the output directory by the
+// experimental_features_report phony target.  The number of modules that checked each feature and
+// the number of modules that it is enabled for are written to .experimental_features.metrics,
+// which soong_ui adds to the build metrics.  The check_experimental_features target, which
+// droidcore depends on, fails if an allowlist entry matches none of the modules that checked the
+// feature, so that the allowlists don't keep stale entries for removed or renamed modules.
+
+var experimentalFeatures = []string{}
+
+// RegisterExperimentalFeature adds a feature to the set of experimental features that products
+// can enable.
+func RegisterExperimentalFeature(feature string) {
+	if InList(feature, experimentalFeatures) {
+		panic(fmt.Errorf("experimental feature %q registered twice", feature))
+	}
+	experimentalFeatures = append(experimentalFeatures, feature)
+}
+
+var experimentalFeaturesKey = NewOnceKey("experimentalFeatures")
+
+func experimentalFeaturesForConfig(config Config) []string {
+	return config.Once(experimentalFeaturesKey, func() interface{} {
+		// No test features were set by SetTestExperimentalFeatures, use the global ones
+		return experimentalFeatures
+	}).([]string)
+}
+
+// Overrides the registered experimental features for the supplied config.
+//
+// For testing only.
+func SetTestExperimentalFeatures(config Config, features []string) {
+	config.Once(experimentalFeaturesKey, func() interface{} { return features })
+}
+
+// experimentalFeatureAllowed returns the entries of the allowlist that match the module with the
+// given name defined in the given directory.
+func experimentalFeatureAllowed(allowlist []string, name, dir string) []string {
+	var matches []string
+	for _, entry := range allowlist {
+		if entry == "*" || entry == name ||
+			strings.HasSuffix(entry, "/") && strings.HasPrefix(dir+"/", entry) {
+			matches = append(matches, entry)
+		}
+	}
+	return matches
+}
+
+// ExperimentalFeatureEnabled returns true if the product enables the experimental feature for
+// the module, and records the result for the adoption report.  The feature must have been
+// registered with RegisterExperimentalFeature.
+func ExperimentalFeatureEnabled(ctx BaseModuleContext, feature string) bool {
+	if !InList(feature, experimentalFeaturesForConfig(ctx.Config())) {
+		panic(fmt.Errorf("unknown experimental feature %q", feature))
+	}
+
+	allowlist := ctx.Config().ExperimentalFeatureAllowlist(feature)
+	matches := experimentalFeatureAllowed(allowlist, ctx.ModuleName(), ctx.ModuleDir())
+	experimentalFeatureUsageForConfig(ctx.Config()).add(feature, ctx.ModuleName(), matches)
+	return len(matches) > 0
+}
+
+type experimentalFeatureUsage struct {
+	sync.Mutex
+	// The modules that checked each feature, and whether it was enabled for them.
+	modules map[string]map[string]bool
+	// The allowlist entries of each feature that matched a module that checked the feature.
+	matchedEntries map[string]map[string]bool
+}
+
+func (u *experimentalFeatureUsage) add(feature, module string, matches []string) {
+	u.Lock()
+	defer u.Unlock()
+	if u.modules[feature] == nil {
+		u.modules[feature] = make(map[string]bool)
+		u.matchedEntries[feature] = make(map[string]bool)
+	}
+	u.modules[feature][module] = u.modules[feature][module] || len(matches) > 0
+	for _, entry := range matches {
+		u.matchedEntries[feature][entry] = true
+	}
+}
+
+var experimentalFeatureUsageKey = NewOnceKey("experimentalFeatureUsage")
+
+func experimentalFeatureUsageForConfig(config Config) *experimentalFeatureUsage {
+	return config.Once(experimentalFeatureUsageKey, func() interface{} {
+		return &experimentalFeatureUsage{
+			modules:        make(map[string]map[string]bool),
+			matchedEntries: make(map[string]map[string]bool),
+		}
+	}).(*experimentalFeatureUsage)
+}
+
+func init() {
+	RegisterSingletonType("experimental_features", ExperimentalFeaturesSingleton)
+}
+
+func ExperimentalFeaturesSingleton() Singleton {
+	return &experimentalFeaturesSingleton{}
+}
+
+type experimentalFeaturesSingleton struct{}
+
+// GenerateBuildActions reports the features enabled by the product that are not registered, and
+// creates the rules that write the adoption of each feature to experimental_features.txt and that
+// check the allowlists for stale entries.
+func (e *experimentalFeaturesSingleton) GenerateBuildActions(ctx SingletonContext) {
+	features := experimentalFeaturesForConfig(ctx.Config())
+	for _, feature := range ctx.Config().ExperimentalFeatures() {
+		if !InList(feature, features) {
+			ctx.Errorf("Experimental_features: unknown experimental feature %q", feature)
+		}
+	}
+
+	u := experimentalFeatureUsageForConfig(ctx.Config())
+	u.Lock()
+	defer u.Unlock()
+
+	sortedFeatures := CopyOf(features)
+	sort.Strings(sortedFeatures)
+
+	var lines, metricsLines []string
+	for _, feature := range sortedFeatures {
+		modules := u.modules[feature]
+		var enabled []string
+		for _, module := range SortedStringKeys(modules) {
+			if modules[module] {
+				enabled = append(enabled, module)
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%s: enabled for %d of %d modules", feature,
+			len(enabled), len(modules)))
+		for _, module := range enabled {
+			lines = append(lines, "  "+module)
+		}
+		metricsLines = append(metricsLines, fmt.Sprintf("%s %d %d", feature, len(modules), len(enabled)))
+	}
+
+	// The metrics are read by soong_ui after running soong_build, so they are written directly
+	// instead of by a rule.
+	metrics := PathForOutput(ctx, ".experimental_features.metrics")
+	metricsContent := ""
+	if len(metricsLines) > 0 {
+		metricsContent = strings.Join(metricsLines, "\n") + "\n"
+	}
+	if err := WriteFileToOutputDir(metrics, []byte(metricsContent), 0666); err != nil {
+		ctx.Errorf(err.Error())
+	}
+
+	report := PathForOutput(ctx, "experimental_features.txt")
+	content := ""
+	if len(lines) > 0 {
+		content = strings.Join(lines, "\n") + "\n"
+	}
+	WriteFileRule(ctx, report, content)
+
+	ctx.Phony("experimental_features_report", report)
+
+	var staleEntries []string
+	for _, feature := range ctx.Config().ExperimentalFeatures() {
+		for _, entry := range ctx.Config().ExperimentalFeatureAllowlist(feature) {
+			if entry != "*" && !u.matchedEntries[feature][entry] {
+				staleEntries = append(staleEntries, fmt.Sprintf("%s: %q", feature, entry))
+			}
+		}
+	}
+
+	stale := PathForOutput(ctx, "experimental_features_stale_entries.txt")
+	content = ""
+	if len(staleEntries) > 0 {
+		content = strings.Join(staleEntries, "\n") + "\n"
+	}
+	WriteFileRule(ctx, stale, content)
+
+	stamp := PathForOutput(ctx, "experimental_features.stamp")
+	rule := NewRuleBuilder()
+	rule.Command().
+		Text("if [ -s").Input(stale).Text("]; then").
+		Text("echo 'ERROR: Experimental_features allowlist entries match no module that checks the feature:';").
+		Text("cat").Input(stale).Text("; exit 1; fi")
+	rule.Command().Text("touch").Output(stamp)
+	rule.Build(pctx, ctx, "check_experimental_features", "check experimental features")
+
+	ctx.Phony("droidcore", stamp)
+	ctx.Phony("check_experimental_features", stamp)
+}
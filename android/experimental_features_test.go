@@ -0,0 +1,164 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+type experimentalFeatureTestModule struct {
+	ModuleBase
+	newDexer bool
+}
+
+func newExperimentalFeatureTestModule() Module {
+	m := &experimentalFeatureTestModule{}
+	InitAndroidModule(m)
+	return m
+}
+
+func (m *experimentalFeatureTestModule) GenerateAndroidBuildActions(ctx ModuleContext) {
+	m.newDexer = ExperimentalFeatureEnabled(ctx, "new_dexer")
+}
+
+func testExperimentalFeatures(t *testing.T, allowlists map[string][]string) (*TestContext, []error) {
+	t.Helper()
+	fs := map[string][]byte{
+		"Android.bp": []byte(`
+			test_module {
+				name: "foo",
+			}
+		`),
+		"packages/apps/Android.bp": []byte(`
+			test_module {
+				name: "bar",
+			}
+		`),
+		"packages/apps/baz/Android.bp": []byte(`
+			test_module {
+				name: "baz",
+			}
+		`),
+		"packages/appsfoo/Android.bp": []byte(`
+			test_module {
+				name: "qux",
+			}
+		`),
+	}
+	config := TestConfig(buildDir, nil, "", fs)
+	config.TestProductVariables.Experimental_features = allowlists
+	SetTestExperimentalFeatures(config, []string{"new_dexer", "new_resource_compiler"})
+
+	ctx := NewTestContext()
+	ctx.RegisterModuleType("test_module", newExperimentalFeatureTestModule)
+	ctx.RegisterSingletonType("experimental_features", ExperimentalFeaturesSingleton)
+	ctx.Register(config)
+
+	_, errs := ctx.ParseBlueprintsFiles("Android.bp")
+	FailIfErrored(t, errs)
+	_, errs = ctx.PrepareBuildActions(config)
+	return ctx, errs
+}
+
+func TestExperimentalFeatures(t *testing.T) {
+	ctx, errs := testExperimentalFeatures(t, map[string][]string{
+		"new_dexer": {"foo", "packages/apps/"},
+	})
+	FailIfErrored(t, errs)
+
+	expected := map[string]bool{
+		"foo": true,
+		"bar": true,
+		"baz": true,
+		"qux": false,
+	}
+	for name, w := range expected {
+		m := ctx.ModuleForTests(name, "").Module().(*experimentalFeatureTestModule)
+		if g := m.newDexer; g != w {
+			t.Errorf("expected new_dexer enabled for %s to be %v, got %v", name, w, g)
+		}
+	}
+
+	singleton := ctx.SingletonForTests("experimental_features")
+	data := ContentFromWriteFileRuleForTests(t, singleton.Output("experimental_features.txt"))
+	expectedReport := "new_dexer: enabled for 3 of 4 modules\n" +
+		"  bar\n" +
+		"  baz\n" +
+		"  foo\n" +
+		"new_resource_compiler: enabled for 0 of 0 modules\n"
+	if g, w := data, expectedReport; g != w {
+		t.Errorf("expected report:\n%s\ngot:\n%s", w, g)
+	}
+
+	if g := ContentFromWriteFileRuleForTests(t, singleton.Output("experimental_features_stale_entries.txt")); g != "" {
+		t.Errorf("expected no stale allowlist entries, got %q", g)
+	}
+
+	metrics, err := ioutil.ReadFile(filepath.Join(buildDir, ".experimental_features.metrics"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := string(metrics), "new_dexer 4 3\nnew_resource_compiler 0 0\n"; g != w {
+		t.Errorf("expected metrics %q, got %q", w, g)
+	}
+}
+
+func TestExperimentalFeaturesStaleEntries(t *testing.T) {
+	ctx, errs := testExperimentalFeatures(t, map[string][]string{
+		"new_dexer":             {"foo", "removed", "packages/removed/"},
+		"new_resource_compiler": {"bar"},
+	})
+	FailIfErrored(t, errs)
+
+	singleton := ctx.SingletonForTests("experimental_features")
+	stale := singleton.Output("experimental_features_stale_entries.txt")
+	expected := `new_dexer: "removed"` + "\n" +
+		`new_dexer: "packages/removed/"` + "\n" +
+		`new_resource_compiler: "bar"` + "\n"
+	if g := ContentFromWriteFileRuleForTests(t, stale); g != expected {
+		t.Errorf("expected stale allowlist entries:\n%s\ngot:\n%s", expected, g)
+	}
+
+	// Test that the check fails the build on the stale entries
+	check := singleton.Output("experimental_features.stamp")
+	if !InList(stale.Output.String(), check.Implicits.Strings()) {
+		t.Errorf("expected the check to read %q, got inputs %q", stale.Output.String(), check.Implicits.Strings())
+	}
+}
+
+func TestExperimentalFeaturesAll(t *testing.T) {
+	ctx, errs := testExperimentalFeatures(t, map[string][]string{
+		"new_dexer": {"*"},
+	})
+	FailIfErrored(t, errs)
+
+	for _, name := range []string{"foo", "bar", "baz", "qux"} {
+		m := ctx.ModuleForTests(name, "").Module().(*experimentalFeatureTestModule)
+		if !m.newDexer {
+			t.Errorf("expected new_dexer to be enabled for %s", name)
+		}
+	}
+}
+
+func TestExperimentalFeaturesUnknown(t *testing.T) {
+	_, errs := testExperimentalFeatures(t, map[string][]string{
+		"new_linker": {"foo"},
+	})
+	CheckErrorsAgainstExpectations(t, errs, []string{
+		`Experimental_features: unknown experimental feature "new_linker"`,
+	})
+}
@@ -0,0 +1,67 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"strings"
+)
+
+// The install_owners singleton lists the files installed by Soong modules together with the module
+// that installs them.  Make compares the list with the files it installs for the product using the
+// install_owners tool, which produces the ownership map of every installed artifact that tracks
+// the remaining conversions from Make to Soong.
+
+func init() {
+	RegisterSingletonType("install_owners", InstallOwnersSingleton)
+}
+
+func InstallOwnersSingleton() Singleton {
+	return &installOwnersSingleton{}
+}
+
+type installOwnersSingleton struct {
+	list Path
+}
+
+func (s *installOwnersSingleton) GenerateBuildActions(ctx SingletonContext) {
+	owners := make(map[string]string)
+	ctx.VisitAllModules(func(module Module) {
+		for _, spec := range modulePackagingSpecs(module) {
+			installPath := spec.InstallPath()
+			// The paths are relative to the install root, which is $OUT for both Soong and Make
+			// modules, so that they can be matched against the files installed by Make.
+			if _, exists := owners[installPath.path]; !exists {
+				owners[installPath.path] = ctx.ModuleName(module)
+			}
+		}
+	})
+
+	var lines []string
+	for _, path := range SortedStringKeys(owners) {
+		lines = append(lines, path+" "+owners[path])
+	}
+
+	// Make reads the list from a rule that depends on it, so it is only written when needed.
+	list := PathForOutput(ctx, "install_owners", "soong_installs.txt")
+	WriteFileRule(ctx, list, strings.Join(lines, "\n")+"\n")
+
+	s.list = list
+}
+
+func (s *installOwnersSingleton) MakeVars(ctx MakeVarsContext) {
+	if s.list != nil {
+		ctx.Strict("SOONG_INSTALLS_LIST", s.list.String())
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInstallOwners(t *testing.T) {
+	t.Run("soong", func(t *testing.T) {
+		testInstallOwners(t, false)
+	})
+	t.Run("embedded in make", func(t *testing.T) {
+		testInstallOwners(t, true)
+	})
+}
+
+func testInstallOwners(t *testing.T, inMake bool) {
+	bp := `
+		test {
+			name: "foo",
+		}
+
+		test {
+			name: "bar",
+			vendor: true,
+		}
+
+		test {
+			name: "disabled",
+			enabled: false,
+		}
+	`
+
+	config := TestArchConfig(buildDir, nil, bp, map[string][]byte{"a.txt": nil})
+	config.inMake = inMake
+
+	ctx := NewTestArchContext()
+	ctx.RegisterModuleType("test", targetFilesTestModuleFactory)
+	ctx.RegisterSingletonType("install_owners", InstallOwnersSingleton)
+	ctx.Register(config)
+
+	_, errs := ctx.ParseFileList(".", []string{"Android.bp"})
+	FailIfErrored(t, errs)
+	_, errs = ctx.PrepareBuildActions(config)
+	FailIfErrored(t, errs)
+
+	list := ctx.SingletonForTests("install_owners").Output("install_owners/soong_installs.txt")
+	content := ContentFromWriteFileRuleForTests(t, list)
+
+	expected := []string{
+		"target/product/test_device/system/etc/foo foo",
+		"target/product/test_device/vendor/etc/bar bar",
+	}
+	if got := strings.Split(strings.TrimSpace(content), "\n"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected installs %q, got %q", expected, got)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/proptools"
+)
+
+// The install_size singleton reports the size of the files that each module installed by the
+// product puts into each partition of the device, and enforces the per-partition size budgets of
+// the product.  A partition that exceeds its budget fails the check_install_size_budgets target
+// with the modules that contribute the most to it, so that growth is caught when it is introduced
+// rather than when the image no longer fits.  The sizes are those of the built files, as device
+// modules are installed by Make when Soong is embedded in it.  The report is built by the
+// install_size_report target; neither target is part of droid, as they build every installed
+// module.
+
+func init() {
+	RegisterSingletonType("install_size", InstallSizeSingleton)
+}
+
+// installSizeReportRule writes one line per module and partition with the partition, the module
+// and the total size in bytes of the files the module installs into the partition, largest modules
+// first.  The manifest holds a "<partition> <module> <built file>" entry for each installed file,
+// and is passed in a response file as it can exceed the maximum length of a command line.
+var installSizeReportRule = pctx.AndroidStaticRule("installSizeReport",
+	blueprint.RuleParams{
+		Command: `xargs -n 3 < $out.rsp | ` +
+			`while read -r partition module file; do ` +
+			`printf '%s\t%s\t%s\n' "$$partition" "$$module" "$$(stat -L -c %s "$$file")"; done | ` +
+			`awk -F '\t' '{ size[$$1 "\t" $$2] += $$3 } END { for (k in size) print k "\t" size[k] }' | ` +
+			`sort -k 3,3nr -k 1,2 > $out`,
+		Rspfile:        "$out.rsp",
+		RspfileContent: "$manifest",
+		Description:    "install size report",
+	}, "manifest")
+
+// installSizeReportOffenders is the number of modules listed when a partition exceeds its budget.
+const installSizeReportOffenders = 10
+
+func InstallSizeSingleton() Singleton {
+	return &installSizeSingleton{}
+}
+
+type installSizeSingleton struct {
+	report Path
+}
+
+// installSizeEntry holds the files installed by a single module into a single partition.
+type installSizeEntry struct {
+	partition string
+	module    string
+	files     Paths
+}
+
+func (s *installSizeSingleton) GenerateBuildActions(ctx SingletonContext) {
+	entries := make(map[string]*installSizeEntry)
+	for _, module := range productInstalledModules(ctx) {
+		for _, spec := range modulePackagingSpecs(module) {
+			partition, ok := spec.Partition()
+			if !ok {
+				// Host installs are not part of any partition.
+				continue
+			}
+			if spec.SrcPath() == nil {
+				// Symlinks don't take any space.
+				continue
+			}
+			key := partition + " " + ctx.ModuleName(module)
+			entry := entries[key]
+			if entry == nil {
+				entry = &installSizeEntry{partition: partition, module: ctx.ModuleName(module)}
+				entries[key] = entry
+			}
+			entry.files = append(entry.files, spec.SrcPath())
+		}
+	}
+
+	if len(entries) == 0 {
+		return
+	}
+
+	var partitions []string
+	for _, key := range SortedStringKeys(entries) {
+		partitions = append(partitions, entries[key].partition)
+	}
+	partitions = FirstUniqueStrings(partitions)
+
+	report := PathForOutput(ctx, "install_size", "install_size_report.txt")
+
+	var manifest []string
+	var files Paths
+	for _, key := range SortedStringKeys(entries) {
+		entry := entries[key]
+		for _, file := range FirstUniquePaths(entry.files) {
+			manifest = append(manifest, entry.partition, entry.module, file.String())
+			files = append(files, file)
+		}
+	}
+	ctx.Build(pctx, BuildParams{
+		Rule:      installSizeReportRule,
+		Output:    report,
+		Implicits: FirstUniquePaths(files),
+		Args: map[string]string{
+			"manifest": strings.Join(manifest, " "),
+		},
+	})
+
+	ctx.Phony("install_size_report", report)
+	s.report = report
+
+	for _, partition := range partitions {
+		budget, ok := ctx.Config().PartitionSizeBudget(partition)
+		if !ok {
+			continue
+		}
+
+		stamp := PathForOutput(ctx, "install_size", partition+".budget.stamp")
+		message := fmt.Sprintf("ERROR: files installed into %s exceed the budget of %d bytes, "+
+			"largest modules:", partition, budget)
+
+		rule := NewRuleBuilder()
+		rule.Command().
+			Textf(`total=$(awk -F '\t' '$1 == "%s" { total += $3 } END { print total + 0 }'`, partition).
+			Input(report).Text(")")
+		rule.Command().
+			Textf(`if [ "$total" -gt %d ]; then`, budget).
+			Textf(`echo %s "$total bytes";`, proptools.ShellEscape(message)).
+			Textf(`awk -F '\t' '$1 == "%s"'`, partition).Input(report).
+			Textf("| head -n %d; exit 1; fi", installSizeReportOffenders)
+		rule.Command().Text("touch").Output(stamp)
+		rule.Build(pctx, ctx, "install_size_budget_"+partition, "install size budget "+partition)
+
+		ctx.Phony("check_install_size_budgets", stamp)
+	}
+}
+
+func (s *installSizeSingleton) MakeVars(ctx MakeVarsContext) {
+	if s.report != nil {
+		ctx.Strict("SOONG_INSTALL_SIZE_REPORT", s.report.String())
+		ctx.DistForGoal("install_size_report", s.report)
+	}
+}
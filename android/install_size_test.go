@@ -0,0 +1,82 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInstallSize(t *testing.T) {
+	// Make installs the files of device modules when Soong is embedded in it, the sizes of the built
+	// files are reported in both cases.
+	t.Run("soong", func(t *testing.T) { testInstallSize(t, false) })
+	t.Run("embedded in make", func(t *testing.T) { testInstallSize(t, true) })
+}
+
+func testInstallSize(t *testing.T, inMake bool) {
+	bp := `
+		test {
+			name: "foo",
+			required: ["bar"],
+		}
+
+		test {
+			name: "bar",
+			vendor: true,
+		}
+
+		test {
+			name: "baz",
+		}
+	`
+
+	config := TestArchConfig(buildDir, nil, bp, map[string][]byte{"a.txt": nil})
+	config.TestProductVariables.Product_packages = []string{"foo"}
+	config.TestProductVariables.Partition_size_budgets = map[string]int64{"system": 1024}
+	config.inMake = inMake
+
+	ctx := NewTestArchContext()
+	ctx.RegisterModuleType("test", targetFilesTestModuleFactory)
+	ctx.RegisterSingletonType("install_size", InstallSizeSingleton)
+	ctx.Register(config)
+
+	_, errs := ctx.ParseFileList(".", []string{"Android.bp"})
+	FailIfErrored(t, errs)
+	_, errs = ctx.PrepareBuildActions(config)
+	FailIfErrored(t, errs)
+
+	singleton := ctx.SingletonForTests("install_size")
+
+	report := singleton.Output("install_size/install_size_report.txt")
+	if expected := "system foo a.txt vendor bar a.txt"; report.Args["manifest"] != expected {
+		t.Errorf("expected install size manifest %q, got %q", expected, report.Args["manifest"])
+	}
+	if !InList("a.txt", report.Implicits.Strings()) {
+		t.Errorf("expected the built files in install size report inputs %q", report.Implicits.Strings())
+	}
+
+	budget := singleton.Output("install_size/system.budget.stamp")
+	if !strings.Contains(budget.RuleParams.Command, `-gt 1024`) {
+		t.Errorf("expected the system budget in command %q", budget.RuleParams.Command)
+	}
+	if !InList(report.Output.String(), budget.Implicits.Strings()) {
+		t.Errorf("expected the report in budget check inputs %q", budget.Implicits.Strings())
+	}
+
+	if r := singleton.MaybeOutput("install_size/vendor.budget.stamp"); r.Rule != nil {
+		t.Errorf("expected no budget check for vendor")
+	}
+}
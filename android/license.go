@@ -0,0 +1,86 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"github.com/google/blueprint"
+)
+
+func init() {
+	RegisterModuleType("license", LicenseFactory)
+}
+
+type licenseKindDependencyTag struct {
+	blueprint.BaseDependencyTag
+}
+
+var licenseKindTag = licenseKindDependencyTag{}
+
+type licenseProperties struct {
+	// The license_kind modules of the license.
+	License_kinds []string
+
+	// The copyright notice of the licensed code.
+	Copyright_notice *string
+
+	// The files that contain the text of the license.
+	License_text []string `android:"path"`
+
+	// The name of the package that the license applies to, for example the name of the upstream
+	// project of an external/ project.
+	Package_name *string
+}
+
+type licenseModule struct {
+	ModuleBase
+
+	properties licenseProperties
+
+	// The names of the license_kind modules of the license and the conditions that they impose.
+	kinds       []string
+	conditions  []string
+	licenseText Paths
+}
+
+// license describes the license of a package, which modules use with the licenses property.  It
+// lists the license_kind modules that the license consists of, which determine the conditions that
+// the license imposes on the modules, and the files with the text of the license.
+func LicenseFactory() Module {
+	module := &licenseModule{}
+	module.AddProperties(&module.properties)
+	InitAndroidModule(module)
+	return module
+}
+
+func (l *licenseModule) DepsMutator(ctx BottomUpMutatorContext) {
+	ctx.AddDependency(ctx.Module(), licenseKindTag, l.properties.License_kinds...)
+}
+
+func (l *licenseModule) GenerateAndroidBuildActions(ctx ModuleContext) {
+	if len(l.properties.License_kinds) == 0 {
+		ctx.PropertyErrorf("license_kinds", "must be set")
+	}
+	ctx.VisitDirectDepsWithTag(licenseKindTag, func(dep Module) {
+		kind, ok := dep.(*licenseKindModule)
+		if !ok {
+			ctx.PropertyErrorf("license_kinds", "%q is not a license_kind module", ctx.OtherModuleName(dep))
+			return
+		}
+		l.kinds = append(l.kinds, ctx.OtherModuleName(dep))
+		l.conditions = append(l.conditions, kind.properties.Conditions...)
+	})
+	l.conditions = SortedUniqueStrings(l.conditions)
+	l.licenseText = PathsForModuleSrc(ctx, l.properties.License_text)
+}
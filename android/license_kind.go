@@ -0,0 +1,71 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+func init() {
+	RegisterModuleType("license_kind", LicenseKindFactory)
+}
+
+// The conditions that a license_kind can impose on the modules that use a license of its kind.
+var licenseConditions = []string{
+	// The license is in the public domain or equivalent.
+	"unencumbered",
+	// The license only requires attribution, like the Apache or the BSD licenses.
+	"notice",
+	// The license requires the sources of the module to be released when it is distributed, like
+	// the MPL.
+	"reciprocal",
+	// The license requires the sources of everything linked with the module to be released under
+	// the same license when it is distributed, like the GPL.
+	"restricted",
+	// The module is not released, and its license is not public.
+	"proprietary",
+	// The license can only be used with the approval of the license owner, case by case.
+	"by_exception_only",
+}
+
+type licenseKindProperties struct {
+	// The conditions that a license of this kind imposes on the modules that use it, one of
+	// "unencumbered", "notice", "reciprocal", "restricted", "proprietary" or "by_exception_only".
+	Conditions []string
+
+	// The URL of the text of the license.
+	Url *string
+}
+
+type licenseKindModule struct {
+	ModuleBase
+
+	properties licenseKindProperties
+}
+
+// license_kind describes a kind of license, for example SPDX-license-identifier-Apache-2.0, and
+// the conditions that the license imposes on the modules that use it.  The license_kinds property
+// of license modules references license_kind modules.
+func LicenseKindFactory() Module {
+	module := &licenseKindModule{}
+	module.AddProperties(&module.properties)
+	InitAndroidModule(module)
+	return module
+}
+
+func (k *licenseKindModule) GenerateAndroidBuildActions(ctx ModuleContext) {
+	for _, condition := range k.properties.Conditions {
+		if !InList(condition, licenseConditions) {
+			ctx.PropertyErrorf("conditions", "unknown condition %q, must be one of %q",
+				condition, licenseConditions)
+		}
+	}
+}
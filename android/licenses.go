@@ -0,0 +1,258 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/blueprint"
+)
+
+// License metadata and license policies for the build system.
+//
+// Modules declare their licenses with the licenses property, which references license modules.
+// A license lists its license_kind modules, and a license_kind lists the conditions that it
+// imposes, like "notice" or "restricted".  The license metadata of a module records the kinds
+// and the conditions of its licenses, and the licensed modules that are statically linked into
+// it, directly or through other statically linked modules.  The metadata is written to the
+// meta_lic file of the module, and the files of all modules are built by the license_metadata
+// phony target.
+//
+// The license policies forbid modules with some conditions from statically linking modules with
+// other conditions, for example proprietary modules from statically linking GPL code.  A module
+// can be exempted from the policies for one of its dependencies with the license_exemptions
+// property, which must acknowledge why the dependency is allowed.
+
+func init() {
+	RegisterSingletonType("license_metadata", LicenseMetadataSingleton)
+}
+
+func RegisterLicensesDepsMutator(ctx RegisterMutatorsContext) {
+	ctx.BottomUp("licenses_deps", licensesDepsMutator).Parallel()
+}
+
+type licensesDependencyTag struct {
+	blueprint.BaseDependencyTag
+}
+
+var licensesTag = licensesDependencyTag{}
+
+func licensesDepsMutator(ctx BottomUpMutatorContext) {
+	m, ok := ctx.Module().(Module)
+	if !ok {
+		return
+	}
+	ctx.AddDependency(m, licensesTag, m.base().commonProperties.Licenses...)
+}
+
+// StaticLinkDependencyTag is implemented by the dependency tags of dependencies that are linked
+// into the module, for example the static libraries of a binary.  The license policies apply to
+// these dependencies.
+type StaticLinkDependencyTag interface {
+	StaticLink() bool
+}
+
+func isStaticLink(tag interface{}) bool {
+	if t, ok := tag.(StaticLinkDependencyTag); ok {
+		return t.StaticLink()
+	}
+	return false
+}
+
+// A LicensePolicy forbids the modules with any of Conditions from statically linking modules with
+// any of CannotLinkConditions.
+type LicensePolicy struct {
+	Conditions           []string
+	CannotLinkConditions []string
+
+	// Why the modules cannot be linked.
+	Reason string
+}
+
+// The license policies of the tree.  Other packages add their own with AddLicensePolicies.
+var licensePolicies = []LicensePolicy{
+	{
+		Conditions:           []string{"proprietary", "by_exception_only"},
+		CannotLinkConditions: []string{"restricted"},
+		Reason:               "restricted licenses require the code linked with them to be released under the same license",
+	},
+}
+
+// AddLicensePolicies adds policies to the set of license policies to apply.
+func AddLicensePolicies(policies ...LicensePolicy) {
+	licensePolicies = append(licensePolicies, policies...)
+}
+
+var licensePoliciesKey = NewOnceKey("licensePolicies")
+
+func licensePoliciesForConfig(config Config) []LicensePolicy {
+	return config.Once(licensePoliciesKey, func() interface{} {
+		// No test policies were set by SetTestLicensePolicies, use the global ones
+		return licensePolicies
+	}).([]LicensePolicy)
+}
+
+// Overrides the default license policies for the supplied config.
+//
+// For testing only.
+func SetTestLicensePolicies(config Config, policies []LicensePolicy) {
+	config.Once(licensePoliciesKey, func() interface{} { return policies })
+}
+
+type licenseMetadata struct {
+	kinds       []string
+	conditions  []string
+	licenseText Paths
+
+	// The licensed modules statically linked into the module, sorted by name.
+	staticDeps []licensedDep
+
+	// The exemptions of the module that allowed one of the static deps, sorted.
+	exemptions []string
+}
+
+type licensedDep struct {
+	name       string
+	conditions []string
+}
+
+var licenseExemptionRegexp = regexp.MustCompile(`^([^:\s]+):\s*(\S.*)$`)
+
+// generateLicenseMetadata collects the license metadata of the module from its licenses and from
+// the metadata of the modules statically linked into it, checks it against the license policies
+// and writes it to the meta_lic file of the module.
+func (m *ModuleBase) generateLicenseMetadata(ctx *moduleContext) {
+	var meta licenseMetadata
+	staticDeps := make(map[string][]string)
+	ctx.VisitDirectDeps(func(dep Module) {
+		tag := ctx.OtherModuleDependencyTag(dep)
+		if tag == licensesTag {
+			license, ok := dep.(*licenseModule)
+			if !ok {
+				ctx.PropertyErrorf("licenses", "%q is not a license module", ctx.OtherModuleName(dep))
+				return
+			}
+			meta.kinds = append(meta.kinds, license.kinds...)
+			meta.conditions = append(meta.conditions, license.conditions...)
+			meta.licenseText = append(meta.licenseText, license.licenseText...)
+		} else if isStaticLink(tag) {
+			depMeta := dep.base().licenseMetadata
+			if depMeta == nil {
+				return
+			}
+			if len(depMeta.conditions) > 0 {
+				staticDeps[ctx.OtherModuleName(dep)] = depMeta.conditions
+			}
+			for _, d := range depMeta.staticDeps {
+				staticDeps[d.name] = d.conditions
+			}
+		}
+	})
+	meta.kinds = SortedUniqueStrings(meta.kinds)
+	meta.conditions = SortedUniqueStrings(meta.conditions)
+	meta.licenseText = FirstUniquePaths(meta.licenseText)
+	for _, name := range SortedStringKeys(staticDeps) {
+		meta.staticDeps = append(meta.staticDeps, licensedDep{name, staticDeps[name]})
+	}
+
+	meta.exemptions = m.checkLicensePolicies(ctx, meta)
+
+	if len(meta.kinds) == 0 && len(meta.staticDeps) == 0 {
+		return
+	}
+	m.licenseMetadata = &meta
+
+	var lines []string
+	for _, kind := range meta.kinds {
+		lines = append(lines, "kind "+kind)
+	}
+	for _, condition := range meta.conditions {
+		lines = append(lines, "condition "+condition)
+	}
+	for _, text := range meta.licenseText {
+		lines = append(lines, "license_text "+text.String())
+	}
+	for _, dep := range meta.staticDeps {
+		lines = append(lines, "static_dep "+dep.name+" "+strings.Join(dep.conditions, ","))
+	}
+	for _, exemption := range meta.exemptions {
+		lines = append(lines, "exemption "+exemption)
+	}
+
+	metadataFile := PathForModuleOut(ctx, "meta_lic")
+	WriteFileRule(ctx, metadataFile, strings.Join(lines, "\n")+"\n")
+	m.licenseMetadataFile = OptionalPathForPath(metadataFile)
+}
+
+// checkLicensePolicies reports the static deps of the module that the license policies don't
+// allow and that are not exempted by the license_exemptions property, and returns the exemptions
+// that allowed a static dep.
+func (m *ModuleBase) checkLicensePolicies(ctx *moduleContext, meta licenseMetadata) []string {
+	exemptions := make(map[string]string)
+	for _, exemption := range m.commonProperties.License_exemptions {
+		match := licenseExemptionRegexp.FindStringSubmatch(exemption)
+		if match == nil {
+			ctx.PropertyErrorf("license_exemptions", "%q is not in the form \"<module>: <acknowledgment>\"",
+				exemption)
+			continue
+		}
+		if _, exists := exemptions[match[1]]; exists {
+			ctx.PropertyErrorf("license_exemptions", "duplicate exemption for %q", match[1])
+		}
+		exemptions[match[1]] = exemption
+	}
+
+	var used []string
+	for _, policy := range licensePoliciesForConfig(ctx.Config()) {
+		if _, applies := FilterList(meta.conditions, policy.Conditions); len(applies) == 0 {
+			continue
+		}
+		for _, dep := range meta.staticDeps {
+			_, forbidden := FilterList(dep.conditions, policy.CannotLinkConditions)
+			if len(forbidden) == 0 {
+				continue
+			}
+			if exemption, ok := exemptions[dep.name]; ok {
+				used = append(used, exemption)
+				continue
+			}
+			ctx.ModuleErrorf("cannot statically link %q, which has the %s license conditions: %s. "+
+				"Add an acknowledged exemption to license_exemptions to allow it.",
+				dep.name, strings.Join(forbidden, ", "), policy.Reason)
+		}
+	}
+	return SortedUniqueStrings(used)
+}
+
+func LicenseMetadataSingleton() Singleton {
+	return &licenseMetadataSingleton{}
+}
+
+type licenseMetadataSingleton struct{}
+
+// GenerateBuildActions makes the license_metadata phony target build the license metadata of all
+// modules.
+func (s *licenseMetadataSingleton) GenerateBuildActions(ctx SingletonContext) {
+	var files Paths
+	ctx.VisitAllModules(func(module Module) {
+		if file := module.base().licenseMetadataFile; file.Valid() {
+			files = append(files, file.Path())
+		}
+	})
+	sort.Slice(files, func(i, j int) bool { return files[i].String() < files[j].String() })
+	ctx.Phony("license_metadata", files...)
+}
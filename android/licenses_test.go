@@ -0,0 +1,243 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The static_libs of the mock cc_library are linked into it.
+func (t neverallowTestDependencyTag) StaticLink() bool {
+	return t == staticDepTag
+}
+
+var licensesBp = `
+	license_kind {
+		name: "SPDX-license-identifier-Apache-2.0",
+		conditions: ["notice"],
+	}
+
+	license_kind {
+		name: "SPDX-license-identifier-GPL-2.0",
+		conditions: ["restricted"],
+	}
+
+	license_kind {
+		name: "legacy_proprietary",
+		conditions: ["proprietary"],
+	}
+
+	license {
+		name: "apache_license",
+		license_kinds: ["SPDX-license-identifier-Apache-2.0"],
+		license_text: ["NOTICE"],
+	}
+
+	license {
+		name: "gpl_license",
+		license_kinds: ["SPDX-license-identifier-GPL-2.0"],
+		license_text: ["COPYING"],
+	}
+
+	license {
+		name: "proprietary_license",
+		license_kinds: ["legacy_proprietary"],
+	}
+
+	cc_library {
+		name: "libgpl",
+		licenses: ["gpl_license"],
+	}
+
+	cc_library {
+		name: "libapache",
+		licenses: ["apache_license"],
+		static_libs: ["libgpl"],
+	}
+`
+
+var licensesTests = []struct {
+	name             string
+	policies         []LicensePolicy
+	bp               string
+	expectedErrors   []string
+	expectedMetadata map[string][]string
+}{
+	{
+		name: "metadata",
+		bp: `
+			cc_library {
+				name: "libfoo",
+				licenses: ["apache_license"],
+				static_libs: ["libapache", "libunlicensed"],
+			}
+
+			cc_library {
+				name: "libunlicensed",
+			}`,
+		expectedMetadata: map[string][]string{
+			"libgpl": {
+				"kind SPDX-license-identifier-GPL-2.0",
+				"condition restricted",
+				"license_text COPYING",
+			},
+			"libfoo": {
+				"kind SPDX-license-identifier-Apache-2.0",
+				"condition notice",
+				"license_text NOTICE",
+				"static_dep libapache notice",
+				"static_dep libgpl restricted",
+			},
+			"libunlicensed": nil,
+		},
+	},
+	{
+		name: "proprietary statically linking gpl",
+		bp: `
+			cc_library {
+				name: "libproprietary",
+				licenses: ["proprietary_license"],
+				static_libs: ["libapache"],
+			}`,
+		expectedErrors: []string{
+			`module "libproprietary": cannot statically link "libgpl", which has the restricted license conditions: ` +
+				`restricted licenses require the code linked with them to be released under the same license.`,
+		},
+	},
+	{
+		name: "acknowledged exemption",
+		bp: `
+			cc_library {
+				name: "libproprietary",
+				licenses: ["proprietary_license"],
+				static_libs: ["libapache"],
+				license_exemptions: ["libgpl: Approved by the copyright holder in b/1234"],
+			}`,
+		expectedMetadata: map[string][]string{
+			"libproprietary": {
+				"kind legacy_proprietary",
+				"condition proprietary",
+				"static_dep libapache notice",
+				"static_dep libgpl restricted",
+				"exemption libgpl: Approved by the copyright holder in b/1234",
+			},
+		},
+	},
+	{
+		name: "exemption without acknowledgment",
+		bp: `
+			cc_library {
+				name: "libproprietary",
+				licenses: ["proprietary_license"],
+				license_exemptions: ["libgpl"],
+			}`,
+		expectedErrors: []string{
+			`license_exemptions: "libgpl" is not in the form "<module>: <acknowledgment>"`,
+		},
+	},
+	{
+		name: "configured policy",
+		policies: []LicensePolicy{
+			{
+				Conditions:           []string{"restricted"},
+				CannotLinkConditions: []string{"notice"},
+				Reason:               "for testing",
+			},
+		},
+		bp: `
+			cc_library {
+				name: "libgpl2",
+				licenses: ["gpl_license"],
+				static_libs: ["libapache"],
+			}`,
+		expectedErrors: []string{
+			`module "libgpl2": cannot statically link "libapache", which has the notice license conditions: for testing.`,
+		},
+	},
+	{
+		name: "not a license",
+		bp: `
+			cc_library {
+				name: "libfoo",
+				licenses: ["libapache"],
+			}`,
+		expectedErrors: []string{
+			`licenses: "libapache" is not a license module`,
+		},
+	},
+	{
+		name: "unknown condition",
+		bp: `
+			license_kind {
+				name: "unknown_kind",
+				conditions: ["unknown"],
+			}`,
+		expectedErrors: []string{
+			`conditions: unknown condition "unknown"`,
+		},
+	},
+}
+
+func TestLicenses(t *testing.T) {
+	for _, test := range licensesTests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := map[string][]byte{
+				"NOTICE":  nil,
+				"COPYING": nil,
+			}
+			config := TestConfig(buildDir, nil, licensesBp+test.bp, fs)
+			if test.policies != nil {
+				SetTestLicensePolicies(config, test.policies)
+			}
+
+			ctx := NewTestContext()
+			ctx.RegisterModuleType("cc_library", newMockCcLibraryModule)
+			ctx.RegisterModuleType("license", LicenseFactory)
+			ctx.RegisterModuleType("license_kind", LicenseKindFactory)
+			ctx.PostDepsMutators(RegisterLicensesDepsMutator)
+			ctx.RegisterSingletonType("license_metadata", LicenseMetadataSingleton)
+			ctx.Register(config)
+
+			_, errs := ctx.ParseBlueprintsFiles("Android.bp")
+			FailIfErrored(t, errs)
+			_, errs = ctx.PrepareBuildActions(config)
+			CheckErrorsAgainstExpectations(t, errs, test.expectedErrors)
+			if len(errs) > 0 {
+				return
+			}
+
+			for name, expected := range test.expectedMetadata {
+				metadata := ctx.ModuleForTests(name, "").MaybeOutput("meta_lic")
+				if expected == nil {
+					if metadata.Rule != nil {
+						t.Errorf("expected no license metadata for %q", name)
+					}
+					continue
+				}
+				if metadata.Rule == nil {
+					t.Errorf("expected license metadata for %q", name)
+					continue
+				}
+				content := ContentFromWriteFileRuleForTests(t, metadata)
+				got := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+				if !reflect.DeepEqual(got, expected) {
+					t.Errorf("expected license metadata of %q to be %q, got %q", name, expected, got)
+				}
+			}
+		})
+	}
+}
@@ -55,6 +55,14 @@ type BuildParams struct {
 
 type ModuleBuildParams BuildParams
 
+// ActionDescription returns a description for a build action made of the type of the action and
+// the base name of the file that it produces, for example "javac foo.jar".  ModuleContext.Build
+// adds the name of the module to the description, so the build log shows which module, which
+// action and which output each line refers to.
+func ActionDescription(action string, output Path) string {
+	return action + " " + output.Base()
+}
+
 // EarlyModuleContext provides methods that can be called early, as soon as the properties have
 // been parsed into the module and before any mutators have run.
 type EarlyModuleContext interface {
@@ -235,6 +243,8 @@ type Module interface {
 	InitRc() Paths
 	VintfFragments() Paths
 	NoticeFile() OptionalPath
+	FilesToInstall() Paths
+	PackagingSpecs() []PackagingSpec
 
 	AddProperties(props ...interface{})
 	GetProperties() []interface{}
@@ -305,6 +315,29 @@ type nameProperties struct {
 	Name *string
 }
 
+// Dist is the specification of the outputs of a module to copy to the dist directory.
+type Dist struct {
+	// copy the output of this module to the $DIST_DIR when `dist` is specified on the
+	// command line and  any of these targets are also on the command line, or otherwise
+	// built
+	Targets []string `android:"arch_variant"`
+
+	// The name of the output artifact. This defaults to the basename of the output of
+	// the module.  It cannot be set when the tag selects more than one output.
+	Dest *string `android:"arch_variant"`
+
+	// The directory within the dist directory to store the artifact. Defaults to the
+	// top level directory ("").
+	Dir *string `android:"arch_variant"`
+
+	// A suffix to add to the artifact file name (before any extension).
+	Suffix *string `android:"arch_variant"`
+
+	// The tag of the outputs of this module to copy, for example ".jar" or ".proguard_map".
+	// Defaults to the default dist output of the module type.
+	Tag *string `android:"arch_variant"`
+}
+
 type commonProperties struct {
 	// emit build rules for this module
 	//
@@ -439,23 +472,22 @@ type commonProperties struct {
 	// relative path to a file to include in the list of notices for the device
 	Notice *string `android:"path"`
 
-	Dist struct {
-		// copy the output of this module to the $DIST_DIR when `dist` is specified on the
-		// command line and  any of these targets are also on the command line, or otherwise
-		// built
-		Targets []string `android:"arch_variant"`
+	// The license modules that describe the licenses of this module.
+	Licenses []string
 
-		// The name of the output artifact. This defaults to the basename of the output of
-		// the module.
-		Dest *string `android:"arch_variant"`
+	// Exemptions from the license policies for the modules statically linked into this module,
+	// each in the form "<module>: <acknowledgment>".  The acknowledgment records why the module
+	// may link the dependency despite the policy, for example the approval of the license owner,
+	// and is included in the license metadata of the module.
+	License_exemptions []string
 
-		// The directory within the dist directory to store the artifact. Defaults to the
-		// top level directory ("").
-		Dir *string `android:"arch_variant"`
+	// configuration to distribute an output of this module to the distribution directory
+	// (default: $OUT/dist, configurable with $DIST_DIR)
+	Dist Dist `android:"arch_variant"`
 
-		// A suffix to add to the artifact file name (before any extension).
-		Suffix *string `android:"arch_variant"`
-	} `android:"arch_variant"`
+	// a list of configurations to distribute outputs of this module to the distribution
+	// directory (default: $OUT/dist, configurable with $DIST_DIR)
+	Dists []Dist `android:"arch_variant"`
 
 	// The OsType of artifacts that this module variant is responsible for creating.
 	//
@@ -518,6 +550,13 @@ type commonProperties struct {
 	DebugMutators   []string `blueprint:"mutated"`
 	DebugVariations []string `blueprint:"mutated"`
 
+	// The sources of the property values of the module, if SOONG_DUMP_MODULE_PROPERTIES lists
+	// the module.  Each entry is a property name and the source that changed it, separated by a
+	// space, in the order the sources were applied.
+	//
+	// Set by tracePropertyChanges.
+	PropertySources []string `blueprint:"mutated"`
+
 	// set by ImageMutator
 	ImageVariation string `blueprint:"mutated"`
 }
@@ -709,9 +748,17 @@ type ModuleBase struct {
 
 	noAddressSanitizer bool
 	installFiles       Paths
+	packagingSpecs     []PackagingSpec
 	checkbuildFiles    Paths
 	noticeFile         OptionalPath
-	phonies            map[string]Paths
+
+	// The direct dependencies that are installed along with the module, see
+	// InstallNeededDependencyTag.
+	installNeededDeps []Module
+	phonies           map[string]Paths
+
+	// Set on the modules that are needed by the apps of an unbundled apps build.
+	neededByUnbundledBuild bool
 
 	// Used by buildTargetSingleton to create checkbuild and per-directory build targets
 	// Only set on the final variant of each module
@@ -731,6 +778,11 @@ type ModuleBase struct {
 	initRcPaths         Paths
 	vintfFragmentsPaths Paths
 
+	// The license metadata of the module, or nil if neither the module nor the modules statically
+	// linked into it have licenses.
+	licenseMetadata     *licenseMetadata
+	licenseMetadataFile OptionalPath
+
 	prefer32 func(ctx BaseModuleContext, base *ModuleBase, class OsClass) bool
 }
 
@@ -979,6 +1031,17 @@ func (m *ModuleBase) filesToInstall() Paths {
 	return m.installFiles
 }
 
+// FilesToInstall returns the paths of the files installed by this module.
+func (m *ModuleBase) FilesToInstall() Paths {
+	return m.installFiles
+}
+
+// PackagingSpecs returns the files installed by this module, including the ones that are installed
+// by Make when Soong is embedded in it.
+func (m *ModuleBase) PackagingSpecs() []PackagingSpec {
+	return m.packagingSpecs
+}
+
 func (m *ModuleBase) NoAddressSanitizer() bool {
 	return m.noAddressSanitizer
 }
@@ -1235,23 +1298,10 @@ func (m *ModuleBase) GenerateBuildActions(blueprintCtx blueprint.ModuleContext)
 	ctx.Variable(pctx, "moduleDescSuffix", s)
 
 	// Some common property checks for properties that will be used later in androidmk.go
-	if m.commonProperties.Dist.Dest != nil {
-		_, err := validateSafePath(*m.commonProperties.Dist.Dest)
-		if err != nil {
-			ctx.PropertyErrorf("dist.dest", "%s", err.Error())
-		}
-	}
-	if m.commonProperties.Dist.Dir != nil {
-		_, err := validateSafePath(*m.commonProperties.Dist.Dir)
-		if err != nil {
-			ctx.PropertyErrorf("dist.dir", "%s", err.Error())
-		}
-	}
-	if m.commonProperties.Dist.Suffix != nil {
-		if strings.Contains(*m.commonProperties.Dist.Suffix, "/") {
-			ctx.PropertyErrorf("dist.suffix", "Suffix may not contain a '/' character.")
-		}
+	for i, dist := range m.commonProperties.Dists {
+		validateDist(ctx, dist, fmt.Sprintf("dists[%d]", i))
 	}
+	validateDist(ctx, m.commonProperties.Dist, "dist")
 
 	if m.Enabled() {
 		// ensure all direct android.Module deps are enabled
@@ -1274,13 +1324,31 @@ func (m *ModuleBase) GenerateBuildActions(blueprintCtx blueprint.ModuleContext)
 			return
 		}
 
-		m.installFiles = append(m.installFiles, ctx.installFiles...)
-		m.checkbuildFiles = append(m.checkbuildFiles, ctx.checkbuildFiles...)
+		for i, dist := range m.commonProperties.Dists {
+			validateDistTag(ctx, dist, fmt.Sprintf("dists[%d]", i))
+		}
+		validateDistTag(ctx, m.commonProperties.Dist, "dist")
+		if ctx.Failed() {
+			return
+		}
+
 		m.initRcPaths = PathsForModuleSrc(ctx, m.commonProperties.Init_rc)
 		m.vintfFragmentsPaths = PathsForModuleSrc(ctx, m.commonProperties.Vintf_fragments)
+		ctx.installInitRcAndVintfFragments(m.initRcPaths, m.vintfFragmentsPaths)
+
+		m.installFiles = append(m.installFiles, ctx.installFiles...)
+		m.packagingSpecs = append(m.packagingSpecs, ctx.packagingSpecs...)
+		m.checkbuildFiles = append(m.checkbuildFiles, ctx.checkbuildFiles...)
+		ctx.VisitDirectDeps(func(dep Module) {
+			if isInstallDepNeeded(ctx.OtherModuleDependencyTag(dep)) {
+				m.installNeededDeps = append(m.installNeededDeps, dep)
+			}
+		})
 		for k, v := range ctx.phonies {
 			m.phonies[k] = append(m.phonies[k], v...)
 		}
+
+		m.generateLicenseMetadata(ctx)
 	} else if ctx.Config().AllowMissingDependencies() {
 		// If the module is not enabled it will not create any build rules, nothing will call
 		// ctx.GetMissingDependencies(), and blueprint will consider the missing dependencies to be unhandled
@@ -1301,6 +1369,79 @@ func (m *ModuleBase) GenerateBuildActions(blueprintCtx blueprint.ModuleContext)
 	m.variables = ctx.variables
 }
 
+// dists returns the dist properties of the module that have targets.
+func (m *ModuleBase) dists() []Dist {
+	var dists []Dist
+	if len(m.commonProperties.Dist.Targets) > 0 {
+		dists = append(dists, m.commonProperties.Dist)
+	}
+	for _, dist := range m.commonProperties.Dists {
+		if len(dist.Targets) > 0 {
+			dists = append(dists, dist)
+		}
+	}
+	return dists
+}
+
+// validateDist checks the paths of a dist property, which are used later in androidmk.go.
+func validateDist(ctx ModuleContext, dist Dist, property string) {
+	if dist.Dest != nil {
+		_, err := validateSafePath(*dist.Dest)
+		if err != nil {
+			ctx.PropertyErrorf(property+".dest", "%s", err.Error())
+		}
+	}
+	if dist.Dir != nil {
+		_, err := validateSafePath(*dist.Dir)
+		if err != nil {
+			ctx.PropertyErrorf(property+".dir", "%s", err.Error())
+		}
+	}
+	if dist.Suffix != nil {
+		if strings.Contains(*dist.Suffix, "/") {
+			ctx.PropertyErrorf(property+".suffix", "Suffix may not contain a '/' character.")
+		}
+	}
+}
+
+// validateDistTag checks that the module produces the outputs selected by the tag of a dist
+// property.  It must be called after GenerateAndroidBuildActions.
+func validateDistTag(ctx ModuleContext, dist Dist, property string) {
+	if dist.Tag == nil {
+		return
+	}
+	paths, err := distTaggedOutputs(ctx.Module(), *dist.Tag)
+	if err != nil {
+		ctx.PropertyErrorf(property+".tag", "%s", err.Error())
+	} else if dist.Dest != nil && len(paths) > 1 {
+		ctx.PropertyErrorf(property+".dest", "cannot be set when the tag selects more than one output, %q selects %q",
+			*dist.Tag, paths.Strings())
+	}
+}
+
+// distTaggedOutputs returns the outputs of a module selected by the tag of a dist property.
+func distTaggedOutputs(module blueprint.Module, tag string) (Paths, error) {
+	producer, ok := module.(OutputFileProducer)
+	if !ok {
+		return nil, fmt.Errorf("module type does not support tagged outputs")
+	}
+	outputs, err := producer.OutputFiles(tag)
+	if err != nil {
+		return nil, err
+	}
+	// Some module types return a nil path for the outputs they did not produce.
+	var paths Paths
+	for _, output := range outputs {
+		if output != nil {
+			paths = append(paths, output)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("tag %q does not select any outputs", tag)
+	}
+	return paths, nil
+}
+
 type earlyModuleContext struct {
 	blueprint.EarlyModuleContext
 
@@ -1416,6 +1557,7 @@ type moduleContext struct {
 	baseModuleContext
 	installDeps     Paths
 	installFiles    Paths
+	packagingSpecs  []PackagingSpec
 	checkbuildFiles Paths
 	module          Module
 	phonies         map[string]Paths
@@ -1882,6 +2024,12 @@ func (m *moduleContext) installFile(installPath InstallPath, name string, srcPat
 	fullInstallPath := installPath.Join(m, name)
 	m.module.base().hooks.runInstallHooks(m, fullInstallPath, false)
 
+	m.packagingSpecs = append(m.packagingSpecs, PackagingSpec{
+		installPath: fullInstallPath,
+		srcPath:     srcPath,
+		executable:  rule == CpExecutable,
+	})
+
 	if !m.skipInstall(fullInstallPath) {
 
 		deps = append(deps, m.installDeps...)
@@ -1912,16 +2060,44 @@ func (m *moduleContext) installFile(installPath InstallPath, name string, srcPat
 	return fullInstallPath
 }
 
+// installInitRcAndVintfFragments installs the init_rc and vintf_fragments files of a device
+// module that installs files into etc/init and etc/vintf/manifest of its partition, so that they
+// are tracked as installed files of the module.  Like Make, only the primary arch variant installs
+// them.  Modules that bypass Make when embedded in it leave them to Make, which installs them
+// through LOCAL_INIT_RC and LOCAL_VINTF_FRAGMENTS.
+func (m *moduleContext) installInitRcAndVintfFragments(initRc, vintfFragments Paths) {
+	if !m.Device() || len(m.installFiles) == 0 {
+		return
+	}
+	if m.Arch().ArchType != Common && !m.PrimaryArch() {
+		return
+	}
+	if m.Config().EmbeddedInMake() && m.InstallBypassMake() {
+		return
+	}
+
+	for _, rc := range initRc {
+		m.InstallFile(PathForModuleInstall(m, "etc", "init"), rc.Base(), rc)
+	}
+	for _, fragment := range vintfFragments {
+		m.InstallFile(PathForModuleInstall(m, "etc", "vintf", "manifest"), fragment.Base(), fragment)
+	}
+}
+
 func (m *moduleContext) InstallSymlink(installPath InstallPath, name string, srcPath InstallPath) InstallPath {
 	fullInstallPath := installPath.Join(m, name)
 	m.module.base().hooks.runInstallHooks(m, fullInstallPath, true)
 
-	if !m.skipInstall(fullInstallPath) {
+	relPath, err := filepath.Rel(path.Dir(fullInstallPath.String()), srcPath.String())
+	if err != nil {
+		panic(fmt.Sprintf("Unable to generate symlink between %q and %q: %s", fullInstallPath.Base(), srcPath.Base(), err))
+	}
+	m.packagingSpecs = append(m.packagingSpecs, PackagingSpec{
+		installPath:   fullInstallPath,
+		symlinkTarget: relPath,
+	})
 
-		relPath, err := filepath.Rel(path.Dir(fullInstallPath.String()), srcPath.String())
-		if err != nil {
-			panic(fmt.Sprintf("Unable to generate symlink between %q and %q: %s", fullInstallPath.Base(), srcPath.Base(), err))
-		}
+	if !m.skipInstall(fullInstallPath) {
 		m.Build(pctx, BuildParams{
 			Rule:        Symlink,
 			Description: "install symlink " + fullInstallPath.Base(),
@@ -1945,6 +2121,11 @@ func (m *moduleContext) InstallAbsoluteSymlink(installPath InstallPath, name str
 	fullInstallPath := installPath.Join(m, name)
 	m.module.base().hooks.runInstallHooks(m, fullInstallPath, true)
 
+	m.packagingSpecs = append(m.packagingSpecs, PackagingSpec{
+		installPath:   fullInstallPath,
+		symlinkTarget: absPath,
+	})
+
 	if !m.skipInstall(fullInstallPath) {
 		m.Build(pctx, BuildParams{
 			Rule:        Symlink,
@@ -1979,15 +2160,6 @@ func isAndroidModule(m blueprint.Module) bool {
 	return ok
 }
 
-func findStringInSlice(str string, slice []string) int {
-	for i, s := range slice {
-		if s == str {
-			return i
-		}
-	}
-	return -1
-}
-
 // SrcIsModule decodes module references in the format ":name" into the module name, or empty string if the input
 // was not a module reference.
 func SrcIsModule(s string) (module string) {
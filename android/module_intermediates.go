@@ -0,0 +1,51 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The module_intermediates singleton lists the intermediates directories of all module variants.
+// The list is built by the module_intermediates phony target.  Before running the build, soong_ui
+// builds the list and compares it with the one from the previous build of the product, and
+// removes the directories of module variants that have been removed or renamed and that no other
+// product has, so that their stale outputs can't be picked up by incremental builds.
+
+func init() {
+	RegisterSingletonType("module_intermediates", ModuleIntermediatesSingleton)
+}
+
+func ModuleIntermediatesSingleton() Singleton {
+	return &moduleIntermediatesSingleton{}
+}
+
+type moduleIntermediatesSingleton struct{}
+
+func (s *moduleIntermediatesSingleton) GenerateBuildActions(ctx SingletonContext) {
+	var dirs []string
+	ctx.VisitAllModules(func(module Module) {
+		dir := moduleOutDir(ctx.ModuleDir(module), ctx.ModuleName(module), ctx.ModuleSubDir(module))
+		dirs = append(dirs, filepath.Join(dir...))
+	})
+	sort.Strings(dirs)
+
+	list := PathForOutput(ctx, ".module_intermediates")
+	WriteFileRule(ctx, list, strings.Join(FirstUniqueStrings(dirs), "\n")+"\n")
+
+	ctx.Phony("module_intermediates", list)
+}
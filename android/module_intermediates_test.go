@@ -0,0 +1,56 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestModuleIntermediates(t *testing.T) {
+	bp := `
+		test {
+			name: "foo",
+		}
+
+		test {
+			name: "bar",
+		}
+	`
+
+	config := TestArchConfig(buildDir, nil, bp, nil)
+
+	ctx := NewTestArchContext()
+	ctx.RegisterModuleType("test", targetFilesTestModuleFactory)
+	ctx.RegisterSingletonType("module_intermediates", ModuleIntermediatesSingleton)
+	ctx.Register(config)
+
+	_, errs := ctx.ParseFileList(".", []string{"Android.bp"})
+	FailIfErrored(t, errs)
+	_, errs = ctx.PrepareBuildActions(config)
+	FailIfErrored(t, errs)
+
+	list := ctx.SingletonForTests("module_intermediates").Output(".module_intermediates")
+	data := ContentFromWriteFileRuleForTests(t, list)
+
+	expected := []string{
+		".intermediates/bar/android_common",
+		".intermediates/foo/android_common",
+	}
+	if got := strings.Split(strings.TrimSpace(data), "\n"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected intermediates directories %q, got %q", expected, got)
+	}
+}
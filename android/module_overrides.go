@@ -0,0 +1,196 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Module overrides allow a product to change a small set of properties of existing modules
+// without editing their Android.bp files, for example to sign an app with a different
+// certificate or to disable a module the product does not ship.  The product points
+// ModuleOverridesFile at a JSON file that maps module names to the properties to override:
+//
+//   {
+//       "Settings": {
+//           "certificate": "platform",
+//           "dex_preopt.enabled": false
+//       },
+//       "UnusedApp": {
+//           "enabled": false
+//       }
+//   }
+//
+// Only the properties in moduleOverridableProperties can be overridden.  Every module in the file
+// must exist and must have all of the properties listed for it, so stale entries are reported
+// instead of silently ignored.  The overrides are applied to all variants of the module after
+// the arch and variable mutators, so they replace the values set in arch, target and product
+// variable specific properties.
+
+// The properties that can be set in the module overrides file; nested properties are separated
+// with a '.'.
+var moduleOverridableProperties = []string{
+	"certificate",
+	"dex_preopt.enabled",
+	"enabled",
+}
+
+func RegisterModuleOverridesMutator(ctx RegisterMutatorsContext) {
+	ctx.BottomUp("module_overrides", moduleOverridesMutator).Parallel()
+}
+
+func init() {
+	RegisterSingletonType("module_overrides", ModuleOverridesSingleton)
+}
+
+// moduleOverrides maps module names to the raw JSON values of their overridden properties.
+type moduleOverrides map[string]map[string]json.RawMessage
+
+type moduleOverridesResult struct {
+	file      string
+	overrides moduleOverrides
+	err       error
+}
+
+var moduleOverridesKey = NewOnceKey("moduleOverrides")
+
+// moduleOverridesForConfig returns the parsed module overrides file of the product, which is
+// read only once per config.
+func moduleOverridesForConfig(config Config) moduleOverridesResult {
+	return config.Once(moduleOverridesKey, func() interface{} {
+		file := config.ModuleOverridesFile()
+		if file == "" {
+			return moduleOverridesResult{}
+		}
+		overrides, err := loadModuleOverrides(config, file)
+		return moduleOverridesResult{file: file, overrides: overrides, err: err}
+	}).(moduleOverridesResult)
+}
+
+func loadModuleOverrides(config Config, file string) (moduleOverrides, error) {
+	r, err := config.fs.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var overrides moduleOverrides
+	if err := json.NewDecoder(r).Decode(&overrides); err != nil {
+		return nil, err
+	}
+
+	for _, module := range SortedStringKeys(overrides) {
+		for property := range overrides[module] {
+			if !InList(property, moduleOverridableProperties) {
+				return nil, fmt.Errorf("module %q: property %q cannot be overridden, only %s can",
+					module, property, strings.Join(moduleOverridableProperties, ", "))
+			}
+		}
+	}
+	return overrides, nil
+}
+
+func moduleOverridesMutator(ctx BottomUpMutatorContext) {
+	result := moduleOverridesForConfig(ctx.Config())
+	// Errors loading the file are reported once by the module_overrides singleton.
+	if result.err != nil {
+		return
+	}
+	properties, ok := result.overrides[ctx.ModuleName()]
+	if !ok {
+		return
+	}
+
+	names := make([]string, 0, len(properties))
+	for property := range properties {
+		names = append(names, property)
+	}
+	sort.Strings(names)
+
+	for _, property := range names {
+		found, err := setModuleOverride(ctx.Module().GetProperties(),
+			fieldNamesForProperties(property), properties[property])
+		if err != nil {
+			ctx.ModuleErrorf("%s: invalid value for property %q: %s", result.file, property, err)
+		} else if !found {
+			ctx.ModuleErrorf("%s: module type %q has no property %q", result.file,
+				ctx.ModuleType(), property)
+		}
+	}
+}
+
+// setModuleOverride sets the field with the given path in every property struct that has it to
+// the JSON value, and returns whether any property struct had the field.
+func setModuleOverride(properties []interface{}, fields []string, value json.RawMessage) (bool, error) {
+	found := false
+	for _, propertyStruct := range properties {
+		field := reflect.ValueOf(propertyStruct).Elem()
+		for _, name := range fields {
+			if field.Kind() != reflect.Struct {
+				field = reflect.Value{}
+				break
+			}
+			field = field.FieldByName(name)
+			if !field.IsValid() {
+				break
+			}
+		}
+		if !field.IsValid() || !field.CanSet() {
+			continue
+		}
+
+		v := reflect.New(field.Type())
+		if err := json.Unmarshal(value, v.Interface()); err != nil {
+			return false, err
+		}
+		field.Set(v.Elem())
+		found = true
+	}
+	return found, nil
+}
+
+func ModuleOverridesSingleton() Singleton {
+	return &moduleOverridesSingleton{}
+}
+
+type moduleOverridesSingleton struct{}
+
+// GenerateBuildActions reports errors in the module overrides file and the modules in it that do
+// not exist, and reruns Soong when the file changes.
+func (m *moduleOverridesSingleton) GenerateBuildActions(ctx SingletonContext) {
+	result := moduleOverridesForConfig(ctx.Config())
+	if result.file == "" {
+		return
+	}
+	ctx.AddNinjaFileDeps(result.file)
+	if result.err != nil {
+		ctx.Errorf("failed to load module overrides file %s: %s", result.file, result.err)
+		return
+	}
+
+	exists := make(map[string]bool)
+	ctx.VisitAllModules(func(module Module) {
+		exists[ctx.ModuleName(module)] = true
+	})
+	for _, module := range SortedStringKeys(result.overrides) {
+		if !exists[module] {
+			ctx.Errorf("%s: module %q does not exist", result.file, module)
+		}
+	}
+}
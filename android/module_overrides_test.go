@@ -0,0 +1,171 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"testing"
+)
+
+type moduleOverridesTestModule struct {
+	ModuleBase
+	properties struct {
+		Certificate *string
+		Dex_preopt  struct {
+			Enabled *bool
+		}
+	}
+}
+
+func newModuleOverridesTestModule() Module {
+	m := &moduleOverridesTestModule{}
+	m.AddProperties(&m.properties)
+	InitAndroidArchModule(m, HostAndDeviceSupported, MultilibCommon)
+	return m
+}
+
+func (m *moduleOverridesTestModule) GenerateAndroidBuildActions(ModuleContext) {}
+
+const moduleOverridesTestBp = `
+	test_module {
+		name: "app",
+		certificate: "testkey",
+	}
+
+	test_module {
+		name: "other",
+		certificate: "testkey",
+		target: {
+			android: {
+				enabled: true,
+			},
+		},
+		product_variables: {
+			unbundled_build: {
+				enabled: true,
+			},
+		},
+	}
+`
+
+func testModuleOverrides(t *testing.T, overrides string) (*TestContext, []error) {
+	t.Helper()
+	fs := map[string][]byte{
+		"Android.bp":                   []byte(moduleOverridesTestBp),
+		"vendor/module_overrides.json": []byte(overrides),
+	}
+	config := TestArchConfig(buildDir, nil, "", fs)
+	config.TestProductVariables.ModuleOverridesFile = stringPtr("vendor/module_overrides.json")
+	config.TestProductVariables.Unbundled_build = boolPtr(true)
+
+	ctx := NewTestArchContext()
+	ctx.RegisterModuleType("test_module", newModuleOverridesTestModule)
+	ctx.PreDepsMutators(registerVariableMutators)
+	ctx.RegisterSingletonType("module_overrides", ModuleOverridesSingleton)
+	ctx.Register(config)
+
+	_, errs := ctx.ParseBlueprintsFiles("Android.bp")
+	FailIfErrored(t, errs)
+	_, errs = ctx.PrepareBuildActions(config)
+	return ctx, errs
+}
+
+func TestModuleOverrides(t *testing.T) {
+	ctx, errs := testModuleOverrides(t, `{
+		"app": {
+			"certificate": "platform",
+			"dex_preopt.enabled": false
+		},
+		"other": {
+			"enabled": false
+		}
+	}`)
+	FailIfErrored(t, errs)
+
+	app := ctx.ModuleForTests("app", "android_common").Module().(*moduleOverridesTestModule)
+	if g, w := String(app.properties.Certificate), "platform"; g != w {
+		t.Errorf("expected certificate %q, got %q", w, g)
+	}
+	if g := app.properties.Dex_preopt.Enabled; g == nil || *g {
+		t.Errorf("expected dex_preopt.enabled to be false, got %v", g)
+	}
+
+	other := ctx.ModuleForTests("other", "android_common").Module().(*moduleOverridesTestModule)
+	if other.Enabled() {
+		t.Errorf("expected other to be disabled by the module overrides file instead of enabled by the product variable")
+	}
+	if g, w := String(other.properties.Certificate), "testkey"; g != w {
+		t.Errorf("expected certificate %q, got %q", w, g)
+	}
+}
+
+func TestModuleOverridesErrors(t *testing.T) {
+	testCases := []struct {
+		name      string
+		overrides string
+		err       string
+	}{
+		{
+			name:      "malformed file",
+			overrides: `{"app": {"certificate": "platform"}`,
+			err:       `failed to load module overrides file vendor/module_overrides.json: unexpected EOF`,
+		},
+		{
+			name:      "disallowed property",
+			overrides: `{"app": {"srcs": ["a.java"]}}`,
+			err:       `module "app": property "srcs" cannot be overridden`,
+		},
+		{
+			name:      "missing module",
+			overrides: `{"missing": {"enabled": false}}`,
+			err:       `vendor/module_overrides.json: module "missing" does not exist`,
+		},
+		{
+			name:      "wrong type",
+			overrides: `{"app": {"certificate": false}}`,
+			err:       `vendor/module_overrides.json: invalid value for property "certificate"`,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			_, errs := testModuleOverrides(t, test.overrides)
+			CheckErrorsAgainstExpectations(t, errs, []string{test.err})
+		})
+	}
+}
+
+func TestModuleOverridesMissingProperty(t *testing.T) {
+	config := TestArchConfig(buildDir, nil, "", map[string][]byte{
+		"Android.bp": []byte(`
+			filegroup {
+				name: "fg",
+			}
+		`),
+		"module_overrides.json": []byte(`{"fg": {"certificate": "platform"}}`),
+	})
+	config.TestProductVariables.ModuleOverridesFile = stringPtr("module_overrides.json")
+
+	ctx := NewTestArchContext()
+	ctx.RegisterModuleType("filegroup", FileGroupFactory)
+	ctx.PreDepsMutators(registerVariableMutators)
+	ctx.Register(config)
+
+	_, errs := ctx.ParseBlueprintsFiles("Android.bp")
+	FailIfErrored(t, errs)
+	_, errs = ctx.PrepareBuildActions(config)
+	CheckErrorsAgainstExpectations(t, errs, []string{
+		`module "fg": module_overrides.json: module type "filegroup" has no property "certificate"`,
+	})
+}
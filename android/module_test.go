@@ -15,6 +15,7 @@
 package android
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -187,3 +188,127 @@ func TestErrorDependsOnDisabledModule(t *testing.T) {
 	_, errs = ctx.PrepareBuildActions(config)
 	FailIfNoMatchingErrors(t, `module "foo": depends on disabled module "bar"`, errs)
 }
+
+type installModule struct {
+	ModuleBase
+}
+
+func (m *installModule) GenerateAndroidBuildActions(ctx ModuleContext) {
+	ctx.InstallFile(PathForModuleInstall(ctx, "bin", ctx.Arch().ArchType.String()), ctx.ModuleName(),
+		PathForModuleSrc(ctx, "a.txt"))
+}
+
+func installModuleFactory() Module {
+	m := &installModule{}
+	InitAndroidArchModule(m, DeviceSupported, MultilibBoth)
+	return m
+}
+
+func TestInstallInitRcAndVintfFragments(t *testing.T) {
+	bp := `
+		install {
+			name: "foo",
+			init_rc: ["foo.rc"],
+			vintf_fragments: ["foo.xml"],
+		}
+	`
+
+	fs := map[string][]byte{
+		"a.txt":   nil,
+		"foo.rc":  nil,
+		"foo.xml": nil,
+	}
+
+	config := TestArchConfig(buildDir, nil, bp, fs)
+
+	ctx := NewTestArchContext()
+	ctx.RegisterModuleType("install", installModuleFactory)
+	ctx.Register(config)
+
+	_, errs := ctx.ParseFileList(".", []string{"Android.bp"})
+	FailIfErrored(t, errs)
+	_, errs = ctx.PrepareBuildActions(config)
+	FailIfErrored(t, errs)
+
+	productOut := buildDir + "/target/product/test_device/system/"
+
+	primary := ctx.ModuleForTests("foo", "android_arm64_armv8-a")
+	for _, installed := range []string{"etc/init/foo.rc", "etc/vintf/manifest/foo.xml"} {
+		primary.Output(productOut + installed)
+	}
+	if installed := primary.Module().FilesToInstall().Strings(); len(installed) != 3 {
+		t.Errorf("expected 3 installed files, got %q", installed)
+	}
+
+	secondary := ctx.ModuleForTests("foo", "android_arm_armv7-a-neon")
+	if rule := secondary.MaybeOutput(productOut + "etc/init/foo.rc"); rule.Rule != nil {
+		t.Errorf("expected secondary arch variant not to install foo.rc")
+	}
+}
+
+func TestModulesInDirs(t *testing.T) {
+	bp := `
+		install {
+			name: "foo",
+		}
+	`
+
+	fs := map[string][]byte{
+		"a/Android.bp":     []byte(bp),
+		"a/b/c/Android.bp": []byte(strings.Replace(bp, "foo", "bar", 1)),
+	}
+
+	run := func(t *testing.T, inMake bool) (TestingSingleton, Config) {
+		config := TestArchConfig(buildDir, nil, "", fs)
+		config.inMake = inMake
+
+		ctx := NewTestArchContext()
+		ctx.RegisterModuleType("install", installModuleFactory)
+		ctx.RegisterSingletonType("buildtarget", BuildTargetSingleton)
+		ctx.RegisterSingletonType("phony", phonySingletonFactory)
+		ctx.Register(config)
+
+		_, errs := ctx.ParseFileList(".", []string{"a/Android.bp", "a/b/c/Android.bp"})
+		FailIfErrored(t, errs)
+		_, errs = ctx.PrepareBuildActions(config)
+		FailIfErrored(t, errs)
+
+		return ctx.SingletonForTests("phony"), config
+	}
+
+	t.Run("soong", func(t *testing.T) {
+		phony, _ := run(t, false)
+
+		// Each directory builds the modules defined in it and the MODULES-IN-* target of its
+		// subdirectories, including the ones without an Android.bp file.
+		expected := map[string][]string{
+			"MODULES-IN-a":     {"foo-install", "MODULES-IN-a-b"},
+			"MODULES-IN-a-b":   {"MODULES-IN-a-b-c"},
+			"MODULES-IN-a-b-c": {"bar-install"},
+		}
+
+		for target, deps := range expected {
+			implicits := phony.Output(target).Implicits.Strings()
+			for _, dep := range deps {
+				if !InList(dep, implicits) {
+					t.Errorf("expected %q in the dependencies of %s, got %q", dep, target, implicits)
+				}
+			}
+		}
+
+		if implicits := phony.Output("MODULES-IN-a-b").Implicits.Strings(); InList("foo-install", implicits) {
+			t.Errorf("expected MODULES-IN-a-b not to build foo, got %q", implicits)
+		}
+	})
+
+	t.Run("make", func(t *testing.T) {
+		// Make generates the MODULES-IN-* targets when Soong is embedded in Make.
+		_, config := run(t, true)
+		if _, exists := getPhonyMap(config)["MODULES-IN-a"]; exists {
+			t.Errorf("expected no MODULES-IN-a target when embedded in Make")
+		}
+		if _, exists := getPhonyMap(config)["foo-install"]; !exists {
+			t.Errorf("expected foo-install target when embedded in Make")
+		}
+	})
+}
@@ -145,7 +145,10 @@ var postDeps = []RegisterMutatorFunc{
 	RegisterPrebuiltsPostDepsMutators,
 	RegisterVisibilityRuleEnforcer,
 	RegisterNeverallowMutator,
+	RegisterDeprecationMutator,
 	RegisterOverridePostDepsMutators,
+	RegisterUnbundledBuildMutator,
+	RegisterLicensesDepsMutator,
 }
 
 var finalDeps = []RegisterMutatorFunc{}
@@ -15,6 +15,7 @@
 package android
 
 import (
+	"fmt"
 	"path/filepath"
 	"reflect"
 	"regexp"
@@ -56,6 +57,7 @@ func init() {
 	AddNeverAllowRules(createJavaDeviceForHostRules()...)
 	AddNeverAllowRules(createCcSdkVariantRules()...)
 	AddNeverAllowRules(createUncompressDexRules()...)
+	AddNeverAllowRules(createLayeringRules()...)
 }
 
 // Add a NeverAllow rule to the set of rules to apply.
@@ -220,6 +222,53 @@ func createUncompressDexRules() []Rule {
 	}
 }
 
+// LayeringRule declares that the modules in a directory tree cannot depend on the modules in other
+// directory trees.
+type LayeringRule struct {
+	// The directory tree that the rule applies to, for example "frameworks".
+	Dir string
+
+	// The directory trees that the modules in Dir cannot depend on, for example "vendor".
+	CannotDependOn []string
+
+	// Projects under Dir that are still allowed to depend on modules in CannotDependOn.  New
+	// entries should not be added, the dependency should be inverted instead.
+	Allowed []string
+}
+
+// The layering rules of the tree.  Other packages add their own with AddLayeringRules.
+var layeringRules = []LayeringRule{
+	{
+		Dir:            "frameworks",
+		CannotDependOn: []string{"vendor"},
+	},
+}
+
+// AddLayeringRules adds rules that prevent the modules in a directory tree from depending on the
+// modules in other directory trees.
+func AddLayeringRules(rules ...LayeringRule) {
+	for _, l := range rules {
+		AddNeverAllowRules(l.neverAllowRule())
+	}
+}
+
+func (l LayeringRule) neverAllowRule() Rule {
+	return NeverAllow().
+		In(l.Dir).
+		NotIn(l.Allowed...).
+		InDirectDepsUnder(l.CannotDependOn...).
+		Because(fmt.Sprintf("modules in %s cannot depend on modules in %s.",
+			cleanPaths([]string{l.Dir})[0], strings.Join(cleanPaths(l.CannotDependOn), " or ")))
+}
+
+func createLayeringRules() []Rule {
+	var rules []Rule
+	for _, l := range layeringRules {
+		rules = append(rules, l.neverAllowRule())
+	}
+	return rules
+}
+
 func neverallowMutator(ctx BottomUpMutatorContext) {
 	m, ok := ctx.Module().(Module)
 	if !ok {
@@ -253,11 +302,20 @@ func neverallowMutator(ctx BottomUpMutatorContext) {
 			continue
 		}
 
+		depsUnderPaths := n.directDepsUnderPaths(ctx)
+		if len(n.directDepsPaths) > 0 && len(depsUnderPaths) == 0 {
+			continue
+		}
+
 		if !n.appliesToBootclasspathJar(ctx) {
 			continue
 		}
 
-		ctx.ModuleErrorf("violates " + n.String())
+		if len(depsUnderPaths) > 0 {
+			ctx.ModuleErrorf("violates %s (dependencies: %s)", n.String(), strings.Join(depsUnderPaths, ", "))
+		} else {
+			ctx.ModuleErrorf("violates " + n.String())
+		}
 	}
 }
 
@@ -352,6 +410,8 @@ type Rule interface {
 
 	InDirectDeps(deps ...string) Rule
 
+	InDirectDepsUnder(path ...string) Rule
+
 	WithOsClass(osClasses ...OsClass) Rule
 
 	ModuleType(types ...string) Rule
@@ -380,6 +440,8 @@ type rule struct {
 
 	directDeps map[string]bool
 
+	directDepsPaths []string
+
 	osClasses []OsClass
 
 	moduleTypes       []string
@@ -413,6 +475,11 @@ func (r *rule) InDirectDeps(deps ...string) Rule {
 	return r
 }
 
+func (r *rule) InDirectDepsUnder(path ...string) Rule {
+	r.directDepsPaths = append(r.directDepsPaths, cleanPaths(path)...)
+	return r
+}
+
 func (r *rule) WithOsClass(osClasses ...OsClass) Rule {
 	r.osClasses = append(r.osClasses, osClasses...)
 	return r
@@ -492,6 +559,9 @@ func (r *rule) String() string {
 	for k := range r.directDeps {
 		s += " deps:" + k
 	}
+	for _, v := range r.directDepsPaths {
+		s += " deps-dir:" + v + "*"
+	}
 	for _, v := range r.osClasses {
 		s += " os:" + v.String()
 	}
@@ -526,6 +596,23 @@ func (r *rule) appliesToDirectDeps(ctx BottomUpMutatorContext) bool {
 	return matches
 }
 
+// directDepsUnderPaths returns the quoted names of the direct dependencies that are in the
+// directories of the rule.
+func (r *rule) directDepsUnderPaths(ctx BottomUpMutatorContext) []string {
+	if len(r.directDepsPaths) == 0 {
+		return nil
+	}
+
+	var deps []string
+	ctx.VisitDirectDeps(func(m Module) {
+		if HasAnyPrefix(ctx.OtherModuleDir(m)+"/", r.directDepsPaths) {
+			deps = append(deps, strconv.Quote(ctx.OtherModuleName(m)))
+		}
+	})
+
+	return FirstUniqueStrings(deps)
+}
+
 func (r *rule) appliesToBootclasspathJar(ctx BottomUpMutatorContext) bool {
 	if !r.onlyBootclasspathJar {
 		return true
@@ -59,6 +59,33 @@ var neverallowTests = []struct {
 		},
 	},
 
+	// in direct deps under tests
+	{
+		name: "not_allowed_in_direct_deps_under",
+		rules: []Rule{
+			NeverAllow().In("top").InDirectDepsUnder("restricted"),
+		},
+		fs: map[string][]byte{
+			"restricted/Android.bp": []byte(`
+				cc_library {
+					name: "librestricted",
+				}`),
+			"top/Android.bp": []byte(`
+				cc_library {
+					name: "libtop",
+					static_libs: ["librestricted"],
+				}`),
+			"other/Android.bp": []byte(`
+				cc_library {
+					name: "libother",
+					static_libs: ["librestricted"],
+				}`),
+		},
+		expectedErrors: []string{
+			`module "libtop": violates neverallow dir:top/\* deps-dir:restricted/\*`,
+		},
+	},
+
 	// Test android specific rules
 
 	// include_dir rule tests
@@ -303,6 +330,71 @@ var neverallowTests = []struct {
 			`module "outside_allowed_list": violates neverallow`,
 		},
 	},
+	// Layering rule tests
+	{
+		name: "frameworks depending on vendor",
+		fs: map[string][]byte{
+			"vendor/Android.bp": []byte(`
+				cc_library {
+					name: "libvendor",
+				}`),
+			"frameworks/Android.bp": []byte(`
+				cc_library {
+					name: "libframeworks",
+					static_libs: ["libvendor"],
+				}`),
+		},
+		expectedErrors: []string{
+			`modules in frameworks/ cannot depend on modules in vendor/. \(dependencies: "libvendor"\)`,
+		},
+	},
+	{
+		name: "layering rule with allowed project",
+		rules: []Rule{
+			LayeringRule{
+				Dir:            "system",
+				CannotDependOn: []string{"vendor", "device"},
+				Allowed:        []string{"system/allowed"},
+			}.neverAllowRule(),
+		},
+		fs: map[string][]byte{
+			"vendor/Android.bp": []byte(`
+				cc_library {
+					name: "libvendor",
+				}`),
+			"device/Android.bp": []byte(`
+				cc_library {
+					name: "libdevice",
+				}`),
+			"system/allowed/Android.bp": []byte(`
+				cc_library {
+					name: "liballowed",
+					static_libs: ["libvendor"],
+				}`),
+			"system/core/Android.bp": []byte(`
+				cc_library {
+					name: "libcore",
+					static_libs: ["libvendor", "libdevice"],
+				}`),
+		},
+		expectedErrors: []string{
+			`module "libcore": violates neverallow .* modules in system/ cannot depend on modules in vendor/ or device/. \(dependencies: "libvendor", "libdevice"\)`,
+		},
+	},
+	{
+		name: "vendor depending on frameworks",
+		fs: map[string][]byte{
+			"frameworks/Android.bp": []byte(`
+				cc_library {
+					name: "libframeworks",
+				}`),
+			"vendor/Android.bp": []byte(`
+				cc_library {
+					name: "libvendor",
+					static_libs: ["libframeworks"],
+				}`),
+		},
+	},
 	{
 		name: "uncompress_dex inside art",
 		fs: map[string][]byte{
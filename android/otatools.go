@@ -0,0 +1,212 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/blueprint"
+)
+
+func init() {
+	RegisterModuleType("otatools_package", OtatoolsPackageFactory)
+}
+
+type otatoolsDependencyTag struct {
+	blueprint.BaseDependencyTag
+	name string
+}
+
+var (
+	otatoolsToolTag      = otatoolsDependencyTag{name: "tool"}
+	otatoolsFrameworkTag = otatoolsDependencyTag{name: "framework"}
+)
+
+type otatoolsPackageProperties struct {
+	// host binaries to place in bin/ of the package.
+	Tools []string
+
+	// host java libraries to place in framework/ of the package.
+	Framework []string
+
+	// releasetools scripts to place in releasetools/ of the package, at their path relative to
+	// the directory of the module, or to the output directory of the module that generates them.
+	Releasetools []string `android:"path"`
+
+	// keys and key metadata to place in the package at their path in the source tree.
+	Keys []string `android:"path"`
+}
+
+type otatoolsPackage struct {
+	ModuleBase
+
+	properties otatoolsPackageProperties
+
+	outputFile OutputPath
+}
+
+// otatools_package collects the host binaries, java libraries, keys and releasetools scripts
+// needed to sign target-files packages and generate OTAs into a single otatools.zip, which is
+// copied to the dist directory for the otatools-package goal.  The contents come from module
+// dependencies rather than a hardcoded file list, so the package stays in sync with the tools that
+// are actually built.  The host shared libraries that the tools depend on are packaged into lib/
+// and lib64/, like in the host output directory.
+func OtatoolsPackageFactory() Module {
+	module := &otatoolsPackage{}
+	module.AddProperties(&module.properties)
+	InitAndroidModule(module)
+	return module
+}
+
+func (p *otatoolsPackage) DepsMutator(ctx BottomUpMutatorContext) {
+	variations := ctx.Config().BuildOSTarget.Variations()
+	ctx.AddFarVariationDependencies(variations, otatoolsToolTag, p.properties.Tools...)
+	variations = ctx.Config().BuildOSCommonTarget.Variations()
+	ctx.AddFarVariationDependencies(variations, otatoolsFrameworkTag, p.properties.Framework...)
+}
+
+func (p *otatoolsPackage) GenerateAndroidBuildActions(ctx ModuleContext) {
+	var tools, framework Paths
+	ctx.VisitDirectDeps(func(m Module) {
+		switch tag := ctx.OtherModuleDependencyTag(m); tag {
+		case otatoolsToolTag:
+			if t, ok := m.(HostToolProvider); ok && t.HostToolPath().Valid() {
+				tools = append(tools, t.HostToolPath().Path())
+			} else {
+				ctx.PropertyErrorf("tools", "%q is not a host tool", ctx.OtherModuleName(m))
+			}
+		case otatoolsFrameworkTag:
+			if producer, ok := m.(OutputFileProducer); ok {
+				files, err := producer.OutputFiles("")
+				if err != nil {
+					ctx.PropertyErrorf("framework", "%s", err)
+				}
+				framework = append(framework, files...)
+			} else {
+				ctx.PropertyErrorf("framework", "%q does not produce output files", ctx.OtherModuleName(m))
+			}
+		}
+	})
+
+	releasetools := PathsForModuleSrc(ctx, p.properties.Releasetools)
+	keys := PathsForModuleSrc(ctx, p.properties.Keys)
+
+	// Copy the shared libraries to their path in the package, so that they keep the name they are
+	// installed with.
+	libsDir := PathForModuleOut(ctx, "libs")
+	var libs Paths
+	hostLibs := p.hostSharedLibs(ctx)
+	for _, rel := range SortedStringKeys(hostLibs) {
+		staged := libsDir.Join(ctx, rel)
+		ctx.Build(pctx, BuildParams{
+			Rule:   Cp,
+			Input:  hostLibs[rel],
+			Output: staged,
+		})
+		libs = append(libs, staged)
+	}
+
+	p.outputFile = PathForModuleOut(ctx, "otatools.zip").OutputPath
+
+	rule := NewRuleBuilder()
+	cmd := rule.Command().
+		BuiltTool(ctx, "soong_zip").
+		Flag("-d").
+		FlagWithOutput("-o ", p.outputFile).
+		FlagForEachInput("-f ", keys)
+	if len(libs) > 0 {
+		cmd.FlagWithArg("-C ", libsDir.String()).
+			FlagForEachInput("-f ", libs)
+	}
+	if len(releasetools) > 0 {
+		cmd.FlagWithArg("-P ", "releasetools")
+		for _, script := range releasetools {
+			// Strip the directory that the path is relative to, which is the directory of the
+			// module for source files and the output directory of the module that generates it
+			// otherwise.
+			dir := strings.TrimSuffix(strings.TrimSuffix(script.String(), script.Rel()), "/")
+			if dir == "" {
+				dir = "."
+			}
+			cmd.FlagWithArg("-C ", dir).FlagWithInput("-f ", script)
+		}
+	}
+	if len(framework) > 0 {
+		cmd.FlagWithArg("-P ", "framework").
+			Flag("-j").
+			FlagForEachInput("-f ", framework)
+	}
+	if len(tools) > 0 {
+		cmd.FlagWithArg("-P ", "bin").
+			Flag("-j").
+			FlagForEachInput("-f ", tools)
+	}
+	rule.Build(pctx, ctx, "otatools", "otatools.zip")
+}
+
+// hostSharedLibs returns the built files of the host shared libraries that the tools depend on,
+// directly or through other libraries, keyed by their install path relative to the host output
+// directory, for example lib64/libc++.so.
+func (p *otatoolsPackage) hostSharedLibs(ctx ModuleContext) map[string]Path {
+	libs := make(map[string]Path)
+	ctx.WalkDeps(func(child, parent Module) bool {
+		if parent == ctx.Module() && ctx.OtherModuleDependencyTag(child) != otatoolsToolTag {
+			return false
+		}
+		if !child.base().Host() {
+			return false
+		}
+		for _, spec := range child.PackagingSpecs() {
+			// The install path is host/<os>-x86/<rel>.
+			parts := strings.SplitN(spec.InstallPath().path, "/", 3)
+			if spec.SrcPath() == nil || len(parts) != 3 || parts[0] != "host" {
+				continue
+			}
+			if rel := parts[2]; strings.HasPrefix(rel, "lib/") || strings.HasPrefix(rel, "lib64/") {
+				libs[rel] = spec.SrcPath()
+			}
+		}
+		return true
+	})
+	return libs
+}
+
+func (p *otatoolsPackage) OutputFiles(tag string) (Paths, error) {
+	switch tag {
+	case "":
+		return Paths{p.outputFile}, nil
+	default:
+		return nil, fmt.Errorf("unsupported module reference tag %q", tag)
+	}
+}
+
+func (p *otatoolsPackage) AndroidMkEntries() []AndroidMkEntries {
+	return []AndroidMkEntries{{
+		Class:      "ETC",
+		OutputFile: OptionalPathForPath(p.outputFile),
+		ExtraEntries: []AndroidMkExtraEntriesFunc{
+			func(entries *AndroidMkEntries) {
+				entries.SetBool("LOCAL_UNINSTALLABLE_MODULE", true)
+			},
+		},
+		ExtraFooters: []AndroidMkExtraFootersFunc{
+			func(w io.Writer, name, prefix, moduleDir string, entries *AndroidMkEntries) {
+				fmt.Fprintf(w, "$(call dist-for-goals,otatools-package,%s:otatools.zip)\n", p.outputFile)
+			},
+		},
+	}}
+}
@@ -0,0 +1,181 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"strings"
+	"testing"
+)
+
+type otatoolsTestTool struct {
+	ModuleBase
+	properties struct {
+		Shared_libs []string
+	}
+	installPath InstallPath
+	outputFile  Path
+}
+
+func (m *otatoolsTestTool) DepsMutator(ctx BottomUpMutatorContext) {
+	ctx.AddDependency(ctx.Module(), nil, m.properties.Shared_libs...)
+}
+
+func (m *otatoolsTestTool) GenerateAndroidBuildActions(ctx ModuleContext) {
+	m.outputFile = PathForModuleSrc(ctx, ctx.ModuleName())
+	m.installPath = ctx.InstallFile(PathForModuleInstall(ctx, "bin"), ctx.ModuleName(), m.outputFile)
+}
+
+func (m *otatoolsTestTool) HostToolPath() OptionalPath {
+	return OptionalPathForPath(m.installPath)
+}
+
+func (m *otatoolsTestTool) OutputFiles(tag string) (Paths, error) {
+	return Paths{m.outputFile}, nil
+}
+
+func otatoolsTestToolFactory() Module {
+	module := &otatoolsTestTool{}
+	module.AddProperties(&module.properties)
+	InitAndroidArchModule(module, HostSupported, MultilibFirst)
+	return module
+}
+
+func otatoolsTestJarFactory() Module {
+	module := &otatoolsTestTool{}
+	InitAndroidArchModule(module, HostSupported, MultilibCommon)
+	return module
+}
+
+type otatoolsTestLib struct {
+	ModuleBase
+}
+
+func (m *otatoolsTestLib) GenerateAndroidBuildActions(ctx ModuleContext) {
+	lib := PathForModuleOut(ctx, "unstripped", ctx.ModuleName())
+	ctx.Build(pctx, BuildParams{Rule: Touch, Output: lib})
+	ctx.InstallFile(PathForModuleInstall(ctx, "lib64"), ctx.ModuleName(), lib)
+}
+
+func otatoolsTestLibFactory() Module {
+	module := &otatoolsTestLib{}
+	InitAndroidArchModule(module, HostSupported, MultilibFirst)
+	return module
+}
+
+type otatoolsTestGen struct {
+	ModuleBase
+	outputFile Path
+}
+
+func (m *otatoolsTestGen) GenerateAndroidBuildActions(ctx ModuleContext) {
+	out := PathForModuleOut(ctx, "sign_target_files_apks.py")
+	ctx.Build(pctx, BuildParams{Rule: Touch, Output: out})
+	m.outputFile = out
+}
+
+func (m *otatoolsTestGen) OutputFiles(tag string) (Paths, error) {
+	return Paths{m.outputFile}, nil
+}
+
+func otatoolsTestGenFactory() Module {
+	module := &otatoolsTestGen{}
+	InitAndroidModule(module)
+	return module
+}
+
+func TestOtatoolsPackage(t *testing.T) {
+	bp := `
+		otatools_package {
+			name: "otatools",
+			tools: ["signtool"],
+			framework: ["signlib.jar"],
+			releasetools: [
+				"releasetools/ota_from_target_files.py",
+				":gen_releasetools",
+			],
+			keys: ["security/testkey.x509.pem"],
+		}
+
+		tool {
+			name: "signtool",
+			shared_libs: ["libsign.so"],
+		}
+
+		lib {
+			name: "libsign.so",
+		}
+
+		jar {
+			name: "signlib.jar",
+		}
+
+		gen {
+			name: "gen_releasetools",
+		}
+	`
+
+	fs := map[string][]byte{
+		"signtool":                              nil,
+		"signlib.jar":                           nil,
+		"releasetools/ota_from_target_files.py": nil,
+		"security/testkey.x509.pem":             nil,
+	}
+
+	config := TestArchConfig(buildDir, nil, bp, fs)
+
+	ctx := NewTestArchContext()
+	ctx.RegisterModuleType("otatools_package", OtatoolsPackageFactory)
+	ctx.RegisterModuleType("tool", otatoolsTestToolFactory)
+	ctx.RegisterModuleType("lib", otatoolsTestLibFactory)
+	ctx.RegisterModuleType("jar", otatoolsTestJarFactory)
+	ctx.RegisterModuleType("gen", otatoolsTestGenFactory)
+	ctx.Register(config)
+
+	_, errs := ctx.ParseFileList(".", []string{"Android.bp"})
+	FailIfErrored(t, errs)
+	_, errs = ctx.PrepareBuildActions(config)
+	FailIfErrored(t, errs)
+
+	otatools := ctx.ModuleForTests("otatools", "")
+	zip := otatools.Output("otatools.zip")
+
+	libsDir := buildDir + "/.intermediates/otatools/libs"
+	libCopy := otatools.Output(libsDir + "/lib64/libsign.so")
+	if g, w := libCopy.Input.String(), buildDir+"/.intermediates/libsign.so/linux_glibc_x86_64/unstripped/libsign.so"; g != w {
+		t.Errorf("expected shared library copied from %q, got %q", w, g)
+	}
+
+	genDir := buildDir + "/.intermediates/gen_releasetools"
+	expectedCommand := "-d -o " + zip.Output.String() +
+		" -f security/testkey.x509.pem" +
+		" -C " + libsDir + " -f " + libsDir + "/lib64/libsign.so" +
+		" -P releasetools -C . -f releasetools/ota_from_target_files.py" +
+		" -C " + genDir + " -f " + genDir + "/sign_target_files_apks.py" +
+		" -P framework -j -f signlib.jar" +
+		" -P bin -j -f " + buildDir + "/host/linux-x86/bin/signtool"
+	if !strings.HasSuffix(zip.RuleParams.Command, expectedCommand) {
+		t.Errorf("expected command to end with %q, got %q", expectedCommand, zip.RuleParams.Command)
+	}
+
+	entries := AndroidMkEntriesForTest(t, config, "", otatools.Module())[0]
+	var footer strings.Builder
+	for _, f := range entries.ExtraFooters {
+		f(&footer, "otatools", "", "", &entries)
+	}
+	expectedDist := "$(call dist-for-goals,otatools-package," + zip.Output.String() + ":otatools.zip)"
+	if !strings.Contains(footer.String(), expectedDist) {
+		t.Errorf("expected footer to contain %q, got %q", expectedDist, footer.String())
+	}
+}
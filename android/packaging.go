@@ -0,0 +1,67 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+// PackagingSpec describes a file that a module installs: the built file and the path it is
+// installed to.  Unlike the installed files of a module, the packaging specs are recorded even when
+// Soong doesn't install the file itself, which is the case for device modules when Soong is
+// embedded in Make.  Code that needs to know what a module puts on the device, or that packages
+// the files of other modules, should use the packaging specs and their built files instead of the
+// installed files.
+type PackagingSpec struct {
+	installPath InstallPath
+
+	// The built file that is installed, or nil for symlinks.
+	srcPath Path
+
+	// The target of the symlink if the file is a symlink.
+	symlinkTarget string
+
+	executable bool
+}
+
+// InstallPath returns the path the file is installed to.  The file may not be built by Soong.
+func (p PackagingSpec) InstallPath() InstallPath {
+	return p.installPath
+}
+
+// SrcPath returns the built file that is installed, or nil if the installed file is a symlink.
+func (p PackagingSpec) SrcPath() Path {
+	return p.srcPath
+}
+
+// SymlinkTarget returns the target of the installed symlink, or "" if the installed file is not a
+// symlink.
+func (p PackagingSpec) SymlinkTarget() string {
+	return p.symlinkTarget
+}
+
+// Executable returns true if the installed file is executable.
+func (p PackagingSpec) Executable() bool {
+	return p.executable
+}
+
+// DevicePath returns the absolute path of the file on the device, e.g. /system/framework/foo.jar,
+// or false if the file is not installed into a partition of the device.
+func (p PackagingSpec) DevicePath() (string, bool) {
+	return p.installPath.devicePath()
+}
+
+// Partition returns the directory of the partition that the file is installed into, relative to
+// the product out directory, e.g. system or vendor, or false if the file is not installed into a
+// partition of the device.
+func (p PackagingSpec) Partition() (string, bool) {
+	return p.installPath.partitionDir()
+}
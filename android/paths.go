@@ -376,13 +376,10 @@ func expandOneSrcPath(ctx ModuleContext, s string, expandedExcludes []string) (P
 		} else if t != "" {
 			return nil, fmt.Errorf("path dependency %q is not an output file producing module", s)
 		} else if srcProducer, ok := module.(SourceFileProducer); ok {
-			moduleSrcs := srcProducer.Srcs()
-			for _, e := range expandedExcludes {
-				for j := 0; j < len(moduleSrcs); j++ {
-					if moduleSrcs[j].String() == e {
-						moduleSrcs = append(moduleSrcs[:j], moduleSrcs[j+1:]...)
-						j--
-					}
+			var moduleSrcs Paths
+			for _, src := range srcProducer.Srcs() {
+				if !matchesExclude(src.String(), expandedExcludes) {
+					moduleSrcs = append(moduleSrcs, src)
 				}
 			}
 			return moduleSrcs, nil
@@ -400,14 +397,29 @@ func expandOneSrcPath(ctx ModuleContext, s string, expandedExcludes []string) (P
 			reportPathErrorf(ctx, "module source path %q does not exist", p)
 		}
 
-		j := findStringInSlice(p.String(), expandedExcludes)
-		if j >= 0 {
+		if matchesExclude(p.String(), expandedExcludes) {
 			return nil, nil
 		}
 		return Paths{p}, nil
 	}
 }
 
+// matchesExclude returns true if the path is one of the excludes, or matches one of the excludes
+// that are globs.  Globs in the excludes apply to all the paths after they have been expanded, not
+// only to the paths that are globs themselves.
+func matchesExclude(path string, expandedExcludes []string) bool {
+	for _, e := range expandedExcludes {
+		if pathtools.IsGlob(e) {
+			if match, err := pathtools.Match(e, path); err == nil && match {
+				return true
+			}
+		} else if e == path {
+			return true
+		}
+	}
+	return false
+}
+
 // pathsForModuleSrcFromFullPath returns Paths rooted from the module's local
 // source directory, but strip the local source directory from the beginning of
 // each string. If incDirs is false, strip paths with a trailing '/' from the list.
@@ -1100,7 +1112,13 @@ func (p ModuleOutPath) objPathWithExt(ctx ModuleContext, subdir, ext string) Mod
 }
 
 func pathForModule(ctx ModuleContext) OutputPath {
-	return PathForOutput(ctx, ".intermediates", ctx.ModuleDir(), ctx.ModuleName(), ctx.ModuleSubDir())
+	return PathForOutput(ctx, moduleOutDir(ctx.ModuleDir(), ctx.ModuleName(), ctx.ModuleSubDir())...)
+}
+
+// moduleOutDir returns the components of the intermediates directory of a module variant relative
+// to the output directory, .intermediates/<module dir>/<module name>/<variant>.
+func moduleOutDir(moduleDir, name, subDir string) []string {
+	return []string{".intermediates", moduleDir, name, subDir}
 }
 
 // PathForVndkRefAbiDump returns an OptionalPath representing the path of the
@@ -1239,6 +1257,31 @@ var _ WritablePath = InstallPath{}
 
 func (p InstallPath) writablePath() {}
 
+// partitionDir returns the directory of the partition that the path is installed into, relative to
+// $OUT/target/product/<device>, or false if the path is not installed into a partition of the
+// device.
+func (p InstallPath) partitionDir() (string, bool) {
+	devicePath, ok := p.devicePath()
+	if !ok {
+		return "", false
+	}
+	return strings.SplitN(strings.TrimPrefix(devicePath, "/"), "/", 2)[0], true
+}
+
+// devicePath returns the absolute path of the file on the device, e.g. /system/framework/foo.jar, or
+// false if the path is not installed into a partition of the device.
+func (p InstallPath) devicePath() (string, bool) {
+	if p.config.productVariables.DeviceName == nil {
+		return "", false
+	}
+	productOut := filepath.Join("target", "product", p.config.DeviceName())
+	rel, err := filepath.Rel(productOut, p.path)
+	if err != nil || strings.HasPrefix(rel, "../") || !strings.Contains(rel, "/") {
+		return "", false
+	}
+	return "/" + rel, true
+}
+
 func (p InstallPath) String() string {
 	return filepath.Join(p.config.buildDir, p.baseDir, p.path)
 }
@@ -1060,6 +1060,48 @@ func TestPathsForModuleSrc(t *testing.T) {
 			srcs: []string{"foo/src_special/$"},
 			rels: []string{"src_special/$"},
 		},
+		{
+			name: "glob excludes",
+			bp: `
+			test {
+				name: "foo",
+				srcs: ["src/**/*"],
+				exclude_srcs: [
+					"src/c",
+					"src/e/*",
+				],
+			}`,
+			srcs: []string{"foo/src/b", "foo/src/d"},
+			rels: []string{"src/b", "src/d"},
+		},
+		{
+			name: "path excluded by glob",
+			bp: `
+			test {
+				name: "foo",
+				srcs: [
+					"src/b",
+					"src/e/e",
+				],
+				exclude_srcs: ["src/e/**/*"],
+			}`,
+			srcs: []string{"foo/src/b"},
+			rels: []string{"src/b"},
+		},
+		{
+			name: "filegroup excluded by path",
+			bp: `
+			test {
+				name: "foo",
+				srcs: [
+					"src/b",
+					":a",
+				],
+				exclude_srcs: [":a"],
+			}`,
+			srcs: []string{"foo/src/b"},
+			rels: []string{"src/b"},
+		},
 	}
 
 	testPathForModuleSrc(t, buildDir, tests)
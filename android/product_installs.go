@@ -0,0 +1,91 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+// The product installs the modules in PRODUCT_PACKAGES, the modules that they require and the
+// dependencies that are installed along with them, such as the shared libraries of a binary, like
+// Make does.  Singletons that check or report what the product puts on the device use
+// productInstalledModules instead of visiting every module in the tree, as the tree defines many
+// modules that the product doesn't install.
+
+// InstallNeededDependencyTag is implemented by the dependency tags of dependencies that are
+// installed along with the module, for example the shared libraries of a binary.
+type InstallNeededDependencyTag interface {
+	InstallDepNeeded() bool
+}
+
+func isInstallDepNeeded(tag interface{}) bool {
+	if t, ok := tag.(InstallNeededDependencyTag); ok {
+		return t.InstallDepNeeded()
+	}
+	return false
+}
+
+// modulePackagingSpecs returns the files that an enabled module installs.  The packaging specs
+// are used instead of the installed files, which are empty for device modules when Soong is
+// embedded in Make.
+func modulePackagingSpecs(module Module) []PackagingSpec {
+	if !module.Enabled() {
+		return nil
+	}
+	return module.PackagingSpecs()
+}
+
+// productInstalledModules returns the enabled variants of the modules that the product installs,
+// in the order they are first reached from PRODUCT_PACKAGES.
+func productInstalledModules(ctx SingletonContext) []Module {
+	variants := make(map[string][]Module)
+	ctx.VisitAllModules(func(module Module) {
+		if module.Enabled() {
+			name := ctx.ModuleName(module)
+			variants[name] = append(variants[name], module)
+		}
+	})
+
+	var installed []Module
+	visited := make(map[Module]bool)
+	var queue []Module
+	add := func(module Module) {
+		if !visited[module] {
+			visited[module] = true
+			queue = append(queue, module)
+		}
+	}
+	addByName := func(names []string) {
+		for _, name := range names {
+			for _, module := range variants[name] {
+				add(module)
+			}
+		}
+	}
+
+	addByName(ctx.Config().ProductPackages())
+	for len(queue) > 0 {
+		module := queue[0]
+		queue = queue[1:]
+		installed = append(installed, module)
+
+		addByName(module.RequiredModuleNames())
+		addByName(module.HostRequiredModuleNames())
+		addByName(module.TargetRequiredModuleNames())
+		for _, dep := range module.base().installNeededDeps {
+			if dep.Enabled() {
+				add(dep)
+			}
+		}
+	}
+
+	return installed
+}
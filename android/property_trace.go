@@ -0,0 +1,186 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/google/blueprint/proptools"
+)
+
+// Property tracing is a debugging aid that shows where the final value of each property of a
+// module came from.  Setting SOONG_DUMP_MODULE_PROPERTIES to a comma separated list of module
+// names records, for each of those modules, which of the Blueprint file, the defaults modules,
+// the arch, multilib and target specific properties and the product variables changed each
+// property.  The final values and their sources are written to
+// module_properties/<module>/<variant>.txt in the output directory, one file per variant, by the
+// module_properties_dump phony target.
+
+const dumpModulePropertiesEnv = "SOONG_DUMP_MODULE_PROPERTIES"
+
+func init() {
+	RegisterSingletonType("module_properties_dump", ModulePropertiesDumpSingleton)
+}
+
+var tracedModulesKey = NewOnceKey("tracedModules")
+
+// tracedModules returns the names of the modules whose property sources are recorded.
+func tracedModules(config Config) []string {
+	return config.Once(tracedModulesKey, func() interface{} {
+		var names []string
+		for _, name := range strings.Split(config.Getenv(dumpModulePropertiesEnv), ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+		return names
+	}).([]string)
+}
+
+// tracePropertyChanges calls apply, which merges the properties from source into the properties
+// of the module, and records source as the source of every property whose value apply changed.
+// If the module is not traced it only calls apply.
+func (m *ModuleBase) tracePropertyChanges(ctx BaseModuleContext, source string, apply func()) {
+	if !InList(ctx.ModuleName(), tracedModules(ctx.Config())) {
+		apply()
+		return
+	}
+
+	before := propertyValues(m.generalProperties)
+
+	// Every value that was set before the first merge comes from the module definition.
+	if len(m.commonProperties.PropertySources) == 0 {
+		m.recordPropertySources(before, nil, ctx.BlueprintsFile())
+	}
+
+	apply()
+
+	m.recordPropertySources(propertyValues(m.generalProperties), before, source)
+}
+
+// recordPropertySources records source as the source of every property in after whose value
+// differs from its value in before.
+func (m *ModuleBase) recordPropertySources(after, before map[string]string, source string) {
+	for _, property := range SortedStringKeys(after) {
+		if value, exists := before[property]; !exists || value != after[property] {
+			m.commonProperties.PropertySources = append(m.commonProperties.PropertySources,
+				property+" "+source)
+		}
+	}
+}
+
+// propertySources returns the sources that changed the given property, in the order they were
+// applied.
+func (m *ModuleBase) propertySources(property string) []string {
+	var sources []string
+	for _, entry := range m.commonProperties.PropertySources {
+		if s := strings.SplitN(entry, " ", 2); s[0] == property {
+			sources = append(sources, s[1])
+		}
+	}
+	return sources
+}
+
+// propertyValues returns the formatted values of the properties that are set in the given
+// property structs, keyed by the property name.  Nested properties are separated with a '.'.
+func propertyValues(propertyStructs []interface{}) map[string]string {
+	values := make(map[string]string)
+	for _, propertyStruct := range propertyStructs {
+		addPropertyValues(values, "", reflect.ValueOf(propertyStruct))
+	}
+	return values
+}
+
+func addPropertyValues(values map[string]string, prefix string, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		addPropertyValues(values, prefix, v.Elem())
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" || proptools.HasTag(field, "blueprint", "mutated") {
+				continue
+			}
+			if field.Anonymous || field.Name == "BlueprintEmbed" {
+				addPropertyValues(values, prefix, v.Field(i))
+			} else {
+				addPropertyValues(values, prefix+proptools.PropertyNameForField(field.Name)+".",
+					v.Field(i))
+			}
+		}
+	case reflect.Slice:
+		if v.Len() > 0 {
+			values[strings.TrimSuffix(prefix, ".")] = fmt.Sprintf("%q", v.Interface())
+		}
+	case reflect.String:
+		if v.Len() > 0 {
+			values[strings.TrimSuffix(prefix, ".")] = fmt.Sprintf("%q", v.String())
+		}
+	default:
+		values[strings.TrimSuffix(prefix, ".")] = fmt.Sprintf("%v", v.Interface())
+	}
+}
+
+func ModulePropertiesDumpSingleton() Singleton {
+	return &modulePropertiesDumpSingleton{}
+}
+
+type modulePropertiesDumpSingleton struct{}
+
+func (d *modulePropertiesDumpSingleton) GenerateBuildActions(ctx SingletonContext) {
+	traced := tracedModules(ctx.Config())
+	if len(traced) == 0 {
+		return
+	}
+
+	var dumps Paths
+	ctx.VisitAllModules(func(module Module) {
+		if !InList(ctx.ModuleName(module), traced) {
+			return
+		}
+
+		m := module.base()
+		values := propertyValues(m.generalProperties)
+
+		var buf strings.Builder
+		fmt.Fprintf(&buf, "%s (%s)\n", ctx.ModuleName(module), ctx.BlueprintFile(module))
+		for _, property := range SortedStringKeys(values) {
+			sources := m.propertySources(property)
+			if len(sources) == 0 {
+				// The module was never merged with anything, so the value is its own.
+				sources = []string{ctx.BlueprintFile(module)}
+			}
+			fmt.Fprintf(&buf, "%s: %s\n", property, values[property])
+			for _, source := range sources {
+				fmt.Fprintf(&buf, "    from %s\n", source)
+			}
+		}
+
+		variant := ctx.ModuleSubDir(module)
+		if variant == "" {
+			variant = "default"
+		}
+		dump := PathForOutput(ctx, "module_properties", ctx.ModuleName(module), variant+".txt")
+		WriteFileRule(ctx, dump, buf.String())
+		dumps = append(dumps, dump)
+	})
+
+	ctx.Phony("module_properties_dump", dumps...)
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPropertyTrace(t *testing.T) {
+	bp := `
+		defaults {
+			name: "transitive",
+			foo: ["transitive"],
+		}
+
+		defaults {
+			name: "defaults",
+			defaults: ["transitive"],
+			foo: ["defaults"],
+		}
+
+		test {
+			name: "foo",
+			defaults: ["defaults"],
+			foo: ["module"],
+		}
+
+		test {
+			name: "bar",
+			defaults: ["defaults"],
+		}
+	`
+
+	config := TestConfig(buildDir, map[string]string{dumpModulePropertiesEnv: "foo"}, bp, nil)
+
+	ctx := NewTestContext()
+	ctx.RegisterModuleType("test", defaultsTestModuleFactory)
+	ctx.RegisterModuleType("defaults", defaultsTestDefaultsFactory)
+	ctx.PreArchMutators(RegisterDefaultsPreArchMutators)
+	ctx.RegisterSingletonType("module_properties_dump", ModulePropertiesDumpSingleton)
+	ctx.Register(config)
+
+	_, errs := ctx.ParseFileList(".", []string{"Android.bp"})
+	FailIfErrored(t, errs)
+	_, errs = ctx.PrepareBuildActions(config)
+	FailIfErrored(t, errs)
+
+	foo := ctx.ModuleForTests("foo", "").Module().base()
+	expected := []string{"Android.bp", "defaults defaults", "defaults transitive"}
+	if got := foo.propertySources("foo"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected sources of foo %q, got %q", expected, got)
+	}
+	if got := foo.propertySources("name"); !reflect.DeepEqual(got, []string{"Android.bp"}) {
+		t.Errorf("expected sources of name %q, got %q", []string{"Android.bp"}, got)
+	}
+
+	bar := ctx.ModuleForTests("bar", "").Module().base()
+	if len(bar.commonProperties.PropertySources) > 0 {
+		t.Errorf("expected no sources for untraced module, got %q", bar.commonProperties.PropertySources)
+	}
+
+	dump := ctx.SingletonForTests("module_properties_dump").Output("module_properties/foo/default.txt")
+	data := ContentFromWriteFileRuleForTests(t, dump)
+	expectedDump := `foo: ["transitive" "defaults" "module"]
+    from Android.bp
+    from defaults defaults
+    from defaults transitive
+`
+	if !strings.Contains(data, expectedDump) {
+		t.Errorf("expected %q in property dump, got %q", expectedDump, data)
+	}
+}
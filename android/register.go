@@ -71,10 +71,15 @@ func RegisterModuleType(name string, factory ModuleFactory) {
 	moduleTypes = append(moduleTypes, moduleType{name, factory})
 }
 
+// RegisterSingletonType registers a Singleton that runs after the build actions of all modules
+// have been generated.  Prefer registering through a RegistrationContext so that tests can
+// register the singleton too.
 func RegisterSingletonType(name string, factory SingletonFactory) {
 	singletons = append(singletons, singleton{name, SingletonFactoryAdaptor(factory)})
 }
 
+// RegisterPreSingletonType registers a Singleton that runs before any mutators, and can only
+// compute global state from the configuration and the source tree.
 func RegisterPreSingletonType(name string, factory SingletonFactory) {
 	preSingletons = append(preSingletons, singleton{name, SingletonFactoryAdaptor(factory)})
 }
@@ -0,0 +1,102 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"strings"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/proptools"
+)
+
+// Release signing runs an external, product-configured signer command over the final artifact of
+// a module (an APK, APEX or jar) after it has been built and signed with its build time keys.  The
+// signer is invoked as "<signer> <input> <output> <key names...>" and is expected to write the
+// release signed artifact to <output>.  The first word of the signer command is the signer itself,
+// which is an input of the rule so that the artifacts are signed again when it changes.  When a v4
+// signature is requested for an APK, the signer is also passed V4_SIGNATURE_FILE=<path> in its
+// environment and is expected to write the v4 signature of the release signed APK to <path>.
+
+var releaseSign = pctx.AndroidStaticRule("releaseSign",
+	blueprint.RuleParams{
+		Command: `rm -f $out && $env $signer $in $out $keys`,
+	},
+	"env", "signer", "keys")
+
+type ReleaseSigningProperties struct {
+	Release_signing struct {
+		// If true, pass the final artifact of this module through the release signer command
+		// configured by the product (RELEASE_SIGNER_COMMAND).  Defaults to false.
+		Enabled *bool
+
+		// Names of the keys to pass to the release signer command.  Required if enabled is true.
+		Keys []string
+	}
+}
+
+// ReleaseSigningEnabled returns true if the module has opted in to release signing and the product
+// has configured a release signer command.
+func ReleaseSigningEnabled(ctx BaseModuleContext, p *ReleaseSigningProperties) bool {
+	return proptools.Bool(p.Release_signing.Enabled) && ctx.Config().ReleaseSignerCommand() != ""
+}
+
+// ReleaseSign creates a rule that passes unsigned through the release signer command and returns
+// the path to the release signed output.  If release signing is not enabled for the module it
+// returns unsigned unchanged.
+func ReleaseSign(ctx ModuleContext, p *ReleaseSigningProperties, unsigned Path) Path {
+	return ReleaseSignWithV4Signature(ctx, p, unsigned, nil)
+}
+
+// ReleaseSignWithV4Signature is like ReleaseSign, but if v4SignatureFile is not nil the release
+// signer also writes the v4 signature of the release signed APK to it.
+func ReleaseSignWithV4Signature(ctx ModuleContext, p *ReleaseSigningProperties, unsigned Path,
+	v4SignatureFile WritablePath) Path {
+
+	if !ReleaseSigningEnabled(ctx, p) {
+		return unsigned
+	}
+
+	if len(p.Release_signing.Keys) == 0 {
+		ctx.PropertyErrorf("release_signing.keys", "must be set when release_signing.enabled is true")
+		return unsigned
+	}
+
+	command := ctx.Config().ReleaseSignerCommand()
+	signer := PathForSourceRelaxed(ctx, strings.Fields(command)[0])
+
+	var env string
+	var implicitOutputs WritablePaths
+	if v4SignatureFile != nil {
+		env = "V4_SIGNATURE_FILE=" + v4SignatureFile.String()
+		implicitOutputs = append(implicitOutputs, v4SignatureFile)
+	}
+
+	signed := PathForModuleOut(ctx, "release_signed", unsigned.Base())
+	ctx.Build(pctx, BuildParams{
+		Rule:            releaseSign,
+		Description:     ActionDescription("release sign", signed),
+		Input:           unsigned,
+		Implicit:        signer,
+		Output:          signed,
+		ImplicitOutputs: implicitOutputs,
+		Args: map[string]string{
+			"env":    env,
+			"signer": command,
+			"keys":   strings.Join(proptools.NinjaAndShellEscapeList(p.Release_signing.Keys), " "),
+		},
+	})
+
+	return signed
+}
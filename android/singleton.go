@@ -18,7 +18,9 @@ import (
 	"github.com/google/blueprint"
 )
 
-// SingletonContext
+// SingletonContext is the context passed to Singleton.GenerateBuildActions.  It gives access to all
+// modules in the build, after their build actions have been generated, and allows creating build
+// actions that are not owned by any module.
 type SingletonContext interface {
 	Config() Config
 	DeviceConfig() DeviceConfig
@@ -110,6 +112,14 @@ func (s *singletonAdaptor) RuleParamsForTests() map[blueprint.Rule]blueprint.Rul
 	return s.ruleParams
 }
 
+// A Singleton generates build-wide outputs that depend on data from all modules, for example the
+// merged event log tags, the hidden API flags of the boot jars or lists of installed files.  Each
+// registered singleton is instantiated once per build, and its GenerateBuildActions method is
+// called after the build actions of all modules have been generated, so it can visit the modules
+// with SingletonContext.VisitAllModules and read the paths that they export through interfaces.
+//
+// A singleton that also implements SingletonMakeVarsProvider can export the paths of its outputs
+// to Make.
 type Singleton interface {
 	GenerateBuildActions(SingletonContext)
 }
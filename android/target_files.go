@@ -0,0 +1,248 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/proptools"
+)
+
+// The target_files singleton assembles the files installed by Soong modules into the layout of a
+// target-files package (SYSTEM/, VENDOR/, PRODUCT/, ...), so that OTA generation can consume the
+// Soong install graph directly.  The resulting zip only contains what Soong knows about; the META/
+// and IMAGES/ directories are added by Make when it merges this zip into the final target-files
+// package, which it finds through the SOONG_TARGET_FILES_ZIP variable.  The packages are built from
+// the built files of the modules, as device modules are installed by Make when Soong is embedded in
+// it.  The modules that the product installs can also add files that they don't install, for
+// example the kernel and the ramdisk of the boot image, by implementing TargetFilesEntriesProvider.
+
+func init() {
+	RegisterSingletonType("target_files", TargetFilesSingleton)
+
+	pctx.HostBinToolVariable("soong_zip", "soong_zip")
+}
+
+var (
+	// targetFilesPartitionZip runs a script that copies the files of a partition into a staging
+	// directory, and zips the staging directory.  The script has a shell escaped command for each
+	// file, and is written to a file as the list of files of a partition can exceed the maximum
+	// length of a command line.
+	targetFilesPartitionZip = pctx.AndroidStaticRule("targetFilesPartitionZip",
+		blueprint.RuleParams{
+			Command: `rm -rf $stagingDir && mkdir -p $stagingDir && ` +
+				`/bin/bash -e $in && ` +
+				`${soong_zip} -d -o $out -P $zipDir -C $stagingDir -D $stagingDir && ` +
+				`rm -rf $stagingDir`,
+			CommandDeps: []string{"${soong_zip}"},
+		}, "stagingDir", "zipDir")
+)
+
+// targetFilesPartitions maps the install directory of a partition, relative to
+// $OUT/target/product/<device>, to the directory it occupies in a target-files package.  The list
+// is ordered so that longer prefixes are matched first.
+var targetFilesPartitions = []struct {
+	installDir string
+	zipDir     string
+}{
+	{"recovery/root", "RECOVERY/RAMDISK"},
+	{"ramdisk", "BOOT/RAMDISK"},
+	{"system_ext", "SYSTEM_EXT"},
+	{"system", "SYSTEM"},
+	{"product", "PRODUCT"},
+	{"vendor", "VENDOR"},
+	{"odm", "ODM"},
+	{"data", "DATA"},
+	{"root", "ROOT"},
+}
+
+// TargetFilesEntry is a file that a module adds to the target-files package.
+type TargetFilesEntry struct {
+	// Path of the file in the target-files package, for example "BOOT/kernel".
+	Path string
+
+	// The built file, or nil if the entry is a symlink.
+	Src Path
+
+	// The target of the symlink if the entry is a symlink.
+	SymlinkTarget string
+}
+
+// TargetFilesEntriesProvider is implemented by modules that build files for the target-files
+// package that they don't install on the device.
+type TargetFilesEntriesProvider interface {
+	TargetFilesEntries() []TargetFilesEntry
+}
+
+// targetFilesZipDir returns the directory of the target-files package that the given path in the
+// package belongs to, and the path relative to the directory.
+func targetFilesZipDir(path string) (string, string) {
+	for _, p := range targetFilesPartitions {
+		if strings.HasPrefix(path, p.zipDir+"/") {
+			return p.zipDir, strings.TrimPrefix(path, p.zipDir+"/")
+		}
+	}
+	if i := strings.Index(path, "/"); i > 0 {
+		return path[:i], path[i+1:]
+	}
+	return "", path
+}
+
+func TargetFilesSingleton() Singleton {
+	return &targetFilesSingleton{}
+}
+
+type targetFilesSingleton struct {
+	targetFilesZip Path
+}
+
+// targetFilesPartition holds the files that belong to a single partition of the target-files
+// package, indexed by their path in the partition.
+type targetFilesPartition struct {
+	zipDir string
+	files  map[string]PackagingSpec
+}
+
+func (t *targetFilesSingleton) GenerateBuildActions(ctx SingletonContext) {
+	if ctx.Config().productVariables.DeviceName == nil {
+		return
+	}
+
+	partitions := make(map[string]*targetFilesPartition)
+	partition := func(zipDir string) *targetFilesPartition {
+		partition := partitions[zipDir]
+		if partition == nil {
+			partition = &targetFilesPartition{zipDir: zipDir, files: make(map[string]PackagingSpec)}
+			partitions[zipDir] = partition
+		}
+		return partition
+	}
+
+	ctx.VisitAllModules(func(module Module) {
+		if !module.Enabled() {
+			return
+		}
+		for _, spec := range module.PackagingSpecs() {
+			devicePath, ok := spec.DevicePath()
+			if !ok {
+				// Host and debug installs are not part of the target-files package.
+				continue
+			}
+			rel := strings.TrimPrefix(devicePath, "/")
+			for _, p := range targetFilesPartitions {
+				if !strings.HasPrefix(rel, p.installDir+"/") {
+					continue
+				}
+				partition(p.zipDir).files[strings.TrimPrefix(rel, p.installDir+"/")] = spec
+				break
+			}
+		}
+	})
+
+	for _, module := range productInstalledModules(ctx) {
+		provider, ok := module.(TargetFilesEntriesProvider)
+		if !ok {
+			continue
+		}
+		for _, entry := range provider.TargetFilesEntries() {
+			zipDir, dest := targetFilesZipDir(entry.Path)
+			if zipDir == "" || dest == "" {
+				ctx.ModuleErrorf(module, "invalid path %q in the target-files package", entry.Path)
+				continue
+			}
+			p := partition(zipDir)
+			if _, exists := p.files[dest]; exists {
+				ctx.ModuleErrorf(module, "%q is already in the target-files package", entry.Path)
+				continue
+			}
+			p.files[dest] = PackagingSpec{srcPath: entry.Src, symlinkTarget: entry.SymlinkTarget}
+		}
+	}
+
+	if len(partitions) == 0 {
+		return
+	}
+
+	var zipDirs []string
+	for zipDir := range partitions {
+		zipDirs = append(zipDirs, zipDir)
+	}
+	sort.Strings(zipDirs)
+
+	var partitionZips Paths
+	for _, zipDir := range zipDirs {
+		partition := partitions[zipDir]
+
+		name := strings.ToLower(strings.Replace(zipDir, "/", "_", -1))
+		stagingDir := PathForOutput(ctx, "target_files", name)
+
+		var script strings.Builder
+		var srcs Paths
+		for _, dest := range SortedStringKeys(partition.files) {
+			spec := partition.files[dest]
+			destPath := filepath.Join(stagingDir.String(), dest)
+			fmt.Fprintf(&script, "mkdir -p %s\n", proptools.ShellEscape(filepath.Dir(destPath)))
+			if spec.SymlinkTarget() != "" {
+				fmt.Fprintf(&script, "ln -sfn %s %s\n",
+					proptools.ShellEscape(spec.SymlinkTarget()), proptools.ShellEscape(destPath))
+			} else {
+				fmt.Fprintf(&script, "cp -f %s %s\n",
+					proptools.ShellEscape(spec.SrcPath().String()), proptools.ShellEscape(destPath))
+				srcs = append(srcs, spec.SrcPath())
+			}
+		}
+
+		copyScript := PathForOutput(ctx, "target_files", name+".sh")
+		WriteFileRule(ctx, copyScript, script.String())
+
+		partitionZip := PathForOutput(ctx, "target_files", name+".zip")
+
+		ctx.Build(pctx, BuildParams{
+			Rule:        targetFilesPartitionZip,
+			Description: "target files " + zipDir,
+			Input:       copyScript,
+			Output:      partitionZip,
+			Implicits:   FirstUniquePaths(srcs),
+			Args: map[string]string{
+				"stagingDir": stagingDir.String(),
+				"zipDir":     zipDir,
+			},
+		})
+
+		partitionZips = append(partitionZips, partitionZip)
+	}
+
+	targetFilesZip := PathForOutput(ctx, "target_files", ctx.Config().DeviceName()+"-target_files.zip")
+
+	rule := NewRuleBuilder()
+	rule.Command().
+		BuiltTool(ctx, "merge_zips").
+		Output(targetFilesZip).
+		Inputs(partitionZips)
+	rule.Build(pctx, ctx, "target_files", "merge target files")
+
+	ctx.Phony("soong_target_files", targetFilesZip)
+	t.targetFilesZip = targetFilesZip
+}
+
+func (t *targetFilesSingleton) MakeVars(ctx MakeVarsContext) {
+	if t.targetFilesZip != nil {
+		ctx.Strict("SOONG_TARGET_FILES_ZIP", t.targetFilesZip.String())
+	}
+}
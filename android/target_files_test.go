@@ -0,0 +1,148 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type targetFilesTestModule struct {
+	ModuleBase
+}
+
+func (m *targetFilesTestModule) GenerateAndroidBuildActions(ctx ModuleContext) {
+	ctx.InstallFile(PathForModuleInstall(ctx, "etc"), ctx.ModuleName(), PathForModuleSrc(ctx, "a.txt"))
+}
+
+func targetFilesTestModuleFactory() Module {
+	module := &targetFilesTestModule{}
+	InitAndroidArchModule(module, DeviceSupported, MultilibCommon)
+	return module
+}
+
+type targetFilesEntriesTestModule struct {
+	ModuleBase
+	output Path
+}
+
+func (m *targetFilesEntriesTestModule) GenerateAndroidBuildActions(ctx ModuleContext) {
+	m.output = PathForModuleSrc(ctx, "a.txt")
+}
+
+func (m *targetFilesEntriesTestModule) TargetFilesEntries() []TargetFilesEntry {
+	return []TargetFilesEntry{
+		{Path: "BOOT/" + m.Name(), Src: m.output},
+		{Path: "BOOT/RAMDISK/" + m.Name(), SymlinkTarget: "/system/bin/" + m.Name()},
+		{Path: "BOOT/RAMDISK/" + m.Name() + " link", SymlinkTarget: "it's"},
+	}
+}
+
+func targetFilesEntriesTestModuleFactory() Module {
+	module := &targetFilesEntriesTestModule{}
+	InitAndroidArchModule(module, DeviceSupported, MultilibCommon)
+	return module
+}
+
+func TestTargetFiles(t *testing.T) {
+	// Make installs the files of device modules when Soong is embedded in it, the target-files
+	// package is built from the built files in both cases.
+	t.Run("soong", func(t *testing.T) { testTargetFiles(t, false) })
+	t.Run("embedded in make", func(t *testing.T) { testTargetFiles(t, true) })
+}
+
+func testTargetFiles(t *testing.T, inMake bool) {
+	bp := `
+		test {
+			name: "foo",
+		}
+
+		test {
+			name: "bar",
+			vendor: true,
+		}
+
+		test {
+			name: "baz",
+			product_specific: true,
+		}
+
+		test_entries {
+			name: "kernel",
+		}
+
+		test_entries {
+			name: "not_installed",
+		}
+	`
+
+	config := TestArchConfig(buildDir, nil, bp, map[string][]byte{"a.txt": nil})
+	config.inMake = inMake
+	config.productVariables.Product_packages = []string{"kernel"}
+
+	ctx := NewTestArchContext()
+	ctx.RegisterModuleType("test", targetFilesTestModuleFactory)
+	ctx.RegisterModuleType("test_entries", targetFilesEntriesTestModuleFactory)
+	ctx.RegisterSingletonType("target_files", TargetFilesSingleton)
+	ctx.Register(config)
+
+	_, errs := ctx.ParseFileList(".", []string{"Android.bp"})
+	FailIfErrored(t, errs)
+	_, errs = ctx.PrepareBuildActions(config)
+	FailIfErrored(t, errs)
+
+	singleton := ctx.SingletonForTests("target_files")
+
+	checkPartition := func(name, zipDir, expectedScript string, expectedImplicits []string) {
+		t.Helper()
+		zip := "target_files/" + name + ".zip"
+		rule := singleton.Output(zip)
+		if rule.Args["zipDir"] != zipDir {
+			t.Errorf("expected %q to be placed under %q, got %q", zip, zipDir, rule.Args["zipDir"])
+		}
+		expectedScript = strings.Replace(expectedScript, "$staging", buildDir+"/target_files/"+name, -1)
+		script := ContentFromWriteFileRuleForTests(t, singleton.Output("target_files/"+name+".sh"))
+		if script != expectedScript {
+			t.Errorf("expected %q copy script:\n%s\ngot:\n%s", zip, expectedScript, script)
+		}
+		if !reflect.DeepEqual(rule.Implicits.Strings(), expectedImplicits) {
+			t.Errorf("expected %q to depend on the built files %q, got %q", zip, expectedImplicits, rule.Implicits.Strings())
+		}
+	}
+
+	checkPartition("system", "SYSTEM", "mkdir -p $staging/etc\ncp -f a.txt $staging/etc/foo\n", []string{"a.txt"})
+	checkPartition("vendor", "VENDOR", "mkdir -p $staging/etc\ncp -f a.txt $staging/etc/bar\n", []string{"a.txt"})
+	checkPartition("product", "PRODUCT", "mkdir -p $staging/etc\ncp -f a.txt $staging/etc/baz\n", []string{"a.txt"})
+
+	// The entries of the modules that the product installs are added to the package
+	checkPartition("boot", "BOOT", "mkdir -p $staging\ncp -f a.txt $staging/kernel\n", []string{"a.txt"})
+	checkPartition("boot_ramdisk", "BOOT/RAMDISK", "mkdir -p $staging\n"+
+		"ln -sfn /system/bin/kernel $staging/kernel\n"+
+		"mkdir -p $staging\n"+
+		`ln -sfn 'it'\''s' '$staging/kernel link'`+"\n", nil)
+
+	merge := singleton.Output("target_files/test_device-target_files.zip")
+	expected := []string{
+		buildDir + "/target_files/boot.zip",
+		buildDir + "/target_files/boot_ramdisk.zip",
+		buildDir + "/target_files/product.zip",
+		buildDir + "/target_files/system.zip",
+		buildDir + "/target_files/vendor.zip",
+	}
+	if !reflect.DeepEqual(merge.Implicits.Strings(), expected) {
+		t.Errorf("expected merged inputs %q, got %q", expected, merge.Implicits.Strings())
+	}
+}
@@ -468,3 +468,19 @@ func NormalizePathsForTesting(paths Paths) []string {
 	}
 	return result
 }
+
+// ContentFromWriteFileRuleForTests returns the content written by a rule created by WriteFileRule
+// whose content fit in a single shard.
+func ContentFromWriteFileRuleForTests(t *testing.T, params TestingBuildParams) string {
+	t.Helper()
+	if params.Rule != writeFileVerbatim {
+		t.Errorf("expected %s to be written by WriteFileRule, was written by %q", params.Output, params.Rule)
+		return ""
+	}
+	content := strings.ReplaceAll(params.Args["content"], "$$", "$")
+	if len(content) >= 2 && content[0] == '\'' && content[len(content)-1] == '\'' {
+		content = content[1 : len(content)-1]
+	}
+	content = strings.ReplaceAll(content, `'\''`, `'`)
+	return writeFileUnescaper.Replace(content)
+}
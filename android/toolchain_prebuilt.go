@@ -0,0 +1,177 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/blueprint"
+)
+
+func init() {
+	RegisterModuleType("toolchain_prebuilt", ToolchainPrebuiltFactory)
+}
+
+var verifyToolchainChecksums = pctx.AndroidStaticRule("verifyToolchainChecksums",
+	blueprint.RuleParams{
+		Command: `if ! (cd $dir && sha256sum --quiet --strict -c $checksums); then ` +
+			`echo "toolchain_prebuilt $name: the files don't match $dir/$checksums, the prebuilt is ` +
+			`corrupted or was updated without updating the checksums" >&2; exit 1; fi && ` +
+			`touch $out`,
+		Description: "verify toolchain $name",
+	},
+	"dir", "checksums", "name")
+
+type toolchainPrebuiltProperties struct {
+	// file listing the SHA-256 checksums of the files of the toolchain in the format written by
+	// sha256sum, with paths relative to the directory of the file.
+	Checksums *string `android:"path"`
+}
+
+type toolchainPrebuilt struct {
+	ModuleBase
+
+	properties toolchainPrebuiltProperties
+
+	files Paths
+
+	// Touched by the rule that verifies the checksums once they match.
+	stamp WritablePath
+}
+
+// VerifiedToolchain is implemented by the modules that verify the checksums of a toolchain.  The
+// modules that use the toolchain add an order-only dependency on the stamp to their actions, so
+// that the toolchain is verified before any of them runs.
+type VerifiedToolchain interface {
+	ToolchainVerifiedStamp() Path
+}
+
+// toolchain_prebuilt declares the checksums of a checked in toolchain, such as the JDK or the dx,
+// aapt and signapk prebuilts, for example, in prebuilts/jdk/jdk11/linux-x86/Android.bp:
+//
+//   toolchain_prebuilt {
+//       name: "jdk-toolchain",
+//       checksums: "SHA256SUMS",
+//   }
+//
+// with SHA256SUMS created by running sha256sum on the files of the toolchain.  The checksums are
+// verified by a build action that reruns whenever one of the files changes, and that the actions of
+// the modules using the toolchain are ordered after, so a corrupted prebuilt or a toolchain update
+// that did not update the checksums is reported as an error of the toolchain_prebuilt module,
+// instead of as a failure of whichever action happens to use the affected file.
+func ToolchainPrebuiltFactory() Module {
+	module := &toolchainPrebuilt{}
+	module.AddProperties(&module.properties)
+	InitAndroidModule(module)
+	return module
+}
+
+type toolchainChecksum struct {
+	sum  string
+	path string
+}
+
+// parseToolchainChecksums parses checksums in the format written by sha256sum.
+func parseToolchainChecksums(r io.Reader) ([]toolchainChecksum, error) {
+	var checksums []toolchainChecksum
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.SplitN(text, " ", 2)
+		if len(fields) != 2 || len(fields[0]) != 2*sha256.Size {
+			return nil, fmt.Errorf("line %d: expected a SHA-256 checksum followed by a path", line)
+		}
+		// sha256sum prefixes the path with '*' in binary mode.
+		path := strings.TrimPrefix(strings.TrimSpace(fields[1]), "*")
+		checksums = append(checksums, toolchainChecksum{sum: strings.ToLower(fields[0]), path: path})
+	}
+	return checksums, scanner.Err()
+}
+
+func (t *toolchainPrebuilt) GenerateAndroidBuildActions(ctx ModuleContext) {
+	if t.properties.Checksums == nil {
+		ctx.PropertyErrorf("checksums", "missing checksums file")
+		return
+	}
+	checksumsFile := PathForModuleSrc(ctx, *t.properties.Checksums)
+	if ctx.Failed() {
+		return
+	}
+
+	// Only the list of files is read here, the files are hashed by the build action.
+	ctx.AddNinjaFileDeps(checksumsFile.String())
+	r, err := ctx.Config().fs.Open(checksumsFile.String())
+	if err != nil {
+		ctx.PropertyErrorf("checksums", "failed to open %s: %s", checksumsFile, err)
+		return
+	}
+	checksums, err := parseToolchainChecksums(r)
+	r.Close()
+	if err != nil {
+		ctx.PropertyErrorf("checksums", "%s: %s", checksumsFile, err)
+		return
+	}
+
+	dir := filepath.Dir(checksumsFile.String())
+	for _, checksum := range checksums {
+		file := ExistentPathForSource(ctx, dir, checksum.path)
+		if !file.Valid() {
+			ctx.ModuleErrorf("%s listed in %s does not exist", filepath.Join(dir, checksum.path),
+				checksumsFile)
+			continue
+		}
+		t.files = append(t.files, file.Path())
+	}
+	if ctx.Failed() {
+		return
+	}
+
+	t.stamp = PathForModuleOut(ctx, "verified.stamp")
+	ctx.Build(pctx, BuildParams{
+		Rule:      verifyToolchainChecksums,
+		Input:     checksumsFile,
+		Implicits: t.files,
+		Output:    t.stamp,
+		Args: map[string]string{
+			"dir":       dir,
+			"checksums": checksumsFile.Base(),
+			"name":      ctx.ModuleName(),
+		},
+	})
+}
+
+// ToolchainVerifiedStamp returns the file that is touched once the checksums of the toolchain
+// have been verified.
+func (t *toolchainPrebuilt) ToolchainVerifiedStamp() Path {
+	return t.stamp
+}
+
+// OutputFiles returns the files of the toolchain.
+func (t *toolchainPrebuilt) OutputFiles(tag string) (Paths, error) {
+	switch tag {
+	case "":
+		return t.files, nil
+	default:
+		return nil, fmt.Errorf("unsupported module reference tag %q", tag)
+	}
+}
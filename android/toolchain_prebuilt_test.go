@@ -0,0 +1,108 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestToolchainPrebuilt(t *testing.T) {
+	testCases := []struct {
+		name          string
+		checksums     string
+		expectedFiles []string
+		expectedErrs  []string
+	}{
+		{
+			name:          "checksums",
+			checksums:     sha256Hex("javac\n") + "  bin/javac\n" + sha256Hex("java\n") + " *bin/java\n",
+			expectedFiles: []string{"jdk/bin/javac", "jdk/bin/java"},
+		},
+		{
+			name:      "missing file",
+			checksums: sha256Hex("jar\n") + "  bin/jar\n",
+			expectedErrs: []string{
+				`jdk/bin/jar listed in jdk/SHA256SUMS does not exist`,
+			},
+		},
+		{
+			name:      "malformed checksums",
+			checksums: "1234 bin/javac\n",
+			expectedErrs: []string{
+				`jdk/SHA256SUMS: line 1: expected a SHA-256 checksum followed by a path`,
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			bp := `
+				toolchain_prebuilt {
+					name: "jdk",
+					checksums: "SHA256SUMS",
+				}
+			`
+			fs := map[string][]byte{
+				"jdk/Android.bp": []byte(bp),
+				"jdk/SHA256SUMS": []byte(test.checksums),
+				"jdk/bin/javac":  []byte("javac\n"),
+				"jdk/bin/java":   []byte("java\n"),
+			}
+
+			config := TestConfig(buildDir, nil, "", fs)
+			ctx := NewTestContext()
+			ctx.RegisterModuleType("toolchain_prebuilt", ToolchainPrebuiltFactory)
+			ctx.Register(config)
+
+			_, errs := ctx.ParseBlueprintsFiles("jdk/Android.bp")
+			FailIfErrored(t, errs)
+			_, errs = ctx.PrepareBuildActions(config)
+			if len(test.expectedErrs) > 0 {
+				CheckErrorsAgainstExpectations(t, errs, test.expectedErrs)
+				return
+			}
+			FailIfErrored(t, errs)
+
+			m := ctx.ModuleForTests("jdk", "")
+			module := m.Module().(*toolchainPrebuilt)
+			if g, w := module.files.Strings(), test.expectedFiles; !reflect.DeepEqual(g, w) {
+				t.Errorf("expected toolchain files %q, got %q", w, g)
+			}
+
+			// The checksums are verified by a build action that depends on all the files.
+			verify := m.Output("verified.stamp")
+			if g, w := verify.Input.String(), "jdk/SHA256SUMS"; g != w {
+				t.Errorf("expected checksums %q, got %q", w, g)
+			}
+			if g, w := verify.Implicits.Strings(), test.expectedFiles; !reflect.DeepEqual(g, w) {
+				t.Errorf("expected verified files %q, got %q", w, g)
+			}
+			if g, w := verify.Args["dir"], "jdk"; g != w {
+				t.Errorf("expected checksums to be verified in %q, got %q", w, g)
+			}
+			if g, w := module.ToolchainVerifiedStamp().String(), verify.Output.String(); g != w {
+				t.Errorf("expected stamp %q, got %q", w, g)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+// An unbundled apps build (TARGET_BUILD_APPS) only builds the listed apps against prebuilt SDKs, so
+// the device modules of the platform are not needed.  They are disabled before any build actions
+// are generated so that they are not analyzed at all.  A device module is kept if it is one of the
+// apps or if a kept module depends on it.  Host modules are always kept, as they may be tools used
+// by the apps.
+
+func RegisterUnbundledBuildMutator(ctx RegisterMutatorsContext) {
+	// Not parallel, the mutator marks the dependencies of a module, which may be shared by other
+	// modules that are visited at the same time.
+	ctx.TopDown("unbundled_build_apps", unbundledBuildAppsMutator)
+}
+
+func unbundledBuildAppsMutator(ctx TopDownMutatorContext) {
+	apps := ctx.Config().UnbundledBuildApps()
+	if len(apps) == 0 {
+		return
+	}
+
+	m := ctx.Module().base()
+	// Modules are visited after all the modules that depend on them, so they are already marked if
+	// they are needed.
+	if !m.neededByUnbundledBuild && m.Device() && !InList(ctx.ModuleName(), apps) {
+		m.Disable()
+		return
+	}
+
+	ctx.VisitDirectDeps(func(dep Module) {
+		dep.base().neededByUnbundledBuild = true
+	})
+}
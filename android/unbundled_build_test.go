@@ -0,0 +1,105 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"testing"
+)
+
+type unbundledBuildTestModule struct {
+	ModuleBase
+	properties struct {
+		Deps []string
+	}
+}
+
+func newUnbundledBuildTestModule() Module {
+	m := &unbundledBuildTestModule{}
+	m.AddProperties(&m.properties)
+	InitAndroidArchModule(m, HostAndDeviceSupported, MultilibCommon)
+	return m
+}
+
+func (m *unbundledBuildTestModule) DepsMutator(ctx BottomUpMutatorContext) {
+	ctx.AddDependency(ctx.Module(), nil, m.properties.Deps...)
+}
+
+func (m *unbundledBuildTestModule) GenerateAndroidBuildActions(ModuleContext) {}
+
+func TestUnbundledBuildApps(t *testing.T) {
+	bp := `
+		test_module {
+			name: "app",
+			deps: ["lib"],
+		}
+
+		test_module {
+			name: "lib",
+		}
+
+		test_module {
+			name: "platform",
+			deps: ["lib"],
+		}
+
+		test_module {
+			name: "tool",
+			host_supported: true,
+			deps: ["tool_lib"],
+		}
+
+		test_module {
+			name: "tool_lib",
+			host_supported: true,
+		}
+	`
+
+	for _, apps := range [][]string{nil, {"app"}} {
+		config := TestArchConfig(buildDir, nil, bp, nil)
+		config.TestProductVariables.Unbundled_build = boolPtr(true)
+		config.TestProductVariables.Unbundled_build_apps = apps
+
+		ctx := NewTestArchContext()
+		ctx.RegisterModuleType("test_module", newUnbundledBuildTestModule)
+		ctx.PostDepsMutators(RegisterUnbundledBuildMutator)
+		ctx.Register(config)
+
+		_, errs := ctx.ParseBlueprintsFiles("Android.bp")
+		FailIfErrored(t, errs)
+		_, errs = ctx.PrepareBuildActions(config)
+		FailIfErrored(t, errs)
+
+		hostCommon := BuildOs.String() + "_common"
+		modules := []struct {
+			name, variant string
+			platform      bool
+		}{
+			{"app", "android_common", false},
+			{"lib", "android_common", false},
+			{"platform", "android_common", true},
+			{"tool", "android_common", true},
+			{"tool", hostCommon, false},
+			{"tool_lib", "android_common", true},
+			{"tool_lib", hostCommon, false},
+		}
+		for _, m := range modules {
+			enabled := ctx.ModuleForTests(m.name, m.variant).Module().Enabled()
+			if expected := apps == nil || !m.platform; enabled != expected {
+				t.Errorf("apps %q: expected %s %s enabled to be %v, got %v", apps, m.name, m.variant,
+					expected, enabled)
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"sort"
+	"strings"
+)
+
+// The unused_modules singleton reports the modules that are defined in the tree but that are not
+// reachable through dependencies from the modules that the current product installs, which are the
+// modules in PRODUCT_PACKAGES and the modules they require.  Modules that are only referenced from
+// Make or looked up by name in singletons are reported as well, so the report is a list of
+// candidates to investigate rather than a list of modules that can be deleted blindly.
+
+func init() {
+	RegisterSingletonType("unused_modules", UnusedModulesSingleton)
+}
+
+func UnusedModulesSingleton() Singleton {
+	return &unusedModulesSingleton{}
+}
+
+type unusedModulesSingleton struct{}
+
+func (u *unusedModulesSingleton) GenerateBuildActions(ctx SingletonContext) {
+	// A module is used if any of its variants is reachable, so track modules by name.
+	used := make(map[string]bool)
+	blueprintFiles := make(map[string]string)
+
+	ctx.VisitAllModules(func(module Module) {
+		if d, ok := module.(Defaults); ok && d.isDefaults() {
+			return
+		}
+		name := ctx.ModuleName(module)
+		if _, exists := blueprintFiles[name]; !exists {
+			blueprintFiles[name] = ctx.BlueprintFile(module)
+		}
+	})
+
+	queue := productInstalledModules(ctx)
+	visited := make(map[Module]bool)
+	for _, module := range queue {
+		visited[module] = true
+	}
+
+	for len(queue) > 0 {
+		module := queue[0]
+		queue = queue[1:]
+		used[ctx.ModuleName(module)] = true
+		ctx.VisitDirectDeps(module, func(dep Module) {
+			if !visited[dep] {
+				visited[dep] = true
+				queue = append(queue, dep)
+			}
+		})
+	}
+
+	var unused []string
+	for name, blueprintFile := range blueprintFiles {
+		if !used[name] {
+			unused = append(unused, name+" "+blueprintFile)
+		}
+	}
+	sort.Strings(unused)
+
+	report := PathForOutput(ctx, "unused_modules.txt")
+	WriteFileRule(ctx, report, strings.Join(unused, "\n")+"\n")
+
+	ctx.Phony("unused_modules_report", report)
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type unusedModulesTestModule struct {
+	ModuleBase
+	properties struct {
+		Deps      []string
+		Installed bool
+	}
+}
+
+func (m *unusedModulesTestModule) DepsMutator(ctx BottomUpMutatorContext) {
+	ctx.AddDependency(ctx.Module(), nil, m.properties.Deps...)
+}
+
+func (m *unusedModulesTestModule) GenerateAndroidBuildActions(ctx ModuleContext) {
+	if m.properties.Installed {
+		ctx.InstallFile(PathForModuleInstall(ctx, "bin"), ctx.ModuleName(), PathForModuleSrc(ctx, "a.txt"))
+	}
+}
+
+func unusedModulesTestModuleFactory() Module {
+	module := &unusedModulesTestModule{}
+	module.AddProperties(&module.properties)
+	InitAndroidModule(module)
+	return module
+}
+
+func TestUnusedModules(t *testing.T) {
+	t.Run("soong", func(t *testing.T) {
+		testUnusedModules(t, false)
+	})
+	t.Run("embedded in make", func(t *testing.T) {
+		testUnusedModules(t, true)
+	})
+}
+
+func testUnusedModules(t *testing.T, inMake bool) {
+	bp := `
+		test {
+			name: "installed",
+			installed: true,
+			deps: ["direct"],
+		}
+
+		test {
+			name: "direct",
+			deps: ["transitive"],
+		}
+
+		test {
+			name: "transitive",
+		}
+
+		test {
+			name: "unused",
+			installed: true,
+			deps: ["unused_dep"],
+		}
+
+		test {
+			name: "unused_dep",
+		}
+	`
+
+	config := TestConfig(buildDir, nil, bp, map[string][]byte{"a.txt": nil})
+	config.TestProductVariables.Product_packages = []string{"installed"}
+	config.inMake = inMake
+
+	ctx := NewTestContext()
+	ctx.RegisterModuleType("test", unusedModulesTestModuleFactory)
+	ctx.RegisterSingletonType("unused_modules", UnusedModulesSingleton)
+	ctx.Register(config)
+
+	_, errs := ctx.ParseFileList(".", []string{"Android.bp"})
+	FailIfErrored(t, errs)
+	_, errs = ctx.PrepareBuildActions(config)
+	FailIfErrored(t, errs)
+
+	report := ctx.SingletonForTests("unused_modules").Output("unused_modules.txt")
+	content := ContentFromWriteFileRuleForTests(t, report)
+
+	expected := []string{"unused Android.bp", "unused_dep Android.bp"}
+	if got := strings.Split(strings.TrimSpace(content), "\n"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected unused modules %q, got %q", expected, got)
+	}
+}
@@ -24,9 +24,16 @@ import (
 )
 
 func init() {
-	PreDepsMutators(func(ctx RegisterMutatorsContext) {
-		ctx.BottomUp("variable", VariableMutator).Parallel()
-	})
+	PreDepsMutators(registerVariableMutators)
+}
+
+// registerVariableMutators registers the mutator that applies the product variables, followed by the
+// mutator that applies the product's module overrides, so that the overrides replace the values set
+// by product variables.  The overrides still run before dependencies are added, as properties like
+// certificate can add dependencies.
+func registerVariableMutators(ctx RegisterMutatorsContext) {
+	ctx.BottomUp("variable", VariableMutator).Parallel()
+	RegisterModuleOverridesMutator(ctx)
 }
 
 type variableProperties struct {
@@ -203,6 +210,10 @@ type productVariables struct {
 
 	AppsDefaultVersionName *string `json:",omitempty"`
 
+	Unbundled_build_apps []string `json:",omitempty"`
+
+	Release_signer_command *string `json:",omitempty"`
+
 	Allow_missing_dependencies       *bool `json:",omitempty"`
 	Unbundled_build                  *bool `json:",omitempty"`
 	Unbundled_build_sdks_from_source *bool `json:",omitempty"`
@@ -233,6 +244,8 @@ type productVariables struct {
 	BootJars          []string `json:",omitempty"`
 	UpdatableBootJars []string `json:",omitempty"`
 
+	BootJarsPackageAllowList []string `json:",omitempty"`
+
 	IntegerOverflowExcludePaths []string `json:",omitempty"`
 
 	EnableCFI       *bool    `json:",omitempty"`
@@ -333,9 +346,34 @@ type productVariables struct {
 
 	EnforceProductPartitionInterface *bool `json:",omitempty"`
 
+	EnforceInterPartitionJavaSdkLibrary *bool    `json:",omitempty"`
+	InterPartitionJavaLibraryAllowList  []string `json:",omitempty"`
+
 	InstallExtraFlattenedApexes *bool `json:",omitempty"`
 
 	BoardUsesRecoveryAsBoot *bool `json:",omitempty"`
+
+	BoardName *string `json:",omitempty"`
+
+	Boot_image_preloaded_classes   *string `json:",omitempty"`
+	Boot_image_dirty_image_objects *string `json:",omitempty"`
+
+	Proguard_obfuscation_dictionary *string  `json:",omitempty"`
+	Proguard_repackage_classes      *string  `json:",omitempty"`
+	Proguard_flags_files            []string `json:",omitempty"`
+	Proguard_disabled               *bool    `json:",omitempty"`
+
+	Product_name     *string  `json:",omitempty"`
+	Product_packages []string `json:",omitempty"`
+
+	Partition_size_budgets map[string]int64 `json:",omitempty"`
+
+	Artifact_path_requirements         map[string][]string `json:",omitempty"`
+	Artifact_path_requirements_relaxed *bool               `json:",omitempty"`
+
+	ModuleOverridesFile *string `json:",omitempty"`
+
+	Experimental_features map[string][]string `json:",omitempty"`
 }
 
 func boolPtr(v bool) *bool {
@@ -436,15 +474,17 @@ func (m *ModuleBase) setVariableProperties(ctx BottomUpMutatorContext,
 
 	printfIntoProperties(ctx, prefix, productVariablePropertyValue, variableValue)
 
-	err := proptools.AppendMatchingProperties(m.generalProperties,
-		productVariablePropertyValue.Addr().Interface(), nil)
-	if err != nil {
-		if propertyErr, ok := err.(*proptools.ExtendPropertyError); ok {
-			ctx.PropertyErrorf(propertyErr.Property, "%s", propertyErr.Err.Error())
-		} else {
-			panic(err)
+	m.tracePropertyChanges(ctx, prefix, func() {
+		err := proptools.AppendMatchingProperties(m.generalProperties,
+			productVariablePropertyValue.Addr().Interface(), nil)
+		if err != nil {
+			if propertyErr, ok := err.(*proptools.ExtendPropertyError); ok {
+				ctx.PropertyErrorf(propertyErr.Property, "%s", propertyErr.Err.Error())
+			} else {
+				panic(err)
+			}
 		}
-	}
+	})
 }
 
 func printfIntoPropertiesError(ctx BottomUpMutatorContext, prefix string,
@@ -209,6 +209,66 @@ func TestProductVariables(t *testing.T) {
 	FailIfErrored(t, errs)
 }
 
+// Test that product variables can disable modules in configurations they do not build in.
+func TestProductVariableEnabled(t *testing.T) {
+	ctx := NewTestContext()
+	ctx.RegisterModuleType("module", func() Module {
+		m := &testProductVariableModule{}
+		InitAndroidModule(m)
+		return m
+	})
+	ctx.PreDepsMutators(func(ctx RegisterMutatorsContext) {
+		ctx.BottomUp("variable", VariableMutator).Parallel()
+	})
+
+	bp := `
+		module {
+			name: "foo",
+			product_variables: {
+				unbundled_build: {
+					enabled: false,
+				},
+			},
+		}
+
+		module {
+			name: "bar",
+		}
+
+		module {
+			name: "baz",
+			enabled: false,
+			product_variables: {
+				pdk: {
+					enabled: true,
+				},
+			},
+		}
+	`
+	config := TestConfig(buildDir, nil, bp, nil)
+	config.TestProductVariables.Unbundled_build = proptools.BoolPtr(true)
+
+	ctx.Register(config)
+
+	_, errs := ctx.ParseFileList(".", []string{"Android.bp"})
+	FailIfErrored(t, errs)
+	_, errs = ctx.PrepareBuildActions(config)
+	FailIfErrored(t, errs)
+
+	for _, tt := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"foo", false},
+		{"bar", true},
+		{"baz", false},
+	} {
+		if g, w := ctx.ModuleForTests(tt.name, "").Module().Enabled(), tt.enabled; g != w {
+			t.Errorf("expected %s enabled to be %v, got %v", tt.name, w, g)
+		}
+	}
+}
+
 var testProductVariableDefaultsProperties = struct {
 	Product_variables struct {
 		Eng struct {
@@ -0,0 +1,85 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android
+
+import (
+	"strings"
+)
+
+// The xref build mode is enabled by setting XREF_CORPUS.  In that mode the compile rules of the
+// java and cc modules are accompanied by Kythe extraction rules that produce .kzip files.  This
+// singleton adds an xref_kzips target that builds all of them and writes their list to
+// xref/kzips.list, and an xref target that merges all of them into a single all.kzip that is the
+// input to the code search indexing pipeline.  As the extraction of some files may fail, the
+// xref target only succeeds if all of them are extracted; build_kzip.bash instead builds
+// xref_kzips with -k and merges the files that are in the list and were extracted.  The cc and java
+// packages also add the xref_cxx and xref_java targets, which build only the extraction files of
+// their modules.
+
+func init() {
+	RegisterSingletonType("xref", XrefSingleton)
+}
+
+// XrefProvider is implemented by modules that produce Kythe extraction (.kzip) files.
+type XrefProvider interface {
+	XrefFiles() Paths
+}
+
+func XrefSingleton() Singleton {
+	return &xrefSingleton{}
+}
+
+type xrefSingleton struct {
+	allKzip Path
+}
+
+func (x *xrefSingleton) GenerateBuildActions(ctx SingletonContext) {
+	if !ctx.Config().EmitXrefRules() {
+		return
+	}
+
+	var kzips Paths
+	ctx.VisitAllModules(func(module Module) {
+		if xref, ok := module.(XrefProvider); ok && module.Enabled() {
+			kzips = append(kzips, xref.XrefFiles()...)
+		}
+	})
+
+	if len(kzips) == 0 {
+		return
+	}
+
+	kzipList := PathForOutput(ctx, "xref", "kzips.list")
+	WriteFileRule(ctx, kzipList, strings.Join(kzips.Strings(), "\n")+"\n")
+	ctx.Phony("xref_kzips", append(Paths{kzipList}, kzips...)...)
+
+	allKzip := PathForOutput(ctx, "xref", "all.kzip")
+
+	rule := NewRuleBuilder()
+	rule.Command().
+		BuiltTool(ctx, "merge_zips").
+		Output(allKzip).
+		FlagWithRspFileInputList("@", kzips)
+	rule.Build(pctx, ctx, "xref", "merge kzip files")
+
+	ctx.Phony("xref", allKzip)
+	x.allKzip = allKzip
+}
+
+func (x *xrefSingleton) MakeVars(ctx MakeVarsContext) {
+	if x.allKzip != nil {
+		ctx.DistForGoal("xref", x.allKzip)
+	}
+}
@@ -1336,11 +1336,13 @@ type apexBundle struct {
 	targetProperties      apexTargetBundleProperties
 	overridableProperties overridableProperties
 
+	releaseSigningProperties android.ReleaseSigningProperties
+
 	// specific to apex_vndk modules
 	vndkProperties apexVndkProperties
 
 	bundleModuleFile android.WritablePath
-	outputFile       android.WritablePath
+	outputFile       android.Path
 	installDir       android.InstallPath
 
 	prebuiltFileToDelete string
@@ -2344,6 +2346,7 @@ func newApexBundle() *apexBundle {
 	module.AddProperties(&module.properties)
 	module.AddProperties(&module.targetProperties)
 	module.AddProperties(&module.overridableProperties)
+	module.AddProperties(&module.releaseSigningProperties)
 	module.Prefer32(func(ctx android.BaseModuleContext, base *android.ModuleBase, class android.OsClass) bool {
 		return class == android.Device && ctx.Config().DevicePrefer32BitExecutables()
 	})
@@ -25,6 +25,7 @@ import (
 
 	"android/soong/android"
 	"android/soong/java"
+	"android/soong/remoteexec"
 
 	"github.com/google/blueprint"
 	"github.com/google/blueprint/proptools"
@@ -575,8 +576,8 @@ func (a *apexBundle) buildUnflattenedApex(ctx android.ModuleContext) {
 		})
 	}
 
-	a.outputFile = android.PathForModuleOut(ctx, a.Name()+suffix)
-	rule := java.Signapk
+	signedOutputFile := android.PathForModuleOut(ctx, a.Name()+suffix)
+	rule, remote := remoteexec.Rule(ctx, "signapk", java.Signapk, java.SignapkRE)
 	args := map[string]string{
 		"certificates": a.container_certificate_file.String() + " " + a.container_private_key_file.String(),
 		"flags":        "-a 4096", //alignment
@@ -585,19 +586,19 @@ func (a *apexBundle) buildUnflattenedApex(ctx android.ModuleContext) {
 		a.container_certificate_file,
 		a.container_private_key_file,
 	}
-	if ctx.Config().IsEnvTrue("RBE_SIGNAPK") {
-		rule = java.SignapkRE
+	if remote {
 		args["implicits"] = strings.Join(implicits.Strings(), ",")
-		args["outCommaList"] = a.outputFile.String()
+		args["outCommaList"] = signedOutputFile.String()
 	}
 	ctx.Build(pctx, android.BuildParams{
 		Rule:        rule,
 		Description: "signapk",
-		Output:      a.outputFile,
+		Output:      signedOutputFile,
 		Input:       unsignedOutputFile,
 		Implicits:   implicits,
 		Args:        args,
 	})
+	a.outputFile = android.ReleaseSign(ctx, &a.releaseSigningProperties, signedOutputFile)
 
 	// Install to $OUT/soong/{target,host}/.../apex
 	if a.installable() {
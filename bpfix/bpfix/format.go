@@ -0,0 +1,107 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file implements the canonical form of blueprint files, which is applied by bpfix -fmt and
+// checked by bpfix -fmt -c.
+
+package bpfix
+
+import (
+	"sort"
+
+	"github.com/google/blueprint/parser"
+)
+
+// The properties whose values are sorted by sortLists.  The order of the values of most other
+// list properties is significant, for example static_libs determines the link order and srcs the
+// order of the compiler inputs, so only the properties whose order is known not to matter are
+// sorted.
+var sortedListProperties = []string{
+	"data",
+	"exclude_srcs",
+	"host_required",
+	"required",
+	"target_required",
+}
+
+var formatSteps = []FixStep{
+	{
+		Name: "reorderCommonProperties",
+		Fix:  runPatchListMod(reorderCommonProperties),
+	},
+	{
+		Name: "sortLists",
+		Fix:  sortLists,
+	},
+}
+
+// AddFormat adds the steps that put a file into its canonical form, without any of the fixes
+// that change the meaning of the file.
+func (r FixRequest) AddFormat() (result FixRequest) {
+	result.steps = append([]FixStep(nil), r.steps...)
+	result.steps = append(result.steps, formatSteps...)
+	return result
+}
+
+// Format returns the canonical form of a blueprint file: the common properties of each module
+// come first in a fixed order, and the values of the list properties whose order does not matter
+// are sorted.
+func Format(tree *parser.File) (*parser.File, error) {
+	return NewFixer(tree).Fix(NewFixRequest().AddFormat())
+}
+
+// sortLists sorts the lists of string literals of the properties in sortedListProperties,
+// including the ones nested in maps such as arch or target.  Values separated by a blank line are
+// sorted separately.
+func sortLists(f *Fixer) error {
+	// Make sure all the offsets are accurate, parser.SortList uses them to keep comments with the
+	// values they belong to.
+	if _, err := f.reparse(); err != nil {
+		return err
+	}
+
+	for _, def := range f.tree.Defs {
+		if mod, ok := def.(*parser.Module); ok {
+			sortListProperties(f.tree, mod.Properties)
+		}
+	}
+
+	sort.SliceStable(f.tree.Comments, func(i, j int) bool {
+		return f.tree.Comments[i].Pos().Offset < f.tree.Comments[j].Pos().Offset
+	})
+	return nil
+}
+
+func sortListProperties(file *parser.File, properties []*parser.Property) {
+	for _, prop := range properties {
+		switch value := prop.Value.(type) {
+		case *parser.Map:
+			sortListProperties(file, value.Properties)
+		case *parser.List:
+			if inList(prop.Name, sortedListProperties) && isStringList(value) {
+				parser.SortList(file, value)
+			}
+		}
+	}
+}
+
+// isStringList returns true if all the values of the list are string literals.
+func isStringList(list *parser.List) bool {
+	for _, value := range list.Values {
+		if _, ok := value.(*parser.String); !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,237 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bpfix
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/blueprint/parser"
+)
+
+func TestSortLists(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		out  string
+	}{
+		{
+			name: "sorted properties",
+			in: `
+				java_library {
+					name: "foo",
+					exclude_srcs: [
+						"b.java",
+						"a.java",
+					],
+					required: [
+						"c",
+						"a",
+						"b",
+					],
+				}
+			`,
+			out: `
+				java_library {
+					name: "foo",
+					exclude_srcs: [
+						"a.java",
+						"b.java",
+					],
+					required: [
+						"a",
+						"b",
+						"c",
+					],
+				}
+			`,
+		},
+		{
+			name: "order sensitive properties",
+			in: `
+				cc_library {
+					name: "foo",
+					srcs: [
+						"b.cpp",
+						"a.cpp",
+					],
+					static_libs: [
+						"libb",
+						"liba",
+					],
+					cflags: ["-DB", "-DA"],
+				}
+			`,
+			out: `
+				cc_library {
+					name: "foo",
+					srcs: [
+						"b.cpp",
+						"a.cpp",
+					],
+					static_libs: [
+						"libb",
+						"liba",
+					],
+					cflags: ["-DB", "-DA"],
+				}
+			`,
+		},
+		{
+			name: "nested properties",
+			in: `
+				cc_library {
+					name: "foo",
+					target: {
+						android: {
+							required: [
+								"d",
+								"c",
+							],
+						},
+					},
+				}
+			`,
+			out: `
+				cc_library {
+					name: "foo",
+					target: {
+						android: {
+							required: [
+								"c",
+								"d",
+							],
+						},
+					},
+				}
+			`,
+		},
+		{
+			name: "groups",
+			in: `
+				java_library {
+					name: "foo",
+					required: [
+						"d",
+						"c",
+
+						"b",
+						"a",
+					],
+				}
+			`,
+			out: `
+				java_library {
+					name: "foo",
+					required: [
+						"c",
+						"d",
+
+						"a",
+						"b",
+					],
+				}
+			`,
+		},
+		{
+			name: "variables",
+			in: `
+				java_library {
+					name: "foo",
+					required: [
+						"b",
+						foo_required,
+					],
+				}
+			`,
+			out: `
+				java_library {
+					name: "foo",
+					required: [
+						"b",
+						foo_required,
+					],
+				}
+			`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runPass(t, test.in, test.out, sortLists)
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	in := `
+		java_library {
+			srcs: [
+				"b.java",
+				"a.java",
+			],
+			installable: true,
+			name: "foo",
+			required: [
+				"b",
+				"a",
+			],
+			static_libs: [
+				"libb",
+				"liba",
+			],
+		}
+	`
+	expected, err := Reformat(`
+		java_library {
+			name: "foo",
+			installable: true,
+			srcs: [
+				"b.java",
+				"a.java",
+			],
+			required: [
+				"a",
+				"b",
+			],
+			static_libs: [
+				"libb",
+				"liba",
+			],
+		}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, errs := parser.Parse("<testcase>", bytes.NewBufferString(in), parser.NewScope(nil))
+	if errs != nil {
+		t.Fatal(errs)
+	}
+
+	tree, err = Format(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := parser.Print(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := string(out); got != expected {
+		t.Errorf("output didn't match:\ninput:\n%s\n\nexpected:\n%s\ngot:\n%s\n", in, expected, got)
+	}
+}
@@ -38,6 +38,8 @@ var (
 	list   = flag.Bool("l", false, "list files whose formatting differs from bpfmt's")
 	write  = flag.Bool("w", false, "write result to (source) file instead of stdout")
 	doDiff = flag.Bool("d", false, "display diffs instead of rewriting files")
+	check  = flag.Bool("c", false, "list files whose formatting differs and exit with a non-zero status, for presubmit checks")
+	format = flag.Bool("fmt", false, "only put files into their canonical form, without applying any fixes")
 )
 
 var (
@@ -88,9 +90,12 @@ func processFile(filename string, in io.Reader, out io.Writer, fixRequest bpfix.
 	}
 	if !bytes.Equal(src, res) {
 		// contents have changed
-		if *list {
+		if *list || *check {
 			fmt.Fprintln(out, filename)
 		}
+		if *check {
+			exitCode = 1
+		}
 		if *write {
 			err = ioutil.WriteFile(filename, res, 0644)
 			if err != nil {
@@ -106,7 +111,7 @@ func processFile(filename string, in io.Reader, out io.Writer, fixRequest bpfix.
 			out.Write(data)
 		}
 	}
-	if !*list && !*write && !*doDiff {
+	if !*list && !*write && !*doDiff && !*check {
 		_, err = out.Write(res)
 	}
 	return err
@@ -129,9 +134,17 @@ func walkDir(path string, fixRequest bpfix.FixRequest) {
 }
 
 func Run() {
+	run()
+	os.Exit(exitCode)
+}
+
+func run() {
 	flag.Parse()
 
 	fixRequest := bpfix.NewFixRequest().AddAll()
+	if *format {
+		fixRequest = bpfix.NewFixRequest().AddFormat()
+	}
 
 	if flag.NArg() == 0 {
 		if *write {
@@ -19,8 +19,9 @@ export KYTHE_KZIP_ENCODING
 # The extraction might fail for some source files, so run with -k and then check that
 # sufficiently many files were generated.
 declare -r out="${OUT_DIR:-out}"
-# Build extraction files for C++ and Java. Build `merge_zips` which we use later.
-build/soong/soong_ui.bash --build-mode --all-modules --dir=$PWD -k merge_zips xref_cxx xref_java
+# Build extraction files for C++ and Java, and their list in $out/soong/xref/kzips.list.
+# Build `merge_zips` which we use later.
+build/soong/soong_ui.bash --build-mode --all-modules --dir=$PWD -k merge_zips xref_kzips
 #Build extraction file for Go files in build/soong directory.
 declare -r abspath_out=$(realpath "${out}")
 declare -r go_extractor=$(realpath prebuilts/build-tools/linux-x86/bin/go_extractor)
@@ -32,11 +33,19 @@ for dir in blueprint soong; do
   )
 done
 
-declare -r kzip_count=$(find "$out" -name '*.kzip' | wc -l)
+# Only the C++ and Java extraction files that were generated are packed.
+declare -r kzip_list="$out/soong/xref/kzips.list"
+[[ -f "$kzip_list" ]] || { printf "The list of kzip files %s was not generated\n" "$kzip_list"; exit 1; }
+declare -r extracted_kzips="$out/soong/xref/extracted_kzips.list"
+while read -r kzip; do
+  if [[ -f "$kzip" ]]; then echo "$kzip"; fi
+done < "$kzip_list" > "$extracted_kzips"
+
+declare -r kzip_count=$(wc -l < "$extracted_kzips")
 (($kzip_count>100000)) || { printf "Too few kzip files were generated: %d\n" $kzip_count; exit 1; }
+printf "Packing %d of %d kzip files\n" $kzip_count $(wc -l < "$kzip_list")
 
-# Pack
-# TODO(asmundak): this should be done by soong.
+# Pack the C++ and Java extraction files together with the Go extraction files.
 declare -r allkzip="$BUILD_NUMBER.kzip"
-"$out/soong/host/linux-x86/bin/merge_zips" "$DIST_DIR/$allkzip" @<(find "$out" -name '*.kzip')
+"$out/soong/host/linux-x86/bin/merge_zips" "$DIST_DIR/$allkzip" @"$extracted_kzips" "$out"/soong/build_*.go.kzip
 
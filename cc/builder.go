@@ -583,10 +583,7 @@ func TransformSourceToObj(ctx android.ModuleContext, subdir string, srcFiles and
 			sAbiDumpFile := android.ObjPathWithExt(ctx, subdir, srcFile, "sdump")
 			sAbiDumpFiles = append(sAbiDumpFiles, sAbiDumpFile)
 
-			dumpRule := sAbiDump
-			if ctx.Config().IsEnvTrue("RBE_ABI_DUMPER") {
-				dumpRule = sAbiDumpRE
-			}
+			dumpRule, _ := remoteexec.Rule(ctx, "abi_dumper", sAbiDump, sAbiDumpRE)
 			ctx.Build(pctx, android.BuildParams{
 				Rule:        dumpRule,
 				Description: "header-abi-dumper " + srcFile.Rel(),
@@ -691,7 +688,7 @@ func TransformObjToDynamicBinary(ctx android.ModuleContext,
 		deps = append(deps, crtBegin.Path(), crtEnd.Path())
 	}
 
-	rule := ld
+	rule, remote := remoteexec.Rule(ctx, "cxx_links", ld, ldRE)
 	args := map[string]string{
 		"ldCmd":         ldCmd,
 		"crtBegin":      crtBegin.String(),
@@ -700,8 +697,7 @@ func TransformObjToDynamicBinary(ctx android.ModuleContext,
 		"ldFlags":       flags.globalLdFlags + " " + flags.localLdFlags,
 		"crtEnd":        crtEnd.String(),
 	}
-	if ctx.Config().IsEnvTrue("RBE_CXX_LINKS") {
-		rule = ldRE
+	if remote {
 		args["implicitOutputs"] = strings.Join(implicitOutputs.Strings(), ",")
 		args["implicitInputs"] = strings.Join(deps.Strings(), ",")
 	}
@@ -738,14 +734,13 @@ func TransformDumpToLinkedDump(ctx android.ModuleContext, sAbiDumps android.Path
 	for _, tag := range excludedSymbolTags {
 		symbolFilterStr += " --exclude-symbol-tag " + tag
 	}
-	rule := sAbiLink
+	rule, remote := remoteexec.Rule(ctx, "abi_linker", sAbiLink, sAbiLinkRE)
 	args := map[string]string{
 		"symbolFilter":        symbolFilterStr,
 		"arch":                ctx.Arch().ArchType.Name,
 		"exportedHeaderFlags": exportedHeaderFlags,
 	}
-	if ctx.Config().IsEnvTrue("RBE_ABI_LINKER") {
-		rule = sAbiLinkRE
+	if remote {
 		rbeImplicits := implicits.Strings()
 		for _, p := range strings.Split(exportedHeaderFlags, " ") {
 			if len(p) > 2 {
@@ -853,13 +848,12 @@ func TransformObjsToObj(ctx android.ModuleContext, objFiles android.Paths,
 
 	ldCmd := "${config.ClangBin}/clang++"
 
-	rule := partialLd
+	rule, remote := remoteexec.Rule(ctx, "cxx_links", partialLd, partialLdRE)
 	args := map[string]string{
 		"ldCmd":   ldCmd,
 		"ldFlags": flags.globalLdFlags + " " + flags.localLdFlags,
 	}
-	if ctx.Config().IsEnvTrue("RBE_CXX_LINKS") {
-		rule = partialLdRE
+	if remote {
 		args["inCommaList"] = strings.Join(objFiles.Strings(), ",")
 		args["implicitInputs"] = strings.Join(deps.Strings(), ",")
 	}
@@ -108,6 +108,8 @@ type Deps struct {
 
 	ReexportGeneratedHeaders []string
 
+	JniHeaderLibs []string
+
 	CrtBegin, CrtEnd string
 
 	// Used for host bionic
@@ -429,6 +431,7 @@ var (
 	genSourceDepTag       = DependencyTag{Name: "gen source"}
 	genHeaderDepTag       = DependencyTag{Name: "gen header"}
 	genHeaderExportDepTag = DependencyTag{Name: "gen header", ReexportFlags: true}
+	jniHeaderLibDepTag    = DependencyTag{Name: "jni header lib"}
 	objDepTag             = DependencyTag{Name: "obj"}
 	linkerFlagsDepTag     = DependencyTag{Name: "linker flags file"}
 	dynamicLinkerDepTag   = DependencyTag{Name: "dynamic linker"}
@@ -442,6 +445,13 @@ var (
 	testPerSrcDepTag      = DependencyTag{Name: "test_per_src"}
 )
 
+// JniHeadersProvider is implemented by the java modules that generate JNI headers for the native
+// methods in their sources, which cc modules reference in jni_header_libs.
+type JniHeadersProvider interface {
+	JniHeaderDirs() android.Paths
+	JniHeaderDeps() android.Paths
+}
+
 func IsSharedDepTag(depTag blueprint.DependencyTag) bool {
 	ccDepTag, ok := depTag.(DependencyTag)
 	return ok && ccDepTag.Shared
@@ -1064,6 +1074,11 @@ func (c *Module) XrefCcFiles() android.Paths {
 	return c.kytheFiles
 }
 
+// XrefFiles implements android.XrefProvider.
+func (c *Module) XrefFiles() android.Paths {
+	return c.kytheFiles
+}
+
 type baseModuleContext struct {
 	android.BaseModuleContext
 	moduleContextImpl
@@ -1979,6 +1994,15 @@ func (c *Module) DepsMutator(actx android.BottomUpMutatorContext) {
 		actx.AddDependency(c, depTag, gen)
 	}
 
+	if len(deps.JniHeaderLibs) > 0 {
+		// The java modules that generate the headers only have a common variant.
+		commonTarget := actx.Config().AndroidCommonTarget
+		if actx.Host() {
+			commonTarget = actx.Config().BuildOSCommonTarget
+		}
+		actx.AddFarVariationDependencies(commonTarget.Variations(), jniHeaderLibDepTag, deps.JniHeaderLibs...)
+	}
+
 	actx.AddVariationDependencies(nil, objDepTag, deps.ObjFiles...)
 
 	vendorSnapshotObjects := vendorSnapshotObjects(actx.Config())
@@ -2201,6 +2225,13 @@ func (c *Module) depsToPaths(ctx android.ModuleContext) PathDeps {
 
 			// handling for a few module types that aren't cc Module but that are also supported
 			switch depTag {
+			case jniHeaderLibDepTag:
+				if lib, ok := dep.(JniHeadersProvider); ok && len(lib.JniHeaderDirs()) > 0 {
+					depPaths.IncludeDirs = append(depPaths.IncludeDirs, lib.JniHeaderDirs()...)
+					depPaths.GeneratedDeps = append(depPaths.GeneratedDeps, lib.JniHeaderDeps()...)
+				} else {
+					ctx.ModuleErrorf("module %q is not a java module with generate_jni_headers: true", depName)
+				}
 			case genSourceDepTag:
 				if genRule, ok := dep.(genrule.SourceFileGenerator); ok {
 					depPaths.GeneratedSources = append(depPaths.GeneratedSources,
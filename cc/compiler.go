@@ -90,6 +90,10 @@ type BaseCompilerProperties struct {
 	// of genrule modules.
 	Generated_headers []string `android:"arch_variant"`
 
+	// list of java modules with generate_jni_headers: true whose JNI headers are added to the
+	// include path.
+	Jni_header_libs []string `android:"arch_variant"`
+
 	// pass -frtti instead of -fno-rtti
 	Rtti *bool
 
@@ -228,6 +232,7 @@ func (compiler *baseCompiler) compilerInit(ctx BaseModuleContext) {}
 func (compiler *baseCompiler) compilerDeps(ctx DepsContext, deps Deps) Deps {
 	deps.GeneratedSources = append(deps.GeneratedSources, compiler.Properties.Generated_sources...)
 	deps.GeneratedHeaders = append(deps.GeneratedHeaders, compiler.Properties.Generated_headers...)
+	deps.JniHeaderLibs = append(deps.JniHeaderLibs, compiler.Properties.Jni_header_libs...)
 
 	android.ProtoDeps(ctx, &compiler.Proto)
 	if compiler.hasSrcExt(".proto") {
@@ -74,6 +74,26 @@ type DependencyTag struct {
 	FromStatic bool
 }
 
+// InstallDepNeeded returns true for shared libraries, which are installed along with the modules
+// that link against them.
+func (d DependencyTag) InstallDepNeeded() bool {
+	return d.Shared
+}
+
+var _ android.InstallNeededDependencyTag = DependencyTag{}
+
+// StaticLink returns true for static libraries, which are linked into the modules that depend on
+// them.
+func (d DependencyTag) StaticLink() bool {
+	switch d {
+	case StaticDepTag, staticExportDepTag, lateStaticDepTag, wholeStaticDepTag, staticUnwinderDepTag:
+		return true
+	}
+	return false
+}
+
+var _ android.StaticLinkDependencyTag = DependencyTag{}
+
 var (
 	SharedDepTag = DependencyTag{Name: "shared", Library: true, Shared: true}
 	StaticDepTag = DependencyTag{Name: "static", Library: true}
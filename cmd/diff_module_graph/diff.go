@@ -0,0 +1,266 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// graphDiff contains the differences between the modules of two builds.
+type graphDiff struct {
+	onlyInA, onlyInB []*module
+	modified         []moduleDiff
+}
+
+// moduleDiff contains the differences between the actions of a module in two builds.
+type moduleDiff struct {
+	a, b *module
+
+	// The first outputs of the build statements that are only in one of the builds.
+	outputsOnlyInA, outputsOnlyInB []string
+
+	// A description of each change to the build statements and variables of the module.
+	changes []string
+}
+
+func (d *graphDiff) empty() bool {
+	return len(d.onlyInA) == 0 && len(d.onlyInB) == 0 && len(d.modified) == 0
+}
+
+// String pretty-prints the differences between the modules of two builds.
+func (d *graphDiff) String() string {
+	buf := &bytes.Buffer{}
+
+	must := func(n int, err error) {
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if len(d.onlyInA) > 0 {
+		must(fmt.Fprintln(buf, "modules removed:"))
+		for _, m := range d.onlyInA {
+			must(fmt.Fprintf(buf, " - %s [%s]\n", m.key(), m.typ))
+		}
+	}
+
+	if len(d.onlyInB) > 0 {
+		must(fmt.Fprintln(buf, "modules added:"))
+		for _, m := range d.onlyInB {
+			must(fmt.Fprintf(buf, " + %s [%s]\n", m.key(), m.typ))
+		}
+	}
+
+	if len(d.modified) > 0 {
+		must(fmt.Fprintln(buf, "modules modified:"))
+		for _, m := range d.modified {
+			must(fmt.Fprintf(buf, "   %s [%s]\n", m.b.key(), m.b.typ))
+			for _, output := range m.outputsOnlyInA {
+				must(fmt.Fprintf(buf, "     - output %s\n", output))
+			}
+			for _, output := range m.outputsOnlyInB {
+				must(fmt.Fprintf(buf, "     + output %s\n", output))
+			}
+			for _, change := range m.changes {
+				must(fmt.Fprintf(buf, "       %s\n", change))
+			}
+		}
+	}
+
+	if !d.empty() {
+		must(fmt.Fprintf(buf, "%d modules removed, %d modules added, %d modules modified\n",
+			len(d.onlyInA), len(d.onlyInB), len(d.modified)))
+	}
+
+	return buf.String()
+}
+
+// diffModuleGraphs compares the modules of two builds.
+func diffModuleGraphs(a, b *moduleGraph) graphDiff {
+	diff := graphDiff{}
+
+	for _, key := range sortedKeys(a.modules) {
+		if _, ok := b.modules[key]; !ok {
+			diff.onlyInA = append(diff.onlyInA, a.modules[key])
+		}
+	}
+
+	for _, key := range sortedKeys(b.modules) {
+		aModule, ok := a.modules[key]
+		if !ok {
+			diff.onlyInB = append(diff.onlyInB, b.modules[key])
+			continue
+		}
+		if moduleDiff := diffModules(aModule, b.modules[key]); moduleDiff != nil {
+			diff.modified = append(diff.modified, *moduleDiff)
+		}
+	}
+
+	return diff
+}
+
+// diffModules compares the actions of a module in two builds, and returns nil if they are the same.
+func diffModules(a, b *module) *moduleDiff {
+	diff := &moduleDiff{a: a, b: b}
+
+	if a.typ != b.typ {
+		diff.changes = append(diff.changes, fmt.Sprintf("type: %s -> %s", a.typ, b.typ))
+	}
+
+	for _, output := range sortedKeys(a.builds) {
+		if _, ok := b.builds[output]; !ok {
+			diff.outputsOnlyInA = append(diff.outputsOnlyInA, output)
+		}
+	}
+
+	for _, output := range sortedKeys(b.builds) {
+		aBuild, ok := a.builds[output]
+		if !ok {
+			diff.outputsOnlyInB = append(diff.outputsOnlyInB, output)
+			continue
+		}
+		diff.changes = append(diff.changes, diffBuildStatements(output, aBuild, b.builds[output])...)
+	}
+
+	diff.changes = append(diff.changes, diffVariables("variable ", a.variables, b.variables)...)
+
+	if len(diff.outputsOnlyInA) == 0 && len(diff.outputsOnlyInB) == 0 && len(diff.changes) == 0 {
+		return nil
+	}
+	return diff
+}
+
+// diffBuildStatements returns a description of each change between two build statements that
+// have the same first output.
+func diffBuildStatements(output string, a, b *buildStatement) []string {
+	var changes []string
+
+	if a.rule != b.rule {
+		changes = append(changes, fmt.Sprintf("%s: rule: %s -> %s", output, a.rule, b.rule))
+	}
+
+	removed, added := diffLists(a.outputs, b.outputs)
+	for _, s := range removed {
+		changes = append(changes, fmt.Sprintf("%s: - output %s", output, s))
+	}
+	for _, s := range added {
+		changes = append(changes, fmt.Sprintf("%s: + output %s", output, s))
+	}
+
+	removed, added = diffLists(a.inputs, b.inputs)
+	for _, s := range removed {
+		changes = append(changes, fmt.Sprintf("%s: - input %s", output, s))
+	}
+	for _, s := range added {
+		changes = append(changes, fmt.Sprintf("%s: + input %s", output, s))
+	}
+
+	changes = append(changes, diffVariables(output+": ", a.variables, b.variables)...)
+
+	return changes
+}
+
+// diffVariables returns a description of each variable that was removed, added or changed.  For
+// variables that contain flags the flags that were removed and added are listed instead of the
+// whole values.
+func diffVariables(prefix string, a, b map[string]string) []string {
+	var changes []string
+
+	for _, name := range sortedKeys(a) {
+		if _, ok := b[name]; !ok {
+			changes = append(changes, fmt.Sprintf("%s- %s = %s", prefix, name, a[name]))
+		}
+	}
+
+	for _, name := range sortedKeys(b) {
+		aValue, ok := a[name]
+		bValue := b[name]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("%s+ %s = %s", prefix, name, bValue))
+		} else if aValue != bValue {
+			removed, added := diffLists(strings.Fields(aValue), strings.Fields(bValue))
+			if len(removed) == 0 && len(added) == 0 {
+				// Only the order or the spacing of the value changed.
+				changes = append(changes, fmt.Sprintf("%s%s: %q -> %q", prefix, name, aValue, bValue))
+				continue
+			}
+			var flags []string
+			if len(removed) > 0 {
+				flags = append(flags, "removed "+strings.Join(removed, " "))
+			}
+			if len(added) > 0 {
+				flags = append(flags, "added "+strings.Join(added, " "))
+			}
+			changes = append(changes, fmt.Sprintf("%s%s: %s", prefix, name, strings.Join(flags, ", ")))
+		}
+	}
+
+	return changes
+}
+
+// diffLists returns the values that are only in a and the values that are only in b.
+func diffLists(a, b []string) (onlyInA, onlyInB []string) {
+	inA := make(map[string]int)
+	for _, s := range a {
+		inA[s]++
+	}
+	inB := make(map[string]int)
+	for _, s := range b {
+		inB[s]++
+	}
+
+	for _, s := range a {
+		if inB[s] > 0 {
+			inB[s]--
+		} else {
+			onlyInA = append(onlyInA, s)
+		}
+	}
+
+	for _, s := range b {
+		if inA[s] > 0 {
+			inA[s]--
+		} else {
+			onlyInB = append(onlyInB, s)
+		}
+	}
+
+	return onlyInA, onlyInB
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]*module:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*buildStatement:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]string:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	default:
+		panic(fmt.Errorf("unsupported map type %T", m))
+	}
+	sort.Strings(keys)
+	return keys
+}
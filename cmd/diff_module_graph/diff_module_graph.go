@@ -0,0 +1,75 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// diff_module_graph compares the ninja files written by soong_build in two builds, for example
+// out/soong/build.ninja before and after a change, and summarizes the modules that were added or
+// removed and the outputs, inputs, rules and flags that changed in each module.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: diff_module_graph <before.ninja> <after.ninja>\n")
+	flag.PrintDefaults()
+	os.Exit(1)
+}
+
+func readModuleGraph(file string) (*moduleGraph, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	graph, err := parseNinjaFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	return graph, nil
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		fmt.Fprintf(os.Stderr, "Error, exactly two arguments are required\n")
+		usage()
+	}
+
+	a, err := readModuleGraph(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading ninja file: %v\n", err)
+		os.Exit(1)
+	}
+
+	b, err := readModuleGraph(flag.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading ninja file: %v\n", err)
+		os.Exit(1)
+	}
+
+	diff := diffModuleGraphs(a, b)
+
+	fmt.Print(diff.String())
+
+	if !diff.empty() {
+		fmt.Fprintln(os.Stderr, "differences found")
+		os.Exit(1)
+	}
+}
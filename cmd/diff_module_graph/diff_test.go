@@ -0,0 +1,153 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffModuleGraphs(t *testing.T) {
+	before := `
+# Module:  libfoo
+# Variant: android_arm64
+# Type:    cc_library
+
+m.libfoo_android_arm64.cflags = -O2 -Wall
+
+build out/foo.o: g.cc.cc foo.c
+    cFlags = ${m.libfoo_android_arm64.cflags} -DFOO
+
+build out/libfoo.a: g.cc.ar out/foo.o
+
+# Module:  libbar
+# Variant: android_arm64
+# Type:    cc_library
+
+build out/bar.o: g.cc.cc bar.c
+
+# Module:  libsame
+# Variant: android_arm64
+# Type:    cc_library
+
+build out/same.o: g.cc.cc same.c
+    cFlags = -DSAME
+`
+
+	after := `
+# Module:  libfoo
+# Variant: android_arm64
+# Type:    cc_library
+
+m.libfoo_android_arm64.cflags = -O3 -Wall -Werror
+
+build out/foo.o: g.cc.clang_tidy foo.c | foo.h
+    cFlags = ${m.libfoo_android_arm64.cflags} -DFOO
+    tidyFlags = -checks=*
+
+build out/libfoo.so: g.cc.ld out/foo.o
+
+# Module:  libbaz
+# Variant: android_arm64
+# Type:    cc_library
+
+build out/baz.o: g.cc.cc baz.c
+
+# Module:  libsame
+# Variant: android_arm64
+# Type:    cc_library
+
+build out/same.o: g.cc.cc same.c
+    cFlags = -DSAME
+`
+
+	a, err := parseNinjaFile(strings.NewReader(before))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := parseNinjaFile(strings.NewReader(after))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff := diffModuleGraphs(a, b)
+
+	expected := `modules removed:
+ - libbar (android_arm64) [cc_library]
+modules added:
+ + libbaz (android_arm64) [cc_library]
+modules modified:
+   libfoo (android_arm64) [cc_library]
+     - output out/libfoo.a
+     + output out/libfoo.so
+       out/foo.o: rule: g.cc.cc -> g.cc.clang_tidy
+       out/foo.o: + input foo.h
+       out/foo.o: + tidyFlags = -checks=*
+       variable m.libfoo_android_arm64.cflags: removed -O2, added -O3 -Werror
+1 modules removed, 1 modules added, 1 modules modified
+`
+
+	if g, w := diff.String(), expected; g != w {
+		t.Errorf("expected diff:\n%s\ngot:\n%s", w, g)
+	}
+
+	if same := diffModuleGraphs(a, a); !same.empty() {
+		t.Errorf("expected no differences between the same graphs, got:\n%s", same.String())
+	}
+}
+
+func TestDiffLists(t *testing.T) {
+	testCases := []struct {
+		name             string
+		a, b             []string
+		onlyInA, onlyInB []string
+	}{
+		{
+			name: "same",
+			a:    []string{"a", "b"},
+			b:    []string{"a", "b"},
+		},
+		{
+			name: "reordered",
+			a:    []string{"a", "b"},
+			b:    []string{"b", "a"},
+		},
+		{
+			name:    "changed",
+			a:       []string{"a", "b", "c"},
+			b:       []string{"a", "d", "c", "e"},
+			onlyInA: []string{"b"},
+			onlyInB: []string{"d", "e"},
+		},
+		{
+			name:    "duplicates",
+			a:       []string{"a", "a", "b"},
+			b:       []string{"a", "b", "b"},
+			onlyInA: []string{"a"},
+			onlyInB: []string{"b"},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			onlyInA, onlyInB := diffLists(test.a, test.b)
+			if !reflect.DeepEqual(onlyInA, test.onlyInA) || !reflect.DeepEqual(onlyInB, test.onlyInB) {
+				t.Errorf("diffLists = %q, %q", onlyInA, onlyInB)
+				t.Errorf("     want %q, %q", test.onlyInA, test.onlyInB)
+			}
+		})
+	}
+}
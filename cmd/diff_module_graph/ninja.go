@@ -0,0 +1,348 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// moduleGraph contains the modules and singletons of a ninja file written by soong_build, and
+// the build statements and variables that each of them defines.
+type moduleGraph struct {
+	modules map[string]*module
+}
+
+// module is a variant of a module, or a singleton, and the actions it defines in the ninja file.
+type module struct {
+	name    string
+	variant string
+	typ     string
+
+	// The directory of the Android.bp file that defines the module.  Modules in different Soong
+	// namespaces can have the same name, but not modules in the same directory.
+	dir string
+
+	// The build statements of the module, keyed by their first output.
+	builds map[string]*buildStatement
+
+	// The module scoped variables of the module, keyed by their name.
+	variables map[string]string
+}
+
+// key returns the name that identifies the module variant in a moduleGraph, which is qualified
+// with the directory of the module, e.g. //external/foo:libfoo, if it is known.
+func (m *module) key() string {
+	name := m.name
+	if m.dir != "" {
+		name = "//" + m.dir + ":" + name
+	}
+	if m.variant == "" {
+		return name
+	}
+	return name + " (" + m.variant + ")"
+}
+
+type buildStatement struct {
+	rule      string
+	outputs   []string
+	inputs    []string
+	variables map[string]string
+}
+
+// The headers blueprint writes before the actions of each module and singleton.
+const (
+	moduleHeaderPrefix    = "# Module:"
+	variantHeaderPrefix   = "# Variant:"
+	typeHeaderPrefix      = "# Type:"
+	definedHeaderPrefix   = "# Defined:"
+	singletonHeaderPrefix = "# Singleton:"
+)
+
+// parseNinjaFile reads the per-module sections of a ninja file written by soong_build.  The build
+// statements and variables that precede the first module, such as the global rules and
+// variables, are not part of any module and are ignored.
+func parseNinjaFile(r io.Reader) (*moduleGraph, error) {
+	graph := &moduleGraph{modules: make(map[string]*module)}
+
+	var current *module
+	var currentBuild *buildStatement
+
+	finishModule := func() error {
+		if current == nil {
+			return nil
+		}
+		if _, exists := graph.modules[current.key()]; exists {
+			return fmt.Errorf("module %s is defined more than once", current.key())
+		}
+		graph.modules[current.key()] = current
+		current = nil
+		return nil
+	}
+
+	newModule := func(name, typ string) *module {
+		return &module{
+			name:      name,
+			typ:       typ,
+			builds:    make(map[string]*buildStatement),
+			variables: make(map[string]string),
+		}
+	}
+
+	lines, err := readNinjaLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, line := range lines {
+		lineErr := func(format string, args ...interface{}) error {
+			return fmt.Errorf("line %d: %s", i+1, fmt.Sprintf(format, args...))
+		}
+
+		switch {
+		case strings.HasPrefix(line, moduleHeaderPrefix):
+			if err := finishModule(); err != nil {
+				return nil, lineErr("%s", err)
+			}
+			current = newModule(headerValue(line, moduleHeaderPrefix), "")
+			currentBuild = nil
+		case strings.HasPrefix(line, singletonHeaderPrefix):
+			if err := finishModule(); err != nil {
+				return nil, lineErr("%s", err)
+			}
+			current = newModule(headerValue(line, singletonHeaderPrefix), "singleton")
+			currentBuild = nil
+		case strings.HasPrefix(line, variantHeaderPrefix):
+			if current != nil {
+				current.variant = headerValue(line, variantHeaderPrefix)
+			}
+		case strings.HasPrefix(line, typeHeaderPrefix):
+			if current != nil {
+				current.typ = headerValue(line, typeHeaderPrefix)
+			}
+		case strings.HasPrefix(line, definedHeaderPrefix):
+			// The position of the module, e.g. external/foo/Android.bp:1:1.
+			if current != nil {
+				current.dir = filepath.Dir(headerValue(line, definedHeaderPrefix))
+			}
+		case strings.HasPrefix(line, "#"), strings.TrimSpace(line) == "":
+			// Comments and blank lines.
+		case line[0] == ' ' || line[0] == '\t':
+			// A variable scoped to the preceding build, rule or pool statement.
+			if currentBuild != nil {
+				name, value, ok := parseAssignment(line)
+				if !ok {
+					return nil, lineErr("invalid variable assignment %q", strings.TrimSpace(line))
+				}
+				currentBuild.variables[name] = value
+			}
+		case strings.HasPrefix(line, "build "):
+			currentBuild = nil
+			if current == nil {
+				continue
+			}
+			build, err := parseBuildStatement(strings.TrimPrefix(line, "build "))
+			if err != nil {
+				return nil, lineErr("%s", err)
+			}
+			if _, exists := current.builds[build.outputs[0]]; exists {
+				return nil, lineErr("output %q of module %s is built more than once",
+					build.outputs[0], current.key())
+			}
+			current.builds[build.outputs[0]] = build
+			currentBuild = build
+		case strings.HasPrefix(line, "rule "), strings.HasPrefix(line, "pool "),
+			strings.HasPrefix(line, "default "), strings.HasPrefix(line, "subninja "),
+			strings.HasPrefix(line, "include "), strings.HasPrefix(line, "ninja_required_version "),
+			strings.HasPrefix(line, "builddir "):
+			currentBuild = nil
+		default:
+			currentBuild = nil
+			if current == nil {
+				continue
+			}
+			name, value, ok := parseAssignment(line)
+			if !ok {
+				return nil, lineErr("unexpected line %q", line)
+			}
+			current.variables[name] = value
+		}
+	}
+
+	if err := finishModule(); err != nil {
+		return nil, err
+	}
+
+	return graph, nil
+}
+
+// readNinjaLines reads the lines of a ninja file, joining the lines that are continued with a
+// '$' at the end of the line.  Lines that are joined are replaced with empty lines so that the
+// line numbers stay accurate.
+func readNinjaLines(r io.Reader) ([]string, error) {
+	var lines []string
+	var continued []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(continued) > 0 {
+			line = strings.TrimLeft(line, " \t")
+		}
+
+		if isContinued(line) {
+			continued = append(continued, strings.TrimSuffix(line, "$"))
+			continue
+		}
+
+		if len(continued) > 0 {
+			lines = append(lines, strings.Join(continued, "")+line)
+			for range continued {
+				lines = append(lines, "")
+			}
+			continued = nil
+		} else {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(continued) > 0 {
+		return nil, fmt.Errorf("unexpected end of file after line continuation")
+	}
+
+	return lines, nil
+}
+
+// isContinued returns true if the line ends with an unescaped '$'.
+func isContinued(line string) bool {
+	dollars := len(line) - len(strings.TrimRight(line, "$"))
+	return dollars%2 == 1
+}
+
+func headerValue(line, prefix string) string {
+	return strings.TrimSpace(strings.TrimPrefix(line, prefix))
+}
+
+// parseAssignment parses a "name = value" line.
+func parseAssignment(line string) (name, value string, ok bool) {
+	i := strings.Index(line, "=")
+	if i < 0 {
+		return "", "", false
+	}
+	name = strings.TrimSpace(line[:i])
+	value = strings.TrimSpace(line[i+1:])
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return "", "", false
+	}
+	return name, value, true
+}
+
+// parseBuildStatement parses the part of a build statement after "build ":
+//   outputs [| implicit outputs]: rule [inputs] [| implicit inputs] [|| order only inputs]
+// The implicit and order only inputs are treated the same as the explicit inputs.
+func parseBuildStatement(s string) (*buildStatement, error) {
+	tokens, err := splitNinjaTokens(s)
+	if err != nil {
+		return nil, err
+	}
+
+	build := &buildStatement{variables: make(map[string]string)}
+
+	i := 0
+	for ; i < len(tokens) && tokens[i] != ":"; i++ {
+		if tokens[i] != "|" {
+			build.outputs = append(build.outputs, tokens[i])
+		}
+	}
+	if i == len(tokens) {
+		return nil, fmt.Errorf("missing ':' in build statement %q", s)
+	}
+	if len(build.outputs) == 0 {
+		return nil, fmt.Errorf("missing outputs in build statement %q", s)
+	}
+	i++
+	if i == len(tokens) || tokens[i] == "|" || tokens[i] == "||" {
+		return nil, fmt.Errorf("missing rule in build statement %q", s)
+	}
+	build.rule = tokens[i]
+	for i++; i < len(tokens); i++ {
+		if tokens[i] != "|" && tokens[i] != "||" {
+			build.inputs = append(build.inputs, tokens[i])
+		}
+	}
+
+	return build, nil
+}
+
+// splitNinjaTokens splits a build statement on unescaped spaces, and returns unescaped ':', '|'
+// and '||' as separate tokens.  The "$ ", "$:" and "$$" escapes are replaced by the characters
+// they escape, other escapes such as variable references are kept as is.
+func splitNinjaTokens(s string) ([]string, error) {
+	var tokens []string
+	var token strings.Builder
+	inToken := false
+
+	flush := func() {
+		if inToken {
+			tokens = append(tokens, token.String())
+			token.Reset()
+			inToken = false
+		}
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '$':
+			if i+1 == len(s) {
+				return nil, fmt.Errorf("unterminated escape in %q", s)
+			}
+			i++
+			switch s[i] {
+			case ' ', ':', '$':
+				token.WriteByte(s[i])
+			default:
+				token.WriteByte('$')
+				token.WriteByte(s[i])
+			}
+			inToken = true
+		case ' ', '\t':
+			flush()
+		case ':':
+			flush()
+			tokens = append(tokens, ":")
+		case '|':
+			flush()
+			if i+1 < len(s) && s[i+1] == '|' {
+				tokens = append(tokens, "||")
+				i++
+			} else {
+				tokens = append(tokens, "|")
+			}
+		default:
+			token.WriteByte(c)
+			inToken = true
+		}
+	}
+	flush()
+
+	return tokens, nil
+}
@@ -0,0 +1,215 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testNinjaFile = `ninja_required_version = 1.7.0
+
+g.cc.clang = prebuilts/clang/bin/clang
+
+rule g.cc.cc
+    command = ${g.cc.clang} -c ${cFlags} -o ${out} ${in}
+
+build out/soong/.bootstrap/bin/soong_build: g.bootstrap.cp out/soong/soong_build
+
+# # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # #
+# Module:  libfoo
+# Variant: android_arm64_armv8-a_static
+# Type:    cc_library
+# Factory: android/soong/cc.LibraryFactory
+# Defined: external/foo/Android.bp:1:1
+
+m.libfoo_android_arm64_armv8-a_static.cflags = -O2 -Wall
+
+build $
+        out/soong/.intermediates/external/foo/libfoo/android_arm64_armv8-a_static/obj/external/foo/foo.o $
+        : g.cc.cc external/foo/foo.c | ${g.cc.clang} || $
+        out/soong/.intermediates/external/foo/libfoo/android_arm64_armv8-a_static/gen/foo.h
+    description = ${m.libfoo_android_arm64_armv8-a_static.moduleDesc}cc foo.c
+    cFlags = ${m.libfoo_android_arm64_armv8-a_static.cflags} -DFOO$:1
+
+build out/soong/.intermediates/libfoo/libfoo.a | out/soong/.intermediates/libfoo/libfoo.a.toc: $
+        g.cc.ar out/foo$ bar.o
+
+# # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # # #
+# Singleton: api_levels
+# Factory:   android/soong/android.ApiLevelsSingleton
+
+build out/soong/api_levels.json: g.android.WriteFile
+    content = {"Q":29}
+
+default out/soong/api_levels.json
+`
+
+func TestParseNinjaFile(t *testing.T) {
+	graph, err := parseNinjaFile(strings.NewReader(testNinjaFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]*module{
+		"//external/foo:libfoo (android_arm64_armv8-a_static)": {
+			name:    "libfoo",
+			variant: "android_arm64_armv8-a_static",
+			typ:     "cc_library",
+			dir:     "external/foo",
+			builds: map[string]*buildStatement{
+				"out/soong/.intermediates/external/foo/libfoo/android_arm64_armv8-a_static/obj/external/foo/foo.o": {
+					rule: "g.cc.cc",
+					outputs: []string{
+						"out/soong/.intermediates/external/foo/libfoo/android_arm64_armv8-a_static/obj/external/foo/foo.o",
+					},
+					inputs: []string{
+						"external/foo/foo.c",
+						"${g.cc.clang}",
+						"out/soong/.intermediates/external/foo/libfoo/android_arm64_armv8-a_static/gen/foo.h",
+					},
+					variables: map[string]string{
+						"description": "${m.libfoo_android_arm64_armv8-a_static.moduleDesc}cc foo.c",
+						"cFlags":      "${m.libfoo_android_arm64_armv8-a_static.cflags} -DFOO$:1",
+					},
+				},
+				"out/soong/.intermediates/libfoo/libfoo.a": {
+					rule: "g.cc.ar",
+					outputs: []string{
+						"out/soong/.intermediates/libfoo/libfoo.a",
+						"out/soong/.intermediates/libfoo/libfoo.a.toc",
+					},
+					inputs:    []string{"out/foo bar.o"},
+					variables: map[string]string{},
+				},
+			},
+			variables: map[string]string{
+				"m.libfoo_android_arm64_armv8-a_static.cflags": "-O2 -Wall",
+			},
+		},
+		"api_levels": {
+			name: "api_levels",
+			typ:  "singleton",
+			builds: map[string]*buildStatement{
+				"out/soong/api_levels.json": {
+					rule:    "g.android.WriteFile",
+					outputs: []string{"out/soong/api_levels.json"},
+					variables: map[string]string{
+						"content": `{"Q":29}`,
+					},
+				},
+			},
+			variables: map[string]string{},
+		},
+	}
+
+	if len(graph.modules) != len(expected) {
+		t.Errorf("expected modules %q, got %q", sortedKeys(expected), sortedKeys(graph.modules))
+	}
+
+	for key, w := range expected {
+		g, ok := graph.modules[key]
+		if !ok {
+			t.Errorf("missing module %q", key)
+			continue
+		}
+		if !reflect.DeepEqual(g, w) {
+			t.Errorf("module %q:\nexpected: %#v\n     got: %#v", key, w, g)
+			for output, build := range g.builds {
+				t.Errorf("  %s: %#v", output, build)
+			}
+		}
+	}
+}
+
+func TestParseNinjaFileNamespaces(t *testing.T) {
+	in := `
+# Module:  libfoo
+# Variant: android
+# Defined: vendor/a/Android.bp:1:1
+
+build out/a/libfoo.so: g.cc.ld out/a/foo.o
+
+# Module:  libfoo
+# Variant: android
+# Defined: vendor/b/Android.bp:1:1
+
+build out/b/libfoo.so: g.cc.ld out/b/foo.o
+`
+	graph, err := parseNinjaFile(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"//vendor/a:libfoo (android)", "//vendor/b:libfoo (android)"}
+	if g := sortedKeys(graph.modules); !reflect.DeepEqual(g, expected) {
+		t.Errorf("expected modules %q, got %q", expected, g)
+	}
+}
+
+func TestParseNinjaFileErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		in   string
+		err  string
+	}{
+		{
+			name: "duplicate module",
+			in: `
+# Module:  libfoo
+# Variant: android
+# Module:  libfoo
+# Variant: android
+`,
+			err: "module libfoo (android) is defined more than once",
+		},
+		{
+			name: "missing rule",
+			in: `
+# Module:  libfoo
+build out/foo.o: | foo.c
+`,
+			err: "line 3: missing rule in build statement",
+		},
+		{
+			name: "missing colon",
+			in: `
+# Module:  libfoo
+build out/foo.o g.cc.cc foo.c
+`,
+			err: "line 3: missing ':' in build statement",
+		},
+		{
+			name: "unterminated continuation",
+			in: `
+# Module:  libfoo
+build out/foo.o: g.cc.cc $`,
+			err: "unexpected end of file after line continuation",
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseNinjaFile(strings.NewReader(test.in))
+			if err == nil {
+				t.Fatalf("expected error %q, got none", test.err)
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("expected error %q, got %q", test.err, err.Error())
+			}
+		})
+	}
+}
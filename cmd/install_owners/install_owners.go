@@ -0,0 +1,191 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// install_owners reports whether each file installed for a product is produced by Soong or by
+// Make.  It reads the list of files installed by Soong modules that is written by the
+// install_owners singleton and the list of files that Make installs for the product, and writes a
+// json file with the owner of every installed file and the number of files owned by Soong and by
+// Make in each partition, which is used as the data of the Make to Soong migration dashboard.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	soongInstalls = flag.String("soong_installs", "", "list of files installed by Soong modules")
+	makeInstalls  = flag.String("make_installs", "", "list of files installed by Make for the product")
+	outDir        = flag.String("out_dir", "out", "directory that the paths in the Make list are relative to")
+	outputFile    = flag.String("o", "", "output json file")
+)
+
+const (
+	ownerSoong = "soong"
+	ownerMake  = "make"
+)
+
+type Artifact struct {
+	// Path of the installed file, relative to the out directory.
+	Path      string
+	Partition string
+	Owner     string
+	// Module that installs the file, if known.
+	Module string `json:",omitempty"`
+}
+
+type Count struct {
+	Partition string
+	Soong     int
+	Make      int
+}
+
+type Report struct {
+	Total      Count
+	Partitions []Count
+	Artifacts  []Artifact
+}
+
+// readInstalls reads a list of installed files with one file per line, optionally followed by the
+// name of the module that installs it, and returns a map from the file to the module.
+func readInstalls(r io.Reader, prefix string) (map[string]string, error) {
+	installs := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		path := filepath.Clean(fields[0])
+		if prefix != "" {
+			if rel, err := filepath.Rel(prefix, path); err == nil && !strings.HasPrefix(rel, "../") {
+				path = rel
+			}
+		}
+		module := ""
+		if len(fields) > 1 {
+			module = fields[1]
+		}
+		if installs[path] == "" {
+			installs[path] = module
+		}
+	}
+	return installs, scanner.Err()
+}
+
+// partition returns the partition that a file is installed into, "host" for files installed into
+// the host output directory, or "other".
+func partition(path string) string {
+	parts := strings.Split(path, "/")
+	switch {
+	case len(parts) > 4 && parts[0] == "target" && parts[1] == "product":
+		return parts[3]
+	case parts[0] == "host":
+		return "host"
+	default:
+		return "other"
+	}
+}
+
+// generateReport assigns every file installed by Make to Soong if it is installed by a Soong
+// module, or to Make otherwise.  Files installed by Soong modules that are not installed for the
+// product are not part of the report.
+func generateReport(soongOwners, makeOwners map[string]string) Report {
+	var paths []string
+	for path := range makeOwners {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	report := Report{Total: Count{Partition: "total"}}
+	counts := make(map[string]*Count)
+	var partitions []string
+
+	for _, path := range paths {
+		artifact := Artifact{Path: path, Partition: partition(path), Owner: ownerMake, Module: makeOwners[path]}
+		if module, ok := soongOwners[path]; ok {
+			artifact.Owner = ownerSoong
+			artifact.Module = module
+		}
+		report.Artifacts = append(report.Artifacts, artifact)
+
+		count := counts[artifact.Partition]
+		if count == nil {
+			count = &Count{Partition: artifact.Partition}
+			counts[artifact.Partition] = count
+			partitions = append(partitions, artifact.Partition)
+		}
+		for _, c := range []*Count{count, &report.Total} {
+			if artifact.Owner == ownerSoong {
+				c.Soong++
+			} else {
+				c.Make++
+			}
+		}
+	}
+
+	sort.Strings(partitions)
+	for _, p := range partitions {
+		report.Partitions = append(report.Partitions, *counts[p])
+	}
+
+	return report
+}
+
+func readInstallsFile(file, prefix string) map[string]string {
+	f, err := os.Open(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	installs, err := readInstalls(f, prefix)
+	if err != nil {
+		log.Fatalf("failed to read %s: %s", file, err)
+	}
+	return installs
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: install_owners -soong_installs <file> -make_installs <file> [-out_dir <dir>] -o <output file>")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if *soongInstalls == "" || *makeInstalls == "" || *outputFile == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	report := generateReport(readInstallsFile(*soongInstalls, ""), readInstallsFile(*makeInstalls, *outDir))
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(*outputFile, append(data, '\n'), 0666); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGenerateReport(t *testing.T) {
+	soong, err := readInstalls(strings.NewReader(`
+target/product/generic/system/bin/foo foo
+target/product/generic/vendor/lib/libbar.so libbar
+host/linux-x86/bin/baz baz
+target/product/generic/system/bin/not_in_product not_in_product
+`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mk, err := readInstalls(strings.NewReader(`
+out/target/product/generic/system/bin/foo
+out/target/product/generic/system/etc/init.rc init.rc
+out/target/product/generic/vendor/lib/libbar.so
+out/target/product/generic/vendor/lib/libqux.so libqux
+out/host/linux-x86/bin/baz
+`), "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := generateReport(soong, mk)
+
+	expectedArtifacts := []Artifact{
+		{Path: "host/linux-x86/bin/baz", Partition: "host", Owner: "soong", Module: "baz"},
+		{Path: "target/product/generic/system/bin/foo", Partition: "system", Owner: "soong", Module: "foo"},
+		{Path: "target/product/generic/system/etc/init.rc", Partition: "system", Owner: "make", Module: "init.rc"},
+		{Path: "target/product/generic/vendor/lib/libbar.so", Partition: "vendor", Owner: "soong", Module: "libbar"},
+		{Path: "target/product/generic/vendor/lib/libqux.so", Partition: "vendor", Owner: "make", Module: "libqux"},
+	}
+	if !reflect.DeepEqual(report.Artifacts, expectedArtifacts) {
+		t.Errorf("expected artifacts:\n  %v\ngot:\n  %v", expectedArtifacts, report.Artifacts)
+	}
+
+	expectedPartitions := []Count{
+		{Partition: "host", Soong: 1},
+		{Partition: "system", Soong: 1, Make: 1},
+		{Partition: "vendor", Soong: 1, Make: 1},
+	}
+	if !reflect.DeepEqual(report.Partitions, expectedPartitions) {
+		t.Errorf("expected partitions %v, got %v", expectedPartitions, report.Partitions)
+	}
+
+	if g, w := report.Total, (Count{Partition: "total", Soong: 3, Make: 2}); g != w {
+		t.Errorf("expected total %v, got %v", w, g)
+	}
+}
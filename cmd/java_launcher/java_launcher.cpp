@@ -0,0 +1,327 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// java_launcher is the native launcher of java_binary modules with native_launcher: true.  Soong
+// creates the launcher of a binary by appending its configuration to a copy of this program: the
+// location of the JDK, the main class, the classpath, the library path and the JVM flags.  The
+// classpath and the library path are relative to the directory of the launcher.  The JDK is
+// relative to the top of the source tree, and the launcher looks for it in the directories above
+// its own, so it doesn't depend on where the source tree or the output directory are, on the
+// environment or on a shell to find java and the jars.  Like the generated wrapper scripts,
+// arguments that start with -J are passed to the JVM.
+//
+// The configuration is a list of "<key> <value>" lines, followed by its length as 16 decimal
+// digits and by kTrailerMagic.
+
+#include <errno.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+#include <string>
+#include <vector>
+
+#ifdef _WIN32
+// windows.h must come first.
+#include <windows.h>
+#include <shellapi.h>
+#else
+#include <limits.h>
+#include <unistd.h>
+#endif
+
+#ifdef __APPLE__
+#include <mach-o/dyld.h>
+#endif
+
+namespace {
+
+const char kTrailerMagic[] = "JLAUNCH1";
+const size_t kLengthDigits = 16;
+const size_t kTrailerSize = kLengthDigits + sizeof(kTrailerMagic) - 1;
+
+#ifdef _WIN32
+const char kPathSeparator = '\\';
+const char kPathListSeparator = ';';
+const char kJava[] = "bin\\java.exe";
+#else
+const char kPathSeparator = '/';
+const char kPathListSeparator = ':';
+const char kJava[] = "bin/java";
+#endif
+
+struct Config {
+  std::string java_home;
+  std::string main_class;
+  std::vector<std::string> classpath;
+  std::vector<std::string> library_path;
+  std::vector<std::string> jvm_flags;
+};
+
+[[noreturn]] void Fatal(const std::string& msg) {
+  fprintf(stderr, "java_launcher: %s\n", msg.c_str());
+  exit(1);
+}
+
+#ifdef _WIN32
+std::wstring ToWide(const std::string& s) {
+  int n = MultiByteToWideChar(CP_UTF8, 0, s.data(), s.size(), nullptr, 0);
+  std::wstring w(n, L'\0');
+  MultiByteToWideChar(CP_UTF8, 0, s.data(), s.size(), &w[0], n);
+  return w;
+}
+
+std::string ToUtf8(const std::wstring& w) {
+  int n = WideCharToMultiByte(CP_UTF8, 0, w.data(), w.size(), nullptr, 0, nullptr, nullptr);
+  std::string s(n, '\0');
+  WideCharToMultiByte(CP_UTF8, 0, w.data(), w.size(), &s[0], n, nullptr, nullptr);
+  return s;
+}
+#endif
+
+// SelfPath returns the path of the running launcher.
+std::string SelfPath() {
+#if defined(_WIN32)
+  std::wstring path(MAX_PATH, L'\0');
+  for (;;) {
+    DWORD n = GetModuleFileNameW(nullptr, &path[0], path.size());
+    if (n == 0) Fatal("cannot find the path of the launcher");
+    if (n < path.size()) {
+      path.resize(n);
+      return ToUtf8(path);
+    }
+    path.resize(path.size() * 2);
+  }
+#elif defined(__APPLE__)
+  uint32_t size = 0;
+  _NSGetExecutablePath(nullptr, &size);
+  std::string path(size, '\0');
+  if (_NSGetExecutablePath(&path[0], &size) != 0) Fatal("cannot find the path of the launcher");
+  char resolved[PATH_MAX];
+  if (realpath(path.c_str(), resolved) == nullptr) Fatal("cannot resolve " + path);
+  return resolved;
+#else
+  char resolved[PATH_MAX];
+  if (realpath("/proc/self/exe", resolved) == nullptr) Fatal("cannot find the path of the launcher");
+  return resolved;
+#endif
+}
+
+FILE* OpenFile(const std::string& path) {
+#ifdef _WIN32
+  return _wfopen(ToWide(path).c_str(), L"rb");
+#else
+  return fopen(path.c_str(), "rb");
+#endif
+}
+
+// ReadConfig reads the configuration appended to the launcher at path.
+Config ReadConfig(const std::string& path) {
+  FILE* f = OpenFile(path);
+  if (f == nullptr) Fatal("cannot open " + path);
+
+  char trailer[kTrailerSize];
+  if (fseek(f, -static_cast<long>(kTrailerSize), SEEK_END) != 0 ||
+      fread(trailer, 1, kTrailerSize, f) != kTrailerSize ||
+      memcmp(trailer + kLengthDigits, kTrailerMagic, kTrailerSize - kLengthDigits) != 0) {
+    Fatal(path + " has no launcher configuration");
+  }
+  long length = strtol(std::string(trailer, kLengthDigits).c_str(), nullptr, 10);
+  if (length <= 0 || fseek(f, -static_cast<long>(kTrailerSize) - length, SEEK_END) != 0) {
+    Fatal(path + " has a corrupt launcher configuration");
+  }
+  std::string data(length, '\0');
+  if (fread(&data[0], 1, length, f) != static_cast<size_t>(length)) {
+    Fatal(path + " has a corrupt launcher configuration");
+  }
+  fclose(f);
+
+  Config config;
+  size_t pos = 0;
+  while (pos < data.size()) {
+    size_t end = data.find('\n', pos);
+    if (end == std::string::npos) end = data.size();
+    std::string line = data.substr(pos, end - pos);
+    pos = end + 1;
+
+    size_t space = line.find(' ');
+    std::string key = line.substr(0, space);
+    std::string value = space == std::string::npos ? "" : line.substr(space + 1);
+    if (key == "java_home") {
+      config.java_home = value;
+    } else if (key == "main_class") {
+      config.main_class = value;
+    } else if (key == "classpath") {
+      config.classpath.push_back(value);
+    } else if (key == "library_path") {
+      config.library_path.push_back(value);
+    } else if (key == "jvm_flag") {
+      config.jvm_flags.push_back(value);
+    } else if (!key.empty()) {
+      Fatal(path + " has an unknown launcher configuration key " + key);
+    }
+  }
+  if (config.java_home.empty() || config.main_class.empty() || config.classpath.empty()) {
+    Fatal(path + " has an incomplete launcher configuration");
+  }
+  return config;
+}
+
+// ToNative returns path, which uses / as separator, with the separator of the host.
+std::string ToNative(std::string path) {
+  for (char& c : path) {
+    if (c == '/') c = kPathSeparator;
+  }
+  return path;
+}
+
+// Resolve returns the path rel, which uses / as separator, relative to dir.
+std::string Resolve(const std::string& dir, const std::string& rel) {
+  return dir + kPathSeparator + ToNative(rel);
+}
+
+bool IsAbsolute(const std::string& path) {
+#ifdef _WIN32
+  return (path.size() > 1 && path[1] == ':') || path.compare(0, 1, "/") == 0;
+#else
+  return path.compare(0, 1, "/") == 0;
+#endif
+}
+
+bool IsExecutable(const std::string& path) {
+#ifdef _WIN32
+  DWORD attrs = GetFileAttributesW(ToWide(path).c_str());
+  return attrs != INVALID_FILE_ATTRIBUTES && !(attrs & FILE_ATTRIBUTE_DIRECTORY);
+#else
+  return access(path.c_str(), X_OK) == 0;
+#endif
+}
+
+// FindJavaHome returns the JDK at java_home, which is relative to the top of the source tree, by
+// looking for it in dir and in the directories above it.  The launcher is installed to the output
+// directory, which is usually in the source tree, or it is packaged together with the JDK.
+std::string FindJavaHome(const std::string& java_home, std::string dir) {
+  if (IsAbsolute(java_home)) return ToNative(java_home);
+  for (;;) {
+    std::string home = Resolve(dir, java_home);
+    if (IsExecutable(Resolve(home, kJava))) return home;
+    size_t sep = dir.find_last_of(kPathSeparator);
+    if (dir.empty() || sep == std::string::npos) break;
+    dir = dir.substr(0, sep);
+  }
+  Fatal("cannot find " + ToNative(java_home) + " in the directories above the launcher");
+}
+
+std::string ResolveList(const std::string& dir, const std::vector<std::string>& paths) {
+  std::string list;
+  for (const std::string& path : paths) {
+    if (!list.empty()) list += kPathListSeparator;
+    list += Resolve(dir, path);
+  }
+  return list;
+}
+
+// JavaCommand returns the command line that runs the main class of the launcher in dir with args.
+std::vector<std::string> JavaCommand(const Config& config, const std::string& dir,
+                                     const std::vector<std::string>& args) {
+  std::vector<std::string> cmd;
+  cmd.push_back(Resolve(FindJavaHome(config.java_home, dir), kJava));
+  cmd.insert(cmd.end(), config.jvm_flags.begin(), config.jvm_flags.end());
+  if (!config.library_path.empty()) {
+    cmd.push_back("-Djava.library.path=" + ResolveList(dir, config.library_path));
+  }
+  size_t i = 0;
+  for (; i < args.size() && args[i].compare(0, 2, "-J") == 0; i++) {
+    size_t opt = args[i].compare(0, 3, "-J-") == 0 ? 3 : 2;
+    cmd.push_back("-" + args[i].substr(opt));
+  }
+  cmd.push_back("-cp");
+  cmd.push_back(ResolveList(dir, config.classpath));
+  cmd.push_back(config.main_class);
+  cmd.insert(cmd.end(), args.begin() + i, args.end());
+  return cmd;
+}
+
+#ifdef _WIN32
+// QuoteArg quotes an argument for CommandLineToArgvW and the C runtime.
+std::wstring QuoteArg(const std::wstring& arg) {
+  if (!arg.empty() && arg.find_first_of(L" \t\n\v\"") == std::wstring::npos) return arg;
+  std::wstring quoted = L"\"";
+  size_t backslashes = 0;
+  for (wchar_t c : arg) {
+    if (c == L'\\') {
+      backslashes++;
+      continue;
+    }
+    quoted.append(c == L'"' ? backslashes * 2 + 1 : backslashes, L'\\');
+    backslashes = 0;
+    quoted += c;
+  }
+  quoted.append(backslashes * 2, L'\\');
+  return quoted + L"\"";
+}
+
+int Run(const std::vector<std::string>& cmd) {
+  std::wstring cmdline;
+  for (const std::string& arg : cmd) {
+    if (!cmdline.empty()) cmdline += L' ';
+    cmdline += QuoteArg(ToWide(arg));
+  }
+
+  STARTUPINFOW si = {};
+  si.cb = sizeof(si);
+  PROCESS_INFORMATION pi = {};
+  if (!CreateProcessW(ToWide(cmd[0]).c_str(), &cmdline[0], nullptr, nullptr, TRUE, 0, nullptr,
+                      nullptr, &si, &pi)) {
+    Fatal("cannot run " + cmd[0]);
+  }
+  WaitForSingleObject(pi.hProcess, INFINITE);
+  DWORD code = 1;
+  GetExitCodeProcess(pi.hProcess, &code);
+  CloseHandle(pi.hThread);
+  CloseHandle(pi.hProcess);
+  return code;
+}
+#else
+int Run(const std::vector<std::string>& cmd) {
+  std::vector<char*> args;
+  for (const std::string& arg : cmd) {
+    args.push_back(const_cast<char*>(arg.c_str()));
+  }
+  args.push_back(nullptr);
+  execv(args[0], args.data());
+  Fatal("cannot run " + cmd[0] + ": " + strerror(errno));
+}
+#endif
+
+}  // namespace
+
+int main(int argc, char** argv) {
+  std::vector<std::string> args;
+#ifdef _WIN32
+  // argv uses the ANSI code page, get the arguments in UTF-8 instead.
+  wchar_t** wargv = CommandLineToArgvW(GetCommandLineW(), &argc);
+  for (int i = 1; i < argc; i++) {
+    args.push_back(ToUtf8(wargv[i]));
+  }
+  LocalFree(wargv);
+#else
+  args.assign(argv + 1, argv + argc);
+#endif
+
+  std::string self = SelfPath();
+  Config config = ReadConfig(self);
+  std::string dir = self.substr(0, self.find_last_of(kPathSeparator));
+  return Run(JavaCommand(config, dir, args));
+}
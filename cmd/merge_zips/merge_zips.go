@@ -25,6 +25,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 
 	"github.com/google/blueprint/pathtools"
 
@@ -290,6 +291,11 @@ func (oz *OutputZip) copyEntry(inputZip InputZip, index int) error {
 			entry.name, existingEntry, entry)
 	}
 
+	if oz.emulateJar && isServiceProviderFile(entry.name) &&
+		(existingEntry.CRC32() != entry.CRC32() || existingEntry.Size() != entry.Size()) {
+		return oz.mergeServiceProviderFiles(entry.name, existingEntry, entry)
+	}
+
 	if oz.ignoreDuplicates ||
 		// Skip manifest and module info files that are not from the first input file
 		(oz.emulateJar && entry.name == jar.ManifestFile || entry.name == jar.ModuleInfoClass) ||
@@ -303,6 +309,69 @@ func (oz *OutputZip) copyEntry(inputZip InputZip, index int) error {
 	return fmt.Errorf("Duplicate path %v found in %v and %v\n", entry.name, existingEntry, inputZip.Name())
 }
 
+// Returns true if the given entry is a service provider configuration file used by ServiceLoader.
+func isServiceProviderFile(name string) bool {
+	provider := strings.TrimPrefix(name, jar.ServicesDir)
+	return provider != name && provider != "" && !strings.Contains(provider, "/")
+}
+
+// Replaces a service provider configuration file with one that also lists the providers from a
+// duplicate entry, so that the providers registered by all the input jars can be loaded instead of
+// only the ones from the first jar.  Entries are only written once all the inputs have been merged
+// when emulating jar, so the existing entry can still be replaced.
+func (oz *OutputZip) mergeServiceProviderFiles(name string, existingEntry, entry ZipEntryContents) error {
+	fh, merged, err := readZipEntry(existingEntry)
+	if err != nil {
+		return err
+	}
+	_, contents, err := readZipEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	providers := make(map[string]bool)
+	for _, line := range strings.Split(string(merged), "\n") {
+		providers[strings.TrimSpace(line)] = true
+	}
+	if len(merged) > 0 && merged[len(merged)-1] != '\n' {
+		merged = append(merged, '\n')
+	}
+	for _, line := range strings.Split(string(contents), "\n") {
+		if provider := strings.TrimSpace(line); provider != "" && !providers[provider] {
+			providers[provider] = true
+			merged = append(merged, provider+"\n"...)
+		}
+	}
+
+	fh.UncompressedSize64 = uint64(len(merged))
+	oz.sourceByDest[name] = ZipEntryFromBuffer{fh, merged}
+	return nil
+}
+
+// Returns a copy of the file header and the contents of an entry.
+func readZipEntry(source ZipEntryContents) (*zip.FileHeader, []byte, error) {
+	switch source := source.(type) {
+	case ZipEntryFromBuffer:
+		fh := *source.fh
+		return &fh, append([]byte(nil), source.content...), nil
+	case *ZipEntryFromZip:
+		if err := source.inputZip.Open(); err != nil {
+			return nil, nil, err
+		}
+		f := source.inputZip.Entries()[source.index]
+		r, err := f.Open()
+		if err != nil {
+			return nil, nil, err
+		}
+		defer r.Close()
+		contents, err := ioutil.ReadAll(r)
+		fh := f.FileHeader
+		return &fh, contents, err
+	default:
+		return nil, nil, fmt.Errorf("cannot read the contents of %v", source)
+	}
+}
+
 func (oz *OutputZip) entriesArray() []string {
 	entries := make([]string, len(oz.sourceByDest))
 	i := 0
@@ -49,6 +49,13 @@ var (
 	manifestFile   = testZipEntry{jar.ManifestFile, 0755, []byte("manifest")}
 	manifestFile2  = testZipEntry{jar.ManifestFile, 0755, []byte("manifest2")}
 	moduleInfoFile = testZipEntry{jar.ModuleInfoClass, 0755, []byte("module-info")}
+
+	servicesDir     = testZipEntry{jar.ServicesDir, os.ModeDir | 0755, nil}
+	serviceFoo      = testZipEntry{jar.ServicesDir + "com.example.Service", 0755, []byte("com.example.Foo\n")}
+	serviceBar      = testZipEntry{jar.ServicesDir + "com.example.Service", 0755, []byte("com.example.Bar")}
+	serviceFooBar   = testZipEntry{jar.ServicesDir + "com.example.Service", 0755, []byte("com.example.Foo\ncom.example.Bar\n")}
+	serviceBarFoo   = testZipEntry{jar.ServicesDir + "com.example.Service", 0755, []byte("com.example.Bar\ncom.example.Foo\n")}
+	otherServiceFoo = testZipEntry{jar.ServicesDir + "com.example.OtherService", 0755, []byte("com.example.Foo\n")}
 )
 
 type testInputZip struct {
@@ -157,6 +164,28 @@ func TestMergeZips(t *testing.T) {
 
 			jar: true,
 		},
+		{
+			name: "jar merge services",
+			in: [][]testZipEntry{
+				{metainfDir, servicesDir, serviceFoo, otherServiceFoo},
+				{metainfDir, servicesDir, serviceBar},
+				{metainfDir, servicesDir, serviceFoo},
+			},
+			out: []testZipEntry{metainfDir, servicesDir, otherServiceFoo, serviceFooBar},
+
+			jar:              true,
+			ignoreDuplicates: true,
+		},
+		{
+			name: "jar merge services without trailing newline",
+			in: [][]testZipEntry{
+				{metainfDir, servicesDir, serviceBar},
+				{metainfDir, servicesDir, serviceFoo},
+			},
+			out: []testZipEntry{metainfDir, servicesDir, serviceBarFoo},
+
+			jar: true,
+		},
 		{
 			name: "merge",
 			in: [][]testZipEntry{
@@ -151,7 +151,8 @@ func main() {
 	stdio := terminal.StdioImpl{}
 
 	output := terminal.NewStatusOutput(stdio.Stdout(), "", false,
-		build.OsEnvironment().IsEnvTrue("ANDROID_QUIET_BUILD"))
+		build.OsEnvironment().IsEnvTrue("ANDROID_QUIET_BUILD"),
+		build.OsEnvironment().IsEnvTrue("ANDROID_SHOW_COMMANDS"))
 
 	log := logger.New(output)
 	defer log.Cleanup()
@@ -410,7 +411,8 @@ func buildProduct(mpctx *mpContext, product string) {
 		Status:  &status.Status{},
 	}}
 	ctx.Status.AddOutput(terminal.NewStatusOutput(ctx.Writer, "", false,
-		build.OsEnvironment().IsEnvTrue("ANDROID_QUIET_BUILD")))
+		build.OsEnvironment().IsEnvTrue("ANDROID_QUIET_BUILD"),
+		build.OsEnvironment().IsEnvTrue("ANDROID_SHOW_COMMANDS")))
 
 	config := build.NewConfig(ctx, flag.Args()...)
 	config.Environment().Set("OUT_DIR", outDir)
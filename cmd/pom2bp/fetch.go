@@ -0,0 +1,255 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Coordinates is a list of maven coordinates in the form <groupId>:<artifactId>:<version>.
+type Coordinates []string
+
+func (c *Coordinates) String() string {
+	return strings.Join(*c, ",")
+}
+
+func (c *Coordinates) Set(v string) error {
+	if _, err := parseCoordinate(v); err != nil {
+		return err
+	}
+	*c = append(*c, v)
+	return nil
+}
+
+type coordinate struct {
+	groupId, artifactId, version string
+}
+
+func parseCoordinate(s string) (coordinate, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return coordinate{}, fmt.Errorf("invalid maven coordinate %q, expected <groupId>:<artifactId>:<version>", s)
+	}
+	return coordinate{parts[0], parts[1], parts[2]}, nil
+}
+
+func (c coordinate) String() string {
+	return c.groupId + ":" + c.artifactId + ":" + c.version
+}
+
+// dir returns the directory of the artifact in the maven repository layout.
+func (c coordinate) dir() string {
+	return path.Join(strings.Replace(c.groupId, ".", "/", -1), c.artifactId, c.version)
+}
+
+// file returns the path of the file of the artifact with the given extension in the maven repository
+// layout.
+func (c coordinate) file(ext string) string {
+	return path.Join(c.dir(), c.artifactId+"-"+c.version+"."+ext)
+}
+
+// artifactUrl returns the url that the artifact of a pom file is downloaded from in a maven repository.
+func artifactUrl(repo string, pom *Pom) string {
+	c := coordinate{pom.GroupId, pom.ArtifactId, pom.Version}
+	return strings.TrimSuffix(repo, "/") + "/" + c.file(pom.Packaging)
+}
+
+// fetchArtifacts downloads the pom files and the artifacts of the given maven coordinates and of
+// their transitive compile and runtime dependencies from a maven repository into dir, using the
+// maven repository layout.  The other versions of the downloaded artifacts are removed from dir.
+// It returns the downloaded artifacts, in the order they were downloaded.
+func fetchArtifacts(repo, dir string, coordinates []string) ([]lockedArtifact, error) {
+	var queue []coordinate
+	for _, s := range coordinates {
+		c, err := parseCoordinate(s)
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, c)
+	}
+
+	var locked []lockedArtifact
+
+	// The versions of the requested artifacts take precedence over the versions that the
+	// dependencies ask for.
+	fetched := make(map[string]bool)
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+
+		key := c.groupId + ":" + c.artifactId
+		if fetched[key] || excludes[rewriteNames.MavenToBp(c.groupId, c.artifactId)] {
+			continue
+		}
+		fetched[key] = true
+
+		pom, err := fetchArtifact(repo, dir, c)
+		if err != nil {
+			return nil, err
+		}
+
+		artifact, err := lockArtifact(dir, c, pom.Packaging)
+		if err != nil {
+			return nil, err
+		}
+		locked = append(locked, artifact)
+
+		for _, d := range pom.Dependencies {
+			if d.Scope != "" && d.Scope != "compile" && d.Scope != "runtime" {
+				continue
+			}
+			version, err := resolveVersion(d)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", c, err)
+			}
+			queue = append(queue, coordinate{d.GroupId, d.ArtifactId, version})
+		}
+	}
+
+	return locked, nil
+}
+
+// fetchArtifact downloads the pom file and the artifact of a maven coordinate and returns the parsed
+// pom file.
+func fetchArtifact(repo, dir string, c coordinate) (*Pom, error) {
+	repo = strings.TrimSuffix(repo, "/")
+
+	if err := removeOtherVersions(dir, c); err != nil {
+		return nil, err
+	}
+
+	pomFile := filepath.Join(dir, filepath.FromSlash(c.file("pom")))
+	if err := download(repo+"/"+c.file("pom"), pomFile); err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(pomFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var pom Pom
+	if err := xml.Unmarshal(data, &pom); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %s", pomFile, err)
+	}
+	if pom.Packaging == "" {
+		pom.Packaging = "jar"
+	}
+
+	artifactFile := filepath.Join(dir, filepath.FromSlash(c.file(pom.Packaging)))
+	if err := download(repo+"/"+c.file(pom.Packaging), artifactFile); err != nil {
+		return nil, err
+	}
+
+	return &pom, nil
+}
+
+// removeOtherVersions removes the other versions of an artifact from dir, each artifact can only be
+// defined once in the Android.bp file.
+func removeOtherVersions(dir string, c coordinate) error {
+	versionsDir := filepath.Join(dir, filepath.FromSlash(path.Dir(c.dir())))
+	versions, err := ioutil.ReadDir(versionsDir)
+	if err != nil {
+		return nil
+	}
+	for _, version := range versions {
+		if version.IsDir() && version.Name() != c.version {
+			if err := os.RemoveAll(filepath.Join(versionsDir, version.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolveVersion returns the version of a dependency in a pom file.  Only the dependencies that
+// specify a single version are supported.
+func resolveVersion(d *Dependency) (string, error) {
+	version := d.Version
+	// The artifacts in the Google maven repository use ranges with a single version, e.g. [1.0.0].
+	if strings.HasPrefix(version, "[") && strings.HasSuffix(version, "]") {
+		version = strings.TrimSuffix(strings.TrimPrefix(version, "["), "]")
+	}
+	if version == "" || strings.ContainsAny(version, "$[](),") {
+		return "", fmt.Errorf("unsupported version %q of dependency %s:%s", d.Version, d.GroupId, d.ArtifactId)
+	}
+	return version, nil
+}
+
+// The client used for downloads, which also supports file:// urls so that the artifacts can be
+// fetched from an offline mirror of the maven repository.
+var client = func() *http.Client {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+	return &http.Client{Transport: t}
+}()
+
+func download(url, file string) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+		return err
+	}
+
+	// Write to a temporary file so that an interrupted download doesn't leave a partial file behind.
+	tmp := file + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, resp.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to download %s: %s", url, err)
+	}
+
+	return os.Rename(tmp, file)
+}
+
+// sha256File returns the hex encoded sha256 hash of the contents of a file.
+func sha256File(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
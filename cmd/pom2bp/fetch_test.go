@@ -0,0 +1,166 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const fooPom = `<?xml version="1.0" encoding="UTF-8"?>
+<project xmlns="http://maven.apache.org/POM/4.0.0">
+  <groupId>com.example</groupId>
+  <artifactId>foo</artifactId>
+  <version>1.0</version>
+  <packaging>aar</packaging>
+  <dependencies>
+    <dependency>
+      <groupId>com.example</groupId>
+      <artifactId>bar</artifactId>
+      <version>[2.0]</version>
+    </dependency>
+    <dependency>
+      <groupId>com.example</groupId>
+      <artifactId>baz</artifactId>
+      <version>3.0</version>
+      <scope>test</scope>
+    </dependency>
+  </dependencies>
+</project>
+`
+
+const barPom = `<?xml version="1.0" encoding="UTF-8"?>
+<project xmlns="http://maven.apache.org/POM/4.0.0">
+  <groupId>com.example</groupId>
+  <artifactId>bar</artifactId>
+  <version>2.0</version>
+</project>
+`
+
+func TestFetchArtifacts(t *testing.T) {
+	files := map[string]string{
+		"/com/example/foo/1.0/foo-1.0.pom": fooPom,
+		"/com/example/foo/1.0/foo-1.0.aar": "foo aar",
+		"/com/example/bar/2.0/bar-2.0.pom": barPom,
+		"/com/example/bar/2.0/bar-2.0.jar": "bar jar",
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if content, ok := files[r.URL.Path]; ok {
+			w.Write([]byte(content))
+		} else {
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "pom2bp_fetch_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// An older version of bar that should be replaced.
+	oldBar := filepath.Join(dir, "com/example/bar/1.0/bar-1.0.pom")
+	if err := os.MkdirAll(filepath.Dir(oldBar), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(oldBar, []byte(barPom), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	locked, err := fetchArtifacts(server.URL+"/", dir, []string{"com.example:foo:1.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			got = append(got, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+
+	expected := []string{
+		"com/example/bar/2.0/bar-2.0.jar",
+		"com/example/bar/2.0/bar-2.0.pom",
+		"com/example/foo/1.0/foo-1.0.aar",
+		"com/example/foo/1.0/foo-1.0.pom",
+	}
+
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected files:\n  %s\ngot:\n  %s", strings.Join(expected, "\n  "), strings.Join(got, "\n  "))
+	}
+
+	var lockedCoordinates []string
+	for _, a := range locked {
+		lockedCoordinates = append(lockedCoordinates, a.coordinate.String()+"@"+a.packaging)
+	}
+	if g, w := strings.Join(lockedCoordinates, " "), "com.example:foo:1.0@aar com.example:bar:2.0@jar"; g != w {
+		t.Errorf("expected locked artifacts %q, got %q", w, g)
+	}
+
+	_, err = fetchArtifacts(server.URL, dir, []string{"com.example:missing:1.0"})
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected a 404 error for a missing artifact, got %v", err)
+	}
+}
+
+func TestResolveVersion(t *testing.T) {
+	testCases := []struct {
+		version  string
+		expected string
+		err      bool
+	}{
+		{version: "1.0", expected: "1.0"},
+		{version: "[1.0]", expected: "1.0"},
+		{version: "[1.0,2.0)", err: true},
+		{version: "${project.version}", err: true},
+		{version: "", err: true},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.version, func(t *testing.T) {
+			version, err := resolveVersion(&Dependency{GroupId: "g", ArtifactId: "a", Version: test.version})
+			if test.err {
+				if err == nil {
+					t.Errorf("expected error, got version %q", version)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %s", err)
+			} else if version != test.expected {
+				t.Errorf("expected version %q, got %q", test.expected, version)
+			}
+		})
+	}
+}
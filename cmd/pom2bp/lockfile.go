@@ -0,0 +1,132 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A lockfile lists the maven artifacts that are checked into a prebuilts directory, one per line:
+//   <groupId>:<artifactId>:<version> <packaging> <sha256 of the artifact> <sha256 of the pom file>
+// Empty lines and lines starting with # are ignored.
+
+const lockfileHeader = `# Maven artifacts used by the Android.bp file generated by pom2bp.  Update this file with pom2bp -fetch.
+# <groupId>:<artifactId>:<version> <packaging> <artifact sha256> <pom sha256>
+`
+
+type lockedArtifact struct {
+	coordinate
+	packaging                 string
+	artifactSha256, pomSha256 string
+}
+
+func (a lockedArtifact) String() string {
+	return fmt.Sprintf("%s %s %s %s", a.coordinate, a.packaging, a.artifactSha256, a.pomSha256)
+}
+
+// lockArtifact returns the lockfile entry of an artifact that has been downloaded into dir.
+func lockArtifact(dir string, c coordinate, packaging string) (lockedArtifact, error) {
+	artifactSha256, err := sha256File(filepath.Join(dir, filepath.FromSlash(c.file(packaging))))
+	if err != nil {
+		return lockedArtifact{}, err
+	}
+	pomSha256, err := sha256File(filepath.Join(dir, filepath.FromSlash(c.file("pom"))))
+	if err != nil {
+		return lockedArtifact{}, err
+	}
+	return lockedArtifact{c, packaging, artifactSha256, pomSha256}, nil
+}
+
+func readLockfile(file string) ([]lockedArtifact, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var artifacts []lockedArtifact
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("%s:%d: expected <groupId>:<artifactId>:<version> <packaging> <artifact sha256> <pom sha256>",
+				file, lineNum)
+		}
+		c, err := parseCoordinate(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", file, lineNum, err)
+		}
+		artifacts = append(artifacts, lockedArtifact{c, fields[1], fields[2], fields[3]})
+	}
+
+	return artifacts, scanner.Err()
+}
+
+func writeLockfile(file string, artifacts []lockedArtifact) error {
+	var b strings.Builder
+	b.WriteString(lockfileHeader)
+	for _, a := range artifacts {
+		fmt.Fprintln(&b, a)
+	}
+	return ioutil.WriteFile(file, []byte(b.String()), 0666)
+}
+
+// syncLockfile makes the contents of dir match the artifacts in a lockfile.  The artifacts and pom
+// files that are missing from dir or don't match their sha256 are downloaded from the maven
+// repository, which can be an offline mirror, and the other versions of the artifacts are removed.
+func syncLockfile(repo, dir string, artifacts []lockedArtifact) error {
+	repo = strings.TrimSuffix(repo, "/")
+
+	for _, a := range artifacts {
+		if err := removeOtherVersions(dir, a.coordinate); err != nil {
+			return err
+		}
+
+		for _, f := range []struct{ ext, sha256 string }{
+			{"pom", a.pomSha256},
+			{a.packaging, a.artifactSha256},
+		} {
+			file := filepath.Join(dir, filepath.FromSlash(a.file(f.ext)))
+			if sha256, err := sha256File(file); err == nil && sha256 == f.sha256 {
+				continue
+			}
+
+			if err := download(repo+"/"+a.file(f.ext), file); err != nil {
+				return err
+			}
+
+			sha256, err := sha256File(file)
+			if err != nil {
+				return err
+			}
+			if sha256 != f.sha256 {
+				os.Remove(file)
+				return fmt.Errorf("sha256 of %s is %s, the lockfile expects %s", a.file(f.ext), sha256, f.sha256)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func sha256String(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for file, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLockfile(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "pom2bp_lockfile_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	mirror := filepath.Join(tmp, "mirror")
+	writeFiles(t, mirror, map[string]string{
+		"com/example/bar/2.0/bar-2.0.pom": barPom,
+		"com/example/bar/2.0/bar-2.0.jar": "bar jar",
+		"com/example/foo/1.0/foo-1.0.pom": fooPom,
+		"com/example/foo/1.0/foo-1.0.aar": "modified foo aar",
+	})
+
+	expected := []lockedArtifact{
+		{coordinate{"com.example", "bar", "2.0"}, "jar", sha256String("bar jar"), sha256String(barPom)},
+		{coordinate{"com.example", "foo", "1.0"}, "aar", sha256String("foo aar"), sha256String(fooPom)},
+	}
+
+	lockfile := filepath.Join(tmp, "maven.lock")
+	if err := writeLockfile(lockfile, expected); err != nil {
+		t.Fatal(err)
+	}
+	locked, err := readLockfile(lockfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(locked, expected) {
+		t.Errorf("expected locked artifacts:\n  %v\ngot:\n  %v", expected, locked)
+	}
+
+	// The matching foo aar is already checked in, bar is fetched from the mirror and the older
+	// version of bar is removed.
+	dir := filepath.Join(tmp, "prebuilts")
+	writeFiles(t, dir, map[string]string{
+		"com/example/foo/1.0/foo-1.0.pom": fooPom,
+		"com/example/foo/1.0/foo-1.0.aar": "foo aar",
+		"com/example/bar/1.0/bar-1.0.pom": barPom,
+	})
+
+	if err := syncLockfile("file://"+mirror, dir, locked); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []string{"com/example/bar/2.0/bar-2.0.jar", "com/example/bar/2.0/bar-2.0.pom"} {
+		if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+			t.Errorf("expected %s to be fetched: %s", file, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "com/example/bar/1.0")); !os.IsNotExist(err) {
+		t.Errorf("expected the older version of bar to be removed")
+	}
+
+	// An artifact that doesn't match the lockfile is fetched again, and the fetched one must match
+	// the lockfile too.
+	writeFiles(t, dir, map[string]string{
+		"com/example/foo/1.0/foo-1.0.aar": "corrupt foo aar",
+	})
+	err = syncLockfile("file://"+mirror, dir, locked)
+	if err == nil || !strings.Contains(err.Error(), "the lockfile expects "+sha256String("foo aar")) {
+		t.Errorf("expected a sha256 mismatch error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "com/example/foo/1.0/foo-1.0.aar")); !os.IsNotExist(err) {
+		t.Errorf("expected the mismatched foo aar to be removed")
+	}
+}
+
+func TestReadLockfileErrors(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "pom2bp_lockfile_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	lockfile := filepath.Join(tmp, "maven.lock")
+	writeFiles(t, tmp, map[string]string{
+		"maven.lock": "# comment\n\ncom.example:foo jar 0123 4567\n",
+	})
+
+	_, err = readLockfile(lockfile)
+	if err == nil || !strings.Contains(err.Error(), "maven.lock:3: invalid maven coordinate") {
+		t.Errorf("expected an invalid coordinate error, got %v", err)
+	}
+}
@@ -147,6 +147,9 @@ var sdkVersion string
 var useVersion string
 var staticDeps bool
 var jetifier bool
+var mavenRepo string
+var fetches = Coordinates{}
+var lockfile string
 
 func InList(s string, list []string) bool {
 	for _, l := range list {
@@ -185,6 +188,10 @@ type Pom struct {
 	BpTarget      string `xml:"-"`
 	MinSdkVersion string `xml:"-"`
 
+	// The origin of the artifact, recorded in the Android.bp file.
+	ArtifactSha256 string `xml:"-"`
+	ArtifactUrl    string `xml:"-"`
+
 	GroupId    string `xml:"groupId"`
 	ArtifactId string `xml:"artifactId"`
 	Version    string `xml:"version"`
@@ -360,6 +367,11 @@ func (p *Pom) ExtractMinSdkVersion() error {
 }
 
 var bpTemplate = template.Must(template.New("bp").Parse(`
+// {{.GroupId}}:{{.ArtifactId}}:{{.Version}}
+{{- if .ArtifactUrl}}
+// url: {{.ArtifactUrl}}
+{{- end}}
+// sha256: {{.ArtifactSha256}}
 {{.ImportModuleType}} {
     name: "{{.BpName}}",
     {{.ImportProperty}}: ["{{.ArtifactFile}}"],
@@ -401,6 +413,11 @@ var bpTemplate = template.Must(template.New("bp").Parse(`
 `))
 
 var bpDepsTemplate = template.Must(template.New("bp").Parse(`
+// {{.GroupId}}:{{.ArtifactId}}:{{.Version}}
+{{- if .ArtifactUrl}}
+// url: {{.ArtifactUrl}}
+{{- end}}
+// sha256: {{.ArtifactSha256}}
 {{.ImportModuleType}} {
     name: "{{.BpName}}-nodeps",
     {{.ImportProperty}}: ["{{.ArtifactFile}}"],
@@ -543,6 +560,25 @@ func rerunForRegen(filename string) error {
 	lastArg := args[len(args)-1]
 	args = args[:len(args)-1]
 
+	// When new artifacts are fetched they replace the ones that were fetched before
+	fetching := false
+	for _, arg := range os.Args[1:] {
+		if arg == "-fetch" || arg == "--fetch" {
+			fetching = true
+		}
+	}
+	if fetching {
+		var oldArgs []string
+		for i := 0; i < len(args); i++ {
+			if args[i] == "-fetch" || args[i] == "--fetch" {
+				i++
+			} else {
+				oldArgs = append(oldArgs, args[i])
+			}
+		}
+		args = oldArgs
+	}
+
 	// Append all current command line args except -regen <file> to the ones from the file
 	for i := 1; i < len(os.Args); i++ {
 		if os.Args[i] == "-regen" || os.Args[i] == "--regen" {
@@ -578,7 +614,7 @@ func main() {
 The tool will extract the necessary information from *.pom files to create an Android.bp whose
 aar libraries can be linked against when using AAPT2.
 
-Usage: %s [--rewrite <regex>=<replace>] [-exclude <module>] [--extra-static-libs <module>=<module>[,<module>]] [--extra-libs <module>=<module>[,<module>]] [<dir>] [-regen <file>]
+Usage: %s [--rewrite <regex>=<replace>] [-exclude <module>] [--extra-static-libs <module>=<module>[,<module>]] [--extra-libs <module>=<module>[,<module>]] [-maven-repo <url> [-fetch <groupId>:<artifactId>:<version>] [-lockfile <file>]] [<dir>] [-regen <file>]
 
   -rewrite <regex>=<replace>
      rewrite can be used to specify mappings between Maven projects and Android.bp modules. The -rewrite
@@ -603,6 +639,20 @@ Usage: %s [--rewrite <regex>=<replace>] [-exclude <module>] [--extra-static-libs
      -use-version can be used to only write Android.bp files for a specific version of those artifacts.
   -jetifier
      Sets jetifier: true for all modules.
+  -maven-repo <url>
+     The url of the maven repository that the artifacts are fetched from.  It is recorded for each
+     module in the Android.bp file.
+  -fetch <groupId>:<artifactId>:<version>
+     Downloads the artifact and its transitive compile and runtime dependencies from the maven repository
+     into <dir> before creating the Android.bp file, and removes the other versions of the downloaded
+     artifacts from <dir>.  This may be specified multiple times.  When used with -regen the artifacts
+     replace the ones fetched by the previous run.
+  -lockfile <file>
+     A checked in list of the maven coordinates and the sha256 of the artifacts in <dir>.  With
+     -fetch the lockfile is written with the downloaded artifacts.  Without -fetch the artifacts
+     and pom files in the lockfile that are missing from <dir> or that don't match their sha256 are
+     downloaded from the maven repository, which may be an offline mirror with a file:// url.  The
+     downloaded files must match the sha256 in the lockfile.
   <dir>
      The directory to search for *.pom files under.
      The contents are written to stdout, to be put in the current directory (often as Android.bp)
@@ -625,6 +675,9 @@ Usage: %s [--rewrite <regex>=<replace>] [-exclude <module>] [--extra-static-libs
 	flag.StringVar(&useVersion, "use-version", "", "Only read artifacts of a specific version")
 	flag.BoolVar(&staticDeps, "static-deps", false, "Statically include direct dependencies")
 	flag.BoolVar(&jetifier, "jetifier", false, "Sets jetifier: true on all modules")
+	flag.StringVar(&mavenRepo, "maven-repo", "", "The url of the maven repository of the artifacts")
+	flag.Var(&fetches, "fetch", "Download the artifact with the maven coordinate and its dependencies")
+	flag.StringVar(&lockfile, "lockfile", "", "The list of the locked maven artifacts in the directory")
 	flag.StringVar(&regen, "regen", "", "Rewrite specified file")
 	flag.Parse()
 
@@ -652,6 +705,38 @@ Usage: %s [--rewrite <regex>=<replace>] [-exclude <module>] [--extra-static-libs
 		os.Exit(1)
 	}
 
+	if len(fetches) > 0 {
+		if mavenRepo == "" {
+			fmt.Fprintln(os.Stderr, "-fetch requires -maven-repo")
+			os.Exit(1)
+		}
+		locked, err := fetchArtifacts(mavenRepo, absDir, fetches)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error fetching artifacts:", err)
+			os.Exit(1)
+		}
+		if lockfile != "" {
+			if err := writeLockfile(lockfile, locked); err != nil {
+				fmt.Fprintln(os.Stderr, "Error writing lockfile:", err)
+				os.Exit(1)
+			}
+		}
+	} else if lockfile != "" {
+		if mavenRepo == "" {
+			fmt.Fprintln(os.Stderr, "-lockfile requires -maven-repo")
+			os.Exit(1)
+		}
+		locked, err := readLockfile(lockfile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error reading lockfile:", err)
+			os.Exit(1)
+		}
+		if err := syncLockfile(mavenRepo, absDir, locked); err != nil {
+			fmt.Fprintln(os.Stderr, "Error fetching locked artifacts:", err)
+			os.Exit(1)
+		}
+	}
+
 	var filenames []string
 	err = filepath.Walk(absDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -729,6 +814,15 @@ Usage: %s [--rewrite <regex>=<replace>] [-exclude <module>] [--extra-static-libs
 			}
 		}
 		pom.FixDeps(modules)
+
+		pom.ArtifactSha256, err = sha256File(pom.ArtifactFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %s", pom.ArtifactFile, err)
+			os.Exit(1)
+		}
+		if mavenRepo != "" {
+			pom.ArtifactUrl = artifactUrl(mavenRepo, pom)
+		}
 	}
 
 	buf := &bytes.Buffer{}
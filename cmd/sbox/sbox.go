@@ -38,6 +38,8 @@ var (
 	copyAllOutput bool
 	depfileOut    string
 	inputHash     string
+	isolateNet    bool
+	isolationLog  string
 )
 
 func init() {
@@ -57,6 +59,28 @@ func init() {
 
 	flag.StringVar(&inputHash, "input-hash", "",
 		"This option is ignored. Typical usage is to supply a hash of the list of input names so that the module will be rebuilt if the list (and thus the hash) changes.")
+
+	flag.BoolVar(&isolateNet, "isolate-network", false,
+		"whether to run the command without network access, so that commands that download files fail.")
+	flag.StringVar(&isolationLog, "network-isolation-log", "",
+		"file to write the output root to when the command can't be run without network access and is run with it instead. The file is left empty when the command is run without network access.")
+}
+
+// writeNetworkIsolationLog writes the output root of the command and the reason it could not be
+// run without network access to the network isolation log, if there is one.  The log is written
+// even if the command was run without network access, as it is an output of the command.
+func writeNetworkIsolationLog(fallbackReason error) error {
+	if isolationLog == "" {
+		return nil
+	}
+	content := ""
+	if fallbackReason != nil {
+		content = fmt.Sprintf("%s: %s\n", outputRoot, fallbackReason)
+	}
+	if err := ioutil.WriteFile(isolationLog, []byte(content), 0666); err != nil {
+		return fmt.Errorf("failed to write network isolation log: %s", err)
+	}
+	return nil
 }
 
 func usageViolation(violation string) {
@@ -65,7 +89,7 @@ func usageViolation(violation string) {
 	}
 
 	fmt.Fprintf(os.Stderr,
-		"Usage: sbox -c <commandToRun> --sandbox-path <sandboxPath> --output-root <outputRoot> [--depfile-out depFile] [--input-hash hash] <outputFile> [<outputFile>...]\n"+
+		"Usage: sbox -c <commandToRun> --sandbox-path <sandboxPath> --output-root <outputRoot> [--depfile-out depFile] [--input-hash hash] [--isolate-network [--network-isolation-log logFile]] <outputFile> [<outputFile>...]\n"+
 			"\n"+
 			"Deletes <outputRoot>,"+
 			"runs <commandToRun>,"+
@@ -204,11 +228,36 @@ func run() error {
 
 	commandDescription := rawCommand
 
-	cmd := exec.Command("bash", "-c", rawCommand)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	newCmd := func() *exec.Cmd {
+		cmd := exec.Command("bash", "-c", rawCommand)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return cmd
+	}
+
+	cmd := newCmd()
+	if isolateNet {
+		isolateNetwork(cmd)
+	}
 	err = cmd.Run()
+	if isolateNet {
+		var fallbackReason error
+		if cmd.ProcessState == nil {
+			// The command could not be started in new namespaces, for example because unprivileged
+			// user namespaces are disabled on the host.  Run it without network isolation, like
+			// soong_ui does when nsjail is not working, but say so and record it, as the build is not
+			// checked for network access anymore.
+			fmt.Fprintf(os.Stderr, "sbox: warning: failed to isolate the network of the command, "+
+				"running it with network access: %s\n", err)
+			fallbackReason = err
+			cmd = newCmd()
+			err = cmd.Run()
+		}
+		if err := writeNetworkIsolationLog(fallbackReason); err != nil {
+			return err
+		}
+	}
 
 	if exit, ok := err.(*exec.ExitError); ok && !exit.Success() {
 		return fmt.Errorf("sbox command (%s) failed with err %#v\n", commandDescription, err.Error())
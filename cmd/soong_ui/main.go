@@ -126,7 +126,8 @@ func main() {
 	}
 
 	output := terminal.NewStatusOutput(c.stdio().Stdout(), os.Getenv("NINJA_STATUS"), c.forceDumbOutput,
-		build.OsEnvironment().IsEnvTrue("ANDROID_QUIET_BUILD"))
+		build.OsEnvironment().IsEnvTrue("ANDROID_QUIET_BUILD"),
+		build.OsEnvironment().IsEnvTrue("ANDROID_SHOW_COMMANDS"))
 
 	log := logger.New(output)
 	defer log.Cleanup()
@@ -171,6 +172,7 @@ func main() {
 
 	buildErrorFile := filepath.Join(logsDir, c.logsPrefix+"build_error")
 	rbeMetricsFile := filepath.Join(logsDir, c.logsPrefix+"rbe_metrics.pb")
+	rbeCacheHitsFile := filepath.Join(logsDir, c.logsPrefix+"rbe_cache_hits.txt")
 	soongMetricsFile := filepath.Join(logsDir, c.logsPrefix+"soong_metrics")
 	defer build.UploadMetrics(buildCtx, config, c.forceDumbOutput, buildStarted, buildErrorFile, rbeMetricsFile, soongMetricsFile)
 
@@ -187,6 +189,8 @@ func main() {
 		config.Parallel(), config.RemoteParallel(), config.HighmemParallel())
 
 	defer met.Dump(soongMetricsFile)
+	// Deferred before DumpRBEMetrics so that it runs after the proxy service is shut down.
+	defer build.DumpRBECacheHits(buildCtx, config, rbeCacheHitsFile)
 	defer build.DumpRBEMetrics(buildCtx, config, rbeMetricsFile)
 
 	if start, ok := os.LookupEnv("TRACE_BEGIN_SOONG"); ok {
@@ -0,0 +1,192 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dexpreopt
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"android/soong/android"
+)
+
+// classLoaderContext describes a shared library in the class loader context of a dexpreopted
+// module, together with the shared libraries that it uses itself.  Each library has both the path
+// of its dex jar in the build, which dex2oat compiles against, and its location on the device,
+// which dex2oat stores in the oat file so that the runtime can verify that the context at install
+// time matches the one the module was compiled with.
+type classLoaderContext struct {
+	name        string
+	host        android.Path
+	device      string
+	subcontexts []*classLoaderContext
+}
+
+// UsesLibrariesCycle returns a cycle in the chains of shared libraries in deps, which maps each
+// library to the libraries that it uses, as the list of libraries along the cycle starting and
+// ending with the same library, or nil if the chains don't contain a cycle.
+func UsesLibrariesCycle(deps map[string][]string) []string {
+	visited := make(map[string]bool)
+	onStack := make(map[string]bool)
+	var stack []string
+
+	var visit func(lib string) []string
+	visit = func(lib string) []string {
+		if onStack[lib] {
+			start := android.IndexList(lib, stack)
+			return append(copyOf(stack[start:]), lib)
+		}
+		if visited[lib] {
+			return nil
+		}
+		visited[lib] = true
+		onStack[lib] = true
+		stack = append(stack, lib)
+		for _, dep := range deps[lib] {
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		stack = stack[:len(stack)-1]
+		onStack[lib] = false
+		return nil
+	}
+
+	for _, lib := range android.SortedStringKeys(deps) {
+		if cycle := visit(lib); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// classLoaderContexts returns the class loader contexts for the given shared libraries, following
+// the chains of libraries used by each library in module.LibraryDependencies.  It panics if the
+// build path of one of the given libraries is unknown or if the chains contain a cycle.  It returns
+// false if the build path of a library further down a chain is unknown, in which case the chains
+// cannot be followed.
+func classLoaderContexts(module *ModuleConfig, libs []string) ([]*classLoaderContext, bool) {
+	if cycle := UsesLibrariesCycle(module.LibraryDependencies); cycle != nil {
+		panic(fmt.Errorf("cycle in uses-libraries of %q: %s", module.Name, strings.Join(cycle, " -> ")))
+	}
+
+	for _, lib := range libs {
+		pathForLibrary(module, lib)
+	}
+
+	var visit func(lib string) (*classLoaderContext, bool)
+	visit = func(lib string) (*classLoaderContext, bool) {
+		host := module.LibraryPaths[lib]
+		if host == nil {
+			return nil, false
+		}
+		clc := &classLoaderContext{
+			name:   lib,
+			host:   host,
+			device: filepath.Join("/system/framework", lib+".jar"),
+		}
+		for _, dep := range module.LibraryDependencies[lib] {
+			sub, ok := visit(dep)
+			if !ok {
+				return nil, false
+			}
+			clc.subcontexts = append(clc.subcontexts, sub)
+		}
+		return clc, true
+	}
+
+	var clcs []*classLoaderContext
+	for _, lib := range libs {
+		clc, ok := visit(lib)
+		if !ok {
+			return nil, false
+		}
+		clcs = append(clcs, clc)
+	}
+	return clcs, true
+}
+
+// libraryClassLoaderContexts returns the class loader contexts for libraries that don't use other
+// shared libraries, given their build paths and device locations.
+func libraryClassLoaderContexts(host android.Paths, device []string) []*classLoaderContext {
+	var clcs []*classLoaderContext
+	for i := range host {
+		clcs = append(clcs, &classLoaderContext{
+			name:   strings.TrimSuffix(filepath.Base(device[i]), ".jar"),
+			host:   host[i],
+			device: device[i],
+		})
+	}
+	return clcs
+}
+
+func copyOfContexts(clcs []*classLoaderContext) []*classLoaderContext {
+	return append([]*classLoaderContext(nil), clcs...)
+}
+
+// flattenClassLoaderContexts returns the build paths and device locations of all libraries in the
+// given class loader contexts, with each library preceding the libraries it uses and duplicates
+// removed.
+func flattenClassLoaderContexts(clcs []*classLoaderContext) (android.Paths, []string) {
+	var host android.Paths
+	var device []string
+	seen := make(map[string]bool)
+
+	var visit func(clc *classLoaderContext)
+	visit = func(clc *classLoaderContext) {
+		if seen[clc.name] {
+			return
+		}
+		seen[clc.name] = true
+		host = append(host, clc.host)
+		device = append(device, clc.device)
+		for _, sub := range clc.subcontexts {
+			visit(sub)
+		}
+	}
+	for _, clc := range clcs {
+		visit(clc)
+	}
+
+	return host, device
+}
+
+// encodeClassLoaderContexts returns the class loader context of a module that uses the given shared
+// libraries in the format that dex2oat and the runtime accept, in which the libraries used by a
+// library are nested in braces after it, for example PCL[]{PCL[a.jar]{PCL[b.jar]}#PCL[c.jar]}.
+// The build paths of the libraries are used if host is true, and their device locations otherwise.
+func encodeClassLoaderContexts(clcs []*classLoaderContext, host bool) string {
+	var encode func(clcs []*classLoaderContext) string
+	encode = func(clcs []*classLoaderContext) string {
+		var contexts []string
+		for _, clc := range clcs {
+			path := clc.device
+			if host {
+				path = clc.host.String()
+			}
+			context := "PCL[" + path + "]"
+			if len(clc.subcontexts) > 0 {
+				context += "{" + encode(clc.subcontexts) + "}"
+			}
+			contexts = append(contexts, context)
+		}
+		return strings.Join(contexts, "#")
+	}
+
+	if len(clcs) == 0 {
+		return "PCL[]"
+	}
+	return "PCL[]{" + encode(clcs) + "}"
+}
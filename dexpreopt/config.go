@@ -57,6 +57,10 @@ type GlobalConfig struct {
 
 	GenerateDMFiles bool // generate Dex Metadata files
 
+	CompactDex        bool     // store the dex files copied into vdex files as compact dex to save space
+	StripDex          bool     // strip dex files from jars and apks whose dex files are copied into their vdex files
+	NeverStripModules []string // modules whose dex files are never stripped
+
 	NoDebugInfo                 bool // don't generate debug info by default
 	DontResolveStartupStrings   bool // don't resolve string literals loaded during application startup.
 	AlwaysSystemServerDebugInfo bool // always generate mini debug info for system server modules (overrides NoDebugInfo=true)
@@ -116,6 +120,7 @@ type ModuleConfig struct {
 	PresentOptionalUsesLibraries []string
 	UsesLibraries                []string
 	LibraryPaths                 map[string]android.Path
+	LibraryDependencies          map[string][]string // uses-libraries of each library in LibraryPaths
 
 	Archs                   []android.ArchType
 	DexPreoptImages         []android.Path
@@ -131,6 +136,8 @@ type ModuleConfig struct {
 	ForceCreateAppImage bool
 
 	PresignedPrebuilt bool
+
+	DexMetadata bool // package the profile and verification metadata into a .dm file
 }
 
 type globalSoongConfigSingleton struct{}
@@ -519,6 +526,9 @@ func GlobalConfigForTests(ctx android.PathContext) *GlobalConfig {
 		DefaultCompilerFilter:              "",
 		SystemServerCompilerFilter:         "",
 		GenerateDMFiles:                    false,
+		CompactDex:                         false,
+		StripDex:                           false,
+		NeverStripModules:                  nil,
 		NoDebugInfo:                        false,
 		DontResolveStartupStrings:          false,
 		AlwaysSystemServerDebugInfo:        false,
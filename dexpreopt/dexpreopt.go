@@ -73,6 +73,7 @@ func GenerateDexpreoptRule(ctx android.PathContext, globalSoong *GlobalSoongConf
 	generateBootProfile := module.ProfileBootListing.Valid() && !global.DisableGenerateProfile
 
 	var profile android.WritablePath
+	var primaryVdex android.WritablePath
 	if generateProfile {
 		profile = profileCommand(ctx, globalSoong, global, module, rule)
 	}
@@ -86,14 +87,22 @@ func GenerateDexpreoptRule(ctx android.PathContext, globalSoong *GlobalSoongConf
 			appImage := (generateProfile || module.ForceCreateAppImage || global.DefaultAppImages) &&
 				!module.NoCreateAppImage
 
-			generateDM := shouldGenerateDM(module, global)
+			// The dex metadata file generated below also contains the verification metadata.
+			generateDM := shouldGenerateDM(module, global) && !module.DexMetadata
 
 			for archIdx, _ := range module.Archs {
-				dexpreoptCommand(ctx, globalSoong, global, module, rule, archIdx, profile, appImage, generateDM)
+				vdex := dexpreoptCommand(ctx, globalSoong, global, module, rule, archIdx, profile, appImage, generateDM)
+				if primaryVdex == nil {
+					primaryVdex = vdex
+				}
 			}
 		}
 	}
 
+	if module.DexMetadata && profile != nil {
+		dexMetadataCommand(ctx, globalSoong, module, rule, profile, primaryVdex)
+	}
+
 	return rule, nil
 }
 
@@ -194,7 +203,7 @@ func bootProfileCommand(ctx android.PathContext, globalSoong *GlobalSoongConfig,
 
 func dexpreoptCommand(ctx android.PathContext, globalSoong *GlobalSoongConfig, global *GlobalConfig,
 	module *ModuleConfig, rule *android.RuleBuilder, archIdx int, profile android.WritablePath,
-	appImage bool, generateDM bool) {
+	appImage bool, generateDM bool) android.WritablePath {
 
 	arch := module.Archs[archIdx]
 
@@ -241,19 +250,29 @@ func dexpreoptCommand(ctx android.PathContext, globalSoong *GlobalSoongConfig, g
 	var conditionalClassLoaderContextHost29 android.Paths
 	var conditionalClassLoaderContextTarget29 []string
 
+	// The class loader contexts of the used libraries, including the libraries that they use in
+	// turn, or nil if the chains of libraries cannot be followed.
+	var usesLibContexts []*classLoaderContext
+
 	// A flag indicating if the '&' class loader context is used.
 	unknownClassLoaderContext := false
 
 	if module.EnforceUsesLibraries {
 		usesLibs := append(copyOf(module.UsesLibraries), module.PresentOptionalUsesLibraries...)
 
-		// Create class loader context for dex2oat from uses libraries and filtered optional libraries
-		for _, l := range usesLibs {
-
-			classLoaderContextHost = append(classLoaderContextHost,
-				pathForLibrary(module, l))
-			classLoaderContextTarget = append(classLoaderContextTarget,
-				filepath.Join("/system/framework", l+".jar"))
+		// Create class loader context for dex2oat from uses libraries and filtered optional libraries,
+		// including the libraries that they use in turn.  If the chains cannot be followed fall back
+		// to the directly used libraries.
+		if clcs, ok := classLoaderContexts(module, usesLibs); ok {
+			usesLibContexts = clcs
+			classLoaderContextHost, classLoaderContextTarget = flattenClassLoaderContexts(clcs)
+		} else {
+			for _, l := range usesLibs {
+				classLoaderContextHost = append(classLoaderContextHost,
+					pathForLibrary(module, l))
+				classLoaderContextTarget = append(classLoaderContextTarget,
+					filepath.Join("/system/framework", l+".jar"))
+			}
 		}
 
 		const httpLegacy = "org.apache.http.legacy"
@@ -352,6 +371,35 @@ func dexpreoptCommand(ctx android.PathContext, globalSoong *GlobalSoongConfig, g
 		rule.Command().Textf(`conditional_target_libs_29="%s"`,
 			strings.Join(conditionalClassLoaderContextTarget29, " "))
 		rule.Command().Text("source").Tool(globalSoong.ConstructContext).Input(module.DexPath)
+
+		if usesLibContexts != nil {
+			// construct_context.sh only constructs flat class loader contexts, replace them with nested
+			// ones so that each library is loaded with the libraries that it uses, as it is on the
+			// device.  The libraries that were in the default classpath are added for older apps the
+			// same way construct_context.sh adds them.
+			conditional29 := libraryClassLoaderContexts(conditionalClassLoaderContextHost29,
+				conditionalClassLoaderContextTarget29)
+			conditional28 := append(libraryClassLoaderContexts(conditionalClassLoaderContextHost28,
+				conditionalClassLoaderContextTarget28), conditional29...)
+			setContext := func(clcs []*classLoaderContext) string {
+				return fmt.Sprintf("class_loader_context_arg='--class-loader-context=%s' "+
+					"stored_class_loader_context_arg='--stored-class-loader-context=%s'",
+					encodeClassLoaderContexts(clcs, true), encodeClassLoaderContexts(clcs, false))
+			}
+			rule.Command().
+				Textf(`if [ "${target_sdk_version}" -lt 28 ] 2>/dev/null; then %s;`,
+					setContext(append(copyOfContexts(usesLibContexts), conditional28...))).
+				Textf(`elif [ "${target_sdk_version}" -lt 29 ] 2>/dev/null; then %s;`,
+					setContext(append(copyOfContexts(usesLibContexts), conditional29...))).
+				Textf(`else %s; fi`, setContext(usesLibContexts))
+
+			// The runtime verifies the class loader context stored in the oat file against the one of
+			// the app when the app is installed, write it next to the oat file so that the expected
+			// context can be checked without dumping the oat file.
+			rule.Command().
+				Text(`echo "${stored_class_loader_context_arg#--stored-class-loader-context=}" >`).
+				Output(odexPath.ReplaceExtension(ctx, "clc"))
+		}
 	}
 
 	// Devices that do not have a product partition use a symlink from /product to /system/product.
@@ -401,6 +449,8 @@ func dexpreoptCommand(ctx android.PathContext, globalSoong *GlobalSoongConfig, g
 
 	if module.UncompressedDex {
 		cmd.FlagWithArg("--copy-dex-files=", "false")
+	} else if global.CompactDex && !generateDM {
+		cmd.FlagWithArg("--compact-dex-level=", "fast")
 	}
 
 	if !android.PrefixInList(preoptFlags, "--compiler-filter=") {
@@ -496,6 +546,60 @@ func dexpreoptCommand(ctx android.PathContext, globalSoong *GlobalSoongConfig, g
 
 	rule.Install(odexPath, odexInstallPath)
 	rule.Install(vdexPath, vdexInstallPath)
+
+	return vdexPath
+}
+
+// dexMetadataCommand packages the binary profile and, if the module was dexpreopted, the
+// verification metadata of the primary arch into a dex metadata (.dm) file that is installed next
+// to the module, where the package manager picks it up for install-time optimization.
+func dexMetadataCommand(ctx android.PathContext, globalSoong *GlobalSoongConfig, module *ModuleConfig,
+	rule *android.RuleBuilder, profile android.WritablePath, vdex android.WritablePath) {
+
+	dmDir := module.BuildPath.InSameDir(ctx, "dm")
+	dmPath := module.BuildPath.InSameDir(ctx, "generated.dm")
+	dmInstalledPath := pathtools.ReplaceExtension(module.DexLocation, "dm")
+
+	rule.Command().Text("rm -rf").Flag(dmDir.String())
+	rule.Command().Text("mkdir -p").Flag(dmDir.String())
+
+	files := android.WritablePaths{dmDir.Join(ctx, "primary.prof")}
+	rule.Command().Text("cp -f").Input(profile).Output(files[0])
+	if vdex != nil {
+		files = append(files, dmDir.Join(ctx, "primary.vdex"))
+		rule.Command().Text("cp -f").Input(vdex).Output(files[1])
+	}
+
+	rule.Command().Tool(globalSoong.SoongZip).
+		FlagWithArg("-L", "9").
+		FlagWithOutput("-o", dmPath).
+		Flag("-j").
+		FlagForEachInput("-f ", files.Paths())
+	rule.Install(dmPath, dmInstalledPath)
+}
+
+// ShouldStripDex returns true if the dex files of the module can be stripped from its jar or apk
+// because they are copied into the vdex files generated by dexpreopting it.
+func ShouldStripDex(ctx android.PathContext, global *GlobalConfig, module *ModuleConfig) bool {
+	if !global.StripDex || contains(global.NeverStripModules, module.Name) {
+		return false
+	}
+
+	// Boot jars are preopted together in the boot image, uncompressed dex files and dex
+	// metadata files generated from vdex files are not copied into the vdex files, and presigned
+	// apks cannot be modified without breaking their signature.
+	if dexpreoptDisabled(ctx, global, module) || contains(global.BootJars, module.Name) ||
+		module.UncompressedDex || shouldGenerateDM(module, global) || module.PresignedPrebuilt {
+		return false
+	}
+
+	// The odex and vdex files of modules dexpreopted into system_other are not available after an
+	// OTA until system_other is written again, so the module needs to keep its dex files.
+	if odexOnSystemOther(module, global) {
+		return false
+	}
+
+	return len(module.Archs) > 0
 }
 
 func shouldGenerateDM(module *ModuleConfig, global *GlobalConfig) bool {
@@ -17,6 +17,7 @@ package dexpreopt
 import (
 	"android/soong/android"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -47,6 +48,7 @@ func testModuleConfig(ctx android.PathContext, name, partition string) *ModuleCo
 		PresentOptionalUsesLibraries:    nil,
 		UsesLibraries:                   nil,
 		LibraryPaths:                    nil,
+		LibraryDependencies:             nil,
 		Archs:                           []android.ArchType{android.Arm},
 		DexPreoptImages:                 android.Paths{android.PathForTesting("system/framework/arm/boot.art")},
 		DexPreoptImagesDeps:             []android.OutputPaths{android.OutputPaths{}},
@@ -57,6 +59,7 @@ func testModuleConfig(ctx android.PathContext, name, partition string) *ModuleCo
 		NoCreateAppImage:                false,
 		ForceCreateAppImage:             false,
 		PresignedPrebuilt:               false,
+		DexMetadata:                     false,
 	}
 }
 
@@ -167,3 +170,138 @@ func TestDexPreoptProfile(t *testing.T) {
 		t.Errorf("\nwant installs:\n   %v\ngot:\n   %v", wantInstalls, rule.Installs())
 	}
 }
+
+func TestDexPreoptDexMetadata(t *testing.T) {
+	config := android.TestConfig("out", nil, "", nil)
+	ctx := android.PathContextForTesting(config)
+	globalSoong := GlobalSoongConfigForTests(config)
+	global := GlobalConfigForTests(ctx)
+	module := testSystemModuleConfig(ctx, "test")
+
+	module.ProfileClassListing = android.OptionalPathForPath(android.PathForTesting("profile"))
+	module.DexMetadata = true
+
+	rule, err := GenerateDexpreoptRule(ctx, globalSoong, global, module)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantInstalls := android.RuleBuilderInstalls{
+		{android.PathForOutput(ctx, "test/profile.prof"), "/system/app/test/test.apk.prof"},
+		{android.PathForOutput(ctx, "test/oat/arm/package.art"), "/system/app/test/oat/arm/test.art"},
+		{android.PathForOutput(ctx, "test/oat/arm/package.odex"), "/system/app/test/oat/arm/test.odex"},
+		{android.PathForOutput(ctx, "test/oat/arm/package.vdex"), "/system/app/test/oat/arm/test.vdex"},
+		{android.PathForOutput(ctx, "test/generated.dm"), "/system/app/test/test.dm"},
+	}
+
+	if rule.Installs().String() != wantInstalls.String() {
+		t.Errorf("\nwant installs:\n   %v\ngot:\n   %v", wantInstalls, rule.Installs())
+	}
+
+	wantFiles := []string{
+		android.PathForOutput(ctx, "test/dm/primary.prof").String(),
+		android.PathForOutput(ctx, "test/dm/primary.vdex").String(),
+	}
+	for _, file := range wantFiles {
+		if !android.InList(file, rule.Outputs().Strings()) {
+			t.Errorf("expected %q in dex metadata, outputs %q", file, rule.Outputs().Strings())
+		}
+	}
+}
+
+func TestDexPreoptCompactDex(t *testing.T) {
+	config := android.TestConfig("out", nil, "", nil)
+	ctx := android.PathContextForTesting(config)
+	globalSoong := GlobalSoongConfigForTests(config)
+	global := GlobalConfigForTests(ctx)
+	global.CompactDex = true
+	module := testSystemModuleConfig(ctx, "test")
+
+	rule, err := GenerateDexpreoptRule(ctx, globalSoong, global, module)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if command := strings.Join(rule.Commands(), " "); !strings.Contains(command, "--compact-dex-level=fast") {
+		t.Errorf("expected --compact-dex-level=fast in dexpreopt command %q", command)
+	}
+
+	module.UncompressedDex = true
+	rule, err = GenerateDexpreoptRule(ctx, globalSoong, global, module)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if command := strings.Join(rule.Commands(), " "); strings.Contains(command, "--compact-dex-level") {
+		t.Errorf("unexpected --compact-dex-level for uncompressed dex in dexpreopt command %q", command)
+	}
+}
+
+func TestShouldStripDex(t *testing.T) {
+	config := android.TestConfig("out", nil, "", nil)
+	ctx := android.PathContextForTesting(config)
+	global := GlobalConfigForTests(ctx)
+	global.StripDex = true
+	module := testSystemModuleConfig(ctx, "test")
+
+	if !ShouldStripDex(ctx, global, module) {
+		t.Errorf("expected the dex files of %s to be stripped", module.Name)
+	}
+
+	global.HasSystemOther = true
+	global.PatternsOnSystemOther = []string{"app/%"}
+	if ShouldStripDex(ctx, global, module) {
+		t.Errorf("expected the dex files of %s to be kept when it is dexpreopted into system_other", module.Name)
+	}
+}
+
+func TestDexPreoptClassLoaderContext(t *testing.T) {
+	config := android.TestConfig("out", nil, "", nil)
+	ctx := android.PathContextForTesting(config)
+	globalSoong := GlobalSoongConfigForTests(config)
+	global := GlobalConfigForTests(ctx)
+
+	libraryPaths := make(map[string]android.Path)
+	for _, lib := range []string{"foo", "bar", "baz", "org.apache.http.legacy",
+		"android.hidl.base-V1.0-java", "android.hidl.manager-V1.0-java"} {
+		libraryPaths[lib] = android.PathForOutput(ctx, lib+".jar")
+	}
+
+	module := testSystemModuleConfig(ctx, "test")
+	module.EnforceUsesLibraries = true
+	module.UsesLibraries = []string{"foo", "baz"}
+	module.LibraryPaths = libraryPaths
+	module.LibraryDependencies = map[string][]string{
+		"foo": {"bar"},
+		"baz": {"bar"},
+	}
+
+	rule, err := GenerateDexpreoptRule(ctx, globalSoong, global, module)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantTarget := `dex_preopt_target_libraries="/system/framework/foo.jar /system/framework/bar.jar /system/framework/baz.jar"`
+	wantHost := `dex_preopt_host_libraries="out/foo.jar out/bar.jar out/baz.jar"`
+	// Each library is nested with the libraries that it uses.
+	wantContext := `else class_loader_context_arg='--class-loader-context=` +
+		`PCL[]{PCL[out/foo.jar]{PCL[out/bar.jar]}#PCL[out/baz.jar]{PCL[out/bar.jar]}}' ` +
+		`stored_class_loader_context_arg='--stored-class-loader-context=` +
+		`PCL[]{PCL[/system/framework/foo.jar]{PCL[/system/framework/bar.jar]}#` +
+		`PCL[/system/framework/baz.jar]{PCL[/system/framework/bar.jar]}}'; fi`
+	for _, want := range []string{wantTarget, wantHost, wantContext} {
+		if !strings.Contains(strings.Join(rule.Commands(), "\n"), want) {
+			t.Errorf("expected %q in commands:\n%s", want, strings.Join(rule.Commands(), "\n"))
+		}
+	}
+
+	if !android.InList("out/test/oat/arm/package.clc", rule.Outputs().Strings()) {
+		t.Errorf("expected the stored class loader context in outputs %q", rule.Outputs().Strings())
+	}
+
+	module.LibraryDependencies["bar"] = []string{"foo"}
+	_, err = GenerateDexpreoptRule(ctx, globalSoong, global, module)
+	if err == nil || !strings.Contains(err.Error(), `cycle in uses-libraries of "test": bar -> foo -> bar`) {
+		t.Errorf("expected cycle error, got %v", err)
+	}
+}
@@ -192,6 +192,12 @@ func (p *PrebuiltEtc) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 		Output: p.outputFilePath,
 		Input:  p.sourceFilePath,
 	})
+
+	// Make installs the file when Soong is embedded in it, this records where the file is installed
+	// for the modules that package it, such as ramdisks.
+	if p.Installable() {
+		ctx.InstallFile(p.installDirPath, p.outputFilePath.Base(), p.outputFilePath)
+	}
 }
 
 func (p *PrebuiltEtc) AndroidMkEntries() []android.AndroidMkEntries {
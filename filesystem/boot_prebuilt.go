@@ -0,0 +1,181 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"fmt"
+
+	"github.com/google/blueprint/proptools"
+
+	"android/soong/android"
+)
+
+func init() {
+	android.RegisterModuleType("prebuilt_kernel", PrebuiltKernelFactory)
+	android.RegisterModuleType("prebuilt_dtb", PrebuiltDtbFactory)
+	android.RegisterModuleType("prebuilt_dtbo", PrebuiltDtboFactory)
+}
+
+type bootPrebuiltBoard struct {
+	// name of the board (TARGET_BOOTLOADER_BOARD_NAME) this source is used for.
+	Name *string
+
+	// source file to use for the board.
+	Src *string `android:"path"`
+}
+
+type bootPrebuiltProperties struct {
+	// source file to use for boards that are not listed in boards.
+	Src *string `android:"path,arch_variant"`
+
+	// sources to use for specific boards, which take precedence over src.
+	Boards []bootPrebuiltBoard
+
+	// name of the output file.  Defaults to "kernel" for prebuilt_kernel, "dtb.img" for
+	// prebuilt_dtb and "dtbo.img" for prebuilt_dtbo.
+	Filename *string
+
+	// path of the image in the target-files package when the product installs the module.
+	// Defaults to "BOOT/kernel" for prebuilt_kernel, "BOOT/dtb" for prebuilt_dtb and
+	// "PREBUILT_IMAGES/dtbo.img" for prebuilt_dtbo, where the boot image assembly finds them.
+	Target_files_path *string
+}
+
+// BootPrebuilt is a kernel, DTB or DTBO image that is consumed by the boot image assembly.
+type BootPrebuilt struct {
+	android.ModuleBase
+
+	properties bootPrebuiltProperties
+
+	defaultFilename        string
+	defaultTargetFilesPath string
+
+	output android.OutputPath
+}
+
+func newBootPrebuilt(defaultFilename, defaultTargetFilesPath string) *BootPrebuilt {
+	module := &BootPrebuilt{defaultFilename: defaultFilename, defaultTargetFilesPath: defaultTargetFilesPath}
+	module.AddProperties(&module.properties)
+	android.InitAndroidArchModule(module, android.DeviceSupported, android.MultilibFirst)
+	return module
+}
+
+// prebuilt_kernel provides a prebuilt kernel image for the boot image, optionally selected per
+// board.
+func PrebuiltKernelFactory() android.Module {
+	return newBootPrebuilt("kernel", "BOOT/kernel")
+}
+
+// prebuilt_dtb provides a prebuilt device tree blob image for the boot image, optionally selected
+// per board.
+func PrebuiltDtbFactory() android.Module {
+	return newBootPrebuilt("dtb.img", "BOOT/dtb")
+}
+
+// prebuilt_dtbo provides a prebuilt device tree blob overlay image, optionally selected per board.
+func PrebuiltDtboFactory() android.Module {
+	return newBootPrebuilt("dtbo.img", "PREBUILT_IMAGES/dtbo.img")
+}
+
+func (p *BootPrebuilt) DepsMutator(ctx android.BottomUpMutatorContext) {
+	// The path properties of structs in lists are not found by the path dependency mutator, add
+	// the dependencies on the modules that the boards reference with ":module" here instead.
+	for _, b := range p.properties.Boards {
+		android.ExtractSourceDeps(ctx, b.Src)
+	}
+}
+
+// sourcePath returns the source file to use for the current board, or an invalid path if there
+// is none.
+func (p *BootPrebuilt) sourcePath(ctx android.ModuleContext) android.OptionalPath {
+	board := ctx.DeviceConfig().BoardName()
+	for _, b := range p.properties.Boards {
+		if proptools.String(b.Name) == board {
+			return android.OptionalPathForPath(android.PathForModuleSrc(ctx, proptools.String(b.Src)))
+		}
+	}
+	if src := proptools.String(p.properties.Src); src != "" {
+		return android.OptionalPathForPath(android.PathForModuleSrc(ctx, src))
+	}
+	return android.OptionalPath{}
+}
+
+func (p *BootPrebuilt) GenerateAndroidBuildActions(ctx android.ModuleContext) {
+	seen := make(map[string]bool)
+	for _, b := range p.properties.Boards {
+		name := proptools.String(b.Name)
+		if name == "" || proptools.String(b.Src) == "" {
+			ctx.PropertyErrorf("boards", "each board must set both name and src")
+			return
+		}
+		if seen[name] {
+			ctx.PropertyErrorf("boards", "board %q is listed more than once", name)
+			return
+		}
+		seen[name] = true
+	}
+
+	src := p.sourcePath(ctx)
+	if !src.Valid() {
+		ctx.PropertyErrorf("src", "no source for board %q and no default src",
+			ctx.DeviceConfig().BoardName())
+		return
+	}
+
+	filename := proptools.StringDefault(p.properties.Filename, p.defaultFilename)
+	p.output = android.PathForModuleOut(ctx, filename).OutputPath
+
+	ctx.Build(pctx, android.BuildParams{
+		Rule:   android.Cp,
+		Output: p.output,
+		Input:  src.Path(),
+	})
+}
+
+// OutputPath returns the path of the image selected for the current board.
+func (p *BootPrebuilt) OutputPath() android.Path {
+	return p.output
+}
+
+func (p *BootPrebuilt) TargetFilesEntries() []android.TargetFilesEntry {
+	return []android.TargetFilesEntry{{
+		Path: proptools.StringDefault(p.properties.Target_files_path, p.defaultTargetFilesPath),
+		Src:  p.output,
+	}}
+}
+
+var _ android.TargetFilesEntriesProvider = (*BootPrebuilt)(nil)
+
+func (p *BootPrebuilt) OutputFiles(tag string) (android.Paths, error) {
+	switch tag {
+	case "":
+		return android.Paths{p.output}, nil
+	default:
+		return nil, fmt.Errorf("unsupported module reference tag %q", tag)
+	}
+}
+
+func (p *BootPrebuilt) AndroidMkEntries() []android.AndroidMkEntries {
+	return []android.AndroidMkEntries{{
+		Class:      "ETC",
+		OutputFile: android.OptionalPathForPath(p.output),
+		ExtraEntries: []android.AndroidMkExtraEntriesFunc{
+			func(entries *android.AndroidMkEntries) {
+				entries.SetString("LOCAL_INSTALLED_MODULE_STEM", p.output.Base())
+				entries.SetBool("LOCAL_UNINSTALLABLE_MODULE", true)
+			},
+		},
+	}}
+}
@@ -0,0 +1,148 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"testing"
+
+	"github.com/google/blueprint/proptools"
+
+	"android/soong/android"
+)
+
+const bootPrebuiltBp = `
+	prebuilt_kernel {
+		name: "kernel",
+		src: "Image.lz4",
+		boards: [
+			{
+				name: "board_a",
+				src: "board_a/Image.gz",
+			},
+			{
+				name: "board_c",
+				src: ":board_c_kernel",
+			},
+		],
+	}
+
+	filegroup {
+		name: "board_c_kernel",
+		srcs: ["board_c/Image"],
+	}
+
+	prebuilt_dtb {
+		name: "dtb",
+		src: "dtb/default.dtb",
+	}
+`
+
+func TestBootPrebuilt(t *testing.T) {
+	testCases := []struct {
+		name        string
+		board       *string
+		module      string
+		expected    string
+		output      string
+		targetFiles string
+	}{
+		{
+			name:        "default kernel",
+			module:      "kernel",
+			expected:    "Image.lz4",
+			output:      "kernel",
+			targetFiles: "BOOT/kernel",
+		},
+		{
+			name:        "board kernel",
+			board:       proptools.StringPtr("board_a"),
+			module:      "kernel",
+			expected:    "board_a/Image.gz",
+			output:      "kernel",
+			targetFiles: "BOOT/kernel",
+		},
+		{
+			name:        "board kernel from module",
+			board:       proptools.StringPtr("board_c"),
+			module:      "kernel",
+			expected:    "board_c/Image",
+			output:      "kernel",
+			targetFiles: "BOOT/kernel",
+		},
+		{
+			name:        "other board kernel",
+			board:       proptools.StringPtr("board_b"),
+			module:      "kernel",
+			expected:    "Image.lz4",
+			output:      "kernel",
+			targetFiles: "BOOT/kernel",
+		},
+		{
+			name:        "dtb",
+			board:       proptools.StringPtr("board_a"),
+			module:      "dtb",
+			expected:    "dtb/default.dtb",
+			output:      "dtb.img",
+			targetFiles: "BOOT/dtb",
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			config := testConfig(bootPrebuiltBp)
+			config.TestProductVariables.BoardName = test.board
+			ctx := testContext(config)
+			_, errs := ctx.ParseFileList(".", []string{"Android.bp"})
+			android.FailIfErrored(t, errs)
+			_, errs = ctx.PrepareBuildActions(config)
+			android.FailIfErrored(t, errs)
+
+			module := ctx.ModuleForTests(test.module, "android_arm64_armv8-a")
+			cp := module.Output(test.output)
+			if cp.Input.String() != test.expected {
+				t.Errorf("expected input %q, got %q", test.expected, cp.Input.String())
+			}
+
+			entries := module.Module().(*BootPrebuilt).TargetFilesEntries()
+			if len(entries) != 1 || entries[0].Path != test.targetFiles || entries[0].Src.String() != cp.Output.String() {
+				t.Errorf("expected target-files entry %q for %q, got %v", test.targetFiles, cp.Output, entries)
+			}
+		})
+	}
+}
+
+func TestBootPrebuiltErrors(t *testing.T) {
+	testFilesystemError(t, `boards: board "board_a" is listed more than once`, `
+		prebuilt_dtbo {
+			name: "dtbo",
+			boards: [
+				{
+					name: "board_a",
+					src: "board_a/Image.gz",
+				},
+				{
+					name: "board_a",
+					src: "Image.lz4",
+				},
+			],
+		}
+	`)
+
+	testFilesystemError(t, `src: no source for board "test_device" and no default src`, `
+		prebuilt_dtbo {
+			name: "dtbo",
+		}
+	`)
+}
@@ -0,0 +1,243 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/proptools"
+
+	"android/soong/android"
+)
+
+var pctx = android.NewPackageContext("android/soong/filesystem")
+
+func init() {
+	android.RegisterModuleType("android_ramdisk", RamdiskFactory)
+}
+
+type dependencyTag struct {
+	blueprint.BaseDependencyTag
+	name string
+}
+
+var ramdiskDepTag = dependencyTag{name: "ramdisk"}
+
+type ramdiskPrebuilt struct {
+	// source file of the prebuilt, relative to the directory of the module.
+	Src *string
+
+	// path of the file in the ramdisk.
+	Dest *string
+}
+
+type ramdiskProperties struct {
+	// modules to include in the ramdisk.  The ramdisk variant of each module is used, and the files
+	// it installs are placed at their path relative to the root of the ramdisk.
+	Deps []string
+
+	// prebuilt files to include in the ramdisk at an explicit path.
+	Prebuilts []ramdiskPrebuilt
+
+	// compression to use for the cpio archive, either "lz4" or "gzip".  Defaults to "gzip".
+	Compression *string
+
+	// directory of the target-files package to add the contents of the ramdisk to when the product
+	// installs the module, for example "BOOT/RAMDISK" or "VENDOR_BOOT/RAMDISK", where the boot
+	// image assembly builds the ramdisk from.  The contents are not added if unset.
+	Target_files_dir *string
+}
+
+type Ramdisk struct {
+	android.ModuleBase
+
+	properties ramdiskProperties
+
+	output android.OutputPath
+
+	// The files and symlinks in the ramdisk, keyed by their path in the ramdisk.
+	contents map[string]android.TargetFilesEntry
+}
+
+// android_ramdisk assembles a cpio ramdisk from the ramdisk variants of its dependencies and a set
+// of prebuilt files, and compresses it with lz4 or gzip.  The resulting image is meant to be
+// consumed by the boot image.
+func RamdiskFactory() android.Module {
+	module := &Ramdisk{}
+	module.AddProperties(&module.properties)
+	android.InitAndroidArchModule(module, android.DeviceSupported, android.MultilibFirst)
+	return module
+}
+
+func (r *Ramdisk) DepsMutator(ctx android.BottomUpMutatorContext) {
+	variations := []blueprint.Variation{{Mutator: "image", Variation: android.RamdiskVariation}}
+	ctx.AddVariationDependencies(variations, ramdiskDepTag, r.properties.Deps...)
+}
+
+// ramdiskRoots returns the install directories of the partitions that make up the ramdisk, in
+// both the Soong and the Make output directories.
+func ramdiskRoots(ctx android.ModuleContext) []string {
+	productOut := filepath.Join("target", "product", ctx.Config().DeviceName())
+	var roots []string
+	for _, dir := range []string{filepath.Join("recovery", "root", "first_stage_ramdisk"), "ramdisk"} {
+		roots = append(roots,
+			filepath.Join(ctx.Config().BuildDir(), productOut, dir)+"/",
+			filepath.Join(ctx.Config().BuildDir(), "..", productOut, dir)+"/")
+	}
+	return roots
+}
+
+// ramdiskPath returns the path of an installed file inside the ramdisk, or false if the file is
+// not installed into the ramdisk.
+func ramdiskPath(roots []string, installed android.InstallPath) (string, bool) {
+	for _, root := range roots {
+		if strings.HasPrefix(installed.String(), root) {
+			return strings.TrimPrefix(installed.String(), root), true
+		}
+	}
+	return "", false
+}
+
+func (r *Ramdisk) GenerateAndroidBuildActions(ctx android.ModuleContext) {
+	compression := proptools.StringDefault(r.properties.Compression, "gzip")
+	if compression != "lz4" && compression != "gzip" {
+		ctx.PropertyErrorf("compression", "must be \"lz4\" or \"gzip\", found %q", compression)
+		return
+	}
+
+	rootDir := android.PathForModuleOut(ctx, "root").OutputPath
+
+	rule := android.NewRuleBuilder()
+	rule.Command().Text("rm -rf").Text(rootDir.String())
+	rule.Command().Text("mkdir -p").Text(rootDir.String())
+
+	dests := make(map[string]string)
+	r.contents = make(map[string]android.TargetFilesEntry)
+	addToRoot := func(dest, origin string) (android.OutputPath, bool) {
+		if other, exists := dests[dest]; exists {
+			ctx.ModuleErrorf("%q is installed by both %s and %s", dest, other, origin)
+			return android.OutputPath{}, false
+		}
+		dests[dest] = origin
+
+		destPath := rootDir.Join(ctx, dest)
+		rule.Command().Text("mkdir -p").Text(filepath.Dir(destPath.String()))
+		return destPath, true
+	}
+	copyToRoot := func(src android.Path, dest, origin string) {
+		if destPath, ok := addToRoot(dest, origin); ok {
+			rule.Command().Text("cp -f").Input(src).Text(destPath.String())
+			r.contents[dest] = android.TargetFilesEntry{Src: src}
+		}
+	}
+
+	// The built files of the dependencies are used rather than their installed files, which are
+	// installed by Make, not by Soong, when Soong is embedded in Make.
+	roots := ramdiskRoots(ctx)
+	ctx.VisitDirectDepsWithTag(ramdiskDepTag, func(m android.Module) {
+		origin := fmt.Sprintf("module %q", ctx.OtherModuleName(m))
+		for _, spec := range m.PackagingSpecs() {
+			dest, ok := ramdiskPath(roots, spec.InstallPath())
+			if !ok {
+				ctx.PropertyErrorf("deps", "%q installs %s outside of the ramdisk",
+					ctx.OtherModuleName(m), spec.InstallPath())
+				continue
+			}
+			if spec.SymlinkTarget() != "" {
+				if destPath, ok := addToRoot(dest, origin); ok {
+					rule.Command().Text("ln -sf").Text(proptools.ShellEscape(spec.SymlinkTarget())).
+						Text(destPath.String())
+					r.contents[dest] = android.TargetFilesEntry{SymlinkTarget: spec.SymlinkTarget()}
+				}
+				continue
+			}
+			copyToRoot(spec.SrcPath(), dest, origin)
+		}
+	})
+
+	for i, prebuilt := range r.properties.Prebuilts {
+		src := proptools.String(prebuilt.Src)
+		dest := proptools.String(prebuilt.Dest)
+		if src == "" || dest == "" {
+			ctx.PropertyErrorf("prebuilts", "entry %d must set both src and dest", i)
+			continue
+		}
+		if strings.HasPrefix(dest, "/") {
+			dest = dest[1:]
+		}
+		copyToRoot(android.PathForModuleSrc(ctx, src), dest, fmt.Sprintf("prebuilt %q", src))
+	}
+
+	r.output = android.PathForModuleOut(ctx, r.Name()+".img").OutputPath
+
+	cmd := rule.Command().
+		BuiltTool(ctx, "mkbootfs").
+		Text(rootDir.String()).
+		Text("|")
+	switch compression {
+	case "lz4":
+		cmd.BuiltTool(ctx, "lz4").Flag("-l -12 --favor-decSpeed")
+	case "gzip":
+		cmd.BuiltTool(ctx, "minigzip")
+	}
+	cmd.Text(">").Output(r.output)
+
+	rule.Build(pctx, ctx, "ramdisk", android.ActionDescription("ramdisk", r.output))
+}
+
+// OutputPath returns the path of the compressed ramdisk image.
+func (r *Ramdisk) OutputPath() android.Path {
+	return r.output
+}
+
+func (r *Ramdisk) TargetFilesEntries() []android.TargetFilesEntry {
+	dir := proptools.String(r.properties.Target_files_dir)
+	if dir == "" {
+		return nil
+	}
+	var entries []android.TargetFilesEntry
+	for _, dest := range android.SortedStringKeys(r.contents) {
+		entry := r.contents[dest]
+		entry.Path = filepath.Join(dir, dest)
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+var _ android.TargetFilesEntriesProvider = (*Ramdisk)(nil)
+
+func (r *Ramdisk) OutputFiles(tag string) (android.Paths, error) {
+	switch tag {
+	case "":
+		return android.Paths{r.output}, nil
+	default:
+		return nil, fmt.Errorf("unsupported module reference tag %q", tag)
+	}
+}
+
+func (r *Ramdisk) AndroidMkEntries() []android.AndroidMkEntries {
+	return []android.AndroidMkEntries{{
+		Class:      "ETC",
+		OutputFile: android.OptionalPathForPath(r.output),
+		ExtraEntries: []android.AndroidMkExtraEntriesFunc{
+			func(entries *android.AndroidMkEntries) {
+				entries.SetBool("LOCAL_UNINSTALLABLE_MODULE", true)
+			},
+		},
+	}}
+}
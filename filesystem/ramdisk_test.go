@@ -0,0 +1,194 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesystem
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"android/soong/android"
+	"android/soong/etc"
+)
+
+var buildDir string
+
+func setUp() {
+	var err error
+	buildDir, err = ioutil.TempDir("", "soong_filesystem_test")
+	if err != nil {
+		panic(err)
+	}
+}
+
+func tearDown() {
+	os.RemoveAll(buildDir)
+}
+
+func TestMain(m *testing.M) {
+	run := func() int {
+		setUp()
+		defer tearDown()
+
+		return m.Run()
+	}
+
+	os.Exit(run())
+}
+
+func testConfig(bp string) android.Config {
+	fs := map[string][]byte{
+		"fstab":            nil,
+		"init.rc":          nil,
+		"Image.lz4":        nil,
+		"board_a/Image.gz": nil,
+		"dtb/default.dtb":  nil,
+		"board_c/Image":    nil,
+	}
+	return android.TestArchConfig(buildDir, nil, bp, fs)
+}
+
+func testContext(config android.Config) *android.TestContext {
+	ctx := android.NewTestArchContext()
+	ctx.RegisterModuleType("filegroup", android.FileGroupFactory)
+	ctx.RegisterModuleType("android_ramdisk", RamdiskFactory)
+	ctx.RegisterModuleType("prebuilt_etc", etc.PrebuiltEtcFactory)
+	ctx.RegisterModuleType("prebuilt_kernel", PrebuiltKernelFactory)
+	ctx.RegisterModuleType("prebuilt_dtb", PrebuiltDtbFactory)
+	ctx.RegisterModuleType("prebuilt_dtbo", PrebuiltDtboFactory)
+	ctx.Register(config)
+	return ctx
+}
+
+func testRamdisk(t *testing.T, bp string, inMake bool) *android.TestContext {
+	t.Helper()
+	config := testConfig(bp)
+	if inMake {
+		android.SetInMakeForTests(config)
+	}
+	ctx := testContext(config)
+	_, errs := ctx.ParseFileList(".", []string{"Android.bp"})
+	android.FailIfErrored(t, errs)
+	_, errs = ctx.PrepareBuildActions(config)
+	android.FailIfErrored(t, errs)
+	return ctx
+}
+
+func testFilesystemError(t *testing.T, pattern, bp string) {
+	t.Helper()
+	config := testConfig(bp)
+	ctx := testContext(config)
+	_, errs := ctx.ParseFileList(".", []string{"Android.bp"})
+	if len(errs) > 0 {
+		android.FailIfNoMatchingErrors(t, pattern, errs)
+		return
+	}
+	_, errs = ctx.PrepareBuildActions(config)
+	if len(errs) > 0 {
+		android.FailIfNoMatchingErrors(t, pattern, errs)
+		return
+	}
+	t.Fatalf("missing expected error %q (0 errors are returned)", pattern)
+}
+
+func TestRamdisk(t *testing.T) {
+	// Make installs the files of the dependencies when Soong is embedded in it, so their built files
+	// are packaged.
+	t.Run("soong", func(t *testing.T) { testRamdiskContents(t, false) })
+	t.Run("embedded in make", func(t *testing.T) { testRamdiskContents(t, true) })
+}
+
+func testRamdiskContents(t *testing.T, inMake bool) {
+	ctx := testRamdisk(t, `
+		android_ramdisk {
+			name: "ramdisk",
+			deps: ["init.rc"],
+			prebuilts: [
+				{
+					src: "fstab",
+					dest: "/first_stage_ramdisk/fstab.device",
+				},
+			],
+			compression: "lz4",
+			target_files_dir: "BOOT/RAMDISK",
+		}
+
+		prebuilt_etc {
+			name: "init.rc",
+			src: "init.rc",
+			ramdisk_available: true,
+		}
+	`, inMake)
+
+	ramdisk := ctx.ModuleForTests("ramdisk", "android_arm64_armv8-a").Rule("ramdisk")
+	command := ramdisk.RuleParams.Command
+
+	initRc := ctx.ModuleForTests("init.rc", "android_ramdisk_arm64_armv8-a").Module().(*etc.PrebuiltEtc).OutputFile()
+	rootDir := buildDir + "/.intermediates/ramdisk/android_arm64_armv8-a/root"
+	for _, expected := range []string{
+		"cp -f " + initRc.String() + " " + rootDir + "/system/etc/init.rc",
+		"cp -f fstab " + rootDir + "/first_stage_ramdisk/fstab.device",
+		"mkbootfs " + rootDir + " | ",
+		"lz4 -l -12 --favor-decSpeed > " + ramdisk.Output.String(),
+	} {
+		if !strings.Contains(command, expected) {
+			t.Errorf("expected %q in command, got %q", expected, command)
+		}
+	}
+
+	if ramdisk.Output.Base() != "ramdisk.img" {
+		t.Errorf("expected output ramdisk.img, got %q", ramdisk.Output.Base())
+	}
+
+	entries := ctx.ModuleForTests("ramdisk", "android_arm64_armv8-a").Module().(*Ramdisk).TargetFilesEntries()
+	var g []string
+	for _, entry := range entries {
+		g = append(g, entry.Path+" "+entry.Src.String())
+	}
+	w := []string{
+		"BOOT/RAMDISK/first_stage_ramdisk/fstab.device fstab",
+		"BOOT/RAMDISK/system/etc/init.rc " + initRc.String(),
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("expected target-files entries %q, got %q", w, g)
+	}
+}
+
+func TestRamdiskErrors(t *testing.T) {
+	testFilesystemError(t, `compression: must be "lz4" or "gzip", found "xz"`, `
+		android_ramdisk {
+			name: "ramdisk",
+			compression: "xz",
+		}
+	`)
+
+	testFilesystemError(t, `"first_stage_ramdisk/fstab" is installed by both`, `
+		android_ramdisk {
+			name: "ramdisk",
+			prebuilts: [
+				{
+					src: "fstab",
+					dest: "first_stage_ramdisk/fstab",
+				},
+				{
+					src: "init.rc",
+					dest: "first_stage_ramdisk/fstab",
+				},
+			],
+		}
+	`)
+}
@@ -43,6 +43,8 @@ func registerGenruleBuildComponents(ctx android.RegistrationContext) {
 	ctx.FinalDepsMutators(func(ctx android.RegisterMutatorsContext) {
 		ctx.BottomUp("genrule_tool_deps", toolDepsMutator).Parallel()
 	})
+
+	ctx.RegisterSingletonType("genrule_network_access", networkAccessSingletonFactory)
 }
 
 var (
@@ -117,6 +119,11 @@ type generatorProperties struct {
 
 	// input files to exclude
 	Exclude_srcs []string `android:"path,arch_variant"`
+
+	// Set to true to allow the command to access the network.  Commands are run without network
+	// access by default, as a command that downloads files makes the build non-hermetic.  Modules
+	// that set this are listed in genrule_network_access.txt, which is distributed with the build.
+	Allow_network *bool
 }
 
 type Module struct {
@@ -142,6 +149,9 @@ type Module struct {
 	outputFiles android.Paths
 	outputDeps  android.Paths
 
+	// The files that sbox writes to when it could not run the commands without network access.
+	networkIsolationLogs android.Paths
+
 	subName string
 	subDir  string
 }
@@ -157,6 +167,8 @@ type generateTask struct {
 	cmd         string
 	shard       int
 	shards      int
+
+	networkIsolationLog android.WritablePath
 }
 
 func (g *Module) GeneratedSourceFiles() android.Paths {
@@ -409,6 +421,18 @@ func (g *Module) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 			sandboxCommand = sandboxCommand + hashSrcFiles(srcFiles)
 		}
 
+		name := "generator"
+		if task.shards > 1 {
+			name += strconv.Itoa(task.shard)
+		}
+
+		if !Bool(g.properties.Allow_network) {
+			task.networkIsolationLog = android.PathForModuleOut(ctx, "network_isolation", name+".log")
+			g.networkIsolationLogs = append(g.networkIsolationLogs, task.networkIsolationLog)
+			sandboxCommand = sandboxCommand + " --isolate-network --network-isolation-log " +
+				task.networkIsolationLog.String()
+		}
+
 		sandboxCommand = sandboxCommand + fmt.Sprintf(" -c %s %s $allouts",
 			rawCommand, depfilePlaceholder)
 
@@ -421,10 +445,6 @@ func (g *Module) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 			ruleParams.Deps = blueprint.DepsGCC
 			args = append(args, "depfileArgs")
 		}
-		name := "generator"
-		if task.shards > 1 {
-			name += strconv.Itoa(task.shard)
-		}
 		rule := ctx.Rule(pctx, name, ruleParams, args...)
 
 		g.generateSourceFile(ctx, task, rule)
@@ -512,6 +532,10 @@ func (g *Module) generateSourceFile(ctx android.ModuleContext, task generateTask
 			"allouts": strings.Join(task.sandboxOuts, " "),
 		},
 	}
+	if task.networkIsolationLog != nil {
+		params.ImplicitOutputs = append(android.WritablePaths{}, task.out[1:]...)
+		params.ImplicitOutputs = append(params.ImplicitOutputs, task.networkIsolationLog)
+	}
 	if Bool(g.properties.Depfile) {
 		params.Depfile = android.PathForModuleGen(ctx, task.out[0].Rel()+".d")
 		params.Args["depfileArgs"] = "--depfile-out " + depFile.String()
@@ -17,6 +17,7 @@ package genrule
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -721,6 +722,57 @@ func TestGenruleDefaults(t *testing.T) {
 	}
 }
 
+func TestGenruleNetworkAccess(t *testing.T) {
+	bp := `
+				genrule {
+					name: "isolated",
+					out: ["out"],
+					cmd: "echo foo > $(out)",
+				}
+
+				genrule {
+					name: "network",
+					out: ["out"],
+					cmd: "curl -o $(out) https://example.com",
+					allow_network: true,
+				}
+			`
+	config := testConfig(bp, nil)
+	ctx := testContext(config)
+	_, errs := ctx.ParseFileList(".", []string{"Android.bp"})
+	if errs == nil {
+		_, errs = ctx.PrepareBuildActions(config)
+	}
+	if errs != nil {
+		t.Fatal(errs)
+	}
+
+	isolated := ctx.ModuleForTests("isolated", "").Rule("generator")
+	log := filepath.Join(buildDir, ".intermediates/isolated/network_isolation/generator.log")
+	if !strings.Contains(isolated.RuleParams.Command, " --isolate-network --network-isolation-log "+log+" ") {
+		t.Errorf("expected --isolate-network with the network isolation log in command %q", isolated.RuleParams.Command)
+	}
+	if !android.InList(log, isolated.ImplicitOutputs.Strings()) {
+		t.Errorf("expected network isolation log %q in implicit outputs %q", log, isolated.ImplicitOutputs.Strings())
+	}
+
+	network := ctx.ModuleForTests("network", "").Rule("generator").RuleParams.Command
+	if strings.Contains(network, "--isolate-network") {
+		t.Errorf("unexpected --isolate-network in command %q", network)
+	}
+
+	singleton := ctx.SingletonForTests("genrule_network_access")
+	report := android.ContentFromWriteFileRuleForTests(t, singleton.Output("genrule_network_access.txt"))
+	if g, w := report, "network Android.bp\n"; g != w {
+		t.Errorf("expected genrules with network access %q, got %q", w, g)
+	}
+
+	fallbacks := singleton.Output("genrule_network_isolation_fallbacks.txt")
+	if g, w := fallbacks.Inputs.Strings(), []string{log}; !reflect.DeepEqual(g, w) {
+		t.Errorf("expected network isolation logs %q, got %q", w, g)
+	}
+}
+
 type testTool struct {
 	android.ModuleBase
 	outputFile android.Path
@@ -0,0 +1,82 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package genrule
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"android/soong/android"
+)
+
+func networkAccessSingletonFactory() android.Singleton {
+	return &networkAccessSingleton{}
+}
+
+// networkAccessSingleton reports the genrules that opted out of running without network access,
+// so that their number can be tracked on the build servers, and merges the logs of the genrule
+// commands that sbox could not run without network access.
+type networkAccessSingleton struct {
+	modules   []string
+	report    android.WritablePath
+	fallbacks android.WritablePath
+}
+
+func (n *networkAccessSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	var logs android.Paths
+	ctx.VisitAllModules(func(module android.Module) {
+		if g, ok := module.(*Module); ok {
+			if Bool(g.properties.Allow_network) {
+				n.modules = append(n.modules, ctx.ModuleName(module)+" "+ctx.BlueprintFile(module))
+			}
+			logs = append(logs, g.networkIsolationLogs...)
+		}
+	})
+	n.modules = android.FirstUniqueStrings(n.modules)
+	sort.Strings(n.modules)
+
+	n.report = android.PathForOutput(ctx, "genrule_network_access.txt")
+	content := ""
+	if len(n.modules) > 0 {
+		content = strings.Join(n.modules, "\n") + "\n"
+	}
+	android.WriteFileRule(ctx, n.report, content)
+
+	// The number of genrules with network access is read by soong_ui after running soong_build
+	// and added to the build metrics, so it is written directly instead of by a rule.
+	metrics := android.PathForOutput(ctx, ".genrule_network_access.metrics")
+	if err := android.WriteFileToOutputDir(metrics, []byte(strconv.Itoa(len(n.modules))+"\n"), 0666); err != nil {
+		ctx.Errorf(err.Error())
+	}
+
+	// Each genrule command that is run without network access writes its own log, which is empty
+	// unless sbox had to run the command with network access.
+	n.fallbacks = android.PathForOutput(ctx, "genrule_network_isolation_fallbacks.txt")
+	rule := android.NewRuleBuilder()
+	rule.Command().
+		Text("xargs cat <").
+		FlagWithRspFileInputList("", logs).
+		Text(">").Output(n.fallbacks)
+	rule.Build(pctx, ctx, "genrule_network_isolation_fallbacks", "merge genrule network isolation logs")
+}
+
+func (n *networkAccessSingleton) MakeVars(ctx android.MakeVarsContext) {
+	ctx.Strict("SOONG_GENRULE_NETWORK_ACCESS_COUNT", strconv.Itoa(len(n.modules)))
+	ctx.Strict("SOONG_GENRULE_NETWORK_ISOLATION_FALLBACKS", n.fallbacks.String())
+	ctx.DistForGoal("droidcore", n.report, n.fallbacks)
+}
+
+var _ android.SingletonMakeVarsProvider = (*networkAccessSingleton)(nil)
@@ -30,6 +30,7 @@ import (
 const (
 	MetaDir         = "META-INF/"
 	ManifestFile    = MetaDir + "MANIFEST.MF"
+	ServicesDir     = MetaDir + "services/"
 	ModuleInfoClass = "module-info.class"
 )
 
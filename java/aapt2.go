@@ -66,6 +66,7 @@ func aapt2Compile(ctx android.ModuleContext, dir android.Path, paths android.Pat
 	shards := android.ShardPaths(paths, AAPT2_SHARD_SIZE)
 
 	ret := make(android.WritablePaths, 0, len(paths))
+	stamps := toolchainStamps(ctx)
 
 	for i, shard := range shards {
 		outPaths := pathsToAapt2Paths(ctx, shard)
@@ -81,6 +82,7 @@ func aapt2Compile(ctx android.ModuleContext, dir android.Path, paths android.Pat
 			Description: "aapt2 compile " + dir.String() + shardDesc,
 			Inputs:      shard,
 			Outputs:     outPaths,
+			OrderOnly:   stamps,
 			Args: map[string]string{
 				"outDir": android.PathForModuleOut(ctx, "aapt2", dir.String()).String(),
 				"cFlags": strings.Join(flags, " "),
@@ -115,6 +117,7 @@ func aapt2CompileZip(ctx android.ModuleContext, flata android.WritablePath, zip
 		Description: "aapt2 compile zip",
 		Input:       zip,
 		Output:      flata,
+		OrderOnly:   toolchainStamps(ctx),
 		Args: map[string]string{
 			"cFlags":       strings.Join(flags, " "),
 			"resZipDir":    android.PathForModuleOut(ctx, "aapt2", "reszip", flata.Base()).String(),
@@ -154,7 +157,7 @@ var mergeAssetsRule = pctx.AndroidStaticRule("mergeAssets",
 	})
 
 func aapt2Link(ctx android.ModuleContext,
-	packageRes, genJar, proguardOptions, rTxt, extraPackages android.WritablePath,
+	packageRes, genJar, proguardOptions, mainDexProguardOptions, rTxt, extraPackages android.WritablePath,
 	flags []string, deps android.Paths,
 	compiledRes, compiledOverlay, assetPackages android.Paths, splitPackages android.WritablePaths) {
 
@@ -192,6 +195,13 @@ func aapt2Link(ctx android.ModuleContext,
 	}
 
 	implicitOutputs := append(splitPackages, proguardOptions, genJar, rTxt, extraPackages)
+
+	// The keep rules for the components in the manifest select the classes of the primary dex file of
+	// apps that use multiple dex files on releases without native multidex support.
+	if mainDexProguardOptions != nil {
+		flags = append(flags, "--proguard-main-dex "+mainDexProguardOptions.String())
+		implicitOutputs = append(implicitOutputs, mainDexProguardOptions)
+	}
 	linkOutput := packageRes
 
 	// AAPT2 ignores assets in overlays. Merge them after linking.
@@ -212,6 +222,7 @@ func aapt2Link(ctx android.ModuleContext,
 		Implicits:       deps,
 		Output:          linkOutput,
 		ImplicitOutputs: implicitOutputs,
+		OrderOnly:       toolchainStamps(ctx),
 		Args: map[string]string{
 			"flags":           strings.Join(flags, " "),
 			"inFlags":         strings.Join(inFlags, " "),
@@ -235,6 +246,7 @@ func aapt2Convert(ctx android.ModuleContext, out android.WritablePath, in androi
 		Rule:        aapt2ConvertRule,
 		Input:       in,
 		Output:      out,
+		OrderOnly:   toolchainStamps(ctx),
 		Description: "convert to proto",
 	})
 }
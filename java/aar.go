@@ -89,6 +89,7 @@ type aapt struct {
 	manifestPath            android.Path
 	transitiveManifestPaths android.Paths
 	proguardOptionsFile     android.Path
+	mainDexProguardOptions  android.Path
 	rroDirs                 []rroDir
 	rTxt                    android.Path
 	extraAaptPackagesFile   android.Path
@@ -104,6 +105,9 @@ type aapt struct {
 	LoggingParent           string
 	resourceFiles           android.Paths
 
+	// Zips of Android resources generated by the module, e.g. the renderscript bitcode.
+	extraResZips android.Paths
+
 	splitNames []string
 	splits     []split
 
@@ -258,6 +262,7 @@ func (a *aapt) buildActions(ctx android.ModuleContext, sdkContext sdkContext, ex
 
 	compileFlags, linkFlags, linkDeps, resDirs, overlayDirs, rroDirs, resZips := a.aapt2Flags(ctx, sdkContext, manifestPath)
 
+	resZips = append(resZips, a.extraResZips...)
 	rroDirs = append(rroDirs, staticRRODirs...)
 	linkFlags = append(linkFlags, libFlags...)
 	linkDeps = append(linkDeps, libDeps...)
@@ -270,6 +275,10 @@ func (a *aapt) buildActions(ctx android.ModuleContext, sdkContext sdkContext, ex
 	// the subdir "android" is required to be filtered by package names
 	srcJar := android.PathForModuleGen(ctx, "android", "R.srcjar")
 	proguardOptionsFile := android.PathForModuleGen(ctx, "proguard.options")
+	var mainDexProguardOptions android.WritablePath
+	if !a.isLibrary {
+		mainDexProguardOptions = android.PathForModuleGen(ctx, "main_dex_proguard.options")
+	}
 	rTxt := android.PathForModuleOut(ctx, "R.txt")
 	// This file isn't used by Soong, but is generated for exporting
 	extraPackages := android.PathForModuleOut(ctx, "extra_packages")
@@ -329,7 +338,7 @@ func (a *aapt) buildActions(ctx android.ModuleContext, sdkContext sdkContext, ex
 		})
 	}
 
-	aapt2Link(ctx, packageRes, srcJar, proguardOptionsFile, rTxt, extraPackages,
+	aapt2Link(ctx, packageRes, srcJar, proguardOptionsFile, mainDexProguardOptions, rTxt, extraPackages,
 		linkFlags, linkDeps, compiledRes, compiledOverlay, assetPackages, splitPackages)
 
 	// Extract assets from the resource package output so that they can be used later in aapt2link
@@ -349,6 +358,7 @@ func (a *aapt) buildActions(ctx android.ModuleContext, sdkContext sdkContext, ex
 	a.exportPackage = packageRes
 	a.manifestPath = manifestPath
 	a.proguardOptionsFile = proguardOptionsFile
+	a.mainDexProguardOptions = mainDexProguardOptions
 	a.rroDirs = rroDirs
 	a.extraAaptPackagesFile = extraPackages
 	a.rTxt = rTxt
@@ -466,6 +476,12 @@ func (a *AndroidLibrary) DepsMutator(ctx android.BottomUpMutatorContext) {
 func (a *AndroidLibrary) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 	a.aapt.isLibrary = true
 	a.aapt.sdkLibraries = a.exportedSdkLibs
+
+	a.Module.renderscriptBuildActions(ctx)
+	if a.renderscriptResZip != nil {
+		a.aapt.extraResZips = append(a.aapt.extraResZips, a.renderscriptResZip)
+	}
+
 	a.aapt.buildActions(ctx, sdkContext(a))
 
 	ctx.CheckbuildFile(a.proguardOptionsFile)
@@ -489,6 +505,7 @@ func (a *AndroidLibrary) GenerateAndroidBuildActions(ctx android.ModuleContext)
 	if a.androidLibraryProperties.BuildAAR {
 		BuildAAR(ctx, a.aarFile, a.outputFile, a.manifestPath, a.rTxt, res)
 		ctx.CheckbuildFile(a.aarFile)
+		a.Module.publishToMaven(ctx, a.aarFile)
 	}
 
 	ctx.VisitDirectDeps(func(m android.Module) {
@@ -515,10 +532,12 @@ func AndroidLibraryFactory() android.Module {
 	module.Module.addHostAndDeviceProperties()
 	module.AddProperties(
 		&module.aaptProperties,
-		&module.androidLibraryProperties)
+		&module.androidLibraryProperties,
+		&module.maven.properties)
 
 	module.androidLibraryProperties.BuildAAR = true
 	module.Module.linter.library = true
+	module.Module.maven.aar = true
 
 	android.InitApexModule(module)
 	InitJavaModule(module, android.DeviceSupported)
@@ -712,7 +731,7 @@ func (a *AARImport) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 
 	overlayRes := append(android.Paths{flata}, transitiveStaticLibs...)
 
-	aapt2Link(ctx, a.exportPackage, srcJar, proguardOptionsFile, rTxt, a.extraAaptPackagesFile,
+	aapt2Link(ctx, a.exportPackage, srcJar, proguardOptionsFile, nil, rTxt, a.extraAaptPackagesFile,
 		linkFlags, linkDeps, nil, overlayRes, transitiveAssets, nil)
 }
 
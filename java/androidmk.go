@@ -91,8 +91,8 @@ func (library *Library) AndroidMkEntries() []android.AndroidMkEntries {
 	} else {
 		mainEntries = android.AndroidMkEntries{
 			Class:      "JAVA_LIBRARIES",
-			DistFile:   android.OptionalPathForPath(library.distFile),
 			OutputFile: android.OptionalPathForPath(library.outputFile),
+			Required:   android.CopyOf(library.properties.Host_jni_libs),
 			Include:    "$(BUILD_SYSTEM)/soong_java_prebuilt.mk",
 			ExtraEntries: []android.AndroidMkExtraEntriesFunc{
 				func(entries *android.AndroidMkEntries) {
@@ -162,10 +162,12 @@ func (j *Test) AndroidMkEntries() []android.AndroidMkEntries {
 		if j.testConfig != nil {
 			entries.SetPath("LOCAL_FULL_TEST_CONFIG", j.testConfig)
 		}
+		entries.AddStrings("LOCAL_EXTRA_FULL_TEST_CONFIGS", j.extraTestConfigs.Strings()...)
 		androidMkWriteTestData(j.data, entries)
 		if !BoolDefault(j.testProperties.Auto_gen_config, true) {
 			entries.SetString("LOCAL_DISABLE_AUTO_GENERATE_TEST_CONFIG", "true")
 		}
+		entries.SetBoolIfTrue("LOCAL_IS_UNIT_TEST", Bool(j.testProperties.Test_options.Unit_test))
 	})
 
 	return entriesList
@@ -262,6 +264,7 @@ func (binary *Binary) AndroidMkEntries() []android.AndroidMkEntries {
 		return []android.AndroidMkEntries{android.AndroidMkEntries{
 			Class:      "JAVA_LIBRARIES",
 			OutputFile: android.OptionalPathForPath(binary.outputFile),
+			Required:   android.CopyOf(binary.properties.Host_jni_libs),
 			Include:    "$(BUILD_SYSTEM)/soong_java_prebuilt.mk",
 			ExtraEntries: []android.AndroidMkExtraEntriesFunc{
 				func(entries *android.AndroidMkEntries) {
@@ -288,6 +291,9 @@ func (binary *Binary) AndroidMkEntries() []android.AndroidMkEntries {
 			ExtraEntries: []android.AndroidMkExtraEntriesFunc{
 				func(entries *android.AndroidMkEntries) {
 					entries.SetBool("LOCAL_STRIP_MODULE", false)
+					if binary.wrapperFile.Ext() == ".bat" {
+						entries.SetString("LOCAL_MODULE_SUFFIX", ".bat")
+					}
 				},
 			},
 			ExtraFooters: []android.AndroidMkExtraFootersFunc{
@@ -409,6 +415,12 @@ func (app *AndroidApp) AndroidMkEntries() []android.AndroidMkEntries {
 					fmt.Fprintf(w, "$(call dist-for-goals,%s,%s:%s)\n",
 						app.installApkName, app.noticeOutputs.HtmlOutput.String(), app.installApkName+"_NOTICE.html")
 				}
+				if app.unbundledBuildApp {
+					// Apps built by an unbundled apps build are collected in the apps directory of
+					// the dist directory.
+					fmt.Fprintf(w, "$(call dist-for-goals,apps_only,%s:apps/%s.apk)\n",
+						app.outputFile.String(), app.installApkName)
+				}
 			},
 		},
 	}}
@@ -651,6 +663,15 @@ func (dstubs *Droidstubs) AndroidMkEntries() []android.AndroidMkEntries {
 							dstubs.apiLintReport.String(), "apilint/"+dstubs.Name()+"-lint-report.txt")
 					}
 				}
+				if dstubs.updateApiLintBaselineTimestamp != nil {
+					fmt.Fprintln(w, ".PHONY:", dstubs.Name()+"-update-api-lint-baseline")
+					fmt.Fprintln(w, dstubs.Name()+"-update-api-lint-baseline:",
+						dstubs.updateApiLintBaselineTimestamp.String())
+
+					fmt.Fprintln(w, ".PHONY: update-api-lint-baselines")
+					fmt.Fprintln(w, "update-api-lint-baselines:",
+						dstubs.updateApiLintBaselineTimestamp.String())
+				}
 				if dstubs.checkNullabilityWarningsTimestamp != nil {
 					fmt.Fprintln(w, ".PHONY:", dstubs.Name()+"-check-nullability-warnings")
 					fmt.Fprintln(w, dstubs.Name()+"-check-nullability-warnings:",
@@ -162,10 +162,175 @@ func TestDistWithTag(t *testing.T) {
 	if len(without_tag_entries) != 2 || len(with_tag_entries) != 2 {
 		t.Errorf("two mk entries per module expected, got %d and %d", len(without_tag_entries), len(with_tag_entries))
 	}
-	if !with_tag_entries[0].DistFile.Valid() || !strings.Contains(with_tag_entries[0].DistFile.String(), "/javac/foo_with_tag.jar") {
-		t.Errorf("expected classes.jar DistFile, got %v", with_tag_entries[0].DistFile)
+
+	distLine := func(entries android.AndroidMkEntries) string {
+		for _, line := range entries.HeaderLinesForTests() {
+			if strings.HasPrefix(line, "$(call dist-for-goals,") {
+				return line
+			}
+		}
+		return ""
+	}
+	if line := distLine(with_tag_entries[0]); !strings.Contains(line, "/javac/foo_with_tag.jar:foo_with_tag.jar)") {
+		t.Errorf("expected classes.jar to be disted, got %q", line)
+	}
+	if line := distLine(without_tag_entries[0]); !strings.Contains(line, "/dex/foo_without_tag.jar:foo_without_tag.jar)") {
+		t.Errorf("expected the output file to be disted, got %q", line)
+	}
+}
+
+func TestDistsWithTags(t *testing.T) {
+	ctx, config := testJava(t, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			compile_dex: true,
+			optimize: {
+				enabled: true,
+			},
+			dists: [
+				{
+					targets: ["hi"],
+					tag: ".jar",
+					dir: "jars",
+				},
+				{
+					targets: ["hi", "there"],
+					tag: ".proguard_map",
+					dest: "foo-mapping.txt",
+					dir: "mappings",
+				},
+			],
+		}
+	`)
+
+	entries := android.AndroidMkEntriesForTest(t, config, "", ctx.ModuleForTests("foo", "android_common").Module())
+
+	var distLines []string
+	for _, line := range entries[0].HeaderLinesForTests() {
+		if strings.HasPrefix(line, "$(call dist-for-goals,") {
+			distLines = append(distLines, line)
+		}
+	}
+
+	expected := []struct {
+		goals string
+		src   string
+		dest  string
+	}{
+		{goals: "hi", src: "/javac/foo.jar", dest: "jars/foo.jar"},
+		{goals: "hi there", src: "/proguard_dictionary", dest: "mappings/foo-mapping.txt"},
+	}
+	if len(distLines) != len(expected) {
+		t.Fatalf("expected %d dist lines, got %q", len(expected), distLines)
 	}
-	if without_tag_entries[0].DistFile.Valid() {
-		t.Errorf("did not expect explicit DistFile, got %v", without_tag_entries[0].DistFile)
+	for i, w := range expected {
+		prefix := "$(call dist-for-goals," + w.goals + ","
+		suffix := w.src + ":" + w.dest + ")"
+		if g := distLines[i]; !strings.HasPrefix(g, prefix) || !strings.HasSuffix(g, suffix) {
+			t.Errorf("expected dist line %q...%q, got %q", prefix, suffix, g)
+		}
+	}
+}
+
+func TestDistTagErrors(t *testing.T) {
+	testJavaError(t, `dists\[0\]\.tag: unsupported module reference tag ".unknown"`, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			dists: [
+				{
+					targets: ["hi"],
+					tag: ".unknown",
+				},
+			],
+		}
+	`)
+}
+
+func TestJavaTestOptions(t *testing.T) {
+	ctx, config := testJavaWithFS(t, `
+		java_test_host {
+			name: "foo",
+			srcs: ["a.java"],
+			test_suites: ["general-tests"],
+			test_mainline_modules: ["com.android.foo.apex"],
+			test_options: {
+				unit_test: true,
+				extra_test_configs: ["AndroidTest-sharded.xml"],
+			},
+		}
+	`, map[string][]byte{
+		"AndroidTest-sharded.xml": nil,
+	})
+
+	foo := ctx.ModuleForTests("foo", android.BuildOs.String()+"_common")
+	entries := android.AndroidMkEntriesForTest(t, config, "", foo.Module())[0]
+
+	if g, w := entries.EntryMap["LOCAL_IS_UNIT_TEST"], []string{"true"}; !reflect.DeepEqual(g, w) {
+		t.Errorf("expected LOCAL_IS_UNIT_TEST %q, got %q", w, g)
+	}
+	if g, w := entries.EntryMap["LOCAL_EXTRA_FULL_TEST_CONFIGS"], []string{"AndroidTest-sharded.xml"}; !reflect.DeepEqual(g, w) {
+		t.Errorf("expected LOCAL_EXTRA_FULL_TEST_CONFIGS %q, got %q", w, g)
+	}
+	if g, w := entries.EntryMap["LOCAL_COMPATIBILITY_SUITE"], []string{"general-tests"}; !reflect.DeepEqual(g, w) {
+		t.Errorf("expected LOCAL_COMPATIBILITY_SUITE %q, got %q", w, g)
+	}
+
+	testConfig := foo.Output("foo.config")
+	if g, w := testConfig.Args["template"], "${JavaHostTestConfigTemplate}"; g != w {
+		t.Errorf("expected test config template %q, got %q", w, g)
+	}
+	option := `<option name="config-descriptor:metadata" key="mainline-param" value="com.android.foo.apex" />`
+	if !strings.Contains(testConfig.Args["extraConfigs"], option) {
+		t.Errorf("expected %q in the test config, got %q", option, testConfig.Args["extraConfigs"])
+	}
+}
+
+func TestJavaTestData(t *testing.T) {
+	ctx, config := testJavaWithFS(t, `
+		java_test {
+			name: "foo",
+			srcs: ["a.java"],
+			host_supported: true,
+			data: [
+				"testdata/data.txt",
+				":foo_data",
+				":foo_gen",
+			],
+		}
+
+		filegroup {
+			name: "foo_data",
+			srcs: ["testdata/filegroup/*.txt"],
+		}
+
+		genrule {
+			name: "foo_gen",
+			cmd: "touch $(out)",
+			out: ["gen.txt"],
+		}
+	`, map[string][]byte{
+		"testdata/data.txt":        nil,
+		"testdata/filegroup/a.txt": nil,
+		"testdata/filegroup/b.txt": nil,
+	})
+
+	gen := ctx.ModuleForTests("foo_gen", "").Output("gen.txt").Output.String()
+	expected := []string{
+		"testdata/data.txt:testdata/data.txt",
+		"testdata/filegroup/a.txt:testdata/filegroup/a.txt",
+		"testdata/filegroup/b.txt:testdata/filegroup/b.txt",
+		gen + ":gen.txt",
+	}
+
+	for _, variant := range []string{"android_common", android.BuildOs.String() + "_common"} {
+		t.Run(variant, func(t *testing.T) {
+			foo := ctx.ModuleForTests("foo", variant).Module()
+			entries := android.AndroidMkEntriesForTest(t, config, "", foo)[0]
+			if g, w := entries.EntryMap["LOCAL_COMPATIBILITY_SUPPORT_FILES"], expected; !reflect.DeepEqual(g, w) {
+				t.Errorf("expected test data %q, got %q", w, g)
+			}
+		})
 	}
 }
@@ -28,6 +28,7 @@ import (
 
 	"android/soong/android"
 	"android/soong/cc"
+	"android/soong/dexpreopt"
 	"android/soong/tradefed"
 )
 
@@ -246,6 +247,11 @@ type appProperties struct {
 	HideFromMake      bool `blueprint:"mutated"`
 	IsCoverageVariant bool `blueprint:"mutated"`
 
+	// Human-readable baseline profile rules for the app.  The rules are compiled into a binary
+	// profile that is embedded in the APK under assets/dexopt, where it is used by install-time
+	// optimization.
+	Baseline_profiles []string `android:"path"`
+
 	// Whether this app is considered mainline updatable or not. When set to true, this will enforce
 	// additional rules to make sure an app can safely be updated. Default is false.
 	// Prefer using other specific properties if build behaviour must be changed; avoid using this
@@ -259,8 +265,15 @@ type overridableAppProperties struct {
 	// or an android_app_certificate module name in the form ":module".
 	Certificate *string
 
-	// Name of the signing certificate lineage file.
-	Lineage *string
+	// Name of the signing certificate lineage file, or a module that produces it in the form
+	// ":module".  The lineage allows the app to be signed with a rotated key using the v3
+	// signature scheme.
+	Lineage *string `android:"path"`
+
+	// Minimum SDK version at which the v3 signature rotates to the latest certificate in the
+	// lineage.  Devices running older versions verify the app against the original certificate.
+	// Requires lineage.
+	Rotation_min_sdk_version *string
 
 	// the package name of this app. The package name in the manifest file is used if one was not given.
 	Package_name *string
@@ -311,6 +324,9 @@ type AndroidApp struct {
 
 	overriddenManifestPackageName string
 
+	// true if this app is one of the apps being built by an unbundled apps build.
+	unbundledBuildApp bool
+
 	android.ApexBundleDepsInfo
 }
 
@@ -392,6 +408,7 @@ func (a *AndroidApp) DepsMutator(ctx android.BottomUpMutatorContext) {
 			variation = append(variation, blueprint.Variation{Mutator: "sdk", Variation: "sdk"})
 		}
 		ctx.AddFarVariationDependencies(variation, tag, a.appProperties.Jni_libs...)
+		ctx.AddFarVariationDependencies(variation, tag, a.renderscriptCompatJniLibs()...)
 	}
 
 	a.usesLibrary.deps(ctx, sdkDep.hasFrameworkLibs())
@@ -419,6 +436,7 @@ func (a *AndroidTestHelperApp) GenerateAndroidBuildActions(ctx android.ModuleCon
 }
 
 func (a *AndroidApp) GenerateAndroidBuildActions(ctx android.ModuleContext) {
+	a.unbundledBuildApp = android.InList(ctx.ModuleName(), ctx.Config().UnbundledBuildApps())
 	a.checkAppSdkVersions(ctx)
 	a.generateAndroidBuildActions(ctx)
 }
@@ -438,6 +456,11 @@ func (a *AndroidApp) checkAppSdkVersions(ctx android.ModuleContext) {
 		}
 	}
 
+	if a.unbundledBuildApp && !a.sdkVersion().usePrebuilt(ctx) {
+		ctx.PropertyErrorf("sdk_version", "apps built by an unbundled apps build must compile against a prebuilt SDK, found %v",
+			a.sdkVersion())
+	}
+
 	a.checkPlatformAPI(ctx)
 	a.checkSdkVersions(ctx)
 }
@@ -549,6 +572,12 @@ func (a *AndroidApp) aaptBuildActions(ctx android.ModuleContext) {
 	a.aapt.splitNames = a.appProperties.Package_splits
 	a.aapt.sdkLibraries = a.exportedSdkLibs
 	a.aapt.LoggingParent = String(a.overridableAppProperties.Logging_parent)
+
+	a.Module.renderscriptBuildActions(ctx)
+	if a.renderscriptResZip != nil {
+		a.aapt.extraResZips = append(a.aapt.extraResZips, a.renderscriptResZip)
+	}
+
 	a.aapt.buildActions(ctx, sdkContext(a), aaptLinkFlags...)
 
 	// apps manifests are handled by aapt, don't let Module see them
@@ -567,6 +596,10 @@ func (a *AndroidApp) proguardBuildActions(ctx android.ModuleContext) {
 
 	a.Module.extraProguardFlagFiles = append(a.Module.extraProguardFlagFiles, staticLibProguardFlagFiles...)
 	a.Module.extraProguardFlagFiles = append(a.Module.extraProguardFlagFiles, a.proguardOptionsFile)
+
+	if a.mainDexProguardOptions != nil {
+		a.Module.extraMainDexRuleFiles = append(a.Module.extraMainDexRuleFiles, a.mainDexProguardOptions)
+	}
 }
 
 func (a *AndroidApp) installPath(ctx android.ModuleContext) android.InstallPath {
@@ -594,6 +627,7 @@ func (a *AndroidApp) dexBuildActions(ctx android.ModuleContext) android.Path {
 	a.dexpreopter.usesLibs = a.usesLibrary.usesLibraryProperties.Uses_libs
 	a.dexpreopter.optionalUsesLibs = a.usesLibrary.presentOptionalUsesLibs(ctx)
 	a.dexpreopter.libraryPaths = a.usesLibrary.usesLibraryPaths(ctx)
+	a.dexpreopter.libraryDependencies = a.usesLibrary.usesLibraryDependencies(ctx)
 	a.dexpreopter.manifestFile = a.mergedManifestFile
 
 	if ctx.ModuleName() != "framework-res" {
@@ -603,6 +637,47 @@ func (a *AndroidApp) dexBuildActions(ctx android.ModuleContext) android.Path {
 	return a.maybeStrippedDexJarFile
 }
 
+// baselineProfileBuildActions compiles the baseline profile rules of the app against its dex
+// files and returns a dex jar with the resulting binary profile added under assets/dexopt, or the
+// given dex jar if the app has no baseline profile rules.
+func (a *AndroidApp) baselineProfileBuildActions(ctx android.ModuleContext, dexJarFile android.Path) android.Path {
+	rules := android.PathsForModuleSrc(ctx, a.appProperties.Baseline_profiles)
+	if len(rules) == 0 || dexJarFile == nil {
+		return dexJarFile
+	}
+
+	dir := android.PathForModuleOut(ctx, "baseline_profile")
+	mergedRules := dir.Join(ctx, "baseline-prof.txt")
+	profile := dir.Join(ctx, "assets", "dexopt", "baseline.prof")
+	profileMeta := dir.Join(ctx, "assets", "dexopt", "baseline.profm")
+	profileZip := dir.Join(ctx, "baseline_profile.zip")
+
+	rule := android.NewRuleBuilder()
+	rule.Command().Text("cat").Inputs(rules).FlagWithOutput("> ", mergedRules)
+	rule.Command().
+		BuiltTool(ctx, "profgen").
+		Flag("bin").
+		Input(mergedRules).
+		FlagWithInput("--apk ", a.dexJarFile).
+		FlagWithOutput("--output ", profile).
+		FlagWithOutput("--output-meta ", profileMeta)
+	rule.Command().
+		BuiltTool(ctx, "soong_zip").
+		FlagWithOutput("-o ", profileZip).
+		FlagWithArg("-C ", dir.String()).
+		FlagWithInput("-f ", profile).
+		FlagWithInput("-f ", profileMeta)
+	rule.Build(pctx, ctx, "baseline_profile", "baseline profile")
+
+	dexJarWithProfile := dir.Join(ctx, "classes-with-profile.jar")
+	ctx.Build(pctx, android.BuildParams{
+		Rule:   combineApk,
+		Inputs: android.Paths{dexJarFile, profileZip},
+		Output: dexJarWithProfile,
+	})
+	return dexJarWithProfile
+}
+
 func (a *AndroidApp) jniBuildActions(jniLibs []jniLib, ctx android.ModuleContext) android.WritablePath {
 	var jniJarFile android.WritablePath
 	if len(jniLibs) > 0 {
@@ -726,6 +801,29 @@ func processMainCert(m android.ModuleBase, certPropValue string, certificates []
 	return certificates
 }
 
+// signingLineage returns the signing certificate lineage file to sign an app with and the minimum
+// SDK version at which the v3 signature rotates to the latest certificate in the lineage.
+func signingLineage(ctx android.ModuleContext, lineage, rotationMinSdkVersion *string) (android.Path, string) {
+	var lineageFile android.Path
+	if String(lineage) != "" {
+		lineageFile = android.PathForModuleSrc(ctx, String(lineage))
+	}
+
+	if rotationMinSdkVersion == nil {
+		return lineageFile, ""
+	}
+	if lineageFile == nil {
+		ctx.PropertyErrorf("rotation_min_sdk_version", "requires lineage")
+		return nil, ""
+	}
+	minSdkVersion, err := android.ApiStrToNum(ctx, *rotationMinSdkVersion)
+	if err != nil {
+		ctx.PropertyErrorf("rotation_min_sdk_version", "%s", err)
+		return lineageFile, ""
+	}
+	return lineageFile, strconv.Itoa(minSdkVersion)
+}
+
 func (a *AndroidApp) InstallApkName() string {
 	return a.installApkName
 }
@@ -790,12 +888,18 @@ func (a *AndroidApp) generateAndroidBuildActions(ctx android.ModuleContext) {
 	if v4SigningRequested {
 		v4SignatureFile = android.PathForModuleOut(ctx, a.installApkName+".apk.idsig")
 	}
-	var lineageFile android.Path
-	if lineage := String(a.overridableAppProperties.Lineage); lineage != "" {
-		lineageFile = android.PathForModuleSrc(ctx, lineage)
+	lineageFile, rotationMinSdkVersion := signingLineage(ctx,
+		a.overridableAppProperties.Lineage, a.overridableAppProperties.Rotation_min_sdk_version)
+	packageDexJarFile := a.baselineProfileBuildActions(ctx, dexJarFile)
+	if android.ReleaseSigningEnabled(ctx, &a.releaseSigningProperties) {
+		// The v4 signature has to match the release signed APK that is installed, so it is
+		// written by the release signer rather than by signapk.
+		CreateAndSignAppPackage(ctx, packageFile, a.exportPackage, jniJarFile, packageDexJarFile, certificates, apkDeps, nil, lineageFile, rotationMinSdkVersion)
+		a.outputFile = android.ReleaseSignWithV4Signature(ctx, &a.releaseSigningProperties, packageFile, v4SignatureFile)
+	} else {
+		CreateAndSignAppPackage(ctx, packageFile, a.exportPackage, jniJarFile, packageDexJarFile, certificates, apkDeps, v4SignatureFile, lineageFile, rotationMinSdkVersion)
+		a.outputFile = packageFile
 	}
-	CreateAndSignAppPackage(ctx, packageFile, a.exportPackage, jniJarFile, dexJarFile, certificates, apkDeps, v4SignatureFile, lineageFile)
-	a.outputFile = packageFile
 	if v4SigningRequested {
 		a.extraOutputFiles = append(a.extraOutputFiles, v4SignatureFile)
 	}
@@ -806,7 +910,7 @@ func (a *AndroidApp) generateAndroidBuildActions(ctx android.ModuleContext) {
 		if v4SigningRequested {
 			v4SignatureFile = android.PathForModuleOut(ctx, a.installApkName+"_"+split.suffix+".apk.idsig")
 		}
-		CreateAndSignAppPackage(ctx, packageFile, split.path, nil, nil, certificates, apkDeps, v4SignatureFile, lineageFile)
+		CreateAndSignAppPackage(ctx, packageFile, split.path, nil, nil, certificates, apkDeps, v4SignatureFile, lineageFile, rotationMinSdkVersion)
 		a.extraOutputFiles = append(a.extraOutputFiles, packageFile)
 		if v4SigningRequested {
 			a.extraOutputFiles = append(a.extraOutputFiles, v4SignatureFile)
@@ -964,11 +1068,18 @@ func (a *AndroidApp) DepIsInSameApex(ctx android.BaseModuleContext, dep android.
 	return a.Library.DepIsInSameApex(ctx, dep)
 }
 
-// For OutputFileProducer interface
+// For OutputFileProducer interface.  The ".aapt.srcjar", ".export-package.apk" and ".R.txt" tags
+// export the R.java sources, the compiled resources and the resource symbols of an app, which lets
+// modules build against the resources of an app like framework-res with dependencies tracked by
+// Soong.
 func (a *AndroidApp) OutputFiles(tag string) (android.Paths, error) {
 	switch tag {
 	case ".aapt.srcjar":
 		return []android.Path{a.aaptSrcJar}, nil
+	case ".export-package.apk":
+		return []android.Path{a.exportPackage}, nil
+	case ".R.txt":
+		return []android.Path{a.rTxt}, nil
 	}
 	return a.Library.OutputFiles(tag)
 }
@@ -1315,8 +1426,15 @@ type AndroidAppImportProperties struct {
 	// be set for presigned modules.
 	Presigned *bool
 
-	// Name of the signing certificate lineage file.
-	Lineage *string
+	// Name of the signing certificate lineage file, or a module that produces it in the form
+	// ":module".  The lineage allows the app to be signed with a rotated key using the v3
+	// signature scheme.
+	Lineage *string `android:"path"`
+
+	// Minimum SDK version at which the v3 signature rotates to the latest certificate in the
+	// lineage.  Devices running older versions verify the app against the original certificate.
+	// Requires lineage.
+	Rotation_min_sdk_version *string
 
 	// Sign with the default system dev certificate. Must be used judiciously. Most imported apps
 	// need to either specify a specific certificate or be presigned.
@@ -1495,6 +1613,7 @@ func (a *AndroidAppImport) generateAndroidBuildActions(ctx android.ModuleContext
 	a.dexpreopter.usesLibs = a.usesLibrary.usesLibraryProperties.Uses_libs
 	a.dexpreopter.optionalUsesLibs = a.usesLibrary.presentOptionalUsesLibs(ctx)
 	a.dexpreopter.libraryPaths = a.usesLibrary.usesLibraryPaths(ctx)
+	a.dexpreopter.libraryDependencies = a.usesLibrary.usesLibraryDependencies(ctx)
 
 	dexOutput := a.dexpreopter.dexpreopt(ctx, jnisUncompressed)
 	if a.dexpreopter.uncompressedDex {
@@ -1520,11 +1639,9 @@ func (a *AndroidAppImport) generateAndroidBuildActions(ctx android.ModuleContext
 		}
 		a.certificate = certificates[0]
 		signed := android.PathForModuleOut(ctx, "signed", apkFilename)
-		var lineageFile android.Path
-		if lineage := String(a.properties.Lineage); lineage != "" {
-			lineageFile = android.PathForModuleSrc(ctx, lineage)
-		}
-		SignAppPackage(ctx, signed, dexOutput, certificates, nil, lineageFile)
+		lineageFile, rotationMinSdkVersion := signingLineage(ctx,
+			a.properties.Lineage, a.properties.Rotation_min_sdk_version)
+		SignAppPackage(ctx, signed, dexOutput, certificates, nil, lineageFile, rotationMinSdkVersion)
 		a.outputFile = signed
 	} else {
 		alignedApk := android.PathForModuleOut(ctx, "zip-aligned", apkFilename)
@@ -1717,8 +1834,15 @@ type RuntimeResourceOverlayProperties struct {
 	// module name in the form ":module".
 	Certificate *string
 
-	// Name of the signing certificate lineage file.
-	Lineage *string
+	// Name of the signing certificate lineage file, or a module that produces it in the form
+	// ":module".  The lineage allows the app to be signed with a rotated key using the v3
+	// signature scheme.
+	Lineage *string `android:"path"`
+
+	// Minimum SDK version at which the v3 signature rotates to the latest certificate in the
+	// lineage.  Devices running older versions verify the app against the original certificate.
+	// Requires lineage.
+	Rotation_min_sdk_version *string
 
 	// optional theme name. If specified, the overlay package will be applied
 	// only when the ro.boot.vendor.overlay.theme system property is set to the same value.
@@ -1785,11 +1909,9 @@ func (r *RuntimeResourceOverlay) GenerateAndroidBuildActions(ctx android.ModuleC
 	_, certificates := collectAppDeps(ctx, r, false, false)
 	certificates = processMainCert(r.ModuleBase, String(r.properties.Certificate), certificates, ctx)
 	signed := android.PathForModuleOut(ctx, "signed", r.Name()+".apk")
-	var lineageFile android.Path
-	if lineage := String(r.properties.Lineage); lineage != "" {
-		lineageFile = android.PathForModuleSrc(ctx, lineage)
-	}
-	SignAppPackage(ctx, signed, r.aapt.exportPackage, certificates, nil, lineageFile)
+	lineageFile, rotationMinSdkVersion := signingLineage(ctx,
+		r.properties.Lineage, r.properties.Rotation_min_sdk_version)
+	SignAppPackage(ctx, signed, r.aapt.exportPackage, certificates, nil, lineageFile, rotationMinSdkVersion)
 	r.certificate = certificates[0]
 
 	r.outputFile = signed
@@ -1878,7 +2000,8 @@ func (u *usesLibrary) presentOptionalUsesLibs(ctx android.BaseModuleContext) []s
 	return optionalUsesLibs
 }
 
-// usesLibraryPaths returns a map of module names of shared library dependencies to the paths to their dex jars.
+// usesLibraryPaths returns a map of module names of shared library dependencies, and of the shared libraries that
+// they use in turn, to the paths to their dex jars.
 func (u *usesLibrary) usesLibraryPaths(ctx android.ModuleContext) map[string]android.Path {
 	usesLibPaths := make(map[string]android.Path)
 
@@ -1887,6 +2010,8 @@ func (u *usesLibrary) usesLibraryPaths(ctx android.ModuleContext) map[string]and
 			if lib, ok := m.(Dependency); ok {
 				if dexJar := lib.DexJar(); dexJar != nil {
 					usesLibPaths[ctx.OtherModuleName(m)] = dexJar
+					// The dex jars of the libraries used indirectly are needed for the class loader context.
+					mergeSdkLibraryContexts(usesLibPaths, nil, m)
 				} else {
 					ctx.ModuleErrorf("module %q in uses_libs or optional_uses_libs must produce a dex jar, does it have installable: true?",
 						ctx.OtherModuleName(m))
@@ -1903,6 +2028,31 @@ func (u *usesLibrary) usesLibraryPaths(ctx android.ModuleContext) map[string]and
 	return usesLibPaths
 }
 
+// usesLibraryDependencies returns a map of module names of shared library dependencies, and of the shared libraries
+// that they use in turn, to the names of the SDK libraries that they use, so that the chains of shared libraries can
+// be followed when computing the class loader context for dexpreopt.
+func (u *usesLibrary) usesLibraryDependencies(ctx android.ModuleContext) map[string][]string {
+	usesLibDeps := make(map[string][]string)
+
+	ctx.VisitDirectDepsWithTag(usesLibTag, func(m android.Module) {
+		if lib, ok := m.(Dependency); ok {
+			name := ctx.OtherModuleName(m)
+			deps := android.FirstUniqueStrings(android.RemoveListFromList(lib.ExportedSdkLibs(), []string{name}))
+			if len(deps) > 0 {
+				usesLibDeps[name] = deps
+			}
+			mergeSdkLibraryContexts(nil, usesLibDeps, m)
+		}
+	})
+
+	if cycle := dexpreopt.UsesLibrariesCycle(usesLibDeps); cycle != nil {
+		ctx.ModuleErrorf("cycle in uses-libraries: %s", strings.Join(cycle, " -> "))
+		return nil
+	}
+
+	return usesLibDeps
+}
+
 // enforceUsesLibraries returns true of <uses-library> tags should be checked against uses_libs and optional_uses_libs
 // properties.  Defaults to true if either of uses_libs or optional_uses_libs is specified.  Will default to true
 // unconditionally in the future.
@@ -141,6 +141,63 @@ func TestAppSplits(t *testing.T) {
 	}
 }
 
+func TestAppResourceOutputFiles(t *testing.T) {
+	ctx := testApp(t, `
+		android_app {
+			name: "foo-res",
+			sdk_version: "current",
+		}
+
+		java_library {
+			name: "bar",
+			srcs: [
+				"a.java",
+				":foo-res{.aapt.srcjar}",
+			],
+			sdk_version: "current",
+		}
+
+		genrule {
+			name: "gen",
+			srcs: [
+				":foo-res{.export-package.apk}",
+				":foo-res{.R.txt}",
+			],
+			out: ["gen.txt"],
+			cmd: "cat $(in) > $(out)",
+		}
+	`)
+
+	fooRes := ctx.ModuleForTests("foo-res", "android_common").Module().(*AndroidApp)
+	outputFile := func(tag string) string {
+		t.Helper()
+		paths, err := fooRes.OutputFiles(tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(paths) != 1 {
+			t.Fatalf("expected a single %s output file, got %q", tag, paths)
+		}
+		return paths[0].String()
+	}
+	srcJar := outputFile(".aapt.srcjar")
+	exportPackage := outputFile(".export-package.apk")
+	rTxt := outputFile(".R.txt")
+
+	javac := ctx.ModuleForTests("bar", "android_common").Rule("javac")
+	if !strings.Contains(javac.Args["srcJars"], srcJar) {
+		t.Errorf("expected %q in bar srcjars %q", srcJar, javac.Args["srcJars"])
+	}
+	if !inList(srcJar, javac.Implicits.Strings()) {
+		t.Errorf("expected %q in bar javac inputs %q", srcJar, javac.Implicits.Strings())
+	}
+
+	gen := ctx.ModuleForTests("gen", "").Output("gen.txt")
+	if g, w := gen.Inputs.Strings(), []string{exportPackage, rTxt}; !reflect.DeepEqual(g, w) {
+		t.Errorf("expected gen inputs %q, got %q", w, g)
+	}
+}
+
 func TestAndroidAppSet(t *testing.T) {
 	ctx, config := testJava(t, `
 		android_app_set {
@@ -1016,6 +1073,28 @@ func TestAndroidResources(t *testing.T) {
 						module, testCase.rroDirs[module], rroDirs)
 				}
 			}
+
+			// The RRO dirs of apps are passed to Make, which generates the RRO packages, in
+			// LOCAL_RESOURCE_DIRS order (high to low priority).
+			for _, module := range []string{"foo", "bar"} {
+				var deviceRRODirs, productRRODirs []string
+				for _, d := range testCase.rroDirs[module] {
+					if strings.HasPrefix(d, "device:") {
+						deviceRRODirs = append([]string{strings.TrimPrefix(d, "device:")}, deviceRRODirs...)
+					} else {
+						productRRODirs = append([]string{strings.TrimPrefix(d, "product:")}, productRRODirs...)
+					}
+				}
+
+				app := ctx.ModuleForTests(module, "android_common").Module()
+				entries := android.AndroidMkEntriesForTest(t, config, "", app)[0]
+				if g, w := entries.EntryMap["LOCAL_SOONG_DEVICE_RRO_DIRS"], deviceRRODirs; !reflect.DeepEqual(g, w) {
+					t.Errorf("expected %s LOCAL_SOONG_DEVICE_RRO_DIRS %q, got %q", module, w, g)
+				}
+				if g, w := entries.EntryMap["LOCAL_SOONG_PRODUCT_RRO_DIRS"], productRRODirs; !reflect.DeepEqual(g, w) {
+					t.Errorf("expected %s LOCAL_SOONG_PRODUCT_RRO_DIRS %q, got %q", module, w, g)
+				}
+			}
 		})
 	}
 }
@@ -1534,6 +1613,52 @@ func TestCertificates(t *testing.T) {
 			expectedLineage:     "--lineage lineage.bin",
 			expectedCertificate: "cert/new_cert.x509.pem cert/new_cert.pk8",
 		},
+		{
+			name: "certificate lineage module",
+			bp: `
+				android_app {
+					name: "foo",
+					srcs: ["a.java"],
+					certificate: ":new_certificate",
+					lineage: ":lineage",
+					sdk_version: "current",
+				}
+
+				android_app_certificate {
+					name: "new_certificate",
+					certificate: "cert/new_cert",
+				}
+
+				filegroup {
+					name: "lineage",
+					srcs: ["lineage.bin"],
+				}
+			`,
+			certificateOverride: "",
+			expectedLineage:     "--lineage lineage.bin",
+			expectedCertificate: "cert/new_cert.x509.pem cert/new_cert.pk8",
+		},
+		{
+			name: "certificate lineage rotation",
+			bp: `
+				android_app {
+					name: "foo",
+					srcs: ["a.java"],
+					certificate: ":new_certificate",
+					lineage: "lineage.bin",
+					rotation_min_sdk_version: "28",
+					sdk_version: "current",
+				}
+
+				android_app_certificate {
+					name: "new_certificate",
+					certificate: "cert/new_cert",
+				}
+			`,
+			certificateOverride: "",
+			expectedLineage:     "--lineage lineage.bin --rotation-min-sdk-version 28",
+			expectedCertificate: "cert/new_cert.x509.pem cert/new_cert.pk8",
+		},
 	}
 
 	for _, test := range testCases {
@@ -2645,6 +2770,70 @@ func TestUsesLibraries(t *testing.T) {
 	}
 }
 
+func TestUsesLibrariesClassLoaderContext(t *testing.T) {
+	bp := `
+		java_sdk_library {
+			name: "foo",
+			srcs: ["a.java"],
+			api_packages: ["foo"],
+			sdk_version: "current",
+			libs: ["bar"],
+		}
+
+		java_sdk_library {
+			name: "bar",
+			srcs: ["a.java"],
+			api_packages: ["bar"],
+			sdk_version: "current",
+			libs: ["baz"],
+		}
+
+		java_sdk_library {
+			name: "baz",
+			srcs: ["a.java"],
+			api_packages: ["baz"],
+			sdk_version: "current",
+		}
+
+		android_app {
+			name: "app",
+			srcs: ["a.java"],
+			uses_libs: ["foo"],
+			sdk_version: "current",
+		}
+	`
+
+	config := testAppConfig(nil, bp, nil)
+	ctx := testContext()
+	run(t, ctx, config)
+
+	// The class loader context includes the libraries that foo uses directly and indirectly, each
+	// following the library that uses it.
+	cmd := ctx.ModuleForTests("app", "android_common").Rule("dexpreopt").RuleParams.Command
+	if w := `dex_preopt_target_libraries="/system/framework/foo.jar /system/framework/bar.jar ` +
+		`/system/framework/baz.jar"`; !strings.Contains(cmd, w) {
+		t.Errorf("wanted %q in %q", w, cmd)
+	}
+
+	// The stored class loader context nests the libraries that foo and bar use.
+	for _, w := range []string{
+		`--stored-class-loader-context=PCL[]{PCL[/system/framework/foo.jar]{`,
+		`PCL[/system/framework/bar.jar]{PCL[/system/framework/baz.jar]}`,
+	} {
+		if !strings.Contains(cmd, w) {
+			t.Errorf("wanted %q in %q", w, cmd)
+		}
+	}
+
+	barDexJar := ctx.ModuleForTests("bar", "android_common").Module().(*SdkLibrary).DexJar().String()
+	bazDexJar := ctx.ModuleForTests("baz", "android_common").Module().(*SdkLibrary).DexJar().String()
+	for _, w := range []string{barDexJar, bazDexJar} {
+		if !strings.Contains(cmd, w) {
+			t.Errorf("wanted dex jar %q of the indirectly used library in %q", w, cmd)
+		}
+	}
+}
+
 func TestCodelessApp(t *testing.T) {
 	testCases := []struct {
 		name   string
@@ -2942,6 +3131,126 @@ func TestUncompressDex(t *testing.T) {
 	}
 }
 
+func TestUnbundledBuildApps(t *testing.T) {
+	bp := `
+		android_app {
+			name: "foo",
+			srcs: ["a.java"],
+			sdk_version: "current",
+		}
+
+		android_app {
+			name: "bar",
+			srcs: ["a.java"],
+			platform_apis: true,
+		}
+	`
+
+	unbundledConfig := func(apps ...string) android.Config {
+		config := testAppConfig(nil, bp, nil)
+		config.TestProductVariables.Unbundled_build = proptools.BoolPtr(true)
+		config.TestProductVariables.Unbundled_build_apps = apps
+		return config
+	}
+
+	testJavaWithConfig(t, unbundledConfig("foo"))
+
+	testJavaErrorWithConfig(t, `module "bar".*apps built by an unbundled apps build must compile against a prebuilt SDK`,
+		unbundledConfig("foo", "bar"))
+}
+
+func TestReleaseSigning(t *testing.T) {
+	bp := `
+		android_app {
+			name: "foo",
+			srcs: ["a.java"],
+			sdk_version: "current",
+			release_signing: {
+				enabled: true,
+				keys: ["releasekey", "platform"],
+			},
+			v4_signature: true,
+		}
+
+		android_app {
+			name: "bar",
+			srcs: ["a.java"],
+			sdk_version: "current",
+		}
+	`
+
+	config := testAppConfig(nil, bp, nil)
+	config.TestProductVariables.Release_signer_command = proptools.StringPtr("vendor/signer --verbose")
+	ctx, _ := testJavaWithConfig(t, config)
+
+	foo := ctx.ModuleForTests("foo", "android_common")
+	signed := foo.Output("release_signed/foo.apk")
+	if signed.Input.String() != foo.Output("foo.apk").Output.String() {
+		t.Errorf("expected release signer input %q, got %q", foo.Output("foo.apk").Output.String(), signed.Input.String())
+	}
+	if keys := signed.Args["keys"]; keys != "releasekey platform" {
+		t.Errorf("expected release signer keys %q, got %q", "releasekey platform", keys)
+	}
+	if !android.InList("vendor/signer", signed.Implicits.Strings()) {
+		t.Errorf("expected the release signer in inputs %q", signed.Implicits.Strings())
+	}
+
+	// The v4 signature is written by the release signer for the release signed APK.
+	if len(signed.ImplicitOutputs) != 1 || !strings.HasSuffix(signed.ImplicitOutputs[0].String(), "/foo.apk.idsig") {
+		t.Errorf("expected the v4 signature in release signer outputs %q", signed.ImplicitOutputs.Strings())
+	} else if env := signed.Args["env"]; env != "V4_SIGNATURE_FILE="+signed.ImplicitOutputs[0].String() {
+		t.Errorf("expected the v4 signature file in release signer environment, got %q", env)
+	}
+	if flags := foo.Output("foo.apk").Args["flags"]; strings.Contains(flags, "--enable-v4") {
+		t.Errorf("expected signapk not to write the v4 signature, got flags %q", flags)
+	}
+	if outputFile := foo.Module().(*AndroidApp).OutputFile(); outputFile.String() != signed.Output.String() {
+		t.Errorf("expected output file %q, got %q", signed.Output.String(), outputFile.String())
+	}
+
+	bar := ctx.ModuleForTests("bar", "android_common")
+	if r := bar.MaybeOutput("release_signed/bar.apk"); r.Rule != nil {
+		t.Errorf("expected bar not to be release signed")
+	}
+}
+
+func TestBaselineProfiles(t *testing.T) {
+	ctx, _ := testJava(t, `
+		android_app {
+			name: "foo",
+			srcs: ["a.java"],
+			sdk_version: "current",
+			baseline_profiles: ["baseline-prof.txt"],
+		}
+
+		android_app {
+			name: "bar",
+			srcs: ["a.java"],
+			sdk_version: "current",
+		}
+	`)
+
+	foo := ctx.ModuleForTests("foo", "android_common")
+	profileZip := foo.Output("baseline_profile/baseline_profile.zip")
+	if !strings.Contains(profileZip.RuleParams.Command, "profgen bin") {
+		t.Errorf("expected profgen in baseline profile command %q", profileZip.RuleParams.Command)
+	}
+	if !strings.Contains(profileZip.RuleParams.Command, "assets/dexopt/baseline.prof") {
+		t.Errorf("expected assets/dexopt/baseline.prof in baseline profile command %q", profileZip.RuleParams.Command)
+	}
+
+	dexJarWithProfile := foo.Output("baseline_profile/classes-with-profile.jar").Output.String()
+	unsignedApk := foo.Output("foo-unsigned.apk")
+	if !android.InList(dexJarWithProfile, unsignedApk.Inputs.Strings()) {
+		t.Errorf("expected %q in apk inputs %q", dexJarWithProfile, unsignedApk.Inputs.Strings())
+	}
+
+	bar := ctx.ModuleForTests("bar", "android_common")
+	if r := bar.MaybeOutput("baseline_profile/baseline_profile.zip"); r.Rule != nil {
+		t.Errorf("expected no baseline profile for bar")
+	}
+}
+
 func checkAapt2LinkFlag(t *testing.T, aapt2Flags, flagName, expectedValue string) {
 	if expectedValue != "" {
 		expectedFlag := "--" + flagName + " " + expectedValue
@@ -0,0 +1,184 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+// This file contains the module types for the ART run-tests and the libcore tests, which are
+// java_test modules with the test configs and the expectation files that their test runners need.
+
+import (
+	"github.com/google/blueprint/proptools"
+
+	"android/soong/android"
+	"android/soong/tradefed"
+)
+
+func init() {
+	RegisterArtTestBuildComponents(android.InitRegistrationContext)
+}
+
+func RegisterArtTestBuildComponents(ctx android.RegistrationContext) {
+	ctx.RegisterModuleType("art_run_test", ArtRunTestFactory)
+	ctx.RegisterModuleType("libcore_test", LibcoreTestFactory)
+}
+
+type artRunTestProperties struct {
+	// the file with the expected standard output of the test.  It is installed with the test and
+	// compared to the output of the test by the test runner.  Defaults to expected-stdout.txt.
+	Expected_stdout *string `android:"path"`
+
+	// list of smali source files.  They are assembled into a dex file that is added to the dex jar
+	// of the test after the dex files compiled from the java sources, for the run-tests that need
+	// bytecode that javac doesn't generate.
+	Smali_srcs []string `android:"path"`
+
+	// list of java libraries whose dex files are added to the dex jar of the test after its own
+	// dex files, for the run-tests of multidex.  The libraries are not on the classpath of the test.
+	Multidex_libs []string
+
+	// list of extra arguments passed to dalvikvm by the run-test runner.
+	Dalvikvm_args []string
+}
+
+type ArtRunTest struct {
+	Test
+
+	artRunTestProperties artRunTestProperties
+
+	expectedStdout android.Path
+}
+
+var multidexLibTag = dependencyTag{name: "multidex-lib"}
+
+func (t *ArtRunTest) DepsMutator(ctx android.BottomUpMutatorContext) {
+	t.Library.DepsMutator(ctx)
+
+	ctx.AddVariationDependencies(nil, multidexLibTag, t.artRunTestProperties.Multidex_libs...)
+}
+
+func (t *ArtRunTest) GenerateAndroidBuildActions(ctx android.ModuleContext) {
+	t.expectedStdout = android.PathForModuleSrc(ctx,
+		proptools.StringDefault(t.artRunTestProperties.Expected_stdout, "expected-stdout.txt"))
+
+	configs := []tradefed.Config{
+		tradefed.Option{Name: "expected-stdout", Value: t.expectedStdout.Base()},
+		tradefed.Option{Name: "push-file", Key: t.expectedStdout.Base(),
+			Value: "/data/local/tmp/" + ctx.ModuleName() + "/" + t.expectedStdout.Base()},
+	}
+	for _, arg := range t.artRunTestProperties.Dalvikvm_args {
+		configs = append(configs, tradefed.Option{Name: "dalvikvm-arg", Value: arg})
+	}
+	t.generateTestConfigAndData(ctx, tradefed.AutoGenArtRunTestConfig, configs)
+	t.data = append(t.data, t.expectedStdout)
+
+	if smaliSrcs := android.PathsForModuleSrc(ctx, t.artRunTestProperties.Smali_srcs); len(smaliSrcs) > 0 {
+		t.extraDexJars = append(t.extraDexJars, t.assembleSmali(ctx, smaliSrcs))
+	}
+
+	ctx.VisitDirectDepsWithTag(multidexLibTag, func(m android.Module) {
+		if dep, ok := m.(Dependency); ok && dep.DexJar() != nil {
+			t.extraDexJars = append(t.extraDexJars, dep.DexJar())
+		} else {
+			ctx.PropertyErrorf("multidex_libs", "%q is not a dexed java library", ctx.OtherModuleName(m))
+		}
+	})
+
+	t.Library.GenerateAndroidBuildActions(ctx)
+}
+
+// assembleSmali assembles the smali sources of the test into a jar with a classes.dex file.
+func (t *ArtRunTest) assembleSmali(ctx android.ModuleContext, srcs android.Paths) android.Path {
+	// The error is reported by dexCommonFlags.
+	minSdkVersion, _ := t.minSdkVersion().effectiveVersion(ctx)
+
+	smaliDir := android.PathForModuleOut(ctx, "smali")
+	dexFile := smaliDir.Join(ctx, "classes.dex")
+	dexJar := smaliDir.Join(ctx, "classes.dex.jar")
+
+	rule := android.NewRuleBuilder()
+	rule.Command().
+		BuiltTool(ctx, "smali").
+		Text("assemble").
+		FlagWithArg("--api ", minSdkVersion.asNumberString()).
+		FlagWithOutput("-o ", dexFile).
+		Inputs(srcs)
+	rule.Command().
+		BuiltTool(ctx, "soong_zip").
+		FlagWithOutput("-o ", dexJar).
+		FlagWithArg("-C ", smaliDir.String()).
+		FlagWithInput("-f ", dexFile)
+	rule.Build(pctx, ctx, "smali", "smali")
+
+	return dexJar
+}
+
+// art_run_test builds an ART run-test: the dex jar of the test, with a Main class that prints to the
+// standard output, is installed into the test suites with the expected standard output of the test
+// and a test config that runs it with the ART run-test runner.  The smali sources and the multidex
+// libraries of the test are added to its dex jar as extra dex files.
+func ArtRunTestFactory() android.Module {
+	module := &ArtRunTest{}
+
+	module.addHostAndDeviceProperties()
+	module.AddProperties(&module.testProperties, &module.artRunTestProperties)
+
+	module.Module.properties.Installable = proptools.BoolPtr(true)
+	module.Module.dexpreopter.isTest = true
+	module.Module.linter.test = true
+
+	InitJavaModule(module, android.DeviceSupported)
+	return module
+}
+
+type libcoreTestProperties struct {
+	// list of files with the expected failures of the tests.  They are packaged into the test jar
+	// at their path relative to the module directory, and passed to the test runner.
+	Expectations []string `android:"path"`
+}
+
+type LibcoreTest struct {
+	Test
+
+	libcoreTestProperties libcoreTestProperties
+}
+
+func (t *LibcoreTest) GenerateAndroidBuildActions(ctx android.ModuleContext) {
+	expectations := android.PathsForModuleSrc(ctx, t.libcoreTestProperties.Expectations)
+	t.extraResources = append(t.extraResources, expectations...)
+
+	var configs []tradefed.Config
+	for _, e := range expectations {
+		configs = append(configs, tradefed.Option{Name: "core-expectation", Value: "/" + e.Rel()})
+	}
+	t.generateTestConfigAndData(ctx, tradefed.AutoGenLibcoreTestConfig, configs)
+
+	t.Library.GenerateAndroidBuildActions(ctx)
+}
+
+// libcore_test builds a jar of libcore tests, for example the CTS tests of the core libraries.  The
+// files with the expected failures are packaged into the jar and the test config runs the tests
+// with the libcore test runner, which skips the expected failures.
+func LibcoreTestFactory() android.Module {
+	module := &LibcoreTest{}
+
+	module.addHostAndDeviceProperties()
+	module.AddProperties(&module.testProperties, &module.libcoreTestProperties)
+
+	module.Module.properties.Installable = proptools.BoolPtr(true)
+	module.Module.dexpreopter.isTest = true
+	module.Module.linter.test = true
+
+	InitJavaModule(module, android.DeviceSupported)
+	return module
+}
@@ -0,0 +1,202 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestArtRunTest(t *testing.T) {
+	ctx, _ := testJavaWithFS(t, `
+		art_run_test {
+			name: "001-HelloWorld",
+			srcs: ["src/Main.java"],
+			sdk_version: "core_platform",
+		}
+
+		art_run_test {
+			name: "002-Sleep",
+			srcs: ["src/Main.java"],
+			sdk_version: "core_platform",
+			expected_stdout: "expected.txt",
+			data: ["data.txt"],
+		}
+	`, map[string][]byte{
+		"expected-stdout.txt": nil,
+		"expected.txt":        nil,
+		"data.txt":            nil,
+		"src/Main.java":       nil,
+	})
+
+	testCases := []struct {
+		name           string
+		expectedStdout string
+		data           []string
+	}{
+		{name: "001-HelloWorld", expectedStdout: "expected-stdout.txt", data: []string{"expected-stdout.txt"}},
+		{name: "002-Sleep", expectedStdout: "expected.txt", data: []string{"data.txt", "expected.txt"}},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			m := ctx.ModuleForTests(test.name, "android_common")
+
+			config := m.Output(test.name + ".config")
+			if g, w := config.Args["template"], "${ArtRunTestConfigTemplate}"; g != w {
+				t.Errorf("expected test config template %q, got %q", w, g)
+			}
+			option := `<option name="expected-stdout" value="` + test.expectedStdout + `" />`
+			if !strings.Contains(config.Args["extraConfigs"], option) {
+				t.Errorf("expected %q in the test config, got %q", option, config.Args["extraConfigs"])
+			}
+
+			data := m.Module().(*ArtRunTest).data.Strings()
+			if g, w := strings.Join(data, " "), strings.Join(test.data, " "); g != w {
+				t.Errorf("expected test data %q, got %q", w, g)
+			}
+
+			if m.MaybeOutput("dex/"+test.name+".jar").Rule == nil {
+				t.Errorf("expected the run-test to be dexed")
+			}
+		})
+	}
+}
+
+func TestLibcoreTest(t *testing.T) {
+	ctx, _ := testJavaWithFS(t, `
+		libcore_test {
+			name: "CtsLibcoreTestCases",
+			srcs: ["a.java"],
+			sdk_version: "core_platform",
+			expectations: [
+				"expectations/knownfailures.txt",
+				"expectations/taggedtests.txt",
+			],
+		}
+	`, map[string][]byte{
+		"expectations/knownfailures.txt": nil,
+		"expectations/taggedtests.txt":   nil,
+	})
+
+	m := ctx.ModuleForTests("CtsLibcoreTestCases", "android_common")
+
+	res := m.Output("res/CtsLibcoreTestCases.jar")
+	expectedArgs := "-C . -f expectations/knownfailures.txt -f expectations/taggedtests.txt"
+	if !strings.Contains(res.Args["jarArgs"], expectedArgs) {
+		t.Errorf("expected %q in the resource jar args, got %q", expectedArgs, res.Args["jarArgs"])
+	}
+
+	config := m.Output("CtsLibcoreTestCases.config")
+	if g, w := config.Args["template"], "${LibcoreTestConfigTemplate}"; g != w {
+		t.Errorf("expected test config template %q, got %q", w, g)
+	}
+	for _, option := range []string{
+		`<option name="core-expectation" value="/expectations/knownfailures.txt" />`,
+		`<option name="core-expectation" value="/expectations/taggedtests.txt" />`,
+	} {
+		if !strings.Contains(config.Args["extraConfigs"], option) {
+			t.Errorf("expected %q in the test config, got %q", option, config.Args["extraConfigs"])
+		}
+	}
+}
+
+func TestArtRunTestExtraDex(t *testing.T) {
+	ctx, _ := testJavaWithFS(t, `
+		art_run_test {
+			name: "003-Multidex",
+			srcs: ["src/Main.java"],
+			smali_srcs: ["smali/Test.smali"],
+			multidex_libs: ["003-Multidex-lib"],
+			dalvikvm_args: ["-Xjitthreshold:0"],
+			test_mainline_modules: ["com.android.art.apex"],
+			test_options: {
+				extra_test_configs: ["extra.xml"],
+			},
+			sdk_version: "core_platform",
+		}
+
+		java_library {
+			name: "003-Multidex-lib",
+			srcs: ["src-multidex/Second.java"],
+			sdk_version: "core_platform",
+			installable: true,
+		}
+	`, map[string][]byte{
+		"expected-stdout.txt":      nil,
+		"extra.xml":                nil,
+		"smali/Test.smali":         nil,
+		"src/Main.java":            nil,
+		"src-multidex/Second.java": nil,
+	})
+
+	m := ctx.ModuleForTests("003-Multidex", "android_common")
+	module := m.Module().(*ArtRunTest)
+
+	config := m.Output("003-Multidex.config")
+	for _, option := range []string{
+		`<option name="config-descriptor:metadata" key="mainline-param" value="com.android.art.apex" />`,
+		`<option name="push-file" key="expected-stdout.txt" value="/data/local/tmp/003-Multidex/expected-stdout.txt" />`,
+		`<option name="dalvikvm-arg" value="-Xjitthreshold:0" />`,
+	} {
+		if !strings.Contains(config.Args["extraConfigs"], option) {
+			t.Errorf("expected %q in the test config, got %q", option, config.Args["extraConfigs"])
+		}
+	}
+
+	if g, w := module.extraTestConfigs.Strings(), []string{"extra.xml"}; !reflect.DeepEqual(g, w) {
+		t.Errorf("expected extra test configs %q, got %q", w, g)
+	}
+
+	smali := m.Rule("smali")
+	if !strings.Contains(smali.RuleParams.Command, "assemble") ||
+		!strings.Contains(smali.RuleParams.Command, "smali/Test.smali") {
+		t.Errorf("expected smali/Test.smali to be assembled, got %q", smali.RuleParams.Command)
+	}
+
+	lib := ctx.ModuleForTests("003-Multidex-lib", "android_common").Module().(*Library)
+	expectedDexJars := []string{
+		m.Output("smali/classes.dex.jar").Output.String(),
+		lib.DexJar().String(),
+	}
+	if g, w := module.extraDexJars.Strings(), expectedDexJars; !reflect.DeepEqual(g, w) {
+		t.Errorf("expected extra dex jars %q, got %q", w, g)
+	}
+
+	extraDex := m.Output("extra_dex/003-Multidex.jar")
+	for _, jar := range expectedDexJars {
+		if !strings.Contains(extraDex.RuleParams.Command, jar) {
+			t.Errorf("expected %q to be added to the dex jar, got %q", jar, extraDex.RuleParams.Command)
+		}
+	}
+}
+
+func TestArtRunTestMultidexLibNotDexed(t *testing.T) {
+	testJavaError(t, `"003-Multidex-lib" is not a dexed java library`, `
+		art_run_test {
+			name: "003-Multidex",
+			srcs: ["a.java"],
+			multidex_libs: ["003-Multidex-lib"],
+			sdk_version: "core_platform",
+		}
+
+		java_library {
+			name: "003-Multidex-lib",
+			srcs: ["b.java"],
+			sdk_version: "core_platform",
+		}
+	`)
+}
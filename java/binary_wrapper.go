@@ -0,0 +1,202 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/proptools"
+
+	"android/soong/android"
+)
+
+var binaryWrapper = pctx.AndroidStaticRule("binaryWrapper",
+	blueprint.RuleParams{
+		Command:     `/bin/bash -c 'printf "%b" "$$0" > $out' '$content'`,
+		Description: "wrapper script $out",
+	},
+	"content")
+
+// nativeLauncher appends the configuration of a launcher to the java_launcher program, followed by
+// the length of the configuration and the magic string that java_launcher looks for.
+var nativeLauncher = pctx.AndroidStaticRule("nativeLauncher",
+	blueprint.RuleParams{
+		Command: `(cat $in $config && printf '%016d' $$(wc -c < $config) && printf JLAUNCH1) > $out && ` +
+			`chmod +x $out`,
+		Description: "native launcher $out",
+	},
+	"config")
+
+// The wrapper scripts generated for java_binary modules with generate_wrapper: true.  They are
+// installed to bin/ and run the main class with the jars installed to framework/ by the binary
+// and by its libs on the classpath.  Like jar-wrapper.sh, the bash script passes arguments that
+// start with -J to the JVM.
+
+var bashWrapperTemplate = template.Must(template.New("bash").Parse(`#!/bin/bash
+# Generated by Soong for {{.Name}}, do not edit.
+
+prog="$0"
+while [ -h "${prog}" ]; do
+    fullprog=$(/bin/ls -ld "${prog}")
+    fullprog=$(expr "${fullprog}" : '.* -> \(.*\)$')
+    if expr "x${fullprog}" : 'x/' >/dev/null; then
+        prog="${fullprog}"
+    else
+        prog="$(dirname "${prog}")/${fullprog}"
+    fi
+done
+progdir=$(cd "$(dirname "${prog}")" && pwd)
+
+declare -a javaOpts=()
+while expr "x$1" : 'x-J' >/dev/null; do
+    opt=$(expr "$1" : '-J-\{0,1\}\(.*\)')
+    javaOpts+=("-${opt}")
+    shift
+done
+
+exec java{{range .JvmFlags}} {{.}}{{end}}{{if .LibraryPath}} "-Djava.library.path={{.LibraryPath}}"{{end}} "${javaOpts[@]}" -cp "{{.Classpath}}" {{.MainClass}} "$@"
+`))
+
+var batWrapperTemplate = template.Must(template.New("bat").Parse(`@echo off
+rem Generated by Soong for {{.Name}}, do not edit.
+setlocal
+set progdir=%~dp0
+java{{range .JvmFlags}} {{.}}{{end}}{{if .LibraryPath}} "-Djava.library.path={{.LibraryPath}}"{{end}} -cp "{{.Classpath}}" {{.MainClass}} %*
+`))
+
+type binaryWrapperParams struct {
+	Name        string
+	JvmFlags    []string
+	LibraryPath string
+	Classpath   string
+	MainClass   string
+}
+
+// generateBinaryWrapper writes a wrapper script to outputFile that runs mainClass with the given
+// jars, which are installed to framework/, on the classpath, and the given directories of the
+// host output directory, such as lib64, on the java.library.path.  A .bat file is generated for
+// Windows, and a bash script otherwise.
+func generateBinaryWrapper(ctx android.ModuleContext, outputFile android.WritablePath,
+	jars []string, libDirs []string, mainClass string, jvmFlags []string) {
+
+	params := binaryWrapperParams{
+		Name:      ctx.ModuleName(),
+		MainClass: mainClass,
+	}
+
+	var classpath []string
+	tmpl := bashWrapperTemplate
+	if ctx.Os() == android.Windows {
+		tmpl = batWrapperTemplate
+		for _, jar := range jars {
+			classpath = append(classpath, `%progdir%..\framework\`+jar)
+		}
+		params.Classpath = strings.Join(classpath, ";")
+		var libraryPath []string
+		for _, dir := range libDirs {
+			libraryPath = append(libraryPath, `%progdir%..\`+dir)
+		}
+		params.LibraryPath = strings.Join(libraryPath, ";")
+		params.JvmFlags = jvmFlags
+	} else {
+		for _, jar := range jars {
+			classpath = append(classpath, "${progdir}/../framework/"+jar)
+		}
+		params.Classpath = strings.Join(classpath, ":")
+		var libraryPath []string
+		for _, dir := range libDirs {
+			libraryPath = append(libraryPath, "${progdir}/../"+dir)
+		}
+		params.LibraryPath = strings.Join(libraryPath, ":")
+		params.JvmFlags = proptools.ShellEscapeList(jvmFlags)
+		params.MainClass = proptools.ShellEscape(mainClass)
+	}
+
+	var content strings.Builder
+	if err := tmpl.Execute(&content, params); err != nil {
+		panic(err)
+	}
+
+	script := content.String()
+	if ctx.Os() == android.Windows {
+		script = strings.ReplaceAll(script, "\n", "\r\n")
+	}
+
+	ctx.Build(pctx, android.BuildParams{
+		Rule:   binaryWrapper,
+		Output: outputFile,
+		Args: map[string]string{
+			"content": escapeBinaryWrapper(script),
+		},
+	})
+}
+
+// generateNativeLauncher writes a native launcher to outputFile that runs mainClass like the script
+// written by generateBinaryWrapper, with the java of the JDK in javaHome, which is relative to the
+// top of the source tree.  The launcher looks for javaHome in the directories above the one it is
+// installed to, so it keeps working when the source tree, or the host tools together with the JDK,
+// are moved.  The launcher is a copy of the java_launcher program with the configuration of the
+// binary appended to it.
+func generateNativeLauncher(ctx android.ModuleContext, outputFile android.WritablePath,
+	launcher android.Path, javaHome string, jars []string, libDirs []string, mainClass string,
+	jvmFlags []string) {
+
+	var config strings.Builder
+	add := func(key, value string) {
+		if strings.ContainsAny(value, "\r\n") {
+			ctx.PropertyErrorf("native_launcher", "%s %q cannot contain a newline", key, value)
+		}
+		fmt.Fprintf(&config, "%s %s\n", key, value)
+	}
+	add("java_home", javaHome)
+	add("main_class", mainClass)
+	for _, jar := range jars {
+		add("classpath", "../framework/"+jar)
+	}
+	for _, dir := range libDirs {
+		add("library_path", "../"+dir)
+	}
+	for _, flag := range jvmFlags {
+		add("jvm_flag", flag)
+	}
+
+	configFile := android.PathForModuleOut(ctx, outputFile.Base()+".launcher_config")
+	android.WriteFileRule(ctx, configFile, config.String())
+
+	ctx.Build(pctx, android.BuildParams{
+		Rule:     nativeLauncher,
+		Input:    launcher,
+		Implicit: configFile,
+		Output:   outputFile,
+		Args: map[string]string{
+			"config": configFile.String(),
+		},
+	})
+}
+
+// escapeBinaryWrapper escapes the script for the binaryWrapper rule, which passes it through
+// ninja, a single quoted bash argument and printf %b.
+func escapeBinaryWrapper(content string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		"\n", `\n`,
+		"\r", `\r`,
+		`'`, `'\''`,
+		`$`, `$$`,
+	).Replace(content)
+}
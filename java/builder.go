@@ -42,14 +42,15 @@ var (
 	// TODO(b/143658984): goma can't handle the --system argument to javac.
 	javac, javacRE = remoteexec.MultiCommandStaticRules(pctx, "javac",
 		blueprint.RuleParams{
-			Command: `rm -rf "$outDir" "$annoDir" "$srcJarDir" && mkdir -p "$outDir" "$annoDir" "$srcJarDir" && ` +
+			Command: `rm -rf "$outDir" "$annoDir" "$srcJarDir" $jniHeadersDir && ` +
+				`mkdir -p "$outDir" "$annoDir" "$srcJarDir" $jniHeadersDir && ` +
 				`${config.ZipSyncCmd} -d $srcJarDir -l $srcJarDir/list -f "*.java" $srcJars && ` +
 				`(if [ -s $srcJarDir/list ] || [ -s $out.rsp ] ; then ` +
 				`${config.SoongJavacWrapper} $javaTemplate${config.JavacCmd} ` +
 				`${config.JavacHeapFlags} ${config.JavacVmFlags} ${config.CommonJdkFlags} ` +
-				`$processorpath $processor $javacFlags $bootClasspath $classpath ` +
-				`-source $javaVersion -target $javaVersion ` +
-				`-d $outDir -s $annoDir @$out.rsp @$srcJarDir/list ; fi ) && ` +
+				`$processorpath $processor $javacFlags $bootClasspath $classpath $javaVersionFlags ` +
+				`-d $outDir -s $annoDir $jniHeadersFlags @$out.rsp @$srcJarDir/list ; fi ) && ` +
+				`$annoSrcJarTemplate${config.SoongZipCmd} -jar -o $annoSrcJar -C $annoDir -D $annoDir && ` +
 				`$zipTemplate${config.SoongZipCmd} -jar -o $out -C $outDir -D $outDir && ` +
 				`rm -rf "$srcJarDir"`,
 			CommandDeps: []string{
@@ -66,6 +67,13 @@ var (
 				ExecStrategy: "${config.REJavacExecStrategy}",
 				Platform:     map[string]string{remoteexec.PoolKey: "${config.REJavaPool}"},
 			},
+			"$annoSrcJarTemplate": &remoteexec.REParams{
+				Labels:       map[string]string{"type": "tool", "name": "soong_zip"},
+				Inputs:       []string{"${config.SoongZipCmd}", "$annoDir"},
+				OutputFiles:  []string{"$annoSrcJar"},
+				ExecStrategy: "${config.REJavacExecStrategy}",
+				Platform:     map[string]string{remoteexec.PoolKey: "${config.REJavaPool}"},
+			},
 			"$zipTemplate": &remoteexec.REParams{
 				Labels:       map[string]string{"type": "tool", "name": "soong_zip"},
 				Inputs:       []string{"${config.SoongZipCmd}", "$outDir"},
@@ -74,7 +82,7 @@ var (
 				Platform:     map[string]string{remoteexec.PoolKey: "${config.REJavaPool}"},
 			},
 		}, []string{"javacFlags", "bootClasspath", "classpath", "processorpath", "processor", "srcJars", "srcJarDir",
-			"outDir", "annoDir", "javaVersion"}, nil)
+			"outDir", "annoDir", "annoSrcJar", "javaVersionFlags", "jniHeadersDir", "jniHeadersFlags"}, nil)
 
 	_ = pctx.VariableFunc("kytheCorpus",
 		func(ctx android.PackageVarContext) string { return ctx.Config().XrefCorpusName() })
@@ -212,6 +220,17 @@ var (
 		},
 		"packages")
 
+	// Copies the jar to $out if all the classes in it are in the allowed packages, so that the rules
+	// that use the checked jar fail when a class is outside of them.
+	packageCheckedJar = pctx.AndroidStaticRule("packageCheckedJar",
+		blueprint.RuleParams{
+			Command: "rm -f $out && " +
+				"${config.PackageCheckCmd} $in $packages && " +
+				"cp -f $in $out",
+			CommandDeps: []string{"${config.PackageCheckCmd}"},
+		},
+		"packages")
+
 	jetifier = pctx.AndroidStaticRule("jetifier",
 		blueprint.RuleParams{
 			Command:     "${config.JavaCmd}  ${config.JavaVmFlags} -jar ${config.JetifierJar} -l error -o $out -i $in",
@@ -249,6 +268,13 @@ type javaBuilderFlags struct {
 	aidlDeps       android.Paths
 	javaVersion    javaVersion
 
+	// Whether javac can select javaVersion with --release, which is only the case when the module
+	// sets java_version explicitly.
+	javaVersionRelease bool
+
+	// The stamps of the verified toolchains, which the compile actions are ordered after.
+	toolchainStamps android.Paths
+
 	errorProneExtraJavacFlags string
 	errorProneProcessorPath   classpath
 
@@ -256,10 +282,18 @@ type javaBuilderFlags struct {
 	kotlincClasspath classpath
 
 	proto android.ProtoFlags
+
+	// The protoc flag that enables the gRPC plugin, the output directory is appended to it.
+	grpcOutFlag string
 }
 
+// TransformJavaToClasses compiles java sources into a jar of .class files in outputFile, and
+// packages the sources generated by annotation processors into a srcjar in annoSrcJar.  If
+// jniHeadersDir is not nil javac also generates the JNI headers for the native methods of the
+// sources into it.
 func TransformJavaToClasses(ctx android.ModuleContext, outputFile android.WritablePath, shardIdx int,
-	srcFiles, srcJars android.Paths, flags javaBuilderFlags, deps android.Paths) {
+	srcFiles, srcJars android.Paths, annoSrcJar android.WritablePath, jniHeadersDir android.Path,
+	flags javaBuilderFlags, deps android.Paths) {
 
 	// Compile java sources into .class files
 	desc := "javac"
@@ -267,7 +301,8 @@ func TransformJavaToClasses(ctx android.ModuleContext, outputFile android.Writab
 		desc += strconv.Itoa(shardIdx)
 	}
 
-	transformJavaToClasses(ctx, outputFile, shardIdx, srcFiles, srcJars, flags, deps, "javac", desc)
+	transformJavaToClasses(ctx, outputFile, shardIdx, srcFiles, srcJars, annoSrcJar, jniHeadersDir, flags,
+		deps, "javac", desc)
 }
 
 func RunErrorProne(ctx android.ModuleContext, outputFile android.WritablePath,
@@ -283,7 +318,11 @@ func RunErrorProne(ctx android.ModuleContext, outputFile android.WritablePath,
 		}
 	}
 
-	transformJavaToClasses(ctx, outputFile, -1, srcFiles, srcJars, flags, nil,
+	// The sources generated by the annotation processors are the same as the ones generated by
+	// javac, the srcjar is only used as an output of the rule.
+	annoSrcJar := android.PathForModuleOut(ctx, "errorprone", "anno.srcjar")
+
+	transformJavaToClasses(ctx, outputFile, -1, srcFiles, srcJars, annoSrcJar, nil, flags, nil,
 		"errorprone", "errorprone")
 }
 
@@ -329,7 +368,7 @@ func emitXrefRule(ctx android.ModuleContext, xrefFile android.WritablePath, idx
 	ctx.Build(pctx,
 		android.BuildParams{
 			Rule:        kytheExtract,
-			Description: "Xref Java extractor",
+			Description: android.ActionDescription("xref java extractor", xrefFile),
 			Output:      xrefFile,
 			Inputs:      srcFiles,
 			Implicits:   deps,
@@ -376,7 +415,7 @@ func TransformJavaToHeaderClasses(ctx android.ModuleContext, outputFile android.
 	deps = append(deps, classpath...)
 	deps = append(deps, flags.processorPath...)
 
-	rule := turbine
+	rule, remote := remoteexec.Rule(ctx, "turbine", turbine, turbineRE)
 	args := map[string]string{
 		"javacFlags":    flags.javacFlags,
 		"bootClasspath": bootClasspath,
@@ -385,23 +424,24 @@ func TransformJavaToHeaderClasses(ctx android.ModuleContext, outputFile android.
 		"outDir":        android.PathForModuleOut(ctx, "turbine", "classes").String(),
 		"javaVersion":   flags.javaVersion.String(),
 	}
-	if ctx.Config().IsEnvTrue("RBE_TURBINE") {
-		rule = turbineRE
+	if remote {
 		args["implicits"] = strings.Join(deps.Strings(), ",")
 	}
 	ctx.Build(pctx, android.BuildParams{
 		Rule:        rule,
-		Description: "turbine",
+		Description: android.ActionDescription("turbine", outputFile),
 		Output:      outputFile,
 		Inputs:      srcFiles,
 		Implicits:   deps,
+		OrderOnly:   flags.toolchainStamps,
 		Args:        args,
 	})
 }
 
 // transformJavaToClasses takes source files and converts them to a jar containing .class files.
 // srcFiles is a list of paths to sources, srcJars is a list of paths to jar files that contain
-// sources.  flags contains various command line flags to be passed to the compiler.
+// sources.  The sources generated by annotation processors are packaged into annoSrcJar.  flags
+// contains various command line flags to be passed to the compiler.
 //
 // This method may be used for different compilers, including javac and Error Prone.  The rule
 // argument specifies which command line to use and desc sets the description of the rule that will
@@ -409,8 +449,8 @@ func TransformJavaToHeaderClasses(ctx android.ModuleContext, outputFile android.
 // suffix will be appended to various intermediate files and directories to avoid collisions when
 // this function is called twice in the same module directory.
 func transformJavaToClasses(ctx android.ModuleContext, outputFile android.WritablePath,
-	shardIdx int, srcFiles, srcJars android.Paths,
-	flags javaBuilderFlags, deps android.Paths,
+	shardIdx int, srcFiles, srcJars android.Paths, annoSrcJar android.WritablePath,
+	jniHeadersDir android.Path, flags javaBuilderFlags, deps android.Paths,
 	intermediatesDir, desc string) {
 
 	deps = append(deps, srcJars...)
@@ -451,41 +491,63 @@ func transformJavaToClasses(ctx android.ModuleContext, outputFile android.Writab
 		outDir = filepath.Join(shardDir, outDir)
 		annoDir = filepath.Join(shardDir, annoDir)
 	}
-	rule := javac
-	if ctx.Config().IsEnvTrue("RBE_JAVAC") {
-		rule = javacRE
+	release := flags.javaVersionRelease && javacCanUseRelease(bootClasspath, flags.javacFlags)
+	javaVersionFlags := flags.javaVersion.javacFlags(release)
+
+	var jniHeadersDirArg, jniHeadersFlags string
+	if jniHeadersDir != nil {
+		jniHeadersDirArg = jniHeadersDir.String()
+		jniHeadersFlags = "-h " + jniHeadersDirArg
 	}
+
+	rule, _ := remoteexec.Rule(ctx, "javac", javac, javacRE)
 	ctx.Build(pctx, android.BuildParams{
-		Rule:        rule,
-		Description: desc,
-		Output:      outputFile,
-		Inputs:      srcFiles,
-		Implicits:   deps,
+		Rule:           rule,
+		Description:    android.ActionDescription(desc, outputFile),
+		Output:         outputFile,
+		ImplicitOutput: annoSrcJar,
+		Inputs:         srcFiles,
+		Implicits:      deps,
+		OrderOnly:      flags.toolchainStamps,
 		Args: map[string]string{
-			"javacFlags":    flags.javacFlags,
-			"bootClasspath": bootClasspath,
-			"classpath":     classpath.FormJavaClassPath("-classpath"),
-			"processorpath": flags.processorPath.FormJavaClassPath("-processorpath"),
-			"processor":     processor,
-			"srcJars":       strings.Join(srcJars.Strings(), " "),
-			"srcJarDir":     android.PathForModuleOut(ctx, intermediatesDir, srcJarDir).String(),
-			"outDir":        android.PathForModuleOut(ctx, intermediatesDir, outDir).String(),
-			"annoDir":       android.PathForModuleOut(ctx, intermediatesDir, annoDir).String(),
-			"javaVersion":   flags.javaVersion.String(),
+			"javacFlags":       flags.javacFlags,
+			"bootClasspath":    bootClasspath,
+			"classpath":        classpath.FormJavaClassPath("-classpath"),
+			"processorpath":    flags.processorPath.FormJavaClassPath("-processorpath"),
+			"processor":        processor,
+			"srcJars":          strings.Join(srcJars.Strings(), " "),
+			"srcJarDir":        android.PathForModuleOut(ctx, intermediatesDir, srcJarDir).String(),
+			"outDir":           android.PathForModuleOut(ctx, intermediatesDir, outDir).String(),
+			"annoDir":          android.PathForModuleOut(ctx, intermediatesDir, annoDir).String(),
+			"annoSrcJar":       annoSrcJar.String(),
+			"javaVersionFlags": javaVersionFlags,
+			"jniHeadersDir":    jniHeadersDirArg,
+			"jniHeadersFlags":  jniHeadersFlags,
 		},
 	})
 }
 
+// Returns true if javac can select the language level with --release, which is only the case for the
+// host modules that compile against the class library of the JDK without patching it.
+func javacCanUseRelease(bootClasspath, javacFlags string) bool {
+	if bootClasspath != "" {
+		return false
+	}
+	for _, flag := range []string{"--add-exports", "--add-reads", "--patch-module", "--system", "-bootclasspath"} {
+		if strings.Contains(javacFlags, flag) {
+			return false
+		}
+	}
+	return true
+}
+
 func TransformResourcesToJar(ctx android.ModuleContext, outputFile android.WritablePath,
 	jarArgs []string, deps android.Paths) {
 
-	rule := jar
-	if ctx.Config().IsEnvTrue("RBE_JAR") {
-		rule = jarRE
-	}
+	rule, _ := remoteexec.Rule(ctx, "jar", jar, jarRE)
 	ctx.Build(pctx, android.BuildParams{
 		Rule:        rule,
-		Description: "jar",
+		Description: android.ActionDescription("jar", outputFile),
 		Output:      outputFile,
 		Implicits:   deps,
 		Args: map[string]string{
@@ -524,7 +586,7 @@ func TransformJarsToJar(ctx android.ModuleContext, outputFile android.WritablePa
 
 	ctx.Build(pctx, android.BuildParams{
 		Rule:        combineJar,
-		Description: desc,
+		Description: android.ActionDescription(desc, outputFile),
 		Output:      outputFile,
 		Inputs:      jars,
 		Implicits:   deps,
@@ -538,7 +600,7 @@ func TransformJarJar(ctx android.ModuleContext, outputFile android.WritablePath,
 	classesJar android.Path, rulesFile android.Path) {
 	ctx.Build(pctx, android.BuildParams{
 		Rule:        jarjar,
-		Description: "jarjar",
+		Description: android.ActionDescription("jarjar", outputFile),
 		Output:      outputFile,
 		Input:       classesJar,
 		Implicit:    rulesFile,
@@ -552,7 +614,7 @@ func CheckJarPackages(ctx android.ModuleContext, outputFile android.WritablePath
 	classesJar android.Path, permittedPackages []string) {
 	ctx.Build(pctx, android.BuildParams{
 		Rule:        packageCheck,
-		Description: "packageCheck",
+		Description: android.ActionDescription("package check", outputFile),
 		Output:      outputFile,
 		Input:       classesJar,
 		Args: map[string]string{
@@ -561,31 +623,126 @@ func CheckJarPackages(ctx android.ModuleContext, outputFile android.WritablePath
 	})
 }
 
+// CheckBootJarPackages copies classesJar to outputFile after checking that all of its classes are in
+// the allowed packages or their sub-packages.
+func CheckBootJarPackages(ctx android.ModuleContext, outputFile android.WritablePath,
+	classesJar android.Path, allowedPackages []string) {
+	ctx.Build(pctx, android.BuildParams{
+		Rule:        packageCheckedJar,
+		Description: android.ActionDescription("boot jar package check", outputFile),
+		Output:      outputFile,
+		Input:       classesJar,
+		Args: map[string]string{
+			"packages": strings.Join(allowedPackages, " "),
+		},
+	})
+}
+
 func TransformJetifier(ctx android.ModuleContext, outputFile android.WritablePath,
 	inputFile android.Path) {
 	ctx.Build(pctx, android.BuildParams{
 		Rule:        jetifier,
-		Description: "jetifier",
+		Description: android.ActionDescription("jetifier", outputFile),
 		Output:      outputFile,
 		Input:       inputFile,
 	})
 }
 
 func GenerateMainClassManifest(ctx android.ModuleContext, outputFile android.WritablePath, mainClass string) {
-	ctx.Build(pctx, android.BuildParams{
-		Rule:        android.WriteFile,
-		Description: "manifest",
-		Output:      outputFile,
-		Args: map[string]string{
-			"content": "Main-Class: " + mainClass + "\n",
-		},
-	})
+	GenerateJarManifest(ctx, outputFile, []string{"Main-Class: " + mainClass})
+}
+
+// GenerateJarManifest writes a jar manifest containing the given attributes, each in the form
+// "Name: value".
+func GenerateJarManifest(ctx android.ModuleContext, outputFile android.WritablePath, attributes []string) {
+	rule := android.NewRuleBuilder()
+	rule.Command().
+		Text(`printf '%s\n'`).
+		Text(strings.Join(proptools.ShellEscapeList(attributes), " ")).
+		FlagWithOutput("> ", outputFile)
+	rule.Build(pctx, ctx, "jar_manifest", "manifest")
+}
+
+// TransformStampJar copies inputFile to outputFile with the build number and the source
+// revision stamped into it.  If stampVersion or stampRevision are set the build number and the
+// source revision are appended to manifest, or to an empty manifest if it is not valid, as
+// Implementation-Version and SCM-Revision.  @BUILD_NUMBER@ and @SCM_REVISION@ are replaced in the
+// entries of the jar listed in resources.  Only this step depends on the build number and the
+// source revision, so that they don't cause the jar to be recompiled.
+func TransformStampJar(ctx android.ModuleContext, outputFile android.WritablePath, inputFile android.Path,
+	manifest android.OptionalPath, stampVersion, stampRevision bool, resources []string) {
+
+	stampDir := filepath.Join(filepath.Dir(outputFile.String()), "stamp")
+	resDir := filepath.Join(stampDir, "res")
+
+	rule := android.NewRuleBuilder()
+	rule.Command().Text("rm -rf").Text(stampDir)
+	rule.Command().Text("mkdir -p").Text(resDir)
+	rule.Command().Text("build_number=$(cat").Input(ctx.Config().BuildNumberFile(ctx)).Text(")")
+	rule.Command().Text("scm_revision=$(cat").Input(ctx.Config().BuildScmRevisionFile(ctx)).Text(")")
+
+	var stampManifest, stampZip string
+
+	if stampVersion || stampRevision {
+		stampManifest = filepath.Join(stampDir, "MANIFEST.MF")
+		cmd := rule.Command().Text("(")
+		if manifest.Valid() {
+			cmd.Text("cat").Input(manifest.Path()).Text(";")
+		}
+		if stampVersion {
+			cmd.Text(`echo "Implementation-Version: ${build_number}";`)
+		}
+		if stampRevision {
+			cmd.Text(`echo "SCM-Revision: ${scm_revision}";`)
+		}
+		cmd.Text(")").FlagWithArg("> ", stampManifest)
+	}
+
+	if len(resources) > 0 {
+		resZip := filepath.Join(stampDir, "res.zip")
+		stampZip = filepath.Join(stampDir, "stamp.zip")
+		var resFiles []string
+		for _, res := range resources {
+			resFiles = append(resFiles, proptools.ShellEscape(filepath.Join(resDir, res)))
+		}
+
+		rule.Command().BuiltTool(ctx, "zip2zip").
+			FlagWithInput("-i ", inputFile).
+			FlagWithArg("-o ", resZip).
+			Text(strings.Join(proptools.ShellEscapeList(resources), " "))
+		rule.Command().BuiltTool(ctx, "zipsync").
+			FlagWithArg("-d ", resDir).
+			Text(resZip)
+		rule.Command().Text("sed -i.bak").
+			Flag(`-e "s|@BUILD_NUMBER@|${build_number}|g"`).
+			Flag(`-e "s|@SCM_REVISION@|${scm_revision}|g"`).
+			Text(strings.Join(resFiles, " "))
+		rule.Command().BuiltTool(ctx, "soong_zip").
+			FlagWithArg("-o ", stampZip).
+			FlagWithArg("-C ", resDir).
+			FlagForEachArg("-f ", resFiles)
+	}
+
+	cmd := rule.Command().BuiltTool(ctx, "merge_zips").Flag("-j").Flag("--ignore-duplicates")
+	if stampManifest != "" {
+		cmd.FlagWithArg("-m ", stampManifest)
+	}
+	cmd.Output(outputFile)
+	if stampZip != "" {
+		// The stamped resources are merged first so that they replace the unstamped ones.
+		cmd.Text(stampZip)
+	}
+	cmd.Input(inputFile)
+
+	rule.Command().Text("rm -rf").Text(stampDir)
+
+	rule.Build(pctx, ctx, "stamp_jar", "stamp")
 }
 
 func TransformZipAlign(ctx android.ModuleContext, outputFile android.WritablePath, inputFile android.Path) {
 	ctx.Build(pctx, android.BuildParams{
 		Rule:        zipalign,
-		Description: "align",
+		Description: android.ActionDescription("zipalign", outputFile),
 		Input:       inputFile,
 		Output:      outputFile,
 	})
@@ -17,6 +17,7 @@ package config
 import (
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 
 	_ "github.com/google/blueprint/bootstrap"
@@ -54,6 +55,16 @@ var (
 		"framework-sdkextensions",
 		"android.net.ipsec.ike",
 	}
+
+	// The toolchain_prebuilt modules that verify the checksums of the prebuilt JDK, dx, aapt2 and
+	// signapk.  They are defined next to the prebuilts, the java modules are ordered after the ones
+	// that exist.
+	ToolchainPrebuilts = []string{
+		"jdk-toolchain",
+		"dx-toolchain",
+		"aapt2-toolchain",
+		"signapk-toolchain",
+	}
 )
 
 const (
@@ -97,7 +108,7 @@ func init() {
 		if override := ctx.Config().Getenv("OVERRIDE_JLINK_VERSION_NUMBER"); override != "" {
 			return override
 		}
-		return "11"
+		return strconv.Itoa(defaultJdkVersion)
 	})
 
 	pctx.SourcePathVariable("JavaToolchain", "${JavaHome}/bin")
@@ -148,13 +159,13 @@ func init() {
 	pctx.HostBinToolVariable("DexpreoptGen", "dexpreopt_gen")
 
 	pctx.VariableFunc("REJavaPool", remoteexec.EnvOverrideFunc("RBE_JAVA_POOL", "java16"))
-	pctx.VariableFunc("REJavacExecStrategy", remoteexec.EnvOverrideFunc("RBE_JAVAC_EXEC_STRATEGY", remoteexec.RemoteLocalFallbackExecStrategy))
-	pctx.VariableFunc("RED8ExecStrategy", remoteexec.EnvOverrideFunc("RBE_D8_EXEC_STRATEGY", remoteexec.RemoteLocalFallbackExecStrategy))
-	pctx.VariableFunc("RER8ExecStrategy", remoteexec.EnvOverrideFunc("RBE_R8_EXEC_STRATEGY", remoteexec.RemoteLocalFallbackExecStrategy))
-	pctx.VariableFunc("RETurbineExecStrategy", remoteexec.EnvOverrideFunc("RBE_TURBINE_EXEC_STRATEGY", remoteexec.LocalExecStrategy))
-	pctx.VariableFunc("RESignApkExecStrategy", remoteexec.EnvOverrideFunc("RBE_SIGNAPK_EXEC_STRATEGY", remoteexec.LocalExecStrategy))
-	pctx.VariableFunc("REJarExecStrategy", remoteexec.EnvOverrideFunc("RBE_JAR_EXEC_STRATEGY", remoteexec.LocalExecStrategy))
-	pctx.VariableFunc("REZipExecStrategy", remoteexec.EnvOverrideFunc("RBE_ZIP_EXEC_STRATEGY", remoteexec.LocalExecStrategy))
+	pctx.VariableFunc("REJavacExecStrategy", remoteexec.ExecStrategyFunc("javac", remoteexec.RemoteLocalFallbackExecStrategy))
+	pctx.VariableFunc("RED8ExecStrategy", remoteexec.ExecStrategyFunc("d8", remoteexec.RemoteLocalFallbackExecStrategy))
+	pctx.VariableFunc("RER8ExecStrategy", remoteexec.ExecStrategyFunc("r8", remoteexec.RemoteLocalFallbackExecStrategy))
+	pctx.VariableFunc("RETurbineExecStrategy", remoteexec.ExecStrategyFunc("turbine", remoteexec.LocalExecStrategy))
+	pctx.VariableFunc("RESignApkExecStrategy", remoteexec.ExecStrategyFunc("signapk", remoteexec.LocalExecStrategy))
+	pctx.VariableFunc("REJarExecStrategy", remoteexec.ExecStrategyFunc("jar", remoteexec.LocalExecStrategy))
+	pctx.VariableFunc("REZipExecStrategy", remoteexec.ExecStrategyFunc("zip", remoteexec.LocalExecStrategy))
 
 	pctx.HostJavaToolVariable("JacocoCLIJar", "jacoco-cli.jar")
 
@@ -241,6 +252,20 @@ func javaTool(ctx android.PathContext, tool string) android.SourcePath {
 
 }
 
+// The major version of the JDK that soong_ui sets up in ANDROID_JAVA_HOME.
+const defaultJdkVersion = 11
+
+// JdkVersion returns the major version of the JDK that is used to compile java code, which is the
+// highest Java language level that can be compiled.
+func JdkVersion(config android.Config) int {
+	if override := config.Getenv("OVERRIDE_JLINK_VERSION_NUMBER"); override != "" {
+		if v, err := strconv.Atoi(strings.SplitN(override, ".", 2)[0]); err == nil {
+			return v
+		}
+	}
+	return defaultJdkVersion
+}
+
 var javaToolchainKey = android.NewOnceKey("javaToolchain")
 
 func javaToolchain(ctx android.PathContext) android.SourcePath {
@@ -257,3 +282,18 @@ func javaHome(ctx android.PathContext) android.SourcePath {
 		return android.PathForSource(ctx, ctx.Config().Getenv("ANDROID_JAVA_HOME"))
 	})
 }
+
+// JavaHomeForOs returns the prebuilt JDK for os, which is next to the JDK that soong_ui sets up in
+// ANDROID_JAVA_HOME, for example prebuilts/jdk/jdk11/windows-x86, or an invalid path if the JDK
+// for os is not checked out.
+func JavaHomeForOs(ctx android.PathContext, os android.OsType) android.OptionalPath {
+	home := javaHome(ctx)
+	if os == android.BuildOs {
+		return android.OptionalPathForPath(home)
+	}
+	prebuiltOs := os.String()
+	if os == android.Linux {
+		prebuiltOs = "linux"
+	}
+	return android.ExistentPathForSource(ctx, filepath.Dir(home.String()), prebuiltOs+"-x86")
+}
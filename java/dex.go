@@ -57,7 +57,6 @@ var r8, r8RE = remoteexec.MultiCommandStaticRules(pctx, "r8",
 		Command: `rm -rf "$outDir" && mkdir -p "$outDir" && ` +
 			`rm -f "$outDict" && ` +
 			`$r8Template${config.R8Cmd} ${config.DexFlags} -injars $in --output $outDir ` +
-			`--force-proguard-compatibility ` +
 			`--no-data-resources ` +
 			`-printmapping $outDict ` +
 			`$r8Flags && ` +
@@ -86,7 +85,132 @@ var r8, r8RE = remoteexec.MultiCommandStaticRules(pctx, "r8",
 		},
 	}, []string{"outDir", "outDict", "r8Flags", "zipFlags"}, []string{"implicits"})
 
-func (j *Module) dexCommonFlags(ctx android.ModuleContext) []string {
+const (
+	// The D8 and R8 configuration of core library desugaring, and the module with the runtime of
+	// the desugared core library APIs.
+	coreLibDesugaringConfig  = "external/desugar_jdk_libs/desugar_jdk_libs_configuration.json"
+	coreLibDesugaringRuntime = "desugar_jdk_libs"
+
+	// The keep rules that prevent R8 from removing the desugared core library APIs used through
+	// reflection.
+	coreLibDesugaringProguardFlags = "external/desugar_jdk_libs/proguard.flags"
+
+	// The experimental feature that runs R8 in full mode instead of ProGuard compatibility mode.
+	r8FullModeFeature = "r8_full_mode"
+)
+
+func init() {
+	android.RegisterExperimentalFeature(r8FullModeFeature)
+}
+
+// coreLibDesugaringDex compiles the desugared core library runtime with L8 and adds it to dexJar as
+// an extra classes.dex file.  If keepRules is not nil it contains the keep rules that R8 generated
+// for the core library APIs used by the module, and only those are kept in the runtime.
+func (j *Module) coreLibDesugaringDex(ctx android.ModuleContext, flags javaBuilderFlags,
+	dexJar android.ModuleOutPath, keepRules android.Path, jarName string) android.ModuleOutPath {
+
+	var runtimeJars android.Paths
+	ctx.VisitDirectDepsWithTag(coreLibDesugaringTag, func(m android.Module) {
+		if dep, ok := m.(Dependency); ok {
+			runtimeJars = append(runtimeJars, dep.ImplementationJars()...)
+		} else {
+			ctx.PropertyErrorf("core_lib_desugaring", "%q is not a java library", ctx.OtherModuleName(m))
+		}
+	})
+	if len(runtimeJars) == 0 {
+		return dexJar
+	}
+
+	// The error is reported by dexCommonFlags.
+	minSdkVersion, _ := j.minSdkVersion().effectiveVersion(ctx)
+
+	runtimeDexJar := android.PathForModuleOut(ctx, "core_lib_desugaring", "classes.dex.jar")
+	renamedRuntimeDexJar := android.PathForModuleOut(ctx, "core_lib_desugaring", "renamed.dex.jar")
+	outputJar := android.PathForModuleOut(ctx, "core_lib_desugaring", jarName)
+
+	rule := android.NewRuleBuilder()
+	l8 := rule.Command().
+		BuiltTool(ctx, "l8").
+		FlagWithArg("--min-api ", minSdkVersion.asNumberString()).
+		FlagWithInput("--desugared-lib ", android.PathForSource(ctx, coreLibDesugaringConfig)).
+		FlagForEachInput("--lib ", android.Paths(flags.bootClasspath))
+	if keepRules != nil {
+		l8.FlagWithInput("--pg-conf ", keepRules)
+	}
+	l8.FlagWithOutput("--output ", runtimeDexJar).Inputs(runtimeJars)
+
+	// The runtime is added after the classes.dex files of the module.
+	rule.Command().
+		Text("n=$(($(zipinfo -1").Input(dexJar).Text(`'classes*.dex' | wc -l) + 1))`)
+	zip2zip := rule.Command().
+		BuiltTool(ctx, "zip2zip").
+		FlagWithInput("-i ", runtimeDexJar).
+		FlagWithOutput("-o ", renamedRuntimeDexJar)
+	if proptools.Bool(j.deviceProperties.Uncompress_dex) {
+		zip2zip.FlagWithArg("-0 ", "'classes*.dex'")
+	}
+	zip2zip.Text(`"classes.dex:classes${n}.dex"`)
+	rule.Command().
+		BuiltTool(ctx, "merge_zips").
+		Output(outputJar).
+		Input(dexJar).
+		Input(renamedRuntimeDexJar)
+
+	rule.Temporary(renamedRuntimeDexJar)
+	rule.DeleteTemporaryFiles()
+	rule.Build(pctx, ctx, "core_lib_desugaring", "core library desugaring")
+
+	return outputJar
+}
+
+// appendDexJars adds the classes*.dex files of dexJars to dexJar, in order, as the classes*.dex
+// files that follow the ones already in dexJar.
+func (j *Module) appendDexJars(ctx android.ModuleContext, dexJar android.ModuleOutPath,
+	dexJars android.Paths, jarName string) android.ModuleOutPath {
+
+	dexDir := android.PathForModuleOut(ctx, "extra_dex", "dex")
+	extraDexJar := android.PathForModuleOut(ctx, "extra_dex", "classes.dex.jar")
+	outputJar := android.PathForModuleOut(ctx, "extra_dex", jarName)
+
+	rule := android.NewRuleBuilder()
+	rule.Command().Text("rm -rf").Text(dexDir.String())
+	rule.Command().Text("mkdir -p").Text(dexDir.String())
+	rule.Command().
+		Text("n=$(zipinfo -1").Input(dexJar).Text(`'classes*.dex' | wc -l)`)
+	for _, jar := range dexJars {
+		// The classes*.dex files of a multidex jar are numbered classes.dex, classes2.dex, ...
+		rule.Command().
+			Text("c=$(zipinfo -1").Input(jar).Text(`'classes*.dex' | wc -l)`)
+		rule.Command().
+			Text("for i in $(seq 1 ${c}); do").
+			Text(`src="classes$([ ${i} -gt 1 ] && echo ${i}).dex" &&`).
+			Text("unzip -p").Input(jar).Text(`"${src}"`).
+			Text(">").Text(dexDir.String() + `/classes$((n + i)).dex;`).
+			Text("done")
+		rule.Command().Text("n=$((n + c))")
+	}
+	soongZip := rule.Command().
+		BuiltTool(ctx, "soong_zip").
+		FlagWithOutput("-o ", extraDexJar).
+		FlagWithArg("-C ", dexDir.String()).
+		FlagWithArg("-D ", dexDir.String())
+	if proptools.Bool(j.deviceProperties.Uncompress_dex) {
+		soongZip.Flag("-L 0")
+	}
+	rule.Command().
+		BuiltTool(ctx, "merge_zips").
+		Output(outputJar).
+		Input(dexJar).
+		Input(extraDexJar)
+
+	rule.Temporary(extraDexJar)
+	rule.DeleteTemporaryFiles()
+	rule.Build(pctx, ctx, "extra_dex", "append dex jars")
+
+	return outputJar
+}
+
+func (j *Module) dexCommonFlags(ctx android.ModuleContext, javaVersion javaVersion) ([]string, android.Paths) {
 	flags := j.deviceProperties.Dxflags
 	// Translate all the DX flags to D8 ones until all the build files have been migrated
 	// to D8 flags. See: b/69377755
@@ -108,17 +232,43 @@ func (j *Module) dexCommonFlags(ctx android.ModuleContext) []string {
 		ctx.PropertyErrorf("min_sdk_version", "%s", err)
 	}
 
+	// D8 and R8 desugar the lambdas and the default and static interface methods of Java 8 and higher
+	// language levels for devices older than N, which don't support them.
+	if javaVersion >= JAVA_VERSION_8 && minSdkVersion < 24 && android.InList("--no-desugaring", flags) {
+		ctx.PropertyErrorf("dxflags", "--no-desugaring requires a min_sdk_version of at least 24 with java_version %s",
+			javaVersion)
+	}
+
+	// Releases before L only load the primary classes.dex file natively, the classes selected by the
+	// main dex rules are kept in it when the dex code is split into multiple dex files.
+	var deps android.Paths
+	if minSdkVersion < 21 {
+		mainDexRules := append(android.PathsForModuleSrc(ctx, j.deviceProperties.Main_dex_rules),
+			j.extraMainDexRuleFiles...)
+		for _, rules := range mainDexRules {
+			flags = append(flags, "--main-dex-rules "+rules.String())
+		}
+		deps = append(deps, mainDexRules...)
+	}
+
+	// Core library desugaring rewrites the uses of core library APIs that are missing at the min
+	// API level to the copies in the desugared core library runtime.
+	if Bool(j.deviceProperties.Core_lib_desugaring) {
+		desugaringConfig := android.PathForSource(ctx, coreLibDesugaringConfig)
+		flags = append(flags, "--desugared-lib "+desugaringConfig.String())
+		deps = append(deps, desugaringConfig)
+	}
+
 	flags = append(flags, "--min-api "+minSdkVersion.asNumberString())
-	return flags
+	return flags, deps
 }
 
 func (j *Module) d8Flags(ctx android.ModuleContext, flags javaBuilderFlags) ([]string, android.Paths) {
-	d8Flags := j.dexCommonFlags(ctx)
+	d8Flags, d8Deps := j.dexCommonFlags(ctx, flags.javaVersion)
 
 	d8Flags = append(d8Flags, flags.bootClasspath.FormRepeatedClassPath("--lib ")...)
 	d8Flags = append(d8Flags, flags.classpath.FormRepeatedClassPath("--lib ")...)
 
-	var d8Deps android.Paths
 	d8Deps = append(d8Deps, flags.bootClasspath...)
 	d8Deps = append(d8Deps, flags.classpath...)
 
@@ -140,7 +290,16 @@ func (j *Module) r8Flags(ctx android.ModuleContext, flags javaBuilderFlags) (r8F
 		proguardRaiseDeps = append(proguardRaiseDeps, dep.(Dependency).HeaderJars()...)
 	})
 
-	r8Flags = append(r8Flags, j.dexCommonFlags(ctx)...)
+	commonFlags, commonDeps := j.dexCommonFlags(ctx, flags.javaVersion)
+	r8Flags = append(r8Flags, commonFlags...)
+	r8Deps = append(r8Deps, commonDeps...)
+
+	// R8 runs in ProGuard compatibility mode unless its full mode, which optimizes more
+	// aggressively but needs the keep rules to cover everything accessed by reflection, is enabled
+	// for the module.
+	if !android.ExperimentalFeatureEnabled(ctx, r8FullModeFeature) {
+		r8Flags = append(r8Flags, "--force-proguard-compatibility")
+	}
 
 	r8Flags = append(r8Flags, proguardRaiseDeps.FormJavaClassPath("-libraryjars"))
 	r8Flags = append(r8Flags, flags.bootClasspath.FormJavaClassPath("-libraryjars"))
@@ -150,28 +309,48 @@ func (j *Module) r8Flags(ctx android.ModuleContext, flags javaBuilderFlags) (r8F
 	r8Deps = append(r8Deps, flags.bootClasspath...)
 	r8Deps = append(r8Deps, flags.classpath...)
 
-	flagFiles := android.Paths{
-		android.PathForSource(ctx, "build/make/core/proguard.flags"),
+	// The origin of each flags file and flag is recorded in the rules report.
+	var report []string
+	addFlagFiles := func(origin string, files android.Paths) {
+		for _, file := range files {
+			r8Flags = append(r8Flags, "-include "+file.String())
+			r8Deps = append(r8Deps, file)
+			report = append(report, origin+": -include "+file.String())
+		}
+	}
+	addFlags := func(origin string, flags ...string) {
+		r8Flags = append(r8Flags, flags...)
+		for _, flag := range flags {
+			report = append(report, origin+": "+flag)
+		}
 	}
 
+	addFlagFiles("default", android.Paths{android.PathForSource(ctx, "build/make/core/proguard.flags")})
+
 	if j.shouldInstrumentStatic(ctx) {
-		flagFiles = append(flagFiles,
-			android.PathForSource(ctx, "build/make/core/proguard.jacoco.flags"))
+		addFlagFiles("jacoco", android.Paths{
+			android.PathForSource(ctx, "build/make/core/proguard.jacoco.flags")})
 	}
 
-	flagFiles = append(flagFiles, j.extraProguardFlagFiles...)
+	addFlagFiles("generated", j.extraProguardFlagFiles)
+
+	if Bool(j.deviceProperties.Core_lib_desugaring) {
+		addFlagFiles("desugaring", android.Paths{android.PathForSource(ctx, coreLibDesugaringProguardFlags)})
+	}
 	// TODO(ccross): static android library proguard files
 
-	flagFiles = append(flagFiles, android.PathsForModuleSrc(ctx, j.deviceProperties.Optimize.Proguard_flags_files)...)
+	productPolicy := BoolDefault(opt.Product_policy, true)
+	if productPolicy {
+		addFlagFiles("product", android.PathsForSource(ctx, ctx.Config().ProguardFlagsFiles()))
+	}
 
-	r8Flags = append(r8Flags, android.JoinWithPrefix(flagFiles.Strings(), "-include "))
-	r8Deps = append(r8Deps, flagFiles...)
+	addFlagFiles("module", android.PathsForModuleSrc(ctx, opt.Proguard_flags_files))
 
 	// TODO(b/70942988): This is included from build/make/core/proguard.flags
 	r8Deps = append(r8Deps, android.PathForSource(ctx,
 		"build/make/core/proguard_basic_keeps.flags"))
 
-	r8Flags = append(r8Flags, j.deviceProperties.Optimize.Proguard_flags...)
+	addFlags("module", opt.Proguard_flags...)
 
 	// TODO(ccross): Don't shrink app instrumentation tests by default.
 	if !Bool(opt.Shrink) {
@@ -185,10 +364,38 @@ func (j *Module) r8Flags(ctx android.ModuleContext, flags javaBuilderFlags) (r8F
 	// TODO(ccross): error if obufscation + app instrumentation test.
 	if !Bool(opt.Obfuscate) {
 		r8Flags = append(r8Flags, "-dontobfuscate")
+	} else {
+		var dictionary android.Path
+		dictionaryOrigin := "module"
+		if opt.Obfuscation_dictionary != nil {
+			dictionary = android.PathForModuleSrc(ctx, *opt.Obfuscation_dictionary)
+		} else if d := ctx.Config().ProguardObfuscationDictionary(); productPolicy && d != "" {
+			dictionary = android.PathForSource(ctx, d)
+			dictionaryOrigin = "product"
+		}
+		if dictionary != nil {
+			addFlags(dictionaryOrigin,
+				"-obfuscationdictionary "+dictionary.String(),
+				"-classobfuscationdictionary "+dictionary.String(),
+				"-packageobfuscationdictionary "+dictionary.String())
+			r8Deps = append(r8Deps, dictionary)
+		}
+
+		repackageClasses := opt.Repackage_classes
+		repackageOrigin := "module"
+		if repackageClasses == nil && productPolicy {
+			repackageClasses = ctx.Config().ProguardRepackageClasses()
+			repackageOrigin = "product"
+		}
+		if repackageClasses != nil {
+			addFlags(repackageOrigin, "-repackageclasses "+proptools.ShellEscape(*repackageClasses))
+		}
 	}
 	// TODO(ccross): if this is an instrumentation test of an obfuscated app, use the
 	// dictionary of the app and move the app from libraryjars to injars.
 
+	j.proguardRulesReport = proguardRulesReportRule(ctx, report)
+
 	// Don't strip out debug information for eng builds.
 	if ctx.Config().Eng() {
 		r8Flags = append(r8Flags, "--debug")
@@ -197,10 +404,26 @@ func (j *Module) r8Flags(ctx android.ModuleContext, flags javaBuilderFlags) (r8F
 	return r8Flags, r8Deps
 }
 
+// proguardRulesReportRule writes the proguard rules passed to r8, each prefixed with where it came
+// from, to a file next to the proguard dictionary.
+func proguardRulesReportRule(ctx android.ModuleContext, report []string) android.Path {
+	reportFile := android.PathForModuleOut(ctx, "proguard_rules_report.txt")
+
+	rule := android.NewRuleBuilder()
+	rule.Command().
+		Text("printf '%s\\n'").
+		Text(strings.Join(proptools.ShellEscapeList(report), " ")).
+		FlagWithOutput("> ", reportFile)
+	rule.Build(pctx, ctx, "proguard_rules_report", "proguard rules report")
+
+	ctx.CheckbuildFile(reportFile)
+	return reportFile
+}
+
 func (j *Module) compileDex(ctx android.ModuleContext, flags javaBuilderFlags,
 	classesJar android.Path, jarName string) android.ModuleOutPath {
 
-	useR8 := j.deviceProperties.EffectiveOptimizeEnabled()
+	useR8 := j.optimizeEnabled(ctx)
 
 	// Compile classes.jar into classes.dex and then javalib.jar
 	javalibJar := android.PathForModuleOut(ctx, "dex", jarName)
@@ -211,42 +434,49 @@ func (j *Module) compileDex(ctx android.ModuleContext, flags javaBuilderFlags,
 		zipFlags += " -L 0"
 	}
 
+	coreLibDesugaring := Bool(j.deviceProperties.Core_lib_desugaring)
+	var coreLibDesugaringKeepRules android.WritablePath
+
 	if useR8 {
 		proguardDictionary := android.PathForModuleOut(ctx, "proguard_dictionary")
 		j.proguardDictionary = proguardDictionary
 		r8Flags, r8Deps := j.r8Flags(ctx, flags)
-		rule := r8
+		implicitOutputs := android.WritablePaths{proguardDictionary}
+		if coreLibDesugaring {
+			coreLibDesugaringKeepRules = android.PathForModuleOut(ctx, "core_lib_desugaring", "keep_rules.txt")
+			r8Flags = append(r8Flags, "--desugared-lib-pg-conf-output "+coreLibDesugaringKeepRules.String())
+			implicitOutputs = append(implicitOutputs, coreLibDesugaringKeepRules)
+		}
+		rule, remote := remoteexec.Rule(ctx, "r8", r8, r8RE)
 		args := map[string]string{
 			"r8Flags":  strings.Join(r8Flags, " "),
 			"zipFlags": zipFlags,
 			"outDict":  j.proguardDictionary.String(),
 			"outDir":   outDir.String(),
 		}
-		if ctx.Config().IsEnvTrue("RBE_R8") {
-			rule = r8RE
+		if remote {
 			args["implicits"] = strings.Join(r8Deps.Strings(), ",")
 		}
 		ctx.Build(pctx, android.BuildParams{
-			Rule:           rule,
-			Description:    "r8",
-			Output:         javalibJar,
-			ImplicitOutput: proguardDictionary,
-			Input:          classesJar,
-			Implicits:      r8Deps,
-			Args:           args,
+			Rule:            rule,
+			Description:     "r8",
+			Output:          javalibJar,
+			ImplicitOutputs: implicitOutputs,
+			Input:           classesJar,
+			Implicits:       r8Deps,
+			OrderOnly:       flags.toolchainStamps,
+			Args:            args,
 		})
 	} else {
 		d8Flags, d8Deps := j.d8Flags(ctx, flags)
-		rule := d8
-		if ctx.Config().IsEnvTrue("RBE_D8") {
-			rule = d8RE
-		}
+		rule, _ := remoteexec.Rule(ctx, "d8", d8, d8RE)
 		ctx.Build(pctx, android.BuildParams{
 			Rule:        rule,
 			Description: "d8",
 			Output:      javalibJar,
 			Input:       classesJar,
 			Implicits:   d8Deps,
+			OrderOnly:   flags.toolchainStamps,
 			Args: map[string]string{
 				"d8Flags":  strings.Join(d8Flags, " "),
 				"zipFlags": zipFlags,
@@ -254,6 +484,12 @@ func (j *Module) compileDex(ctx android.ModuleContext, flags javaBuilderFlags,
 			},
 		})
 	}
+	if coreLibDesugaring {
+		javalibJar = j.coreLibDesugaringDex(ctx, flags, javalibJar, coreLibDesugaringKeepRules, jarName)
+	}
+	if len(j.extraDexJars) > 0 {
+		javalibJar = j.appendDexJars(ctx, javalibJar, j.extraDexJars, jarName)
+	}
 	if proptools.Bool(j.deviceProperties.Uncompress_dex) {
 		alignedJavalibJar := android.PathForModuleOut(ctx, "aligned", jarName)
 		TransformZipAlign(ctx, alignedJavalibJar, javalibJar)
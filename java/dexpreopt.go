@@ -15,6 +15,8 @@
 package java
 
 import (
+	"strings"
+
 	"android/soong/android"
 	"android/soong/dexpreopt"
 )
@@ -33,13 +35,19 @@ type dexpreopter struct {
 	isTest              bool
 	isPresignedPrebuilt bool
 
-	manifestFile     android.Path
-	usesLibs         []string
-	optionalUsesLibs []string
-	enforceUsesLibs  bool
-	libraryPaths     map[string]android.Path
+	manifestFile        android.Path
+	usesLibs            []string
+	optionalUsesLibs    []string
+	enforceUsesLibs     bool
+	libraryPaths        map[string]android.Path
+	libraryDependencies map[string][]string
 
 	builtInstalled string
+
+	// Files generated by dexpreopting the module and the dex jar that is packaged after
+	// dexpreopting, used to report the space cost of dexpreopting.
+	builtArtifacts android.Paths
+	packagedDexJar android.Path
 }
 
 type DexpreoptProperties struct {
@@ -59,9 +67,33 @@ type DexpreoptProperties struct {
 		// defaults to searching for a file that matches the name of this module in the default
 		// profile location set by PRODUCT_DEX_PREOPT_PROFILE_DIR, or empty if not found.
 		Profile *string `android:"path"`
+
+		// If true, package the profile together with the verification metadata into a dex
+		// metadata (.dm) file that is installed next to the module for install-time
+		// optimization.  Requires profile.  Defaults to false.
+		Dex_metadata *bool
+
+		// The compiler filter that dex2oat uses for this module, for example "speed" or "verify".
+		// Defaults to a filter selected from the product configuration and the profile of the
+		// module.
+		Compiler_filter *string
 	}
 }
 
+// dexpreoptCompilerFilters lists the compiler filters that can be set in dex_preopt.compiler_filter.
+var dexpreoptCompilerFilters = []string{
+	"assume-verified",
+	"extract",
+	"verify",
+	"quicken",
+	"space-profile",
+	"space",
+	"speed-profile",
+	"speed",
+	"everything-profile",
+	"everything",
+}
+
 func init() {
 	dexpreopt.DexpreoptRunningInSoong = true
 }
@@ -114,6 +146,13 @@ func dexpreoptToolDepsMutator(ctx android.BottomUpMutatorContext) {
 	dexpreopt.RegisterToolDeps(ctx)
 }
 
+// stripDexAfterDexpreopt returns true if the product strips the dex files of the module after
+// dexpreopting it instead of storing them uncompressed.
+func stripDexAfterDexpreopt(ctx android.ModuleContext) bool {
+	global := dexpreopt.GetGlobalConfig(ctx)
+	return global.StripDex && !inList(ctx.ModuleName(), global.NeverStripModules)
+}
+
 func odexOnSystemOther(ctx android.ModuleContext, installPath android.InstallPath) bool {
 	return dexpreopt.OdexOnSystemOtherByName(ctx.ModuleName(), android.InstallPathToOnDevicePath(ctx, installPath), dexpreopt.GetGlobalConfig(ctx))
 }
@@ -180,6 +219,28 @@ func (d *dexpreopter) dexpreopt(ctx android.ModuleContext, dexJarFile android.Mo
 		}
 	}
 
+	dexMetadata := BoolDefault(d.dexpreoptProperties.Dex_preopt.Dex_metadata, false)
+	if dexMetadata && !profileClassListing.Valid() {
+		ctx.PropertyErrorf("dex_preopt.dex_metadata", "requires a profile")
+		return dexJarFile
+	}
+
+	var preoptFlags []string
+	if compilerFilter := String(d.dexpreoptProperties.Dex_preopt.Compiler_filter); compilerFilter != "" {
+		if !inList(compilerFilter, dexpreoptCompilerFilters) {
+			ctx.PropertyErrorf("dex_preopt.compiler_filter", "unknown compiler filter %q, expected one of %q",
+				compilerFilter, dexpreoptCompilerFilters)
+			return dexJarFile
+		}
+		// Module flags replace the global flags, keep the global flags other than the compiler filter.
+		for _, flag := range global.PreoptFlags {
+			if !strings.HasPrefix(flag, "--compiler-filter=") {
+				preoptFlags = append(preoptFlags, flag)
+			}
+		}
+		preoptFlags = append(preoptFlags, "--compiler-filter="+compilerFilter)
+	}
+
 	dexpreoptConfig := &dexpreopt.ModuleConfig{
 		Name:            ctx.ModuleName(),
 		DexLocation:     dexLocation,
@@ -188,7 +249,7 @@ func (d *dexpreopter) dexpreopt(ctx android.ModuleContext, dexJarFile android.Mo
 		ManifestPath:    d.manifestFile,
 		UncompressedDex: d.uncompressedDex,
 		HasApkLibraries: false,
-		PreoptFlags:     nil,
+		PreoptFlags:     preoptFlags,
 
 		ProfileClassListing:  profileClassListing,
 		ProfileIsTextListing: profileIsTextListing,
@@ -198,6 +259,7 @@ func (d *dexpreopter) dexpreopt(ctx android.ModuleContext, dexJarFile android.Mo
 		PresentOptionalUsesLibraries: d.optionalUsesLibs,
 		UsesLibraries:                d.usesLibs,
 		LibraryPaths:                 d.libraryPaths,
+		LibraryDependencies:          d.libraryDependencies,
 
 		Archs:                   archs,
 		DexPreoptImages:         images,
@@ -213,6 +275,8 @@ func (d *dexpreopter) dexpreopt(ctx android.ModuleContext, dexJarFile android.Mo
 		ForceCreateAppImage: BoolDefault(d.dexpreoptProperties.Dex_preopt.App_image, false),
 
 		PresignedPrebuilt: d.isPresignedPrebuilt,
+
+		DexMetadata: dexMetadata,
 	}
 
 	dexpreoptRule, err := dexpreopt.GenerateDexpreoptRule(ctx, globalSoong, global, dexpreoptConfig)
@@ -224,6 +288,28 @@ func (d *dexpreopter) dexpreopt(ctx android.ModuleContext, dexJarFile android.Mo
 	dexpreoptRule.Build(pctx, ctx, "dexpreopt", "dexpreopt")
 
 	d.builtInstalled = dexpreoptRule.Installs().String()
+	for _, install := range dexpreoptRule.Installs() {
+		d.builtArtifacts = append(d.builtArtifacts, install.From)
+	}
+
+	if dexpreopt.ShouldStripDex(ctx, global, dexpreoptConfig) {
+		stripped := android.PathForModuleOut(ctx, "dex_stripped", dexJarFile.Base())
+		rule := android.NewRuleBuilder()
+		rule.Command().
+			Tool(globalSoong.Zip2zip).
+			FlagWithInput("-i ", dexJarFile).
+			FlagWithOutput("-o ", stripped).
+			FlagWithArg("-x ", "'classes*.dex'")
+		rule.Build(pctx, ctx, "strip_dex", "strip dex")
+		dexJarFile = stripped
+	}
+	d.packagedDexJar = dexJarFile
 
 	return dexJarFile
 }
+
+// dexpreoptSizeReportFiles returns the files generated by dexpreopting the module and the dex jar
+// that is packaged after dexpreopting, or nil if the module was not dexpreopted.
+func (d *dexpreopter) dexpreoptSizeReportFiles() (android.Paths, android.Path) {
+	return d.builtArtifacts, d.packagedDexJar
+}
@@ -234,10 +234,12 @@ func (d *dexpreoptBootJars) GenerateBuildActions(ctx android.SingletonContext) {
 		return
 	}
 
+	layout := bootImageLayoutRule(ctx)
+
 	// Always create the default boot image first, to get a unique profile rule for all images.
-	d.defaultBootImage = buildBootImage(ctx, defaultBootImageConfig(ctx))
+	d.defaultBootImage = buildBootImage(ctx, defaultBootImageConfig(ctx), layout)
 	// Create boot image for the ART apex (build artifacts are accessed via the global boot image config).
-	d.otherImages = append(d.otherImages, buildBootImage(ctx, artBootImageConfig(ctx)))
+	d.otherImages = append(d.otherImages, buildBootImage(ctx, artBootImageConfig(ctx), layout))
 
 	dumpOatRules(ctx, d.defaultBootImage)
 }
@@ -296,7 +298,7 @@ func getBootImageJar(ctx android.SingletonContext, image *bootImageConfig, modul
 }
 
 // buildBootImage takes a bootImageConfig, creates rules to build it, and returns the image.
-func buildBootImage(ctx android.SingletonContext, image *bootImageConfig) *bootImageConfig {
+func buildBootImage(ctx android.SingletonContext, image *bootImageConfig, layout bootImageLayout) *bootImageConfig {
 	// Collect dex jar paths for the boot image modules.
 	// This logic is tested in the apex package to avoid import cycle apex <-> java.
 	bootDexJars := make(android.Paths, len(image.modules))
@@ -338,7 +340,7 @@ func buildBootImage(ctx android.SingletonContext, image *bootImageConfig) *bootI
 
 	var allFiles android.Paths
 	for _, variant := range image.variants {
-		files := buildBootImageVariant(ctx, variant, profile, missingDeps)
+		files := buildBootImageVariant(ctx, variant, profile, layout, missingDeps)
 		allFiles = append(allFiles, files.Paths()...)
 	}
 
@@ -357,7 +359,7 @@ func buildBootImage(ctx android.SingletonContext, image *bootImageConfig) *bootI
 }
 
 func buildBootImageVariant(ctx android.SingletonContext, image *bootImageVariant,
-	profile android.Path, missingDeps []string) android.WritablePaths {
+	profile android.Path, layout bootImageLayout, missingDeps []string) android.WritablePaths {
 
 	globalSoong := dexpreopt.GetCachedGlobalSoongConfig(ctx)
 	global := dexpreopt.GetGlobalConfig(ctx)
@@ -407,10 +409,20 @@ func buildBootImageVariant(ctx android.SingletonContext, image *bootImageVariant
 		cmd.FlagWithInput("--profile-file=", profile)
 	}
 
-	if global.DirtyImageObjects.Valid() {
+	if layout.preloadedClasses != nil {
+		cmd.FlagWithInput("--preloaded-classes=", layout.preloadedClasses)
+	}
+
+	if layout.dirtyImageObjects != nil {
+		cmd.FlagWithInput("--dirty-image-objects=", layout.dirtyImageObjects)
+	} else if global.DirtyImageObjects.Valid() {
 		cmd.FlagWithInput("--dirty-image-objects=", global.DirtyImageObjects.Path())
 	}
 
+	if layout.preloadedClassesCheck != nil {
+		cmd.Implicit(layout.preloadedClassesCheck)
+	}
+
 	if image.extension {
 		artImage := image.primaryImages
 		cmd.
@@ -654,6 +666,129 @@ func updatableBcpPackagesRule(ctx android.SingletonContext, image *bootImageConf
 
 var updatableBcpPackagesRuleKey = android.NewOnceKey("updatableBcpPackagesRule")
 
+// bootImageLayout holds the files that control how classes are laid out in the boot images.
+type bootImageLayout struct {
+	// List of classes to preload and initialize in the boot images, or nil.
+	preloadedClasses android.Path
+
+	// List of objects that are likely to be written to at runtime, or nil to use the one from the
+	// global dexpreopt config.
+	dirtyImageObjects android.Path
+
+	// Stamp file of the rule that checks that all preloaded classes exist, or nil.
+	preloadedClassesCheck android.Path
+}
+
+// bootImageLayoutFile returns the single file produced by the named module, or nil if no module is
+// named.
+func bootImageLayoutFile(ctx android.SingletonContext, name string) android.Path {
+	if name == "" {
+		return nil
+	}
+
+	var path android.Path
+	found := false
+	ctx.VisitAllModules(func(module android.Module) {
+		if found || ctx.ModuleName(module) != name {
+			return
+		}
+		found = true
+
+		var files android.Paths
+		switch m := module.(type) {
+		case android.OutputFileProducer:
+			files, _ = m.OutputFiles("")
+		case android.SourceFileProducer:
+			files = m.Srcs()
+		}
+		if len(files) != 1 {
+			ctx.Errorf("boot image layout module %q must produce exactly one file, found %d", name, len(files))
+			return
+		}
+		path = files[0]
+	})
+
+	if !found {
+		if ctx.Config().AllowMissingDependencies() {
+			return nil
+		}
+		ctx.Errorf("boot image layout module %q does not exist", name)
+	}
+	return path
+}
+
+// bootImageLayoutRule resolves the preloaded-classes and dirty-image-objects modules configured for
+// the product and creates a rule that checks that every class listed in preloaded-classes exists in
+// the class jars of the boot classpath.
+func bootImageLayoutRule(ctx android.SingletonContext) bootImageLayout {
+	layout := bootImageLayout{
+		preloadedClasses:  bootImageLayoutFile(ctx, ctx.Config().BootImagePreloadedClassesModule()),
+		dirtyImageObjects: bootImageLayoutFile(ctx, ctx.Config().BootImageDirtyImageObjectsModule()),
+	}
+	if layout.preloadedClasses == nil {
+		return layout
+	}
+
+	global := dexpreopt.GetGlobalConfig(ctx)
+	bootModules := concat(global.BootJars, dexpreopt.GetJarsFromApexJarPairs(global.UpdatableBootJars))
+
+	// The same jar may occur in multiple variants, use the first one that is found.
+	classJars := make(map[string]android.Paths)
+	ctx.VisitAllModules(func(module android.Module) {
+		name := ctx.ModuleName(module)
+		if !android.InList(name, bootModules) || classJars[name] != nil {
+			return
+		}
+		if j, ok := module.(Dependency); ok && len(j.ImplementationJars()) > 0 {
+			classJars[name] = j.ImplementationJars()
+		}
+	})
+
+	var jars android.Paths
+	var missingDeps []string
+	for _, name := range bootModules {
+		if classJars[name] == nil {
+			missingDeps = append(missingDeps, name)
+			continue
+		}
+		jars = append(jars, classJars[name]...)
+	}
+	if len(missingDeps) > 0 && !ctx.Config().AllowMissingDependencies() {
+		ctx.Errorf("failed to find the class jars of boot classpath modules %q"+
+			" to check preloaded classes against", missingDeps)
+		return layout
+	}
+
+	dir := android.PathForOutput(ctx, ctx.Config().DeviceName(), "boot_image_layout")
+	bootClasses := dir.Join(ctx, "boot-classes.txt")
+	preloadedClasses := dir.Join(ctx, "preloaded-classes.txt")
+	missingClasses := dir.Join(ctx, "missing-classes.txt")
+	stamp := dir.Join(ctx, "preloaded-classes.stamp")
+
+	rule := android.NewRuleBuilder()
+	rule.MissingDeps(missingDeps)
+	rule.Command().
+		Text("for jar in").Inputs(jars).Text("; do zipinfo -1 $jar; done").
+		Text("| grep '\\.class$' | sed -e 's/\\.class$//' -e 's|/|.|g'").
+		Text("| sort -u").FlagWithOutput("> ", bootClasses)
+	rule.Command().
+		Text("grep -v -e '^#' -e '^$'").Input(layout.preloadedClasses).
+		Text("| sort -u").FlagWithOutput("> ", preloadedClasses)
+	rule.Command().
+		Text("comm -23").Input(preloadedClasses).Input(bootClasses).
+		FlagWithOutput("> ", missingClasses)
+	rule.Command().
+		Text("if [ -s").Input(missingClasses).Text("]; then").
+		Textf("echo %s;", proptools.ShellEscape("ERROR: "+layout.preloadedClasses.String()+
+			" lists classes that are not on the boot classpath:")).
+		Text("cat").Input(missingClasses).Text("; exit 1; fi")
+	rule.Command().Text("touch").Output(stamp)
+	rule.Build(pctx, ctx, "bootImagePreloadedClassesCheck", "check preloaded classes")
+
+	layout.preloadedClassesCheck = stamp
+	return layout
+}
+
 func dumpOatRules(ctx android.SingletonContext, image *bootImageConfig) {
 	var allPhonies android.Paths
 	for _, image := range image.variants {
@@ -18,10 +18,13 @@ import (
 	"path/filepath"
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
 
 	"android/soong/android"
 	"android/soong/dexpreopt"
+
+	"github.com/google/blueprint/proptools"
 )
 
 func TestDexpreoptBootJars(t *testing.T) {
@@ -112,3 +115,73 @@ func TestDexpreoptBootJars(t *testing.T) {
 		t.Errorf("want outputs %q\n got outputs %q", expectedOutputs, outputs)
 	}
 }
+
+func TestDexpreoptBootJarsLayout(t *testing.T) {
+	bp := `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			installable: true,
+		}
+
+		java_library {
+			name: "bar",
+			srcs: ["b.java"],
+			installable: true,
+		}
+
+		filegroup {
+			name: "preloaded-classes",
+			srcs: ["preloaded-classes"],
+		}
+
+		filegroup {
+			name: "dirty-image-objects",
+			srcs: ["dirty-image-objects"],
+		}
+	`
+
+	config := testConfig(nil, bp, map[string][]byte{
+		"preloaded-classes":   nil,
+		"dirty-image-objects": nil,
+	})
+	config.TestProductVariables.Boot_image_preloaded_classes = proptools.StringPtr("preloaded-classes")
+	config.TestProductVariables.Boot_image_dirty_image_objects = proptools.StringPtr("dirty-image-objects")
+
+	pathCtx := android.PathContextForTesting(config)
+	dexpreoptConfig := dexpreopt.GlobalConfigForTests(pathCtx)
+	dexpreoptConfig.BootJars = []string{"foo", "bar"}
+	dexpreopt.SetTestGlobalConfig(config, dexpreoptConfig)
+
+	ctx := testContext()
+
+	RegisterDexpreoptBootJarsComponents(ctx)
+
+	run(t, ctx, config)
+
+	dexpreoptBootJars := ctx.SingletonForTests("dex_bootjars")
+
+	check := dexpreoptBootJars.Output("boot_image_layout/preloaded-classes.stamp")
+	for _, jar := range []string{"foo", "bar"} {
+		lib := ctx.ModuleForTests(jar, "android_common").Module().(*Library)
+		expected := lib.ImplementationJars()[0].String()
+		if !android.InList(expected, check.Implicits.Strings()) {
+			t.Errorf("expected class jar %q in preloaded classes check inputs %q", expected, check.Implicits.Strings())
+		}
+	}
+	if !android.InList("preloaded-classes", check.Implicits.Strings()) {
+		t.Errorf("expected preloaded-classes in preloaded classes check inputs %q", check.Implicits.Strings())
+	}
+
+	bootArt := dexpreoptBootJars.Output("boot-foo.art")
+	cmd := bootArt.RuleParams.Command
+	if !strings.Contains(cmd, "--preloaded-classes=preloaded-classes") {
+		t.Errorf("expected --preloaded-classes in dex2oat command %q", cmd)
+	}
+	if !strings.Contains(cmd, "--dirty-image-objects=dirty-image-objects") {
+		t.Errorf("expected --dirty-image-objects from module in dex2oat command %q", cmd)
+	}
+	if !android.InList(check.Output.String(), bootArt.Implicits.Strings()) {
+		t.Errorf("expected preloaded classes check stamp in dex2oat inputs %q", bootArt.Implicits.Strings())
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/google/blueprint"
+
+	"android/soong/android"
+)
+
+func init() {
+	RegisterDexpreoptSizeReportComponents(android.InitRegistrationContext)
+}
+
+func RegisterDexpreoptSizeReportComponents(ctx android.RegistrationContext) {
+	ctx.RegisterSingletonType("dexpreopt_size_report", dexpreoptSizeReportSingletonFactory)
+}
+
+// dexpreoptSizeReportRule writes the report from a manifest that holds a
+// "<module> <preopt|packaged> <built file>" entry for each file of each module, which is passed in a
+// response file as it can exceed the maximum length of a command line.
+var dexpreoptSizeReportRule = pctx.AndroidStaticRule("dexpreoptSizeReport",
+	blueprint.RuleParams{
+		Command: `(printf 'module\tpreopt_bytes\tpackaged_bytes\n' && ` +
+			`xargs -n 3 < $out.rsp | ` +
+			`while read -r module kind file; do ` +
+			`printf '%s\t%s\t%s\n' "$$module" "$$kind" "$$(stat -L -c %s "$$file")"; done | ` +
+			`awk -F '\t' '{ size[$$1 "\t" $$2] += $$3; modules[$$1] = 1 } ` +
+			`END { for (m in modules) print m "\t" (size[m "\tpreopt"] + 0) "\t" (size[m "\tpackaged"] + 0) }' | ` +
+			`sort) > $out`,
+		Rspfile:        "$out.rsp",
+		RspfileContent: "$manifest",
+		Description:    "dexpreopt size report",
+	}, "manifest")
+
+type dexpreoptSizeReportSingleton struct {
+	report android.WritablePath
+}
+
+func dexpreoptSizeReportSingletonFactory() android.Singleton {
+	return &dexpreoptSizeReportSingleton{}
+}
+
+type dexpreoptSizeReporter interface {
+	dexpreoptSizeReportFiles() (android.Paths, android.Path)
+}
+
+type dexpreoptSizeReportEntry struct {
+	name      string
+	artifacts android.Paths
+	dexJar    android.Path
+}
+
+// GenerateBuildActions writes a report with one line per dexpreopted module, containing the name
+// of the module, the total size in bytes of the files generated by dexpreopting it and the size in
+// bytes of the jar or apk it is packaged in, which no longer contains dex files if they were
+// stripped.
+func (d *dexpreoptSizeReportSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	var entries []dexpreoptSizeReportEntry
+	ctx.VisitAllModules(func(module android.Module) {
+		if r, ok := module.(dexpreoptSizeReporter); ok {
+			artifacts, dexJar := r.dexpreoptSizeReportFiles()
+			if len(artifacts) > 0 && dexJar != nil {
+				entries = append(entries, dexpreoptSizeReportEntry{ctx.ModuleName(module), artifacts, dexJar})
+			}
+		}
+	})
+	if len(entries) == 0 {
+		return
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+	d.report = android.PathForOutput(ctx, "dexpreopt_size_report.txt")
+
+	var manifest []string
+	var files android.Paths
+	for _, entry := range entries {
+		for _, artifact := range entry.artifacts {
+			manifest = append(manifest, entry.name, "preopt", artifact.String())
+		}
+		manifest = append(manifest, entry.name, "packaged", entry.dexJar.String())
+		files = append(files, entry.artifacts...)
+		files = append(files, entry.dexJar)
+	}
+	ctx.Build(pctx, android.BuildParams{
+		Rule:      dexpreoptSizeReportRule,
+		Output:    d.report,
+		Implicits: files,
+		Args: map[string]string{
+			"manifest": strings.Join(manifest, " "),
+		},
+	})
+
+	ctx.Phony("dexpreopt_size_report", d.report)
+}
+
+func (d *dexpreoptSizeReportSingleton) MakeVars(ctx android.MakeVarsContext) {
+	if d.report == nil {
+		return
+	}
+
+	ctx.Strict("SOONG_DEXPREOPT_SIZE_REPORT", d.report.String())
+	ctx.DistForGoal("dexpreopt_size_report", d.report)
+}
+
+var _ android.SingletonMakeVarsProvider = (*dexpreoptSizeReportSingleton)(nil)
@@ -15,7 +15,11 @@
 package java
 
 import (
+	"strings"
 	"testing"
+
+	"android/soong/android"
+	"android/soong/dexpreopt"
 )
 
 func TestDexpreoptEnabled(t *testing.T) {
@@ -166,3 +170,96 @@ func enabledString(enabled bool) string {
 		return "disabled"
 	}
 }
+
+func TestDexpreoptStripDex(t *testing.T) {
+	bp := `
+		android_app {
+			name: "foo",
+			srcs: ["a.java"],
+			sdk_version: "current",
+		}
+
+		android_app {
+			name: "bar",
+			srcs: ["a.java"],
+			sdk_version: "current",
+		}
+	`
+
+	config := testAppConfig(nil, bp, nil)
+
+	pathCtx := android.PathContextForTesting(config)
+	dexpreoptConfig := dexpreopt.GlobalConfigForTests(pathCtx)
+	dexpreoptConfig.StripDex = true
+	dexpreoptConfig.NeverStripModules = []string{"bar"}
+	dexpreopt.SetTestGlobalConfig(config, dexpreoptConfig)
+
+	ctx := testContext()
+	RegisterDexpreoptSizeReportComponents(ctx)
+	run(t, ctx, config)
+
+	foo := ctx.ModuleForTests("foo", "android_common")
+	strip := foo.Description("strip dex")
+	if !strings.Contains(strip.RuleParams.Command, "-x 'classes*.dex'") {
+		t.Errorf("expected dex files to be excluded in strip command %q", strip.RuleParams.Command)
+	}
+	unsignedApk := foo.Output("foo-unsigned.apk")
+	if !android.InList(strip.Output.String(), unsignedApk.Inputs.Strings()) {
+		t.Errorf("expected stripped dex jar %q in apk inputs %q", strip.Output.String(), unsignedApk.Inputs.Strings())
+	}
+
+	bar := ctx.ModuleForTests("bar", "android_common")
+	if r := bar.MaybeDescription("strip dex"); r.Rule != nil {
+		t.Errorf("expected dex files of bar not to be stripped")
+	}
+
+	report := ctx.SingletonForTests("dexpreopt_size_report").Output("dexpreopt_size_report.txt")
+	if !android.InList(strip.Output.String(), report.Implicits.Strings()) {
+		t.Errorf("expected stripped dex jar %q in size report inputs %q", strip.Output.String(), report.Implicits.Strings())
+	}
+	for _, name := range []string{"foo", "bar"} {
+		if !strings.Contains(report.Args["manifest"], name+" packaged ") {
+			t.Errorf("expected %s in size report manifest %q", name, report.Args["manifest"])
+		}
+	}
+}
+
+func TestDexpreoptCompilerFilter(t *testing.T) {
+	ctx, _ := testJava(t, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			installable: true,
+			dex_preopt: {
+				compiler_filter: "speed",
+			},
+		}
+
+		java_library {
+			name: "bar",
+			srcs: ["a.java"],
+			installable: true,
+		}
+	`)
+
+	foo := ctx.ModuleForTests("foo", "android_common").Description("dexpreopt")
+	if !strings.Contains(foo.RuleParams.Command, "--compiler-filter=speed") {
+		t.Errorf("expected --compiler-filter=speed in dexpreopt command %q", foo.RuleParams.Command)
+	}
+
+	bar := ctx.ModuleForTests("bar", "android_common").Description("dexpreopt")
+	if strings.Contains(bar.RuleParams.Command, "--compiler-filter=speed ") {
+		t.Errorf("expected the default compiler filter in dexpreopt command %q", bar.RuleParams.Command)
+	}
+
+	testJavaError(t, `unknown compiler filter "fast"`, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			installable: true,
+			dex_preopt: {
+				compiler_filter: "fast",
+			},
+		}
+	`)
+}
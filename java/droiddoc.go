@@ -394,6 +394,10 @@ type Javadoc struct {
 func (j *Javadoc) OutputFiles(tag string) (android.Paths, error) {
 	switch tag {
 	case "":
+		// Only droiddoc modules generate stubs sources, javadoc modules only generate docs.
+		if j.stubsSrcJar == nil {
+			return nil, fmt.Errorf("javadoc modules do not generate stubs sources, use the %q tag for the docs", ".docs.zip")
+		}
 		return android.Paths{j.stubsSrcJar}, nil
 	case ".docs.zip":
 		return android.Paths{j.docZip}, nil
@@ -1189,6 +1193,8 @@ type Droidstubs struct {
 	apiLintTimestamp              android.WritablePath
 	apiLintReport                 android.WritablePath
 
+	updateApiLintBaselineTimestamp android.WritablePath
+
 	checkNullabilityWarningsTimestamp android.WritablePath
 
 	annotationsZip android.WritablePath
@@ -1238,8 +1244,16 @@ func (d *Droidstubs) OutputFiles(tag string) (android.Paths, error) {
 	case ".docs.zip":
 		return android.Paths{d.docZip}, nil
 	case ".annotations.zip":
+		if d.annotationsZip == nil {
+			return nil, fmt.Errorf("annotations are only generated with annotations_enabled: true")
+		}
 		return android.Paths{d.annotationsZip}, nil
 	case ".api_versions.xml":
+		// The API level database generated from the historical android.jar files is used by lint's
+		// NewApi check.
+		if d.apiVersionsXml == nil {
+			return nil, fmt.Errorf("the API level database is only generated with api_levels_annotations_enabled: true")
+		}
 		return android.Paths{d.apiVersionsXml}, nil
 	default:
 		return nil, fmt.Errorf("unsupported module reference tag %q", tag)
@@ -1448,10 +1462,10 @@ func metalavaCmd(ctx android.ModuleContext, rule *android.RuleBuilder, javaVersi
 	// Metalava uses lots of memory, restrict the number of metalava jobs that can run in parallel.
 	rule.HighMem()
 	cmd := rule.Command()
-	if ctx.Config().IsEnvTrue("RBE_METALAVA") {
+	if remoteexec.UseRemote(ctx, "metalava") {
 		rule.Remoteable(android.RemoteRuleSupports{RBE: true})
 		pool := ctx.Config().GetenvWithDefault("RBE_METALAVA_POOL", "metalava")
-		execStrategy := ctx.Config().GetenvWithDefault("RBE_METALAVA_EXEC_STRATEGY", remoteexec.LocalExecStrategy)
+		execStrategy := remoteexec.ExecStrategy(ctx, "metalava", remoteexec.LocalExecStrategy)
 		labels := map[string]string{"type": "compile", "lang": "java", "compiler": "metalava"}
 		if !sandbox {
 			execStrategy = remoteexec.LocalExecStrategy
@@ -1617,14 +1631,31 @@ func (d *Droidstubs) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 			cmd.FlagWithInput("--baseline:api-lint ", baselineFile.Path())
 			cmd.FlagWithOutput("--update-baseline:api-lint ", updatedBaselineOutput)
 
+			if ctx.Config().IsEnvTrue("UPDATE_API_LINT_BASELINES") {
+				// Record the new issues in the updated baseline instead of failing, so that the
+				// update rule below can copy it over the checked in baseline.
+				cmd.Flag("--pass-baseline-updates")
+			}
+
 			msg += fmt.Sprintf(``+
 				`2. You can update the baseline by executing the following\n`+
 				`   command:\n`+
 				`       cp \\\n`+
 				`       "'"$PWD"$'/%s" \\\n`+
 				`       "'"$PWD"$'/%s"\n`+
+				`   or by running:\n`+
+				`       UPDATE_API_LINT_BASELINES=true m %s-update-api-lint-baseline\n`+
 				`   To submit the revised baseline.txt to the main Android\n`+
-				`   repository, you will need approval.\n`, updatedBaselineOutput, baselineFile.Path())
+				`   repository, you will need approval.\n`, updatedBaselineOutput, baselineFile.Path(), d.Name())
+
+			d.updateApiLintBaselineTimestamp = android.PathForModuleOut(ctx, "update_api_lint_baseline.timestamp")
+
+			updateRule := android.NewRuleBuilder()
+			updateRule.Command().
+				Text("cp").Flag("-f").
+				Input(updatedBaselineOutput).Flag(baselineFile.String())
+			updateRule.Command().Text("touch").Output(d.updateApiLintBaselineTimestamp)
+			updateRule.Build(pctx, ctx, "metalavaApiLintBaselineUpdate", "update API lint baseline")
 		} else {
 			msg += fmt.Sprintf(``+
 				`2. You can add a baseline file of existing lint failures\n`+
@@ -1800,6 +1831,7 @@ func (d *Droidstubs) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 		if d.nullabilityWarningsFile == nil {
 			ctx.PropertyErrorf("check_nullability_warnings",
 				"Cannot specify check_nullability_warnings unless validating nullability")
+			return
 		}
 
 		checkNullabilityWarnings := android.PathForModuleSrc(ctx, String(d.properties.Check_nullability_warnings))
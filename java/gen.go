@@ -149,6 +149,8 @@ func (j *Module) genSources(ctx android.ModuleContext, srcFiles android.Paths,
 			outSrcFiles = append(outSrcFiles, javaFile)
 		case ".proto":
 			protoSrcs = append(protoSrcs, srcFile)
+		case ".rs", ".fs":
+			// Compiled by renderscriptBuildActions.
 		default:
 			outSrcFiles = append(outSrcFiles, srcFile)
 		}
@@ -156,7 +158,7 @@ func (j *Module) genSources(ctx android.ModuleContext, srcFiles android.Paths,
 
 	// Process all proto files together to support sharding them into one or more rules that produce srcjars.
 	if len(protoSrcs) > 0 {
-		srcJarFiles := genProto(ctx, protoSrcs, flags.proto)
+		srcJarFiles := genProto(ctx, protoSrcs, flags.proto, flags.grpcOutFlag)
 		outSrcFiles = append(outSrcFiles, srcJarFiles...)
 	}
 
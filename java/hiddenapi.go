@@ -27,11 +27,46 @@ var hiddenAPIGenerateCSVRule = pctx.AndroidStaticRule("hiddenAPIGenerateCSV", bl
 	CommandDeps: []string{"${config.Class2Greylist}"},
 }, "outFlag", "stubAPIFlags")
 
+type HiddenAPIProperties struct {
+	// Lists of member signatures of this module, one per line, that are added to the lists in
+	// frameworks/base/config that override the hidden API flags derived from the stubs.  Only used
+	// if the module is on the boot jars list or provides hidden API information for a module on the
+	// list.
+	Hiddenapi struct {
+		// Members that are accessible to apps targeting any API level.
+		Greylist []string `android:"path"`
+
+		// Members that are accessible to apps targeting API level 29 or lower.
+		Greylist_max_q []string `android:"path"`
+
+		// Members that are accessible to apps targeting API level 28 or lower.
+		Greylist_max_p []string `android:"path"`
+
+		// Members that are accessible to apps targeting API level 26 or lower.
+		Greylist_max_o []string `android:"path"`
+
+		// Members that are not accessible to apps.
+		Blacklist []string `android:"path"`
+	}
+}
+
+// hiddenAPIFlagLists holds the lists of member signatures that a module adds to hiddenapi-flags.csv.
+type hiddenAPIFlagLists struct {
+	greylist     android.Paths
+	greylistMaxQ android.Paths
+	greylistMaxP android.Paths
+	greylistMaxO android.Paths
+	blacklist    android.Paths
+}
+
 type hiddenAPI struct {
+	hiddenAPIProperties HiddenAPIProperties
+
 	bootDexJarPath  android.Path
 	flagsCSVPath    android.Path
 	indexCSVPath    android.Path
 	metadataCSVPath android.Path
+	flagListPaths   hiddenAPIFlagLists
 }
 
 func (h *hiddenAPI) flagsCSV() android.Path {
@@ -50,11 +85,16 @@ func (h *hiddenAPI) indexCSV() android.Path {
 	return h.indexCSVPath
 }
 
+func (h *hiddenAPI) flagLists() hiddenAPIFlagLists {
+	return h.flagListPaths
+}
+
 type hiddenAPIIntf interface {
 	bootDexJar() android.Path
 	flagsCSV() android.Path
 	indexCSV() android.Path
 	metadataCSV() android.Path
+	flagLists() hiddenAPIFlagLists
 }
 
 var _ hiddenAPIIntf = (*hiddenAPI)(nil)
@@ -84,6 +124,15 @@ func (h *hiddenAPI) hiddenAPI(ctx android.ModuleContext, name string, primary bo
 			indexCSV := android.PathForModuleOut(ctx, "hiddenapi", "index.csv")
 			h.hiddenAPIGenerateCSV(ctx, flagsCSV, metadataCSV, indexCSV, implementationJar)
 
+			props := h.hiddenAPIProperties.Hiddenapi
+			h.flagListPaths = hiddenAPIFlagLists{
+				greylist:     android.PathsForModuleSrc(ctx, props.Greylist),
+				greylistMaxQ: android.PathsForModuleSrc(ctx, props.Greylist_max_q),
+				greylistMaxP: android.PathsForModuleSrc(ctx, props.Greylist_max_p),
+				greylistMaxO: android.PathsForModuleSrc(ctx, props.Greylist_max_o),
+				blacklist:    android.PathsForModuleSrc(ctx, props.Blacklist),
+			}
+
 			// If this module is actually on the boot jars list and not providing
 			// hiddenapi information for a module on the boot jars list then encode
 			// the gathered information in the generated dex file.
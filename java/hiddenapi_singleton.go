@@ -21,9 +21,13 @@ import (
 )
 
 func init() {
-	android.RegisterSingletonType("hiddenapi", hiddenAPISingletonFactory)
-	android.RegisterSingletonType("hiddenapi_index", hiddenAPIIndexSingletonFactory)
-	android.RegisterModuleType("hiddenapi_flags", hiddenAPIFlagsFactory)
+	RegisterHiddenAPIBuildComponents(android.InitRegistrationContext)
+}
+
+func RegisterHiddenAPIBuildComponents(ctx android.RegistrationContext) {
+	ctx.RegisterSingletonType("hiddenapi", hiddenAPISingletonFactory)
+	ctx.RegisterSingletonType("hiddenapi_index", hiddenAPIIndexSingletonFactory)
+	ctx.RegisterModuleType("hiddenapi_flags", hiddenAPIFlagsFactory)
 }
 
 type hiddenAPISingletonPathsStruct struct {
@@ -217,16 +221,23 @@ func moduleForGreyListRemovedApis(ctx android.SingletonContext, module android.M
 }
 
 // flagsRule creates a rule to build hiddenapi-flags.csv out of flags.csv files generated for boot image modules and
-// the greylists.
+// the greylists, including the lists of members set in the hiddenapi properties of boot image modules.
 func flagsRule(ctx android.SingletonContext) android.Path {
 	var flagsCSV android.Paths
 	var greylistRemovedApis android.Paths
+	var flagLists hiddenAPIFlagLists
 
 	ctx.VisitAllModules(func(module android.Module) {
 		if h, ok := module.(hiddenAPIIntf); ok {
 			if csv := h.flagsCSV(); csv != nil {
 				flagsCSV = append(flagsCSV, csv)
 			}
+			lists := h.flagLists()
+			flagLists.greylist = append(flagLists.greylist, lists.greylist...)
+			flagLists.greylistMaxQ = append(flagLists.greylistMaxQ, lists.greylistMaxQ...)
+			flagLists.greylistMaxP = append(flagLists.greylistMaxP, lists.greylistMaxP...)
+			flagLists.greylistMaxO = append(flagLists.greylistMaxO, lists.greylistMaxO...)
+			flagLists.blacklist = append(flagLists.blacklist, lists.blacklist...)
 		} else if ds, ok := module.(*Droidstubs); ok {
 			// Track @removed public and system APIs via corresponding droidstubs targets.
 			// These APIs are not present in the stubs, however, we have to keep allowing access
@@ -258,15 +269,20 @@ func flagsRule(ctx android.SingletonContext) android.Path {
 		Inputs(flagsCSV).
 		FlagWithInput("--greylist ",
 			android.PathForSource(ctx, "frameworks/base/config/hiddenapi-greylist.txt")).
+		Inputs(flagLists.greylist).
 		FlagWithInput("--greylist-ignore-conflicts ", combinedRemovedApis).
 		FlagWithInput("--greylist-max-q ",
 			android.PathForSource(ctx, "frameworks/base/config/hiddenapi-greylist-max-q.txt")).
+		Inputs(flagLists.greylistMaxQ).
 		FlagWithInput("--greylist-max-p ",
 			android.PathForSource(ctx, "frameworks/base/config/hiddenapi-greylist-max-p.txt")).
+		Inputs(flagLists.greylistMaxP).
 		FlagWithInput("--greylist-max-o-ignore-conflicts ",
 			android.PathForSource(ctx, "frameworks/base/config/hiddenapi-greylist-max-o.txt")).
+		Inputs(flagLists.greylistMaxO).
 		FlagWithInput("--blacklist ",
 			android.PathForSource(ctx, "frameworks/base/config/hiddenapi-force-blacklist.txt")).
+		Inputs(flagLists.blacklist).
 		FlagWithInput("--greylist-packages ",
 			android.PathForSource(ctx, "frameworks/base/config/hiddenapi-greylist-packages.txt")).
 		FlagWithOutput("--output ", tempPath)
@@ -0,0 +1,74 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHiddenAPIFlagLists(t *testing.T) {
+	bp := `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			hiddenapi: {
+				greylist: ["foo-greylist.txt"],
+				blacklist: ["foo-blacklist.txt"],
+			},
+		}
+
+		java_library {
+			name: "bar",
+			srcs: ["b.java"],
+			hiddenapi: {
+				greylist: ["bar-greylist.txt"],
+			},
+		}
+	`
+
+	config := testConfig(nil, bp, map[string][]byte{
+		"foo-greylist.txt":  nil,
+		"foo-blacklist.txt": nil,
+		"bar-greylist.txt":  nil,
+		"frameworks/base/config/hiddenapi-greylist.txt":        nil,
+		"frameworks/base/config/hiddenapi-force-blacklist.txt": nil,
+	})
+	config.TestProductVariables.BootJars = []string{"foo"}
+
+	ctx := testContext()
+	RegisterHiddenAPIBuildComponents(ctx)
+	run(t, ctx, config)
+
+	foo := ctx.ModuleForTests("foo", "android_common")
+	if foo.MaybeOutput("hiddenapi/foo.jar").Rule == nil {
+		t.Errorf("expected the hidden API flags to be encoded into the dex jar of foo")
+	}
+
+	flags := ctx.SingletonForTests("hiddenapi").Rule("hiddenAPIFlagsFile")
+	for _, w := range []string{
+		"--greylist frameworks/base/config/hiddenapi-greylist.txt foo-greylist.txt ",
+		"--blacklist frameworks/base/config/hiddenapi-force-blacklist.txt foo-blacklist.txt ",
+	} {
+		if !strings.Contains(flags.RuleParams.Command, w) {
+			t.Errorf("expected %q in the hiddenapi flags command %q", w, flags.RuleParams.Command)
+		}
+	}
+
+	// bar is not on the boot jars list, so its lists don't affect the hidden API flags.
+	if strings.Contains(flags.RuleParams.Command, "bar-greylist.txt") {
+		t.Errorf("expected the greylist of bar not to be used, got %q", flags.RuleParams.Command)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+// This file contains the support for host_jni_libs, the host native shared libraries that are
+// packaged into the jars of host modules.
+
+import (
+	"path/filepath"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/pathtools"
+
+	"android/soong/android"
+	"android/soong/cc"
+)
+
+var hostJniLibTag = &jniDependencyTag{}
+
+// hostJniLibsDeps adds the dependencies on the libraries in host_jni_libs, built for the primary
+// architecture of the host.
+func (j *Module) hostJniLibsDeps(ctx android.BottomUpMutatorContext) {
+	if len(j.properties.Host_jni_libs) == 0 {
+		return
+	}
+	if ctx.Device() {
+		ctx.PropertyErrorf("host_jni_libs", "only supported for host modules")
+		return
+	}
+
+	targets := ctx.Config().Targets[ctx.Os()]
+	if len(targets) == 0 {
+		return
+	}
+	variation := append(targets[0].Variations(),
+		blueprint.Variation{Mutator: "link", Variation: "shared"})
+	ctx.AddFarVariationDependencies(variation, hostJniLibTag, j.properties.Host_jni_libs...)
+}
+
+// collectHostJniLibs returns the libraries in host_jni_libs.
+func (j *Module) collectHostJniLibs(ctx android.ModuleContext) []jniLib {
+	var libs []jniLib
+	ctx.VisitDirectDepsWithTag(hostJniLibTag, func(module android.Module) {
+		otherName := ctx.OtherModuleName(module)
+		dep, ok := module.(*cc.Module)
+		if !ok {
+			ctx.PropertyErrorf("host_jni_libs", "%q is not a native shared library", otherName)
+			return
+		}
+		if lib := dep.OutputFile(); lib.Valid() {
+			libs = append(libs, jniLib{
+				name:   otherName,
+				path:   lib.Path(),
+				target: module.Target(),
+			})
+		} else {
+			ctx.ModuleErrorf("dependency %q missing output file", otherName)
+		}
+	})
+	return libs
+}
+
+// hostJniLibJarDir returns the directory in the jar that the libraries for the target are
+// packaged in, for example lib/linux-x86_64.
+func hostJniLibJarDir(target android.Target) string {
+	os := target.Os.String()
+	if target.Os == android.Linux {
+		os = "linux"
+	}
+	return filepath.Join("lib", os+"-"+target.Arch.ArchType.String())
+}
+
+// hostJniLibInstallDir returns the directory, relative to the host output directory, that the
+// libraries for the target are installed to.
+func hostJniLibInstallDir(target android.Target) string {
+	if target.Arch.ArchType.Multilib == "lib64" {
+		return "lib64"
+	}
+	return "lib"
+}
+
+// hostJniLibsToJarArgs returns the arguments to soong_zip -jar that package the libraries into
+// the jar.  They set the path prefix in the jar, so they must come after any other arguments.
+func hostJniLibsToJarArgs(libs []jniLib) (args []string, deps android.Paths) {
+	for _, lib := range libs {
+		args = append(args,
+			"-P", hostJniLibJarDir(lib.target),
+			"-C", filepath.Dir(lib.path.String()),
+			"-f", pathtools.MatchEscape(lib.path.String()))
+		deps = append(deps, lib.path)
+	}
+	return args, deps
+}
@@ -28,6 +28,14 @@ import (
 	"android/soong/java/config"
 )
 
+func init() {
+	RegisterJacocoBuildComponents(android.InitRegistrationContext)
+}
+
+func RegisterJacocoBuildComponents(ctx android.RegistrationContext) {
+	ctx.RegisterSingletonType("jacoco_report_classes", jacocoReportClassesSingletonFactory)
+}
+
 var (
 	jacoco = pctx.AndroidStaticRule("jacoco", blueprint.RuleParams{
 		Command: `rm -rf $tmpDir && mkdir -p $tmpDir && ` +
@@ -141,3 +149,74 @@ func jacocoFilterToSpec(filter string) (string, error) {
 
 	return spec, nil
 }
+
+type jacocoReportClassesSingleton struct {
+	jar android.WritablePath
+}
+
+func jacocoReportClassesSingletonFactory() android.Singleton {
+	return &jacocoReportClassesSingleton{}
+}
+
+// GenerateBuildActions collects the uninstrumented classes of every module that was instrumented
+// with jacoco into soong-jacoco-report-classes.jar, which is needed to generate a coverage report
+// from the coverage data collected on the device.  The classes of each variant of a module are
+// placed in a <module>/<variant> directory, as the same classes may be instrumented by several
+// modules.  Make builds its own jacoco-report-classes-all.jar from the
+// LOCAL_SOONG_JACOCO_REPORT_CLASSES_JAR of the modules it knows about, so this jar uses a distinct
+// name.
+func (j *jacocoReportClassesSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	if !ctx.Config().IsEnvTrue("EMMA_INSTRUMENT") {
+		return
+	}
+
+	var prefixes []string
+	var reportClassesFiles android.Paths
+	ctx.VisitAllModules(func(module android.Module) {
+		if !module.Enabled() {
+			return
+		}
+		if dep, ok := module.(Dependency); ok && dep.JacocoReportClassesFile() != nil {
+			prefixes = append(prefixes, filepath.Join(ctx.ModuleName(module), ctx.ModuleSubDir(module)))
+			reportClassesFiles = append(reportClassesFiles, dep.JacocoReportClassesFile())
+		}
+	})
+	if len(reportClassesFiles) == 0 {
+		return
+	}
+
+	j.jar = android.PathForOutput(ctx, "jacoco", "soong-jacoco-report-classes.jar")
+
+	// The -P and -f arguments for every module are passed to soong_zip in a response file, as they
+	// can exceed the maximum length of a command line.
+	var args []string
+	for i, file := range reportClassesFiles {
+		args = append(args, "-P", prefixes[i], "-f", file.String())
+	}
+	rspFile := android.PathForOutput(ctx, "jacoco", "soong-jacoco-report-classes.rsp")
+	android.WriteFileRule(ctx, rspFile, strings.Join(args, " "))
+
+	rule := android.NewRuleBuilder()
+	rule.Command().
+		BuiltTool(ctx, "soong_zip").
+		FlagWithOutput("-o ", j.jar).
+		Flag("-L 0").
+		Flag("-j").
+		Text("@" + rspFile.String()).
+		Implicit(rspFile).
+		Implicits(reportClassesFiles)
+	rule.Build(pctx, ctx, "jacoco_report_classes", "jacoco report classes jar")
+
+	ctx.Phony("soong-jacoco-report-classes", j.jar)
+}
+
+func (j *jacocoReportClassesSingleton) MakeVars(ctx android.MakeVarsContext) {
+	if j.jar == nil {
+		return
+	}
+
+	ctx.Strict("SOONG_JACOCO_REPORT_CLASSES_JAR", j.jar.String())
+	ctx.DistForGoal("dist_files", j.jar)
+}
+
+var _ android.SingletonMakeVarsProvider = (*jacocoReportClassesSingleton)(nil)
@@ -14,7 +14,12 @@
 
 package java
 
-import "testing"
+import (
+	"strings"
+	"testing"
+
+	"android/soong/android"
+)
 
 func TestJacocoFilterToSpecs(t *testing.T) {
 	testCases := []struct {
@@ -103,3 +108,54 @@ func TestJacocoFiltersToZipCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestJacocoReportClasses(t *testing.T) {
+	bp := `
+		android_test {
+			name: "foo",
+			srcs: ["a.java"],
+			jacoco: {
+				include_filter: ["com.android.foo.**"],
+			},
+		}
+
+		java_library {
+			name: "bar",
+			srcs: ["b.java"],
+		}
+	`
+
+	config := testConfig(map[string]string{"EMMA_INSTRUMENT": "true"}, bp, nil)
+
+	ctx := testContext()
+	RegisterJacocoBuildComponents(ctx)
+	run(t, ctx, config)
+
+	foo := ctx.ModuleForTests("foo", "android_common")
+	instrument := foo.Rule("jacoco")
+	if !strings.Contains(instrument.Args["stripSpec"], "com/android/foo/**/*.class") {
+		t.Errorf("expected the include filter in the jacoco strip spec, got %q", instrument.Args["stripSpec"])
+	}
+
+	// The uninstrumented classes are used by the report, the instrumented ones are packaged.
+	reportClasses := foo.Module().(*AndroidTest).JacocoReportClassesFile()
+	if reportClasses == nil {
+		t.Fatalf("expected foo to be instrumented")
+	}
+	if bar := ctx.ModuleForTests("bar", "android_common").Module().(*Library); bar.JacocoReportClassesFile() != nil {
+		t.Errorf("expected bar not to be instrumented")
+	}
+
+	jar := ctx.SingletonForTests("jacoco_report_classes").Output("jacoco/soong-jacoco-report-classes.jar")
+	if !inList(reportClasses.String(), jar.Implicits.Strings()) {
+		t.Errorf("expected report classes %q in inputs %q", reportClasses.String(), jar.Implicits.Strings())
+	}
+	rsp := ctx.SingletonForTests("jacoco_report_classes").Output("jacoco/soong-jacoco-report-classes.rsp")
+	if !inList(rsp.Output.String(), jar.Implicits.Strings()) {
+		t.Errorf("expected response file %q in inputs %q", rsp.Output.String(), jar.Implicits.Strings())
+	}
+	args := android.ContentFromWriteFileRuleForTests(t, rsp)
+	if !strings.Contains(args, "-P foo/android_common -f "+reportClasses.String()) {
+		t.Errorf("expected foo report classes in foo/android_common, got arguments %q", args)
+	}
+}
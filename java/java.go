@@ -21,6 +21,7 @@ package java
 import (
 	"fmt"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -29,7 +30,9 @@ import (
 	"github.com/google/blueprint/proptools"
 
 	"android/soong/android"
+	"android/soong/cc"
 	"android/soong/java/config"
+	"android/soong/remoteexec"
 	"android/soong/tradefed"
 )
 
@@ -113,10 +116,50 @@ func (j *Module) checkSdkVersions(ctx android.ModuleContext) {
 			case bootClasspathTag, libTag, staticLibTag, java9LibTag:
 				checkLinkType(ctx, j, module.(linkTypeContext), tag.(dependencyTag))
 			}
+			if tag == libTag {
+				checkPartitionsForJavaDependency(ctx, j, module.(partitionedJavaLibrary))
+			}
 		}
 	})
 }
 
+type partitionedJavaLibrary interface {
+	linkTypeContext
+	PartitionTag(android.DeviceConfig) string
+	OptionalImplicitSdkLibrary() []string
+}
+
+// checkPartitionsForJavaDependency reports an error when a module on a partition that requires
+// stable APIs uses a java library from another partition through libs.  The library is not
+// available at runtime in the classloader of the module, so the only stable way to use it is
+// through the stubs of a java_sdk_library, which are installed as a shared library, or by
+// including it with static_libs.
+func checkPartitionsForJavaDependency(ctx android.ModuleContext, from *Module, to partitionedJavaLibrary) {
+	if !ctx.Config().EnforceInterPartitionJavaSdkLibrary() || !from.RequiresStableAPIs(ctx) {
+		return
+	}
+
+	name := ctx.OtherModuleName(to)
+	if android.InList(name, ctx.Config().InterPartitionJavaLibraryAllowList()) {
+		return
+	}
+
+	// Stubs libraries, including the ones generated by java_sdk_library, provide a stable API.
+	if _, stubs := to.getLinkType(name); stubs || len(to.OptionalImplicitSdkLibrary()) > 0 {
+		return
+	}
+
+	myPartition := from.PartitionTag(ctx.DeviceConfig())
+	otherPartition := to.PartitionTag(ctx.DeviceConfig())
+	if myPartition != otherPartition {
+		ctx.PropertyErrorf("libs",
+			"%q is installed in the %s partition and can't be used from the %s partition through libs. "+
+				"Use it through a java_sdk_library, include it with static_libs, or add it to "+
+				"PRODUCT_INTER_PARTITION_JAVA_LIBRARY_ALLOWLIST.",
+			name, otherPartition, myPartition)
+	}
+}
+
 func (j *Module) checkPlatformAPI(ctx android.ModuleContext) {
 	if sc, ok := ctx.Module().(sdkContext); ok {
 		usePlatformAPI := proptools.Bool(j.deviceProperties.Platform_apis)
@@ -141,15 +184,17 @@ func (j *Module) checkPlatformAPI(ctx android.ModuleContext) {
 
 type CompilerProperties struct {
 	// list of source files used to compile the Java module.  May be .java, .logtags, .proto,
-	// or .aidl files.
+	// .aidl, or renderscript .rs and .fs files.
 	Srcs []string `android:"path,arch_variant"`
 
 	// list of source files that should not be used to build the Java module.
 	// This is most useful in the arch/multilib variants to remove non-common files
 	Exclude_srcs []string `android:"path,arch_variant"`
 
-	// list of directories containing Java resources
-	Java_resource_dirs []string `android:"arch_variant"`
+	// list of directories containing Java resources.  A filegroup or another module referenced
+	// with ":module" adds its files at their paths relative to the module, or to the path property
+	// of a filegroup.
+	Java_resource_dirs []string `android:"path,arch_variant"`
 
 	// list of directories that should be excluded from java_resource_dirs
 	Exclude_java_resource_dirs []string `android:"arch_variant"`
@@ -157,6 +202,17 @@ type CompilerProperties struct {
 	// list of files to use as Java resources
 	Java_resources []string `android:"path,arch_variant"`
 
+	// list of host native shared libraries to package into the jar under lib/<os>-<arch>/, for
+	// example lib/linux-x86_64/.  They are also installed with the module and added to
+	// java.library.path by the wrapper generated for java_binary modules with generate_wrapper:
+	// true.  Only supported for host modules.
+	Host_jni_libs []string
+
+	// path prefix to strip from the paths of the outputs of other modules listed in
+	// java_resources, e.g. ":gen_module", when they are added to the jar.  For example, with
+	// "res" the output res/config/foo.xml of a genrule is added to the jar as config/foo.xml.
+	Java_resource_strip_prefix *string
+
 	// list of files that should be excluded from java_resources and java_resource_dirs
 	Exclude_java_resources []string `android:"path,arch_variant"`
 
@@ -166,6 +222,10 @@ type CompilerProperties struct {
 	// list of module-specific flags that will be used for kotlinc compiles
 	Kotlincflags []string `android:"arch_variant"`
 
+	// list of Kotlin source files that are compiled as the common sources of a multiplatform
+	// module, for example expect declarations whose actual declarations are in srcs.
+	Common_srcs []string `android:"path,arch_variant"`
+
 	// list of of java libraries that will be in the classpath
 	Libs []string `android:"arch_variant"`
 
@@ -175,10 +235,36 @@ type CompilerProperties struct {
 	// manifest file to be included in resulting jar
 	Manifest *string `android:"path"`
 
+	// Name of the class containing main to be inserted into the manifest as Main-Class.
+	Main_class *string
+
+	// list of attributes to be inserted into the manifest, each in the form "Name: value".
+	Manifest_attributes []string
+
+	// If set to true, insert the build number into the manifest as Implementation-Version.  The
+	// build number is stamped into the jar after it has been built, see stamp.
+	Inject_implementation_version *bool
+
+	// Build information to stamp into the jar.  The jar is stamped in a separate step after it
+	// has been built, or after it has been compiled to dex, so that a new build number or source
+	// revision only reruns that step and the steps after it, and dependent modules are compiled
+	// against the unstamped jar.
+	Stamp struct {
+		// If set to true, insert the build number and the source revision into the manifest as
+		// Implementation-Version and SCM-Revision.
+		Manifest *bool
+
+		// list of java resources, as paths in the jar, in which @BUILD_NUMBER@ and
+		// @SCM_REVISION@ are replaced with the build number and the source revision.
+		Java_resources []string
+	}
+
 	// if not blank, run jarjar using the specified rules file
 	Jarjar_rules *string `android:"path,arch_variant"`
 
-	// If not blank, set the java version passed to javac as -source and -target
+	// If not blank, set the java version passed to javac as -source and -target, or as --release for
+	// host modules that compile against the JDK, which also restricts them to the APIs of that
+	// release of the JDK.  Must not be higher than the version of the JDK.
 	Java_version *string
 
 	// If set to true, allow this module to be dexed and installed on devices.  Has no
@@ -188,6 +274,10 @@ type CompilerProperties struct {
 	// If set to true, include sources used to compile the module in to the final jar
 	Include_srcs *bool
 
+	// If set to true, javac also generates JNI headers for the native methods declared in the
+	// sources.  cc modules add the headers to their include path with jni_header_libs.
+	Generate_jni_headers *bool
+
 	// If not empty, classes are restricted to the specified packages and their sub-packages.
 	// This restriction is checked after applying jarjar rules and including static libs.
 	Permitted_packages []string
@@ -198,7 +288,10 @@ type CompilerProperties struct {
 	// List of modules to export to libraries that directly depend on this library as annotation processors
 	Exported_plugins []string
 
-	// The number of Java source entries each Javac instance can process
+	// The number of Java source entries each Javac instance can process.  If set, the sources are
+	// split into shards that are compiled in parallel against the header jar of the module, and the
+	// classes of the shards are merged.  Sharding requires turbine, and is only supported for device
+	// modules.
 	Javac_shard_size *int64
 
 	// Add host jdk tools.jar to bootclasspath
@@ -242,11 +335,25 @@ type CompilerProperties struct {
 	Errorprone struct {
 		// List of javac flags that should only be used when running errorprone.
 		Javacflags []string
+
+		// List of java_plugin modules that provide extra errorprone checks.
+		Extra_check_modules []string
+
+		// Whether to run errorprone on this module when the build runs errorprone with
+		// RUN_ERROR_PRONE=true.  Defaults to true.
+		Enabled *bool
 	}
 
 	Proto struct {
 		// List of extra options that will be passed to the proto generator.
 		Output_params []string
+
+		// Name of a host tool module that is used as a protoc plugin to generate gRPC service stubs
+		// for the services declared in the .proto srcs, for example "protoc-gen-grpc-java-plugin".
+		Grpc_plugin *string
+
+		// List of extra options that will be passed to the gRPC plugin.
+		Grpc_output_params []string
 	}
 
 	Instrument bool `blueprint:"mutated"`
@@ -256,12 +363,27 @@ type CompilerProperties struct {
 
 	// If true, package the kotlin stdlib into the jar.  Defaults to true.
 	Static_kotlin_stdlib *bool `android:"arch_variant"`
+
+	// If true, don't add the kotlin stdlib to the classpath of a module that has Kotlin sources.
+	// The kotlin stdlib is also not added to modules that don't use the standard libraries.
+	// Defaults to false.
+	No_kotlin_stdlib *bool
 }
 
 type CompilerDeviceProperties struct {
 	// list of module-specific flags that will be used for dex compiles
 	Dxflags []string `android:"arch_variant"`
 
+	// list of proguard flag files with the keep rules that select the classes that must be in the
+	// primary classes.dex file when the dex code doesn't fit in a single dex file.  Only used when
+	// min_sdk_version is lower than 21, as older releases only load the primary classes.dex file.
+	Main_dex_rules []string `android:"path"`
+
+	// If true, desugar the uses of core library APIs, such as java.time and java.util.stream, that
+	// are not available at min_sdk_version, and add the dex code of the desugared core library
+	// runtime to the module as an extra classes.dex file.  Defaults to false.
+	Core_lib_desugaring *bool
+
 	// if not blank, set to the version of the sdk to compile against.
 	// Defaults to compiling against the current platform.
 	Sdk_version *string
@@ -297,6 +419,19 @@ type CompilerDeviceProperties struct {
 		Generate_get_transaction_name *bool
 	}
 
+	Renderscript struct {
+		// Renderscript API level to target.  Defaults to sdk_version if it is a numbered version.
+		Target_api *string
+
+		// list of flags that will be passed to llvm-rs-cc
+		Flags []string
+
+		// If true, generate code for the RenderScript support library, android.support.v8.renderscript,
+		// instead of the android.renderscript platform APIs, and link it and its JNI libraries into
+		// the app.  Requires a target API of 11 or later.
+		Compat_lib *bool
+	}
+
 	// If true, export a copy of the module as a -hostdex module for host testing.
 	Hostdex *bool
 
@@ -336,6 +471,19 @@ type CompilerDeviceProperties struct {
 
 		// Specifies the locations of files containing proguard flags.
 		Proguard_flags_files []string `android:"path"`
+
+		// If false, do not apply the product-wide shrinking policy, which consists of the
+		// obfuscation dictionary, the package to repackage classes into and the proguard flags
+		// files configured for the product.  Defaults to true.
+		Product_policy *bool
+
+		// File to use as the dictionary for obfuscated class, package and member names, overriding
+		// the product-wide dictionary.  Only used if obfuscate is true.
+		Obfuscation_dictionary *string `android:"path"`
+
+		// Package to repackage obfuscated classes into, overriding the product-wide package.  Set
+		// to "" to repackage classes into the root package.  Only used if obfuscate is true.
+		Repackage_classes *string
 	}
 
 	// When targeting 1.9 and above, override the modules to use with --system,
@@ -368,6 +516,17 @@ func (me *CompilerDeviceProperties) EffectiveOptimizeEnabled() bool {
 	return BoolDefault(me.Optimize.Enabled, me.Optimize.EnabledByDefault)
 }
 
+// runErrorProne returns true if the build runs errorprone and the module does not opt out of it.
+func (j *Module) runErrorProne(ctx android.BaseModuleContext) bool {
+	return ctx.Config().RunErrorProne() && BoolDefault(j.properties.Errorprone.Enabled, true)
+}
+
+// optimizeEnabled returns true if the module is shrunk, obfuscated and optimized with R8, unless
+// the product disables it for all modules.
+func (j *Module) optimizeEnabled(ctx android.BaseModuleContext) bool {
+	return j.deviceProperties.EffectiveOptimizeEnabled() && !ctx.Config().ProguardDisabled()
+}
+
 // Functionality common to Module and Import
 //
 // It is embedded in Module so its functionality can be used by methods in Module
@@ -408,6 +567,8 @@ type Module struct {
 	protoProperties  android.ProtoProperties
 	deviceProperties CompilerDeviceProperties
 
+	releaseSigningProperties android.ReleaseSigningProperties
+
 	// jar file containing header classes including static library dependencies, suitable for
 	// inserting into the bootclasspath/classpath of another compile
 	headerJarFile android.Path
@@ -439,6 +600,14 @@ type Module struct {
 	// output file containing mapping of obfuscated names
 	proguardDictionary android.Path
 
+	// lists each proguard rule and flags file passed to r8 together with where it came from
+	proguardRulesReport android.Path
+
+	// directories containing the JNI headers generated by javac for the native methods in the
+	// sources, and the class jars whose rules generate them
+	jniHeaderDirs android.Paths
+	jniHeaderDeps android.Paths
+
 	// output file of the module, which may be a classes jar or a dex jar
 	outputFile       android.Path
 	extraOutputFiles android.Paths
@@ -450,19 +619,34 @@ type Module struct {
 	// installed file for binary dependency
 	installFile android.Path
 
+	// host native shared libraries packaged into the jar
+	hostJniLibs []jniLib
+
 	// list of .java files and srcjars that was passed to javac
 	compiledJavaSrcs android.Paths
 	compiledSrcJars  android.Paths
 
+	// srcjars containing the sources generated by annotation processors, one for each javac shard
+	annoSrcJars android.Paths
+
 	// list of extra progurad flag files
 	extraProguardFlagFiles android.Paths
 
+	// list of extra main dex rules files, for example the keep rules generated by aapt2 for the
+	// components of an app
+	extraMainDexRuleFiles android.Paths
+
 	// manifest file to use instead of properties.Manifest
-	overrideManifest android.OptionalPath
 
 	// list of SDK lib names that this java module is exporting
 	exportedSdkLibs []string
 
+	// the dex jars of the shared libraries that this java module knows about through its
+	// dependencies, and the shared libraries that each of them uses, so that the class loader
+	// context of dexpreopted apps can include the shared libraries used indirectly
+	exportedSdkLibPaths map[string]android.Path
+	exportedSdkLibDeps  map[string][]string
+
 	// list of plugins that this java module is exporting
 	exportedPluginJars android.Paths
 
@@ -482,20 +666,33 @@ type Module struct {
 	// Extra files generated by the module type to be added as java resources.
 	extraResources android.Paths
 
+	// Extra dex jars built by the module type whose classes*.dex files are added to the dex jar of
+	// the module after its own ones.
+	extraDexJars android.Paths
+
+	// Srcjar containing the java sources reflected from the renderscript srcs.
+	renderscriptSrcJar android.Path
+
+	// Zip of Android resources containing the bitcode compiled from the renderscript srcs, which
+	// is compiled into the resources of the app or Android library.
+	renderscriptResZip android.Path
+
 	hiddenAPI
 	dexpreopter
 	linter
 
+	// publishing the library to a maven repository
+	maven mavenPublisher
+
 	// list of the xref extraction files
 	kytheFiles android.Paths
-
-	distFile android.Path
 }
 
 func (j *Module) addHostProperties() {
 	j.AddProperties(
 		&j.properties,
 		&j.protoProperties,
+		&j.releaseSigningProperties,
 	)
 }
 
@@ -504,6 +701,7 @@ func (j *Module) addHostAndDeviceProperties() {
 	j.AddProperties(
 		&j.deviceProperties,
 		&j.dexpreoptProperties,
+		&j.hiddenAPIProperties,
 		&j.linter.properties,
 	)
 }
@@ -516,6 +714,18 @@ func (j *Module) OutputFiles(tag string) (android.Paths, error) {
 		return android.Paths{j.implementationAndResourcesJar}, nil
 	case ".proguard_map":
 		return android.Paths{j.proguardDictionary}, nil
+	case ".proguard_rules_report":
+		if j.proguardRulesReport == nil {
+			return nil, fmt.Errorf("%q requires optimize.enabled: true", tag)
+		}
+		return android.Paths{j.proguardRulesReport}, nil
+	case ".maven":
+		if j.maven.zip == nil {
+			return nil, fmt.Errorf("%q requires maven.group_id and maven.version", tag)
+		}
+		return android.Paths{j.maven.zip}, nil
+	case ".annotation_srcjars":
+		return j.annoSrcJars, nil
 	default:
 		return nil, fmt.Errorf("unsupported module reference tag %q", tag)
 	}
@@ -546,10 +756,63 @@ type xref interface {
 	XrefJavaFiles() android.Paths
 }
 
+// sdkLibraryContextProvider is implemented by java modules that export the dex jars of the shared
+// libraries they know about through their dependencies, and the shared libraries that each of them
+// uses in turn.
+type sdkLibraryContextProvider interface {
+	exportedSdkLibContexts() (map[string]android.Path, map[string][]string)
+}
+
+// mergeSdkLibraryContexts adds the dex jars and the uses-libraries of the shared libraries exported
+// by module to paths and deps.  Either map may be nil if it is not needed.
+func mergeSdkLibraryContexts(paths map[string]android.Path, deps map[string][]string, module android.Module) {
+	provider, ok := module.(sdkLibraryContextProvider)
+	if !ok {
+		return
+	}
+	depPaths, depDeps := provider.exportedSdkLibContexts()
+	if paths != nil {
+		for lib, path := range depPaths {
+			if _, exists := paths[lib]; !exists {
+				paths[lib] = path
+			}
+		}
+	}
+	if deps != nil {
+		for lib, libs := range depDeps {
+			if _, exists := deps[lib]; !exists {
+				deps[lib] = libs
+			}
+		}
+	}
+}
+
+// addSdkLibraryContext adds the dex jar of the java_sdk_library module with the given name and the
+// shared libraries that it uses to paths and deps, followed by the shared libraries it exports.
+func addSdkLibraryContext(paths map[string]android.Path, deps map[string][]string, name string,
+	module android.Module) {
+
+	if lib, ok := module.(Dependency); ok {
+		if dexJar := lib.DexJar(); dexJar != nil {
+			paths[name] = dexJar
+		}
+		libs := android.FirstUniqueStrings(android.RemoveListFromList(lib.ExportedSdkLibs(), []string{name}))
+		if len(libs) > 0 {
+			deps[name] = libs
+		}
+	}
+	mergeSdkLibraryContexts(paths, deps, module)
+}
+
 func (j *Module) XrefJavaFiles() android.Paths {
 	return j.kytheFiles
 }
 
+// XrefFiles implements android.XrefProvider.
+func (j *Module) XrefFiles() android.Paths {
+	return j.kytheFiles
+}
+
 func InitJavaModule(module android.DefaultableModule, hod android.HostOrDeviceSupported) {
 	android.InitAndroidArchModule(module, hod, android.MultilibCommon)
 	android.InitDefaultableModule(module)
@@ -586,8 +849,20 @@ var (
 	instrumentationForTag = dependencyTag{name: "instrumentation_for"}
 	usesLibTag            = dependencyTag{name: "uses-library"}
 	extraLintCheckTag     = dependencyTag{name: "extra-lint-check"}
+	grpcPluginTag         = dependencyTag{name: "grpc-plugin"}
+	errorpronePluginTag   = dependencyTag{name: "errorprone-plugin"}
+	coreLibDesugaringTag  = dependencyTag{name: "core-lib-desugaring"}
+	toolchainPrebuiltTag  = dependencyTag{name: "toolchain-prebuilt"}
+	nativeLauncherTag     = dependencyTag{name: "native-launcher"}
 )
 
+// StaticLink returns true for static_libs, which are included in the jar of the module.
+func (d dependencyTag) StaticLink() bool {
+	return d == staticLibTag
+}
+
+var _ android.StaticLinkDependencyTag = dependencyTag{}
+
 func IsLibDepTag(depTag blueprint.DependencyTag) bool {
 	return depTag == libTag
 }
@@ -695,7 +970,7 @@ func (j *Module) deps(ctx android.BottomUpMutatorContext) {
 		} else if sdkDep.useModule {
 			ctx.AddVariationDependencies(nil, bootClasspathTag, sdkDep.bootclasspath...)
 			ctx.AddVariationDependencies(nil, java9LibTag, sdkDep.java9Classpath...)
-			if j.deviceProperties.EffectiveOptimizeEnabled() && sdkDep.hasStandardLibs() {
+			if j.optimizeEnabled(ctx) && sdkDep.hasStandardLibs() {
 				ctx.AddVariationDependencies(nil, proguardRaiseTag, config.DefaultBootclasspathLibraries...)
 				ctx.AddVariationDependencies(nil, proguardRaiseTag, config.DefaultLibraries...)
 			}
@@ -738,20 +1013,31 @@ func (j *Module) deps(ctx android.BottomUpMutatorContext) {
 
 	ctx.AddVariationDependencies(nil, libTag, rewriteSyspropLibs(j.properties.Libs, "libs")...)
 	ctx.AddVariationDependencies(nil, staticLibTag, rewriteSyspropLibs(j.properties.Static_libs, "static_libs")...)
+	if Bool(j.deviceProperties.Renderscript.Compat_lib) && j.hasRenderscriptSrcs() {
+		ctx.AddVariationDependencies(nil, staticLibTag, rsCompatJavaLib)
+	}
 
 	ctx.AddFarVariationDependencies(ctx.Config().BuildOSCommonTarget.Variations(), pluginTag, j.properties.Plugins...)
 	ctx.AddFarVariationDependencies(ctx.Config().BuildOSCommonTarget.Variations(), exportedPluginTag, j.properties.Exported_plugins...)
+	if j.runErrorProne(ctx) {
+		ctx.AddFarVariationDependencies(ctx.Config().BuildOSCommonTarget.Variations(), errorpronePluginTag,
+			j.properties.Errorprone.Extra_check_modules...)
+	}
+
+	j.hostJniLibsDeps(ctx)
 
 	android.ProtoDeps(ctx, &j.protoProperties)
 	if j.hasSrcExt(".proto") {
-		protoDeps(ctx, &j.protoProperties)
+		protoDeps(ctx, &j.properties, &j.protoProperties)
 	}
 
-	if j.hasSrcExt(".kt") {
+	if j.hasKotlinSrcs() {
 		// TODO(ccross): move this to a mutator pass that can tell if generated sources contain
 		// Kotlin files
-		ctx.AddVariationDependencies(nil, kotlinStdlibTag,
-			"kotlin-stdlib", "kotlin-stdlib-jdk7", "kotlin-stdlib-jdk8")
+		if j.useKotlinStdlib(ctx) {
+			ctx.AddVariationDependencies(nil, kotlinStdlibTag,
+				"kotlin-stdlib", "kotlin-stdlib-jdk7", "kotlin-stdlib-jdk8")
+		}
 		if len(j.properties.Plugins) > 0 {
 			ctx.AddVariationDependencies(nil, kotlinAnnotationsTag, "kotlin-annotations")
 		}
@@ -767,6 +1053,16 @@ func (j *Module) deps(ctx android.BottomUpMutatorContext) {
 	} else if j.shouldInstrumentStatic(ctx) {
 		ctx.AddVariationDependencies(nil, staticLibTag, "jacocoagent")
 	}
+
+	if ctx.Device() && Bool(j.deviceProperties.Core_lib_desugaring) {
+		ctx.AddVariationDependencies(nil, coreLibDesugaringTag, coreLibDesugaringRuntime)
+	}
+
+	for _, toolchain := range config.ToolchainPrebuilts {
+		if ctx.OtherModuleExists(toolchain) {
+			ctx.AddFarVariationDependencies(nil, toolchainPrebuiltTag, toolchain)
+		}
+	}
 }
 
 func hasSrcExt(srcs []string, ext string) bool {
@@ -783,6 +1079,22 @@ func (j *Module) hasSrcExt(ext string) bool {
 	return hasSrcExt(j.properties.Srcs, ext)
 }
 
+func (j *Module) hasKotlinSrcs() bool {
+	return j.hasSrcExt(".kt") || len(j.properties.Common_srcs) > 0
+}
+
+// useKotlinStdlib returns true if the kotlin stdlib should be added to the classpath of the module
+// when it has Kotlin sources.
+func (j *Module) useKotlinStdlib(ctx android.BaseModuleContext) bool {
+	if Bool(j.properties.No_kotlin_stdlib) {
+		return false
+	}
+	if ctx.Device() && !decodeSdkDep(ctx, sdkContext(j)).hasStandardLibs() {
+		return false
+	}
+	return true
+}
+
 func (j *Module) aidlFlags(ctx android.ModuleContext, aidlPreprocess android.OptionalPath,
 	aidlIncludeDirs android.Paths) (string, android.Paths) {
 
@@ -832,6 +1144,7 @@ type deps struct {
 	bootClasspath      classpath
 	processorPath      classpath
 	processorClasses   []string
+	errorProneChecks   classpath
 	staticJars         android.Paths
 	staticHeaderJars   android.Paths
 	staticResourceJars android.Paths
@@ -843,6 +1156,9 @@ type deps struct {
 	kotlinStdlib       android.Paths
 	kotlinAnnotations  android.Paths
 
+	// The stamps of the verified toolchains, which the compile actions are ordered after.
+	toolchainStamps android.Paths
+
 	disableTurbine bool
 }
 
@@ -868,6 +1184,24 @@ const (
 	javaPlatform
 )
 
+// apiName returns the name of the API that modules with the link type compile against.
+func (l linkType) apiName() string {
+	switch l {
+	case javaCore:
+		return "core Java API"
+	case javaSdk:
+		return "Android API"
+	case javaSystem:
+		return "system API"
+	case javaModule:
+		return "module API"
+	case javaSystemServer:
+		return "system server API"
+	default:
+		return "private API"
+	}
+}
+
 type linkTypeContext interface {
 	android.Module
 	getLinkType(name string) (ret linkType, stubs bool)
@@ -916,6 +1250,44 @@ func (m *Module) getLinkType(name string) (ret linkType, stubs bool) {
 	return javaSdk, false
 }
 
+// Platform-only libraries that have a stubs library that can be used in their place by modules
+// that compile against a stable API surface, keyed by the link type of the depending module.
+var platformLibraryStubs = map[string]map[linkType]string{
+	"framework": {
+		javaSdk:          "android_stubs_current",
+		javaSystem:       "android_system_stubs_current",
+		javaModule:       "android_module_lib_stubs_current",
+		javaSystemServer: "android_system_server_stubs_current",
+	},
+}
+
+// Returns the name of a stubs library that provides the API of the platform-only library name to
+// a module with the link type from, or "" if no suitable stubs library is known.  The stubs library
+// may not exist in the tree.
+func stubsAlternativeForLinkType(name string, from linkType) string {
+	if stubs, ok := platformLibraryStubs[name]; ok {
+		return stubs[from]
+	}
+
+	// The implementation library of a java_sdk_library is replaced by the stubs library for the
+	// matching scope.
+	if strings.HasSuffix(name, ".impl") {
+		baseName := strings.TrimSuffix(name, ".impl")
+		switch from {
+		case javaSdk:
+			return apiScopePublic.stubsLibraryModuleName(baseName)
+		case javaSystem:
+			return apiScopeSystem.stubsLibraryModuleName(baseName)
+		case javaModule:
+			return apiScopeModuleLib.stubsLibraryModuleName(baseName)
+		case javaSystemServer:
+			return apiScopeSystemServer.stubsLibraryModuleName(baseName)
+		}
+	}
+
+	return ""
+}
+
 func checkLinkType(ctx android.ModuleContext, from *Module, to linkTypeContext, tag dependencyTag) {
 	if ctx.Host() {
 		return
@@ -927,6 +1299,11 @@ func checkLinkType(ctx android.ModuleContext, from *Module, to linkTypeContext,
 	}
 	otherLinkType, _ := to.getLinkType(ctx.OtherModuleName(to))
 	commonMessage := "Adjust sdk_version: property of the source or target module so that target module is built with the same or smaller API set than the source."
+	if stubs := stubsAlternativeForLinkType(ctx.OtherModuleName(to), myLinkType); stubs != "" && ctx.OtherModuleExists(stubs) {
+		commonMessage += fmt.Sprintf(" Depend on the stubs library %q instead.", stubs)
+	} else {
+		commonMessage += fmt.Sprintf(" Depend on a stubs library of the %s instead.", myLinkType.apiName())
+	}
 
 	switch myLinkType {
 	case javaCore:
@@ -965,6 +1342,18 @@ func checkLinkType(ctx android.ModuleContext, from *Module, to linkTypeContext,
 	}
 }
 
+// toolchainStamps returns the stamps of the toolchain_prebuilt modules that the module depends on,
+// which the rules that run the prebuilt tools are ordered after.
+func toolchainStamps(ctx android.ModuleContext) android.Paths {
+	var stamps android.Paths
+	ctx.VisitDirectDepsWithTag(toolchainPrebuiltTag, func(module android.Module) {
+		if toolchain, ok := module.(android.VerifiedToolchain); ok {
+			stamps = append(stamps, toolchain.ToolchainVerifiedStamp())
+		}
+	})
+	return stamps
+}
+
 func (j *Module) collectDeps(ctx android.ModuleContext) deps {
 	var deps deps
 
@@ -987,19 +1376,27 @@ func (j *Module) collectDeps(ctx android.ModuleContext) deps {
 	// that, if necessary, a <uses-library> element for that java_sdk_library is
 	// added to the Android manifest.
 	j.exportedSdkLibs = append(j.exportedSdkLibs, j.OptionalImplicitSdkLibrary()...)
+	j.exportedSdkLibPaths = make(map[string]android.Path)
+	j.exportedSdkLibDeps = make(map[string][]string)
 
 	ctx.VisitDirectDeps(func(module android.Module) {
 		otherName := ctx.OtherModuleName(module)
 		tag := ctx.OtherModuleDependencyTag(module)
 
 		if _, ok := tag.(*jniDependencyTag); ok {
-			// Handled by AndroidApp.collectAppDeps
+			// Handled by AndroidApp.collectAppDeps and Module.collectHostJniLibs
 			return
 		}
 		if tag == certificateTag {
 			// Handled by AndroidApp.collectAppDeps
 			return
 		}
+		if tag == toolchainPrebuiltTag {
+			if toolchain, ok := module.(android.VerifiedToolchain); ok {
+				deps.toolchainStamps = append(deps.toolchainStamps, toolchain.ToolchainVerifiedStamp())
+			}
+			return
+		}
 
 		switch dep := module.(type) {
 		case SdkLibraryDependency:
@@ -1008,6 +1405,9 @@ func (j *Module) collectDeps(ctx android.ModuleContext) deps {
 				deps.classpath = append(deps.classpath, dep.SdkHeaderJars(ctx, j.sdkVersion())...)
 				// names of sdk libs that are directly depended are exported
 				j.exportedSdkLibs = append(j.exportedSdkLibs, dep.OptionalImplicitSdkLibrary()...)
+				for _, lib := range dep.OptionalImplicitSdkLibrary() {
+					addSdkLibraryContext(j.exportedSdkLibPaths, j.exportedSdkLibDeps, lib, module)
+				}
 			case staticLibTag:
 				ctx.ModuleErrorf("dependency on java_sdk_library %q can only be in libs", otherName)
 			}
@@ -1019,6 +1419,7 @@ func (j *Module) collectDeps(ctx android.ModuleContext) deps {
 				deps.classpath = append(deps.classpath, dep.HeaderJars()...)
 				// sdk lib names from dependencies are re-exported
 				j.exportedSdkLibs = append(j.exportedSdkLibs, dep.ExportedSdkLibs()...)
+				mergeSdkLibraryContexts(j.exportedSdkLibPaths, j.exportedSdkLibDeps, module)
 				deps.aidlIncludeDirs = append(deps.aidlIncludeDirs, dep.AidlIncludeDirs()...)
 				pluginJars, pluginClasses := dep.ExportedPlugins()
 				addPlugins(&deps, pluginJars, pluginClasses...)
@@ -1031,6 +1432,7 @@ func (j *Module) collectDeps(ctx android.ModuleContext) deps {
 				deps.staticResourceJars = append(deps.staticResourceJars, dep.ResourceJars()...)
 				// sdk lib names from dependencies are re-exported
 				j.exportedSdkLibs = append(j.exportedSdkLibs, dep.ExportedSdkLibs()...)
+				mergeSdkLibraryContexts(j.exportedSdkLibPaths, j.exportedSdkLibDeps, module)
 				deps.aidlIncludeDirs = append(deps.aidlIncludeDirs, dep.AidlIncludeDirs()...)
 				pluginJars, pluginClasses := dep.ExportedPlugins()
 				addPlugins(&deps, pluginJars, pluginClasses...)
@@ -1045,6 +1447,12 @@ func (j *Module) collectDeps(ctx android.ModuleContext) deps {
 				} else {
 					ctx.PropertyErrorf("plugins", "%q is not a java_plugin module", otherName)
 				}
+			case errorpronePluginTag:
+				if plugin, ok := dep.(*Plugin); ok {
+					deps.errorProneChecks = append(deps.errorProneChecks, plugin.ImplementationAndResourcesJars()...)
+				} else {
+					ctx.PropertyErrorf("errorprone.extra_check_modules", "%q is not a java_plugin module", otherName)
+				}
 			case exportedPluginTag:
 				if plugin, ok := dep.(*Plugin); ok {
 					if plugin.pluginProperties.Generates_api != nil && *plugin.pluginProperties.Generates_api {
@@ -1133,6 +1541,7 @@ const (
 	JAVA_VERSION_7           = 7
 	JAVA_VERSION_8           = 8
 	JAVA_VERSION_9           = 9
+	JAVA_VERSION_11          = 11
 )
 
 func (v javaVersion) String() string {
@@ -1145,6 +1554,8 @@ func (v javaVersion) String() string {
 		return "1.8"
 	case JAVA_VERSION_9:
 		return "1.9"
+	case JAVA_VERSION_11:
+		return "11"
 	default:
 		return "unsupported"
 	}
@@ -1155,23 +1566,45 @@ func (v javaVersion) usesJavaModules() bool {
 	return v >= 9
 }
 
-func normalizeJavaVersion(ctx android.BaseModuleContext, javaVersion string) javaVersion {
-	switch javaVersion {
+// Returns the javac arguments that select this language level.  --release also restricts the code to
+// the APIs of the selected release of the JDK, but can only be used when compiling against the
+// class library of the JDK, it can't be combined with -bootclasspath or --system.
+func (v javaVersion) javacFlags(release bool) string {
+	if release {
+		return "--release " + strconv.Itoa(int(v))
+	}
+	return "-source " + v.String() + " -target " + v.String()
+}
+
+func normalizeJavaVersion(ctx android.BaseModuleContext, version string) javaVersion {
+	var v javaVersion
+	switch version {
 	case "1.6", "6":
-		return JAVA_VERSION_6
+		v = JAVA_VERSION_6
 	case "1.7", "7":
-		return JAVA_VERSION_7
+		v = JAVA_VERSION_7
 	case "1.8", "8":
-		return JAVA_VERSION_8
+		v = JAVA_VERSION_8
 	case "1.9", "9":
-		return JAVA_VERSION_9
-	case "10", "11":
-		ctx.PropertyErrorf("java_version", "Java language levels above 9 are not supported")
+		v = JAVA_VERSION_9
+	case "11":
+		v = JAVA_VERSION_11
+	case "10", "12", "13", "14", "15":
+		ctx.PropertyErrorf("java_version", "Java language level %s is not supported, use 9 or 11", version)
 		return JAVA_VERSION_UNSUPPORTED
 	default:
 		ctx.PropertyErrorf("java_version", "Unrecognized Java language level")
 		return JAVA_VERSION_UNSUPPORTED
 	}
+
+	// The language level can't be higher than the version of the JDK that compiles the code.
+	if jdkVersion := config.JdkVersion(ctx.Config()); int(v) > jdkVersion {
+		ctx.PropertyErrorf("java_version", "Java language level %s is not supported by the JDK %d toolchain",
+			version, jdkVersion)
+		return JAVA_VERSION_UNSUPPORTED
+	}
+
+	return v
 }
 
 func (j *Module) collectBuilderFlags(ctx android.ModuleContext, deps deps) javaBuilderFlags {
@@ -1180,6 +1613,9 @@ func (j *Module) collectBuilderFlags(ctx android.ModuleContext, deps deps) javaB
 
 	// javaVersion flag.
 	flags.javaVersion = getJavaVersion(ctx, String(j.properties.Java_version), sdkContext(j))
+	// Only an explicit java_version selects the language level with --release, as it also restricts
+	// the code to the APIs of that release of the JDK.
+	flags.javaVersionRelease = j.properties.Java_version != nil
 
 	// javac flags.
 	javacFlags := j.properties.Javacflags
@@ -1193,7 +1629,7 @@ func (j *Module) collectBuilderFlags(ctx android.ModuleContext, deps deps) javaB
 	}
 	javacFlags = append(javacFlags, "-Xlint:-dep-ann")
 
-	if ctx.Config().RunErrorProne() {
+	if j.runErrorProne(ctx) {
 		if config.ErrorProneClasspath == nil {
 			ctx.ModuleErrorf("cannot build with Error Prone, missing external/error_prone?")
 		}
@@ -1207,6 +1643,7 @@ func (j *Module) collectBuilderFlags(ctx android.ModuleContext, deps deps) javaB
 		flags.errorProneExtraJavacFlags = "${config.ErrorProneFlags} " +
 			"'" + strings.Join(errorProneFlags, " ") + "'"
 		flags.errorProneProcessorPath = classpath(android.PathsForSource(ctx, config.ErrorProneClasspath))
+		flags.errorProneProcessorPath = append(flags.errorProneProcessorPath, deps.errorProneChecks...)
 	}
 
 	// classpath
@@ -1261,6 +1698,8 @@ func (j *Module) collectBuilderFlags(ctx android.ModuleContext, deps deps) javaB
 	// aidl flags.
 	flags.aidlFlags, flags.aidlDeps = j.aidlFlags(ctx, deps.aidlPreprocess, deps.aidlIncludeDirs)
 
+	flags.toolchainStamps = deps.toolchainStamps
+
 	if len(javacFlags) > 0 {
 		// optimization.
 		ctx.Variable(pctx, "javacFlags", strings.Join(javacFlags, " "))
@@ -1270,6 +1709,80 @@ func (j *Module) collectBuilderFlags(ctx android.ModuleContext, deps deps) javaB
 	return flags
 }
 
+var manifestAttributeRegexp = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9_-]*): (.*)$`)
+
+// jarManifest returns the manifest to be included in the jar, which is either the manifest
+// property or a manifest generated from main_class, manifest_attributes and
+// inject_implementation_version.
+func (j *Module) jarManifest(ctx android.ModuleContext) android.OptionalPath {
+	var attributes []string
+	if j.properties.Main_class != nil {
+		attributes = append(attributes, "Main-Class: "+*j.properties.Main_class)
+	}
+	names := make(map[string]bool)
+	for _, attr := range j.properties.Manifest_attributes {
+		match := manifestAttributeRegexp.FindStringSubmatch(attr)
+		if match == nil {
+			ctx.PropertyErrorf("manifest_attributes", "%q is not in the form \"Name: value\"", attr)
+			continue
+		}
+		switch name := strings.ToLower(match[1]); {
+		case name == "main-class" && j.properties.Main_class != nil,
+			name == "implementation-version" && j.stampVersion(),
+			name == "scm-revision" && j.stampRevision():
+			ctx.PropertyErrorf("manifest_attributes", "%s conflicts with the attribute generated by "+
+				"main_class, inject_implementation_version or stamp", match[1])
+		case names[name]:
+			ctx.PropertyErrorf("manifest_attributes", "duplicate attribute %s", match[1])
+		}
+		names[strings.ToLower(match[1])] = true
+		attributes = append(attributes, attr)
+	}
+
+	if j.properties.Manifest != nil {
+		if len(attributes) > 0 || j.stampVersion() || j.stampRevision() {
+			ctx.PropertyErrorf("manifest", "cannot be used with main_class, manifest_attributes, "+
+				"inject_implementation_version or stamp.manifest")
+			return android.OptionalPath{}
+		}
+		return android.OptionalPathForPath(android.PathForModuleSrc(ctx, *j.properties.Manifest))
+	}
+
+	if len(attributes) == 0 {
+		return android.OptionalPath{}
+	}
+
+	manifestFile := android.PathForModuleOut(ctx, "manifest.txt")
+	GenerateJarManifest(ctx, manifestFile, attributes)
+	return android.OptionalPathForPath(manifestFile)
+}
+
+// stampVersion returns true if the build number is stamped into the manifest of the jar.
+func (j *Module) stampVersion() bool {
+	return Bool(j.properties.Inject_implementation_version) || Bool(j.properties.Stamp.Manifest)
+}
+
+// stampRevision returns true if the source revision is stamped into the manifest of the jar.
+func (j *Module) stampRevision() bool {
+	return Bool(j.properties.Stamp.Manifest)
+}
+
+// stamped returns true if build information is stamped into the jar.
+func (j *Module) stamped() bool {
+	return j.stampVersion() || j.stampRevision() || len(j.properties.Stamp.Java_resources) > 0
+}
+
+// stamp returns the jar with the build information requested by the stamp properties stamped
+// into it.
+func (j *Module) stamp(ctx android.ModuleContext, dir string, jar android.Path,
+	manifest android.OptionalPath, jarName string) android.ModuleOutPath {
+
+	stampedJar := android.PathForModuleOut(ctx, dir, jarName)
+	TransformStampJar(ctx, stampedJar, jar, manifest, j.stampVersion(), j.stampRevision(),
+		j.properties.Stamp.Java_resources)
+	return stampedJar
+}
+
 func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 	j.exportAidlIncludeDirs = android.PathsForModuleSrc(ctx, j.deviceProperties.Aidl.Export_include_dirs)
 
@@ -1292,6 +1805,15 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 		srcJars = append(srcJars, aaptSrcJar)
 	}
 
+	j.renderscriptBuildActions(ctx)
+	if j.renderscriptSrcJar != nil {
+		if aaptSrcJar == nil {
+			// The bitcode is an Android resource, which needs aapt2.
+			ctx.PropertyErrorf("srcs", "renderscript sources are only supported for android_app and android_library modules")
+		}
+		srcJars = append(srcJars, j.renderscriptSrcJar)
+	}
+
 	if j.properties.Jarjar_rules != nil {
 		j.expandJarjarRules = android.PathForModuleSrc(ctx, *j.properties.Jarjar_rules)
 	}
@@ -1313,11 +1835,22 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 
 	var kotlinJars android.Paths
 
-	if srcFiles.HasExt(".kt") {
+	kotlinCommonSrcFiles := android.PathsForModuleSrc(ctx, j.properties.Common_srcs)
+	if len(kotlinCommonSrcFiles.FilterOutByExt(".kt")) > 0 {
+		ctx.PropertyErrorf("common_srcs", "common_srcs must be .kt files")
+	}
+
+	if srcFiles.HasExt(".kt") || len(kotlinCommonSrcFiles) > 0 {
 		// user defined kotlin flags.
 		kotlincFlags := j.properties.Kotlincflags
 		CheckKotlincFlags(ctx, kotlincFlags)
 
+		// Only use the -Xmulti-platform flag when there are common sources, it allows the expect
+		// and actual declarations of a multiplatform module.
+		if len(kotlinCommonSrcFiles) > 0 {
+			kotlincFlags = append(kotlincFlags, "-Xmulti-platform")
+		}
+
 		// If there are kotlin files, compile them first but pass all the kotlin and java files
 		// kotlinc will use the java files to resolve types referenced by the kotlin files, but
 		// won't emit any classes for them.
@@ -1334,9 +1867,12 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 		var kotlinSrcFiles android.Paths
 		kotlinSrcFiles = append(kotlinSrcFiles, uniqueSrcFiles...)
 		kotlinSrcFiles = append(kotlinSrcFiles, srcFiles.FilterByExt(".kt")...)
+		// kotlinc compiles the common sources as .kt sources that are marked as common.
+		kotlinSrcFiles = android.FirstUniquePaths(append(kotlinSrcFiles, kotlinCommonSrcFiles...))
 
 		// Collect .kt files for AIDEGen
 		j.expandIDEInfoCompiledSrcs = append(j.expandIDEInfoCompiledSrcs, srcFiles.FilterByExt(".kt").Strings()...)
+		j.expandIDEInfoCompiledSrcs = append(j.expandIDEInfoCompiledSrcs, kotlinCommonSrcFiles.Strings()...)
 
 		flags.classpath = append(flags.classpath, deps.kotlinStdlib...)
 		flags.classpath = append(flags.classpath, deps.kotlinAnnotations...)
@@ -1348,7 +1884,7 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 			// Use kapt for annotation processing
 			kaptSrcJar := android.PathForModuleOut(ctx, "kapt", "kapt-sources.jar")
 			kaptResJar := android.PathForModuleOut(ctx, "kapt", "kapt-res.jar")
-			kotlinKapt(ctx, kaptSrcJar, kaptResJar, kotlinSrcFiles, srcJars, flags)
+			kotlinKapt(ctx, kaptSrcJar, kaptResJar, kotlinSrcFiles, kotlinCommonSrcFiles, srcJars, flags)
 			srcJars = append(srcJars, kaptSrcJar)
 			kotlinJars = append(kotlinJars, kaptResJar)
 			// Disable annotation processing in javac, it's already been handled by kapt
@@ -1357,7 +1893,7 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 		}
 
 		kotlinJar := android.PathForModuleOut(ctx, "kotlin", jarName)
-		kotlinCompile(ctx, kotlinJar, kotlinSrcFiles, srcJars, flags)
+		kotlinCompile(ctx, kotlinJar, kotlinSrcFiles, kotlinCommonSrcFiles, srcJars, flags)
 		if ctx.Failed() {
 			return
 		}
@@ -1397,7 +1933,7 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 	}
 	if len(uniqueSrcFiles) > 0 || len(srcJars) > 0 {
 		var extraJarDeps android.Paths
-		if ctx.Config().RunErrorProne() {
+		if j.runErrorProne(ctx) {
 			// If error-prone is enabled, add an additional rule to compile the java files into
 			// a separate set of classes (so that they don't overwrite the normal ones and require
 			// a rebuild when error-prone is turned off).
@@ -1444,7 +1980,8 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 
 	dirArgs, dirDeps := ResourceDirsToJarArgs(ctx, j.properties.Java_resource_dirs,
 		j.properties.Exclude_java_resource_dirs, j.properties.Exclude_java_resources)
-	fileArgs, fileDeps := ResourceFilesToJarArgs(ctx, j.properties.Java_resources, j.properties.Exclude_java_resources)
+	fileArgs, fileDeps := ResourceFilesToJarArgs(ctx, j.properties.Java_resources, j.properties.Exclude_java_resources,
+		String(j.properties.Java_resource_strip_prefix))
 	extraArgs, extraDeps := resourcePathsToJarArgs(j.extraResources), j.extraResources
 
 	var resArgs []string
@@ -1459,6 +1996,12 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 	resArgs = append(resArgs, extraArgs...)
 	resDeps = append(resDeps, extraDeps...)
 
+	// The arguments for the host JNI libraries set the path prefix in the jar, so they must be last.
+	j.hostJniLibs = j.collectHostJniLibs(ctx)
+	jniArgs, jniDeps := hostJniLibsToJarArgs(j.hostJniLibs)
+	resArgs = append(resArgs, jniArgs...)
+	resDeps = append(resDeps, jniDeps...)
+
 	if len(resArgs) > 0 {
 		resourceJar := android.PathForModuleOut(ctx, "res", jarName)
 		TransformResourcesToJar(ctx, resourceJar, resArgs, resDeps)
@@ -1490,10 +2033,7 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 		jars = append(jars, deps.staticJars...)
 	}
 
-	manifest := j.overrideManifest
-	if !manifest.Valid() && j.properties.Manifest != nil {
-		manifest = android.OptionalPathForPath(android.PathForModuleSrc(ctx, *j.properties.Manifest))
-	}
+	manifest := j.jarManifest(ctx)
 
 	services := android.PathsForModuleSrc(ctx, j.properties.Services)
 	if len(services) > 0 {
@@ -1503,12 +2043,11 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 			serviceFile := file.String()
 			zipargs = append(zipargs, "-C", filepath.Dir(serviceFile), "-f", serviceFile)
 		}
-		rule := zip
+		rule, remote := remoteexec.Rule(ctx, "zip", zip, zipRE)
 		args := map[string]string{
 			"jarArgs": "-P META-INF/services/ " + strings.Join(proptools.NinjaAndShellEscapeList(zipargs), " "),
 		}
-		if ctx.Config().IsEnvTrue("RBE_ZIP") {
-			rule = zipRE
+		if remote {
 			args["implicits"] = strings.Join(services.Strings(), ",")
 		}
 		ctx.Build(pctx, android.BuildParams{
@@ -1578,6 +2117,16 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 		}
 	}
 
+	// Check that the classes of the boot jars are in the packages that are allowed on the boot
+	// classpath.  The rest of the build uses the checked copy of the jar, so a class outside of the
+	// allowed packages fails the build of the module.
+	if allowed := ctx.Config().BootJarsPackageAllowList(); len(allowed) > 0 && ctx.Device() &&
+		android.InList(ctx.ModuleName(), ctx.Config().BootJars()) {
+		checkedJar := android.PathForModuleOut(ctx, "boot-jar-package-check", jarName)
+		CheckBootJarPackages(ctx, checkedJar, outputFile, allowed)
+		outputFile = checkedJar
+	}
+
 	j.implementationJarFile = outputFile
 	if j.headerJarFile == nil {
 		j.headerJarFile = j.implementationJarFile
@@ -1617,6 +2166,14 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 		}
 	}
 
+	// Core library desugaring happens when the module is dexed, so it has no effect on the classes jar
+	// of a module that is not dexed, for example one that is only statically linked into an app.
+	if ctx.Device() && Bool(j.deviceProperties.Core_lib_desugaring) &&
+		!(Bool(j.properties.Installable) || Bool(j.deviceProperties.Compile_dex)) {
+		ctx.PropertyErrorf("core_lib_desugaring",
+			"has no effect on a module that is not dexed, set it on the module that dexes this code")
+	}
+
 	if ctx.Device() && j.hasCode(ctx) &&
 		(Bool(j.properties.Installable) || Bool(j.deviceProperties.Compile_dex)) {
 		// Dex compilation
@@ -1648,6 +2205,16 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 			}
 		}
 
+		// stamp the dex jar before it is dexpreopted
+		if j.stamped() {
+			dexOutputFile = j.stamp(ctx, "dex-stamped", dexOutputFile, manifest, jarName)
+			if proptools.Bool(j.deviceProperties.Uncompress_dex) {
+				stampedAlignedJar := android.PathForModuleOut(ctx, "dex-stamped-aligned", jarName)
+				TransformZipAlign(ctx, stampedAlignedJar, dexOutputFile)
+				dexOutputFile = stampedAlignedJar
+			}
+		}
+
 		j.dexJarFile = dexOutputFile
 
 		// Dexpreopting
@@ -1660,6 +2227,8 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 		if ctx.Failed() {
 			return
 		}
+	} else if j.stamped() {
+		outputFile = j.stamp(ctx, "stamped", implementationAndResourcesJar, manifest, jarName)
 	} else {
 		outputFile = implementationAndResourcesJar
 	}
@@ -1695,17 +2264,46 @@ func (j *Module) compile(ctx android.ModuleContext, aaptSrcJar android.Path) {
 	j.outputFile = outputFile.WithoutRel()
 }
 
+// JniHeaderDirs returns the directories of the JNI headers generated for the native methods in the
+// sources with generate_jni_headers: true.
+func (j *Module) JniHeaderDirs() android.Paths {
+	return j.jniHeaderDirs
+}
+
+// JniHeaderDeps returns the files that cc modules using the headers in JniHeaderDirs depend on.
+func (j *Module) JniHeaderDeps() android.Paths {
+	return j.jniHeaderDeps
+}
+
 func (j *Module) compileJavaClasses(ctx android.ModuleContext, jarName string, idx int,
 	srcFiles, srcJars android.Paths, flags javaBuilderFlags, extraJarDeps android.Paths) android.WritablePath {
 
 	kzipName := pathtools.ReplaceExtension(jarName, "kzip")
+	annoSrcJarName := "anno.srcjar"
 	if idx >= 0 {
 		kzipName = strings.TrimSuffix(jarName, filepath.Ext(jarName)) + strconv.Itoa(idx) + ".kzip"
+		annoSrcJarName = "anno" + strconv.Itoa(idx) + ".srcjar"
 		jarName += strconv.Itoa(idx)
 	}
 
 	classes := android.PathForModuleOut(ctx, "javac", jarName)
-	TransformJavaToClasses(ctx, classes, idx, srcFiles, srcJars, flags, extraJarDeps)
+	annoSrcJar := android.PathForModuleOut(ctx, "javac", annoSrcJarName)
+
+	var jniHeadersDir android.Path
+	if Bool(j.properties.Generate_jni_headers) {
+		// Each shard generates the headers of its sources into its own directory.
+		dir := android.PathForModuleOut(ctx, "jni_headers").OutputPath
+		if idx >= 0 {
+			dir = dir.Join(ctx, "shard"+strconv.Itoa(idx))
+		}
+		jniHeadersDir = dir
+		j.jniHeaderDirs = append(j.jniHeaderDirs, dir)
+		j.jniHeaderDeps = append(j.jniHeaderDeps, classes)
+	}
+
+	TransformJavaToClasses(ctx, classes, idx, srcFiles, srcJars, annoSrcJar, jniHeadersDir, flags,
+		extraJarDeps)
+	j.annoSrcJars = append(j.annoSrcJars, annoSrcJar)
 
 	if ctx.Config().EmitXrefRules() {
 		extractionFile := android.PathForModuleOut(ctx, kzipName)
@@ -1842,6 +2440,10 @@ func (j *Module) ExportedSdkLibs() []string {
 	return j.exportedSdkLibs
 }
 
+func (j *Module) exportedSdkLibContexts() (map[string]android.Path, map[string][]string) {
+	return j.exportedSdkLibPaths, j.exportedSdkLibDeps
+}
+
 func (j *Module) ExportedPlugins() (android.Paths, []string) {
 	return j.exportedPluginJars, j.exportedPluginClasses
 }
@@ -1903,18 +2505,9 @@ func (j *Module) IsInstallable() bool {
 // Java libraries (.jar file)
 //
 
-type LibraryProperties struct {
-	Dist struct {
-		// The tag of the output of this module that should be output.
-		Tag *string `android:"arch_variant"`
-	} `android:"arch_variant"`
-}
-
 type Library struct {
 	Module
 
-	libraryProperties LibraryProperties
-
 	InstallMixin func(ctx android.ModuleContext, installPath android.Path) (extraInstallDeps android.Paths)
 }
 
@@ -1940,8 +2533,9 @@ func shouldUncompressDex(ctx android.ModuleContext, dexpreopter *dexpreopter) bo
 		return true
 	}
 
-	// Store uncompressed dex files that are preopted on /system.
-	if !dexpreopter.dexpreoptDisabled(ctx) && (ctx.Host() || !odexOnSystemOther(ctx, dexpreopter.installPath)) {
+	// Store uncompressed dex files that are preopted on /system, unless the product strips them.
+	if !dexpreopter.dexpreoptDisabled(ctx) && (ctx.Host() || !odexOnSystemOther(ctx, dexpreopter.installPath)) &&
+		!stripDexAfterDexpreopt(ctx) {
 		return true
 	}
 	if ctx.Config().UncompressPrivAppDex() &&
@@ -1962,9 +2556,11 @@ func (j *Library) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 	}
 	j.dexpreopter.uncompressedDex = *j.deviceProperties.Uncompress_dex
 	j.compile(ctx, nil)
+	j.publishToMaven(ctx, j.implementationAndResourcesJar)
 
 	exclusivelyForApex := android.InAnyApex(ctx.ModuleName()) && !j.IsForPlatform()
 	if (Bool(j.properties.Installable) || ctx.Host()) && !exclusivelyForApex {
+		j.outputFile = android.ReleaseSign(ctx, &j.releaseSigningProperties, j.outputFile)
 		var extraInstallDeps android.Paths
 		if j.InstallMixin != nil {
 			extraInstallDeps = j.InstallMixin(ctx, j.outputFile)
@@ -1972,15 +2568,6 @@ func (j *Library) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 		j.installFile = ctx.InstallFile(android.PathForModuleInstall(ctx, "framework"),
 			j.Stem()+".jar", j.outputFile, extraInstallDeps...)
 	}
-
-	// Verify Dist.Tag is set to a supported output
-	if j.libraryProperties.Dist.Tag != nil {
-		distFiles, err := j.OutputFiles(*j.libraryProperties.Dist.Tag)
-		if err != nil {
-			ctx.PropertyErrorf("dist.tag", "%s", err.Error())
-		}
-		j.distFile = distFiles[0]
-	}
 }
 
 func (j *Library) DepsMutator(ctx android.BottomUpMutatorContext) {
@@ -2098,7 +2685,7 @@ func LibraryFactory() android.Module {
 	module := &Library{}
 
 	module.addHostAndDeviceProperties()
-	module.AddProperties(&module.libraryProperties)
+	module.AddProperties(&module.maven.properties)
 
 	module.initModuleAndImport(&module.ModuleBase)
 
@@ -2121,6 +2708,7 @@ func LibraryHostFactory() android.Module {
 	module := &Library{}
 
 	module.addHostProperties()
+	module.AddProperties(&module.maven.properties)
 
 	module.Module.properties.Installable = proptools.BoolPtr(true)
 
@@ -2158,6 +2746,17 @@ type testProperties struct {
 	// Add parameterized mainline modules to auto generated test config. The options will be
 	// handled by TradeFed to do downloading and installing the specified modules on the device.
 	Test_mainline_modules []string
+
+	// Test options.
+	Test_options struct {
+		// If the test is a unit test that can run on the host without a device, mark it so that
+		// the test harness runs it in the host unit test suites.
+		Unit_test *bool
+
+		// list of extra test configuration files (for example "AndroidTest-sharded.xml") that
+		// should be installed with the module to run the test in other configurations.
+		Extra_test_configs []string `android:"path,arch_variant"`
+	}
 }
 
 type testHelperLibraryProperties struct {
@@ -2181,8 +2780,9 @@ type Test struct {
 
 	testProperties testProperties
 
-	testConfig android.Path
-	data       android.Paths
+	testConfig       android.Path
+	extraTestConfigs android.Paths
+	data             android.Paths
 }
 
 type TestHelperLibrary struct {
@@ -2200,20 +2800,42 @@ type JavaTestImport struct {
 }
 
 func (j *Test) GenerateAndroidBuildActions(ctx android.ModuleContext) {
-	j.testConfig = tradefed.AutoGenJavaTestConfig(ctx, j.testProperties.Test_config, j.testProperties.Test_config_template,
-		j.testProperties.Test_suites, j.testProperties.Auto_gen_config)
-	j.data = android.PathsForModuleSrc(ctx, j.testProperties.Data)
+	j.generateTestConfigAndData(ctx, tradefed.AutoGenJavaTestConfig, nil)
 
 	j.Library.GenerateAndroidBuildActions(ctx)
 }
 
+// autoGenTestConfigFunc is the signature of the tradefed functions that generate the test config
+// of a java test from one of the templates.
+type autoGenTestConfigFunc func(ctx android.ModuleContext, testConfigProp *string,
+	testConfigTemplateProp *string, testSuites []string, configs []tradefed.Config,
+	autoGenConfig *bool) android.Path
+
+// generateTestConfigAndData sets the test config, the extra test configs and the data of the
+// test.  The module types that extend java_test use it with their own test config template and
+// the extra configs that their test runner needs.
+func (j *Test) generateTestConfigAndData(ctx android.ModuleContext, autoGenTestConfig autoGenTestConfigFunc,
+	extraConfigs []tradefed.Config) {
+
+	var configs []tradefed.Config
+	for _, module := range j.testProperties.Test_mainline_modules {
+		configs = append(configs, tradefed.Option{Name: "config-descriptor:metadata", Key: "mainline-param", Value: module})
+	}
+	configs = append(configs, extraConfigs...)
+
+	j.testConfig = autoGenTestConfig(ctx, j.testProperties.Test_config, j.testProperties.Test_config_template,
+		j.testProperties.Test_suites, configs, j.testProperties.Auto_gen_config)
+	j.extraTestConfigs = android.PathsForModuleSrc(ctx, j.testProperties.Test_options.Extra_test_configs)
+	j.data = android.PathsForModuleSrc(ctx, j.testProperties.Data)
+}
+
 func (j *TestHelperLibrary) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 	j.Library.GenerateAndroidBuildActions(ctx)
 }
 
 func (j *JavaTestImport) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 	j.testConfig = tradefed.AutoGenJavaTestConfig(ctx, j.prebuiltTestProperties.Test_config, nil,
-		j.prebuiltTestProperties.Test_suites, nil)
+		j.prebuiltTestProperties.Test_suites, nil, nil)
 
 	j.Import.GenerateAndroidBuildActions(ctx)
 }
@@ -2363,8 +2985,20 @@ type binaryProperties struct {
 	// installable script to execute the resulting jar
 	Wrapper *string `android:"path"`
 
-	// Name of the class containing main to be inserted into the manifest as Main-Class.
-	Main_class *string
+	// If set to true, generate the installable script from main_class, jvm_flags and the jars
+	// of the binary and its libs instead of using wrapper.  A .bat file is generated for
+	// Windows.  Only supported for host binaries.
+	Generate_wrapper *bool
+
+	// If set to true, install a native launcher instead of a script.  The launcher is a single
+	// executable that runs main_class with the jars of the binary and its libs, so that the binary
+	// can be executed without a shell.  It runs the java of the prebuilt JDK, which it finds
+	// relative to its own location.  Only supported for host binaries.
+	Native_launcher *bool
+
+	// Flags to pass to the JVM in the generated script or native launcher.  Requires
+	// generate_wrapper or native_launcher.
+	Jvm_flags []string
 }
 
 type Binary struct {
@@ -2376,6 +3010,14 @@ type Binary struct {
 
 	wrapperFile android.Path
 	binaryFile  android.InstallPath
+
+	// The installed jars of the libs of the binary, which are on the classpath of the generated
+	// wrapper.
+	runtimeJars android.Paths
+
+	// The host JNI libraries of the binary and its libs, whose install directories are on the
+	// java.library.path of the generated wrapper.
+	runtimeJniLibs []jniLib
 }
 
 func (j *Binary) HostToolPath() android.OptionalPath {
@@ -2385,38 +3027,170 @@ func (j *Binary) HostToolPath() android.OptionalPath {
 func (j *Binary) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 	if ctx.Arch().ArchType == android.Common {
 		// Compile the jar
-		if j.binaryProperties.Main_class != nil {
-			if j.properties.Manifest != nil {
-				ctx.PropertyErrorf("main_class", "main_class cannot be used when manifest is set")
-			}
-			manifestFile := android.PathForModuleOut(ctx, "manifest.txt")
-			GenerateMainClassManifest(ctx, manifestFile, String(j.binaryProperties.Main_class))
-			j.overrideManifest = android.OptionalPathForPath(manifestFile)
-		}
-
 		j.Library.GenerateAndroidBuildActions(ctx)
+
+		if j.generatesWrapper() {
+			j.collectRuntimeDeps(ctx)
+		}
 	} else {
 		// Handle the binary wrapper
 		j.isWrapperVariant = true
 
+		// Depend on the installed jar so that the wrapper doesn't get executed by
+		// another build rule before the jar has been installed.
+		primary := ctx.PrimaryModule().(*Binary)
+		jarFile := primary.installFile
+
+		if j.generatesWrapper() {
+			j.generateWrapper(ctx, primary)
+			return
+		}
+
+		// The default wrapper runs the jar with java -jar and has no way to receive the flags.
+		if len(j.binaryProperties.Jvm_flags) > 0 {
+			ctx.PropertyErrorf("jvm_flags", "only supported with generate_wrapper: true or native_launcher: true")
+		}
+
 		if j.binaryProperties.Wrapper != nil {
 			j.wrapperFile = android.PathForModuleSrc(ctx, *j.binaryProperties.Wrapper)
 		} else {
 			j.wrapperFile = android.PathForSource(ctx, "build/soong/scripts/jar-wrapper.sh")
 		}
 
-		// Depend on the installed jar so that the wrapper doesn't get executed by
-		// another build rule before the jar has been installed.
-		jarFile := ctx.PrimaryModule().(*Binary).installFile
-
 		j.binaryFile = ctx.InstallExecutable(android.PathForModuleInstall(ctx, "bin"),
 			ctx.ModuleName(), j.wrapperFile, jarFile)
 	}
 }
 
+// collectRuntimeDeps collects the installed jars and the host JNI libraries that the generated
+// wrapper puts on the classpath and the library path.  The jars of static_libs are already in the
+// jar of the binary, but the libs of the libraries are needed at runtime too, so the libs and
+// static_libs are followed transitively.
+func (j *Binary) collectRuntimeDeps(ctx android.ModuleContext) {
+	j.runtimeJniLibs = append(j.runtimeJniLibs, j.hostJniLibs...)
+	ctx.WalkDeps(func(child, parent android.Module) bool {
+		tag := ctx.OtherModuleDependencyTag(child)
+		if tag != libTag && tag != staticLibTag {
+			return false
+		}
+		if tag == libTag {
+			for _, spec := range child.PackagingSpecs() {
+				if dir := filepath.Base(filepath.Dir(spec.InstallPath().String())); dir == "framework" {
+					j.runtimeJars = append(j.runtimeJars, spec.InstallPath())
+				}
+			}
+		}
+		if lib, ok := child.(*Library); ok {
+			j.runtimeJniLibs = append(j.runtimeJniLibs, lib.hostJniLibs...)
+		}
+		return true
+	})
+	j.runtimeJars = android.FirstUniquePaths(j.runtimeJars)
+}
+
+// generatesWrapper returns true if the script or native launcher of the binary is generated
+// instead of using the wrapper property.
+func (j *Binary) generatesWrapper() bool {
+	return Bool(j.binaryProperties.Generate_wrapper) || Bool(j.binaryProperties.Native_launcher)
+}
+
+// generateWrapper generates and installs the script or native launcher that runs the main class of
+// the binary with the jars installed by the primary variant on the classpath.
+func (j *Binary) generateWrapper(ctx android.ModuleContext, primary *Binary) {
+	property := "generate_wrapper"
+	nativeLauncher := Bool(j.binaryProperties.Native_launcher)
+	if nativeLauncher {
+		property = "native_launcher"
+		if Bool(j.binaryProperties.Generate_wrapper) {
+			ctx.PropertyErrorf(property, "cannot be used when generate_wrapper is set")
+			return
+		}
+	}
+
+	if !ctx.Host() {
+		ctx.PropertyErrorf(property, "only supported for host binaries")
+		return
+	}
+	if j.binaryProperties.Wrapper != nil {
+		ctx.PropertyErrorf(property, "cannot be used when wrapper is set")
+		return
+	}
+	if j.properties.Main_class == nil {
+		ctx.PropertyErrorf(property, "main_class must be set")
+		return
+	}
+	if primary.installFile == nil {
+		ctx.PropertyErrorf(property, "the jar of the binary is not installed")
+		return
+	}
+
+	installed := append(android.Paths{primary.installFile}, primary.runtimeJars...)
+	var jars []string
+	for _, jar := range installed {
+		jars = append(jars, jar.Base())
+	}
+
+	name := ctx.ModuleName()
+	if ctx.Os() == android.Windows {
+		if nativeLauncher {
+			name += ".exe"
+		} else {
+			name += ".bat"
+		}
+	}
+	var libDirs []string
+	for _, lib := range primary.runtimeJniLibs {
+		libDirs = append(libDirs, hostJniLibInstallDir(lib.target))
+	}
+
+	installDir := android.PathForModuleInstall(ctx, "bin")
+	wrapperFile := android.PathForModuleOut(ctx, name)
+	if nativeLauncher {
+		launcher, javaHome := j.nativeLauncherDeps(ctx)
+		if launcher == nil {
+			return
+		}
+		generateNativeLauncher(ctx, wrapperFile, launcher, javaHome, jars,
+			android.FirstUniqueStrings(libDirs), String(j.properties.Main_class),
+			j.binaryProperties.Jvm_flags)
+	} else {
+		generateBinaryWrapper(ctx, wrapperFile, jars, android.FirstUniqueStrings(libDirs),
+			String(j.properties.Main_class), j.binaryProperties.Jvm_flags)
+	}
+	j.wrapperFile = wrapperFile
+
+	j.binaryFile = ctx.InstallExecutable(installDir, name, j.wrapperFile, installed...)
+}
+
+// nativeLauncherDeps returns the java_launcher program that the native launcher of the binary is
+// created from, and the location of the JDK relative to the top of the source tree, or nil if
+// either is missing.
+func (j *Binary) nativeLauncherDeps(ctx android.ModuleContext) (android.Path, string) {
+	var launcher android.Path
+	ctx.VisitDirectDepsWithTag(nativeLauncherTag, func(m android.Module) {
+		if dep, ok := m.(*cc.Module); ok && dep.OutputFile().Valid() {
+			launcher = dep.OutputFile().Path()
+		} else {
+			ctx.ModuleErrorf("%q is not a native binary", ctx.OtherModuleName(m))
+		}
+	})
+	if launcher == nil {
+		return nil, ""
+	}
+
+	javaHome := config.JavaHomeForOs(ctx, ctx.Os())
+	if !javaHome.Valid() {
+		ctx.PropertyErrorf("native_launcher", "no prebuilt JDK for %s", ctx.Os())
+		return nil, ""
+	}
+	return launcher, filepath.ToSlash(javaHome.String())
+}
+
 func (j *Binary) DepsMutator(ctx android.BottomUpMutatorContext) {
 	if ctx.Arch().ArchType == android.Common {
 		j.deps(ctx)
+	} else if ctx.Host() && Bool(j.binaryProperties.Native_launcher) {
+		ctx.AddFarVariationDependencies(ctx.Target().Variations(), nativeLauncherTag, "java_launcher")
 	}
 }
 
@@ -2463,10 +3237,13 @@ func BinaryHostFactory() android.Module {
 //
 
 type ImportProperties struct {
+	// List of jars to import.  Multiple jars are merged into a single jar, in the order they are
+	// listed.
 	Jars []string `android:"path,arch_variant"`
 
 	Sdk_version *string
 
+	// if set to true, install the merged jar into /system/framework.  Defaults to false.
 	Installable *bool
 
 	// List of shared java libs that this module has dependencies to
@@ -2499,6 +3276,8 @@ type Import struct {
 
 	combinedClasspathFile android.Path
 	exportedSdkLibs       []string
+	exportedSdkLibPaths   map[string]android.Path
+	exportedSdkLibDeps    map[string][]string
 }
 
 func (j *Import) sdkVersion() sdkSpec {
@@ -2556,6 +3335,8 @@ func (j *Import) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 	// that, if necessary, a <uses-library> element for that java_sdk_library is
 	// added to the Android manifest.
 	j.exportedSdkLibs = append(j.exportedSdkLibs, j.OptionalImplicitSdkLibrary()...)
+	j.exportedSdkLibPaths = make(map[string]android.Path)
+	j.exportedSdkLibDeps = make(map[string][]string)
 
 	ctx.VisitDirectDeps(func(module android.Module) {
 		otherName := ctx.OtherModuleName(module)
@@ -2567,12 +3348,14 @@ func (j *Import) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 			case libTag, staticLibTag:
 				// sdk lib names from dependencies are re-exported
 				j.exportedSdkLibs = append(j.exportedSdkLibs, dep.ExportedSdkLibs()...)
+				mergeSdkLibraryContexts(j.exportedSdkLibPaths, j.exportedSdkLibDeps, module)
 			}
 		case SdkLibraryDependency:
 			switch tag {
 			case libTag:
 				// names of sdk libs that are directly depended are exported
 				j.exportedSdkLibs = append(j.exportedSdkLibs, otherName)
+				addSdkLibraryContext(j.exportedSdkLibPaths, j.exportedSdkLibDeps, otherName, module)
 			}
 		}
 	})
@@ -2623,6 +3406,10 @@ func (j *Import) ExportedSdkLibs() []string {
 	return j.exportedSdkLibs
 }
 
+func (j *Import) exportedSdkLibContexts() (map[string]android.Path, map[string][]string) {
+	return j.exportedSdkLibPaths, j.exportedSdkLibDeps
+}
+
 func (j *Import) ExportedPlugins() (android.Paths, []string) {
 	return nil, nil
 }
@@ -2760,6 +3547,16 @@ func (j *DexImport) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 	inputJar := ctx.ExpandSource(j.properties.Jars[0], "jars")
 	dexOutputFile := android.PathForModuleOut(ctx, ctx.ModuleName()+".jar")
 
+	// The jar is not dexed, check that it already contains dex code instead of failing later in
+	// dexpreopt or on the device.
+	dexCheck := android.PathForModuleOut(ctx, "dex_check.stamp")
+	checkRule := android.NewRuleBuilder()
+	checkRule.Command().
+		Text("if ! zipinfo -1").Input(inputJar).Text(`'classes*.dex' >/dev/null 2>&1; then`).
+		Textf(`echo "%s: %s does not contain classes.dex" >&2; exit 1; fi`, ctx.ModuleName(), inputJar)
+	checkRule.Command().Text("touch").Output(dexCheck)
+	checkRule.Build(pctx, ctx, "dex_import_check", "check dex")
+
 	if j.dexpreopter.uncompressedDex {
 		rule := android.NewRuleBuilder()
 
@@ -2771,7 +3568,8 @@ func (j *DexImport) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 			BuiltTool(ctx, "zip2zip").
 			FlagWithInput("-i ", inputJar).
 			FlagWithOutput("-o ", temporary).
-			FlagWithArg("-0 ", "'classes*.dex'")
+			FlagWithArg("-0 ", "'classes*.dex'").
+			Implicit(dexCheck)
 
 		// use zipalign to align uncompressed classes*.dex files
 		rule.Command().
@@ -2786,9 +3584,10 @@ func (j *DexImport) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 		rule.Build(pctx, ctx, "uncompress_dex", "uncompress dex")
 	} else {
 		ctx.Build(pctx, android.BuildParams{
-			Rule:   android.Cp,
-			Input:  inputJar,
-			Output: dexOutputFile,
+			Rule:     android.Cp,
+			Input:    inputJar,
+			Output:   dexOutputFile,
+			Implicit: dexCheck,
 		})
 	}
 
@@ -2874,6 +3673,7 @@ func DefaultsFactory() android.Module {
 		&CompilerProperties{},
 		&CompilerDeviceProperties{},
 		&DexpreoptProperties{},
+		&HiddenAPIProperties{},
 		&android.ProtoProperties{},
 		&aaptProperties{},
 		&androidLibraryProperties{},
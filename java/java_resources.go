@@ -51,6 +51,20 @@ func ResourceDirsToJarArgs(ctx android.ModuleContext,
 	excludeFiles = append(excludeFiles, resourceExcludes...)
 
 	for _, resourceDir := range resourceDirs {
+		if m, _ := android.SrcIsModuleWithTag(resourceDir); m != "" {
+			// The files of a filegroup or the outputs of another module are added at their paths
+			// relative to the module, which for a filegroup is relative to its path property.
+			var files android.Paths
+			for _, f := range android.PathsForModuleSrc(ctx, []string{resourceDir}) {
+				if !matchesResourceExclude(f.String(), excludeFiles) {
+					files = append(files, f)
+				}
+			}
+			args = append(args, resourcePathsToJarArgs(files)...)
+			deps = append(deps, files...)
+			continue
+		}
+
 		// resourceDir may be a glob, resolve it first
 		dirs := ctx.Glob(android.PathForSource(ctx, ctx.ModuleDir()).Join(ctx, resourceDir).String(), excludeDirs)
 		for _, dir := range dirs {
@@ -75,32 +89,71 @@ func ResourceDirsToJarArgs(ctx android.ModuleContext,
 	return args, deps
 }
 
+func matchesResourceExclude(path string, excludes []string) bool {
+	for _, exclude := range excludes {
+		if match, err := pathtools.Match(exclude, path); err == nil && match {
+			return true
+		}
+	}
+	return false
+}
+
 // Convert java_resources properties to arguments to soong_zip -jar, ignoring common patterns
-// that should not be treated as resources (including *.java).
+// that should not be treated as resources (including *.java).  stripPrefix is stripped from the
+// paths in the jar of the outputs of modules referenced with ":module".
 func ResourceFilesToJarArgs(ctx android.ModuleContext,
-	res, exclude []string) (args []string, deps android.Paths) {
+	res, exclude []string, stripPrefix string) (args []string, deps android.Paths) {
 
 	exclude = append([]string(nil), exclude...)
 	exclude = append(exclude, resourceExcludes...)
-	return resourceFilesToJarArgs(ctx, res, exclude)
+	return resourceFilesToJarArgs(ctx, res, exclude, stripPrefix)
 }
 
 func resourceFilesToJarArgs(ctx android.ModuleContext,
-	res, exclude []string) (args []string, deps android.Paths) {
+	res, exclude []string, stripPrefix string) (args []string, deps android.Paths) {
 
-	files := android.PathsForModuleSrcExcludes(ctx, res, exclude)
+	if stripPrefix == "" {
+		files := android.PathsForModuleSrcExcludes(ctx, res, exclude)
+		return resourcePathsToJarArgs(files), files
+	}
 
-	args = resourcePathsToJarArgs(files)
+	stripPrefix = filepath.Clean(stripPrefix) + "/"
+	var jarPaths []string
+	for _, r := range res {
+		for _, f := range android.PathsForModuleSrcExcludes(ctx, []string{r}, exclude) {
+			jarPath := f.Rel()
+			if android.SrcIsModule(r) != "" {
+				if !strings.HasPrefix(jarPath, stripPrefix) {
+					ctx.PropertyErrorf("java_resource_strip_prefix", "output %q of %q does not start with %q",
+						jarPath, r, stripPrefix)
+					continue
+				}
+				jarPath = strings.TrimPrefix(jarPath, stripPrefix)
+			}
+			deps = append(deps, f)
+			jarPaths = append(jarPaths, jarPath)
+		}
+	}
 
-	return args, files
+	return resourcePathsWithJarPathsToJarArgs(deps, jarPaths), deps
 }
 
 func resourcePathsToJarArgs(files android.Paths) []string {
+	var jarPaths []string
+	for _, f := range files {
+		jarPaths = append(jarPaths, f.Rel())
+	}
+	return resourcePathsWithJarPathsToJarArgs(files, jarPaths)
+}
+
+// resourcePathsWithJarPathsToJarArgs returns the arguments to soong_zip -jar that add each file to
+// the jar at the corresponding path in jarPaths, which must be a suffix of the path of the file.
+func resourcePathsWithJarPathsToJarArgs(files android.Paths, jarPaths []string) []string {
 	var args []string
 
 	lastDir := ""
 	for i, f := range files {
-		rel := f.Rel()
+		rel := jarPaths[i]
 		path := f.String()
 		if !strings.HasSuffix(path, rel) {
 			panic(fmt.Errorf("path %q does not end with %q", path, rel))
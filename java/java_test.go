@@ -78,6 +78,7 @@ func testContext() *android.TestContext {
 	RegisterAARBuildComponents(ctx)
 	RegisterGenRuleBuildComponents(ctx)
 	RegisterSystemModulesBuildComponents(ctx)
+	RegisterArtTestBuildComponents(ctx)
 	ctx.RegisterModuleType("java_plugin", PluginFactory)
 	ctx.RegisterModuleType("filegroup", android.FileGroupFactory)
 	ctx.RegisterModuleType("genrule", genrule.GenRuleFactory)
@@ -171,6 +172,52 @@ func moduleToPath(name string) string {
 	}
 }
 
+func TestJavaLinkTypeStubsAlternative(t *testing.T) {
+	testJavaError(t, `dependency "framework" is compiling against non-public Android API.*Depend on the stubs library "android_stubs_current" instead`, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			sdk_version: "current",
+			static_libs: ["framework"],
+		}
+	`)
+
+	testJavaError(t, `dependency "bar.impl" is compiling against private API.*Depend on the stubs library "bar.stubs.system" instead`, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			sdk_version: "system_current",
+			libs: ["bar.impl"],
+		}
+
+		java_library {
+			name: "bar.impl",
+			srcs: ["b.java"],
+		}
+
+		java_library {
+			name: "bar.stubs.system",
+			srcs: ["b.java"],
+			sdk_version: "system_current",
+		}
+	`)
+
+	// A stubs library that doesn't exist is not suggested
+	testJavaError(t, `dependency "bar.impl" is compiling against private API.*Depend on a stubs library of the system API instead`, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			sdk_version: "system_current",
+			libs: ["bar.impl"],
+		}
+
+		java_library {
+			name: "bar.impl",
+			srcs: ["b.java"],
+		}
+	`)
+}
+
 func TestJavaLinkType(t *testing.T) {
 	testJava(t, `
 		java_library {
@@ -386,6 +433,34 @@ func TestExportedPlugins(t *testing.T) {
 	}
 }
 
+func TestExportedPluginsErrors(t *testing.T) {
+	testJavaError(t, `Cannot export plugins with generates_api = true, found plugin`, `
+		java_plugin {
+			name: "plugin",
+			processor_class: "com.android.TestPlugin",
+			generates_api: true,
+		}
+
+		java_library {
+			name: "exports",
+			exported_plugins: ["plugin"],
+		}
+	`)
+
+	testJavaError(t, `"lib" is not a java_plugin module`, `
+		java_library {
+			name: "lib",
+			srcs: ["a.java"],
+			host_supported: true,
+		}
+
+		java_library {
+			name: "exports",
+			exported_plugins: ["lib"],
+		}
+	`)
+}
+
 func TestSdkVersionByPartition(t *testing.T) {
 	testJavaError(t, "sdk_version must have a value when the module is located at vendor or product", `
 		java_library {
@@ -421,6 +496,64 @@ func TestSdkVersionByPartition(t *testing.T) {
 	}
 }
 
+func TestInterPartitionJavaLibraries(t *testing.T) {
+	bp := `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			vendor: true,
+			sdk_version: "current",
+			libs: ["bar", "baz"],
+			static_libs: ["qux"],
+		}
+
+		java_library {
+			name: "bar",
+			srcs: ["b.java"],
+			sdk_version: "current",
+		}
+
+		java_library {
+			name: "baz",
+			srcs: ["c.java"],
+			vendor: true,
+			sdk_version: "current",
+		}
+
+		java_library {
+			name: "qux",
+			srcs: ["d.java"],
+			sdk_version: "current",
+		}
+	`
+
+	errorMessage := `libs: "bar" is installed in the system partition and can't be used from the vendor partition`
+
+	testCases := []struct {
+		name      string
+		enforce   bool
+		allowList []string
+		err       string
+	}{
+		{name: "not enforced"},
+		{name: "enforced", enforce: true, err: errorMessage},
+		{name: "allowed", enforce: true, allowList: []string{"bar"}},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			config := testConfig(nil, bp, nil)
+			config.TestProductVariables.EnforceInterPartitionJavaSdkLibrary = proptools.BoolPtr(test.enforce)
+			config.TestProductVariables.InterPartitionJavaLibraryAllowList = test.allowList
+			if test.err != "" {
+				testJavaErrorWithConfig(t, test.err, config)
+			} else {
+				testJavaWithConfig(t, config)
+			}
+		})
+	}
+}
+
 func TestArchSpecific(t *testing.T) {
 	ctx, _ := testJava(t, `
 		java_library {
@@ -469,1398 +602,3220 @@ func TestBinary(t *testing.T) {
 
 }
 
-func TestPrebuilts(t *testing.T) {
+func TestBinaryGenerateWrapper(t *testing.T) {
 	ctx, _ := testJava(t, `
-		java_library {
+		java_library_host {
 			name: "foo",
-			srcs: ["a.java", ":stubs-source"],
-			libs: ["bar", "sdklib"],
-			static_libs: ["baz"],
-		}
-
-		java_import {
-			name: "bar",
-			jars: ["a.jar"],
+			srcs: ["a.java"],
+			libs: ["baz"],
 		}
 
-		java_import {
+		java_library_host {
 			name: "baz",
-			jars: ["b.jar"],
+			srcs: ["c.java"],
 		}
 
-		dex_import {
+		java_library_host {
 			name: "qux",
-			jars: ["b.jar"],
-		}
-
-		java_sdk_library_import {
-			name: "sdklib",
-			public: {
-				jars: ["c.jar"],
-			},
+			srcs: ["d.java"],
+			libs: ["baz", "quux"],
 		}
 
-		prebuilt_stubs_sources {
-			name: "stubs-source",
-			srcs: ["stubs/sources"],
+		java_library_host {
+			name: "quux",
+			srcs: ["e.java"],
 		}
 
-		java_test_import {
-			name: "test",
-			jars: ["a.jar"],
-			test_suites: ["cts"],
-			test_config: "AndroidTest.xml",
+		java_binary_host {
+			name: "bar",
+			srcs: ["b.java"],
+			libs: ["foo"],
+			static_libs: ["qux"],
+			main_class: "com.android.bar.Main",
+			jvm_flags: ["-Xmx2g"],
+			generate_wrapper: true,
 		}
-		`)
-
-	fooModule := ctx.ModuleForTests("foo", "android_common")
-	javac := fooModule.Rule("javac")
-	combineJar := ctx.ModuleForTests("foo", "android_common").Description("for javac")
-	barJar := ctx.ModuleForTests("bar", "android_common").Rule("combineJar").Output
-	bazJar := ctx.ModuleForTests("baz", "android_common").Rule("combineJar").Output
-	sdklibStubsJar := ctx.ModuleForTests("sdklib.stubs", "android_common").Rule("combineJar").Output
-
-	fooLibrary := fooModule.Module().(*Library)
-	assertDeepEquals(t, "foo java sources incorrect",
-		[]string{"a.java"}, fooLibrary.compiledJavaSrcs.Strings())
+	`)
 
-	assertDeepEquals(t, "foo java source jars incorrect",
-		[]string{".intermediates/stubs-source/android_common/stubs-source-stubs.srcjar"},
-		android.NormalizePathsForTesting(fooLibrary.compiledSrcJars))
+	buildOS := android.BuildOs.String()
 
-	if !strings.Contains(javac.Args["classpath"], barJar.String()) {
-		t.Errorf("foo classpath %v does not contain %q", javac.Args["classpath"], barJar.String())
+	installFile := func(name string) string {
+		return ctx.ModuleForTests(name, buildOS+"_common").Module().(*Library).installFile.String()
 	}
+	fooJar, bazJar, quuxJar := installFile("foo"), installFile("baz"), installFile("quux")
+	barJar := ctx.ModuleForTests("bar", buildOS+"_common").Module().(*Binary).installFile.String()
+	barWrapper := ctx.ModuleForTests("bar", buildOS+"_x86_64")
 
-	if !strings.Contains(javac.Args["classpath"], sdklibStubsJar.String()) {
-		t.Errorf("foo classpath %v does not contain %q", javac.Args["classpath"], sdklibStubsJar.String())
+	// Test that the classpath has the libs of the libs and of the static_libs, but not the
+	// static_libs themselves as they are in the jar of the binary
+	content := barWrapper.Rule("binaryWrapper").Args["content"]
+	expected := `exec java -Xmx2g "$${javaOpts[@]}" ` +
+		`-cp "$${progdir}/../framework/bar.jar:$${progdir}/../framework/foo.jar:` +
+		`$${progdir}/../framework/baz.jar:$${progdir}/../framework/quux.jar" ` +
+		`com.android.bar.Main "$$@"`
+	if !strings.Contains(content, expected) {
+		t.Errorf("expected generated wrapper to contain %q, got %q", expected, content)
 	}
 
-	if len(combineJar.Inputs) != 2 || combineJar.Inputs[1].String() != bazJar.String() {
-		t.Errorf("foo combineJar inputs %v does not contain %q", combineJar.Inputs, bazJar.String())
+	// Test that the installed wrapper depends on the installed jars on its classpath
+	binaryFile := barWrapper.Module().(*Binary).binaryFile.String()
+	barWrapperDeps := barWrapper.Output(binaryFile).Implicits.Strings()
+	expectedDeps := []string{barJar, fooJar, bazJar, quuxJar}
+	if !reflect.DeepEqual(barWrapperDeps, expectedDeps) {
+		t.Errorf("expected binary wrapper implicits %q, got %q", expectedDeps, barWrapperDeps)
 	}
-
-	ctx.ModuleForTests("qux", "android_common").Rule("Cp")
 }
 
-func assertDeepEquals(t *testing.T, message string, expected interface{}, actual interface{}) {
-	if !reflect.DeepEqual(expected, actual) {
-		t.Errorf("%s: expected %q, found %q", message, expected, actual)
-	}
-}
+func TestBinaryNativeLauncher(t *testing.T) {
+	bp := cc.GatherRequiredDepsForTest(android.Android) + `
+		cc_binary_host {
+			name: "java_launcher",
+			srcs: ["java_launcher.cpp"],
+			stl: "none",
+			system_shared_libs: [],
+		}
 
-func TestJavaSdkLibraryImport(t *testing.T) {
-	ctx, _ := testJava(t, `
-		java_library {
+		java_library_host {
 			name: "foo",
 			srcs: ["a.java"],
-			libs: ["sdklib"],
-			sdk_version: "current",
 		}
 
-		java_library {
-			name: "foo.system",
-			srcs: ["a.java"],
-			libs: ["sdklib"],
-			sdk_version: "system_current",
+		java_binary_host {
+			name: "bar",
+			srcs: ["b.java"],
+			libs: ["foo"],
+			main_class: "com.android.bar.Main",
+			jvm_flags: ["-Xmx2g"],
+			native_launcher: true,
 		}
+	`
+	config := testConfig(map[string]string{"ANDROID_JAVA_HOME": "prebuilts/jdk/jdk11/linux-x86"}, bp, nil)
+	ctx, _ := testJavaWithConfig(t, config)
 
-		java_library {
-			name: "foo.test",
-			srcs: ["a.java"],
-			libs: ["sdklib"],
-			sdk_version: "test_current",
-		}
+	buildOS := android.BuildOs.String()
 
-		java_sdk_library_import {
-			name: "sdklib",
-			public: {
-				jars: ["a.jar"],
-			},
-			system: {
-				jars: ["b.jar"],
-			},
-			test: {
-				jars: ["c.jar"],
-				stub_srcs: ["c.java"],
-			},
-		}
-		`)
+	fooJar := ctx.ModuleForTests("foo", buildOS+"_common").Module().(*Library).installFile.String()
+	barJar := ctx.ModuleForTests("bar", buildOS+"_common").Module().(*Binary).installFile.String()
+	barWrapper := ctx.ModuleForTests("bar", buildOS+"_x86_64")
+	javaLauncher := ctx.ModuleForTests("java_launcher", buildOS+"_x86_64").Output("java_launcher")
 
-	for _, scope := range []string{"", ".system", ".test"} {
-		fooModule := ctx.ModuleForTests("foo"+scope, "android_common")
-		javac := fooModule.Rule("javac")
+	// Test that the launcher is the java_launcher program with the configuration of the binary
+	launcher := barWrapper.Rule("nativeLauncher")
+	if launcher.Input.String() != javaLauncher.Output.String() {
+		t.Errorf("expected native launcher input %q, got %q", javaLauncher.Output.String(), launcher.Input.String())
+	}
+	launcherConfig := android.ContentFromWriteFileRuleForTests(t, barWrapper.Output("bar.launcher_config"))
+	lines := strings.Split(strings.TrimSuffix(launcherConfig, "\n"), "\n")
+	expected := []string{
+		"java_home prebuilts/jdk/jdk11/linux-x86",
+		"main_class com.android.bar.Main",
+		"classpath ../framework/bar.jar",
+		"classpath ../framework/foo.jar",
+		"jvm_flag -Xmx2g",
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected the launcher configuration to contain %q, got %q", expected, launcherConfig)
+	}
 
-		sdklibStubsJar := ctx.ModuleForTests("sdklib.stubs"+scope, "android_common").Rule("combineJar").Output
-		if !strings.Contains(javac.Args["classpath"], sdklibStubsJar.String()) {
-			t.Errorf("foo classpath %v does not contain %q", javac.Args["classpath"], sdklibStubsJar.String())
-		}
+	// Test that the installed launcher depends on the installed jars on its classpath
+	binaryFile := barWrapper.Module().(*Binary).binaryFile.String()
+	barWrapperDeps := barWrapper.Output(binaryFile).Implicits.Strings()
+	if !reflect.DeepEqual(barWrapperDeps, []string{barJar, fooJar}) {
+		t.Errorf("expected native launcher implicits %q, got %q", []string{barJar, fooJar}, barWrapperDeps)
 	}
 }
 
-func TestDefaults(t *testing.T) {
-	ctx, _ := testJava(t, `
-		java_defaults {
-			name: "defaults",
-			srcs: ["a.java"],
-			libs: ["bar"],
-			static_libs: ["baz"],
-			optimize: {enabled: false},
-		}
-
-		java_library {
-			name: "foo",
-			defaults: ["defaults"],
+func TestBinaryGenerateWrapperErrors(t *testing.T) {
+	testJavaError(t, `generate_wrapper: main_class must be set`, `
+		java_binary_host {
+			name: "bar",
+			srcs: ["b.java"],
+			generate_wrapper: true,
 		}
+	`)
 
-		java_library {
+	testJavaError(t, `generate_wrapper: cannot be used when wrapper is set`, `
+		java_binary_host {
 			name: "bar",
 			srcs: ["b.java"],
+			main_class: "com.android.bar.Main",
+			wrapper: "bar.sh",
+			generate_wrapper: true,
+		}
+	`)
+
+	testJavaError(t, `native_launcher: cannot be used when generate_wrapper is set`, cc.GatherRequiredDepsForTest(android.Android)+`
+		cc_binary_host {
+			name: "java_launcher",
+			srcs: ["java_launcher.cpp"],
+			stl: "none",
+			system_shared_libs: [],
 		}
 
-		java_library {
-			name: "baz",
-			srcs: ["c.java"],
+		java_binary_host {
+			name: "bar",
+			srcs: ["b.java"],
+			main_class: "com.android.bar.Main",
+			generate_wrapper: true,
+			native_launcher: true,
 		}
+	`)
 
-		android_test {
-			name: "atestOptimize",
-			defaults: ["defaults"],
-			optimize: {enabled: true},
+	testJavaError(t, `jvm_flags: only supported with generate_wrapper: true or native_launcher: true`, `
+		java_binary_host {
+			name: "bar",
+			srcs: ["b.java"],
+			main_class: "com.android.bar.Main",
+			jvm_flags: ["-Xmx2g"],
 		}
+	`)
+}
 
-		android_test {
-			name: "atestNoOptimize",
-			defaults: ["defaults"],
+func TestHostJniLibs(t *testing.T) {
+	ctx, _ := testJava(t, cc.GatherRequiredDepsForTest(android.Android)+`
+		cc_library_host_shared {
+			name: "libfoo_jni",
+			stl: "none",
+			system_shared_libs: [],
 		}
 
-		android_test {
-			name: "atestDefault",
+		java_binary_host {
+			name: "foo",
 			srcs: ["a.java"],
+			main_class: "com.android.foo.Main",
+			generate_wrapper: true,
+			host_jni_libs: ["libfoo_jni"],
 		}
-		`)
+	`)
 
-	javac := ctx.ModuleForTests("foo", "android_common").Rule("javac")
-	combineJar := ctx.ModuleForTests("foo", "android_common").Description("for javac")
+	buildOS := android.BuildOs.String()
 
-	if len(javac.Inputs) != 1 || javac.Inputs[0].String() != "a.java" {
-		t.Errorf(`foo inputs %v != ["a.java"]`, javac.Inputs)
-	}
+	jniLib := ctx.ModuleForTests("libfoo_jni", buildOS+"_x86_64_shared").Module().(*cc.Module).OutputFile().Path()
+	fooRes := ctx.ModuleForTests("foo", buildOS+"_common").Output("res/foo.jar")
 
-	barTurbine := filepath.Join(buildDir, ".intermediates", "bar", "android_common", "turbine-combined", "bar.jar")
-	if !strings.Contains(javac.Args["classpath"], barTurbine) {
-		t.Errorf("foo classpath %v does not contain %q", javac.Args["classpath"], barTurbine)
+	if !inList(jniLib.String(), fooRes.Implicits.Strings()) {
+		t.Errorf("expected %q in resource jar implicits, got %v", jniLib, fooRes.Implicits)
 	}
-
-	baz := ctx.ModuleForTests("baz", "android_common").Rule("javac").Output.String()
-	if len(combineJar.Inputs) != 2 || combineJar.Inputs[1].String() != baz {
-		t.Errorf("foo combineJar inputs %v does not contain %q", combineJar.Inputs, baz)
+	expected := "-P lib/" + strings.TrimSuffix(buildOS, "_glibc") + "-x86_64 -C " + filepath.Dir(jniLib.String()) +
+		" -f " + jniLib.String()
+	if !strings.Contains(fooRes.Args["jarArgs"], expected) {
+		t.Errorf("expected resource jar args to contain %q, got %q", expected, fooRes.Args["jarArgs"])
 	}
 
-	atestOptimize := ctx.ModuleForTests("atestOptimize", "android_common").MaybeRule("r8")
-	if atestOptimize.Output == nil {
-		t.Errorf("atestOptimize should optimize APK")
+	content := ctx.ModuleForTests("foo", buildOS+"_x86_64").Rule("binaryWrapper").Args["content"]
+	if w := `"-Djava.library.path=$${progdir}/../lib64"`; !strings.Contains(content, w) {
+		t.Errorf("expected generated wrapper to contain %q, got %q", w, content)
 	}
+}
 
-	atestNoOptimize := ctx.ModuleForTests("atestNoOptimize", "android_common").MaybeRule("d8")
-	if atestNoOptimize.Output == nil {
-		t.Errorf("atestNoOptimize should not optimize APK")
+func TestHostJniLibsDevice(t *testing.T) {
+	testJavaError(t, `host_jni_libs: only supported for host modules`, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			host_jni_libs: ["libfoo_jni"],
+		}
+	`)
+}
+
+func TestJarManifest(t *testing.T) {
+	ctx, _ := testJava(t, `
+		java_library_host {
+			name: "foo",
+			srcs: ["a.java"],
+			main_class: "com.android.foo.Main",
+			manifest_attributes: ["Implementation-Title: foo"],
+		}
+	`)
+
+	buildOS := android.BuildOs.String()
+	foo := ctx.ModuleForTests("foo", buildOS+"_common")
+
+	manifest := foo.Rule("jar_manifest")
+	expected := `printf '%s\n' 'Main-Class: com.android.foo.Main' 'Implementation-Title: foo'`
+	if !strings.Contains(manifest.RuleParams.Command, expected) {
+		t.Errorf("expected manifest command to contain %q, got %q", expected, manifest.RuleParams.Command)
 	}
 
-	atestDefault := ctx.ModuleForTests("atestDefault", "android_common").MaybeRule("r8")
-	if atestDefault.Output == nil {
-		t.Errorf("atestDefault should optimize APK")
+	combined := foo.Output("combined/foo.jar")
+	if !android.InList(manifest.Output.String(), combined.Implicits.Strings()) {
+		t.Errorf("expected %q in combined jar implicits, got %v", manifest.Output, combined.Implicits)
 	}
 }
 
-func TestResources(t *testing.T) {
-	var table = []struct {
-		name  string
-		prop  string
-		extra string
-		args  string
-	}{
-		{
-			// Test that a module with java_resource_dirs includes the files
-			name: "resource dirs",
-			prop: `java_resource_dirs: ["java-res"]`,
-			args: "-C java-res -f java-res/a/a -f java-res/b/b",
-		},
-		{
-			// Test that a module with java_resources includes the files
-			name: "resource files",
-			prop: `java_resources: ["java-res/a/a", "java-res/b/b"]`,
-			args: "-C . -f java-res/a/a -f java-res/b/b",
-		},
-		{
-			// Test that a module with a filegroup in java_resources includes the files with the
-			// path prefix
-			name: "resource filegroup",
-			prop: `java_resources: [":foo-res"]`,
-			extra: `
-				filegroup {
-					name: "foo-res",
-					path: "java-res",
-					srcs: ["java-res/a/a", "java-res/b/b"],
-				}`,
-			args: "-C java-res -f java-res/a/a -f java-res/b/b",
-		},
-		{
-			// Test that a module with wildcards in java_resource_dirs has the correct path prefixes
-			name: "wildcard dirs",
-			prop: `java_resource_dirs: ["java-res/*"]`,
-			args: "-C java-res/a -f java-res/a/a -C java-res/b -f java-res/b/b",
-		},
-		{
-			// Test that a module exclude_java_resource_dirs excludes the files
-			name: "wildcard dirs",
-			prop: `java_resource_dirs: ["java-res/*"], exclude_java_resource_dirs: ["java-res/b"]`,
-			args: "-C java-res/a -f java-res/a/a",
-		},
-		{
-			// Test wildcards in java_resources
-			name: "wildcard files",
-			prop: `java_resources: ["java-res/**/*"]`,
-			args: "-C . -f java-res/a/a -f java-res/b/b",
-		},
-		{
-			// Test exclude_java_resources with java_resources
-			name: "wildcard files with exclude",
-			prop: `java_resources: ["java-res/**/*"], exclude_java_resources: ["java-res/b/*"]`,
-			args: "-C . -f java-res/a/a",
-		},
-		{
-			// Test exclude_java_resources with java_resource_dirs
-			name: "resource dirs with exclude files",
-			prop: `java_resource_dirs: ["java-res"], exclude_java_resources: ["java-res/b/b"]`,
-			args: "-C java-res -f java-res/a/a",
-		},
-		{
-			// Test exclude_java_resource_dirs with java_resource_dirs
-			name: "resource dirs with exclude files",
-			prop: `java_resource_dirs: ["java-res", "java-res2"], exclude_java_resource_dirs: ["java-res2"]`,
-			args: "-C java-res -f java-res/a/a -f java-res/b/b",
-		},
+func TestRelocatableJavacAndManifestPaths(t *testing.T) {
+	ctx, _ := testJava(t, `
+		java_library_host {
+			name: "foo",
+			srcs: ["a.java"],
+			java_version: "1.8",
+			main_class: "com.android.foo.Main",
+			inject_implementation_version: true,
+		}
+	`)
+
+	buildOS := android.BuildOs.String()
+	foo := ctx.ModuleForTests("foo", buildOS+"_common")
+	relToOut := func(s string) string {
+		return strings.ReplaceAll(s, buildDir, "out")
 	}
 
-	for _, test := range table {
-		t.Run(test.name, func(t *testing.T) {
-			ctx, _ := testJavaWithFS(t, `
-				java_library {
-					name: "foo",
-					srcs: [
-						"a.java",
-						"b.java",
-						"c.java",
-					],
-					`+test.prop+`,
-				}
-			`+test.extra,
-				map[string][]byte{
-					"java-res/a/a": nil,
-					"java-res/b/b": nil,
-					"java-res2/a":  nil,
-				},
-			)
+	// The JDK 8 class library is referenced relative to the top of the source tree through
+	// ANDROID_JAVA8_HOME.
+	javac := foo.Rule("javac")
+	if g, w := javac.Args["bootClasspath"], "-bootclasspath jdk8/jre/lib/jce.jar:jdk8/jre/lib/rt.jar"; g != w {
+		t.Errorf("expected bootclasspath %q, got %q", w, g)
+	}
 
-			foo := ctx.ModuleForTests("foo", "android_common").Output("withres/foo.jar")
-			fooRes := ctx.ModuleForTests("foo", "android_common").Output("res/foo.jar")
+	// The manifests are referenced through the build directory, and don't contain any paths.
+	intermediates := "out/.intermediates/foo/" + buildOS + "_common/"
+	combined := foo.Output("combined/foo.jar")
+	if g, w := relToOut(combined.Args["jarArgs"]), "-m  "+intermediates+"manifest.txt"; !strings.Contains(g, w) {
+		t.Errorf("expected combined jar args to contain %q, got %q", w, g)
+	}
 
-			if !inList(fooRes.Output.String(), foo.Inputs.Strings()) {
-				t.Errorf("foo combined jars %v does not contain %q",
-					foo.Inputs.Strings(), fooRes.Output.String())
-			}
+	stamp := foo.Rule("stamp_jar")
+	if g, w := relToOut(stamp.RuleParams.Command), "-m "+intermediates+"stamped/stamp/MANIFEST.MF"; !strings.Contains(g, w) {
+		t.Errorf("expected stamp command to contain %q, got %q", w, g)
+	}
 
-			if fooRes.Args["jarArgs"] != test.args {
-				t.Errorf("foo resource jar args %q is not %q",
-					fooRes.Args["jarArgs"], test.args)
-			}
-		})
+	manifest := foo.Rule("jar_manifest")
+	if g, w := manifest.RuleParams.Command, `printf '%s\n' 'Main-Class: com.android.foo.Main' >`; !strings.Contains(g, w) {
+		t.Errorf("expected manifest command to contain %q, got %q", w, g)
 	}
 }
 
-func TestIncludeSrcs(t *testing.T) {
-	ctx, _ := testJavaWithFS(t, `
-		java_library {
+func TestStamp(t *testing.T) {
+	ctx, _ := testJava(t, `
+		java_library_host {
 			name: "foo",
-			srcs: [
-				"a.java",
-				"b.java",
-				"c.java",
-			],
-			include_srcs: true,
+			srcs: ["a.java"],
+			main_class: "com.android.foo.Main",
+			inject_implementation_version: true,
+			stamp: {
+				java_resources: ["com/android/foo/version.properties"],
+			},
 		}
 
 		java_library {
 			name: "bar",
-			srcs: [
-				"a.java",
-				"b.java",
-				"c.java",
-			],
-			java_resource_dirs: ["java-res"],
-			include_srcs: true,
+			srcs: ["b.java"],
+			installable: true,
+			stamp: {
+				manifest: true,
+			},
 		}
-	`, map[string][]byte{
-		"java-res/a/a": nil,
-		"java-res/b/b": nil,
-		"java-res2/a":  nil,
-	})
-
-	// Test a library with include_srcs: true
-	foo := ctx.ModuleForTests("foo", "android_common").Output("withres/foo.jar")
-	fooSrcJar := ctx.ModuleForTests("foo", "android_common").Output("foo.srcjar")
+	`)
 
-	if g, w := fooSrcJar.Output.String(), foo.Inputs.Strings(); !inList(g, w) {
-		t.Errorf("foo combined jars %v does not contain %q", w, g)
+	buildOS := android.BuildOs.String()
+	foo := ctx.ModuleForTests("foo", buildOS+"_common")
+
+	stamp := foo.Rule("stamp_jar")
+	combinedJar := foo.Output("combined/foo.jar").Output.String()
+	manifest := foo.Output("manifest.txt").Output.String()
+	for _, w := range []string{"build_number.txt", "build_scm_revision.txt", combinedJar, manifest} {
+		found := false
+		for _, input := range stamp.Implicits.Strings() {
+			if strings.HasSuffix(input, w) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected %q in stamp implicits, got %v", w, stamp.Implicits)
+		}
 	}
-
-	if g, w := fooSrcJar.Args["jarArgs"], "-C . -f a.java -f b.java -f c.java"; g != w {
-		t.Errorf("foo source jar args %q is not %q", w, g)
+	for _, w := range []string{
+		`echo "Implementation-Version: $${build_number}"`,
+		`-e "s|@BUILD_NUMBER@|$${build_number}|g"`,
+		`com/android/foo/version.properties`,
+	} {
+		if !strings.Contains(stamp.RuleParams.Command, w) {
+			t.Errorf("expected stamp command to contain %q, got %q", w, stamp.RuleParams.Command)
+		}
 	}
-
-	// Test a library with include_srcs: true and resources
-	bar := ctx.ModuleForTests("bar", "android_common").Output("withres/bar.jar")
-	barResCombined := ctx.ModuleForTests("bar", "android_common").Output("res-combined/bar.jar")
-	barRes := ctx.ModuleForTests("bar", "android_common").Output("res/bar.jar")
-	barSrcJar := ctx.ModuleForTests("bar", "android_common").Output("bar.srcjar")
-
-	if g, w := barSrcJar.Output.String(), barResCombined.Inputs.Strings(); !inList(g, w) {
-		t.Errorf("bar combined resource jars %v does not contain %q", w, g)
+	if strings.Contains(stamp.RuleParams.Command, "SCM-Revision") {
+		t.Errorf("expected stamp command not to stamp the source revision, got %q", stamp.RuleParams.Command)
 	}
 
-	if g, w := barRes.Output.String(), barResCombined.Inputs.Strings(); !inList(g, w) {
-		t.Errorf("bar combined resource jars %v does not contain %q", w, g)
+	// The unstamped jar is used on the classpath of dependents, the stamped one is installed.
+	fooModule := foo.Module().(*Library)
+	if g, w := fooModule.implementationAndResourcesJar.String(), combinedJar; g != w {
+		t.Errorf("expected unstamped jar %q, got %q", w, g)
 	}
-
-	if g, w := barResCombined.Output.String(), bar.Inputs.Strings(); !inList(g, w) {
-		t.Errorf("bar combined jars %v does not contain %q", w, g)
+	if g, w := fooModule.outputFile.String(), stamp.Output.String(); g != w {
+		t.Errorf("expected stamped output file %q, got %q", w, g)
 	}
 
-	if g, w := barSrcJar.Args["jarArgs"], "-C . -f a.java -f b.java -f c.java"; g != w {
-		t.Errorf("bar source jar args %q is not %q", w, g)
+	// Device modules are stamped after they are compiled to dex.
+	bar := ctx.ModuleForTests("bar", "android_common")
+	barStamp := bar.Rule("stamp_jar")
+	if !strings.Contains(barStamp.RuleParams.Command, `echo "SCM-Revision: $${scm_revision}"`) {
+		t.Errorf("expected stamp command to stamp the source revision, got %q", barStamp.RuleParams.Command)
 	}
-
-	if g, w := barRes.Args["jarArgs"], "-C java-res -f java-res/a/a -f java-res/b/b"; g != w {
-		t.Errorf("bar resource jar args %q is not %q", w, g)
+	barDexJar := bar.Rule("d8").Output.String()
+	if !android.InList(barDexJar, barStamp.Implicits.Strings()) {
+		t.Errorf("expected dex jar %q in stamp implicits, got %v", barDexJar, barStamp.Implicits)
 	}
 }
 
-func TestGeneratedSources(t *testing.T) {
+func TestJarManifestErrors(t *testing.T) {
+	testJavaError(t, `manifest_attributes: "Implementation-Title foo" is not in the form "Name: value"`, `
+		java_library_host {
+			name: "foo",
+			srcs: ["a.java"],
+			manifest_attributes: ["Implementation-Title foo"],
+		}
+	`)
+
+	testJavaError(t, `manifest_attributes: Main-Class conflicts with the attribute generated by main_class`, `
+		java_library_host {
+			name: "foo",
+			srcs: ["a.java"],
+			main_class: "com.android.foo.Main",
+			manifest_attributes: ["Main-Class: com.android.foo.Other"],
+		}
+	`)
+
+	testJavaError(t, `manifest: cannot be used with main_class`, `
+		java_library_host {
+			name: "foo",
+			srcs: ["a.java"],
+			manifest: "manifest.txt",
+			main_class: "com.android.foo.Main",
+		}
+	`)
+}
+
+func TestProtoGrpcPlugin(t *testing.T) {
 	ctx, _ := testJavaWithFS(t, `
-		java_library {
+		java_library_host {
 			name: "foo",
-			srcs: [
-				"a*.java",
-				":gen",
-				"b*.java",
-			],
+			srcs: ["a.proto"],
+			proto: {
+				type: "full",
+				grpc_plugin: "protoc-gen-grpc-java-plugin",
+			},
 		}
 
-		genrule {
-			name: "gen",
-			tool_files: ["java-res/a"],
-			out: ["gen.java"],
+		java_library_host {
+			name: "libprotobuf-java-full",
+			srcs: ["a.java"],
+		}
+
+		java_binary_host {
+			name: "protoc-gen-grpc-java-plugin",
+			srcs: ["b.java"],
 		}
 	`, map[string][]byte{
-		"a.java": nil,
-		"b.java": nil,
+		"a.proto": nil,
 	})
 
-	javac := ctx.ModuleForTests("foo", "android_common").Rule("javac")
-	genrule := ctx.ModuleForTests("gen", "").Rule("generator")
+	buildOS := android.BuildOs.String()
 
-	if filepath.Base(genrule.Output.String()) != "gen.java" {
-		t.Fatalf(`gen output file %v is not ".../gen.java"`, genrule.Output.String())
-	}
+	protoc := ctx.ModuleForTests("foo", buildOS+"_common").Rule("protoc")
+	plugin := ctx.ModuleForTests("protoc-gen-grpc-java-plugin", buildOS+"_x86_64").Module().(*Binary).HostToolPath().String()
 
-	if len(javac.Inputs) != 3 ||
-		javac.Inputs[0].String() != "a.java" ||
-		javac.Inputs[1].String() != genrule.Output.String() ||
-		javac.Inputs[2].String() != "b.java" {
-		t.Errorf(`foo inputs %v != ["a.java", ".../gen.java", "b.java"]`, javac.Inputs)
+	if !strings.Contains(protoc.RuleParams.Command, "--plugin=protoc-gen-grpc-java="+plugin) {
+		t.Errorf("expected protoc command to use the gRPC plugin %q, got %q", plugin, protoc.RuleParams.Command)
+	}
+	if !strings.Contains(protoc.RuleParams.Command, "--grpc-java_out=:") {
+		t.Errorf("expected protoc command to contain --grpc-java_out, got %q", protoc.RuleParams.Command)
+	}
+	if !inList(plugin, protoc.Implicits.Strings()) {
+		t.Errorf("expected protoc implicits to contain %q, got %v", plugin, protoc.Implicits.Strings())
 	}
 }
 
-func TestTurbine(t *testing.T) {
-	ctx, _ := testJava(t, `
+func TestProto(t *testing.T) {
+	ctx, _ := testJavaWithFS(t, `
 		java_library {
 			name: "foo",
-			srcs: ["a.java"],
-			sdk_version: "14",
+			srcs: [
+				"a.java",
+				"proto/foo.proto",
+			],
+			proto: {
+				include_dirs: ["external/protobuf/src"],
+			},
 		}
 
 		java_library {
 			name: "bar",
+			srcs: ["proto/bar.proto"],
+			proto: {
+				type: "nano",
+			},
+		}
+
+		java_library {
+			name: "libprotobuf-java-lite",
 			srcs: ["b.java"],
-			static_libs: ["foo"],
-			sdk_version: "14",
 		}
 
 		java_library {
-			name: "baz",
-			srcs: ["c.java"],
-			libs: ["bar"],
-			sdk_version: "14",
+			name: "libprotobuf-java-nano",
+			srcs: ["b.java"],
 		}
-		`)
+	`, map[string][]byte{
+		"proto/foo.proto": nil,
+		"proto/bar.proto": nil,
+	})
 
-	fooTurbine := ctx.ModuleForTests("foo", "android_common").Rule("turbine")
-	barTurbine := ctx.ModuleForTests("bar", "android_common").Rule("turbine")
-	barJavac := ctx.ModuleForTests("bar", "android_common").Rule("javac")
-	barTurbineCombined := ctx.ModuleForTests("bar", "android_common").Description("for turbine")
-	bazJavac := ctx.ModuleForTests("baz", "android_common").Rule("javac")
+	foo := ctx.ModuleForTests("foo", "android_common")
+	protoc := foo.Rule("protoc")
+	for _, w := range []string{"--java_out=lite:", "-Iexternal/protobuf/src"} {
+		if !strings.Contains(protoc.RuleParams.Command, w) {
+			t.Errorf("expected protoc command to contain %q, got %q", w, protoc.RuleParams.Command)
+		}
+	}
 
-	if len(fooTurbine.Inputs) != 1 || fooTurbine.Inputs[0].String() != "a.java" {
-		t.Errorf(`foo inputs %v != ["a.java"]`, fooTurbine.Inputs)
+	// Test that the generated java files are compiled
+	javac := foo.Rule("javac")
+	if g, w := javac.Implicits.Strings(), protoc.Output.String(); !inList(w, g) {
+		t.Errorf("javac implicits %q do not contain the proto srcjar %q", g, w)
 	}
 
-	fooHeaderJar := filepath.Join(buildDir, ".intermediates", "foo", "android_common", "turbine-combined", "foo.jar")
-	if !strings.Contains(barTurbine.Args["classpath"], fooHeaderJar) {
-		t.Errorf("bar turbine classpath %v does not contain %q", barTurbine.Args["classpath"], fooHeaderJar)
+	// Test that the runtime matching the proto type is statically linked
+	combineJar := foo.Description("for javac")
+	lite := ctx.ModuleForTests("libprotobuf-java-lite", "android_common").Rule("combineJar").Output
+	if g, w := combineJar.Inputs.Strings(), lite.String(); !inList(w, g) {
+		t.Errorf("foo combined inputs %q do not contain the lite runtime %q", g, w)
 	}
-	if !strings.Contains(barJavac.Args["classpath"], fooHeaderJar) {
-		t.Errorf("bar javac classpath %v does not contain %q", barJavac.Args["classpath"], fooHeaderJar)
+
+	bar := ctx.ModuleForTests("bar", "android_common")
+	if g, w := bar.Rule("protoc").RuleParams.Command, "--javanano_out=:"; !strings.Contains(g, w) {
+		t.Errorf("expected protoc command to contain %q, got %q", w, g)
 	}
-	if len(barTurbineCombined.Inputs) != 2 || barTurbineCombined.Inputs[1].String() != fooHeaderJar {
-		t.Errorf("bar turbine combineJar inputs %v does not contain %q", barTurbineCombined.Inputs, fooHeaderJar)
+	nano := ctx.ModuleForTests("libprotobuf-java-nano", "android_common").Rule("combineJar").Output
+	if g, w := bar.Description("for javac").Inputs.Strings(), nano.String(); !inList(w, g) {
+		t.Errorf("bar combined inputs %q do not contain the nano runtime %q", g, w)
 	}
-	if !strings.Contains(bazJavac.Args["classpath"], "prebuilts/sdk/14/public/android.jar") {
-		t.Errorf("baz javac classpath %v does not contain %q", bazJavac.Args["classpath"],
-			"prebuilts/sdk/14/public/android.jar")
+
+	testJavaError(t, `proto.type: full java protos only supported on the host`, `
+		java_library {
+			name: "baz",
+			srcs: ["a.proto"],
+			proto: {
+				type: "full",
+			},
+		}
+	`)
+}
+
+func TestGenerateJniHeaders(t *testing.T) {
+	ctx, _ := testJavaWithFS(t, cc.GatherRequiredDepsForTest(android.Android)+`
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			generate_jni_headers: true,
+		}
+
+		cc_library_shared {
+			name: "libfoo_jni",
+			srcs: ["foo_jni.cpp"],
+			jni_header_libs: ["foo"],
+			stl: "none",
+			system_shared_libs: [],
+		}
+	`, map[string][]byte{
+		"foo_jni.cpp": nil,
+	})
+
+	javac := ctx.ModuleForTests("foo", "android_common").Rule("javac")
+	headersDir := filepath.Join(buildDir, ".intermediates", "foo", "android_common", "jni_headers")
+	if !strings.Contains(javac.RuleParams.Command, "$jniHeadersFlags") || javac.Args["jniHeadersFlags"] != "-h "+headersDir {
+		t.Errorf("expected javac to generate the JNI headers into %q, got %q", headersDir, javac.Args["jniHeadersFlags"])
+	}
+
+	jniCc := ctx.ModuleForTests("libfoo_jni", "android_arm64_armv8-a_shared").Rule("cc")
+	if !strings.Contains(jniCc.Args["cFlags"], "-I"+headersDir) {
+		t.Errorf("expected cc flags to include %q, got %q", "-I"+headersDir, jniCc.Args["cFlags"])
+	}
+	if !android.InList(javac.Output.String(), jniCc.OrderOnly.Strings()) {
+		t.Errorf("expected cc to depend on %q, got %q", javac.Output.String(), jniCc.OrderOnly.Strings())
 	}
 }
 
-func TestSharding(t *testing.T) {
+func TestPrebuilts(t *testing.T) {
 	ctx, _ := testJava(t, `
 		java_library {
+			name: "foo",
+			srcs: ["a.java", ":stubs-source"],
+			libs: ["bar", "sdklib"],
+			static_libs: ["baz"],
+		}
+
+		java_import {
 			name: "bar",
-			srcs: ["a.java","b.java","c.java"],
-			javac_shard_size: 1
+			jars: ["a.jar"],
 		}
-		`)
 
-	barHeaderJar := filepath.Join(buildDir, ".intermediates", "bar", "android_common", "turbine-combined", "bar.jar")
-	for i := 0; i < 3; i++ {
-		barJavac := ctx.ModuleForTests("bar", "android_common").Description("javac" + strconv.Itoa(i))
-		if !strings.Contains(barJavac.Args["classpath"], barHeaderJar) {
-			t.Errorf("bar javac classpath %v does not contain %q", barJavac.Args["classpath"], barHeaderJar)
+		java_import {
+			name: "baz",
+			jars: ["b.jar"],
 		}
-	}
-}
 
-func TestDroiddoc(t *testing.T) {
-	ctx, _ := testJavaWithFS(t, `
-		droiddoc_exported_dir {
-		    name: "droiddoc-templates-sdk",
-		    path: ".",
+		dex_import {
+			name: "qux",
+			jars: ["b.jar"],
 		}
-		filegroup {
-		    name: "bar-doc-aidl-srcs",
-		    srcs: ["bar-doc/IBar.aidl"],
-		    path: "bar-doc",
+
+		java_sdk_library_import {
+			name: "sdklib",
+			public: {
+				jars: ["c.jar"],
+			},
 		}
-		droiddoc {
-		    name: "bar-doc",
-		    srcs: [
-		        "bar-doc/a.java",
-		        "bar-doc/IFoo.aidl",
-		        ":bar-doc-aidl-srcs",
-		    ],
-		    exclude_srcs: [
-		        "bar-doc/b.java"
-		    ],
-		    custom_template: "droiddoc-templates-sdk",
-		    hdf: [
-		        "android.whichdoc offline",
-		    ],
-		    knowntags: [
-		        "bar-doc/known_oj_tags.txt",
-		    ],
-		    proofread_file: "libcore-proofread.txt",
-		    todo_file: "libcore-docs-todo.html",
-		    args: "-offlinemode -title \"libcore\"",
+
+		prebuilt_stubs_sources {
+			name: "stubs-source",
+			srcs: ["stubs/sources"],
 		}
-		`,
-		map[string][]byte{
-			"bar-doc/a.java": nil,
-			"bar-doc/b.java": nil,
-		})
 
-	barDoc := ctx.ModuleForTests("bar-doc", "android_common").Rule("javadoc")
-	var javaSrcs []string
-	for _, i := range barDoc.Inputs {
-		javaSrcs = append(javaSrcs, i.Base())
-	}
-	if len(javaSrcs) != 1 || javaSrcs[0] != "a.java" {
-		t.Errorf("inputs of bar-doc must be []string{\"a.java\"}, but was %#v.", javaSrcs)
+		java_test_import {
+			name: "test",
+			jars: ["a.jar"],
+			test_suites: ["cts"],
+			test_config: "AndroidTest.xml",
+		}
+		`)
+
+	fooModule := ctx.ModuleForTests("foo", "android_common")
+	javac := fooModule.Rule("javac")
+	combineJar := ctx.ModuleForTests("foo", "android_common").Description("for javac")
+	barJar := ctx.ModuleForTests("bar", "android_common").Rule("combineJar").Output
+	bazJar := ctx.ModuleForTests("baz", "android_common").Rule("combineJar").Output
+	sdklibStubsJar := ctx.ModuleForTests("sdklib.stubs", "android_common").Rule("combineJar").Output
+
+	fooLibrary := fooModule.Module().(*Library)
+	assertDeepEquals(t, "foo java sources incorrect",
+		[]string{"a.java"}, fooLibrary.compiledJavaSrcs.Strings())
+
+	assertDeepEquals(t, "foo java source jars incorrect",
+		[]string{".intermediates/stubs-source/android_common/stubs-source-stubs.srcjar"},
+		android.NormalizePathsForTesting(fooLibrary.compiledSrcJars))
+
+	if !strings.Contains(javac.Args["classpath"], barJar.String()) {
+		t.Errorf("foo classpath %v does not contain %q", javac.Args["classpath"], barJar.String())
 	}
 
-	aidl := ctx.ModuleForTests("bar-doc", "android_common").Rule("aidl")
-	if g, w := barDoc.Implicits.Strings(), aidl.Output.String(); !inList(w, g) {
-		t.Errorf("implicits of bar-doc must contain %q, but was %q.", w, g)
+	if !strings.Contains(javac.Args["classpath"], sdklibStubsJar.String()) {
+		t.Errorf("foo classpath %v does not contain %q", javac.Args["classpath"], sdklibStubsJar.String())
 	}
 
-	if g, w := aidl.Implicits.Strings(), []string{"bar-doc/IBar.aidl", "bar-doc/IFoo.aidl"}; !reflect.DeepEqual(w, g) {
-		t.Errorf("aidl inputs must be %q, but was %q", w, g)
+	if len(combineJar.Inputs) != 2 || combineJar.Inputs[1].String() != bazJar.String() {
+		t.Errorf("foo combineJar inputs %v does not contain %q", combineJar.Inputs, bazJar.String())
 	}
+
+	ctx.ModuleForTests("qux", "android_common").Rule("Cp")
 }
 
-func TestDroidstubs(t *testing.T) {
-	ctx, _ := testJavaWithFS(t, `
-		droiddoc_exported_dir {
-		    name: "droiddoc-templates-sdk",
-		    path: ".",
+func TestDexImport(t *testing.T) {
+	ctx, _ := testJava(t, `
+		dex_import {
+			name: "foo",
+			jars: ["a.jar"],
 		}
+	`)
 
-		droidstubs {
-		    name: "bar-stubs",
-		    srcs: [
-		        "bar-doc/a.java",
-				],
-				api_levels_annotations_dirs: [
-					"droiddoc-templates-sdk",
-				],
-				api_levels_annotations_enabled: true,
-		}
+	foo := ctx.ModuleForTests("foo", "android_common")
+	check := foo.Output("dex_check.stamp")
+	if expected := "zipinfo -1 a.jar 'classes*.dex'"; !strings.Contains(check.RuleParams.Command, expected) {
+		t.Errorf("expected %q in the dex check command %q", expected, check.RuleParams.Command)
+	}
 
-		droidstubs {
-		    name: "bar-stubs-other",
-		    srcs: [
-		        "bar-doc/a.java",
-				],
-				api_levels_annotations_dirs: [
-					"droiddoc-templates-sdk",
-				],
-				api_levels_annotations_enabled: true,
-				api_levels_jar_filename: "android.other.jar",
-		}
-		`,
-		map[string][]byte{
-			"bar-doc/a.java": nil,
-		})
-	testcases := []struct {
-		moduleName          string
-		expectedJarFilename string
-	}{
-		{
-			moduleName:          "bar-stubs",
-			expectedJarFilename: "android.jar",
-		},
-		{
-			moduleName:          "bar-stubs-other",
-			expectedJarFilename: "android.other.jar",
-		},
+	cp := foo.Rule("Cp")
+	if !android.InList(check.Output.String(), cp.Implicits.Strings()) {
+		t.Errorf("expected the dex check %q in the inputs of the imported jar, got %q",
+			check.Output.String(), cp.Implicits.Strings())
 	}
-	for _, c := range testcases {
-		m := ctx.ModuleForTests(c.moduleName, "android_common")
-		metalava := m.Rule("metalava")
-		expected := "--android-jar-pattern ./%/public/" + c.expectedJarFilename
-		if actual := metalava.RuleParams.Command; !strings.Contains(actual, expected) {
-			t.Errorf("For %q, expected metalava argument %q, but was not found %q", c.moduleName, expected, actual)
-		}
+
+	dexJar := foo.Module().(*DexImport).DexJar()
+	if dexJar == nil || dexJar.String() != cp.Output.String() {
+		t.Errorf("expected the dex jar to be the imported jar %q, got %v", cp.Output.String(), dexJar)
 	}
 }
 
-func TestDroidstubsWithSystemModules(t *testing.T) {
+func TestJavaImportPrefer(t *testing.T) {
 	ctx, _ := testJava(t, `
-		droidstubs {
-		    name: "stubs-source-system-modules",
-		    srcs: [
-		        "bar-doc/a.java",
-		    ],
-				sdk_version: "none",
-				system_modules: "source-system-modules",
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
 		}
 
-		java_library {
-				name: "source-jar",
-		    srcs: [
-		        "a.java",
-		    ],
+		java_import {
+			name: "foo",
+			jars: ["a.jar", "b.jar"],
+			installable: true,
+			prefer: true,
 		}
 
-		java_system_modules {
-				name: "source-system-modules",
-				libs: ["source-jar"],
+		java_library {
+			name: "bar",
+			srcs: ["b.java"],
+			libs: ["foo"],
 		}
+	`)
 
-		droidstubs {
-		    name: "stubs-prebuilt-system-modules",
-		    srcs: [
-		        "bar-doc/a.java",
-		    ],
-				sdk_version: "none",
-				system_modules: "prebuilt-system-modules",
-		}
-
-		java_import {
-				name: "prebuilt-jar",
-				jars: ["a.jar"],
-		}
-
-		java_system_modules_import {
-				name: "prebuilt-system-modules",
-				libs: ["prebuilt-jar"],
-		}
-		`)
+	fooImport := ctx.ModuleForTests("prebuilt_foo", "android_common")
+	combineJar := fooImport.Rule("combineJar")
+	if g, w := combineJar.Inputs.Strings(), []string{"a.jar", "b.jar"}; !reflect.DeepEqual(g, w) {
+		t.Errorf("expected the prebuilt jars %q to be merged, got %q", w, g)
+	}
 
-	checkSystemModulesUseByDroidstubs(t, ctx, "stubs-source-system-modules", "source-jar.jar")
+	install := buildDir + "/target/product/test_device/system/framework/foo.jar"
+	if fooImport.MaybeOutput(install).Rule == nil {
+		t.Errorf("expected the installable prebuilt to be installed to %q", install)
+	}
 
-	checkSystemModulesUseByDroidstubs(t, ctx, "stubs-prebuilt-system-modules", "prebuilt-jar.jar")
+	// The preferred prebuilt shadows the source module of the same name.
+	javac := ctx.ModuleForTests("bar", "android_common").Rule("javac")
+	if !strings.Contains(javac.Args["classpath"], combineJar.Output.String()) {
+		t.Errorf("bar classpath %v does not contain the prebuilt %q", javac.Args["classpath"], combineJar.Output.String())
+	}
+	sourceJar := ctx.ModuleForTests("foo", "android_common").Rule("javac").Output.String()
+	if strings.Contains(javac.Args["classpath"], sourceJar) {
+		t.Errorf("bar classpath %v contains the source module %q", javac.Args["classpath"], sourceJar)
+	}
 }
 
-func checkSystemModulesUseByDroidstubs(t *testing.T, ctx *android.TestContext, moduleName string, systemJar string) {
-	metalavaRule := ctx.ModuleForTests(moduleName, "android_common").Rule("metalava")
-	var systemJars []string
-	for _, i := range metalavaRule.Implicits {
-		systemJars = append(systemJars, i.Base())
-	}
-	if len(systemJars) < 1 || systemJars[0] != systemJar {
-		t.Errorf("inputs of %q must be []string{%q}, but was %#v.", moduleName, systemJar, systemJars)
+func assertDeepEquals(t *testing.T, message string, expected interface{}, actual interface{}) {
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("%s: expected %q, found %q", message, expected, actual)
 	}
 }
 
-func TestJarGenrules(t *testing.T) {
+func TestJavaSdkLibraryImport(t *testing.T) {
 	ctx, _ := testJava(t, `
 		java_library {
 			name: "foo",
 			srcs: ["a.java"],
-		}
-
-		java_genrule {
-			name: "jargen",
-			tool_files: ["b.java"],
-			cmd: "$(location b.java) $(in) $(out)",
-			out: ["jargen.jar"],
-			srcs: [":foo"],
+			libs: ["sdklib"],
+			sdk_version: "current",
 		}
 
 		java_library {
-			name: "bar",
-			static_libs: ["jargen"],
-			srcs: ["c.java"],
+			name: "foo.system",
+			srcs: ["a.java"],
+			libs: ["sdklib"],
+			sdk_version: "system_current",
 		}
 
 		java_library {
-			name: "baz",
-			libs: ["jargen"],
-			srcs: ["c.java"],
+			name: "foo.test",
+			srcs: ["a.java"],
+			libs: ["sdklib"],
+			sdk_version: "test_current",
 		}
-	`)
-
-	foo := ctx.ModuleForTests("foo", "android_common").Output("javac/foo.jar")
-	jargen := ctx.ModuleForTests("jargen", "android_common").Output("jargen.jar")
-	bar := ctx.ModuleForTests("bar", "android_common").Output("javac/bar.jar")
-	baz := ctx.ModuleForTests("baz", "android_common").Output("javac/baz.jar")
-	barCombined := ctx.ModuleForTests("bar", "android_common").Output("combined/bar.jar")
-
-	if len(jargen.Inputs) != 1 || jargen.Inputs[0].String() != foo.Output.String() {
-		t.Errorf("expected jargen inputs [%q], got %q", foo.Output.String(), jargen.Inputs.Strings())
-	}
-
-	if !strings.Contains(bar.Args["classpath"], jargen.Output.String()) {
-		t.Errorf("bar classpath %v does not contain %q", bar.Args["classpath"], jargen.Output.String())
-	}
-
-	if !strings.Contains(baz.Args["classpath"], jargen.Output.String()) {
-		t.Errorf("baz classpath %v does not contain %q", baz.Args["classpath"], jargen.Output.String())
-	}
-
-	if len(barCombined.Inputs) != 2 ||
-		barCombined.Inputs[0].String() != bar.Output.String() ||
-		barCombined.Inputs[1].String() != jargen.Output.String() {
-		t.Errorf("bar combined jar inputs %v is not [%q, %q]",
-			barCombined.Inputs.Strings(), bar.Output.String(), jargen.Output.String())
-	}
-}
 
-func TestExcludeFileGroupInSrcs(t *testing.T) {
-	ctx, _ := testJava(t, `
-		java_library {
-			name: "foo",
-			srcs: ["a.java", ":foo-srcs"],
-			exclude_srcs: ["a.java", ":foo-excludes"],
+		java_sdk_library_import {
+			name: "sdklib",
+			public: {
+				jars: ["a.jar"],
+			},
+			system: {
+				jars: ["b.jar"],
+			},
+			test: {
+				jars: ["c.jar"],
+				stub_srcs: ["c.java"],
+			},
 		}
+		`)
 
-		filegroup {
-			name: "foo-srcs",
-			srcs: ["java-fg/a.java", "java-fg/b.java", "java-fg/c.java"],
-		}
+	for _, scope := range []string{"", ".system", ".test"} {
+		fooModule := ctx.ModuleForTests("foo"+scope, "android_common")
+		javac := fooModule.Rule("javac")
 
-		filegroup {
-			name: "foo-excludes",
-			srcs: ["java-fg/a.java", "java-fg/b.java"],
+		sdklibStubsJar := ctx.ModuleForTests("sdklib.stubs"+scope, "android_common").Rule("combineJar").Output
+		if !strings.Contains(javac.Args["classpath"], sdklibStubsJar.String()) {
+			t.Errorf("foo classpath %v does not contain %q", javac.Args["classpath"], sdklibStubsJar.String())
 		}
-	`)
-
-	javac := ctx.ModuleForTests("foo", "android_common").Rule("javac")
-
-	if len(javac.Inputs) != 1 || javac.Inputs[0].String() != "java-fg/c.java" {
-		t.Errorf(`foo inputs %v != ["java-fg/c.java"]`, javac.Inputs)
 	}
 }
 
-func TestJavaLibrary(t *testing.T) {
-	config := testConfig(nil, "", map[string][]byte{
-		"libcore/Android.bp": []byte(`
-				java_library {
-						name: "core",
-						sdk_version: "none",
-						system_modules: "none",
-				}`),
-	})
-	ctx := testContext()
-	run(t, ctx, config)
-}
-
-func TestJavaSdkLibrary(t *testing.T) {
+func TestDefaults(t *testing.T) {
 	ctx, _ := testJava(t, `
-		droiddoc_exported_dir {
-			name: "droiddoc-templates-sdk",
-			path: ".",
+		java_defaults {
+			name: "defaults",
+			srcs: ["a.java"],
+			libs: ["bar"],
+			static_libs: ["baz"],
+			optimize: {enabled: false},
 		}
-		java_sdk_library {
+
+		java_library {
 			name: "foo",
-			srcs: ["a.java", "b.java"],
-			api_packages: ["foo"],
+			defaults: ["defaults"],
 		}
-		java_sdk_library {
+
+		java_library {
 			name: "bar",
-			srcs: ["a.java", "b.java"],
-			api_packages: ["bar"],
+			srcs: ["b.java"],
 		}
+
 		java_library {
 			name: "baz",
 			srcs: ["c.java"],
-			libs: ["foo", "bar.stubs"],
-			sdk_version: "system_current",
-		}
-		java_sdk_library {
-			name: "barney",
-			srcs: ["c.java"],
-			api_only: true,
-		}
-		java_sdk_library {
-			name: "betty",
-			srcs: ["c.java"],
-			shared_library: false,
-		}
-		java_sdk_library_import {
-		    name: "quuz",
-				public: {
-					jars: ["c.jar"],
-				},
-		}
-		java_sdk_library_import {
-		    name: "fred",
-				public: {
-					jars: ["b.jar"],
-				},
-		}
-		java_sdk_library_import {
-		    name: "wilma",
-				public: {
-					jars: ["b.jar"],
-				},
-				shared_library: false,
 		}
-		java_library {
-		    name: "qux",
-		    srcs: ["c.java"],
-		    libs: ["baz", "fred", "quuz.stubs", "wilma", "barney", "betty"],
-		    sdk_version: "system_current",
+
+		android_test {
+			name: "atestOptimize",
+			defaults: ["defaults"],
+			optimize: {enabled: true},
 		}
-		java_library {
-			name: "baz-test",
-			srcs: ["c.java"],
-			libs: ["foo"],
-			sdk_version: "test_current",
+
+		android_test {
+			name: "atestNoOptimize",
+			defaults: ["defaults"],
 		}
-		java_library {
-			name: "baz-29",
-			srcs: ["c.java"],
-			libs: ["foo"],
-			sdk_version: "system_29",
+
+		android_test {
+			name: "atestDefault",
+			srcs: ["a.java"],
 		}
 		`)
 
-	// check the existence of the internal modules
-	ctx.ModuleForTests("foo", "android_common")
-	ctx.ModuleForTests(apiScopePublic.stubsLibraryModuleName("foo"), "android_common")
-	ctx.ModuleForTests(apiScopeSystem.stubsLibraryModuleName("foo"), "android_common")
-	ctx.ModuleForTests(apiScopeTest.stubsLibraryModuleName("foo"), "android_common")
-	ctx.ModuleForTests(apiScopePublic.stubsSourceModuleName("foo"), "android_common")
-	ctx.ModuleForTests(apiScopeSystem.stubsSourceModuleName("foo"), "android_common")
-	ctx.ModuleForTests(apiScopeTest.stubsSourceModuleName("foo"), "android_common")
-	ctx.ModuleForTests("foo"+sdkXmlFileSuffix, "android_common")
-	ctx.ModuleForTests("foo.api.public.28", "")
-	ctx.ModuleForTests("foo.api.system.28", "")
-	ctx.ModuleForTests("foo.api.test.28", "")
+	javac := ctx.ModuleForTests("foo", "android_common").Rule("javac")
+	combineJar := ctx.ModuleForTests("foo", "android_common").Description("for javac")
 
-	bazJavac := ctx.ModuleForTests("baz", "android_common").Rule("javac")
-	// tests if baz is actually linked to the stubs lib
-	if !strings.Contains(bazJavac.Args["classpath"], "foo.stubs.system.jar") {
-		t.Errorf("baz javac classpath %v does not contain %q", bazJavac.Args["classpath"],
-			"foo.stubs.system.jar")
-	}
-	// ... and not to the impl lib
-	if strings.Contains(bazJavac.Args["classpath"], "foo.jar") {
-		t.Errorf("baz javac classpath %v should not contain %q", bazJavac.Args["classpath"],
-			"foo.jar")
-	}
-	// test if baz is not linked to the system variant of foo
-	if strings.Contains(bazJavac.Args["classpath"], "foo.stubs.jar") {
-		t.Errorf("baz javac classpath %v should not contain %q", bazJavac.Args["classpath"],
-			"foo.stubs.jar")
+	if len(javac.Inputs) != 1 || javac.Inputs[0].String() != "a.java" {
+		t.Errorf(`foo inputs %v != ["a.java"]`, javac.Inputs)
 	}
 
-	bazTestJavac := ctx.ModuleForTests("baz-test", "android_common").Rule("javac")
-	// tests if baz-test is actually linked to the test stubs lib
+	barTurbine := filepath.Join(buildDir, ".intermediates", "bar", "android_common", "turbine-combined", "bar.jar")
+	if !strings.Contains(javac.Args["classpath"], barTurbine) {
+		t.Errorf("foo classpath %v does not contain %q", javac.Args["classpath"], barTurbine)
+	}
+
+	baz := ctx.ModuleForTests("baz", "android_common").Rule("javac").Output.String()
+	if len(combineJar.Inputs) != 2 || combineJar.Inputs[1].String() != baz {
+		t.Errorf("foo combineJar inputs %v does not contain %q", combineJar.Inputs, baz)
+	}
+
+	atestOptimize := ctx.ModuleForTests("atestOptimize", "android_common").MaybeRule("r8")
+	if atestOptimize.Output == nil {
+		t.Errorf("atestOptimize should optimize APK")
+	}
+
+	atestNoOptimize := ctx.ModuleForTests("atestNoOptimize", "android_common").MaybeRule("d8")
+	if atestNoOptimize.Output == nil {
+		t.Errorf("atestNoOptimize should not optimize APK")
+	}
+
+	atestDefault := ctx.ModuleForTests("atestDefault", "android_common").MaybeRule("r8")
+	if atestDefault.Output == nil {
+		t.Errorf("atestDefault should optimize APK")
+	}
+}
+
+func TestResources(t *testing.T) {
+	var table = []struct {
+		name  string
+		prop  string
+		extra string
+		args  string
+	}{
+		{
+			// Test that a module with java_resource_dirs includes the files
+			name: "resource dirs",
+			prop: `java_resource_dirs: ["java-res"]`,
+			args: "-C java-res -f java-res/a/a -f java-res/b/b",
+		},
+		{
+			// Test that a module with java_resources includes the files
+			name: "resource files",
+			prop: `java_resources: ["java-res/a/a", "java-res/b/b"]`,
+			args: "-C . -f java-res/a/a -f java-res/b/b",
+		},
+		{
+			// Test that a module with a filegroup in java_resources includes the files with the
+			// path prefix
+			name: "resource filegroup",
+			prop: `java_resources: [":foo-res"]`,
+			extra: `
+				filegroup {
+					name: "foo-res",
+					path: "java-res",
+					srcs: ["java-res/a/a", "java-res/b/b"],
+				}`,
+			args: "-C java-res -f java-res/a/a -f java-res/b/b",
+		},
+		{
+			// Test that exclude_java_resources and the default resource excludes apply to the files of
+			// a filegroup in java_resources
+			name: "resource filegroup with exclude",
+			prop: `java_resources: [":foo-res"], exclude_java_resources: ["java-res/b/b"]`,
+			extra: `
+				filegroup {
+					name: "foo-res",
+					path: "java-res",
+					srcs: ["java-res/**/*"],
+				}`,
+			args: "-C java-res -f java-res/a/a",
+		},
+		{
+			// Test that a module with a genrule in java_resources includes the outputs
+			name: "resource genrule",
+			prop: `java_resources: [":foo-gen"]`,
+			extra: `
+				genrule {
+					name: "foo-gen",
+					cmd: "touch $(out)",
+					out: ["res/config/foo.xml"],
+				}`,
+			args: "-C " + buildDir + "/.intermediates/foo-gen/gen" +
+				" -f " + buildDir + "/.intermediates/foo-gen/gen/res/config/foo.xml",
+		},
+		{
+			// Test that java_resource_strip_prefix strips the prefix from the outputs of modules
+			// but not from source files
+			name: "resource genrule with strip prefix",
+			prop: `java_resources: [":foo-gen", "java-res/a/a"], java_resource_strip_prefix: "res"`,
+			extra: `
+				genrule {
+					name: "foo-gen",
+					cmd: "touch $(out)",
+					out: ["res/config/foo.xml"],
+				}`,
+			args: "-C " + buildDir + "/.intermediates/foo-gen/gen/res" +
+				" -f " + buildDir + "/.intermediates/foo-gen/gen/res/config/foo.xml" +
+				" -C . -f java-res/a/a",
+		},
+		{
+			// Test that a module with a filegroup in java_resource_dirs includes the files relative to
+			// the path of the filegroup, without the excluded files
+			name: "resource dirs filegroup",
+			prop: `java_resource_dirs: [":foo-res"], exclude_java_resources: ["java-res/b/b"]`,
+			extra: `
+				filegroup {
+					name: "foo-res",
+					path: "java-res",
+					srcs: ["java-res/**/*"],
+				}`,
+			args: "-C java-res -f java-res/a/a",
+		},
+		{
+			// Test that a module with wildcards in java_resource_dirs has the correct path prefixes
+			name: "wildcard dirs",
+			prop: `java_resource_dirs: ["java-res/*"]`,
+			args: "-C java-res/a -f java-res/a/a -C java-res/b -f java-res/b/b",
+		},
+		{
+			// Test that a module exclude_java_resource_dirs excludes the files
+			name: "wildcard dirs",
+			prop: `java_resource_dirs: ["java-res/*"], exclude_java_resource_dirs: ["java-res/b"]`,
+			args: "-C java-res/a -f java-res/a/a",
+		},
+		{
+			// Test wildcards in java_resources
+			name: "wildcard files",
+			prop: `java_resources: ["java-res/**/*"]`,
+			args: "-C . -f java-res/a/a -f java-res/b/b",
+		},
+		{
+			// Test exclude_java_resources with java_resources
+			name: "wildcard files with exclude",
+			prop: `java_resources: ["java-res/**/*"], exclude_java_resources: ["java-res/b/*"]`,
+			args: "-C . -f java-res/a/a",
+		},
+		{
+			// Test exclude_java_resources with java_resource_dirs
+			name: "resource dirs with exclude files",
+			prop: `java_resource_dirs: ["java-res"], exclude_java_resources: ["java-res/b/b"]`,
+			args: "-C java-res -f java-res/a/a",
+		},
+		{
+			// Test exclude_java_resource_dirs with java_resource_dirs
+			name: "resource dirs with exclude files",
+			prop: `java_resource_dirs: ["java-res", "java-res2"], exclude_java_resource_dirs: ["java-res2"]`,
+			args: "-C java-res -f java-res/a/a -f java-res/b/b",
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, _ := testJavaWithFS(t, `
+				java_library {
+					name: "foo",
+					srcs: [
+						"a.java",
+						"b.java",
+						"c.java",
+					],
+					`+test.prop+`,
+				}
+			`+test.extra,
+				map[string][]byte{
+					"java-res/a/a":    nil,
+					"java-res/b/b":    nil,
+					"java-res/a.java": nil,
+					"java-res2/a":     nil,
+				},
+			)
+
+			foo := ctx.ModuleForTests("foo", "android_common").Output("withres/foo.jar")
+			fooRes := ctx.ModuleForTests("foo", "android_common").Output("res/foo.jar")
+
+			if !inList(fooRes.Output.String(), foo.Inputs.Strings()) {
+				t.Errorf("foo combined jars %v does not contain %q",
+					foo.Inputs.Strings(), fooRes.Output.String())
+			}
+
+			if fooRes.Args["jarArgs"] != test.args {
+				t.Errorf("foo resource jar args %q is not %q",
+					fooRes.Args["jarArgs"], test.args)
+			}
+		})
+	}
+}
+
+func TestResourceStripPrefixError(t *testing.T) {
+	testJavaError(t, `java_resource_strip_prefix: output "config/foo.xml" of ":foo-gen" does not start with "res/"`, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			java_resources: [":foo-gen"],
+			java_resource_strip_prefix: "res",
+		}
+
+		genrule {
+			name: "foo-gen",
+			cmd: "touch $(out)",
+			out: ["config/foo.xml"],
+		}
+	`)
+}
+
+func TestAidl(t *testing.T) {
+	ctx, _ := testJavaWithFS(t, `
+		java_library {
+			name: "foo",
+			srcs: [
+				"a.java",
+				"aidl/foo/IFoo.aidl",
+			],
+			aidl: {
+				include_dirs: ["frameworks/base/core/aidl"],
+				local_include_dirs: ["aidl"],
+			},
+		}
+	`, map[string][]byte{
+		"aidl/foo/IFoo.aidl":                     nil,
+		"frameworks/base/core/aidl/IBinder.aidl": nil,
+	})
+
+	foo := ctx.ModuleForTests("foo", "android_common")
+	aidl := foo.Rule("aidl")
+
+	if g, w := aidl.Implicits.Strings(), "aidl/foo/IFoo.aidl"; !inList(w, g) {
+		t.Errorf("aidl inputs %q do not contain %q", g, w)
+	}
+
+	for _, w := range []string{"-Iaidl", "-Iframeworks/base/core/aidl"} {
+		if !strings.Contains(aidl.RuleParams.Command, w) {
+			t.Errorf("expected aidl command to contain %q, got %q", w, aidl.RuleParams.Command)
+		}
+	}
+
+	// Test that the generated java files are compiled
+	javac := foo.Rule("javac")
+	if g, w := javac.Implicits.Strings(), aidl.Output.String(); !inList(w, g) {
+		t.Errorf("javac implicits %q do not contain the aidl srcjar %q", g, w)
+	}
+}
+
+func TestRenderscript(t *testing.T) {
+	bp := cc.GatherRequiredDepsForTest(android.Android)
+	for _, lib := range []string{"libRSSupport", "libRSSupportIO", "librsjni", "libblasV8"} {
+		bp += `
+			cc_library {
+				name: "` + lib + `",
+				system_shared_libs: [],
+				stl: "none",
+			}
+		`
+	}
+	bp += `
+		java_library {
+			name: "android-support-v8-renderscript",
+			srcs: ["d.java"],
+			sdk_version: "current",
+		}
+	`
+	ctx, _ := testJava(t, bp+`
+
+		android_app {
+			name: "foo",
+			srcs: [
+				"a.java",
+				"b.rs",
+				"c.fs",
+			],
+			platform_apis: true,
+			renderscript: {
+				target_api: "21",
+				flags: ["-O3"],
+				compat_lib: true,
+			},
+		}
+	`)
+
+	foo := ctx.ModuleForTests("foo", "android_common")
+	rs := foo.Rule("renderscript")
+
+	for _, w := range []string{"b.rs", "c.fs"} {
+		if g := rs.Implicits.Strings(); !inList(w, g) {
+			t.Errorf("renderscript inputs %q do not contain %q", g, w)
+		}
+	}
+
+	for _, w := range []string{"-target-api 21", "-O3", "-rs-package-name=android.support.v8.renderscript"} {
+		if !strings.Contains(rs.RuleParams.Command, w) {
+			t.Errorf("expected renderscript command to contain %q, got %q", w, rs.RuleParams.Command)
+		}
+	}
+
+	// Test that the generated java files are compiled
+	srcJar := foo.Output("rs/rs.srcjar")
+	javac := foo.Rule("javac")
+	if g, w := javac.Implicits.Strings(), srcJar.Output.String(); !inList(w, g) {
+		t.Errorf("javac implicits %q do not contain the renderscript srcjar %q", g, w)
+	}
+
+	// Test that the bitcode is compiled into the Android resources in raw/
+	resZip := foo.Output("rs/rs-res.zip")
+	resDir := filepath.Join(filepath.Dir(resZip.Output.String()), "rs.tmp", "res")
+	if w := "-C " + resDir + " -D " + filepath.Join(resDir, "raw"); !strings.Contains(rs.RuleParams.Command, w) {
+		t.Errorf("expected renderscript command to contain %q, got %q", w, rs.RuleParams.Command)
+	}
+	if g, w := foo.Output("reszip.0.flata").Input.String(), resZip.Output.String(); g != w {
+		t.Errorf("expected aapt2 to compile the renderscript resources %q, got %q", w, g)
+	}
+
+	// Test that the app embeds the support library and its JNI libraries
+	if g, w := javac.Args["classpath"], "android-support-v8-renderscript"; !strings.Contains(g, w) {
+		t.Errorf("expected javac classpath to contain %q, got %q", w, g)
+	}
+	var jniLibs []string
+	for _, lib := range foo.Module().(*AndroidApp).jniLibs {
+		jniLibs = append(jniLibs, lib.name)
+	}
+	expectedJniLibs := []string{"libRSSupport", "libRSSupportIO", "libblasV8", "librsjni"}
+	if !reflect.DeepEqual(android.SortedUniqueStrings(jniLibs), expectedJniLibs) {
+		t.Errorf("expected JNI libraries %q, got %q", expectedJniLibs, jniLibs)
+	}
+
+	testJavaError(t, `renderscript.compat_lib: requires renderscript.target_api or sdk_version 11 or later`, bp+`
+		android_library {
+			name: "foo",
+			srcs: ["b.rs"],
+			platform_apis: true,
+			renderscript: {
+				compat_lib: true,
+			},
+		}
+	`)
+
+	testJavaError(t, `srcs: renderscript sources are only supported for android_app and android_library modules`, `
+		java_library {
+			name: "foo",
+			srcs: ["b.rs"],
+		}
+	`)
+}
+
+func TestLogtags(t *testing.T) {
+	ctx, _ := testJava(t, `
+		java_library {
+			name: "foo",
+			srcs: [
+				"a.java",
+				"b.logtags",
+			],
+		}
+
+		java_library {
+			name: "bar",
+			srcs: [
+				"c.java",
+				"d.logtags",
+			],
+		}
+	`)
+
+	foo := ctx.ModuleForTests("foo", "android_common")
+	logtags := foo.Rule("logtags")
+	if g, w := logtags.Input.String(), "b.logtags"; g != w {
+		t.Errorf("expected logtags input %q, got %q", w, g)
+	}
+
+	// Test that the generated java files are compiled
+	javac := foo.Rule("javac")
+	if g, w := javac.Inputs.Strings(), logtags.Output.String(); !inList(w, g) {
+		t.Errorf("javac inputs %q do not contain the generated logtags source %q", g, w)
+	}
+
+	// Test that the logtags of all modules are merged
+	merged := ctx.SingletonForTests("logtags").Output("all-event-log-tags.txt")
+	if g, w := merged.Inputs.Strings(), []string{"b.logtags", "d.logtags"}; !reflect.DeepEqual(android.SortedUniqueStrings(g), w) {
+		t.Errorf("expected merged logtags inputs %q, got %q", w, g)
+	}
+}
+
+func TestIncludeSrcs(t *testing.T) {
+	ctx, _ := testJavaWithFS(t, `
+		java_library {
+			name: "foo",
+			srcs: [
+				"a.java",
+				"b.java",
+				"c.java",
+			],
+			include_srcs: true,
+		}
+
+		java_library {
+			name: "bar",
+			srcs: [
+				"a.java",
+				"b.java",
+				"c.java",
+			],
+			java_resource_dirs: ["java-res"],
+			include_srcs: true,
+		}
+	`, map[string][]byte{
+		"java-res/a/a": nil,
+		"java-res/b/b": nil,
+		"java-res2/a":  nil,
+	})
+
+	// Test a library with include_srcs: true
+	foo := ctx.ModuleForTests("foo", "android_common").Output("withres/foo.jar")
+	fooSrcJar := ctx.ModuleForTests("foo", "android_common").Output("foo.srcjar")
+
+	if g, w := fooSrcJar.Output.String(), foo.Inputs.Strings(); !inList(g, w) {
+		t.Errorf("foo combined jars %v does not contain %q", w, g)
+	}
+
+	if g, w := fooSrcJar.Args["jarArgs"], "-C . -f a.java -f b.java -f c.java"; g != w {
+		t.Errorf("foo source jar args %q is not %q", w, g)
+	}
+
+	// Test a library with include_srcs: true and resources
+	bar := ctx.ModuleForTests("bar", "android_common").Output("withres/bar.jar")
+	barResCombined := ctx.ModuleForTests("bar", "android_common").Output("res-combined/bar.jar")
+	barRes := ctx.ModuleForTests("bar", "android_common").Output("res/bar.jar")
+	barSrcJar := ctx.ModuleForTests("bar", "android_common").Output("bar.srcjar")
+
+	if g, w := barSrcJar.Output.String(), barResCombined.Inputs.Strings(); !inList(g, w) {
+		t.Errorf("bar combined resource jars %v does not contain %q", w, g)
+	}
+
+	if g, w := barRes.Output.String(), barResCombined.Inputs.Strings(); !inList(g, w) {
+		t.Errorf("bar combined resource jars %v does not contain %q", w, g)
+	}
+
+	if g, w := barResCombined.Output.String(), bar.Inputs.Strings(); !inList(g, w) {
+		t.Errorf("bar combined jars %v does not contain %q", w, g)
+	}
+
+	if g, w := barSrcJar.Args["jarArgs"], "-C . -f a.java -f b.java -f c.java"; g != w {
+		t.Errorf("bar source jar args %q is not %q", w, g)
+	}
+
+	if g, w := barRes.Args["jarArgs"], "-C java-res -f java-res/a/a -f java-res/b/b"; g != w {
+		t.Errorf("bar resource jar args %q is not %q", w, g)
+	}
+}
+
+func TestGeneratedSources(t *testing.T) {
+	ctx, _ := testJavaWithFS(t, `
+		java_library {
+			name: "foo",
+			srcs: [
+				"a*.java",
+				":gen",
+				"b*.java",
+			],
+		}
+
+		genrule {
+			name: "gen",
+			tool_files: ["java-res/a"],
+			out: ["gen.java"],
+		}
+	`, map[string][]byte{
+		"a.java": nil,
+		"b.java": nil,
+	})
+
+	javac := ctx.ModuleForTests("foo", "android_common").Rule("javac")
+	genrule := ctx.ModuleForTests("gen", "").Rule("generator")
+
+	if filepath.Base(genrule.Output.String()) != "gen.java" {
+		t.Fatalf(`gen output file %v is not ".../gen.java"`, genrule.Output.String())
+	}
+
+	if len(javac.Inputs) != 3 ||
+		javac.Inputs[0].String() != "a.java" ||
+		javac.Inputs[1].String() != genrule.Output.String() ||
+		javac.Inputs[2].String() != "b.java" {
+		t.Errorf(`foo inputs %v != ["a.java", ".../gen.java", "b.java"]`, javac.Inputs)
+	}
+}
+
+func TestTurbine(t *testing.T) {
+	ctx, _ := testJava(t, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			sdk_version: "14",
+		}
+
+		java_library {
+			name: "bar",
+			srcs: ["b.java"],
+			static_libs: ["foo"],
+			sdk_version: "14",
+		}
+
+		java_library {
+			name: "baz",
+			srcs: ["c.java"],
+			libs: ["bar"],
+			sdk_version: "14",
+		}
+		`)
+
+	fooTurbine := ctx.ModuleForTests("foo", "android_common").Rule("turbine")
+	barTurbine := ctx.ModuleForTests("bar", "android_common").Rule("turbine")
+	barJavac := ctx.ModuleForTests("bar", "android_common").Rule("javac")
+	barTurbineCombined := ctx.ModuleForTests("bar", "android_common").Description("for turbine")
+	bazJavac := ctx.ModuleForTests("baz", "android_common").Rule("javac")
+
+	if len(fooTurbine.Inputs) != 1 || fooTurbine.Inputs[0].String() != "a.java" {
+		t.Errorf(`foo inputs %v != ["a.java"]`, fooTurbine.Inputs)
+	}
+
+	fooHeaderJar := filepath.Join(buildDir, ".intermediates", "foo", "android_common", "turbine-combined", "foo.jar")
+	if !strings.Contains(barTurbine.Args["classpath"], fooHeaderJar) {
+		t.Errorf("bar turbine classpath %v does not contain %q", barTurbine.Args["classpath"], fooHeaderJar)
+	}
+	if !strings.Contains(barJavac.Args["classpath"], fooHeaderJar) {
+		t.Errorf("bar javac classpath %v does not contain %q", barJavac.Args["classpath"], fooHeaderJar)
+	}
+	if len(barTurbineCombined.Inputs) != 2 || barTurbineCombined.Inputs[1].String() != fooHeaderJar {
+		t.Errorf("bar turbine combineJar inputs %v does not contain %q", barTurbineCombined.Inputs, fooHeaderJar)
+	}
+	if !strings.Contains(bazJavac.Args["classpath"], "prebuilts/sdk/14/public/android.jar") {
+		t.Errorf("baz javac classpath %v does not contain %q", bazJavac.Args["classpath"],
+			"prebuilts/sdk/14/public/android.jar")
+	}
+}
+
+func TestTurbineCompileAvoidance(t *testing.T) {
+	ctx, _ := testJava(t, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+		}
+
+		java_library {
+			name: "bar",
+			srcs: ["b.java"],
+			libs: ["foo"],
+		}
+		`)
+
+	foo := ctx.ModuleForTests("foo", "android_common")
+	fooTurbine := foo.Rule("turbine")
+	fooJavac := foo.Rule("javac")
+	barJavac := ctx.ModuleForTests("bar", "android_common").Rule("javac")
+
+	// The header jar is only rewritten when the API of foo changes, so that implementation-only
+	// changes to foo don't recompile bar.
+	if !fooTurbine.RuleParams.Restat {
+		t.Errorf("expected turbine rule to use restat")
+	}
+
+	fooHeaderJar := filepath.Join(buildDir, ".intermediates", "foo", "android_common", "turbine-combined", "foo.jar")
+	if !inList(fooHeaderJar, barJavac.Implicits.Strings()) {
+		t.Errorf("expected foo header jar %q in bar javac inputs %q", fooHeaderJar, barJavac.Implicits.Strings())
+	}
+	if fooClasses := fooJavac.Output.String(); strings.Contains(barJavac.Args["classpath"], fooClasses) ||
+		inList(fooClasses, barJavac.Implicits.Strings()) {
+		t.Errorf("expected foo classes jar %q not to be an input of bar javac", fooClasses)
+	}
+}
+
+func TestSharding(t *testing.T) {
+	ctx, _ := testJava(t, `
+		java_library {
+			name: "bar",
+			srcs: ["a.java","b.java","c.java"],
+			javac_shard_size: 1
+		}
+		`)
+
+	bar := ctx.ModuleForTests("bar", "android_common")
+	barHeaderJar := filepath.Join(buildDir, ".intermediates", "bar", "android_common", "turbine-combined", "bar.jar")
+	var shardJars []string
+	for i := 0; i < 3; i++ {
+		barJavac := bar.Description("javac" + strconv.Itoa(i))
+		if !strings.Contains(barJavac.Args["classpath"], barHeaderJar) {
+			t.Errorf("bar javac classpath %v does not contain %q", barJavac.Args["classpath"], barHeaderJar)
+		}
+		if len(barJavac.Inputs) != 1 {
+			t.Errorf("expected one source in shard %d, got %q", i, barJavac.Inputs.Strings())
+		}
+		shardJars = append(shardJars, barJavac.Output.String())
+	}
+
+	// The classes of the shards are merged.
+	combined := bar.Description("for javac")
+	if !reflect.DeepEqual(combined.Inputs.Strings(), shardJars) {
+		t.Errorf("expected the classes of the shards %q to be merged, got %q", shardJars, combined.Inputs.Strings())
+	}
+}
+
+func TestDroiddoc(t *testing.T) {
+	ctx, _ := testJavaWithFS(t, `
+		droiddoc_exported_dir {
+		    name: "droiddoc-templates-sdk",
+		    path: ".",
+		}
+		filegroup {
+		    name: "bar-doc-aidl-srcs",
+		    srcs: ["bar-doc/IBar.aidl"],
+		    path: "bar-doc",
+		}
+		droiddoc {
+		    name: "bar-doc",
+		    srcs: [
+		        "bar-doc/a.java",
+		        "bar-doc/IFoo.aidl",
+		        ":bar-doc-aidl-srcs",
+		    ],
+		    exclude_srcs: [
+		        "bar-doc/b.java"
+		    ],
+		    custom_template: "droiddoc-templates-sdk",
+		    hdf: [
+		        "android.whichdoc offline",
+		    ],
+		    knowntags: [
+		        "bar-doc/known_oj_tags.txt",
+		    ],
+		    proofread_file: "libcore-proofread.txt",
+		    todo_file: "libcore-docs-todo.html",
+		    args: "-offlinemode -title \"libcore\"",
+		}
+		`,
+		map[string][]byte{
+			"bar-doc/a.java": nil,
+			"bar-doc/b.java": nil,
+		})
+
+	barDoc := ctx.ModuleForTests("bar-doc", "android_common").Rule("javadoc")
+	var javaSrcs []string
+	for _, i := range barDoc.Inputs {
+		javaSrcs = append(javaSrcs, i.Base())
+	}
+	if len(javaSrcs) != 1 || javaSrcs[0] != "a.java" {
+		t.Errorf("inputs of bar-doc must be []string{\"a.java\"}, but was %#v.", javaSrcs)
+	}
+
+	aidl := ctx.ModuleForTests("bar-doc", "android_common").Rule("aidl")
+	if g, w := barDoc.Implicits.Strings(), aidl.Output.String(); !inList(w, g) {
+		t.Errorf("implicits of bar-doc must contain %q, but was %q.", w, g)
+	}
+
+	if g, w := aidl.Implicits.Strings(), []string{"bar-doc/IBar.aidl", "bar-doc/IFoo.aidl"}; !reflect.DeepEqual(w, g) {
+		t.Errorf("aidl inputs must be %q, but was %q", w, g)
+	}
+}
+
+func TestDroiddocOutputs(t *testing.T) {
+	ctx, _ := testJava(t, `
+		droiddoc_exported_dir {
+			name: "droiddoc-templates-sdk",
+			path: ".",
+		}
+		droiddoc {
+			name: "foo-doc",
+			srcs: ["a.java"],
+			custom_template: "droiddoc-templates-sdk",
+		}
+		javadoc {
+			name: "bar-doc",
+			srcs: ["b.java"],
+		}
+		java_library {
+			name: "foo",
+			srcs: [":foo-doc"],
+		}
+		`)
+
+	fooDoc := ctx.ModuleForTests("foo-doc", "android_common").Module().(*Droiddoc)
+	barDoc := ctx.ModuleForTests("bar-doc", "android_common").Module().(*Javadoc)
+	foo := ctx.ModuleForTests("foo", "android_common").Module().(*Library)
+
+	// The stubs sources generated by droiddoc can be compiled by another module.
+	if g, w := foo.compiledSrcJars.Strings(), fooDoc.stubsSrcJar.String(); !inList(w, g) {
+		t.Errorf("expected the stubs sources %q in the source jars of foo, got %q", w, g)
+	}
+
+	// Both droiddoc and javadoc generate docs.
+	for _, m := range []android.OutputFileProducer{fooDoc, barDoc} {
+		docs, err := m.OutputFiles(".docs.zip")
+		if err != nil || len(docs) != 1 || !strings.HasSuffix(docs[0].String(), "-docs.zip") {
+			t.Errorf("expected a docs zip, got %q, %v", docs, err)
+		}
+	}
+
+	testJavaError(t, "javadoc modules do not generate stubs sources", `
+		javadoc {
+			name: "bar-doc",
+			srcs: ["b.java"],
+		}
+		java_library {
+			name: "bar",
+			srcs: [":bar-doc"],
+		}
+		`)
+}
+
+func TestDroidstubs(t *testing.T) {
+	ctx, _ := testJavaWithFS(t, `
+		droiddoc_exported_dir {
+		    name: "droiddoc-templates-sdk",
+		    path: ".",
+		}
+
+		droidstubs {
+		    name: "bar-stubs",
+		    srcs: [
+		        "bar-doc/a.java",
+				],
+				api_levels_annotations_dirs: [
+					"droiddoc-templates-sdk",
+				],
+				api_levels_annotations_enabled: true,
+		}
+
+		droidstubs {
+		    name: "bar-stubs-other",
+		    srcs: [
+		        "bar-doc/a.java",
+				],
+				api_levels_annotations_dirs: [
+					"droiddoc-templates-sdk",
+				],
+				api_levels_annotations_enabled: true,
+				api_levels_jar_filename: "android.other.jar",
+		}
+		`,
+		map[string][]byte{
+			"bar-doc/a.java": nil,
+		})
+	testcases := []struct {
+		moduleName          string
+		expectedJarFilename string
+	}{
+		{
+			moduleName:          "bar-stubs",
+			expectedJarFilename: "android.jar",
+		},
+		{
+			moduleName:          "bar-stubs-other",
+			expectedJarFilename: "android.other.jar",
+		},
+	}
+	for _, c := range testcases {
+		m := ctx.ModuleForTests(c.moduleName, "android_common")
+		metalava := m.Rule("metalava")
+		expected := "--android-jar-pattern ./%/public/" + c.expectedJarFilename
+		if actual := metalava.RuleParams.Command; !strings.Contains(actual, expected) {
+			t.Errorf("For %q, expected metalava argument %q, but was not found %q", c.moduleName, expected, actual)
+		}
+	}
+}
+
+func TestDroidstubsApiVersions(t *testing.T) {
+	config := testConfig(nil, `
+		droiddoc_exported_dir {
+			name: "sdk-dir",
+			path: ".",
+		}
+
+		droidstubs {
+			name: "framework-doc-stubs",
+			srcs: ["bar-doc/a.java"],
+			annotations_enabled: true,
+			api_levels_annotations_dirs: ["sdk-dir"],
+			api_levels_annotations_enabled: true,
+		}
+		`, map[string][]byte{
+		"bar-doc/a.java": nil,
+	})
+
+	ctx := testContext()
+	ctx.RegisterSingletonType("lint", func() android.Singleton { return &lintSingleton{} })
+	run(t, ctx, config)
+
+	m := ctx.ModuleForTests("framework-doc-stubs", "android_common")
+	metalava := m.Rule("metalava")
+	apiVersions := m.Output("api-versions.xml").Output
+	for _, expected := range []string{
+		"--generate-api-levels " + apiVersions.String(),
+		"--current-version " + config.PlatformSdkVersion(),
+		"--android-jar-pattern ./%/public/android.jar",
+	} {
+		if !strings.Contains(metalava.RuleParams.Command, expected) {
+			t.Errorf("expected %q in metalava command %q", expected, metalava.RuleParams.Command)
+		}
+	}
+
+	// The API level database is copied for lint's NewApi check.
+	lintApiVersions := ctx.SingletonForTests("lint").Output("lint/api_versions.xml")
+	if lintApiVersions.Input.String() != apiVersions.String() {
+		t.Errorf("expected lint to use the API level database %q, got %q", apiVersions.String(), lintApiVersions.Input.String())
+	}
+}
+
+func TestDroidstubsApiVersionsNotEnabled(t *testing.T) {
+	testJavaError(t, `the API level database is only generated with api_levels_annotations_enabled: true`, `
+		droidstubs {
+			name: "foo-stubs",
+			srcs: ["a.java"],
+		}
+
+		genrule {
+			name: "gen",
+			srcs: [":foo-stubs{.api_versions.xml}"],
+			out: ["api-versions.xml"],
+			cmd: "cp $(in) $(out)",
+		}
+		`)
+}
+
+func TestDroidstubsCheckApi(t *testing.T) {
+	ctx, _ := testJavaWithFS(t, `
+		droidstubs {
+			name: "foo-stubs",
+			srcs: ["foo/a.java"],
+			check_api: {
+				current: {
+					api_file: "api/current.txt",
+					removed_api_file: "api/removed.txt",
+				},
+				api_lint: {
+					enabled: true,
+					baseline_file: "api/lint-baseline.txt",
+				},
+			},
+		}
+		`,
+		map[string][]byte{
+			"foo/a.java":            nil,
+			"api/current.txt":       nil,
+			"api/removed.txt":       nil,
+			"api/lint-baseline.txt": nil,
+		})
+
+	m := ctx.ModuleForTests("foo-stubs", "android_common")
+
+	metalava := m.Description("metalava merged")
+	for _, w := range []string{
+		"--api-lint",
+		"--baseline:api-lint api/lint-baseline.txt",
+		"--update-baseline:api-lint " + m.Output("api_lint_baseline.txt").Output.String(),
+	} {
+		if !strings.Contains(metalava.RuleParams.Command, w) {
+			t.Errorf("expected %q in the metalava command %q", w, metalava.RuleParams.Command)
+		}
+	}
+
+	apiFile := m.Output("foo-stubs_api.txt").Output.String()
+	removedApiFile := m.Output("foo-stubs_removed.txt").Output.String()
+
+	check := m.Description("check current API")
+	for _, w := range []string{"api/current.txt " + apiFile, "api/removed.txt " + removedApiFile} {
+		if !strings.Contains(check.RuleParams.Command, w) {
+			t.Errorf("expected the API check to diff %q, got %q", w, check.RuleParams.Command)
+		}
+	}
+	if !strings.Contains(check.RuleParams.Command, "make foo-stubs-update-current-api") {
+		t.Errorf("expected the API check to point to the update rule, got %q", check.RuleParams.Command)
+	}
+
+	update := m.Description("update current API")
+	for _, w := range []string{"cp -f " + apiFile + " api/current.txt", "cp -f " + removedApiFile + " api/removed.txt"} {
+		if !strings.Contains(update.RuleParams.Command, w) {
+			t.Errorf("expected %q in the API update command %q", w, update.RuleParams.Command)
+		}
+	}
+}
+
+func TestDroidstubsUpdateApiLintBaseline(t *testing.T) {
+	bp := `
+		droidstubs {
+			name: "foo-stubs",
+			srcs: ["foo/a.java"],
+			check_api: {
+				api_lint: {
+					enabled: true,
+					baseline_file: "api/lint-baseline.txt",
+				},
+			},
+		}
+	`
+	fs := map[string][]byte{
+		"foo/a.java":            nil,
+		"api/lint-baseline.txt": nil,
+	}
+
+	ctx, _ := testJavaWithConfig(t, testConfig(nil, bp, fs))
+	m := ctx.ModuleForTests("foo-stubs", "android_common")
+	updatedBaseline := m.Output("api_lint_baseline.txt").Output.String()
+
+	metalava := m.Description("metalava merged")
+	if strings.Contains(metalava.RuleParams.Command, "--pass-baseline-updates") {
+		t.Errorf("expected new API lint issues to fail the build, got %q", metalava.RuleParams.Command)
+	}
+	if w := "UPDATE_API_LINT_BASELINES=true m foo-stubs-update-api-lint-baseline"; !strings.Contains(metalava.RuleParams.Command, w) {
+		t.Errorf("expected the API lint error message to point to the update rule, got %q", metalava.RuleParams.Command)
+	}
+
+	update := m.Output("update_api_lint_baseline.timestamp")
+	if w := "cp -f " + updatedBaseline + " api/lint-baseline.txt"; !strings.Contains(update.RuleParams.Command, w) {
+		t.Errorf("expected %q in the baseline update command %q", w, update.RuleParams.Command)
+	}
+
+	ctx, _ = testJavaWithConfig(t, testConfig(map[string]string{"UPDATE_API_LINT_BASELINES": "true"}, bp, fs))
+	metalava = ctx.ModuleForTests("foo-stubs", "android_common").Description("metalava merged")
+	if !strings.Contains(metalava.RuleParams.Command, "--pass-baseline-updates") {
+		t.Errorf("expected the API lint issues to be recorded in the baseline, got %q", metalava.RuleParams.Command)
+	}
+}
+
+func TestDroidstubsNullability(t *testing.T) {
+	ctx, config := testJavaWithFS(t, `
+		droidstubs {
+			name: "foo-stubs",
+			srcs: ["foo/a.java"],
+			annotations_enabled: true,
+			previous_api: "api/previous.txt",
+			validate_nullability_from_list: "api/nullability.txt",
+			check_nullability_warnings: "api/nullability_warnings.txt",
+		}
+		`, map[string][]byte{
+		"foo/a.java":                   nil,
+		"api/previous.txt":             nil,
+		"api/nullability.txt":          nil,
+		"api/nullability_warnings.txt": nil,
+	})
+
+	m := ctx.ModuleForTests("foo-stubs", "android_common")
+	metalava := m.Rule("metalava")
+	annotationsZip := m.Output("foo-stubs_annotations.zip").Output
+	nullabilityWarnings := m.Output("foo-stubs_nullability_warnings.txt").Output
+	for _, expected := range []string{
+		"--include-annotations",
+		"--migrate-nullness api/previous.txt",
+		"--validate-nullability-from-list api/nullability.txt",
+		"--nullability-warnings-txt " + nullabilityWarnings.String(),
+		"--extract-annotations " + annotationsZip.String(),
+	} {
+		if !strings.Contains(metalava.RuleParams.Command, expected) {
+			t.Errorf("expected %q in metalava command %q", expected, metalava.RuleParams.Command)
+		}
+	}
+
+	// The warnings of the validation are compared to the checked in list of expected warnings.
+	check := m.Description("nullability warnings check")
+	if expected := "diff " + nullabilityWarnings.String() + " api/nullability_warnings.txt"; !strings.Contains(check.RuleParams.Command, expected) {
+		t.Errorf("expected %q in nullability warnings check %q", expected, check.RuleParams.Command)
+	}
+
+	// The extracted annotations are available to other modules and to make.
+	stubs := ctx.ModuleForTests("foo-stubs", "android_common").Module().(*Droidstubs)
+	outputs, err := stubs.OutputFiles(".annotations.zip")
+	if err != nil || len(outputs) != 1 || outputs[0].String() != annotationsZip.String() {
+		t.Errorf("expected annotations zip output %q, got %q, %v", annotationsZip, outputs, err)
+	}
+	entries := android.AndroidMkEntriesForTest(t, config, "", stubs)[0]
+	if actual := entries.EntryMap["LOCAL_DROIDDOC_ANNOTATIONS_ZIP"]; len(actual) != 1 || actual[0] != annotationsZip.String() {
+		t.Errorf("expected LOCAL_DROIDDOC_ANNOTATIONS_ZIP %q, got %q", annotationsZip, actual)
+	}
+}
+
+func TestDroidstubsCheckNullabilityWarningsWithoutValidation(t *testing.T) {
+	testJavaError(t, `Cannot specify check_nullability_warnings unless validating nullability`, `
+		droidstubs {
+			name: "foo-stubs",
+			srcs: ["a.java"],
+			annotations_enabled: true,
+			check_nullability_warnings: "nullability_warnings.txt",
+		}
+		`)
+}
+
+func TestDroidstubsWithSystemModules(t *testing.T) {
+	ctx, _ := testJava(t, `
+		droidstubs {
+		    name: "stubs-source-system-modules",
+		    srcs: [
+		        "bar-doc/a.java",
+		    ],
+				sdk_version: "none",
+				system_modules: "source-system-modules",
+		}
+
+		java_library {
+				name: "source-jar",
+		    srcs: [
+		        "a.java",
+		    ],
+		}
+
+		java_system_modules {
+				name: "source-system-modules",
+				libs: ["source-jar"],
+		}
+
+		droidstubs {
+		    name: "stubs-prebuilt-system-modules",
+		    srcs: [
+		        "bar-doc/a.java",
+		    ],
+				sdk_version: "none",
+				system_modules: "prebuilt-system-modules",
+		}
+
+		java_import {
+				name: "prebuilt-jar",
+				jars: ["a.jar"],
+		}
+
+		java_system_modules_import {
+				name: "prebuilt-system-modules",
+				libs: ["prebuilt-jar"],
+		}
+		`)
+
+	checkSystemModulesUseByDroidstubs(t, ctx, "stubs-source-system-modules", "source-jar.jar")
+
+	checkSystemModulesUseByDroidstubs(t, ctx, "stubs-prebuilt-system-modules", "prebuilt-jar.jar")
+}
+
+func checkSystemModulesUseByDroidstubs(t *testing.T, ctx *android.TestContext, moduleName string, systemJar string) {
+	metalavaRule := ctx.ModuleForTests(moduleName, "android_common").Rule("metalava")
+	var systemJars []string
+	for _, i := range metalavaRule.Implicits {
+		systemJars = append(systemJars, i.Base())
+	}
+	if len(systemJars) < 1 || systemJars[0] != systemJar {
+		t.Errorf("inputs of %q must be []string{%q}, but was %#v.", moduleName, systemJar, systemJars)
+	}
+}
+
+func TestJarGenrules(t *testing.T) {
+	ctx, _ := testJava(t, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+		}
+
+		java_genrule {
+			name: "jargen",
+			tool_files: ["b.java"],
+			cmd: "$(location b.java) $(in) $(out)",
+			out: ["jargen.jar"],
+			srcs: [":foo"],
+		}
+
+		java_library {
+			name: "bar",
+			static_libs: ["jargen"],
+			srcs: ["c.java"],
+		}
+
+		java_library {
+			name: "baz",
+			libs: ["jargen"],
+			srcs: ["c.java"],
+		}
+	`)
+
+	foo := ctx.ModuleForTests("foo", "android_common").Output("javac/foo.jar")
+	jargen := ctx.ModuleForTests("jargen", "android_common").Output("jargen.jar")
+	bar := ctx.ModuleForTests("bar", "android_common").Output("javac/bar.jar")
+	baz := ctx.ModuleForTests("baz", "android_common").Output("javac/baz.jar")
+	barCombined := ctx.ModuleForTests("bar", "android_common").Output("combined/bar.jar")
+
+	if len(jargen.Inputs) != 1 || jargen.Inputs[0].String() != foo.Output.String() {
+		t.Errorf("expected jargen inputs [%q], got %q", foo.Output.String(), jargen.Inputs.Strings())
+	}
+
+	if !strings.Contains(bar.Args["classpath"], jargen.Output.String()) {
+		t.Errorf("bar classpath %v does not contain %q", bar.Args["classpath"], jargen.Output.String())
+	}
+
+	if !strings.Contains(baz.Args["classpath"], jargen.Output.String()) {
+		t.Errorf("baz classpath %v does not contain %q", baz.Args["classpath"], jargen.Output.String())
+	}
+
+	if len(barCombined.Inputs) != 2 ||
+		barCombined.Inputs[0].String() != bar.Output.String() ||
+		barCombined.Inputs[1].String() != jargen.Output.String() {
+		t.Errorf("bar combined jar inputs %v is not [%q, %q]",
+			barCombined.Inputs.Strings(), bar.Output.String(), jargen.Output.String())
+	}
+}
+
+func TestExcludeFileGroupInSrcs(t *testing.T) {
+	ctx, _ := testJava(t, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java", ":foo-srcs"],
+			exclude_srcs: ["a.java", ":foo-excludes"],
+		}
+
+		filegroup {
+			name: "foo-srcs",
+			srcs: ["java-fg/a.java", "java-fg/b.java", "java-fg/c.java"],
+		}
+
+		filegroup {
+			name: "foo-excludes",
+			srcs: ["java-fg/a.java", "java-fg/b.java"],
+		}
+	`)
+
+	javac := ctx.ModuleForTests("foo", "android_common").Rule("javac")
+
+	if len(javac.Inputs) != 1 || javac.Inputs[0].String() != "java-fg/c.java" {
+		t.Errorf(`foo inputs %v != ["java-fg/c.java"]`, javac.Inputs)
+	}
+}
+
+func TestJavaLibrary(t *testing.T) {
+	config := testConfig(nil, "", map[string][]byte{
+		"libcore/Android.bp": []byte(`
+				java_library {
+						name: "core",
+						sdk_version: "none",
+						system_modules: "none",
+				}`),
+	})
+	ctx := testContext()
+	run(t, ctx, config)
+}
+
+func TestJavaSdkLibrary(t *testing.T) {
+	ctx, _ := testJava(t, `
+		droiddoc_exported_dir {
+			name: "droiddoc-templates-sdk",
+			path: ".",
+		}
+		java_sdk_library {
+			name: "foo",
+			srcs: ["a.java", "b.java"],
+			api_packages: ["foo"],
+		}
+		java_sdk_library {
+			name: "bar",
+			srcs: ["a.java", "b.java"],
+			api_packages: ["bar"],
+		}
+		java_library {
+			name: "baz",
+			srcs: ["c.java"],
+			libs: ["foo", "bar.stubs"],
+			sdk_version: "system_current",
+		}
+		java_sdk_library {
+			name: "barney",
+			srcs: ["c.java"],
+			api_only: true,
+		}
+		java_sdk_library {
+			name: "betty",
+			srcs: ["c.java"],
+			shared_library: false,
+		}
+		java_sdk_library_import {
+		    name: "quuz",
+				public: {
+					jars: ["c.jar"],
+				},
+		}
+		java_sdk_library_import {
+		    name: "fred",
+				public: {
+					jars: ["b.jar"],
+				},
+		}
+		java_sdk_library_import {
+		    name: "wilma",
+				public: {
+					jars: ["b.jar"],
+				},
+				shared_library: false,
+		}
+		java_library {
+		    name: "qux",
+		    srcs: ["c.java"],
+		    libs: ["baz", "fred", "quuz.stubs", "wilma", "barney", "betty"],
+		    sdk_version: "system_current",
+		}
+		java_library {
+			name: "baz-test",
+			srcs: ["c.java"],
+			libs: ["foo"],
+			sdk_version: "test_current",
+		}
+		java_library {
+			name: "baz-29",
+			srcs: ["c.java"],
+			libs: ["foo"],
+			sdk_version: "system_29",
+		}
+		`)
+
+	// check the existence of the internal modules
+	ctx.ModuleForTests("foo", "android_common")
+	ctx.ModuleForTests(apiScopePublic.stubsLibraryModuleName("foo"), "android_common")
+	ctx.ModuleForTests(apiScopeSystem.stubsLibraryModuleName("foo"), "android_common")
+	ctx.ModuleForTests(apiScopeTest.stubsLibraryModuleName("foo"), "android_common")
+	ctx.ModuleForTests(apiScopePublic.stubsSourceModuleName("foo"), "android_common")
+	ctx.ModuleForTests(apiScopeSystem.stubsSourceModuleName("foo"), "android_common")
+	ctx.ModuleForTests(apiScopeTest.stubsSourceModuleName("foo"), "android_common")
+	ctx.ModuleForTests("foo"+sdkXmlFileSuffix, "android_common")
+	ctx.ModuleForTests("foo.api.public.28", "")
+	ctx.ModuleForTests("foo.api.system.28", "")
+	ctx.ModuleForTests("foo.api.test.28", "")
+
+	bazJavac := ctx.ModuleForTests("baz", "android_common").Rule("javac")
+	// tests if baz is actually linked to the stubs lib
+	if !strings.Contains(bazJavac.Args["classpath"], "foo.stubs.system.jar") {
+		t.Errorf("baz javac classpath %v does not contain %q", bazJavac.Args["classpath"],
+			"foo.stubs.system.jar")
+	}
+	// ... and not to the impl lib
+	if strings.Contains(bazJavac.Args["classpath"], "foo.jar") {
+		t.Errorf("baz javac classpath %v should not contain %q", bazJavac.Args["classpath"],
+			"foo.jar")
+	}
+	// test if baz is not linked to the system variant of foo
+	if strings.Contains(bazJavac.Args["classpath"], "foo.stubs.jar") {
+		t.Errorf("baz javac classpath %v should not contain %q", bazJavac.Args["classpath"],
+			"foo.stubs.jar")
+	}
+
+	bazTestJavac := ctx.ModuleForTests("baz-test", "android_common").Rule("javac")
+	// tests if baz-test is actually linked to the test stubs lib
 	if !strings.Contains(bazTestJavac.Args["classpath"], "foo.stubs.test.jar") {
 		t.Errorf("baz-test javac classpath %v does not contain %q", bazTestJavac.Args["classpath"],
 			"foo.stubs.test.jar")
 	}
 
-	baz29Javac := ctx.ModuleForTests("baz-29", "android_common").Rule("javac")
-	// tests if baz-29 is actually linked to the system 29 stubs lib
-	if !strings.Contains(baz29Javac.Args["classpath"], "prebuilts/sdk/29/system/foo.jar") {
-		t.Errorf("baz-29 javac classpath %v does not contain %q", baz29Javac.Args["classpath"],
-			"prebuilts/sdk/29/system/foo.jar")
+	baz29Javac := ctx.ModuleForTests("baz-29", "android_common").Rule("javac")
+	// tests if baz-29 is actually linked to the system 29 stubs lib
+	if !strings.Contains(baz29Javac.Args["classpath"], "prebuilts/sdk/29/system/foo.jar") {
+		t.Errorf("baz-29 javac classpath %v does not contain %q", baz29Javac.Args["classpath"],
+			"prebuilts/sdk/29/system/foo.jar")
+	}
+
+	// test if baz has exported SDK lib names foo and bar to qux
+	qux := ctx.ModuleForTests("qux", "android_common")
+	if quxLib, ok := qux.Module().(*Library); ok {
+		sdkLibs := quxLib.ExportedSdkLibs()
+		sort.Strings(sdkLibs)
+		if w := []string{"bar", "foo", "fred", "quuz"}; !reflect.DeepEqual(w, sdkLibs) {
+			t.Errorf("qux should export %q but exports %q", w, sdkLibs)
+		}
+	}
+}
+
+func TestJavaSdkLibrary_DoNotAccessImplWhenItIsNotBuilt(t *testing.T) {
+	ctx, _ := testJava(t, `
+		java_sdk_library {
+			name: "foo",
+			srcs: ["a.java"],
+			api_only: true,
+			public: {
+				enabled: true,
+			},
+		}
+
+		java_library {
+			name: "bar",
+			srcs: ["b.java"],
+			libs: ["foo"],
+		}
+		`)
+
+	// The bar library should depend on the stubs jar.
+	barLibrary := ctx.ModuleForTests("bar", "android_common").Rule("javac")
+	if expected, actual := `^-classpath .*:/[^:]*/turbine-combined/foo\.stubs\.jar$`, barLibrary.Args["classpath"]; !regexp.MustCompile(expected).MatchString(actual) {
+		t.Errorf("expected %q, found %#q", expected, actual)
+	}
+}
+
+func TestJavaSdkLibrary_UseSourcesFromAnotherSdkLibrary(t *testing.T) {
+	testJava(t, `
+		java_sdk_library {
+			name: "foo",
+			srcs: ["a.java"],
+			api_packages: ["foo"],
+			public: {
+				enabled: true,
+			},
+		}
+
+		java_library {
+			name: "bar",
+			srcs: ["b.java", ":foo{.public.stubs.source}"],
+		}
+		`)
+}
+
+func TestJavaSdkLibrary_AccessOutputFiles_MissingScope(t *testing.T) {
+	testJavaError(t, `"foo" does not provide api scope system`, `
+		java_sdk_library {
+			name: "foo",
+			srcs: ["a.java"],
+			api_packages: ["foo"],
+			public: {
+				enabled: true,
+			},
+		}
+
+		java_library {
+			name: "bar",
+			srcs: ["b.java", ":foo{.system.stubs.source}"],
+		}
+		`)
+}
+
+func TestJavaSdkLibraryImport_AccessOutputFiles(t *testing.T) {
+	testJava(t, `
+		java_sdk_library_import {
+			name: "foo",
+			public: {
+				jars: ["a.jar"],
+				stub_srcs: ["a.java"],
+				current_api: "api/current.txt",
+				removed_api: "api/removed.txt",
+			},
+		}
+
+		java_library {
+			name: "bar",
+			srcs: [":foo{.public.stubs.source}"],
+			java_resources: [
+				":foo{.public.api.txt}",
+				":foo{.public.removed-api.txt}",
+			],
+		}
+		`)
+}
+
+func TestJavaSdkLibraryImport_AccessOutputFiles_Invalid(t *testing.T) {
+	bp := `
+		java_sdk_library_import {
+			name: "foo",
+			public: {
+				jars: ["a.jar"],
+			},
+		}
+		`
+
+	t.Run("stubs.source", func(t *testing.T) {
+		testJavaError(t, `stubs.source not available for api scope public`, bp+`
+		java_library {
+			name: "bar",
+			srcs: [":foo{.public.stubs.source}"],
+			java_resources: [
+				":foo{.public.api.txt}",
+				":foo{.public.removed-api.txt}",
+			],
+		}
+		`)
+	})
+
+	t.Run("api.txt", func(t *testing.T) {
+		testJavaError(t, `api.txt not available for api scope public`, bp+`
+		java_library {
+			name: "bar",
+			srcs: ["a.java"],
+			java_resources: [
+				":foo{.public.api.txt}",
+			],
+		}
+		`)
+	})
+
+	t.Run("removed-api.txt", func(t *testing.T) {
+		testJavaError(t, `removed-api.txt not available for api scope public`, bp+`
+		java_library {
+			name: "bar",
+			srcs: ["a.java"],
+			java_resources: [
+				":foo{.public.removed-api.txt}",
+			],
+		}
+		`)
+	})
+}
+
+func TestJavaSdkLibrary_InvalidScopes(t *testing.T) {
+	testJavaError(t, `module "foo": enabled api scope "system" depends on disabled scope "public"`, `
+		java_sdk_library {
+			name: "foo",
+			srcs: ["a.java", "b.java"],
+			api_packages: ["foo"],
+			// Explicitly disable public to test the check that ensures the set of enabled
+			// scopes is consistent.
+			public: {
+				enabled: false,
+			},
+			system: {
+				enabled: true,
+			},
+		}
+		`)
+}
+
+func TestJavaSdkLibrary_SdkVersion_ForScope(t *testing.T) {
+	testJava(t, `
+		java_sdk_library {
+			name: "foo",
+			srcs: ["a.java", "b.java"],
+			api_packages: ["foo"],
+			system: {
+				enabled: true,
+				sdk_version: "module_current",
+			},
+		}
+		`)
+}
+
+func TestJavaSdkLibrary_ModuleLib(t *testing.T) {
+	testJava(t, `
+		java_sdk_library {
+			name: "foo",
+			srcs: ["a.java", "b.java"],
+			api_packages: ["foo"],
+			system: {
+				enabled: true,
+			},
+			module_lib: {
+				enabled: true,
+			},
+		}
+		`)
+}
+
+func TestJavaSdkLibrary_SystemServer(t *testing.T) {
+	testJava(t, `
+		java_sdk_library {
+			name: "foo",
+			srcs: ["a.java", "b.java"],
+			api_packages: ["foo"],
+			system: {
+				enabled: true,
+			},
+			system_server: {
+				enabled: true,
+			},
+		}
+		`)
+}
+
+func TestJavaSdkLibrary_XmlPermissionsFile(t *testing.T) {
+	ctx, _ := testJava(t, `
+		java_sdk_library {
+			name: "foo",
+			srcs: ["a.java"],
+			api_packages: ["foo"],
+		}
+
+		java_sdk_library {
+			name: "bar",
+			srcs: ["b.java"],
+			api_packages: ["bar"],
+			soc_specific: true,
+		}
+		`)
+
+	testCases := []struct {
+		module   string
+		expected string
+	}{
+		{module: "foo", expected: `<library name=\"foo\" file=\"/system/framework/foo.jar\"/>`},
+		{module: "bar", expected: `<library name=\"bar\" file=\"/vendor/framework/bar.jar\"/>`},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.module, func(t *testing.T) {
+			xml := ctx.ModuleForTests(test.module+sdkXmlFileSuffix, "android_common").Output(test.module + ".xml")
+			if !strings.Contains(xml.RuleParams.Command, test.expected) {
+				t.Errorf("expected %q in the permissions file, got command %q", test.expected, xml.RuleParams.Command)
+			}
+		})
+	}
+}
+
+func TestJavaSdkLibrary_InstallPaths(t *testing.T) {
+	ctx, _ := testJava(t, `
+		java_sdk_library {
+			name: "foo",
+			srcs: ["a.java"],
+			api_packages: ["foo"],
+		}
+
+		java_sdk_library {
+			name: "bar",
+			srcs: ["b.java"],
+			api_packages: ["bar"],
+			api_only: true,
+		}
+		`)
+
+	foo := ctx.ModuleForTests("foo", "android_common").Module().(*SdkLibrary)
+	if foo.installFile == nil || !strings.HasSuffix(foo.installFile.String(), "/system/framework/foo.jar") {
+		t.Errorf("expected the implementation of foo to be installed to /system/framework/foo.jar, got %v", foo.installFile)
+	}
+
+	xml := ctx.ModuleForTests("foo"+sdkXmlFileSuffix, "android_common").Module().(*sdkLibraryXml)
+	if g, w := xml.installDirPath.String(), "/system/etc/permissions"; !strings.HasSuffix(g, w) {
+		t.Errorf("expected the permissions file of foo to be installed to %q, got %q", w, g)
+	}
+
+	// An api_only library has no implementation to install or permissions file.
+	if bar := ctx.ModuleForTests("bar", "android_common").Module().(*SdkLibrary); bar.installFile != nil {
+		t.Errorf("expected no implementation of bar to be installed, got %q", bar.installFile)
+	}
+	for _, m := range ctx.ModuleVariantsForTests("bar" + sdkXmlFileSuffix) {
+		t.Errorf("expected no permissions file for bar, found variant %q", m)
+	}
+}
+
+func TestJavaSdkLibrary_MissingScope(t *testing.T) {
+	testJavaError(t, `requires api scope module-lib from foo but it only has \[\] available`, `
+		java_sdk_library {
+			name: "foo",
+			srcs: ["a.java"],
+			public: {
+				enabled: false,
+			},
+		}
+
+		java_library {
+			name: "baz",
+			srcs: ["a.java"],
+			libs: ["foo"],
+			sdk_version: "module_current",
+		}
+		`)
+}
+
+func TestJavaSdkLibrary_FallbackScope(t *testing.T) {
+	testJava(t, `
+		java_sdk_library {
+			name: "foo",
+			srcs: ["a.java"],
+			system: {
+				enabled: true,
+			},
+		}
+
+		java_library {
+			name: "baz",
+			srcs: ["a.java"],
+			libs: ["foo"],
+			// foo does not have module-lib scope so it should fallback to system
+			sdk_version: "module_current",
+		}
+		`)
+}
+
+func TestJavaSdkLibrary_DefaultToStubs(t *testing.T) {
+	ctx, _ := testJava(t, `
+		java_sdk_library {
+			name: "foo",
+			srcs: ["a.java"],
+			system: {
+				enabled: true,
+			},
+			default_to_stubs: true,
+		}
+
+		java_library {
+			name: "baz",
+			srcs: ["a.java"],
+			libs: ["foo"],
+			// does not have sdk_version set, should fallback to module,
+			// which will then fallback to system because the module scope
+			// is not enabled.
+		}
+		`)
+	// The baz library should depend on the system stubs jar.
+	bazLibrary := ctx.ModuleForTests("baz", "android_common").Rule("javac")
+	if expected, actual := `^-classpath .*:/[^:]*/turbine-combined/foo\.stubs.system\.jar$`, bazLibrary.Args["classpath"]; !regexp.MustCompile(expected).MatchString(actual) {
+		t.Errorf("expected %q, found %#q", expected, actual)
+	}
+}
+
+var compilerFlagsTestCases = []struct {
+	in  string
+	out bool
+}{
+	{
+		in:  "a",
+		out: false,
+	},
+	{
+		in:  "-a",
+		out: true,
+	},
+	{
+		in:  "-no-jdk",
+		out: false,
+	},
+	{
+		in:  "-no-stdlib",
+		out: false,
+	},
+	{
+		in:  "-kotlin-home",
+		out: false,
+	},
+	{
+		in:  "-kotlin-home /some/path",
+		out: false,
+	},
+	{
+		in:  "-include-runtime",
+		out: false,
+	},
+	{
+		in:  "-Xintellij-plugin-root",
+		out: false,
+	},
+}
+
+type mockContext struct {
+	android.ModuleContext
+	result bool
+}
+
+func (ctx *mockContext) PropertyErrorf(property, format string, args ...interface{}) {
+	// CheckBadCompilerFlags calls this function when the flag should be rejected
+	ctx.result = false
+}
+
+func TestCompilerFlags(t *testing.T) {
+	for _, testCase := range compilerFlagsTestCases {
+		ctx := &mockContext{result: true}
+		CheckKotlincFlags(ctx, []string{testCase.in})
+		if ctx.result != testCase.out {
+			t.Errorf("incorrect output:")
+			t.Errorf("     input: %#v", testCase.in)
+			t.Errorf("  expected: %#v", testCase.out)
+			t.Errorf("       got: %#v", ctx.result)
+		}
 	}
+}
 
-	// test if baz has exported SDK lib names foo and bar to qux
-	qux := ctx.ModuleForTests("qux", "android_common")
-	if quxLib, ok := qux.Module().(*Library); ok {
-		sdkLibs := quxLib.ExportedSdkLibs()
-		sort.Strings(sdkLibs)
-		if w := []string{"bar", "foo", "fred", "quuz"}; !reflect.DeepEqual(w, sdkLibs) {
-			t.Errorf("qux should export %q but exports %q", w, sdkLibs)
+// TODO(jungjw): Consider making this more robust by ignoring path order.
+func checkPatchModuleFlag(t *testing.T, ctx *android.TestContext, moduleName string, expected string) {
+	variables := ctx.ModuleForTests(moduleName, "android_common").Module().VariablesForTests()
+	flags := strings.Split(variables["javacFlags"], " ")
+	got := ""
+	for _, flag := range flags {
+		keyEnd := strings.Index(flag, "=")
+		if keyEnd > -1 && flag[:keyEnd] == "--patch-module" {
+			got = flag[keyEnd+1:]
+			break
 		}
 	}
+	if expected != got {
+		t.Errorf("Unexpected patch-module flag for module %q - expected %q, but got %q", moduleName, expected, got)
+	}
 }
 
-func TestJavaSdkLibrary_DoNotAccessImplWhenItIsNotBuilt(t *testing.T) {
+func TestPatchModule(t *testing.T) {
+	t.Run("Java language level 8", func(t *testing.T) {
+		// Test with legacy javac -source 1.8 -target 1.8
+		bp := `
+			java_library {
+				name: "foo",
+				srcs: ["a.java"],
+				java_version: "1.8",
+			}
+
+			java_library {
+				name: "bar",
+				srcs: ["b.java"],
+				sdk_version: "none",
+				system_modules: "none",
+				patch_module: "java.base",
+				java_version: "1.8",
+			}
+
+			java_library {
+				name: "baz",
+				srcs: ["c.java"],
+				patch_module: "java.base",
+				java_version: "1.8",
+			}
+		`
+		ctx, _ := testJava(t, bp)
+
+		checkPatchModuleFlag(t, ctx, "foo", "")
+		checkPatchModuleFlag(t, ctx, "bar", "")
+		checkPatchModuleFlag(t, ctx, "baz", "")
+	})
+
+	t.Run("Java language level 9", func(t *testing.T) {
+		// Test with default javac -source 9 -target 9
+		bp := `
+			java_library {
+				name: "foo",
+				srcs: ["a.java"],
+			}
+
+			java_library {
+				name: "bar",
+				srcs: ["b.java"],
+				sdk_version: "none",
+				system_modules: "none",
+				patch_module: "java.base",
+			}
+
+			java_library {
+				name: "baz",
+				srcs: ["c.java"],
+				patch_module: "java.base",
+			}
+		`
+		ctx, _ := testJava(t, bp)
+
+		checkPatchModuleFlag(t, ctx, "foo", "")
+		expected := "java.base=.:" + buildDir
+		checkPatchModuleFlag(t, ctx, "bar", expected)
+		expected = "java.base=" + strings.Join([]string{".", buildDir, moduleToPath("ext"), moduleToPath("framework")}, ":")
+		checkPatchModuleFlag(t, ctx, "baz", expected)
+	})
+}
+
+func TestJavaSystemModules(t *testing.T) {
 	ctx, _ := testJava(t, `
-		java_sdk_library {
-			name: "foo",
+		java_system_modules {
+			name: "system-modules",
+			libs: ["system-module1", "system-module2"],
+		}
+		java_library {
+			name: "system-module1",
 			srcs: ["a.java"],
-			api_only: true,
-			public: {
-				enabled: true,
-			},
+			sdk_version: "none",
+			system_modules: "none",
 		}
-
 		java_library {
-			name: "bar",
+			name: "system-module2",
 			srcs: ["b.java"],
-			libs: ["foo"],
+			sdk_version: "none",
+			system_modules: "none",
 		}
 		`)
 
-	// The bar library should depend on the stubs jar.
-	barLibrary := ctx.ModuleForTests("bar", "android_common").Rule("javac")
-	if expected, actual := `^-classpath .*:/[^:]*/turbine-combined/foo\.stubs\.jar$`, barLibrary.Args["classpath"]; !regexp.MustCompile(expected).MatchString(actual) {
-		t.Errorf("expected %q, found %#q", expected, actual)
+	// check the existence of the module
+	systemModules := ctx.ModuleForTests("system-modules", "android_common")
+
+	cmd := systemModules.Rule("jarsTosystemModules")
+
+	// make sure the command compiles against the supplied modules.
+	for _, module := range []string{"system-module1.jar", "system-module2.jar"} {
+		if !strings.Contains(cmd.Args["classpath"], module) {
+			t.Errorf("system modules classpath %v does not contain %q", cmd.Args["classpath"],
+				module)
+		}
 	}
 }
 
-func TestJavaSdkLibrary_UseSourcesFromAnotherSdkLibrary(t *testing.T) {
-	testJava(t, `
-		java_sdk_library {
-			name: "foo",
-			srcs: ["a.java"],
-			api_packages: ["foo"],
-			public: {
-				enabled: true,
-			},
+func TestJavaSystemModulesImport(t *testing.T) {
+	ctx, _ := testJava(t, `
+		java_system_modules_import {
+			name: "system-modules",
+			libs: ["system-module1", "system-module2"],
 		}
-
-		java_library {
-			name: "bar",
-			srcs: ["b.java", ":foo{.public.stubs.source}"],
+		java_import {
+			name: "system-module1",
+			jars: ["a.jar"],
+		}
+		java_import {
+			name: "system-module2",
+			jars: ["b.jar"],
 		}
 		`)
+
+	// check the existence of the module
+	systemModules := ctx.ModuleForTests("system-modules", "android_common")
+
+	cmd := systemModules.Rule("jarsTosystemModules")
+
+	// make sure the command compiles against the supplied modules.
+	for _, module := range []string{"system-module1.jar", "system-module2.jar"} {
+		if !strings.Contains(cmd.Args["classpath"], module) {
+			t.Errorf("system modules classpath %v does not contain %q", cmd.Args["classpath"],
+				module)
+		}
+	}
 }
 
-func TestJavaSdkLibrary_AccessOutputFiles_MissingScope(t *testing.T) {
-	testJavaError(t, `"foo" does not provide api scope system`, `
-		java_sdk_library {
-			name: "foo",
-			srcs: ["a.java"],
-			api_packages: ["foo"],
-			public: {
-				enabled: true,
-			},
+func TestJavaLibraryWithSystemModules(t *testing.T) {
+	ctx, _ := testJava(t, `
+		java_library {
+		    name: "lib-with-source-system-modules",
+		    srcs: [
+		        "a.java",
+		    ],
+				sdk_version: "none",
+				system_modules: "source-system-modules",
 		}
 
 		java_library {
-			name: "bar",
-			srcs: ["b.java", ":foo{.system.stubs.source}"],
+				name: "source-jar",
+		    srcs: [
+		        "a.java",
+		    ],
 		}
-		`)
-}
 
-func TestJavaSdkLibraryImport_AccessOutputFiles(t *testing.T) {
-	testJava(t, `
-		java_sdk_library_import {
-			name: "foo",
-			public: {
-				jars: ["a.jar"],
-				stub_srcs: ["a.java"],
-				current_api: "api/current.txt",
-				removed_api: "api/removed.txt",
-			},
+		java_system_modules {
+				name: "source-system-modules",
+				libs: ["source-jar"],
 		}
 
 		java_library {
-			name: "bar",
-			srcs: [":foo{.public.stubs.source}"],
-			java_resources: [
-				":foo{.public.api.txt}",
-				":foo{.public.removed-api.txt}",
-			],
+		    name: "lib-with-prebuilt-system-modules",
+		    srcs: [
+		        "a.java",
+		    ],
+				sdk_version: "none",
+				system_modules: "prebuilt-system-modules",
+		}
+
+		java_import {
+				name: "prebuilt-jar",
+				jars: ["a.jar"],
+		}
+
+		java_system_modules_import {
+				name: "prebuilt-system-modules",
+				libs: ["prebuilt-jar"],
 		}
 		`)
+
+	checkBootClasspathForSystemModule(t, ctx, "lib-with-source-system-modules", "source-system-modules", "/source-jar.jar")
+
+	checkBootClasspathForSystemModule(t, ctx, "lib-with-prebuilt-system-modules", "prebuilt-system-modules", "/prebuilt-jar.jar")
+}
+
+func checkBootClasspathForSystemModule(t *testing.T, ctx *android.TestContext, moduleName, systemModulesName, expectedSuffix string) {
+	t.Helper()
+	javacRule := ctx.ModuleForTests(moduleName, "android_common").Rule("javac")
+	systemModulesRule := ctx.ModuleForTests(systemModulesName, "android_common").Rule("jarsTosystemModules")
+
+	bootClasspath := javacRule.Args["bootClasspath"]
+	if w := "--system=" + systemModulesRule.Args["outDir"]; bootClasspath != w {
+		t.Errorf("bootclasspath of %q must be %q, but was %#v.", moduleName, w, bootClasspath)
+	}
+	if classpath := systemModulesRule.Args["classpath"]; !strings.HasSuffix(classpath, expectedSuffix) {
+		t.Errorf("system modules %q must be built from a jar ending with %q, but was %#v.", systemModulesName, expectedSuffix, classpath)
+	}
 }
 
-func TestJavaSdkLibraryImport_AccessOutputFiles_Invalid(t *testing.T) {
+func TestProguardProductPolicy(t *testing.T) {
 	bp := `
-		java_sdk_library_import {
+		java_library {
 			name: "foo",
-			public: {
-				jars: ["a.jar"],
+			srcs: ["a.java"],
+			optimize: {
+				enabled: true,
+				obfuscate: true,
+				proguard_flags: ["-keep class foo.Foo"],
 			},
 		}
-		`
 
-	t.Run("stubs.source", func(t *testing.T) {
-		testJavaError(t, `stubs.source not available for api scope public`, bp+`
 		java_library {
 			name: "bar",
-			srcs: [":foo{.public.stubs.source}"],
-			java_resources: [
-				":foo{.public.api.txt}",
-				":foo{.public.removed-api.txt}",
-			],
+			srcs: ["b.java"],
+			optimize: {
+				enabled: true,
+				obfuscate: true,
+				obfuscation_dictionary: "bar-dictionary.txt",
+				repackage_classes: "bar",
+			},
 		}
-		`)
-	})
 
-	t.Run("api.txt", func(t *testing.T) {
-		testJavaError(t, `api.txt not available for api scope public`, bp+`
 		java_library {
-			name: "bar",
-			srcs: ["a.java"],
-			java_resources: [
-				":foo{.public.api.txt}",
-			],
+			name: "baz",
+			srcs: ["c.java"],
+			optimize: {
+				enabled: true,
+				obfuscate: true,
+				product_policy: false,
+			},
 		}
-		`)
-	})
+	`
 
-	t.Run("removed-api.txt", func(t *testing.T) {
-		testJavaError(t, `removed-api.txt not available for api scope public`, bp+`
-		java_library {
-			name: "bar",
-			srcs: ["a.java"],
-			java_resources: [
-				":foo{.public.removed-api.txt}",
-			],
-		}
-		`)
-	})
-}
+	config := testConfig(nil, bp, nil)
+	config.TestProductVariables.Proguard_obfuscation_dictionary = proptools.StringPtr("vendor/dictionary.txt")
+	config.TestProductVariables.Proguard_repackage_classes = proptools.StringPtr("")
+	config.TestProductVariables.Proguard_flags_files = []string{"vendor/product.flags"}
 
-func TestJavaSdkLibrary_InvalidScopes(t *testing.T) {
-	testJavaError(t, `module "foo": enabled api scope "system" depends on disabled scope "public"`, `
-		java_sdk_library {
+	ctx := testContext()
+	run(t, ctx, config)
+
+	testCases := []struct {
+		name        string
+		expected    []string
+		notExpected []string
+	}{
+		{
 			name: "foo",
-			srcs: ["a.java", "b.java"],
-			api_packages: ["foo"],
-			// Explicitly disable public to test the check that ensures the set of enabled
-			// scopes is consistent.
-			public: {
-				enabled: false,
+			expected: []string{
+				"-include vendor/product.flags",
+				"-obfuscationdictionary vendor/dictionary.txt",
+				"-repackageclasses ''",
+				"-keep class foo.Foo",
 			},
-			system: {
-				enabled: true,
+		},
+		{
+			name: "bar",
+			expected: []string{
+				"-include vendor/product.flags",
+				"-obfuscationdictionary bar-dictionary.txt",
+				"-repackageclasses bar",
 			},
+			notExpected: []string{"vendor/dictionary.txt"},
+		},
+		{
+			name:        "baz",
+			notExpected: []string{"vendor/product.flags", "-obfuscationdictionary", "-repackageclasses"},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			module := ctx.ModuleForTests(test.name, "android_common")
+			r8Flags := module.Rule("r8").Args["r8Flags"]
+			for _, flag := range test.expected {
+				if !strings.Contains(r8Flags, flag) {
+					t.Errorf("expected %q in r8 flags %q", flag, r8Flags)
+				}
+			}
+			for _, flag := range test.notExpected {
+				if strings.Contains(r8Flags, flag) {
+					t.Errorf("unexpected %q in r8 flags %q", flag, r8Flags)
+				}
+			}
+		})
+	}
+
+	report := ctx.ModuleForTests("foo", "android_common").Output("proguard_rules_report.txt")
+	for _, line := range []string{"'product: -include vendor/product.flags'", "'module: -keep class foo.Foo'"} {
+		if !strings.Contains(report.RuleParams.Command, line) {
+			t.Errorf("expected %q in proguard rules report command %q", line, report.RuleParams.Command)
 		}
-		`)
+	}
 }
 
-func TestJavaSdkLibrary_SdkVersion_ForScope(t *testing.T) {
-	testJava(t, `
-		java_sdk_library {
+func TestProguardDisabled(t *testing.T) {
+	bp := `
+		java_library {
 			name: "foo",
-			srcs: ["a.java", "b.java"],
-			api_packages: ["foo"],
-			system: {
+			srcs: ["a.java"],
+			optimize: {
 				enabled: true,
-				sdk_version: "module_current",
+				obfuscate: true,
 			},
 		}
-		`)
+	`
+
+	config := testConfig(nil, bp, nil)
+	config.TestProductVariables.Proguard_disabled = proptools.BoolPtr(true)
+
+	ctx := testContext()
+	run(t, ctx, config)
+
+	foo := ctx.ModuleForTests("foo", "android_common")
+	if foo.MaybeRule("r8").Rule != nil {
+		t.Errorf("expected foo not to be optimized with r8 when proguard is disabled for the product")
+	}
+	if foo.MaybeRule("d8").Rule == nil {
+		t.Errorf("expected foo to be dexed with d8 when proguard is disabled for the product")
+	}
+	if dict := foo.Module().(*Library).proguardDictionary; dict != nil {
+		t.Errorf("expected no proguard dictionary, got %q", dict)
+	}
 }
 
-func TestJavaSdkLibrary_ModuleLib(t *testing.T) {
-	testJava(t, `
-		java_sdk_library {
+func TestR8FullMode(t *testing.T) {
+	bp := `
+		java_library {
 			name: "foo",
-			srcs: ["a.java", "b.java"],
-			api_packages: ["foo"],
-			system: {
-				enabled: true,
-			},
-			module_lib: {
+			srcs: ["a.java"],
+			optimize: {
 				enabled: true,
 			},
 		}
-		`)
-}
 
-func TestJavaSdkLibrary_SystemServer(t *testing.T) {
-	testJava(t, `
-		java_sdk_library {
-			name: "foo",
-			srcs: ["a.java", "b.java"],
-			api_packages: ["foo"],
-			system: {
-				enabled: true,
-			},
-			system_server: {
+		java_library {
+			name: "bar",
+			srcs: ["b.java"],
+			optimize: {
 				enabled: true,
 			},
 		}
-		`)
+	`
+
+	config := testConfig(nil, bp, nil)
+	config.TestProductVariables.Experimental_features = map[string][]string{
+		"r8_full_mode": {"foo"},
+	}
+
+	ctx := testContext()
+	run(t, ctx, config)
+
+	foo := ctx.ModuleForTests("foo", "android_common").Rule("r8").Args["r8Flags"]
+	if strings.Contains(foo, "--force-proguard-compatibility") {
+		t.Errorf("expected foo to be optimized with r8 in full mode, got r8 flags %q", foo)
+	}
+
+	bar := ctx.ModuleForTests("bar", "android_common").Rule("r8").Args["r8Flags"]
+	if !strings.Contains(bar, "--force-proguard-compatibility") {
+		t.Errorf("expected bar to be optimized with r8 in compatibility mode, got r8 flags %q", bar)
+	}
 }
 
-func TestJavaSdkLibrary_MissingScope(t *testing.T) {
-	testJavaError(t, `requires api scope module-lib from foo but it only has \[\] available`, `
-		java_sdk_library {
+func TestD8MinSdkVersion(t *testing.T) {
+	ctx, _ := testJava(t, `
+		java_library {
 			name: "foo",
 			srcs: ["a.java"],
-			public: {
-				enabled: false,
-			},
+			sdk_version: "current",
+			min_sdk_version: "21",
 		}
 
 		java_library {
-			name: "baz",
+			name: "bar",
 			srcs: ["a.java"],
-			libs: ["foo"],
-			sdk_version: "module_current",
+			sdk_version: "29",
 		}
-		`)
+	`)
+
+	testCases := []struct {
+		module string
+		minApi string
+	}{
+		{module: "foo", minApi: "--min-api 21"},
+		{module: "bar", minApi: "--min-api 29"},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.module, func(t *testing.T) {
+			d8 := ctx.ModuleForTests(test.module, "android_common").Rule("d8")
+			if !strings.Contains(d8.Args["d8Flags"], test.minApi) {
+				t.Errorf("expected %q in d8 flags, got %q", test.minApi, d8.Args["d8Flags"])
+			}
+		})
+	}
 }
 
-func TestJavaSdkLibrary_FallbackScope(t *testing.T) {
-	testJava(t, `
-		java_sdk_library {
+func TestMainDexRules(t *testing.T) {
+	ctx, _ := testJavaWithFS(t, `
+		java_library {
 			name: "foo",
 			srcs: ["a.java"],
-			system: {
-				enabled: true,
-			},
+			sdk_version: "current",
+			min_sdk_version: "19",
+			main_dex_rules: ["main_dex.flags"],
 		}
 
 		java_library {
-			name: "baz",
+			name: "bar",
 			srcs: ["a.java"],
-			libs: ["foo"],
-			// foo does not have module-lib scope so it should fallback to system
-			sdk_version: "module_current",
+			sdk_version: "current",
+			min_sdk_version: "21",
+			main_dex_rules: ["main_dex.flags"],
 		}
-		`)
+
+		android_app {
+			name: "app",
+			srcs: ["a.java"],
+			sdk_version: "current",
+			min_sdk_version: "19",
+			optimize: {
+				enabled: false,
+			},
+		}
+	`, map[string][]byte{
+		"main_dex.flags": nil,
+	})
+
+	foo := ctx.ModuleForTests("foo", "android_common").Rule("d8")
+	if !strings.Contains(foo.Args["d8Flags"], "--main-dex-rules main_dex.flags") {
+		t.Errorf("expected the main dex rules in d8 flags, got %q", foo.Args["d8Flags"])
+	}
+	if !inList("main_dex.flags", foo.Implicits.Strings()) {
+		t.Errorf("expected the main dex rules in d8 inputs, got %q", foo.Implicits.Strings())
+	}
+
+	// Native multidex doesn't need main dex rules.
+	bar := ctx.ModuleForTests("bar", "android_common").Rule("d8")
+	if strings.Contains(bar.Args["d8Flags"], "--main-dex-rules") {
+		t.Errorf("unexpected main dex rules in d8 flags %q", bar.Args["d8Flags"])
+	}
+
+	app := ctx.ModuleForTests("app", "android_common")
+	mainDexProguardOptions := app.Output("main_dex_proguard.options").Output.String()
+	if link := app.Output("package-res.apk"); !strings.Contains(link.Args["flags"], "--proguard-main-dex "+mainDexProguardOptions) {
+		t.Errorf("expected aapt2 to generate the main dex rules, got flags %q", link.Args["flags"])
+	}
+	d8 := app.Rule("d8")
+	if !strings.Contains(d8.Args["d8Flags"], "--main-dex-rules "+mainDexProguardOptions) {
+		t.Errorf("expected the aapt2 main dex rules in d8 flags, got %q", d8.Args["d8Flags"])
+	}
 }
 
-func TestJavaSdkLibrary_DefaultToStubs(t *testing.T) {
+func TestCoreLibDesugaring(t *testing.T) {
 	ctx, _ := testJava(t, `
-		java_sdk_library {
+		java_library {
+			name: "desugar_jdk_libs",
+			srcs: ["b.java"],
+			sdk_version: "current",
+		}
+
+		java_library {
 			name: "foo",
 			srcs: ["a.java"],
-			system: {
-				enabled: true,
-			},
-			default_to_stubs: true,
+			sdk_version: "current",
+			min_sdk_version: "21",
+			installable: true,
+			core_lib_desugaring: true,
 		}
 
 		java_library {
-			name: "baz",
+			name: "bar",
 			srcs: ["a.java"],
-			libs: ["foo"],
-			// does not have sdk_version set, should fallback to module,
-			// which will then fallback to system because the module scope
-			// is not enabled.
+			sdk_version: "current",
+			min_sdk_version: "21",
+			installable: true,
 		}
-		`)
-	// The baz library should depend on the system stubs jar.
-	bazLibrary := ctx.ModuleForTests("baz", "android_common").Rule("javac")
-	if expected, actual := `^-classpath .*:/[^:]*/turbine-combined/foo\.stubs.system\.jar$`, bazLibrary.Args["classpath"]; !regexp.MustCompile(expected).MatchString(actual) {
-		t.Errorf("expected %q, found %#q", expected, actual)
-	}
-}
 
-var compilerFlagsTestCases = []struct {
-	in  string
-	out bool
-}{
-	{
-		in:  "a",
-		out: false,
-	},
-	{
-		in:  "-a",
-		out: true,
-	},
-	{
-		in:  "-no-jdk",
-		out: false,
-	},
-	{
-		in:  "-no-stdlib",
-		out: false,
-	},
-	{
-		in:  "-kotlin-home",
-		out: false,
-	},
-	{
-		in:  "-kotlin-home /some/path",
-		out: false,
-	},
-	{
-		in:  "-include-runtime",
-		out: false,
-	},
-	{
-		in:  "-Xintellij-plugin-root",
-		out: false,
-	},
-}
+		android_app {
+			name: "app",
+			srcs: ["a.java"],
+			sdk_version: "current",
+			min_sdk_version: "21",
+			core_lib_desugaring: true,
+			optimize: {
+				enabled: true,
+			},
+		}
+	`)
 
-type mockContext struct {
-	android.ModuleContext
-	result bool
-}
+	desugarConfig := "--desugared-lib " + coreLibDesugaringConfig
+	runtimeJar := ctx.ModuleForTests("desugar_jdk_libs", "android_common").Rule("javac").Output.String()
 
-func (ctx *mockContext) PropertyErrorf(property, format string, args ...interface{}) {
-	// CheckBadCompilerFlags calls this function when the flag should be rejected
-	ctx.result = false
-}
+	foo := ctx.ModuleForTests("foo", "android_common")
+	d8 := foo.Rule("d8")
+	if !strings.Contains(d8.Args["d8Flags"], desugarConfig) {
+		t.Errorf("expected %q in d8 flags, got %q", desugarConfig, d8.Args["d8Flags"])
+	}
+	if !inList(coreLibDesugaringConfig, d8.Implicits.Strings()) {
+		t.Errorf("expected the desugaring configuration in d8 inputs, got %q", d8.Implicits.Strings())
+	}
+	if combined := foo.Description("for javac"); inList(runtimeJar, combined.Inputs.Strings()) {
+		t.Errorf("expected the desugared core library runtime not to be linked into foo, got %q", combined.Inputs.Strings())
+	}
 
-func TestCompilerFlags(t *testing.T) {
-	for _, testCase := range compilerFlagsTestCases {
-		ctx := &mockContext{result: true}
-		CheckKotlincFlags(ctx, []string{testCase.in})
-		if ctx.result != testCase.out {
-			t.Errorf("incorrect output:")
-			t.Errorf("     input: %#v", testCase.in)
-			t.Errorf("  expected: %#v", testCase.out)
-			t.Errorf("       got: %#v", ctx.result)
+	// The runtime is compiled separately and added to the dex jar as an extra classes.dex file.
+	desugaring := foo.Description("core library desugaring")
+	for _, w := range []string{
+		"l8 --min-api 21 " + desugarConfig,
+		runtimeJar,
+		"zipinfo -1 " + d8.Output.String() + " 'classes*.dex'",
+		`"classes.dex:classes$${n}.dex"`,
+	} {
+		if !strings.Contains(desugaring.RuleParams.Command, w) {
+			t.Errorf("expected %q in core library desugaring command %q", w, desugaring.RuleParams.Command)
 		}
 	}
-}
+	if strings.Contains(desugaring.RuleParams.Command, "--pg-conf") {
+		t.Errorf("expected the runtime not to be shrunk without r8, got %q", desugaring.RuleParams.Command)
+	}
+	if dexJar := foo.Module().(*Library).DexJar(); dexJar.String() != foo.Output("core_lib_desugaring/foo.jar").Output.String() {
+		t.Errorf("expected the dex jar with the runtime, got %q", dexJar)
+	}
 
-// TODO(jungjw): Consider making this more robust by ignoring path order.
-func checkPatchModuleFlag(t *testing.T, ctx *android.TestContext, moduleName string, expected string) {
-	variables := ctx.ModuleForTests(moduleName, "android_common").Module().VariablesForTests()
-	flags := strings.Split(variables["javacFlags"], " ")
-	got := ""
-	for _, flag := range flags {
-		keyEnd := strings.Index(flag, "=")
-		if keyEnd > -1 && flag[:keyEnd] == "--patch-module" {
-			got = flag[keyEnd+1:]
-			break
+	bar := ctx.ModuleForTests("bar", "android_common")
+	if d8Flags := bar.Rule("d8").Args["d8Flags"]; strings.Contains(d8Flags, "--desugared-lib") {
+		t.Errorf("unexpected core library desugaring in d8 flags %q", d8Flags)
+	}
+	if bar.MaybeDescription("core library desugaring").Rule != nil {
+		t.Errorf("unexpected core library desugaring rule in bar")
+	}
+
+	// R8 generates the keep rules of the core library APIs used by the app, which are used to
+	// shrink the runtime.
+	app := ctx.ModuleForTests("app", "android_common")
+	r8 := app.Rule("r8")
+	keepRules := app.Output("core_lib_desugaring/keep_rules.txt").Output.String()
+	for _, w := range []string{
+		desugarConfig,
+		"-include " + coreLibDesugaringProguardFlags,
+		"--desugared-lib-pg-conf-output " + keepRules,
+	} {
+		if !strings.Contains(r8.Args["r8Flags"], w) {
+			t.Errorf("expected %q in r8 flags, got %q", w, r8.Args["r8Flags"])
 		}
 	}
-	if expected != got {
-		t.Errorf("Unexpected patch-module flag for module %q - expected %q, but got %q", moduleName, expected, got)
+	appDesugaring := app.Description("core library desugaring")
+	if w := "--pg-conf " + keepRules; !strings.Contains(appDesugaring.RuleParams.Command, w) {
+		t.Errorf("expected %q in core library desugaring command %q", w, appDesugaring.RuleParams.Command)
 	}
 }
 
-func TestPatchModule(t *testing.T) {
-	t.Run("Java language level 8", func(t *testing.T) {
-		// Test with legacy javac -source 1.8 -target 1.8
-		bp := `
-			java_library {
-				name: "foo",
-				srcs: ["a.java"],
-				java_version: "1.8",
-			}
-
-			java_library {
-				name: "bar",
-				srcs: ["b.java"],
-				sdk_version: "none",
-				system_modules: "none",
-				patch_module: "java.base",
-				java_version: "1.8",
-			}
+func TestCoreLibDesugaringNotDexed(t *testing.T) {
+	testJavaError(t, `core_lib_desugaring: has no effect on a module that is not dexed`, `
+		java_library {
+			name: "desugar_jdk_libs",
+			srcs: ["b.java"],
+			sdk_version: "current",
+		}
 
-			java_library {
-				name: "baz",
-				srcs: ["c.java"],
-				patch_module: "java.base",
-				java_version: "1.8",
-			}
-		`
-		ctx, _ := testJava(t, bp)
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			sdk_version: "current",
+			min_sdk_version: "21",
+			core_lib_desugaring: true,
+		}
+	`)
+}
 
-		checkPatchModuleFlag(t, ctx, "foo", "")
-		checkPatchModuleFlag(t, ctx, "bar", "")
-		checkPatchModuleFlag(t, ctx, "baz", "")
-	})
+func TestBootJarsPackageCheck(t *testing.T) {
+	bp := `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+		}
 
-	t.Run("Java language level 9", func(t *testing.T) {
-		// Test with default javac -source 9 -target 9
-		bp := `
-			java_library {
-				name: "foo",
-				srcs: ["a.java"],
-			}
+		java_library {
+			name: "bar",
+			srcs: ["b.java"],
+		}
+	`
 
-			java_library {
-				name: "bar",
-				srcs: ["b.java"],
-				sdk_version: "none",
-				system_modules: "none",
-				patch_module: "java.base",
-			}
+	config := testConfig(nil, bp, nil)
+	config.TestProductVariables.BootJars = []string{"foo"}
+	config.TestProductVariables.BootJarsPackageAllowList = []string{"java", "android"}
+	ctx, _ := testJavaWithConfig(t, config)
 
-			java_library {
-				name: "baz",
-				srcs: ["c.java"],
-				patch_module: "java.base",
-			}
-		`
-		ctx, _ := testJava(t, bp)
+	foo := ctx.ModuleForTests("foo", "android_common")
+	check := foo.Output("boot-jar-package-check/foo.jar")
+	if g, w := check.Args["packages"], "java android"; g != w {
+		t.Errorf("expected allowed packages %q, got %q", w, g)
+	}
+	if g, w := check.Input.String(), foo.Rule("javac").Output.String(); g != w {
+		t.Errorf("expected the package check of %q, got %q", w, g)
+	}
+	if g, w := foo.Module().(*Library).implementationJarFile.String(), check.Output.String(); g != w {
+		t.Errorf("expected the implementation jar to be the checked jar %q, got %q", w, g)
+	}
 
-		checkPatchModuleFlag(t, ctx, "foo", "")
-		expected := "java.base=.:" + buildDir
-		checkPatchModuleFlag(t, ctx, "bar", expected)
-		expected = "java.base=" + strings.Join([]string{".", buildDir, moduleToPath("ext"), moduleToPath("framework")}, ":")
-		checkPatchModuleFlag(t, ctx, "baz", expected)
-	})
+	bar := ctx.ModuleForTests("bar", "android_common")
+	if check := bar.MaybeOutput("boot-jar-package-check/bar.jar"); check.Rule != nil {
+		t.Errorf("expected no package check for a library that is not a boot jar")
+	}
 }
 
-func TestJavaSystemModules(t *testing.T) {
+func TestJavaVersion(t *testing.T) {
 	ctx, _ := testJava(t, `
-		java_system_modules {
-			name: "system-modules",
-			libs: ["system-module1", "system-module2"],
-		}
 		java_library {
-			name: "system-module1",
+			name: "foo",
 			srcs: ["a.java"],
-			sdk_version: "none",
-			system_modules: "none",
+			java_version: "1.7",
 		}
+
 		java_library {
-			name: "system-module2",
-			srcs: ["b.java"],
-			sdk_version: "none",
-			system_modules: "none",
+			name: "bar",
+			srcs: ["a.java"],
+			java_version: "11",
 		}
-		`)
 
-	// check the existence of the module
-	systemModules := ctx.ModuleForTests("system-modules", "android_common")
+		java_library_host {
+			name: "baz",
+			srcs: ["a.java"],
+			java_version: "11",
+		}
 
-	cmd := systemModules.Rule("jarsTosystemModules")
+		java_library_host {
+			name: "qux",
+			srcs: ["a.java"],
+			java_version: "1.8",
+		}
 
-	// make sure the command compiles against the supplied modules.
-	for _, module := range []string{"system-module1.jar", "system-module2.jar"} {
-		if !strings.Contains(cmd.Args["classpath"], module) {
-			t.Errorf("system modules classpath %v does not contain %q", cmd.Args["classpath"],
-				module)
+		java_library_host {
+			name: "quux",
+			srcs: ["a.java"],
 		}
+	`)
+
+	buildOS := android.BuildOs.String()
+
+	testCases := []struct {
+		module   string
+		variant  string
+		expected string
+	}{
+		{module: "foo", variant: "android_common", expected: "-source 1.7 -target 1.7"},
+		{module: "bar", variant: "android_common", expected: "-source 11 -target 11"},
+		{module: "baz", variant: buildOS + "_common", expected: "--release 11"},
+		{module: "qux", variant: buildOS + "_common", expected: "--release 8"},
+		{module: "quux", variant: buildOS + "_common", expected: "-source 1.9 -target 1.9"},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.module, func(t *testing.T) {
+			javac := ctx.ModuleForTests(test.module, test.variant).Rule("javac")
+			if g, w := javac.Args["javaVersionFlags"], test.expected; g != w {
+				t.Errorf("expected javac language level flags %q, got %q", w, g)
+			}
+		})
 	}
 }
 
-func TestJavaSystemModulesImport(t *testing.T) {
-	ctx, _ := testJava(t, `
-		java_system_modules_import {
-			name: "system-modules",
-			libs: ["system-module1", "system-module2"],
+func TestToolchainPrebuilts(t *testing.T) {
+	bp := `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			installable: true,
 		}
-		java_import {
-			name: "system-module1",
-			jars: ["a.jar"],
+
+		android_app {
+			name: "bar",
+			srcs: ["a.java"],
+			sdk_version: "current",
 		}
-		java_import {
-			name: "system-module2",
-			jars: ["b.jar"],
+
+		toolchain_prebuilt {
+			name: "jdk-toolchain",
+			checksums: "jdk/SHA256SUMS",
 		}
-		`)
+	`
+	fs := map[string][]byte{
+		"jdk/SHA256SUMS": []byte(strings.Repeat("0", 64) + "  bin/javac\n"),
+		"jdk/bin/javac":  nil,
+	}
+	config := testConfig(nil, bp, fs)
+	ctx := testContext()
+	ctx.RegisterModuleType("toolchain_prebuilt", android.ToolchainPrebuiltFactory)
+	run(t, ctx, config)
 
-	// check the existence of the module
-	systemModules := ctx.ModuleForTests("system-modules", "android_common")
+	stamp := ctx.ModuleForTests("jdk-toolchain", "").Output("verified.stamp").Output.String()
 
-	cmd := systemModules.Rule("jarsTosystemModules")
+	foo := ctx.ModuleForTests("foo", "android_common")
+	for _, rule := range []string{"javac", "turbine", "d8"} {
+		params := foo.Rule(rule)
+		if !inList(stamp, params.OrderOnly.Strings()) {
+			t.Errorf("expected %s to be ordered after %q, got %q", rule, stamp, params.OrderOnly.Strings())
+		}
+	}
 
-	// make sure the command compiles against the supplied modules.
-	for _, module := range []string{"system-module1.jar", "system-module2.jar"} {
-		if !strings.Contains(cmd.Args["classpath"], module) {
-			t.Errorf("system modules classpath %v does not contain %q", cmd.Args["classpath"],
-				module)
+	bar := ctx.ModuleForTests("bar", "android_common")
+	for _, rule := range []string{"aapt2Link", "signapk"} {
+		params := bar.Rule(rule)
+		if !inList(stamp, params.OrderOnly.Strings()) {
+			t.Errorf("expected %s to be ordered after %q, got %q", rule, stamp, params.OrderOnly.Strings())
 		}
 	}
 }
 
-func TestJavaLibraryWithSystemModules(t *testing.T) {
-	ctx, _ := testJava(t, `
+func TestJavaVersionErrors(t *testing.T) {
+	testJavaError(t, `java_version: Java language level 10 is not supported`, `
 		java_library {
-		    name: "lib-with-source-system-modules",
-		    srcs: [
-		        "a.java",
-		    ],
-				sdk_version: "none",
-				system_modules: "source-system-modules",
+			name: "foo",
+			srcs: ["a.java"],
+			java_version: "10",
 		}
+	`)
 
+	bp := `
 		java_library {
-				name: "source-jar",
-		    srcs: [
-		        "a.java",
-		    ],
+			name: "foo",
+			srcs: ["a.java"],
+			java_version: "11",
 		}
+	`
+	config := testConfig(map[string]string{"OVERRIDE_JLINK_VERSION_NUMBER": "9"}, bp, nil)
+	testJavaErrorWithConfig(t, `java_version: Java language level 11 is not supported by the JDK 9 toolchain`, config)
 
-		java_system_modules {
-				name: "source-system-modules",
-				libs: ["source-jar"],
+	testJavaError(t, `dxflags: --no-desugaring requires a min_sdk_version of at least 24`, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			sdk_version: "current",
+			min_sdk_version: "21",
+			java_version: "1.8",
+			dxflags: ["--no-desugaring"],
+			installable: true,
 		}
+	`)
+}
 
+func TestPlatformSources(t *testing.T) {
+	bp := `
 		java_library {
-		    name: "lib-with-prebuilt-system-modules",
-		    srcs: [
-		        "a.java",
-		    ],
-				sdk_version: "none",
-				system_modules: "prebuilt-system-modules",
+			name: "foo",
+			srcs: ["a.java", "b.aidl"],
 		}
 
-		java_import {
-				name: "prebuilt-jar",
-				jars: ["a.jar"],
+		java_library {
+			name: "bar",
+			srcs: ["b.java"],
 		}
 
-		java_system_modules_import {
-				name: "prebuilt-system-modules",
-				libs: ["prebuilt-jar"],
+		java_library {
+			name: "baz",
+			srcs: ["c.java"],
 		}
-		`)
+	`
 
-	checkBootClasspathForSystemModule(t, ctx, "lib-with-source-system-modules", "/source-jar.jar")
+	config := testConfig(nil, bp, nil)
+	config.TestProductVariables.BootJars = []string{"foo", "bar"}
 
-	checkBootClasspathForSystemModule(t, ctx, "lib-with-prebuilt-system-modules", "/prebuilt-jar.jar")
-}
+	ctx := testContext()
+	RegisterPlatformSourcesComponents(ctx)
+	run(t, ctx, config)
 
-func checkBootClasspathForSystemModule(t *testing.T, ctx *android.TestContext, moduleName string, expectedSuffix string) {
-	javacRule := ctx.ModuleForTests(moduleName, "android_common").Rule("javac")
-	bootClasspath := javacRule.Args["bootClasspath"]
-	if strings.HasPrefix(bootClasspath, "--system ") && strings.HasSuffix(bootClasspath, expectedSuffix) {
-		t.Errorf("bootclasspath of %q must start with --system and end with %q, but was %#v.", moduleName, expectedSuffix, bootClasspath)
+	platformSources := ctx.SingletonForTests("platform_sources").Output("platform-sources.zip")
+
+	if g, w := platformSources.Inputs.Strings(), []string{"a.java", "b.java"}; !reflect.DeepEqual(g, w) {
+		t.Errorf("expected sources %q, got %q", w, g)
+	}
+
+	aidlSrcJar := ctx.ModuleForTests("foo", "android_common").Output("aidl0.srcjar").Output.String()
+	if !inList(aidlSrcJar, platformSources.Implicits.Strings()) {
+		t.Errorf("expected generated srcjar %q in platform sources inputs %q", aidlSrcJar, platformSources.Implicits.Strings())
 	}
 }
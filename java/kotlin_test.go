@@ -16,6 +16,7 @@ package java
 
 import (
 	"android/soong/android"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
@@ -83,6 +84,81 @@ func TestKotlin(t *testing.T) {
 	}
 }
 
+func TestKotlinCommonSrcs(t *testing.T) {
+	ctx, _ := testJavaWithFS(t, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java", "b.kt"],
+			common_srcs: ["common.kt"],
+		}
+		`, map[string][]byte{
+		"common.kt": nil,
+	})
+
+	foo := ctx.ModuleForTests("foo", "android_common")
+	fooKotlinc := foo.Rule("kotlinc")
+	commonSrcsList := foo.Output("kotlinc/common_srcs.list")
+
+	if g, w := fooKotlinc.Inputs.Strings(), []string{"a.java", "b.kt", "common.kt"}; !reflect.DeepEqual(g, w) {
+		t.Errorf("foo kotlinc inputs %q != %q", g, w)
+	}
+
+	if g, w := commonSrcsList.Args["content"], "common.kt"; g != w {
+		t.Errorf("foo common srcs list %q != %q", g, w)
+	}
+
+	if g, w := fooKotlinc.Args["commonSrcFilesArg"], "--common_srcs "+commonSrcsList.Output.String(); g != w {
+		t.Errorf("foo kotlinc commonSrcFilesArg %q != %q", g, w)
+	}
+
+	if !inList(commonSrcsList.Output.String(), fooKotlinc.Implicits.Strings()) {
+		t.Errorf("expected %q in foo kotlinc implicits %v",
+			commonSrcsList.Output.String(), fooKotlinc.Implicits.Strings())
+	}
+}
+
+func TestKotlinStdlib(t *testing.T) {
+	ctx, _ := testJava(t, `
+		java_library {
+			name: "foo",
+			srcs: ["a.kt"],
+		}
+
+		java_library {
+			name: "no_kotlin_stdlib",
+			srcs: ["a.kt"],
+			no_kotlin_stdlib: true,
+		}
+
+		java_library {
+			name: "no_standard_libs",
+			srcs: ["a.kt"],
+			sdk_version: "none",
+			system_modules: "none",
+		}
+		`)
+
+	testCases := []struct {
+		name      string
+		hasStdlib bool
+	}{
+		{name: "foo", hasStdlib: true},
+		{name: "no_kotlin_stdlib", hasStdlib: false},
+		{name: "no_standard_libs", hasStdlib: false},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			kotlinc := ctx.ModuleForTests(test.name, "android_common").Rule("kotlinc")
+			hasStdlib := strings.Contains(kotlinc.Args["classpath"], "/kotlin-stdlib/")
+			if hasStdlib != test.hasStdlib {
+				t.Errorf("expected kotlin-stdlib in classpath: %v, classpath: %q",
+					test.hasStdlib, kotlinc.Args["classpath"])
+			}
+		})
+	}
+}
+
 func TestKapt(t *testing.T) {
 	ctx, _ := testJava(t, `
 		java_library {
@@ -0,0 +1,213 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/google/blueprint/proptools"
+
+	"android/soong/android"
+)
+
+type MavenProperties struct {
+	// Controls for publishing the library to a maven repository.  The pom file, the jar or aar and
+	// the sources jar of the library are packaged in the maven repository layout into a zip file
+	// that is available with the ".maven" output tag.
+	Maven struct {
+		// The groupId of the published library.  The library is only published if group_id and
+		// version are set.
+		Group_id *string
+
+		// The artifactId of the published library.  Defaults to the name of the module.
+		Artifact_id *string
+
+		// The version of the published library.
+		Version *string
+	}
+}
+
+type mavenPublisher struct {
+	properties MavenProperties
+
+	// True if the library is published as an aar instead of a jar.
+	aar bool
+
+	// The zip file containing the published files in the maven repository layout.
+	zip android.WritablePath
+}
+
+// mavenArtifact is implemented by the libraries that can be published to a maven repository, and
+// returns the coordinates of the published library.
+type mavenArtifact interface {
+	mavenCoordinates() (coordinates mavenCoordinates, published bool)
+}
+
+type mavenCoordinates struct {
+	groupId, artifactId, version, packaging string
+}
+
+var mavenIdRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+func (m *mavenPublisher) enabled() bool {
+	return m.properties.Maven.Group_id != nil && m.properties.Maven.Version != nil
+}
+
+func (j *Module) mavenCoordinates() (mavenCoordinates, bool) {
+	if !j.maven.enabled() {
+		return mavenCoordinates{}, false
+	}
+
+	packaging := "jar"
+	if j.maven.aar {
+		packaging = "aar"
+	}
+
+	return mavenCoordinates{
+		groupId:    String(j.maven.properties.Maven.Group_id),
+		artifactId: proptools.StringDefault(j.maven.properties.Maven.Artifact_id, j.Name()),
+		version:    String(j.maven.properties.Maven.Version),
+		packaging:  packaging,
+	}, true
+}
+
+var _ mavenArtifact = (*Module)(nil)
+
+// publishToMaven packages the pom file, the jar or aar and the sources jar of a library into a zip
+// file in the maven repository layout.  The libs dependencies are listed as the dependencies in
+// the pom file, and must also be published to a maven repository.
+func (j *Module) publishToMaven(ctx android.ModuleContext, artifact android.Path) {
+	coordinates, published := j.mavenCoordinates()
+	if !published || artifact == nil {
+		return
+	}
+
+	// The ids are written into the pom file and used as paths, only allow the characters that are
+	// safe in both.
+	for _, id := range []struct{ property, value string }{
+		{"maven.group_id", coordinates.groupId},
+		{"maven.artifact_id", coordinates.artifactId},
+		{"maven.version", coordinates.version},
+	} {
+		if !mavenIdRegexp.MatchString(id.value) {
+			ctx.PropertyErrorf(id.property, "%q must only contain letters, digits, '_', '.' and '-'", id.value)
+		}
+	}
+	if ctx.Failed() {
+		return
+	}
+
+	// A library in libs is needed by the users of the published library, so it must be published
+	// too.  The other libTag dependencies, like the default libraries of the platform, are provided
+	// by the runtime.
+	var dependencies []mavenCoordinates
+	ctx.VisitDirectDepsWithTag(libTag, func(dep android.Module) {
+		name := strings.TrimPrefix(ctx.OtherModuleName(dep), "prebuilt_")
+		if !android.InList(name, j.properties.Libs) {
+			return
+		}
+		if lib, ok := dep.(mavenArtifact); ok {
+			if depCoordinates, depPublished := lib.mavenCoordinates(); depPublished {
+				dependencies = append(dependencies, depCoordinates)
+				return
+			}
+		}
+		ctx.PropertyErrorf("libs", "%q is not published to a maven repository, set its maven "+
+			"group_id and version so that it can be a dependency of the published library", name)
+	})
+	if ctx.Failed() {
+		return
+	}
+
+	dir := android.PathForModuleOut(ctx, "maven")
+	versionDir := filepath.Join(strings.Replace(coordinates.groupId, ".", "/", -1),
+		coordinates.artifactId, coordinates.version)
+	base := coordinates.artifactId + "-" + coordinates.version
+
+	pom := android.PathForModuleOut(ctx, "maven", versionDir, base+".pom")
+	ctx.Build(pctx, android.BuildParams{
+		Rule:   android.WriteFile,
+		Output: pom,
+		Args: map[string]string{
+			// WriteFile automatically adds the last end-of-line.
+			"content": strings.Replace(generatePom(coordinates, dependencies), "\n", "\\n", -1),
+		},
+	})
+
+	publishedArtifact := android.PathForModuleOut(ctx, "maven", versionDir, base+"."+coordinates.packaging)
+	ctx.Build(pctx, android.BuildParams{
+		Rule:   android.Cp,
+		Input:  artifact,
+		Output: publishedArtifact,
+	})
+
+	// Package the .java files in the directories that match their package, together with the
+	// generated sources.
+	sources := android.PathForModuleOut(ctx, "maven", versionDir, base+"-sources.jar")
+	sourcesZip := android.PathForModuleOut(ctx, "maven_sources", "srcs.zip")
+	rule := android.NewRuleBuilder()
+	rule.Command().
+		BuiltTool(ctx, "soong_zip").
+		Flag("-srcjar").
+		FlagWithOutput("-o ", sourcesZip).
+		FlagWithRspFileInputList("-l ", j.compiledJavaSrcs)
+	rule.Command().
+		BuiltTool(ctx, "merge_zips").
+		Output(sources).
+		Input(sourcesZip).
+		Inputs(j.compiledSrcJars)
+	rule.Build(pctx, ctx, "maven_sources", "maven sources jar")
+
+	j.maven.zip = android.PathForModuleOut(ctx, ctx.ModuleName()+"-maven.zip")
+	rule = android.NewRuleBuilder()
+	rule.Command().
+		BuiltTool(ctx, "soong_zip").
+		FlagWithOutput("-o ", j.maven.zip).
+		FlagWithArg("-C ", dir.String()).
+		FlagForEachInput("-f ", android.Paths{pom, publishedArtifact, sources})
+	rule.Build(pctx, ctx, "maven_zip", "maven zip")
+}
+
+// generatePom returns the contents of the pom file of a library published to a maven repository.
+func generatePom(coordinates mavenCoordinates, dependencies []mavenCoordinates) string {
+	var b strings.Builder
+	fmt.Fprintln(&b, `<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintln(&b, `<project xmlns="http://maven.apache.org/POM/4.0.0">`)
+	fmt.Fprintln(&b, `  <modelVersion>4.0.0</modelVersion>`)
+	fmt.Fprintf(&b, "  <groupId>%s</groupId>\n", coordinates.groupId)
+	fmt.Fprintf(&b, "  <artifactId>%s</artifactId>\n", coordinates.artifactId)
+	fmt.Fprintf(&b, "  <version>%s</version>\n", coordinates.version)
+	fmt.Fprintf(&b, "  <packaging>%s</packaging>\n", coordinates.packaging)
+	if len(dependencies) > 0 {
+		fmt.Fprintln(&b, `  <dependencies>`)
+		for _, dep := range dependencies {
+			fmt.Fprintln(&b, `    <dependency>`)
+			fmt.Fprintf(&b, "      <groupId>%s</groupId>\n", dep.groupId)
+			fmt.Fprintf(&b, "      <artifactId>%s</artifactId>\n", dep.artifactId)
+			fmt.Fprintf(&b, "      <version>%s</version>\n", dep.version)
+			if dep.packaging != "jar" {
+				fmt.Fprintf(&b, "      <type>%s</type>\n", dep.packaging)
+			}
+			fmt.Fprintln(&b, `      <scope>compile</scope>`)
+			fmt.Fprintln(&b, `    </dependency>`)
+		}
+		fmt.Fprintln(&b, `  </dependencies>`)
+	}
+	fmt.Fprint(&b, `</project>`)
+	return b.String()
+}
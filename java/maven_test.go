@@ -0,0 +1,168 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"android/soong/android"
+)
+
+func TestMaven(t *testing.T) {
+	ctx, _ := testJava(t, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			libs: ["bar", "baz"],
+			maven: {
+				group_id: "com.android.example",
+				artifact_id: "foo-lib",
+				version: "1.0",
+			},
+		}
+
+		java_library {
+			name: "bar",
+			srcs: ["b.java"],
+			maven: {
+				group_id: "com.android.example",
+				version: "2.0",
+			},
+		}
+
+		android_library {
+			name: "baz",
+			srcs: ["c.java"],
+			sdk_version: "current",
+			maven: {
+				group_id: "com.android.example",
+				version: "3.0",
+			},
+		}
+
+		java_library {
+			name: "unpublished",
+			srcs: ["d.java"],
+		}
+	`)
+
+	foo := ctx.ModuleForTests("foo", "android_common")
+
+	expectedPom := strings.Join([]string{
+		`<?xml version="1.0" encoding="UTF-8"?>`,
+		`<project xmlns="http://maven.apache.org/POM/4.0.0">`,
+		`  <modelVersion>4.0.0</modelVersion>`,
+		`  <groupId>com.android.example</groupId>`,
+		`  <artifactId>foo-lib</artifactId>`,
+		`  <version>1.0</version>`,
+		`  <packaging>jar</packaging>`,
+		`  <dependencies>`,
+		`    <dependency>`,
+		`      <groupId>com.android.example</groupId>`,
+		`      <artifactId>bar</artifactId>`,
+		`      <version>2.0</version>`,
+		`      <scope>compile</scope>`,
+		`    </dependency>`,
+		`    <dependency>`,
+		`      <groupId>com.android.example</groupId>`,
+		`      <artifactId>baz</artifactId>`,
+		`      <version>3.0</version>`,
+		`      <type>aar</type>`,
+		`      <scope>compile</scope>`,
+		`    </dependency>`,
+		`  </dependencies>`,
+		`</project>`,
+	}, `\n`)
+
+	pom := foo.Output("maven/com/android/example/foo-lib/1.0/foo-lib-1.0.pom")
+	if g, w := pom.Args["content"], expectedPom; g != w {
+		t.Errorf("expected pom:\n%s\ngot:\n%s", w, g)
+	}
+
+	jar := foo.Output("maven/com/android/example/foo-lib/1.0/foo-lib-1.0.jar")
+	implementationJar := foo.Module().(*Library).implementationAndResourcesJar
+	if g, w := jar.Input.String(), implementationJar.String(); g != w {
+		t.Errorf("expected published jar to be a copy of %q, got %q", w, g)
+	}
+
+	sources := foo.Output("maven/com/android/example/foo-lib/1.0/foo-lib-1.0-sources.jar")
+	if g, w := sources.Inputs.Strings(), []string{"a.java"}; !reflect.DeepEqual(g, w) {
+		t.Errorf("expected sources jar inputs %q, got %q", w, g)
+	}
+
+	zip := foo.Output("foo-maven.zip")
+	versionDir := filepath.Dir(pom.Output.String())
+	for _, published := range []string{"foo-lib-1.0.pom", "foo-lib-1.0.jar", "foo-lib-1.0-sources.jar"} {
+		if path := filepath.Join(versionDir, published); !inList(path, zip.Implicits.Strings()) {
+			t.Errorf("expected %q in maven zip implicits %q", path, zip.Implicits.Strings())
+		}
+	}
+
+	outputs, err := foo.Module().(android.OutputFileProducer).OutputFiles(".maven")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := outputs.Strings(), []string{zip.Output.String()}; !reflect.DeepEqual(g, w) {
+		t.Errorf("expected .maven output files %q, got %q", w, g)
+	}
+
+	baz := ctx.ModuleForTests("baz", "android_common")
+	aar := baz.Output("maven/com/android/example/baz/3.0/baz-3.0.aar")
+	if g, w := aar.Input.String(), baz.Output("baz.aar").Output.String(); g != w {
+		t.Errorf("expected published aar to be a copy of %q, got %q", w, g)
+	}
+
+	unpublished := ctx.ModuleForTests("unpublished", "android_common")
+	if zip := unpublished.MaybeOutput("unpublished-maven.zip"); zip.Rule != nil {
+		t.Errorf("expected no maven zip for a library without maven properties")
+	}
+	_, err = unpublished.Module().(android.OutputFileProducer).OutputFiles(".maven")
+	if err == nil {
+		t.Errorf("expected an error for the .maven output files of a library without maven properties")
+	}
+}
+
+func TestMavenErrors(t *testing.T) {
+	testJavaError(t, `maven.version: "1.0 beta" must only contain letters, digits`, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			maven: {
+				group_id: "com.android.example",
+				version: "1.0 beta",
+			},
+		}
+	`)
+
+	testJavaError(t, `libs: "bar" is not published to a maven repository`, `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			libs: ["bar"],
+			maven: {
+				group_id: "com.android.example",
+				version: "1.0",
+			},
+		}
+
+		java_library {
+			name: "bar",
+			srcs: ["b.java"],
+		}
+	`)
+}
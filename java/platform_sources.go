@@ -0,0 +1,106 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"android/soong/android"
+)
+
+func init() {
+	RegisterPlatformSourcesComponents(android.InitRegistrationContext)
+}
+
+func RegisterPlatformSourcesComponents(ctx android.RegistrationContext) {
+	ctx.RegisterSingletonType("platform_sources", platformSourcesSingletonFactory)
+}
+
+type platformSourcesSingleton struct {
+	zip android.WritablePath
+}
+
+func platformSourcesSingletonFactory() android.Singleton {
+	return &platformSourcesSingleton{}
+}
+
+// compiledSourcesProvider is implemented by the modules that compile java sources, and returns the
+// .java files and the generated .srcjar files that were passed to javac.
+type compiledSourcesProvider interface {
+	compiledSources() (srcs android.Paths, srcJars android.Paths)
+}
+
+func (j *Module) compiledSources() (android.Paths, android.Paths) {
+	return j.compiledJavaSrcs, j.compiledSrcJars
+}
+
+var _ compiledSourcesProvider = (*Module)(nil)
+
+// GenerateBuildActions collects the sources of the modules on the boot classpath, including the
+// generated ones, into platform-sources.zip, for attaching the platform sources in IDEs and for
+// API review.  The .java files are placed in the directories that match their package.
+func (p *platformSourcesSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	bootJars := ctx.Config().BootJars()
+
+	// Use the first device variant of each module, the apex variants of a module compile the same
+	// sources.
+	found := make(map[string]bool)
+	var srcs, srcJars android.Paths
+	ctx.VisitAllModules(func(module android.Module) {
+		name := ctx.ModuleName(module)
+		if found[name] || !android.InList(name, bootJars) {
+			return
+		}
+		if !module.Enabled() || module.Target().Os.Class != android.Device {
+			return
+		}
+		if provider, ok := module.(compiledSourcesProvider); ok {
+			found[name] = true
+			moduleSrcs, moduleSrcJars := provider.compiledSources()
+			srcs = append(srcs, moduleSrcs...)
+			srcJars = append(srcJars, moduleSrcJars...)
+		}
+	})
+	if len(srcs) == 0 && len(srcJars) == 0 {
+		return
+	}
+
+	p.zip = android.PathForOutput(ctx, "platform-sources.zip")
+	srcsZip := android.PathForOutput(ctx, "platform_sources", "srcs.zip")
+
+	rule := android.NewRuleBuilder()
+	rule.Command().
+		BuiltTool(ctx, "soong_zip").
+		Flag("-srcjar").
+		FlagWithOutput("-o ", srcsZip).
+		FlagWithRspFileInputList("-l ", android.FirstUniquePaths(srcs))
+	rule.Command().
+		BuiltTool(ctx, "merge_zips").
+		Output(p.zip).
+		Input(srcsZip).
+		Inputs(android.FirstUniquePaths(srcJars))
+	rule.Build(pctx, ctx, "platform_sources", "platform sources zip")
+
+	ctx.Phony("platform-sources", p.zip)
+}
+
+func (p *platformSourcesSingleton) MakeVars(ctx android.MakeVarsContext) {
+	if p.zip == nil {
+		return
+	}
+
+	ctx.Strict("SOONG_PLATFORM_SOURCES_ZIP", p.zip.String())
+	ctx.DistForGoal("platform-sources", p.zip)
+}
+
+var _ android.SingletonMakeVarsProvider = (*platformSourcesSingleton)(nil)
@@ -15,8 +15,12 @@
 package java
 
 import (
-	"android/soong/android"
+	"reflect"
+	"strings"
 	"testing"
+
+	"android/soong/android"
+	"android/soong/java/config"
 )
 
 func TestNoPlugin(t *testing.T) {
@@ -80,6 +84,24 @@ func TestPlugin(t *testing.T) {
 	if javac.Args["processor"] != "-processor com.bar" {
 		t.Errorf("foo processor %q != '-processor com.bar'", javac.Args["processor"])
 	}
+
+	foo := ctx.ModuleForTests("foo", "android_common")
+	annoSrcJar := javac.Args["annoSrcJar"]
+	if !strings.HasSuffix(annoSrcJar, "/javac/anno.srcjar") {
+		t.Errorf("foo annoSrcJar %q is not javac/anno.srcjar", annoSrcJar)
+	}
+
+	if !inList(annoSrcJar, javac.ImplicitOutputs.Strings()) {
+		t.Errorf("foo javac implicit outputs %v does not contain %q", javac.ImplicitOutputs.Strings(), annoSrcJar)
+	}
+
+	outputs, err := foo.Module().(android.OutputFileProducer).OutputFiles(".annotation_srcjars")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, w := outputs.Strings(), []string{annoSrcJar}; !reflect.DeepEqual(g, w) {
+		t.Errorf("foo .annotation_srcjars %q != %q", g, w)
+	}
 }
 
 func TestPluginGeneratesApi(t *testing.T) {
@@ -121,3 +143,52 @@ func TestPluginGeneratesApi(t *testing.T) {
 		t.Errorf("foo processor %q != '-processor com.bar'", javac.Args["processor"])
 	}
 }
+
+func TestErrorProne(t *testing.T) {
+	defer func(classpath []string) { config.ErrorProneClasspath = classpath }(config.ErrorProneClasspath)
+	config.ErrorProneClasspath = []string{"external/error_prone/error_prone_core.jar"}
+
+	bp := `
+		java_library {
+			name: "foo",
+			srcs: ["a.java"],
+			errorprone: {
+				javacflags: ["-Xep:FooCheck:ERROR"],
+				extra_check_modules: ["checks"],
+			},
+		}
+
+		java_library {
+			name: "bar",
+			srcs: ["b.java"],
+			errorprone: {
+				enabled: false,
+			},
+		}
+
+		java_plugin {
+			name: "checks",
+			srcs: ["c.java"],
+		}
+	`
+
+	env := map[string]string{"RUN_ERROR_PRONE": "true"}
+	fs := map[string][]byte{"external/error_prone/error_prone_core.jar": nil}
+	ctx, _ := testJavaWithConfig(t, testConfig(env, bp, fs))
+
+	errorprone := ctx.ModuleForTests("foo", "android_common").Description("errorprone")
+	checks := ctx.ModuleForTests("checks", android.BuildOs.String()+"_common").Rule("javac").Output.String()
+	processorPath := errorprone.Args["processorpath"]
+	for _, w := range []string{"external/error_prone/error_prone_core.jar", checks} {
+		if !strings.Contains(processorPath, w) {
+			t.Errorf("expected %q in errorprone processorpath %q", w, processorPath)
+		}
+	}
+	if !strings.Contains(errorprone.Args["javacFlags"], "-Xep:FooCheck:ERROR") {
+		t.Errorf("expected errorprone javacflags in %q", errorprone.Args["javacFlags"])
+	}
+
+	if bar := ctx.ModuleForTests("bar", "android_common").MaybeDescription("errorprone"); bar.Rule != nil {
+		t.Errorf("expected no errorprone rule for bar, which opts out of errorprone")
+	}
+}
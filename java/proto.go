@@ -17,11 +17,14 @@ package java
 import (
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"android/soong/android"
 )
 
-func genProto(ctx android.ModuleContext, protoFiles android.Paths, flags android.ProtoFlags) android.Paths {
+func genProto(ctx android.ModuleContext, protoFiles android.Paths, flags android.ProtoFlags,
+	grpcOutFlag string) android.Paths {
+
 	// Shard proto files into groups of 100 to avoid having to recompile all of them if one changes and to avoid
 	// hitting command line length limits.
 	shards := android.ShardPaths(protoFiles, 100)
@@ -34,6 +37,13 @@ func genProto(ctx android.ModuleContext, protoFiles android.Paths, flags android
 
 		outDir := srcJarFile.ReplaceExtension(ctx, "tmp")
 
+		shardFlags := flags
+		if grpcOutFlag != "" {
+			// The gRPC service stubs are generated into the same directory as the messages so that
+			// they are packaged into the same srcjar.
+			shardFlags.Flags = append(android.CopyOf(flags.Flags), grpcOutFlag+outDir.String())
+		}
+
 		rule := android.NewRuleBuilder()
 
 		rule.Command().Text("rm -rf").Flag(outDir.String())
@@ -42,7 +52,7 @@ func genProto(ctx android.ModuleContext, protoFiles android.Paths, flags android
 		for _, protoFile := range shard {
 			depFile := srcJarFile.InSameDir(ctx, protoFile.String()+".d")
 			rule.Command().Text("mkdir -p").Flag(filepath.Dir(depFile.String()))
-			android.ProtoRule(ctx, rule, protoFile, flags, flags.Deps, outDir, depFile, nil)
+			android.ProtoRule(ctx, rule, protoFile, shardFlags, shardFlags.Deps, outDir, depFile, nil)
 		}
 
 		// Proto generated java files have an unknown package name in the path, so package the entire output directory
@@ -72,7 +82,11 @@ func genProto(ctx android.ModuleContext, protoFiles android.Paths, flags android
 	return srcJarFiles
 }
 
-func protoDeps(ctx android.BottomUpMutatorContext, p *android.ProtoProperties) {
+func protoDeps(ctx android.BottomUpMutatorContext, j *CompilerProperties, p *android.ProtoProperties) {
+	if plugin := String(j.Proto.Grpc_plugin); plugin != "" {
+		ctx.AddFarVariationDependencies(ctx.Config().BuildOSTarget.Variations(), grpcPluginTag, plugin)
+	}
+
 	if String(p.Proto.Plugin) == "" {
 		switch String(p.Proto.Type) {
 		case "micro":
@@ -127,5 +141,31 @@ func protoFlags(ctx android.ModuleContext, j *CompilerProperties, p *android.Pro
 
 	flags.proto.OutParams = append(flags.proto.OutParams, j.Proto.Output_params...)
 
+	if String(j.Proto.Grpc_plugin) != "" {
+		ctx.VisitDirectDepsWithTag(grpcPluginTag, func(dep android.Module) {
+			if hostTool, ok := dep.(android.HostToolProvider); !ok || !hostTool.HostToolPath().Valid() {
+				ctx.PropertyErrorf("proto.grpc_plugin", "module %q is not a host tool provider",
+					ctx.OtherModuleName(dep))
+			} else {
+				flags.proto.Deps = append(flags.proto.Deps, hostTool.HostToolPath().Path())
+				flags.proto.Flags = append(flags.proto.Flags,
+					"--plugin=protoc-gen-grpc-java="+hostTool.HostToolPath().String())
+			}
+		})
+
+		var grpcOutParams []string
+		if String(p.Proto.Plugin) == "" {
+			switch String(p.Proto.Type) {
+			case "lite", "":
+				grpcOutParams = append(grpcOutParams, "lite")
+			case "micro", "nano":
+				ctx.PropertyErrorf("proto.grpc_plugin", "gRPC service stubs are not supported for %s protos",
+					String(p.Proto.Type))
+			}
+		}
+		grpcOutParams = append(grpcOutParams, j.Proto.Grpc_output_params...)
+		flags.grpcOutFlag = "--grpc-java_out=" + strings.Join(grpcOutParams, ",") + ":"
+	}
+
 	return flags
 }
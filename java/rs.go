@@ -0,0 +1,183 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package java
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+
+	"android/soong/android"
+)
+
+// The include directories passed to llvm-rs-cc for every module.
+var rsGlobalIncludes = []string{
+	"external/clang/lib/Headers",
+	"frameworks/rs/script_api/include",
+}
+
+func rsCmd(ctx android.ModuleContext) android.Path {
+	if ctx.Config().UnbundledBuild() {
+		// Use RenderScript prebuilts for unbundled builds
+		return android.PathForSource(ctx, "prebuilts/sdk/tools", runtime.GOOS, "bin/llvm-rs-cc")
+	}
+	return ctx.Config().HostToolPath(ctx, "llvm-rs-cc")
+}
+
+// The RenderScript support library that modules with renderscript.compat_lib link statically, and
+// the JNI libraries that apps with renderscript.compat_lib embed.  libRSSupportIO is only embedded
+// for target API levels after rsCompatNoIoApiLevel, as earlier levels don't support USAGE_IO.
+var (
+	rsCompatJavaLib      = "android-support-v8-renderscript"
+	rsCompatJniLibs      = []string{"libRSSupport", "librsjni", "libblasV8"}
+	rsCompatIoJniLib     = "libRSSupportIO"
+	rsCompatNoIoApiLevel = 13
+)
+
+// rsGenerateJava compiles the .rs and .fs files with llvm-rs-cc, and returns a srcjar containing
+// the generated ScriptC_*.java files and a zip of Android resources containing the bitcode in raw/,
+// which the generated classes load as R.raw resources.
+func rsGenerateJava(ctx android.ModuleContext, rsFiles android.Paths, rsFlags []string) (srcJar, resZip android.Path) {
+	srcJarFile := android.PathForModuleGen(ctx, "rs", "rs.srcjar")
+	resZipFile := android.PathForModuleGen(ctx, "rs", "rs-res.zip")
+
+	outDir := srcJarFile.ReplaceExtension(ctx, "tmp")
+	javaDir := outDir.Join(ctx, "src")
+	resDir := outDir.Join(ctx, "res")
+	bitcodeDir := resDir.Join(ctx, "raw")
+	depDir := android.PathForModuleGen(ctx, "rs", "deps")
+
+	rule := android.NewRuleBuilder()
+
+	rule.Command().Text("rm -rf").Flag(outDir.String())
+	rule.Command().Text("mkdir -p").Flag(javaDir.String()).Flag(bitcodeDir.String()).Flag(depDir.String())
+
+	cmd := rule.Command().
+		Tool(rsCmd(ctx)).
+		FlagWithArg("-o ", bitcodeDir.String()).
+		FlagWithArg("-p ", javaDir.String()).
+		FlagWithArg("-d ", depDir.String()).
+		Flag("-MD").
+		Flags(rsFlags).
+		Inputs(rsFiles)
+	for _, rsFile := range rsFiles {
+		// llvm-rs-cc writes a depfile for each source file into the -d directory.
+		fileName := strings.TrimSuffix(rsFile.Base(), rsFile.Ext())
+		cmd.ImplicitDepFile(depDir.Join(ctx, fileName+".d"))
+	}
+
+	rule.Command().
+		BuiltTool(ctx, "soong_zip").
+		Flag("-jar").
+		Flag("-write_if_changed").
+		FlagWithOutput("-o ", srcJarFile).
+		FlagWithArg("-C ", javaDir.String()).
+		FlagWithArg("-D ", javaDir.String())
+
+	rule.Command().
+		BuiltTool(ctx, "soong_zip").
+		Flag("-write_if_changed").
+		FlagWithOutput("-o ", resZipFile).
+		FlagWithArg("-C ", resDir.String()).
+		FlagWithArg("-D ", bitcodeDir.String())
+
+	rule.Restat()
+
+	rule.Build(pctx, ctx, "renderscript", "renderscript")
+
+	return srcJarFile, resZipFile
+}
+
+// renderscriptBuildActions compiles the .rs and .fs srcs of the module, if any.  Apps and Android
+// libraries call it before compiling their resources, as the bitcode is compiled into the
+// resources by aapt2.
+func (j *Module) renderscriptBuildActions(ctx android.ModuleContext) {
+	if j.renderscriptSrcJar != nil {
+		return
+	}
+
+	var rsSrcs android.Paths
+	for _, src := range android.PathsForModuleSrcExcludes(ctx, j.properties.Srcs, j.properties.Exclude_srcs) {
+		if ext := src.Ext(); ext == ".rs" || ext == ".fs" {
+			rsSrcs = append(rsSrcs, src)
+		}
+	}
+	if len(rsSrcs) == 0 {
+		return
+	}
+
+	j.renderscriptSrcJar, j.renderscriptResZip = rsGenerateJava(ctx, rsSrcs, j.renderscriptFlags(ctx))
+}
+
+// hasRenderscriptSrcs returns true if the srcs property lists .rs or .fs files.
+func (j *Module) hasRenderscriptSrcs() bool {
+	return j.hasSrcExt(".rs") || j.hasSrcExt(".fs")
+}
+
+// renderscriptTargetApi returns the API level targeted by the renderscript srcs, or "" if the
+// module doesn't target a numbered API level.
+func (j *Module) renderscriptTargetApi() string {
+	if targetApi := String(j.deviceProperties.Renderscript.Target_api); targetApi != "" {
+		return targetApi
+	}
+	if j.sdkVersion().version.isNumbered() {
+		return j.sdkVersion().version.String()
+	}
+	return ""
+}
+
+// renderscriptCompatJniLibs returns the JNI libraries of the RenderScript support library that are
+// embedded in apps with renderscript.compat_lib.
+func (j *Module) renderscriptCompatJniLibs() []string {
+	if !Bool(j.deviceProperties.Renderscript.Compat_lib) || !j.hasRenderscriptSrcs() {
+		return nil
+	}
+	libs := append([]string(nil), rsCompatJniLibs...)
+	if api, err := strconv.Atoi(j.renderscriptTargetApi()); err == nil && api > rsCompatNoIoApiLevel {
+		libs = append(libs, rsCompatIoJniLib)
+	}
+	return libs
+}
+
+// renderscriptFlags returns the flags passed to llvm-rs-cc for the .rs and .fs srcs of the module.
+func (j *Module) renderscriptFlags(ctx android.ModuleContext) []string {
+	if ctx.Host() {
+		ctx.PropertyErrorf("srcs", "renderscript sources are only supported for device modules")
+		return nil
+	}
+
+	props := &j.deviceProperties.Renderscript
+	targetApi := j.renderscriptTargetApi()
+
+	var flags []string
+	if Bool(props.Compat_lib) {
+		// The RenderScript support library does not support API levels before 11.
+		if api, err := strconv.Atoi(targetApi); err != nil || api < 11 {
+			ctx.PropertyErrorf("renderscript.compat_lib",
+				"requires renderscript.target_api or sdk_version 11 or later")
+		}
+		flags = append(flags, "-rs-package-name=android.support.v8.renderscript")
+	}
+
+	if targetApi != "" {
+		flags = append(flags, "-target-api", targetApi)
+	}
+
+	flags = append(flags, "-Wall", "-Werror")
+	flags = append(flags, props.Flags...)
+	flags = append(flags, android.JoinWithPrefix(rsGlobalIncludes, "-I"))
+
+	return flags
+}
@@ -1111,6 +1111,7 @@ func (module *SdkLibrary) createImplLibrary(mctx android.DefaultableHookContext)
 		&module.protoProperties,
 		&module.deviceProperties,
 		&module.dexpreoptProperties,
+		&module.hiddenAPIProperties,
 		&module.linter.properties,
 		&props,
 		module.sdkComponentPropertiesForChildLibrary(),
@@ -1353,14 +1354,24 @@ func (module *SdkLibrary) DepIsInSameApex(mctx android.BaseModuleContext, dep an
 
 // Creates the xml file that publicizes the runtime library
 func (module *SdkLibrary) createXmlFile(mctx android.DefaultableHookContext) {
+	// The permissions file is installed into the same partition as the implementation library, and
+	// points to it.
 	props := struct {
-		Name           *string
-		Lib_name       *string
-		Apex_available []string
+		Name                *string
+		Lib_name            *string
+		Soc_specific        *bool
+		Device_specific     *bool
+		Product_specific    *bool
+		System_ext_specific *bool
+		Apex_available      []string
 	}{
-		Name:           proptools.StringPtr(module.xmlPermissionsModuleName()),
-		Lib_name:       proptools.StringPtr(module.BaseModuleName()),
-		Apex_available: module.ApexProperties.Apex_available,
+		Name:                proptools.StringPtr(module.xmlPermissionsModuleName()),
+		Lib_name:            proptools.StringPtr(module.BaseModuleName()),
+		Soc_specific:        proptools.BoolPtr(module.SocSpecific()),
+		Device_specific:     proptools.BoolPtr(module.DeviceSpecific()),
+		Product_specific:    proptools.BoolPtr(module.ProductSpecific()),
+		System_ext_specific: proptools.BoolPtr(module.SystemExtSpecific()),
+		Apex_available:      module.ApexProperties.Apex_available,
 	}
 
 	mctx.CreateModule(sdkLibraryXmlFactory, &props)
@@ -0,0 +1,164 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linkerconfig
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/blueprint"
+	"github.com/google/blueprint/proptools"
+
+	"android/soong/android"
+)
+
+var pctx = android.NewPackageContext("android/soong/linkerconfig")
+
+func init() {
+	android.RegisterModuleType("linker_config", LinkerConfigFactory)
+}
+
+type dependencyTag struct {
+	blueprint.BaseDependencyTag
+	name string
+}
+
+var provideLibsTag = dependencyTag{name: "provide_libs"}
+
+type linkerConfigProperties struct {
+	// linker configuration fragments in JSON format, merged in order.
+	Srcs []string `android:"path"`
+
+	// shared library modules that are provided by the partition or apex that this configuration
+	// is for.  Each module must install a shared library; the names of the installed libraries
+	// are added to provideLibs of the configuration.
+	Provide_libs []string
+
+	// whether to install the linker.config.pb to etc/ of the partition.  Defaults to true.
+	Installable *bool
+}
+
+type linkerConfig struct {
+	android.ModuleBase
+
+	properties linkerConfigProperties
+
+	outputFile android.OutputPath
+	installDir android.InstallPath
+}
+
+// linker_config compiles linker configuration fragments into the linker.config.pb read by
+// linkerconfig for a partition or an apex.  The libraries listed in provide_libs are resolved
+// through their modules, so a configuration can only reference libraries that are actually
+// installed.
+func LinkerConfigFactory() android.Module {
+	module := &linkerConfig{}
+	module.AddProperties(&module.properties)
+	android.InitAndroidArchModule(module, android.DeviceSupported, android.MultilibFirst)
+	return module
+}
+
+func (l *linkerConfig) DepsMutator(ctx android.BottomUpMutatorContext) {
+	variations := []blueprint.Variation{{Mutator: "link", Variation: "shared"}}
+	ctx.AddVariationDependencies(variations, provideLibsTag, l.properties.Provide_libs...)
+}
+
+func (l *linkerConfig) installable() bool {
+	return proptools.BoolDefault(l.properties.Installable, true)
+}
+
+func (l *linkerConfig) GenerateAndroidBuildActions(ctx android.ModuleContext) {
+	srcs := android.PathsForModuleSrc(ctx, l.properties.Srcs)
+	if len(srcs) == 0 {
+		ctx.PropertyErrorf("srcs", "at least one linker configuration fragment is required")
+		return
+	}
+
+	// The packaging specs are used rather than the installed files, as the libraries are installed by
+	// Make, not by Soong, when Soong is embedded in Make.
+	var provideLibs []string
+	ctx.VisitDirectDepsWithTag(provideLibsTag, func(m android.Module) {
+		var libs []string
+		for _, spec := range m.PackagingSpecs() {
+			if installed := spec.InstallPath(); filepath.Ext(installed.Base()) == ".so" {
+				libs = append(libs, installed.Base())
+			}
+		}
+		if len(libs) == 0 {
+			ctx.PropertyErrorf("provide_libs", "%q does not install a shared library",
+				ctx.OtherModuleName(m))
+			return
+		}
+		provideLibs = append(provideLibs, libs...)
+	})
+	provideLibs = android.SortedUniqueStrings(provideLibs)
+
+	l.outputFile = android.PathForModuleOut(ctx, "linker.config.pb").OutputPath
+
+	rule := android.NewRuleBuilder()
+	if len(provideLibs) == 0 {
+		rule.Command().
+			BuiltTool(ctx, "conv_linker_config").
+			Flag("proto").
+			FlagWithInputList("--source ", srcs, ":").
+			FlagWithOutput("--output ", l.outputFile)
+	} else {
+		intermediate := android.PathForModuleOut(ctx, "linker.config.pb.tmp")
+		rule.Command().
+			BuiltTool(ctx, "conv_linker_config").
+			Flag("proto").
+			FlagWithInputList("--source ", srcs, ":").
+			FlagWithOutput("--output ", intermediate)
+		rule.Command().
+			BuiltTool(ctx, "conv_linker_config").
+			Flag("append").
+			FlagWithInput("--source ", intermediate).
+			FlagWithOutput("--output ", l.outputFile).
+			FlagWithArg("--key ", "provideLibs").
+			FlagWithArg("--value ", proptools.ShellEscape(strings.Join(provideLibs, " ")))
+		rule.Temporary(intermediate)
+		rule.DeleteTemporaryFiles()
+	}
+	rule.Build(pctx, ctx, "conv_linker_config", android.ActionDescription("linker config", l.outputFile))
+
+	l.installDir = android.PathForModuleInstall(ctx, "etc")
+	if l.installable() {
+		ctx.InstallFile(l.installDir, l.outputFile.Base(), l.outputFile)
+	}
+}
+
+func (l *linkerConfig) OutputFiles(tag string) (android.Paths, error) {
+	switch tag {
+	case "":
+		return android.Paths{l.outputFile}, nil
+	default:
+		return nil, fmt.Errorf("unsupported module reference tag %q", tag)
+	}
+}
+
+func (l *linkerConfig) AndroidMkEntries() []android.AndroidMkEntries {
+	return []android.AndroidMkEntries{{
+		Class:      "ETC",
+		OutputFile: android.OptionalPathForPath(l.outputFile),
+		ExtraEntries: []android.AndroidMkExtraEntriesFunc{
+			func(entries *android.AndroidMkEntries) {
+				entries.SetString("LOCAL_MODULE_PATH", l.installDir.ToMakePath().String())
+				entries.SetString("LOCAL_INSTALLED_MODULE_STEM", l.outputFile.Base())
+				entries.SetBool("LOCAL_UNINSTALLABLE_MODULE", !l.installable())
+			},
+		},
+	}}
+}
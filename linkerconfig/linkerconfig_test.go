@@ -0,0 +1,142 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linkerconfig
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"android/soong/android"
+	"android/soong/cc"
+)
+
+var buildDir string
+
+func setUp() {
+	var err error
+	buildDir, err = ioutil.TempDir("", "soong_linkerconfig_test")
+	if err != nil {
+		panic(err)
+	}
+}
+
+func tearDown() {
+	os.RemoveAll(buildDir)
+}
+
+func TestMain(m *testing.M) {
+	run := func() int {
+		setUp()
+		defer tearDown()
+
+		return m.Run()
+	}
+
+	os.Exit(run())
+}
+
+func testContext(t *testing.T, bp string) (*android.TestContext, []error) {
+	t.Helper()
+	return testContextInMake(t, bp, false)
+}
+
+func testContextInMake(t *testing.T, bp string, inMake bool) (*android.TestContext, []error) {
+	t.Helper()
+
+	fs := map[string][]byte{
+		"linker.config.json": nil,
+		"extra.json":         nil,
+	}
+
+	config := cc.TestConfig(buildDir, android.Android, nil, bp, fs)
+	if inMake {
+		android.SetInMakeForTests(config)
+	}
+
+	ctx := cc.CreateTestContext()
+	ctx.RegisterModuleType("linker_config", LinkerConfigFactory)
+	ctx.Register(config)
+
+	_, errs := ctx.ParseFileList(".", []string{"Android.bp"})
+	if len(errs) > 0 {
+		return ctx, errs
+	}
+	_, errs = ctx.PrepareBuildActions(config)
+	return ctx, errs
+}
+
+func TestLinkerConfig(t *testing.T) {
+	// Make installs the libraries when Soong is embedded in it, they are still provided.
+	t.Run("soong", func(t *testing.T) { testLinkerConfig(t, false) })
+	t.Run("embedded in make", func(t *testing.T) { testLinkerConfig(t, true) })
+}
+
+func testLinkerConfig(t *testing.T, inMake bool) {
+	ctx, errs := testContextInMake(t, `
+		linker_config {
+			name: "linker_config",
+			srcs: ["linker.config.json", "extra.json"],
+			provide_libs: ["libfoo", "libbar"],
+		}
+
+		cc_library_shared {
+			name: "libfoo",
+			srcs: ["foo.cpp"],
+		}
+
+		cc_library_shared {
+			name: "libbar",
+			srcs: ["bar.cpp"],
+		}
+	`, inMake)
+	android.FailIfErrored(t, errs)
+
+	module := ctx.ModuleForTests("linker_config", "android_arm64_armv8-a")
+	rule := module.Rule("conv_linker_config")
+
+	for _, expected := range []string{
+		"conv_linker_config proto --source linker.config.json:extra.json",
+		"conv_linker_config append",
+		"--key provideLibs --value 'libbar.so libfoo.so'",
+	} {
+		if !strings.Contains(rule.RuleParams.Command, expected) {
+			t.Errorf("expected %q in command, got %q", expected, rule.RuleParams.Command)
+		}
+	}
+
+	if !inMake {
+		module.Output(buildDir + "/target/product/test_device/system/etc/linker.config.pb")
+	}
+}
+
+func TestLinkerConfigErrors(t *testing.T) {
+	_, errs := testContext(t, `
+		linker_config {
+			name: "linker_config",
+		}
+	`)
+	android.FailIfNoMatchingErrors(t, `srcs: at least one linker configuration fragment is required`, errs)
+
+	_, errs = testContext(t, `
+		linker_config {
+			name: "linker_config",
+			srcs: ["linker.config.json"],
+			provide_libs: ["libmissing"],
+		}
+	`)
+	android.FailIfNoMatchingErrors(t, `depends on undefined module "libmissing"`, errs)
+}
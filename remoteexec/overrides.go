@@ -0,0 +1,229 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remoteexec
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/google/blueprint"
+
+	"android/soong/android"
+)
+
+// Exec strategy overrides allow the exec strategy of remotely executable actions to be changed
+// per action type and per module through a config file instead of code changes, for example to
+// run a flaky tool locally or to run javac remotely for all but a few modules.  The file is
+// named by RBE_EXEC_STRATEGY_OVERRIDES and looks like:
+//
+//   {
+//       "action_types": {
+//           "javac": "remote",
+//           "metalava": "local"
+//       },
+//       "modules": {
+//           "framework": {
+//               "javac": "local"
+//           }
+//       }
+//   }
+//
+// Action types are the lower case names used in the RBE_<ACTION_TYPE> environment variables,
+// e.g. javac, turbine, r8 or cxx_links.  The RBE_<ACTION_TYPE> and
+// RBE_<ACTION_TYPE>_EXEC_STRATEGY environment variables take precedence over the action types in
+// the file, and the modules in the file take precedence over both.  An action type or module with
+// a strategy other than local is executed remotely when USE_RBE is set, even if
+// RBE_<ACTION_TYPE> is not.
+
+const execStrategyOverridesEnv = "RBE_EXEC_STRATEGY_OVERRIDES"
+
+func init() {
+	android.RegisterSingletonType("remoteexec_overrides", execStrategyOverridesSingletonFactory)
+}
+
+type execStrategyOverrides struct {
+	// Exec strategies keyed by action type.
+	ActionTypes map[string]string `json:"action_types"`
+
+	// Exec strategies keyed by module name and action type.
+	Modules map[string]map[string]string `json:"modules"`
+}
+
+type execStrategyOverridesResult struct {
+	overrides *execStrategyOverrides
+	err       error
+}
+
+var execStrategyOverridesKey = android.NewOnceKey("execStrategyOverrides")
+
+// loadExecStrategyOverrides returns the exec strategy overrides from the file named by
+// RBE_EXEC_STRATEGY_OVERRIDES, or empty overrides if it is not set.
+func loadExecStrategyOverrides(cfg android.Config) execStrategyOverridesResult {
+	return cfg.Once(execStrategyOverridesKey, func() interface{} {
+		overrides := &execStrategyOverrides{}
+		file := cfg.Getenv(execStrategyOverridesEnv)
+		if file == "" {
+			return execStrategyOverridesResult{overrides: overrides}
+		}
+
+		data, err := ioutil.ReadFile(file)
+		if err == nil {
+			err = json.Unmarshal(data, overrides)
+		}
+		if err == nil {
+			err = overrides.validate()
+		}
+		if err != nil {
+			err = fmt.Errorf("%s=%s: %s", execStrategyOverridesEnv, file, err)
+			return execStrategyOverridesResult{overrides: &execStrategyOverrides{}, err: err}
+		}
+		return execStrategyOverridesResult{overrides: overrides}
+	}).(execStrategyOverridesResult)
+}
+
+func validExecStrategy(strategy string) bool {
+	return android.InList(strategy,
+		[]string{LocalExecStrategy, RemoteExecStrategy, RemoteLocalFallbackExecStrategy})
+}
+
+func (o *execStrategyOverrides) validate() error {
+	for _, actionType := range android.SortedStringKeys(o.ActionTypes) {
+		if strategy := o.ActionTypes[actionType]; !validExecStrategy(strategy) {
+			return fmt.Errorf("invalid exec strategy %q for action type %q", strategy, actionType)
+		}
+	}
+	for _, module := range android.SortedStringKeys(o.Modules) {
+		for _, actionType := range android.SortedStringKeys(o.Modules[module]) {
+			if strategy := o.Modules[module][actionType]; !validExecStrategy(strategy) {
+				return fmt.Errorf("invalid exec strategy %q for action type %q of module %q",
+					strategy, actionType, module)
+			}
+		}
+	}
+	return nil
+}
+
+func actionTypeEnv(actionType string) string {
+	return "RBE_" + strings.ToUpper(actionType)
+}
+
+// ExecStrategyFunc retrieves a variable func that evaluates to the exec strategy for the given
+// action type: the value of RBE_<ACTION_TYPE>_EXEC_STRATEGY if set, otherwise the strategy for the
+// action type in the exec strategy overrides file if any, otherwise the given default.
+func ExecStrategyFunc(actionType, defaultVal string) func(ctx android.PackageVarContext) string {
+	return func(ctx android.PackageVarContext) string {
+		return actionTypeExecStrategy(ctx.Config(), actionType, defaultVal)
+	}
+}
+
+func actionTypeExecStrategy(cfg android.Config, actionType, defaultVal string) string {
+	if override := cfg.Getenv(actionTypeEnv(actionType) + "_EXEC_STRATEGY"); override != "" {
+		return override
+	}
+	if strategy, ok := loadExecStrategyOverrides(cfg).overrides.ActionTypes[actionType]; ok {
+		return strategy
+	}
+	return defaultVal
+}
+
+// moduleExecStrategy returns the exec strategy for the given action type of the module from the
+// exec strategy overrides file, or false if the file does not override it.
+func moduleExecStrategy(ctx android.ModuleContext, actionType string) (string, bool) {
+	strategy, ok := loadExecStrategyOverrides(ctx.Config()).overrides.Modules[ctx.ModuleName()][actionType]
+	return strategy, ok
+}
+
+// UseRemote returns true if the actions of the given type of the module should be executed
+// through the remote execution wrapper.
+func UseRemote(ctx android.ModuleContext, actionType string) bool {
+	if useRemote(ctx, actionType) {
+		recordRemoteModule(ctx)
+		return true
+	}
+	return false
+}
+
+func useRemote(ctx android.ModuleContext, actionType string) bool {
+	if strategy, ok := moduleExecStrategy(ctx, actionType); ok {
+		return strategy != LocalExecStrategy && ctx.Config().UseRBE()
+	}
+	if ctx.Config().IsEnvTrue(actionTypeEnv(actionType)) {
+		return true
+	}
+	if strategy, ok := loadExecStrategyOverrides(ctx.Config()).overrides.ActionTypes[actionType]; ok {
+		return strategy != LocalExecStrategy && ctx.Config().UseRBE()
+	}
+	return false
+}
+
+// ExecStrategy returns the exec strategy for the actions of the given type of the module, for
+// actions that construct their remote execution wrapper with NoVarTemplate.
+func ExecStrategy(ctx android.ModuleContext, actionType, defaultVal string) string {
+	if strategy, ok := moduleExecStrategy(ctx, actionType); ok {
+		return strategy
+	}
+	return actionTypeExecStrategy(ctx.Config(), actionType, defaultVal)
+}
+
+// Rule returns the rule to use for the actions of the given type of the module, given the pair of
+// rules returned by StaticRules or MultiCommandStaticRules.  It returns the locally executable
+// rule unless the actions should be executed remotely, in which case it returns the remotely
+// executable rule, or a copy of it with the exec strategy set for the module.  The returned bool
+// is true if the returned rule is remotely executable and needs the args specific to remote
+// execution.
+func Rule(ctx android.ModuleContext, actionType string, local, remote blueprint.Rule) (blueprint.Rule, bool) {
+	if !UseRemote(ctx, actionType) {
+		return local, false
+	}
+	if strategy, ok := moduleExecStrategy(ctx, actionType); ok {
+		if rule, exists := strategyRules[remote][strategy]; exists {
+			return rule, true
+		}
+	}
+	return remote, true
+}
+
+// strategyRules contains copies of the remotely executable rules created by StaticRules and
+// MultiCommandStaticRules with a fixed exec strategy, for modules that override it.
+var strategyRules = make(map[blueprint.Rule]map[string]blueprint.Rule)
+
+// addStrategyRules creates the copies of the remotely executable rule for each exec strategy that
+// executes remotely.
+func addStrategyRules(remote blueprint.Rule, create func(strategy string) blueprint.Rule) {
+	rules := make(map[string]blueprint.Rule)
+	for _, strategy := range []string{RemoteExecStrategy, RemoteLocalFallbackExecStrategy} {
+		rules[strategy] = create(strategy)
+	}
+	strategyRules[remote] = rules
+}
+
+func execStrategyOverridesSingletonFactory() android.Singleton {
+	return &execStrategyOverridesSingleton{}
+}
+
+type execStrategyOverridesSingleton struct{}
+
+// GenerateBuildActions reports errors in the exec strategy overrides file, and reruns Soong when
+// the file changes.
+func (s *execStrategyOverridesSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	if file := ctx.Config().Getenv(execStrategyOverridesEnv); file != "" {
+		ctx.AddNinjaFileDeps(file)
+	}
+	if err := loadExecStrategyOverrides(ctx.Config()).err; err != nil {
+		ctx.Errorf("%s", err)
+	}
+}
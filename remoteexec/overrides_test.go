@@ -0,0 +1,106 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remoteexec
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"android/soong/android"
+)
+
+func testExecStrategyOverridesConfig(t *testing.T, dir, overrides string, env map[string]string) android.Config {
+	t.Helper()
+
+	file := filepath.Join(dir, "overrides.json")
+	if err := ioutil.WriteFile(file, []byte(overrides), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if env == nil {
+		env = make(map[string]string)
+	}
+	env[execStrategyOverridesEnv] = file
+	return android.TestConfig(dir, env, "", nil)
+}
+
+func TestExecStrategyOverrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remoteexec_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := testExecStrategyOverridesConfig(t, dir, `{
+		"action_types": {
+			"javac": "remote",
+			"d8": "remote"
+		},
+		"modules": {
+			"framework": {
+				"javac": "local"
+			}
+		}
+	}`, map[string]string{"RBE_D8_EXEC_STRATEGY": LocalExecStrategy})
+
+	result := loadExecStrategyOverrides(config)
+	if result.err != nil {
+		t.Fatal(result.err)
+	}
+
+	tests := []struct {
+		actionType string
+		want       string
+	}{
+		{actionType: "javac", want: RemoteExecStrategy},
+		{actionType: "d8", want: LocalExecStrategy},
+		{actionType: "zip", want: RemoteLocalFallbackExecStrategy},
+	}
+	for _, test := range tests {
+		got := actionTypeExecStrategy(config, test.actionType, RemoteLocalFallbackExecStrategy)
+		if got != test.want {
+			t.Errorf("expected exec strategy %q for %s, got %q", test.want, test.actionType, got)
+		}
+	}
+
+	if got := result.overrides.Modules["framework"]["javac"]; got != LocalExecStrategy {
+		t.Errorf("expected exec strategy %q for javac of framework, got %q", LocalExecStrategy, got)
+	}
+}
+
+func TestExecStrategyOverridesInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remoteexec_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := testExecStrategyOverridesConfig(t, dir, `{
+		"modules": {
+			"framework": {
+				"javac": "fast"
+			}
+		}
+	}`, nil)
+
+	err = loadExecStrategyOverrides(config).err
+	want := `invalid exec strategy "fast" for action type "javac" of module "framework"`
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("expected error %q, got %v", want, err)
+	}
+}
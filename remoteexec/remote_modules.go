@@ -0,0 +1,80 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remoteexec
+
+import (
+	"strings"
+	"sync"
+
+	"android/soong/android"
+)
+
+// The remote modules file lists the output directory of every module variant with actions that
+// are executed remotely, followed by the name of the module.  It is built by the remote_modules
+// phony target, which droidcore depends on.  soong_ui uses it to attribute the actions in the
+// reproxy log to modules when it reports the remote cache hit ratios after the build.
+const remoteModulesFile = "remote_modules.txt"
+
+func init() {
+	android.RegisterSingletonType("remote_modules", remoteModulesSingletonFactory)
+}
+
+type remoteModules struct {
+	sync.Mutex
+	modules map[string]string
+}
+
+var remoteModulesKey = android.NewOnceKey("remoteModules")
+
+func getRemoteModules(cfg android.Config) *remoteModules {
+	return cfg.Once(remoteModulesKey, func() interface{} {
+		return &remoteModules{modules: make(map[string]string)}
+	}).(*remoteModules)
+}
+
+// recordRemoteModule records that the module has actions that are executed remotely.
+func recordRemoteModule(ctx android.ModuleContext) {
+	r := getRemoteModules(ctx.Config())
+	r.Lock()
+	defer r.Unlock()
+	r.modules[android.PathForModuleOut(ctx).String()] = ctx.ModuleName()
+}
+
+func remoteModulesSingletonFactory() android.Singleton {
+	return &remoteModulesSingleton{}
+}
+
+type remoteModulesSingleton struct{}
+
+func (s *remoteModulesSingleton) GenerateBuildActions(ctx android.SingletonContext) {
+	if !ctx.Config().UseRBE() {
+		return
+	}
+
+	r := getRemoteModules(ctx.Config())
+	r.Lock()
+	defer r.Unlock()
+
+	var lines []string
+	for _, dir := range android.SortedStringKeys(r.modules) {
+		lines = append(lines, dir+" "+r.modules[dir]+"\n")
+	}
+
+	file := android.PathForOutput(ctx, remoteModulesFile)
+	android.WriteFileRule(ctx, file, strings.Join(lines, ""))
+
+	ctx.Phony("remote_modules", file)
+	ctx.Phony("droidcore", file)
+}
@@ -168,30 +168,58 @@ func (r *REParams) wrapperArgs() string {
 // StaticRules returns a pair of rules based on the given RuleParams, where the first rule is a
 // locally executable rule and the second rule is a remotely executable rule. commonArgs are args
 // used for both the local and remotely executable rules. reArgs are used only for remote
-// execution.
+// execution.  Use Rule to select between the rules for a module.
 func StaticRules(ctx android.PackageContext, name string, ruleParams blueprint.RuleParams, reParams *REParams, commonArgs []string, reArgs []string) (blueprint.Rule, blueprint.Rule) {
-	ruleParamsRE := ruleParams
-	ruleParams.Command = strings.ReplaceAll(ruleParams.Command, "$reTemplate", "")
-	ruleParamsRE.Command = strings.ReplaceAll(ruleParamsRE.Command, "$reTemplate", reParams.Template())
+	remoteRule := func(name string, reParams *REParams) blueprint.Rule {
+		ruleParamsRE := ruleParams
+		ruleParamsRE.Command = strings.ReplaceAll(ruleParamsRE.Command, "$reTemplate", reParams.Template())
+		return ctx.AndroidRemoteStaticRule(name, android.RemoteRuleSupports{RBE: true}, ruleParamsRE, append(commonArgs, reArgs...)...)
+	}
+
+	localParams := ruleParams
+	localParams.Command = strings.ReplaceAll(localParams.Command, "$reTemplate", "")
 
-	return ctx.AndroidStaticRule(name, ruleParams, commonArgs...),
-		ctx.AndroidRemoteStaticRule(name+"RE", android.RemoteRuleSupports{RBE: true}, ruleParamsRE, append(commonArgs, reArgs...)...)
+	remote := remoteRule(name+"RE", reParams)
+	addStrategyRules(remote, func(strategy string) blueprint.Rule {
+		strategyParams := *reParams
+		strategyParams.ExecStrategy = strategy
+		return remoteRule(name+"RE_"+strategy, &strategyParams)
+	})
+
+	return ctx.AndroidStaticRule(name, localParams, commonArgs...), remote
 }
 
 // MultiCommandStaticRules returns a pair of rules based on the given RuleParams, where the first
 // rule is a locally executable rule and the second rule is a remotely executable rule. This
 // function supports multiple remote execution wrappers placed in the template when commands are
 // chained together with &&. commonArgs are args used for both the local and remotely executable
-// rules. reArgs are args used only for remote execution.
+// rules. reArgs are args used only for remote execution.  Use Rule to select between the rules
+// for a module.
 func MultiCommandStaticRules(ctx android.PackageContext, name string, ruleParams blueprint.RuleParams, reParams map[string]*REParams, commonArgs []string, reArgs []string) (blueprint.Rule, blueprint.Rule) {
-	ruleParamsRE := ruleParams
-	for k, v := range reParams {
-		ruleParams.Command = strings.ReplaceAll(ruleParams.Command, k, "")
-		ruleParamsRE.Command = strings.ReplaceAll(ruleParamsRE.Command, k, v.Template())
+	remoteRule := func(name string, strategy string) blueprint.Rule {
+		ruleParamsRE := ruleParams
+		for k, v := range reParams {
+			if strategy != "" {
+				strategyParams := *v
+				strategyParams.ExecStrategy = strategy
+				v = &strategyParams
+			}
+			ruleParamsRE.Command = strings.ReplaceAll(ruleParamsRE.Command, k, v.Template())
+		}
+		return ctx.AndroidRemoteStaticRule(name, android.RemoteRuleSupports{RBE: true}, ruleParamsRE, append(commonArgs, reArgs...)...)
 	}
 
-	return ctx.AndroidStaticRule(name, ruleParams, commonArgs...),
-		ctx.AndroidRemoteStaticRule(name+"RE", android.RemoteRuleSupports{RBE: true}, ruleParamsRE, append(commonArgs, reArgs...)...)
+	localParams := ruleParams
+	for k := range reParams {
+		localParams.Command = strings.ReplaceAll(localParams.Command, k, "")
+	}
+
+	remote := remoteRule(name+"RE", "")
+	addStrategyRules(remote, func(strategy string) blueprint.Rule {
+		return remoteRule(name+"RE_"+strategy, strategy)
+	})
+
+	return ctx.AndroidStaticRule(name, localParams, commonArgs...), remote
 }
 
 // EnvOverrideFunc retrieves a variable func that evaluates to the value of the given environment
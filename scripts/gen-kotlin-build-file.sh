@@ -17,7 +17,7 @@
 # Generates kotlinc module xml file to standard output based on rsp files
 
 if [[ -z "$1" ]]; then
-  echo "usage: $0 <classpath> <name> <outDir> <rspFiles>..." >&2
+  echo "usage: $0 <classpath> <name> <outDir> [--common_srcs <commonSrcsList>] <rspFiles>..." >&2
   exit 1
 fi
 
@@ -31,6 +31,13 @@ name=$2
 out_dir=$3
 shift 3
 
+# Optional list of Kotlin common sources of a multiplatform module.
+common_srcs_list=
+if [[ $1 == "--common_srcs" ]]; then
+  common_srcs_list=$2
+  shift 2
+fi
+
 # Path in the build file may be relative to the build file, we need to make them
 # absolute
 prefix="$(pwd)"
@@ -70,4 +77,17 @@ while (( "$#" )); do
   shift
 done
 
+# Print common source entries
+if [[ -n "${common_srcs_list}" ]]; then
+  for file in $(cat "${common_srcs_list}"); do
+    path="$(get_abs_path "$file")"
+    if [[ $file == *.kt ]]; then
+      echo "  <commonSources path=\"${path}\"/>"
+    else
+      echo "Unknown common source file type ${file}"
+      exit 1
+    fi
+  done
+fi
+
 echo "</module></modules>"
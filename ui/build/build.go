@@ -44,6 +44,16 @@ func SetupOutDir(ctx Context, config Config) {
 	} else {
 		ctx.Fatalln("Missing BUILD_DATETIME_FILE")
 	}
+
+	// The source revision is stamped into outputs by Soong.  Only write it when it changes so
+	// that the stamping actions don't rerun on every build.
+	scmRevisionFile := filepath.Join(config.SoongOutDir(), "build_scm_revision.txt")
+	if contents, err := ioutil.ReadFile(scmRevisionFile); err != nil || string(contents) != config.BuildScmRevision() {
+		ensureDirectoriesExist(ctx, config.SoongOutDir())
+		if err := ioutil.WriteFile(scmRevisionFile, []byte(config.BuildScmRevision()), 0666); err != nil {
+			ctx.Fatalln("Failed to write BUILD_SCM_REVISION to file:", err)
+		}
+	}
 }
 
 var combinedBuildNinjaTemplate = template.Must(template.New("combined").Parse(`
@@ -253,7 +263,13 @@ func Build(ctx Context, config Config, what int) {
 			installCleanIfNecessary(ctx, config)
 		}
 
+		cleanOldModuleIntermediates(ctx, config)
+
 		// Run ninja
 		runNinja(ctx, config)
+
+		if !config.SkipMake() {
+			updateInstallJournal(ctx, config)
+		}
 	}
 }
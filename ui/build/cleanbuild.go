@@ -24,6 +24,7 @@ import (
 	"strings"
 
 	"android/soong/ui/metrics"
+	"android/soong/ui/status"
 )
 
 func removeGlobs(ctx Context, globs ...string) {
@@ -261,6 +262,99 @@ func cleanOldFiles(ctx Context, basePath, file string) {
 	os.Rename(file, oldFile)
 }
 
+// cleanOldModuleIntermediates removes the intermediates directories of module variants that are no
+// longer in the list built by the module_intermediates target, for example because the module was
+// renamed or its variants changed, so that stale outputs don't corrupt later incremental builds.
+// It runs before the build so that the stale outputs can't be used by it, after building only the
+// list.  The intermediates directories are shared by all products, so the last list of each
+// product is kept and a directory is only removed if it isn't listed for any product.
+func cleanOldModuleIntermediates(ctx Context, config Config) {
+	ctx.BeginTrace("clean", "clean old intermediates")
+	defer ctx.EndTrace()
+
+	func() {
+		fifo := filepath.Join(config.OutDir(), ".ninja_fifo")
+		nr := status.NewNinjaReader(ctx, ctx.Status.StartTool(), fifo)
+		defer nr.Close()
+
+		cmd := Command(ctx, config, "module intermediates", config.PrebuiltBuildTool("ninja"),
+			"--frontend_file", fifo,
+			"-f", config.CombinedNinjaFile(),
+			"module_intermediates")
+		cmd.Sandbox = ninjaSandbox
+		cmd.RunAndStreamOrFatal()
+	}()
+
+	cleanOldDirs(ctx, config.SoongOutDir(), ".module_intermediates", config.TargetProduct())
+}
+
+// cleanOldDirs takes an input file listing directories relative to basePath for the given product,
+// and removes the directories with all their contents if they were removed from the input file
+// since the last execution for the product.  Directories that contain a directory that is still
+// listed, either in the input file or in the last input file of another product, are kept.  The
+// last input file of each product is kept in <file>.<product>, as the input file is built by ninja
+// and has to be kept up to date.
+func cleanOldDirs(ctx Context, basePath, file, product string) {
+	file = filepath.Join(basePath, file)
+	productFile := file + "." + product
+
+	newData, err := ioutil.ReadFile(file)
+	if err != nil {
+		ctx.Fatalf("Failed to read list of directories (%q): %v", file, err)
+	}
+
+	oldData, err := ioutil.ReadFile(productFile)
+	if err == nil {
+		if bytes.Equal(newData, oldData) {
+			return
+		}
+
+		keep := make(map[string]bool)
+		keepListed := func(data []byte) {
+			for _, path := range strings.Fields(string(data)) {
+				for dir := path; dir != "." && dir != "/"; dir = filepath.Dir(dir) {
+					keep[dir] = true
+				}
+			}
+		}
+		keepListed(newData)
+
+		otherFiles, _ := filepath.Glob(file + ".*")
+		for _, otherFile := range otherFiles {
+			if otherFile == productFile {
+				continue
+			}
+			otherData, err := ioutil.ReadFile(otherFile)
+			if err != nil {
+				ctx.Fatalf("Failed to read list of directories (%q): %v", otherFile, err)
+			}
+			keepListed(otherData)
+		}
+
+		for _, old := range strings.Fields(string(oldData)) {
+			if keep[old] {
+				continue
+			}
+			dir := filepath.Join(basePath, old)
+			if _, err := os.Stat(dir); err != nil {
+				continue
+			}
+			if err := os.RemoveAll(dir); err == nil {
+				ctx.Println("Removed stale intermediates directory:", dir)
+			} else {
+				ctx.Fatalf("Failed to remove stale intermediates directory (%q): %v", dir, err)
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		ctx.Fatalf("Failed to read list of directories (%q): %v", productFile, err)
+	}
+
+	// Use the new list as the base for the next build of the product
+	if err := ioutil.WriteFile(productFile, newData, 0666); err != nil {
+		ctx.Fatalf("Failed to write list of directories (%q): %v", productFile, err)
+	}
+}
+
 func cleanEmptyDirs(ctx Context, dir string) {
 	files, err := ioutil.ReadDir(dir)
 	if err != nil || len(files) > 0 {
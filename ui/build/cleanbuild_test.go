@@ -98,3 +98,82 @@ func TestCleanOldFiles(t *testing.T) {
 	runCleanOldFiles("foo", "baz")
 	assertFileList("foo", "bar", "baz", "foo2", ".installed.previous")
 }
+
+func TestCleanOldDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "testcleanolddirs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := testContext()
+	logBuf := &bytes.Buffer{}
+	ctx.Logger = logger.New(logBuf)
+
+	mkdirs := func(names ...string) {
+		for _, name := range names {
+			if err := os.MkdirAll(filepath.Join(dir, name, "out"), 0777); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	runCleanOldDirs := func(product string, names ...string) {
+		data := []byte(strings.Join(names, "\n"))
+		if err := ioutil.WriteFile(filepath.Join(dir, ".dirs"), data, 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		cleanOldDirs(ctx, dir, ".dirs", product)
+	}
+	assertExist := func(names ...string) {
+		t.Helper()
+		for _, name := range names {
+			if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+				t.Errorf("expected %q to exist: %s", name, err)
+			}
+		}
+	}
+	assertRemoved := func(names ...string) {
+		t.Helper()
+		for _, name := range names {
+			if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+				t.Errorf("expected %q to be removed", name)
+			}
+		}
+	}
+
+	mkdirs("a/foo/android_common", "a/bar/android_common", "a/bar/baz/android_common")
+
+	// The first list only becomes the base for the next run
+	runCleanOldDirs("product1", "a/foo/android_common", "a/bar/android_common", "a/bar/baz/android_common")
+	assertExist("a/foo/android_common/out", "a/bar/android_common/out", "a/bar/baz/android_common/out")
+
+	// foo was renamed to foo2, and bar is now in the same directory as a module that is still there
+	runCleanOldDirs("product1", "a/foo2/android_common", "a/bar/baz/android_common")
+	assertRemoved("a/foo/android_common", "a/bar/android_common")
+	assertExist("a/bar/baz/android_common/out")
+
+	// The list is kept per product, and copied once it has been handled
+	assertExist(".dirs", ".dirs.product1")
+	if data, err := ioutil.ReadFile(filepath.Join(dir, ".dirs.product1")); err != nil {
+		t.Fatal(err)
+	} else if g, w := string(data), "a/foo2/android_common\na/bar/baz/android_common"; g != w {
+		t.Errorf("expected previous list %q, got %q", w, g)
+	}
+
+	// Directories that are listed for another product are kept when switching products
+	mkdirs("a/foo2/android_common", "a/qux/android_common", "a/qux/android_arm64")
+	runCleanOldDirs("product2", "a/qux/android_common", "a/qux/android_arm64")
+	runCleanOldDirs("product2", "a/qux/android_common")
+	assertRemoved("a/qux/android_arm64")
+	assertExist("a/foo2/android_common/out", "a/bar/baz/android_common/out", "a/qux/android_common/out")
+
+	runCleanOldDirs("product1", "a/bar/baz/android_common")
+	assertRemoved("a/foo2/android_common")
+	assertExist("a/bar/baz/android_common/out", "a/qux/android_common/out")
+
+	// A directory that is no longer listed for a product is kept while another product lists it
+	runCleanOldDirs("product1", "a/bar/baz/android_common", "a/qux/android_common")
+	runCleanOldDirs("product1", "a/bar/baz/android_common")
+	assertExist("a/qux/android_common/out")
+}
@@ -40,6 +40,8 @@ type configImpl struct {
 	distDir       string
 	buildDateTime string
 
+	buildScmRevision string
+
 	// From the arguments
 	parallel   int
 	keepGoing  int
@@ -109,23 +111,27 @@ func NewConfig(ctx Context, args ...string) Config {
 
 	ret.parseArgs(ctx, args)
 
+	// The paths below are made relative to the top of the source tree when they are inside it, see
+	// relativeToTop.
+	wd, err := os.Getwd()
+	if err != nil {
+		ctx.Fatalln("Failed to get working directory:", err)
+	}
+
 	// Make sure OUT_DIR is set appropriately
 	if outDir, ok := ret.environ.Get("OUT_DIR"); ok {
-		ret.environ.Set("OUT_DIR", filepath.Clean(outDir))
+		ret.environ.Set("OUT_DIR", relativeToTop(wd, outDir))
 	} else {
 		outDir := "out"
 		if baseDir, ok := ret.environ.Get("OUT_DIR_COMMON_BASE"); ok {
-			if wd, err := os.Getwd(); err != nil {
-				ctx.Fatalln("Failed to get working directory:", err)
-			} else {
-				outDir = filepath.Join(baseDir, filepath.Base(wd))
-			}
+			outDir = relativeToTop(wd, filepath.Join(baseDir, filepath.Base(wd)))
 		}
 		ret.environ.Set("OUT_DIR", outDir)
 	}
 
 	if distDir, ok := ret.environ.Get("DIST_DIR"); ok {
-		ret.distDir = filepath.Clean(distDir)
+		ret.distDir = relativeToTop(wd, distDir)
+		ret.environ.Set("DIST_DIR", ret.distDir)
 	} else {
 		ret.distDir = filepath.Join(ret.OutDir(), "dist")
 	}
@@ -241,7 +247,7 @@ func NewConfig(ctx Context, args ...string) Config {
 	java11Home := filepath.Join("prebuilts/jdk/jdk11", ret.HostPrebuiltTag())
 	javaHome := func() string {
 		if override, ok := ret.environ.Get("OVERRIDE_ANDROID_JAVA_HOME"); ok {
-			return override
+			return relativeToTop(wd, override)
 		}
 		if toolchain11, ok := ret.environ.Get("EXPERIMENTAL_USE_OPENJDK11_TOOLCHAIN"); ok && toolchain11 != "true" {
 			ctx.Fatalln("The environment variable EXPERIMENTAL_USE_OPENJDK11_TOOLCHAIN is no longer supported. An OpenJDK 11 toolchain is now the global default.")
@@ -275,6 +281,12 @@ func NewConfig(ctx Context, args ...string) Config {
 
 	ret.environ.Set("BUILD_DATETIME_FILE", buildDateTimeFile)
 
+	if scmRevision, ok := ret.environ.Get("BUILD_SCM_REVISION"); ok && scmRevision != "" {
+		ret.buildScmRevision = scmRevision
+	} else {
+		ret.buildScmRevision = "unknown"
+	}
+
 	if ret.UseRBE() {
 		for k, v := range getRBEVars(ctx, Config{ret}) {
 			ret.environ.Set(k, v)
@@ -674,6 +686,19 @@ func (c *configImpl) Arguments() []string {
 	return c.arguments
 }
 
+// relativeToTop returns path relative to the top of the source tree if it is inside the source
+// tree.  It is used for the directories that end up in the commands of the actions, like the
+// output directory and the JDK.  Actions are run from the top of the source tree, so their commands
+// then do not depend on where the source tree is checked out, which allows the outputs of the
+// actions to be shared between machines through the remote cache.  A path outside of the source
+// tree is returned unchanged.
+func relativeToTop(top, path string) string {
+	if rel, ok := relToTop(top, path); ok && rel != "." {
+		return rel
+	}
+	return filepath.Clean(path)
+}
+
 func (c *configImpl) OutDir() string {
 	if outDir, ok := c.environ.Get("OUT_DIR"); ok {
 		return outDir
@@ -853,6 +878,12 @@ func (c *configImpl) StartRBE() bool {
 	return true
 }
 
+// VerifyInputs returns true if the files read by each action should be compared with the inputs
+// declared for the action.
+func (c *configImpl) VerifyInputs() bool {
+	return c.environ.IsEnvTrue("SOONG_VERIFY_INPUTS")
+}
+
 func (c *configImpl) logDir() string {
 	if c.Dist() {
 		return filepath.Join(c.DistDir(), "logs")
@@ -1085,6 +1116,12 @@ func (c *configImpl) BuildDateTime() string {
 	return c.buildDateTime
 }
 
+// BuildScmRevision returns the source revision to stamp into build outputs, from
+// BUILD_SCM_REVISION.
+func (c *configImpl) BuildScmRevision() string {
+	return c.buildScmRevision
+}
+
 func (c *configImpl) MetricsUploaderApp() string {
 	if p, ok := c.environ.Get("ANDROID_ENABLE_METRICS_UPLOAD"); ok {
 		return p
@@ -995,3 +995,70 @@ func TestGetConfigArgsBuildModulesInDirectories(t *testing.T) {
 		})
 	}
 }
+
+func TestRelativeToTop(t *testing.T) {
+	tests := []struct {
+		outDir string
+		want   string
+	}{
+		{outDir: "out", want: "out"},
+		{outDir: "out/", want: "out"},
+		{outDir: "/src/out", want: "out"},
+		{outDir: "/src/../src/out/target", want: "out/target"},
+		{outDir: "/ssd/out", want: "/ssd/out"},
+		{outDir: "/src2/out", want: "/src2/out"},
+		{outDir: "/src", want: "/src"},
+	}
+	for _, tt := range tests {
+		if got := relativeToTop("/src", tt.outDir); got != tt.want {
+			t.Errorf("relativeToTop(%q): expected %q, got %q", tt.outDir, tt.want, got)
+		}
+	}
+}
+
+func TestConfigPathsRelativeToTop(t *testing.T) {
+	ctx := testContext()
+
+	top, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(top)
+	// The temporary directory may be behind a symlink, use the path of the working directory.
+	defer setTop(t, top)()
+	if top, err = os.Getwd(); err != nil {
+		t.Fatalf("could not get working directory: %v", err)
+	}
+
+	env := map[string]string{
+		"OUT_DIR":                    filepath.Join(top, "out"),
+		"DIST_DIR":                   filepath.Join(top, "out", "dist"),
+		"OVERRIDE_ANDROID_JAVA_HOME": filepath.Join(top, "prebuilts", "jdk", "jdk11", "linux-x86"),
+	}
+	for name, value := range env {
+		if old, ok := os.LookupEnv(name); ok {
+			defer os.Setenv(name, old)
+		} else {
+			defer os.Unsetenv(name)
+		}
+		os.Setenv(name, value)
+	}
+
+	config := NewConfig(ctx)
+
+	if g, w := config.OutDir(), "out"; g != w {
+		t.Errorf("expected OUT_DIR %q, got %q", w, g)
+	}
+	if g, w := config.DistDir(), "out/dist"; g != w {
+		t.Errorf("expected DIST_DIR %q, got %q", w, g)
+	}
+
+	// JAVA_HOME and PATH are only used to find java outside of the actions.
+	allowed := []string{"JAVA_HOME", "PATH"}
+	for _, v := range config.Environment().Environ() {
+		name := strings.SplitN(v, "=", 2)[0]
+		if strings.Contains(v, top) && indexList(name, allowed) == -1 {
+			t.Errorf("expected no absolute path to the source tree in the environment, found %q", v)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"android/soong/ui/metrics"
+)
+
+// The install journal records the files in the product out directory that were changed by the
+// builds since it was last consumed, so that adb sync and flashing tools can push only the modified
+// files to a device instead of comparing the whole staged image against it.
+//
+// After every build the size and modification time of each installable file listed by Kati is
+// compared with the snapshot taken after the previous build.  Each added or modified file is
+// journaled as "M <path>" and each file that is no longer installed as "D <path>", with paths
+// relative to the product out directory.  Entries accumulate over incremental builds, with the
+// latest change of a file replacing the earlier ones, until the tool that consumes the journal
+// removes it after syncing the device.
+
+const (
+	installJournalFile  = ".installed_files_changes"
+	installSnapshotFile = ".installed_files_snapshot"
+
+	installJournalModified = "M"
+	installJournalDeleted  = "D"
+)
+
+type installedFileState struct {
+	size  int64
+	mtime int64
+}
+
+func updateInstallJournal(ctx Context, config Config) {
+	ctx.BeginTrace(metrics.InstallJournal, "install journal")
+	defer ctx.EndTrace()
+
+	dir := config.ProductOut()
+
+	// cleanOldInstalledFiles has moved the list written by the last Kati run to .previous.
+	installed, err := readInstalledFilesList(filepath.Join(dir, installableFilesList(config)+".previous"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return
+		}
+		ctx.Fatalf("Failed to read the installed files list: %v", err)
+	}
+
+	if err := journalInstalledFiles(dir, installed); err != nil {
+		ctx.Fatalf("Failed to update the install journal: %v", err)
+	}
+}
+
+func readInstalledFilesList(file string) ([]string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// journalInstalledFiles adds the changes of the installed files in dir since the last snapshot to
+// the install journal and takes a new snapshot.
+func journalInstalledFiles(dir string, installed []string) error {
+	snapshotFile := filepath.Join(dir, installSnapshotFile)
+	journalFile := filepath.Join(dir, installJournalFile)
+
+	old, err := readInstalledFileStates(snapshotFile)
+	if err != nil {
+		return err
+	}
+	current := statInstalledFiles(dir, installed)
+
+	journal, err := readInstallJournal(journalFile)
+	if err != nil {
+		return err
+	}
+	for path, change := range diffInstalledFiles(old, current) {
+		journal[path] = change
+	}
+
+	// The journal is written before the snapshot so that the changes are never lost if the build
+	// is interrupted between the two.
+	if err := writeInstallJournal(journalFile, journal); err != nil {
+		return err
+	}
+	return writeInstalledFileStates(snapshotFile, current)
+}
+
+// statInstalledFiles returns the state of the installed files, skipping the ones that don't exist.
+func statInstalledFiles(dir string, installed []string) map[string]installedFileState {
+	states := make(map[string]installedFileState)
+	for _, path := range installed {
+		fi, err := os.Lstat(filepath.Join(dir, path))
+		if err != nil || fi.IsDir() {
+			continue
+		}
+		states[path] = installedFileState{size: fi.Size(), mtime: fi.ModTime().UnixNano()}
+	}
+	return states
+}
+
+// diffInstalledFiles returns the journal entries of the files that were added, modified or removed
+// between two snapshots.
+func diffInstalledFiles(old, current map[string]installedFileState) map[string]string {
+	changes := make(map[string]string)
+	for path, state := range current {
+		if oldState, ok := old[path]; !ok || oldState != state {
+			changes[path] = installJournalModified
+		}
+	}
+	for path := range old {
+		if _, ok := current[path]; !ok {
+			changes[path] = installJournalDeleted
+		}
+	}
+	return changes
+}
+
+func readInstalledFileStates(file string) (map[string]installedFileState, error) {
+	states := make(map[string]installedFileState)
+	err := readJournalLines(file, 3, func(fields []string) error {
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		mtime, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return err
+		}
+		states[fields[0]] = installedFileState{size: size, mtime: mtime}
+		return nil
+	})
+	return states, err
+}
+
+func writeInstalledFileStates(file string, states map[string]installedFileState) error {
+	var paths []string
+	for path := range states {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var b strings.Builder
+	for _, path := range paths {
+		fmt.Fprintf(&b, "%s %d %d\n", path, states[path].size, states[path].mtime)
+	}
+	return ioutil.WriteFile(file, []byte(b.String()), 0666)
+}
+
+func readInstallJournal(file string) (map[string]string, error) {
+	journal := make(map[string]string)
+	err := readJournalLines(file, 2, func(fields []string) error {
+		if fields[0] != installJournalModified && fields[0] != installJournalDeleted {
+			return fmt.Errorf("unknown change %q", fields[0])
+		}
+		journal[fields[1]] = fields[0]
+		return nil
+	})
+	return journal, err
+}
+
+func writeInstallJournal(file string, journal map[string]string) error {
+	var paths []string
+	for path := range journal {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var b strings.Builder
+	for _, path := range paths {
+		fmt.Fprintf(&b, "%s %s\n", journal[path], path)
+	}
+	return ioutil.WriteFile(file, []byte(b.String()), 0666)
+}
+
+// readJournalLines calls f with the fields of every line of file, which must have n fields each.  A
+// missing file is treated as an empty one.
+func readJournalLines(file string, n int, f func(fields []string) error) error {
+	r, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != n {
+			return fmt.Errorf("%s:%d: expected %d fields, got %d", file, lineNum, n, len(fields))
+		}
+		if err := f(fields); err != nil {
+			return fmt.Errorf("%s:%d: %v", file, lineNum, err)
+		}
+	}
+	return scanner.Err()
+}
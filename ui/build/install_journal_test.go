@@ -0,0 +1,96 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInstallJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "testinstalljournal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, content string, mtime time.Time) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	build := func(installed ...string) {
+		t.Helper()
+		if err := journalInstalledFiles(dir, installed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertJournal := func(expected string) {
+		t.Helper()
+		data, err := ioutil.ReadFile(filepath.Join(dir, installJournalFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("expected journal:\n%s\ngot:\n%s", expected, string(data))
+		}
+	}
+	consume := func() {
+		if err := os.Remove(filepath.Join(dir, installJournalFile)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t1 := time.Unix(1000, 0)
+	t2 := time.Unix(2000, 0)
+
+	// Everything is journaled by the first build.
+	write("system/app/a.apk", "a", t1)
+	write("system/lib/b.so", "b", t1)
+	build("system/app/a.apk", "system/lib/b.so")
+	assertJournal("M system/app/a.apk\nM system/lib/b.so\n")
+
+	// Nothing changes after the journal has been consumed.
+	consume()
+	build("system/app/a.apk", "system/lib/b.so")
+	assertJournal("")
+
+	// Modified and added files are journaled, and changes accumulate until the journal is
+	// consumed.
+	write("system/app/a.apk", "a", t2)
+	build("system/app/a.apk", "system/lib/b.so")
+	write("system/etc/c.xml", "c", t1)
+	build("system/app/a.apk", "system/etc/c.xml", "system/lib/b.so")
+	assertJournal("M system/app/a.apk\nM system/etc/c.xml\n")
+
+	// A file that is no longer installed is journaled as deleted, replacing its earlier change.
+	build("system/etc/c.xml", "system/lib/b.so")
+	assertJournal("D system/app/a.apk\nM system/etc/c.xml\n")
+
+	// A file that is installed again after being deleted is journaled as modified.
+	consume()
+	build("system/app/a.apk", "system/etc/c.xml", "system/lib/b.so")
+	assertJournal("M system/app/a.apk\n")
+}
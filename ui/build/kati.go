@@ -197,17 +197,21 @@ func cleanOldInstalledFiles(ctx Context, config Config) {
 	ctx.BeginTrace("clean", "clean old installed files")
 	defer ctx.EndTrace()
 
+	cleanOldFiles(ctx, config.ProductOut(), installableFilesList(config))
+
+	cleanOldFiles(ctx, config.HostOut(), ".installable_test_files")
+}
+
+// installableFilesList returns the name of the list of files installed into the product out
+// directory that is written by Kati.
+func installableFilesList(config Config) string {
 	// We shouldn't be removing files from one side of the two-step asan builds
-	var suffix string
 	if v, ok := config.Environment().Get("SANITIZE_TARGET"); ok {
 		if sanitize := strings.Fields(v); inList("address", sanitize) {
-			suffix = "_asan"
+			return ".installable_files_asan"
 		}
 	}
-
-	cleanOldFiles(ctx, config.ProductOut(), ".installable_files"+suffix)
-
-	cleanOldFiles(ctx, config.HostOut(), ".installable_test_files")
+	return ".installable_files"
 }
 
 func runKatiPackage(ctx Context, config Config) {
@@ -31,6 +31,18 @@ func runNinja(ctx Context, config Config) {
 	ctx.BeginTrace(metrics.PrimaryNinja, "ninja")
 	defer ctx.EndTrace()
 
+	var verifier *inputVerifier
+	succeeded := false
+	if config.VerifyInputs() {
+		verifier = newInputVerifier(ctx, config)
+		defer func() {
+			// Deferred so that it runs after the ninja status reader has reported every action.
+			if succeeded {
+				verifier.verify(ctx)
+			}
+		}()
+	}
+
 	fifo := filepath.Join(config.OutDir(), ".ninja_fifo")
 	nr := status.NewNinjaReader(ctx, ctx.Status.StartTool(), fifo)
 	defer nr.Close()
@@ -61,6 +73,10 @@ func runNinja(ctx Context, config Config) {
 		"-w", "dupbuild=err",
 		"-w", "missingdepfile=err")
 
+	if verifier != nil {
+		executable, args = verifier.wrap(executable, args)
+	}
+
 	cmd := Command(ctx, config, "ninja", executable, args...)
 	cmd.Sandbox = ninjaSandbox
 	if config.HasKatiSuffix() {
@@ -186,6 +202,7 @@ func runNinja(ctx Context, config Config) {
 
 	ctx.Status.Status("Starting ninja...")
 	cmd.RunAndStreamOrFatal()
+	succeeded = true
 }
 
 type statusChecker struct {
@@ -0,0 +1,335 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/scanner"
+
+	"android/soong/ui/metrics"
+)
+
+const (
+	// List of the output directories of the modules with remotely executed actions, built by the
+	// remote_modules target of Soong.
+	remoteModulesFilename = "remote_modules.txt"
+
+	// Status of the actions in the reproxy log that were served from the remote cache.
+	cacheHitStatus = "CACHE_HIT"
+)
+
+// rbeAction is an action read from the reproxy log.
+type rbeAction struct {
+	labels   string
+	outputs  []string
+	cacheHit bool
+}
+
+type cacheHits struct {
+	hits, total int
+}
+
+func (c cacheHits) ratio() float64 {
+	return float64(c.hits) / float64(c.total)
+}
+
+// DumpRBECacheHits writes the remote cache hit ratios of the actions executed through RBE, per
+// action type and per module, to the given file, so that actions with poor cacheability can be
+// identified.  Actions that are never served from the cache usually have non-deterministic outputs
+// or absolute paths in their commands.  It must be called after the proxy service has been shut
+// down by DumpRBEMetrics, which flushes the reproxy log.
+func DumpRBECacheHits(ctx Context, config Config, filename string) {
+	ctx.BeginTrace(metrics.RunShutdownTool, "dump_rbe_cache_hits")
+	defer ctx.EndTrace()
+
+	os.Remove(filename)
+
+	if !config.StartRBE() {
+		return
+	}
+
+	// Only the text format of the reproxy log can be read without the RBE protos.
+	logPath := config.rbeLogPath()
+	if !strings.HasPrefix(logPath, "text://") {
+		return
+	}
+
+	f, err := os.Open(strings.TrimPrefix(logPath, "text://"))
+	if err != nil {
+		ctx.Verbosef("failed to open reproxy log: %v", err)
+		return
+	}
+	defer f.Close()
+
+	actions, err := parseReproxyLog(f)
+	if err != nil {
+		ctx.Verbosef("failed to parse reproxy log: %v", err)
+		return
+	}
+
+	modules := make(map[string]string)
+	if m, err := os.Open(filepath.Join(config.SoongOutDir(), remoteModulesFilename)); err == nil {
+		modules = parseRemoteModules(m)
+		m.Close()
+	}
+
+	top, err := os.Getwd()
+	if err != nil {
+		ctx.Fatalln("Failed to get working directory:", err)
+	}
+
+	byLabels, byModule := countCacheHits(actions, modules, top)
+
+	sb := &strings.Builder{}
+	fmt.Fprintln(sb, "Remote cache hits by action type:")
+	writeCacheHits(sb, byLabels)
+	fmt.Fprintln(sb)
+	fmt.Fprintln(sb, "Remote cache hits by module:")
+	writeCacheHits(sb, byModule)
+
+	if err := ioutil.WriteFile(filename, []byte(sb.String()), 0666); err != nil {
+		ctx.Fatalf("failed to write %q: %v\n", filename, err)
+	}
+}
+
+// writeCacheHits writes the cache hits sorted from the lowest ratio to the highest.
+func writeCacheHits(w io.Writer, hits map[string]cacheHits) {
+	var keys []string
+	for k := range hits {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if ri, rj := hits[keys[i]].ratio(), hits[keys[j]].ratio(); ri != rj {
+			return ri < rj
+		}
+		return keys[i] < keys[j]
+	})
+	for _, k := range keys {
+		h := hits[k]
+		fmt.Fprintf(w, "  %s: %d/%d (%.1f%%)\n", k, h.hits, h.total, 100*h.ratio())
+	}
+}
+
+// countCacheHits returns the cache hits of the actions keyed by their labels and by the module
+// that the first output of the action belongs to.
+func countCacheHits(actions []rbeAction, modules map[string]string,
+	top string) (byLabels, byModule map[string]cacheHits) {
+
+	var dirs []string
+	relModules := make(map[string]string)
+	for dir, module := range modules {
+		if rel, ok := relToTop(top, dir); ok {
+			relModules[rel] = module
+			dirs = append(dirs, rel)
+		}
+	}
+	// Sort the longest directories first so that the most specific directory is matched.
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) > len(dirs[j]) })
+
+	byLabels = make(map[string]cacheHits)
+	byModule = make(map[string]cacheHits)
+	add := func(m map[string]cacheHits, key string, hit bool) {
+		c := m[key]
+		c.total++
+		if hit {
+			c.hits++
+		}
+		m[key] = c
+	}
+
+	for _, action := range actions {
+		add(byLabels, action.labels, action.cacheHit)
+
+		if len(action.outputs) == 0 {
+			continue
+		}
+		output, ok := relToTop(top, action.outputs[0])
+		if !ok {
+			continue
+		}
+		for _, dir := range dirs {
+			if strings.HasPrefix(output, dir+"/") {
+				add(byModule, relModules[dir], action.cacheHit)
+				break
+			}
+		}
+	}
+	return byLabels, byModule
+}
+
+// parseRemoteModules parses the remote modules file written by Soong into a map from output
+// directory to module name.
+func parseRemoteModules(r io.Reader) map[string]string {
+	modules := make(map[string]string)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if fields := strings.Fields(s.Text()); len(fields) == 2 {
+			modules[fields[0]] = fields[1]
+		}
+	}
+	return modules
+}
+
+// textField is a field of a message in the protobuf text format.
+type textField struct {
+	name   string
+	value  string
+	fields []*textField
+}
+
+// parseReproxyLog parses the log records written by reproxy in the protobuf text format.  Each
+// record starts with its command field.
+func parseReproxyLog(r io.Reader) ([]rbeAction, error) {
+	fields, err := parseTextFields(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var actions []rbeAction
+	var record []*textField
+	flush := func() {
+		if len(record) > 0 {
+			actions = append(actions, rbeActionFromRecord(record))
+		}
+		record = nil
+	}
+	for _, field := range fields {
+		if field.name == "command" {
+			flush()
+		}
+		record = append(record, field)
+	}
+	flush()
+	return actions, nil
+}
+
+func rbeActionFromRecord(record []*textField) rbeAction {
+	var action rbeAction
+	var labels []string
+	for _, field := range record {
+		switch field.name {
+		case "command":
+			for _, output := range findTextFields(field.fields, "output", "output_files") {
+				action.outputs = append(action.outputs, output.value)
+			}
+		case "result":
+			for _, status := range findTextFields(field.fields, "status") {
+				action.cacheHit = action.cacheHit || status.value == cacheHitStatus
+			}
+		case "remote_metadata":
+			for _, cacheHit := range findTextFields(field.fields, "cache_hit") {
+				action.cacheHit = action.cacheHit || cacheHit.value == "true"
+			}
+		case "local_metadata":
+			for _, label := range findTextFields(field.fields, "labels") {
+				key := findTextFields(label.fields, "key")
+				value := findTextFields(label.fields, "value")
+				if len(key) == 1 && len(value) == 1 {
+					labels = append(labels, key[0].value+"="+value[0].value)
+				}
+			}
+		}
+	}
+	sort.Strings(labels)
+	action.labels = strings.Join(labels, ",")
+	return action
+}
+
+// findTextFields returns the fields found by following the given path of field names.
+func findTextFields(fields []*textField, path ...string) []*textField {
+	var ret []*textField
+	for _, field := range fields {
+		if field.name != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			ret = append(ret, field)
+		} else {
+			ret = append(ret, findTextFields(field.fields, path[1:]...)...)
+		}
+	}
+	return ret
+}
+
+// parseTextFields parses a sequence of fields in the protobuf text format.
+func parseTextFields(r io.Reader) ([]*textField, error) {
+	var s scanner.Scanner
+	s.Init(r)
+	s.Mode = scanner.ScanIdents | scanner.ScanInts | scanner.ScanFloats | scanner.ScanStrings
+	var errs []string
+	s.Error = func(s *scanner.Scanner, msg string) {
+		errs = append(errs, fmt.Sprintf("%s: %s", s.Position, msg))
+	}
+
+	var parse func(end rune) ([]*textField, error)
+	parse = func(end rune) ([]*textField, error) {
+		var fields []*textField
+		for {
+			tok := s.Scan()
+			if tok == end {
+				return fields, nil
+			}
+			if tok != scanner.Ident {
+				return nil, fmt.Errorf("%s: expected field name, found %q", s.Position, s.TokenText())
+			}
+			field := &textField{name: s.TokenText()}
+			fields = append(fields, field)
+
+			var err error
+			tok = s.Scan()
+			if tok == ':' {
+				tok = s.Scan()
+			}
+			switch tok {
+			case '{', '<':
+				closing := '}'
+				if tok == '<' {
+					closing = '>'
+				}
+				field.fields, err = parse(closing)
+				if err != nil {
+					return nil, err
+				}
+			case scanner.String:
+				field.value, err = strconv.Unquote(s.TokenText())
+				if err != nil {
+					return nil, fmt.Errorf("%s: %s", s.Position, err)
+				}
+			case '-':
+				s.Scan()
+				field.value = "-" + s.TokenText()
+			case scanner.Ident, scanner.Int, scanner.Float:
+				field.value = s.TokenText()
+			default:
+				return nil, fmt.Errorf("%s: expected value of %s, found %q", s.Position, field.name,
+					s.TokenText())
+			}
+		}
+	}
+
+	fields, err := parse(scanner.EOF)
+	if err == nil && len(errs) > 0 {
+		err = fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+	return fields, err
+}
@@ -0,0 +1,141 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testReproxyLog = `command: {
+  identifiers: {
+    command_id: "1"
+  }
+  args: "prebuilts/clang/bin/clang++"
+  output: {
+    output_files: "out/soong/.intermediates/frameworks/libfoo/android_arm64_shared/obj/foo.o"
+  }
+}
+result: {
+  status: CACHE_HIT
+}
+remote_metadata: {
+  cache_hit: true
+}
+local_metadata: {
+  labels: {
+    key: "type"
+    value: "compile"
+  }
+  labels: {
+    key: "lang"
+    value: "cpp"
+  }
+}
+
+command: {
+  output: {
+    output_files: "out/soong/.intermediates/frameworks/libfoo/android_arm64_shared/obj/bar.o"
+  }
+}
+result: {
+  status: SUCCESS
+  exit_code: -1
+}
+local_metadata: {
+  labels: {
+    key: "lang"
+    value: "cpp"
+  }
+  labels: {
+    key: "type"
+    value: "compile"
+  }
+}
+
+command: {
+  output: {
+    output_files: "/top/out/soong/.intermediates/frameworks/framework/android_common/javac/classes.jar"
+  }
+}
+result: {
+  status: SUCCESS
+}
+local_metadata: {
+  labels: {
+    key: "type"
+    value: "tool"
+  }
+  labels: {
+    key: "tool"
+    value: "javac"
+  }
+}
+`
+
+func TestParseReproxyLog(t *testing.T) {
+	actions, err := parseReproxyLog(strings.NewReader(testReproxyLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []rbeAction{
+		{
+			labels:   "lang=cpp,type=compile",
+			outputs:  []string{"out/soong/.intermediates/frameworks/libfoo/android_arm64_shared/obj/foo.o"},
+			cacheHit: true,
+		},
+		{
+			labels:  "lang=cpp,type=compile",
+			outputs: []string{"out/soong/.intermediates/frameworks/libfoo/android_arm64_shared/obj/bar.o"},
+		},
+		{
+			labels:  "tool=javac,type=tool",
+			outputs: []string{"/top/out/soong/.intermediates/frameworks/framework/android_common/javac/classes.jar"},
+		},
+	}
+	if !reflect.DeepEqual(actions, expected) {
+		t.Errorf("expected actions:\n%v\ngot:\n%v", expected, actions)
+	}
+
+	modules := parseRemoteModules(strings.NewReader(
+		"out/soong/.intermediates/frameworks/libfoo/android_arm64_shared libfoo\n" +
+			"/top/out/soong/.intermediates/frameworks/framework/android_common framework\n"))
+
+	byLabels, byModule := countCacheHits(actions, modules, "/top")
+
+	expectedByLabels := map[string]cacheHits{
+		"lang=cpp,type=compile": {hits: 1, total: 2},
+		"tool=javac,type=tool":  {hits: 0, total: 1},
+	}
+	if !reflect.DeepEqual(byLabels, expectedByLabels) {
+		t.Errorf("expected cache hits by action type:\n%v\ngot:\n%v", expectedByLabels, byLabels)
+	}
+
+	expectedByModule := map[string]cacheHits{
+		"libfoo":    {hits: 1, total: 2},
+		"framework": {hits: 0, total: 1},
+	}
+	if !reflect.DeepEqual(byModule, expectedByModule) {
+		t.Errorf("expected cache hits by module:\n%v\ngot:\n%v", expectedByModule, byModule)
+	}
+}
+
+func TestParseReproxyLogError(t *testing.T) {
+	if _, err := parseReproxyLog(strings.NewReader("command: {\n  args: ")); err == nil {
+		t.Error("expected an error for a truncated log")
+	}
+}
@@ -15,6 +15,8 @@
 package build
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -126,4 +128,59 @@ func runSoong(ctx Context, config Config) {
 
 	ninja("minibootstrap", ".minibootstrap/build.ninja")
 	ninja("bootstrap", ".bootstrap/build.ninja")
+
+	loadExperimentalFeatureMetrics(ctx, config)
+	loadGenruleNetworkAccessMetrics(ctx, config)
+}
+
+// loadExperimentalFeatureMetrics adds the adoption of the experimental features, which soong_build
+// writes to .experimental_features.metrics as "<feature> <modules> <enabled modules>" lines, to
+// the build metrics.
+func loadExperimentalFeatureMetrics(ctx Context, config Config) {
+	if ctx.Metrics == nil {
+		return
+	}
+
+	file := filepath.Join(config.SoongOutDir(), ".experimental_features.metrics")
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		ctx.Fatalf("Failed to read experimental features metrics (%q): %v", file, err)
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		var feature string
+		var modules, enabled uint32
+		if _, err := fmt.Sscanf(line, "%s %d %d", &feature, &modules, &enabled); err != nil {
+			ctx.Fatalf("Malformed line in experimental features metrics (%q): %q", file, line)
+		}
+		ctx.Metrics.AddExperimentalFeature(feature, modules, enabled)
+	}
+}
+
+// loadGenruleNetworkAccessMetrics adds the number of genrules that opted out of running their
+// command without network access, which soong_build writes to .genrule_network_access.metrics, to
+// the build metrics.
+func loadGenruleNetworkAccessMetrics(ctx Context, config Config) {
+	if ctx.Metrics == nil {
+		return
+	}
+
+	file := filepath.Join(config.SoongOutDir(), ".genrule_network_access.metrics")
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		ctx.Fatalf("Failed to read genrule network access metrics (%q): %v", file, err)
+	}
+
+	count, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 32)
+	if err != nil {
+		ctx.Fatalf("Malformed genrule network access metrics (%q): %v", file, err)
+	}
+	ctx.Metrics.SetGenruleNetworkAccessCount(uint32(count))
 }
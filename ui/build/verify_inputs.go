@@ -0,0 +1,448 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"android/soong/ui/metrics"
+	"android/soong/ui/status"
+)
+
+// Input verification is a build mode, enabled with SOONG_VERIFY_INPUTS=true, that runs ninja under
+// strace to record every file read by each action, and reports the files that an action read
+// without declaring them as inputs.  An undeclared input does not cause the action to be rerun
+// when it changes, so each one is a potential incremental build failure.
+//
+// Only actions that ninja runs are checked, so the report is only complete for a clean build.
+// Actions that are executed remotely through goma or RBE do not read their inputs locally, and
+// reads relative to a directory file descriptor other than the working directory are ignored.
+
+// inputVerifier records the declared inputs and outputs of the actions started by ninja, keyed by
+// their command, so that they can be compared with the files read by the commands.
+type inputVerifier struct {
+	strace  string
+	clone3  bool
+	trace   string
+	pidFile string
+	report  string
+	actions map[string]*status.Action
+
+	config Config
+}
+
+func newInputVerifier(ctx Context, config Config) *inputVerifier {
+	strace, err := exec.LookPath("strace")
+	if err != nil {
+		ctx.Fatalln("SOONG_VERIFY_INPUTS requires strace:", err)
+	}
+	if config.UseGoma() || config.UseRBE() {
+		ctx.Println("Actions executed remotely will not be checked for undeclared inputs.")
+	}
+
+	// strace only knows about clone3 since version 5.3, and fails to start with an unknown system
+	// call in the filter.  Without it, the processes that are started with clone3 are still traced
+	// by -f, but their reads can't be attributed to the action that started them.
+	clone3 := exec.Command(strace, "-qq", "-e", "trace=clone3", "-o", os.DevNull, "true").Run() == nil
+	if !clone3 {
+		ctx.Verboseln("strace does not support clone3, processes started with it will not be checked")
+	}
+
+	v := &inputVerifier{
+		strace:  strace,
+		clone3:  clone3,
+		trace:   filepath.Join(config.OutDir(), ".verify_inputs.trace"),
+		pidFile: filepath.Join(config.OutDir(), ".verify_inputs.pid"),
+		report:  filepath.Join(config.logDir(), "undeclared_inputs.txt"),
+		actions: make(map[string]*status.Action),
+		config:  config,
+	}
+	ctx.Status.AddOutput(v)
+	return v
+}
+
+// wrap returns the executable and arguments that run the given command under strace.  The command
+// is started by a shell that writes its pid to the pid file before replacing itself with the
+// command, so that the process of the command can be found in the trace.
+func (v *inputVerifier) wrap(executable string, args []string) (string, []string) {
+	syscalls := "execve,open,openat,chdir,clone,fork,vfork"
+	if v.clone3 {
+		syscalls += ",clone3"
+	}
+	return v.strace, append([]string{
+		"-f", "-qq",
+		"-s", "1048576",
+		"-e", "trace=" + syscalls,
+		"-e", "signal=none",
+		"-o", v.trace,
+		"/bin/sh", "-c", `echo $$ > "$0" && exec "$@"`, v.pidFile,
+		executable,
+	}, args...)
+}
+
+// verify compares the files read by each action with its declared inputs and outputs, and writes
+// the undeclared ones to the report.
+func (v *inputVerifier) verify(ctx Context) {
+	ctx.BeginTrace(metrics.VerifyInputs, "verify inputs")
+	defer ctx.EndTrace()
+
+	top, err := os.Getwd()
+	if err != nil {
+		ctx.Fatalln("Failed to get working directory:", err)
+	}
+
+	pid, err := ioutil.ReadFile(v.pidFile)
+	if err != nil {
+		ctx.Fatalln("Failed to read ninja pid:", err)
+	}
+	ninja, err := strconv.Atoi(strings.TrimSpace(string(pid)))
+	if err != nil {
+		ctx.Fatalln("Failed to parse ninja pid:", err)
+	}
+
+	f, err := os.Open(v.trace)
+	if err != nil {
+		ctx.Fatalln("Failed to open strace output:", err)
+	}
+	defer f.Close()
+
+	reads, err := parseTrace(f, top, ninja)
+	if err != nil {
+		ctx.Fatalln("Failed to parse strace output:", err)
+	}
+
+	// The inputs that ninja discovered from the depfiles of the actions are declared too, but
+	// they aren't part of the actions reported to the status outputs.
+	cmd := Command(ctx, v.config, "ninja deps", v.config.PrebuiltBuildTool("ninja"),
+		"-f", v.config.CombinedNinjaFile(), "-t", "deps")
+	depfileDeps, err := parseNinjaDeps(bytes.NewReader(cmd.OutputOrFatal()))
+	if err != nil {
+		ctx.Fatalln("Failed to parse ninja deps:", err)
+	}
+
+	undeclared := undeclaredInputs(reads, v.actions, depfileDeps, top, isRegularFile)
+
+	sb := &strings.Builder{}
+	for _, u := range undeclared {
+		fmt.Fprintln(sb, u.output)
+		for _, input := range u.inputs {
+			fmt.Fprintln(sb, "    ", input)
+		}
+	}
+	if err := ioutil.WriteFile(v.report, []byte(sb.String()), 0666); err != nil {
+		ctx.Fatalln("Failed to write undeclared inputs report:", err)
+	}
+
+	if len(undeclared) > 0 {
+		ctx.Printf("%d actions read undeclared inputs, see %s", len(undeclared), v.report)
+	}
+	os.Remove(v.trace)
+	os.Remove(v.pidFile)
+}
+
+func (v *inputVerifier) StartAction(action *status.Action, counts status.Counts) {
+	if action.Command != "" {
+		v.actions[action.Command] = action
+	}
+}
+
+func (v *inputVerifier) FinishAction(result status.ActionResult, counts status.Counts) {}
+func (v *inputVerifier) Message(level status.MsgLevel, msg string)                     {}
+func (v *inputVerifier) Flush()                                                        {}
+func (v *inputVerifier) Write(p []byte) (int, error)                                   { return len(p), nil }
+
+var _ status.StatusOutput = (*inputVerifier)(nil)
+
+func isRegularFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+type undeclaredInput struct {
+	output string
+	inputs []string
+}
+
+// parseNinjaDeps parses the output of ninja -t deps, and returns the dependencies that ninja
+// recorded from the depfile of each output.
+func parseNinjaDeps(r io.Reader) (map[string][]string, error) {
+	deps := make(map[string][]string)
+	var output string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if output != "" {
+				deps[output] = append(deps[output], strings.TrimSpace(line))
+			}
+			continue
+		}
+		// out/foo.o: #deps 2, deps mtime 1234 (VALID)
+		i := strings.LastIndex(line, ": #deps ")
+		if i == -1 {
+			return nil, fmt.Errorf("unexpected line %q", line)
+		}
+		output = line[:i]
+	}
+	return deps, scanner.Err()
+}
+
+// undeclaredInputs returns, for each action, the regular files that the action read that are
+// neither inputs, outputs nor depfile dependencies of the action, sorted by the first output of
+// the action.
+func undeclaredInputs(reads map[string]map[string]bool, actions map[string]*status.Action,
+	depfileDeps map[string][]string, top string, isFile func(string) bool) []undeclaredInput {
+
+	var ret []undeclaredInput
+	for command, files := range reads {
+		action := actions[command]
+		if action == nil || len(action.Outputs) == 0 {
+			continue
+		}
+
+		declared := make(map[string]bool)
+		paths := append(append([]string(nil), action.Inputs...), action.Outputs...)
+		for _, output := range action.Outputs {
+			paths = append(paths, depfileDeps[output]...)
+		}
+		for _, path := range paths {
+			if rel, ok := relToTop(top, path); ok {
+				declared[rel] = true
+			}
+		}
+
+		var inputs []string
+		for file := range files {
+			if !declared[file] && isFile(file) {
+				inputs = append(inputs, file)
+			}
+		}
+		if len(inputs) > 0 {
+			sort.Strings(inputs)
+			ret = append(ret, undeclaredInput{output: action.Outputs[0], inputs: inputs})
+		}
+	}
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].output < ret[j].output })
+	return ret
+}
+
+// relToTop returns the path relative to the top of the source tree, or false if the path is
+// outside of it.
+func relToTop(top, path string) (string, bool) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(top, path)
+	}
+	rel, err := filepath.Rel(top, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+	return rel, true
+}
+
+var straceLineRe = regexp.MustCompile(`^(\d+)\s+(\w+)\((.*)\)\s+=\s+(-?\d+)`)
+
+type tracedProcess struct {
+	parent int
+	cwd    string
+	// command is the command of the ninja action that the process is part of.
+	command string
+}
+
+type traceParser struct {
+	top   string
+	ninja int
+	procs map[int]*tracedProcess
+
+	// unfinished contains the start of system calls that were interrupted by another process.
+	unfinished map[int]string
+
+	// pending contains the system calls of processes whose parent has not been seen yet.
+	pending map[int][]string
+
+	reads map[string]map[string]bool
+}
+
+// parseTrace parses the output of strace -f for ninja running in the process with the given pid,
+// and returns the files under top that were read by each action, keyed by the command of the
+// action.  Actions are the processes that ninja starts with sh -c, together with all of their
+// descendants.
+func parseTrace(r io.Reader, top string, ninja int) (map[string]map[string]bool, error) {
+	p := &traceParser{
+		top:        top,
+		ninja:      ninja,
+		procs:      map[int]*tracedProcess{ninja: {}},
+		unfinished: make(map[int]string),
+		pending:    make(map[int][]string),
+		reads:      make(map[string]map[string]bool),
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		p.line(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return p.reads, nil
+}
+
+func (p *traceParser) line(line string) {
+	fields := strings.SplitN(line, " ", 2)
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil || len(fields) < 2 {
+		return
+	}
+	rest := strings.TrimSpace(fields[1])
+
+	// Join system calls that strace split in two because another process made a system call
+	// while they were in progress.
+	if strings.HasSuffix(rest, "<unfinished ...>") {
+		p.unfinished[pid] = strings.TrimSuffix(rest, "<unfinished ...>")
+		return
+	}
+	if strings.HasPrefix(rest, "<... ") {
+		i := strings.Index(rest, " resumed>")
+		if i == -1 {
+			return
+		}
+		rest = p.unfinished[pid] + rest[i+len(" resumed>"):]
+		delete(p.unfinished, pid)
+	}
+
+	if p.procs[pid] == nil {
+		p.pending[pid] = append(p.pending[pid], rest)
+		return
+	}
+	p.syscall(pid, rest)
+}
+
+func (p *traceParser) syscall(pid int, call string) {
+	m := straceLineRe.FindStringSubmatch(strconv.Itoa(pid) + " " + call)
+	if m == nil {
+		return
+	}
+	name, args := m[2], m[3]
+	ret, _ := strconv.Atoi(m[4])
+	if ret < 0 {
+		return
+	}
+	proc := p.procs[pid]
+
+	switch name {
+	case "clone", "clone3", "fork", "vfork":
+		child := &tracedProcess{parent: pid, cwd: proc.cwd, command: proc.command}
+		p.procs[ret] = child
+		for _, pending := range p.pending[ret] {
+			p.syscall(ret, pending)
+		}
+		delete(p.pending, ret)
+	case "execve":
+		strs := straceStrings(args)
+		if len(strs) == 0 {
+			return
+		}
+		if proc.parent == p.ninja && len(strs) >= 4 && strs[2] == "-c" {
+			proc.command = strs[3]
+		}
+		p.read(proc, strs[0])
+	case "chdir":
+		if strs := straceStrings(args); len(strs) > 0 {
+			proc.cwd = p.resolve(proc, strs[0])
+		}
+	case "open", "openat":
+		if name == "openat" && !strings.HasPrefix(args, "AT_FDCWD,") {
+			return
+		}
+		strs := straceStrings(args)
+		if len(strs) == 0 {
+			return
+		}
+		flags := args[strings.LastIndex(args, `",`)+1:]
+		for _, flag := range []string{"O_WRONLY", "O_RDWR", "O_CREAT", "O_DIRECTORY"} {
+			if strings.Contains(flags, flag) {
+				return
+			}
+		}
+		p.read(proc, strs[0])
+	}
+}
+
+// resolve returns the absolute path of a path used by the process.
+func (p *traceParser) resolve(proc *tracedProcess, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	if proc.cwd != "" {
+		return filepath.Join(proc.cwd, path)
+	}
+	return filepath.Join(p.top, path)
+}
+
+func (p *traceParser) read(proc *tracedProcess, path string) {
+	if proc.command == "" {
+		return
+	}
+	rel, ok := relToTop(p.top, p.resolve(proc, path))
+	if !ok {
+		return
+	}
+	if p.reads[proc.command] == nil {
+		p.reads[proc.command] = make(map[string]bool)
+	}
+	p.reads[proc.command][rel] = true
+}
+
+// straceStrings returns the quoted strings in the arguments of a system call printed by strace.
+func straceStrings(args string) []string {
+	var strs []string
+	for i := 0; i < len(args); i++ {
+		if args[i] != '"' {
+			continue
+		}
+		j := i + 1
+		for ; j < len(args) && args[j] != '"'; j++ {
+			if args[j] == '\\' {
+				j++
+			}
+		}
+		if j >= len(args) {
+			break
+		}
+		s, err := strconv.Unquote(args[i : j+1])
+		if err != nil {
+			s = args[i+1 : j]
+		}
+		strs = append(strs, s)
+		i = j
+	}
+	return strs
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"android/soong/ui/status"
+)
+
+const testTrace = `99 openat(AT_FDCWD, "e.txt", O_RDONLY) = 3
+100 execve("/bin/sh", ["/bin/sh", "-c", "echo $$ > \"$0\" && exec \"$@\"", "out/.verify_inputs.pid", "/prebuilts/ninja", "-f", "out/combined.ninja"], 0x7ffd /* 20 vars */) = 0
+100 openat(AT_FDCWD, "out/.verify_inputs.pid", O_WRONLY|O_CREAT|O_TRUNC, 0666) = 3
+100 execve("/prebuilts/ninja", ["ninja", "-f", "out/combined.ninja"], 0x7ffd /* 20 vars */) = 0
+100 openat(AT_FDCWD, "out/combined.ninja", O_RDONLY) = 3
+100 clone(child_stack=NULL, flags=CLONE_VM|CLONE_VFORK|SIGCHLD <unfinished ...>
+101 execve("/bin/sh", ["/bin/sh", "-c", "cp a.txt out/a.txt && cat \"b.txt\""], 0x7ffd /* 20 vars */) = 0
+100 <... clone resumed>) = 101
+101 openat(AT_FDCWD, "/etc/ld.so.cache", O_RDONLY|O_CLOEXEC) = 3
+101 clone(child_stack=NULL, flags=CLONE_CHILD_SETTID|SIGCHLD) = 102
+102 execve("/bin/cp", ["cp", "a.txt", "out/a.txt"], 0x7ffd /* 20 vars */) = 0
+102 openat(AT_FDCWD, "a.txt", O_RDONLY) = 3
+102 openat(AT_FDCWD, "out/a.txt", O_WRONLY|O_CREAT|O_TRUNC, 0644) = 4
+101 clone(child_stack=NULL, flags=CLONE_CHILD_SETTID|SIGCHLD) = 103
+103 execve("/bin/cat", ["cat", "b.txt"], 0x7ffd /* 20 vars */) = 0
+103 openat(AT_FDCWD, "b.txt", O_RDONLY) = 3
+103 openat(AT_FDCWD, "missing.txt", O_RDONLY) = -1 ENOENT (No such file or directory)
+100 clone(child_stack=NULL, flags=CLONE_VM|CLONE_VFORK|SIGCHLD) = 104
+104 execve("/bin/sh", ["/bin/sh", "-c", "cd sub && tool"], 0x7ffd /* 20 vars */) = 0
+104 chdir("sub") = 0
+104 execve("/top/sub/tool", ["tool"], 0x7ffd /* 20 vars */) = 0
+104 open("../c.txt", O_RDONLY) = 3
+104 openat(AT_FDCWD, "lib", O_RDONLY|O_DIRECTORY) = 3
+104 openat(3, "d.txt", O_RDONLY) = 4
+`
+
+func TestParseTrace(t *testing.T) {
+	reads, err := parseTrace(strings.NewReader(testTrace), "/top", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]map[string]bool{
+		`cp a.txt out/a.txt && cat "b.txt"`: {
+			"a.txt": true,
+			"b.txt": true,
+		},
+		"cd sub && tool": {
+			"sub/tool": true,
+			"c.txt":    true,
+		},
+	}
+	if !reflect.DeepEqual(reads, expected) {
+		t.Errorf("expected reads:\n%v\ngot:\n%v", expected, reads)
+	}
+}
+
+func TestUndeclaredInputs(t *testing.T) {
+	reads := map[string]map[string]bool{
+		"cmd a": {"a.txt": true, "b.txt": true, "out/a.txt": true},
+		"cmd b": {"sub/tool": true, "c.txt": true, "deleted.tmp": true, "b.h": true},
+		"cmd c": {"unknown.txt": true},
+	}
+	actions := map[string]*status.Action{
+		"cmd a": {Inputs: []string{"a.txt"}, Outputs: []string{"out/a.txt"}},
+		"cmd b": {Inputs: []string{"/top/sub/tool"}, Outputs: []string{"out/b.txt"}},
+	}
+	depfileDeps := map[string][]string{
+		"out/b.txt": {"b.h"},
+	}
+	isFile := func(path string) bool { return path != "deleted.tmp" }
+
+	expected := []undeclaredInput{
+		{output: "out/a.txt", inputs: []string{"b.txt"}},
+		{output: "out/b.txt", inputs: []string{"c.txt"}},
+	}
+	if g := undeclaredInputs(reads, actions, depfileDeps, "/top", isFile); !reflect.DeepEqual(g, expected) {
+		t.Errorf("expected undeclared inputs:\n%v\ngot:\n%v", expected, g)
+	}
+}
+
+func TestParseNinjaDeps(t *testing.T) {
+	input := `out/b.o: #deps 2, deps mtime 1234 (VALID)
+    b.c
+    b.h
+
+out/c.o: #deps 1, deps mtime 1235 (STALE)
+    c.c
+
+`
+	deps, err := parseNinjaDeps(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]string{
+		"out/b.o": {"b.c", "b.h"},
+		"out/c.o": {"c.c"},
+	}
+	if !reflect.DeepEqual(deps, expected) {
+		t.Errorf("expected deps:\n%v\ngot:\n%v", expected, deps)
+	}
+}
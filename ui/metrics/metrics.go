@@ -26,6 +26,7 @@ import (
 )
 
 const (
+	InstallJournal  = "install_journal"
 	PrimaryNinja    = "ninja"
 	RunKati         = "kati"
 	RunSetupTool    = "setup"
@@ -33,6 +34,7 @@ const (
 	RunSoong        = "soong"
 	TestRun         = "test"
 	Total           = "total"
+	VerifyInputs    = "verify_inputs"
 )
 
 type Metrics struct {
@@ -61,11 +63,32 @@ func (m *Metrics) SetTimeMetrics(perf soong_metrics_proto.PerfInfo) {
 		break
 	case Total:
 		m.metrics.Total = &perf
+	case VerifyInputs:
+		m.metrics.VerifyInputsRuns = append(m.metrics.VerifyInputsRuns, &perf)
+	case InstallJournal:
+		m.metrics.InstallJournalRuns = append(m.metrics.InstallJournalRuns, &perf)
 	default:
 		// ignored
 	}
 }
 
+// AddExperimentalFeature records the number of modules that checked an experimental feature, and
+// the number of modules that it is enabled for.
+func (m *Metrics) AddExperimentalFeature(name string, numOfModules, numOfEnabledModules uint32) {
+	m.metrics.ExperimentalFeatures = append(m.metrics.ExperimentalFeatures,
+		&soong_metrics_proto.ExperimentalFeatureInfo{
+			Name:                proto.String(name),
+			NumOfModules:        proto.Uint32(numOfModules),
+			NumOfEnabledModules: proto.Uint32(numOfEnabledModules),
+		})
+}
+
+// SetGenruleNetworkAccessCount records the number of genrules that opted out of running their
+// command without network access.
+func (m *Metrics) SetGenruleNetworkAccessCount(count uint32) {
+	m.metrics.GenruleNetworkAccessCount = proto.Uint32(count)
+}
+
 func (m *Metrics) BuildConfig(b *soong_metrics_proto.BuildConfig) {
 	m.metrics.BuildConfig = b
 }
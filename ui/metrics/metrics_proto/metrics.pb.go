@@ -197,11 +197,19 @@ type MetricsBase struct {
 	// The metrics for calling Ninja.
 	NinjaRuns []*PerfInfo `protobuf:"bytes,20,rep,name=ninja_runs,json=ninjaRuns" json:"ninja_runs,omitempty"`
 	// The metrics for the whole build
-	Total                *PerfInfo    `protobuf:"bytes,21,opt,name=total" json:"total,omitempty"`
-	BuildConfig          *BuildConfig `protobuf:"bytes,23,opt,name=build_config,json=buildConfig" json:"build_config,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
-	XXX_unrecognized     []byte       `json:"-"`
-	XXX_sizecache        int32        `json:"-"`
+	Total       *PerfInfo    `protobuf:"bytes,21,opt,name=total" json:"total,omitempty"`
+	BuildConfig *BuildConfig `protobuf:"bytes,23,opt,name=build_config,json=buildConfig" json:"build_config,omitempty"`
+	// The metrics for verifying the inputs of the actions run by Ninja.
+	VerifyInputsRuns []*PerfInfo `protobuf:"bytes,24,rep,name=verify_inputs_runs,json=verifyInputsRuns" json:"verify_inputs_runs,omitempty"`
+	// The metrics for updating the install journal after Ninja.
+	InstallJournalRuns []*PerfInfo `protobuf:"bytes,25,rep,name=install_journal_runs,json=installJournalRuns" json:"install_journal_runs,omitempty"`
+	// The adoption of the experimental features that were checked by modules.
+	ExperimentalFeatures []*ExperimentalFeatureInfo `protobuf:"bytes,26,rep,name=experimental_features,json=experimentalFeatures" json:"experimental_features,omitempty"`
+	// The number of genrules that opted out of running their command without network access.
+	GenruleNetworkAccessCount *uint32  `protobuf:"varint,27,opt,name=genrule_network_access_count,json=genruleNetworkAccessCount" json:"genrule_network_access_count,omitempty"`
+	XXX_NoUnkeyedLiteral      struct{} `json:"-"`
+	XXX_unrecognized          []byte   `json:"-"`
+	XXX_sizecache             int32    `json:"-"`
 }
 
 func (m *MetricsBase) Reset()         { *m = MetricsBase{} }
@@ -388,6 +396,34 @@ func (m *MetricsBase) GetBuildConfig() *BuildConfig {
 	return nil
 }
 
+func (m *MetricsBase) GetVerifyInputsRuns() []*PerfInfo {
+	if m != nil {
+		return m.VerifyInputsRuns
+	}
+	return nil
+}
+
+func (m *MetricsBase) GetInstallJournalRuns() []*PerfInfo {
+	if m != nil {
+		return m.InstallJournalRuns
+	}
+	return nil
+}
+
+func (m *MetricsBase) GetExperimentalFeatures() []*ExperimentalFeatureInfo {
+	if m != nil {
+		return m.ExperimentalFeatures
+	}
+	return nil
+}
+
+func (m *MetricsBase) GetGenruleNetworkAccessCount() uint32 {
+	if m != nil && m.GenruleNetworkAccessCount != nil {
+		return *m.GenruleNetworkAccessCount
+	}
+	return 0
+}
+
 type BuildConfig struct {
 	UseGoma              *bool    `protobuf:"varint,1,opt,name=use_goma,json=useGoma" json:"use_goma,omitempty"`
 	UseRbe               *bool    `protobuf:"varint,2,opt,name=use_rbe,json=useRbe" json:"use_rbe,omitempty"`
@@ -670,6 +706,64 @@ func (m *CriticalUserJourneysMetrics) GetCujs() []*CriticalUserJourneyMetrics {
 	return nil
 }
 
+type ExperimentalFeatureInfo struct {
+	// The name of the experimental feature, eg. r8_full_mode.
+	Name *string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	// The number of modules that checked the feature.
+	NumOfModules *uint32 `protobuf:"varint,2,opt,name=num_of_modules,json=numOfModules" json:"num_of_modules,omitempty"`
+	// The number of modules that the feature is enabled for.
+	NumOfEnabledModules  *uint32  `protobuf:"varint,3,opt,name=num_of_enabled_modules,json=numOfEnabledModules" json:"num_of_enabled_modules,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ExperimentalFeatureInfo) Reset()         { *m = ExperimentalFeatureInfo{} }
+func (m *ExperimentalFeatureInfo) String() string { return proto.CompactTextString(m) }
+func (*ExperimentalFeatureInfo) ProtoMessage()    {}
+func (*ExperimentalFeatureInfo) Descriptor() ([]byte, []int) {
+	return fileDescriptor_6039342a2ba47b72, []int{6}
+}
+
+func (m *ExperimentalFeatureInfo) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ExperimentalFeatureInfo.Unmarshal(m, b)
+}
+func (m *ExperimentalFeatureInfo) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ExperimentalFeatureInfo.Marshal(b, m, deterministic)
+}
+func (m *ExperimentalFeatureInfo) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ExperimentalFeatureInfo.Merge(m, src)
+}
+func (m *ExperimentalFeatureInfo) XXX_Size() int {
+	return xxx_messageInfo_ExperimentalFeatureInfo.Size(m)
+}
+func (m *ExperimentalFeatureInfo) XXX_DiscardUnknown() {
+	xxx_messageInfo_ExperimentalFeatureInfo.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ExperimentalFeatureInfo proto.InternalMessageInfo
+
+func (m *ExperimentalFeatureInfo) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *ExperimentalFeatureInfo) GetNumOfModules() uint32 {
+	if m != nil && m.NumOfModules != nil {
+		return *m.NumOfModules
+	}
+	return 0
+}
+
+func (m *ExperimentalFeatureInfo) GetNumOfEnabledModules() uint32 {
+	if m != nil && m.NumOfEnabledModules != nil {
+		return *m.NumOfEnabledModules
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterEnum("soong_build_metrics.MetricsBase_BuildVariant", MetricsBase_BuildVariant_name, MetricsBase_BuildVariant_value)
 	proto.RegisterEnum("soong_build_metrics.MetricsBase_Arch", MetricsBase_Arch_name, MetricsBase_Arch_value)
@@ -680,68 +774,79 @@ func init() {
 	proto.RegisterType((*ModuleTypeInfo)(nil), "soong_build_metrics.ModuleTypeInfo")
 	proto.RegisterType((*CriticalUserJourneyMetrics)(nil), "soong_build_metrics.CriticalUserJourneyMetrics")
 	proto.RegisterType((*CriticalUserJourneysMetrics)(nil), "soong_build_metrics.CriticalUserJourneysMetrics")
+	proto.RegisterType((*ExperimentalFeatureInfo)(nil), "soong_build_metrics.ExperimentalFeatureInfo")
 }
 
 func init() { proto.RegisterFile("metrics.proto", fileDescriptor_6039342a2ba47b72) }
 
 var fileDescriptor_6039342a2ba47b72 = []byte{
-	// 924 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x56, 0xdf, 0x6e, 0xdb, 0x36,
-	0x17, 0xaf, 0x62, 0x25, 0x96, 0x8e, 0x62, 0x57, 0x65, 0x52, 0x44, 0xfd, 0x8a, 0xe0, 0x33, 0x84,
-	0x75, 0xc8, 0xc5, 0x9a, 0x16, 0x59, 0x11, 0x14, 0x41, 0x31, 0x20, 0x71, 0x82, 0xa0, 0x0b, 0x6c,
-	0x17, 0x4c, 0xdc, 0x15, 0xdb, 0x85, 0x20, 0x4b, 0xb4, 0xa3, 0xce, 0x12, 0x0d, 0x92, 0x2a, 0xe6,
-	0x87, 0xd8, 0x6b, 0xec, 0xcd, 0xf6, 0x1e, 0x03, 0x0f, 0x25, 0x47, 0x01, 0x5c, 0x34, 0xe8, 0x9d,
-	0x74, 0x7e, 0x7f, 0xf8, 0x3b, 0x24, 0x75, 0x6c, 0xe8, 0xe4, 0x4c, 0x89, 0x2c, 0x91, 0x87, 0x0b,
-	0xc1, 0x15, 0x27, 0x3b, 0x92, 0xf3, 0x62, 0x16, 0x4d, 0xca, 0x6c, 0x9e, 0x46, 0x15, 0x14, 0xfe,
-	0x03, 0xe0, 0x0d, 0xcc, 0xf3, 0x59, 0x2c, 0x19, 0x79, 0x0d, 0xbb, 0x86, 0x90, 0xc6, 0x8a, 0x45,
-	0x2a, 0xcb, 0x99, 0x54, 0x71, 0xbe, 0x08, 0xac, 0x9e, 0x75, 0xd0, 0xa2, 0x04, 0xb1, 0xf3, 0x58,
-	0xb1, 0x9b, 0x1a, 0x21, 0xcf, 0xc0, 0x31, 0x8a, 0x2c, 0x0d, 0x36, 0x7a, 0xd6, 0x81, 0x4b, 0xdb,
-	0xf8, 0xfe, 0x3e, 0x25, 0x27, 0xf0, 0x6c, 0x31, 0x8f, 0xd5, 0x94, 0x8b, 0x3c, 0xfa, 0xc2, 0x84,
-	0xcc, 0x78, 0x11, 0x25, 0x3c, 0x65, 0x45, 0x9c, 0xb3, 0xa0, 0x85, 0xdc, 0xbd, 0x9a, 0xf0, 0xd1,
-	0xe0, 0xfd, 0x0a, 0x26, 0x2f, 0xa0, 0xab, 0x62, 0x31, 0x63, 0x2a, 0x5a, 0x08, 0x9e, 0x96, 0x89,
-	0x0a, 0x6c, 0x14, 0x74, 0x4c, 0xf5, 0x83, 0x29, 0x92, 0x14, 0x76, 0x2b, 0x9a, 0x09, 0xf1, 0x25,
-	0x16, 0x59, 0x5c, 0xa8, 0x60, 0xb3, 0x67, 0x1d, 0x74, 0x8f, 0x5e, 0x1e, 0xae, 0xe9, 0xf9, 0xb0,
-	0xd1, 0xef, 0xe1, 0x99, 0x46, 0x3e, 0x1a, 0xd1, 0x49, 0xeb, 0x62, 0x78, 0x49, 0x89, 0xf1, 0x6b,
-	0x02, 0x64, 0x04, 0x5e, 0xb5, 0x4a, 0x2c, 0x92, 0xdb, 0x60, 0x0b, 0xcd, 0x5f, 0x7c, 0xd3, 0xfc,
-	0x54, 0x24, 0xb7, 0x27, 0xed, 0xf1, 0xf0, 0x6a, 0x38, 0xfa, 0x6d, 0x48, 0xc1, 0x58, 0xe8, 0x22,
-	0x39, 0x84, 0x9d, 0x86, 0xe1, 0x2a, 0x75, 0x1b, 0x5b, 0x7c, 0x72, 0x47, 0xac, 0x03, 0xfc, 0x04,
-	0x55, 0xac, 0x28, 0x59, 0x94, 0x2b, 0xba, 0x83, 0x74, 0xdf, 0x20, 0xfd, 0x45, 0x59, 0xb3, 0xaf,
-	0xc0, 0xbd, 0xe5, 0xb2, 0x0a, 0xeb, 0x7e, 0x57, 0x58, 0x47, 0x1b, 0x60, 0x54, 0x0a, 0x1d, 0x34,
-	0x3b, 0x2a, 0x52, 0x63, 0x08, 0xdf, 0x65, 0xe8, 0x69, 0x93, 0xa3, 0x22, 0x45, 0xcf, 0x3d, 0x68,
-	0xa3, 0x27, 0x97, 0x81, 0x87, 0x3d, 0x6c, 0xe9, 0xd7, 0x91, 0x24, 0x61, 0xb5, 0x18, 0x97, 0x11,
-	0xfb, 0x4b, 0x89, 0x38, 0xd8, 0x46, 0xd8, 0x33, 0xf0, 0x85, 0x2e, 0xad, 0x38, 0x89, 0xe0, 0x52,
-	0x6a, 0x8b, 0xce, 0x1d, 0xa7, 0xaf, 0x6b, 0x23, 0x49, 0x7e, 0x84, 0xc7, 0x0d, 0x0e, 0xc6, 0xee,
-	0x9a, 0xeb, 0xb3, 0x62, 0x61, 0x90, 0x97, 0xb0, 0xd3, 0xe0, 0xad, 0x5a, 0x7c, 0x6c, 0x36, 0x76,
-	0xc5, 0x6d, 0xe4, 0xe6, 0xa5, 0x8a, 0xd2, 0x4c, 0x04, 0xbe, 0xc9, 0xcd, 0x4b, 0x75, 0x9e, 0x09,
-	0xf2, 0x0b, 0x78, 0x92, 0xa9, 0x72, 0x11, 0x29, 0xce, 0xe7, 0x32, 0x78, 0xd2, 0x6b, 0x1d, 0x78,
-	0x47, 0xfb, 0x6b, 0xb7, 0xe8, 0x03, 0x13, 0xd3, 0xf7, 0xc5, 0x94, 0x53, 0x40, 0xc5, 0x8d, 0x16,
-	0x90, 0x13, 0x70, 0xff, 0x8c, 0x55, 0x16, 0x89, 0xb2, 0x90, 0x01, 0x79, 0x88, 0xda, 0xd1, 0x7c,
-	0x5a, 0x16, 0x92, 0xbc, 0x03, 0x30, 0x4c, 0x14, 0xef, 0x3c, 0x44, 0xec, 0x22, 0x5a, 0xab, 0x8b,
-	0xac, 0xf8, 0x1c, 0x1b, 0xf5, 0xee, 0x83, 0xd4, 0x28, 0x40, 0xf5, 0xcf, 0xb0, 0xa9, 0xb8, 0x8a,
-	0xe7, 0xc1, 0xd3, 0x9e, 0xf5, 0x6d, 0xa1, 0xe1, 0x92, 0x3e, 0x6c, 0x1b, 0x42, 0xc2, 0x8b, 0x69,
-	0x36, 0x0b, 0xf6, 0x50, 0xdb, 0x5b, 0xab, 0xc5, 0xcf, 0xb0, 0x8f, 0x3c, 0xea, 0x4d, 0xee, 0x5e,
-	0xc2, 0xd7, 0xb0, 0x7d, 0xef, 0x13, 0x75, 0xc0, 0x1e, 0x5f, 0x5f, 0x50, 0xff, 0x11, 0xe9, 0x80,
-	0xab, 0x9f, 0xce, 0x2f, 0xce, 0xc6, 0x97, 0xbe, 0x45, 0xda, 0xa0, 0x3f, 0x6b, 0x7f, 0x23, 0x7c,
-	0x07, 0x36, 0x1e, 0xa2, 0x07, 0xf5, 0xa5, 0xf4, 0x1f, 0x69, 0xf4, 0x94, 0x0e, 0x7c, 0x8b, 0xb8,
-	0xb0, 0x79, 0x4a, 0x07, 0xc7, 0x6f, 0xfc, 0x0d, 0x5d, 0xfb, 0xf4, 0xf6, 0xd8, 0x6f, 0x11, 0x80,
-	0xad, 0x4f, 0x6f, 0x8f, 0xa3, 0xe3, 0x37, 0xbe, 0x1d, 0xce, 0xc0, 0x6b, 0x64, 0xd1, 0x53, 0xaf,
-	0x94, 0x2c, 0x9a, 0xf1, 0x3c, 0xc6, 0xd9, 0xe8, 0xd0, 0x76, 0x29, 0xd9, 0x25, 0xcf, 0x63, 0x7d,
-	0x49, 0x34, 0x24, 0x26, 0x0c, 0xe7, 0xa1, 0x43, 0xb7, 0x4a, 0xc9, 0xe8, 0x84, 0x91, 0x1f, 0xa0,
-	0x3b, 0xe5, 0x22, 0x61, 0xd1, 0x4a, 0xd9, 0x42, 0x7c, 0x1b, 0xab, 0x63, 0x23, 0x0f, 0xff, 0xb6,
-	0xc0, 0xa9, 0x77, 0x8c, 0x10, 0xb0, 0x53, 0x26, 0x13, 0x5c, 0xc2, 0xa5, 0xf8, 0xac, 0x6b, 0x38,
-	0x40, 0xcd, 0xb0, 0xc5, 0x67, 0xb2, 0x0f, 0x20, 0x55, 0x2c, 0x14, 0x4e, 0x6c, 0xb4, 0xb5, 0xa9,
-	0x8b, 0x15, 0x3d, 0xa8, 0xc9, 0x73, 0x70, 0x05, 0x8b, 0xe7, 0x06, 0xb5, 0x11, 0x75, 0x74, 0x01,
-	0xc1, 0x7d, 0x80, 0x9c, 0xe5, 0x5c, 0x2c, 0x75, 0x2e, 0x1c, 0x9c, 0x36, 0x75, 0x4d, 0x65, 0x2c,
-	0x59, 0xf8, 0xaf, 0x05, 0xdd, 0x01, 0x4f, 0xcb, 0x39, 0xbb, 0x59, 0x2e, 0x18, 0xa6, 0xfa, 0xa3,
-	0x3e, 0x40, 0xb9, 0x94, 0x8a, 0xe5, 0x98, 0xae, 0x7b, 0xf4, 0x6a, 0xfd, 0x44, 0xb8, 0x27, 0x35,
-	0xe7, 0x79, 0x8d, 0xb2, 0xc6, 0x6c, 0x98, 0xdc, 0x55, 0xc9, 0xff, 0xc1, 0xcb, 0x51, 0x13, 0xa9,
-	0xe5, 0xa2, 0xee, 0x12, 0xf2, 0x95, 0x8d, 0xde, 0xc6, 0xa2, 0xcc, 0x23, 0x3e, 0x8d, 0x4c, 0x51,
-	0x62, 0xbf, 0x1d, 0xba, 0x5d, 0x94, 0xf9, 0x68, 0x6a, 0xd6, 0x93, 0xe1, 0xab, 0xea, 0xbc, 0x2a,
-	0xd7, 0x7b, 0x87, 0xee, 0xc2, 0xe6, 0xf5, 0x68, 0x34, 0xd4, 0xb7, 0xc3, 0x01, 0x7b, 0x70, 0x7a,
-	0x75, 0xe1, 0x6f, 0x84, 0x73, 0xf8, 0x5f, 0x5f, 0x64, 0x2a, 0x4b, 0xe2, 0xf9, 0x58, 0x32, 0xf1,
-	0x2b, 0x2f, 0x45, 0xc1, 0x96, 0xd5, 0x40, 0x5b, 0x6d, 0xba, 0xd5, 0xd8, 0xf4, 0x13, 0x68, 0x57,
-	0x5d, 0x62, 0xca, 0xaf, 0x5d, 0xe1, 0xc6, 0x4c, 0xa4, 0xb5, 0x20, 0x9c, 0xc0, 0xf3, 0x35, 0xab,
-	0xc9, 0x7a, 0xb9, 0x3e, 0xd8, 0x49, 0xf9, 0x59, 0x06, 0x16, 0x7e, 0x8f, 0xeb, 0x77, 0xf6, 0xeb,
-	0x69, 0x29, 0x8a, 0xcf, 0x9e, 0xfe, 0x5e, 0xfd, 0xe4, 0x57, 0x8a, 0x08, 0xff, 0x07, 0xfc, 0x17,
-	0x00, 0x00, 0xff, 0xff, 0xdd, 0xe8, 0xec, 0xe5, 0x17, 0x08, 0x00, 0x00,
+	// 1083 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x56, 0x5f, 0x6f, 0xdb, 0x36,
+	0x10, 0xaf, 0x6c, 0x27, 0xb6, 0xce, 0x7f, 0xaa, 0x32, 0xe9, 0xa2, 0xb4, 0x2b, 0x66, 0x18, 0xeb,
+	0x90, 0x87, 0x36, 0x2d, 0xd2, 0x22, 0x28, 0x82, 0x62, 0x43, 0xe2, 0x7a, 0x45, 0x17, 0xc4, 0x2e,
+	0xd4, 0xb8, 0x2b, 0xb6, 0x07, 0x82, 0x96, 0x68, 0x47, 0xa9, 0x24, 0x1a, 0x24, 0x95, 0xd5, 0xdf,
+	0x60, 0x2f, 0xfb, 0x98, 0x03, 0xf6, 0x31, 0x06, 0x1e, 0x65, 0xc7, 0x59, 0xdc, 0x35, 0xe8, 0x1b,
+	0x75, 0xbf, 0x3f, 0xbc, 0x23, 0x7d, 0x3c, 0x43, 0x33, 0xe5, 0x5a, 0xc6, 0xa1, 0xda, 0x9d, 0x4a,
+	0xa1, 0x05, 0xd9, 0x50, 0x42, 0x64, 0x13, 0x3a, 0xca, 0xe3, 0x24, 0xa2, 0x05, 0xd4, 0xf9, 0xa7,
+	0x01, 0xf5, 0x13, 0xbb, 0x3e, 0x62, 0x8a, 0x93, 0xa7, 0xb0, 0x69, 0x09, 0x11, 0xd3, 0x9c, 0xea,
+	0x38, 0xe5, 0x4a, 0xb3, 0x74, 0xea, 0x3b, 0x6d, 0x67, 0xa7, 0x1c, 0x10, 0xc4, 0x5e, 0x31, 0xcd,
+	0x4f, 0xe7, 0x08, 0xd9, 0x86, 0x9a, 0x55, 0xc4, 0x91, 0x5f, 0x6a, 0x3b, 0x3b, 0x6e, 0x50, 0xc5,
+	0xef, 0x37, 0x11, 0x39, 0x80, 0xed, 0x69, 0xc2, 0xf4, 0x58, 0xc8, 0x94, 0x5e, 0x70, 0xa9, 0x62,
+	0x91, 0xd1, 0x50, 0x44, 0x3c, 0x63, 0x29, 0xf7, 0xcb, 0xc8, 0xdd, 0x9a, 0x13, 0xde, 0x5b, 0xbc,
+	0x5b, 0xc0, 0xe4, 0x21, 0xb4, 0x34, 0x93, 0x13, 0xae, 0xe9, 0x54, 0x8a, 0x28, 0x0f, 0xb5, 0x5f,
+	0x41, 0x41, 0xd3, 0x46, 0xdf, 0xda, 0x20, 0x89, 0x60, 0xb3, 0xa0, 0xd9, 0x24, 0x2e, 0x98, 0x8c,
+	0x59, 0xa6, 0xfd, 0xb5, 0xb6, 0xb3, 0xd3, 0xda, 0x7b, 0xbc, 0xbb, 0xa2, 0xe6, 0xdd, 0xa5, 0x7a,
+	0x77, 0x8f, 0x0c, 0xf2, 0xde, 0x8a, 0x0e, 0xca, 0xbd, 0xfe, 0xeb, 0x80, 0x58, 0xbf, 0x65, 0x80,
+	0x0c, 0xa0, 0x5e, 0xec, 0xc2, 0x64, 0x78, 0xe6, 0xaf, 0xa3, 0xf9, 0xc3, 0x2f, 0x9a, 0x1f, 0xca,
+	0xf0, 0xec, 0xa0, 0x3a, 0xec, 0x1f, 0xf7, 0x07, 0xbf, 0xf6, 0x03, 0xb0, 0x16, 0x26, 0x48, 0x76,
+	0x61, 0x63, 0xc9, 0x70, 0x91, 0x75, 0x15, 0x4b, 0xbc, 0x73, 0x49, 0x9c, 0x27, 0xf0, 0x08, 0x8a,
+	0xb4, 0x68, 0x38, 0xcd, 0x17, 0xf4, 0x1a, 0xd2, 0x3d, 0x8b, 0x74, 0xa7, 0xf9, 0x9c, 0x7d, 0x0c,
+	0xee, 0x99, 0x50, 0x45, 0xb2, 0xee, 0x57, 0x25, 0x5b, 0x33, 0x06, 0x98, 0x6a, 0x00, 0x4d, 0x34,
+	0xdb, 0xcb, 0x22, 0x6b, 0x08, 0x5f, 0x65, 0x58, 0x37, 0x26, 0x7b, 0x59, 0x84, 0x9e, 0x5b, 0x50,
+	0x45, 0x4f, 0xa1, 0xfc, 0x3a, 0xd6, 0xb0, 0x6e, 0x3e, 0x07, 0x8a, 0x74, 0x8a, 0xcd, 0x84, 0xa2,
+	0xfc, 0x93, 0x96, 0xcc, 0x6f, 0x20, 0x5c, 0xb7, 0x70, 0xcf, 0x84, 0x16, 0x9c, 0x50, 0x0a, 0xa5,
+	0x8c, 0x45, 0xf3, 0x92, 0xd3, 0x35, 0xb1, 0x81, 0x22, 0x3f, 0xc0, 0xed, 0x25, 0x0e, 0xa6, 0xdd,
+	0xb2, 0x3f, 0x9f, 0x05, 0x0b, 0x13, 0x79, 0x0c, 0x1b, 0x4b, 0xbc, 0x45, 0x89, 0xb7, 0xed, 0xc1,
+	0x2e, 0xb8, 0x4b, 0x79, 0x8b, 0x5c, 0xd3, 0x28, 0x96, 0xbe, 0x67, 0xf3, 0x16, 0xb9, 0x7e, 0x15,
+	0x4b, 0xf2, 0x23, 0xd4, 0x15, 0xd7, 0xf9, 0x94, 0x6a, 0x21, 0x12, 0xe5, 0xdf, 0x69, 0x97, 0x77,
+	0xea, 0x7b, 0x0f, 0x56, 0x1e, 0xd1, 0x5b, 0x2e, 0xc7, 0x6f, 0xb2, 0xb1, 0x08, 0x00, 0x15, 0xa7,
+	0x46, 0x40, 0x0e, 0xc0, 0xfd, 0xc8, 0x74, 0x4c, 0x65, 0x9e, 0x29, 0x9f, 0xdc, 0x44, 0x5d, 0x33,
+	0xfc, 0x20, 0xcf, 0x14, 0x79, 0x09, 0x60, 0x99, 0x28, 0xde, 0xb8, 0x89, 0xd8, 0x45, 0x74, 0xae,
+	0xce, 0xe2, 0xec, 0x9c, 0x59, 0xf5, 0xe6, 0x8d, 0xd4, 0x28, 0x40, 0xf5, 0x33, 0x58, 0xd3, 0x42,
+	0xb3, 0xc4, 0xbf, 0xdb, 0x76, 0xbe, 0x2c, 0xb4, 0x5c, 0xd2, 0x85, 0x86, 0x25, 0x84, 0x22, 0x1b,
+	0xc7, 0x13, 0x7f, 0x0b, 0xb5, 0xed, 0x95, 0x5a, 0x6c, 0xc3, 0x2e, 0xf2, 0x82, 0xfa, 0xe8, 0xf2,
+	0x83, 0x1c, 0x03, 0xb9, 0xe0, 0x32, 0x1e, 0xcf, 0x68, 0x9c, 0x4d, 0x73, 0xad, 0x6c, 0xfe, 0xfe,
+	0x4d, 0xf2, 0xf7, 0xac, 0xf0, 0x0d, 0xea, 0xb0, 0x8c, 0x01, 0x6c, 0xc6, 0x99, 0xd2, 0x2c, 0x49,
+	0xe8, 0xb9, 0xc8, 0x65, 0xc6, 0x12, 0x6b, 0xb7, 0x7d, 0x13, 0x3b, 0x52, 0x48, 0x7f, 0xb1, 0x4a,
+	0x34, 0x64, 0x70, 0x97, 0x7f, 0x9a, 0x72, 0x19, 0xa7, 0x3c, 0xd3, 0x2c, 0xa1, 0x63, 0xce, 0x74,
+	0x2e, 0xb9, 0xf2, 0xef, 0xa1, 0xe3, 0xa3, 0x95, 0x8e, 0xbd, 0x25, 0xc5, 0xcf, 0x56, 0x80, 0x1b,
+	0x6c, 0xf2, 0xeb, 0x80, 0x22, 0x3f, 0xc1, 0xb7, 0x13, 0x9e, 0xc9, 0x3c, 0xe1, 0x34, 0xe3, 0xfa,
+	0x0f, 0x21, 0x3f, 0x52, 0x16, 0x86, 0x5c, 0x29, 0x1a, 0x8a, 0x3c, 0xd3, 0xfe, 0xfd, 0xb6, 0xb3,
+	0xd3, 0x0c, 0xb6, 0x0b, 0x4e, 0xdf, 0x52, 0x0e, 0x91, 0xd1, 0x35, 0x84, 0xce, 0x53, 0x68, 0x5c,
+	0x79, 0xe4, 0x6a, 0x50, 0x19, 0xbe, 0xeb, 0x05, 0xde, 0x2d, 0xd2, 0x04, 0xd7, 0xac, 0x5e, 0xf5,
+	0x8e, 0x86, 0xaf, 0x3d, 0x87, 0x54, 0xc1, 0x3c, 0x8c, 0x5e, 0xa9, 0xf3, 0x12, 0x2a, 0xd8, 0x06,
+	0x75, 0x98, 0xb7, 0xb5, 0x77, 0xcb, 0xa0, 0x87, 0xc1, 0x89, 0xe7, 0x10, 0x17, 0xd6, 0x0e, 0x83,
+	0x93, 0xfd, 0xe7, 0x5e, 0xc9, 0xc4, 0x3e, 0xbc, 0xd8, 0xf7, 0xca, 0x04, 0x60, 0xfd, 0xc3, 0x8b,
+	0x7d, 0xba, 0xff, 0xdc, 0xab, 0x74, 0x26, 0x50, 0x5f, 0xba, 0x4d, 0x33, 0x37, 0x72, 0xc5, 0xe9,
+	0x44, 0xa4, 0x0c, 0xa7, 0x4b, 0x2d, 0xa8, 0xe6, 0x8a, 0xbf, 0x16, 0x29, 0x33, 0x6d, 0x66, 0x20,
+	0x39, 0xe2, 0x38, 0x51, 0x6a, 0xc1, 0x7a, 0xae, 0x78, 0x30, 0xe2, 0xe4, 0x7b, 0x68, 0x8d, 0x85,
+	0x0c, 0x39, 0x5d, 0x28, 0xcb, 0x88, 0x37, 0x30, 0x3a, 0xb4, 0xf2, 0xce, 0x5f, 0x0e, 0xd4, 0xe6,
+	0xb7, 0x43, 0x08, 0x54, 0x22, 0xae, 0x42, 0xdc, 0xc2, 0x0d, 0x70, 0x6d, 0x62, 0x38, 0x82, 0xec,
+	0xb8, 0xc2, 0x35, 0x79, 0x00, 0xa0, 0x34, 0x93, 0x1a, 0x67, 0x1e, 0xda, 0x56, 0x02, 0x17, 0x23,
+	0x66, 0xd4, 0x91, 0xfb, 0xe0, 0x4a, 0xce, 0x12, 0x8b, 0x56, 0x10, 0xad, 0x99, 0x00, 0x82, 0x0f,
+	0x00, 0x52, 0x9e, 0x0a, 0x39, 0x33, 0x79, 0xe1, 0xe8, 0xa9, 0x04, 0xae, 0x8d, 0x0c, 0x15, 0xef,
+	0xfc, 0xed, 0x40, 0xeb, 0x44, 0x44, 0x79, 0xc2, 0x4f, 0x67, 0x53, 0xbc, 0x52, 0xf2, 0xfb, 0xbc,
+	0x05, 0xd4, 0x4c, 0x69, 0x9e, 0x62, 0x76, 0xad, 0xbd, 0x27, 0xab, 0xdf, 0xd4, 0x2b, 0x52, 0xdb,
+	0x11, 0xef, 0x50, 0xb6, 0xf4, 0xba, 0x8e, 0x2e, 0xa3, 0xe4, 0x3b, 0xa8, 0xa7, 0xa8, 0xa1, 0x7a,
+	0x36, 0x9d, 0x57, 0x09, 0xe9, 0xc2, 0xc6, 0x1c, 0x63, 0x96, 0xa7, 0x54, 0x8c, 0xa9, 0x0d, 0x2a,
+	0xac, 0xb7, 0x19, 0x34, 0xb2, 0x3c, 0x1d, 0x8c, 0xed, 0x7e, 0xaa, 0xf3, 0xa4, 0xb8, 0xaf, 0xc2,
+	0xf5, 0xca, 0xa5, 0xbb, 0xb0, 0xf6, 0x6e, 0x30, 0xe8, 0x9b, 0x5f, 0x47, 0x0d, 0x2a, 0x27, 0x87,
+	0xc7, 0x3d, 0xaf, 0xd4, 0x49, 0xe0, 0x5e, 0x57, 0xc6, 0x3a, 0x0e, 0x59, 0x32, 0x54, 0x5c, 0x62,
+	0x3f, 0xf0, 0x59, 0x31, 0x12, 0x16, 0x87, 0xee, 0x2c, 0x1d, 0xfa, 0x01, 0x54, 0x8b, 0x2a, 0xfd,
+	0xd2, 0xff, 0x3c, 0x02, 0x4b, 0x53, 0x25, 0x98, 0x0b, 0x3a, 0x23, 0xb8, 0xbf, 0x62, 0x37, 0x35,
+	0xdf, 0xae, 0x0b, 0x95, 0x30, 0x3f, 0x57, 0xbe, 0x83, 0x0d, 0xb7, 0xfa, 0x64, 0x3f, 0x9f, 0x6d,
+	0x80, 0xe2, 0xce, 0x9f, 0x0e, 0x6c, 0x7d, 0xa6, 0x2b, 0x57, 0xd6, 0x73, 0xfd, 0x60, 0x4b, 0xd7,
+	0x0f, 0x96, 0x3c, 0x83, 0x6f, 0x0a, 0x16, 0xcf, 0xd8, 0x28, 0xe1, 0xd1, 0x7f, 0xae, 0x61, 0x03,
+	0xd9, 0x3d, 0x8b, 0x15, 0xa2, 0xa3, 0xbb, 0xbf, 0x15, 0xff, 0xdf, 0x8a, 0xe4, 0x29, 0xfe, 0xa9,
+	0xfb, 0x77, 0x00, 0xd6, 0xd5, 0x37, 0xbb, 0xe4, 0x09, 0x00, 0x00,
 }
@@ -46,10 +46,7 @@ func (s *dumbStatusOutput) StartAction(action *status.Action, counts status.Coun
 }
 
 func (s *dumbStatusOutput) FinishAction(result status.ActionResult, counts status.Counts) {
-	str := result.Description
-	if str == "" {
-		str = result.Command
-	}
+	str := s.formatter.describe(result.Action)
 
 	progress := s.formatter.progress(counts) + str
 
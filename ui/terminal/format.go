@@ -23,23 +23,36 @@ import (
 )
 
 type formatter struct {
-	format string
-	quiet  bool
-	start  time.Time
+	format       string
+	quiet        bool
+	showCommands bool
+	start        time.Time
 }
 
 // newFormatter returns a formatter for formatting output to
 // the terminal in a format similar to Ninja.
 // format takes nearly all the same options as NINJA_STATUS.
 // %c is currently unsupported.
-func newFormatter(format string, quiet bool) formatter {
+// If showCommands is set the command of each action is printed
+// instead of its description.
+func newFormatter(format string, quiet, showCommands bool) formatter {
 	return formatter{
-		format: format,
-		quiet:  quiet,
-		start:  time.Now(),
+		format:       format,
+		quiet:        quiet,
+		showCommands: showCommands,
+		start:        time.Now(),
 	}
 }
 
+// describe returns the string that is printed for an action, which
+// is its description unless it has none or commands were requested.
+func (s formatter) describe(action *status.Action) string {
+	if action.Description == "" || (s.showCommands && action.Command != "") {
+		return action.Command
+	}
+	return action.Description
+}
+
 func (s formatter) message(level status.MsgLevel, message string) string {
 	if level >= status.ErrorLvl {
 		return fmt.Sprintf("FAILED: %s", message)
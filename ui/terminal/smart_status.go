@@ -122,10 +122,7 @@ func (s *smartStatusOutput) Message(level status.MsgLevel, message string) {
 func (s *smartStatusOutput) StartAction(action *status.Action, counts status.Counts) {
 	startTime := time.Now()
 
-	str := action.Description
-	if str == "" {
-		str = action.Command
-	}
+	str := s.formatter.describe(action)
 
 	progress := s.formatter.progress(counts)
 
@@ -141,10 +138,7 @@ func (s *smartStatusOutput) StartAction(action *status.Action, counts status.Cou
 }
 
 func (s *smartStatusOutput) FinishAction(result status.ActionResult, counts status.Counts) {
-	str := result.Description
-	if str == "" {
-		str = result.Command
-	}
+	str := s.formatter.describe(result.Action)
 
 	progress := s.formatter.progress(counts) + str
 
@@ -355,10 +349,7 @@ func (s *smartStatusOutput) actionTable() {
 
 			seconds := int(time.Since(runningAction.startTime).Round(time.Second).Seconds())
 
-			desc := runningAction.action.Description
-			if desc == "" {
-				desc = runningAction.action.Command
-			}
+			desc := s.formatter.describe(runningAction.action)
 
 			color := ""
 			if seconds >= 60 {
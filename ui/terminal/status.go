@@ -26,8 +26,11 @@ import (
 //
 // statusFormat takes nearly all the same options as NINJA_STATUS.
 // %c is currently unsupported.
-func NewStatusOutput(w io.Writer, statusFormat string, forceDumbOutput, quietBuild bool) status.StatusOutput {
-	formatter := newFormatter(statusFormat, quietBuild)
+//
+// showCommands prints the command of each action instead of its
+// description.
+func NewStatusOutput(w io.Writer, statusFormat string, forceDumbOutput, quietBuild, showCommands bool) status.StatusOutput {
+	formatter := newFormatter(statusFormat, quietBuild, showCommands)
 
 	if !forceDumbOutput && isSmartTerminal(w) {
 		return NewSmartStatusOutput(w, formatter)
@@ -94,7 +94,7 @@ func TestStatusOutput(t *testing.T) {
 
 			t.Run("smart", func(t *testing.T) {
 				smart := &fakeSmartTerminal{termWidth: 40}
-				stat := NewStatusOutput(smart, "", false, false)
+				stat := NewStatusOutput(smart, "", false, false, false)
 				tt.calls(stat)
 				stat.Flush()
 
@@ -105,7 +105,7 @@ func TestStatusOutput(t *testing.T) {
 
 			t.Run("dumb", func(t *testing.T) {
 				dumb := &bytes.Buffer{}
-				stat := NewStatusOutput(dumb, "", false, false)
+				stat := NewStatusOutput(dumb, "", false, false, false)
 				tt.calls(stat)
 				stat.Flush()
 
@@ -116,7 +116,7 @@ func TestStatusOutput(t *testing.T) {
 
 			t.Run("force dumb", func(t *testing.T) {
 				smart := &fakeSmartTerminal{termWidth: 40}
-				stat := NewStatusOutput(smart, "", true, false)
+				stat := NewStatusOutput(smart, "", true, false, false)
 				tt.calls(stat)
 				stat.Flush()
 
@@ -265,11 +265,33 @@ func actionWithOuptutWithAnsiCodes(stat status.StatusOutput) {
 	runner.finishAction(result1WithOutputWithAnsiCodes)
 }
 
+func TestStatusOutputShowCommands(t *testing.T) {
+	dumb := &bytes.Buffer{}
+	stat := NewStatusOutput(dumb, "", false, false, true)
+
+	runner := newRunner(stat, 2)
+
+	action := &status.Action{Description: "action1", Command: "touch f1"}
+	runner.startAction(action)
+	runner.finishAction(status.ActionResult{Action: action})
+
+	// Actions without a command still print their description.
+	action = &status.Action{Description: "action2"}
+	runner.startAction(action)
+	runner.finishAction(status.ActionResult{Action: action})
+
+	stat.Flush()
+
+	if g, w := dumb.String(), "[ 50% 1/2] touch f1\n[100% 2/2] action2\n"; g != w {
+		t.Errorf("want:\n%q\ngot:\n%q", w, g)
+	}
+}
+
 func TestSmartStatusOutputWidthChange(t *testing.T) {
 	os.Setenv(tableHeightEnVar, "")
 
 	smart := &fakeSmartTerminal{termWidth: 40}
-	stat := NewStatusOutput(smart, "", false, false)
+	stat := NewStatusOutput(smart, "", false, false, false)
 	smartStat := stat.(*smartStatusOutput)
 	smartStat.sigwinchHandled = make(chan bool)
 